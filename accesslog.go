@@ -0,0 +1,151 @@
+package traefik_modifier_plugin
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// AccessLogConfig holds the access log enrichment configuration
+type AccessLogConfig struct {
+	HeaderPrefix string `json:"header_prefix,omitempty"`
+}
+
+// AccessLogEnricher places modifier results into request headers so that
+// Traefik access log header capture can record them
+type AccessLogEnricher struct {
+	prefix string
+}
+
+// accessLogRecord collects what happened to a single request. Upstream
+// callbacks such as retries may run on batch goroutines, so it is guarded
+// by a mutex.
+type accessLogRecord struct {
+	mu        sync.Mutex
+	templates []string
+	flags     []string
+}
+
+// NewAccessLogEnricher creates a new access log enricher
+func NewAccessLogEnricher(config *AccessLogConfig) *AccessLogEnricher {
+	prefix := config.HeaderPrefix
+	if prefix == "" {
+		prefix = "X-Modifier-"
+	}
+	return &AccessLogEnricher{prefix: prefix}
+}
+
+// newRecord starts a record for a request. A nil enricher returns a nil record.
+func (e *AccessLogEnricher) newRecord() *accessLogRecord {
+	if e == nil {
+		return nil
+	}
+	return &accessLogRecord{}
+}
+
+// strip removes the request headers with the prefix sent by the client, so
+// the access log only records values set by the plugin
+func (e *AccessLogEnricher) strip(req *http.Request) {
+	if e == nil {
+		return
+	}
+	for name := range req.Header {
+		if len(name) >= len(e.prefix) && strings.EqualFold(name[:len(e.prefix)], e.prefix) {
+			req.Header.Del(name)
+		}
+	}
+}
+
+// apply writes the collected values as request headers
+func (e *AccessLogEnricher) apply(req *http.Request, rule string, record *accessLogRecord) {
+	if e == nil || record == nil {
+		return
+	}
+
+	record.mu.Lock()
+	defer record.mu.Unlock()
+	req.Header.Set(e.prefix+"Rule", rule)
+	if len(record.templates) > 0 {
+		req.Header.Set(e.prefix+"Templates", strings.Join(record.templates, ","))
+	}
+	if len(record.flags) > 0 {
+		req.Header.Set(e.prefix+"Flags", strings.Join(record.flags, ","))
+	}
+}
+
+// fired records that a template produced output
+func (r *accessLogRecord) fired(name string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.templates = append(r.templates, name)
+}
+
+// flag records a modification flag
+func (r *accessLogRecord) flag(name string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.flags = append(r.flags, name)
+}
+
+// snapshot captures request headers and query before modification
+func (r *accessLogRecord) snapshot(req *http.Request) (http.Header, url.Values) {
+	if r == nil {
+		return nil, nil
+	}
+	return req.Header.Clone(), req.URL.Query()
+}
+
+// diffHeaders records header templates whose output changed the request
+func (r *accessLogRecord) diffHeaders(before, after http.Header, templates map[string]*template.Template) {
+	if r == nil {
+		return
+	}
+	var changed []string
+	for name := range templates {
+		if strings.Join(before.Values(name), ",") != strings.Join(after.Values(name), ",") {
+			changed = append(changed, name)
+		}
+	}
+	r.firedAll(phaseHeader, changed)
+}
+
+// diffQuery records query templates whose output changed the request and
+// the parameters removed from it
+func (r *accessLogRecord) diffQuery(before, after url.Values, transforms map[string]string) {
+	if r == nil {
+		return
+	}
+	var changed []string
+	for name := range transforms {
+		if strings.Join(before[name], ",") != strings.Join(after[name], ",") {
+			changed = append(changed, name)
+		}
+	}
+	for name := range before {
+		if _, transformed := transforms[name]; !transformed && !after.Has(name) {
+			changed = append(changed, name)
+		}
+	}
+	r.firedAll(phaseQuery, changed)
+}
+
+// firedAll records the changed template names of a phase and flags the phase
+func (r *accessLogRecord) firedAll(phase string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r.fired(phase + ":" + name)
+	}
+	r.flag(phase)
+}
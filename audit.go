@@ -0,0 +1,411 @@
+package traefik_modifier_plugin
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audit sinks
+const (
+	auditSinkStdout = "stdout"
+	auditSinkFile   = "file"
+	auditSinkHTTP   = "http"
+)
+
+// defaultAuditRedactHeaders are always redacted from audit records
+var defaultAuditRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// AuditConfig holds the audit log configuration. Records hold the original
+// and modified request and response of each request, with the headers of
+// RedactHeaders and the JSON body values of RedactPaths ($.user.password,
+// $.items.*.card) replaced.
+type AuditConfig struct {
+	Sink          string            `json:"sink,omitempty"`
+	Path          string            `json:"path,omitempty"`
+	URL           string            `json:"url,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	RedactHeaders []string          `json:"redact_headers,omitempty"`
+	RedactPaths   []string          `json:"redact_paths,omitempty"`
+	Replacement   string            `json:"replacement,omitempty"`
+	MaxBody       int64             `json:"max_body,omitempty"`
+	Timeout       string            `json:"timeout,omitempty"`
+	QueueSize     int               `json:"queue_size,omitempty"`
+}
+
+// Auditor writes a record of what the plugin changed for each request
+type Auditor struct {
+	sink          string
+	url           string
+	headers       map[string]string
+	redactHeaders map[string]bool
+	redactPaths   [][]string
+	replacement   string
+	maxBody       int64
+	client        *http.Client
+	slots         chan struct{}
+
+	mu   sync.Mutex
+	file io.Writer
+}
+
+// auditEntry collects the record of one request
+type auditEntry struct {
+	auditor *Auditor
+	ctx     *TemplateContext
+	client  *auditResponseWriter
+
+	// Batch fan-out calls the upstream concurrently; the last call is recorded
+	mu     sync.Mutex
+	record auditRecord
+}
+
+// auditRecord is one audit log line
+type auditRecord struct {
+	Time       string        `json:"time"`
+	Middleware string        `json:"middleware"`
+	RequestID  string        `json:"requestID,omitempty"`
+	Method     string        `json:"method"`
+	Path       string        `json:"path"`
+	Request    auditExchange `json:"request"`
+	Response   auditExchange `json:"response"`
+
+	UpstreamDurationMs int64 `json:"upstreamDurationMs,omitempty"`
+}
+
+// auditExchange holds the original and modified side of a request or response
+type auditExchange struct {
+	Original *auditMessage `json:"original,omitempty"`
+	Modified *auditMessage `json:"modified,omitempty"`
+}
+
+// auditMessage is a redacted request or response
+type auditMessage struct {
+	Status      int                 `json:"status,omitempty"`
+	Query       string              `json:"query,omitempty"`
+	Headers     map[string][]string `json:"headers,omitempty"`
+	Body        interface{}         `json:"body,omitempty"`
+	BodyOmitted bool                `json:"bodyOmitted,omitempty"`
+}
+
+// NewAuditor creates the audit log. It defaults to stdout, 64KiB bodies and
+// "[REDACTED]" replacements.
+func NewAuditor(config *AuditConfig) (*Auditor, error) {
+	a := &Auditor{
+		sink:          strings.ToLower(config.Sink),
+		url:           config.URL,
+		headers:       config.Headers,
+		redactHeaders: make(map[string]bool),
+		redactPaths:   splitJSONPaths(config.RedactPaths),
+		replacement:   config.Replacement,
+		maxBody:       config.MaxBody,
+	}
+	if a.replacement == "" {
+		a.replacement = "[REDACTED]"
+	}
+	if a.maxBody <= 0 {
+		a.maxBody = 64 << 10
+	}
+	for _, name := range append(defaultAuditRedactHeaders, config.RedactHeaders...) {
+		a.redactHeaders[http.CanonicalHeaderKey(name)] = true
+	}
+
+	switch a.sink {
+	case "", auditSinkStdout:
+		a.sink = auditSinkStdout
+		a.file = os.Stdout
+	case auditSinkFile:
+		if config.Path == "" {
+			return nil, errors.New("audit path is required for the file sink")
+		}
+		file, err := os.OpenFile(config.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit file: %w", err)
+		}
+		a.file = file
+	case auditSinkHTTP:
+		if u, err := url.Parse(config.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid audit url %q", config.URL)
+		}
+		a.client = &http.Client{Timeout: 5 * time.Second}
+		if config.Timeout != "" {
+			timeout, err := time.ParseDuration(config.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid audit timeout: %w", err)
+			}
+			a.client.Timeout = timeout
+		}
+		queueSize := config.QueueSize
+		if queueSize <= 0 {
+			queueSize = 100
+		}
+		a.slots = make(chan struct{}, queueSize)
+	default:
+		return nil, fmt.Errorf("invalid audit sink %q: expected stdout, file or http", config.Sink)
+	}
+
+	return a, nil
+}
+
+// Start records the original request before any modification and wraps rw
+// so the response sent to the client is recorded
+func (a *Auditor) Start(rw http.ResponseWriter, req *http.Request, ctx *TemplateContext, middleware string) (*auditEntry, http.ResponseWriter) {
+	if a == nil {
+		return nil, rw
+	}
+
+	e := &auditEntry{
+		auditor: a,
+		ctx:     ctx,
+		record: auditRecord{
+			Middleware: middleware,
+			Method:     req.Method,
+			Path:       req.URL.Path,
+		},
+	}
+	e.record.Request.Original = a.requestMessage(req)
+	e.client = &auditResponseWriter{ResponseWriter: rw, limit: a.maxBody}
+	return e, e.client
+}
+
+// requestMessage records the query, headers and body of req, restoring the body
+func (a *Auditor) requestMessage(req *http.Request) *auditMessage {
+	msg := &auditMessage{
+		Query:   req.URL.RawQuery,
+		Headers: a.redactHeader(req.Header),
+	}
+	body, ok := bufferRequestBody(req, a.maxBody)
+	if !ok {
+		msg.BodyOmitted = true
+		return msg
+	}
+	if body != nil {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		msg.Body = a.redactBody(req.Header.Get("Content-Encoding"), body)
+	}
+	return msg
+}
+
+// Handler wraps the upstream so the request it receives and its response
+// are recorded
+func (e *auditEntry) Handler(next http.Handler) http.Handler {
+	if e == nil {
+		return next
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		request := e.auditor.requestMessage(req)
+		aw := &auditResponseWriter{ResponseWriter: rw, limit: e.auditor.maxBody}
+		next.ServeHTTP(aw, req)
+		response := e.auditor.responseMessage(aw)
+
+		e.mu.Lock()
+		e.record.Request.Modified, e.record.Response.Original = request, response
+		e.mu.Unlock()
+	})
+}
+
+// responseMessage records a captured response
+func (a *Auditor) responseMessage(aw *auditResponseWriter) *auditMessage {
+	msg := &auditMessage{
+		Status:      aw.status,
+		Headers:     a.redactHeader(aw.header),
+		BodyOmitted: aw.overflowed,
+	}
+	if msg.Status == 0 {
+		msg.Status = http.StatusOK
+	}
+	if !aw.overflowed && aw.body.Len() > 0 {
+		msg.Body = a.redactBody(aw.header.Get("Content-Encoding"), aw.body.Bytes())
+	}
+	return msg
+}
+
+// finish writes the record of the request
+func (e *auditEntry) finish() {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.record.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	if e.ctx != nil {
+		e.record.RequestID, _ = (*e.ctx)["requestID"].(string)
+		e.record.UpstreamDurationMs, _ = (*e.ctx)[upstreamDurationKey].(int64)
+	}
+	e.record.Response.Modified = e.auditor.responseMessage(e.client)
+
+	line, err := json.Marshal(e.record)
+	if err != nil {
+		requestLog(e.ctx).errorf("audit", "", "Audit record error: %v", err)
+		return
+	}
+	e.auditor.write(line)
+}
+
+// write sends a record to the sink; http records are posted in the
+// background and dropped when the queue is full
+func (a *Auditor) write(line []byte) {
+	if a.sink != auditSinkHTTP {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if _, err := a.file.Write(append(line, '\n')); err != nil {
+			log.Printf("Audit write failed: %v", err)
+		}
+		return
+	}
+
+	select {
+	case a.slots <- struct{}{}:
+	default:
+		log.Printf("Audit queue full, dropping record")
+		return
+	}
+	go func() {
+		defer func() { <-a.slots }()
+		if err := a.post(line); err != nil {
+			log.Printf("Audit post to %s failed: %v", a.url, err)
+		}
+	}()
+}
+
+// post delivers a record to the http sink
+func (a *Auditor) post(line []byte) error {
+	req, err := http.NewRequest(http.MethodPost, a.url, bytes.NewReader(line))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range a.headers {
+		req.Header.Set(name, value)
+	}
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// redactHeader copies header, replacing the values of redacted headers
+func (a *Auditor) redactHeader(header http.Header) map[string][]string {
+	if len(header) == 0 {
+		return nil
+	}
+	result := make(map[string][]string, len(header))
+	for name, values := range header {
+		if a.redactHeaders[http.CanonicalHeaderKey(name)] {
+			result[name] = []string{a.replacement}
+			continue
+		}
+		result[name] = append([]string(nil), values...)
+	}
+	return result
+}
+
+// redactBody decodes a JSON body with the values at the redacted paths
+// replaced; other bodies are recorded as text. Compressed bodies are
+// decompressed first, up to max_body bytes.
+func (a *Auditor) redactBody(encoding string, body []byte) interface{} {
+	if encoding != "" && encoding != "identity" {
+		decoded, err := decodeContentEncoding(encoding, body, a.maxBody)
+		if errors.Is(err, errDecodedTooLarge) {
+			// Recorded as text, like bodies cut at max_body
+			decoded, err = decoded[:a.maxBody], nil
+		}
+		if err != nil {
+			return nil
+		}
+		body = decoded
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return string(body)
+	}
+	return a.redactValue(value, nil)
+}
+
+func (a *Auditor) redactValue(value interface{}, path []string) interface{} {
+	if path != nil && jsonPathMatches(a.redactPaths, path) {
+		return a.replacement
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = a.redactValue(child, append(path[:len(path):len(path)], key))
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = a.redactValue(child, append(path[:len(path):len(path)], strconv.Itoa(i)))
+		}
+	}
+	return value
+}
+
+// auditResponseWriter passes the response through while keeping its
+// status, headers and up to limit bytes of its body
+type auditResponseWriter struct {
+	http.ResponseWriter
+	limit      int64
+	status     int
+	header     http.Header
+	body       bytes.Buffer
+	overflowed bool
+}
+
+func (aw *auditResponseWriter) WriteHeader(statusCode int) {
+	if aw.status == 0 && statusCode >= http.StatusOK {
+		aw.status = statusCode
+		aw.header = aw.ResponseWriter.Header().Clone()
+	}
+	aw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (aw *auditResponseWriter) Write(b []byte) (int, error) {
+	if aw.status == 0 {
+		aw.WriteHeader(http.StatusOK)
+	}
+	if !aw.overflowed {
+		if int64(aw.body.Len()+len(b)) > aw.limit {
+			aw.overflowed = true
+			aw.body.Reset()
+		} else {
+			aw.body.Write(b)
+		}
+	}
+	return aw.ResponseWriter.Write(b)
+}
+
+// Flush forwards flushes of streamed responses
+func (aw *auditResponseWriter) Flush() {
+	if flusher, ok := aw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack forwards connection upgrades
+func (aw *auditResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := aw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
@@ -0,0 +1,87 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestModifier_Audit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	config := CreateConfig()
+	config.Audit = &AuditConfig{Sink: "file", Path: path, RedactPaths: []string{"$.password"}}
+	config.ModifierHeader = HeaderConfig{"X-Method": "[[ .request.method ]]"}
+	config.ModifierRequest = `{"login": "[[ .request.api.body.user ]]", "password": "[[ .request.api.body.password ]]"}`
+	config.ModifierResponse = map[string]string{"200": `{"wrapped": [[ toJSON .response.body ]]}`}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		io.WriteString(rw, `{"id":1}`)
+	}), config, "login")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/login?next=home", strings.NewReader(`{"user": "jane", "password": "hunter2"}`))
+	req.Header.Set("Authorization", "Bearer secret-token")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected an audit file: %v", err)
+	}
+	if strings.Contains(string(data), "hunter2") || strings.Contains(string(data), "secret-token") {
+		t.Errorf("Expected secrets to be redacted, got %s", data)
+	}
+
+	var record auditRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatalf("Invalid audit record %s: %v", data, err)
+	}
+	if record.Middleware != "login" || record.Method != "POST" || record.Path != "/login" {
+		t.Errorf("Unexpected record %+v", record)
+	}
+
+	original, modified := record.Request.Original, record.Request.Modified
+	if original == nil || modified == nil {
+		t.Fatalf("Expected the original and modified request, got %s", data)
+	}
+	if original.Query != "next=home" || original.Headers["Authorization"][0] != "[REDACTED]" {
+		t.Errorf("Unexpected original request %+v", original)
+	}
+	if body, _ := original.Body.(map[string]interface{}); body["user"] != "jane" || body["password"] != "[REDACTED]" {
+		t.Errorf("Unexpected original request body %v", original.Body)
+	}
+	if body, _ := modified.Body.(map[string]interface{}); body["login"] != "jane" || body["password"] != "[REDACTED]" {
+		t.Errorf("Unexpected modified request body %v", modified.Body)
+	}
+	if modified.Headers["X-Method"][0] != "POST" {
+		t.Errorf("Expected the modified request headers, got %v", modified.Headers)
+	}
+
+	if body, _ := record.Response.Original.Body.(map[string]interface{}); body["id"] != float64(1) {
+		t.Errorf("Unexpected original response body %v", record.Response.Original.Body)
+	}
+	if body, _ := record.Response.Modified.Body.(map[string]interface{}); body["wrapped"] == nil || record.Response.Modified.Status != http.StatusOK {
+		t.Errorf("Unexpected modified response %+v", record.Response.Modified)
+	}
+}
+
+func TestNewAuditor_Invalid(t *testing.T) {
+	for _, config := range []*AuditConfig{
+		{Sink: "syslog"},
+		{Sink: "file"},
+		{Sink: "http", URL: "not a url"},
+		{Sink: "http", URL: "http://audit.local", Timeout: "soon"},
+	} {
+		if _, err := NewAuditor(config); err == nil {
+			t.Errorf("Expected error for %+v", config)
+		}
+	}
+}
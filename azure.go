@@ -0,0 +1,115 @@
+package traefik_modifier_plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const defaultAzureAuthority = "https://login.microsoftonline.com"
+
+// AzureADConfig holds the Azure AD client credentials configuration
+type AzureADConfig struct {
+	TenantID     string `json:"tenant_id,omitempty"`
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	Authority    string `json:"authority,omitempty"`
+	Timeout      string `json:"timeout,omitempty"`
+}
+
+// AzureADProvider obtains app-only access tokens from Azure AD using the
+// client credentials grant
+type AzureADProvider struct {
+	tokenURL string
+	config   *AzureADConfig
+	client   *http.Client
+	token    *cachedToken
+}
+
+// NewAzureADProvider creates a new Azure AD token provider
+func NewAzureADProvider(config *AzureADConfig) (*AzureADProvider, error) {
+	if config.TenantID == "" || config.ClientID == "" || config.ClientSecret == "" {
+		return nil, errors.New("azure ad tenant_id, client_id and client_secret are required")
+	}
+	if config.Scope == "" {
+		return nil, errors.New("azure ad scope is required")
+	}
+
+	authority := strings.TrimRight(config.Authority, "/")
+	if authority == "" {
+		authority = defaultAzureAuthority
+	}
+
+	p := &AzureADProvider{
+		tokenURL: authority + "/" + url.PathEscape(config.TenantID) + "/oauth2/v2.0/token",
+		config:   config,
+		client:   &http.Client{Timeout: 5 * time.Second},
+	}
+
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid azure ad timeout: %w", err)
+		}
+		p.client.Timeout = timeout
+	}
+
+	p.token = newCachedToken(p.fetch)
+	return p, nil
+}
+
+// FuncMap returns the Azure AD template functions
+func (p *AzureADProvider) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"azureToken": p.Token,
+	}
+}
+
+// Token returns a cached access token, refreshing it before expiry
+func (p *AzureADProvider) Token() (string, error) {
+	return p.token.Token()
+}
+
+// fetch requests a new access token from the token endpoint
+func (p *AzureADProvider) fetch() (string, time.Time, error) {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {p.config.ClientID},
+		"client_secret": {p.config.ClientSecret},
+		"scope":         {p.config.Scope},
+	}
+
+	res, err := p.client.PostForm(p.tokenURL, form)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("azure ad: %w", err)
+	}
+	defer res.Body.Close()
+
+	var resp struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return "", time.Time{}, fmt.Errorf("azure ad: invalid response (status %d): %w", res.StatusCode, err)
+	}
+	if res.StatusCode != http.StatusOK || resp.AccessToken == "" {
+		if resp.Error != "" {
+			return "", time.Time{}, fmt.Errorf("azure ad: %s: %s", resp.Error, resp.ErrorDescription)
+		}
+		return "", time.Time{}, fmt.Errorf("azure ad: token endpoint returned %d", res.StatusCode)
+	}
+
+	expiresIn := time.Hour
+	if resp.ExpiresIn > 0 {
+		expiresIn = time.Duration(resp.ExpiresIn) * time.Second
+	}
+	return resp.AccessToken, time.Now().Add(expiresIn), nil
+}
@@ -0,0 +1,63 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAzureADProvider_HeaderTemplate(t *testing.T) {
+	calls := 0
+	aad := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls++
+		req.ParseForm()
+		if req.URL.Path != "/contoso/oauth2/v2.0/token" || req.Form.Get("grant_type") != "client_credentials" ||
+			req.Form.Get("client_secret") != "secret" || req.Form.Get("scope") != "https://graph.microsoft.com/.default" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			rw.Write([]byte(`{"error": "invalid_client", "error_description": "AADSTS7000215"}`))
+			return
+		}
+		rw.Write([]byte(`{"token_type": "Bearer", "expires_in": 3599, "access_token": "graph-token"}`))
+	}))
+	defer aad.Close()
+
+	config := CreateConfig()
+	config.AzureAD = &AzureADConfig{
+		TenantID:     "contoso",
+		ClientID:     "gateway",
+		ClientSecret: "secret",
+		Scope:        "https://graph.microsoft.com/.default",
+		Authority:    aad.URL,
+	}
+	config.ModifierHeader = HeaderConfig{"Authorization": "Bearer [[ azureToken ]]"}
+
+	var authorization []string
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		authorization = append(authorization, req.Header.Get("Authorization"))
+		io.WriteString(rw, "ok")
+	})
+
+	handler, err := New(context.Background(), next, config, "graph")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/me", nil))
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected access token to be cached, got %d calls", calls)
+	}
+	for _, value := range authorization {
+		if value != "Bearer graph-token" {
+			t.Errorf("Unexpected Authorization %q", value)
+		}
+	}
+
+	p, _ := NewAzureADProvider(&AzureADConfig{TenantID: "contoso", ClientID: "gateway", ClientSecret: "wrong", Scope: "x", Authority: aad.URL})
+	if _, err := p.Token(); err == nil || err.Error() != "azure ad: invalid_client: AADSTS7000215" {
+		t.Errorf("Expected invalid_client error, got %v", err)
+	}
+}
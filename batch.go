@@ -0,0 +1,283 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// BatchConfig holds the batch fan-out configuration
+type BatchConfig struct {
+	PathPrefix   string `json:"path_prefix,omitempty"`
+	Method       string `json:"method,omitempty"`
+	PathTemplate string `json:"path_template,omitempty"`
+	ItemTemplate string `json:"item_template,omitempty"`
+	Concurrency  int    `json:"concurrency,omitempty"`
+	MaxItems     int    `json:"max_items,omitempty"`
+}
+
+// BatchFanOut splits JSON array requests into one upstream call per item
+// and aggregates the responses into an array
+type BatchFanOut struct {
+	pathPrefix   string
+	method       string
+	pathTemplate *template.Template
+	pathBase     string
+	itemTemplate *template.Template
+	concurrency  int
+	maxItems     int
+}
+
+// batchResult is the aggregated response of a single item
+type batchResult struct {
+	Status int         `json:"status"`
+	Body   interface{} `json:"body,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// defaultBatchMaxBody is the largest batch body read when no request body
+// limit is configured
+const defaultBatchMaxBody = 1 << 20
+
+// batchResponseWriter records the response of a single item
+type batchResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// NewBatchFanOut creates a new batch fan-out
+func NewBatchFanOut(config *BatchConfig, funcs template.FuncMap) (*BatchFanOut, error) {
+	b := &BatchFanOut{
+		pathPrefix:  config.PathPrefix,
+		method:      strings.ToUpper(config.Method),
+		concurrency: config.Concurrency,
+		maxItems:    config.MaxItems,
+	}
+	if b.concurrency <= 0 {
+		b.concurrency = 4
+	}
+	if b.maxItems <= 0 {
+		b.maxItems = 100
+	}
+
+	if config.PathTemplate != "" {
+		tmpl, err := template.New("batch[path]").Funcs(funcs).Delims("[[", "]]").Parse(config.PathTemplate)
+		if err != nil {
+			return nil, newTemplateError("batch[path]", err)
+		}
+		b.pathTemplate = tmpl
+		b.pathBase = templatePathBase(config.PathTemplate)
+	}
+	if config.ItemTemplate != "" {
+		tmpl, err := template.New("batch[item]").Funcs(funcs).Delims("[[", "]]").Parse(config.ItemTemplate)
+		if err != nil {
+			return nil, newTemplateError("batch[item]", err)
+		}
+		b.itemTemplate = tmpl
+	}
+
+	return b, nil
+}
+
+// templatePathBase returns the directory of the literal text before the
+// first action of a path template; rendered paths must stay below it
+func templatePathBase(pathTemplate string) string {
+	literal := pathTemplate
+	if i := strings.Index(literal, "[["); i >= 0 {
+		literal = literal[:i]
+	}
+	return literal[:strings.LastIndex(literal, "/")+1]
+}
+
+// Handler wraps next so requests with a JSON array body are fanned out to
+// next one item at a time. Other requests pass through unchanged. Bodies
+// are read up to limit bytes (0 uses defaultBatchMaxBody); larger arrays
+// are rejected and other large bodies are streamed to next.
+func (b *BatchFanOut) Handler(next http.Handler, limit int64, ctx *TemplateContext, errs *pluginErrors, onBatch func(int)) http.Handler {
+	if limit <= 0 {
+		limit = defaultBatchMaxBody
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Body == nil || !strings.HasPrefix(req.URL.Path, b.pathPrefix) {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+		if err != nil {
+			req.Body.Close()
+			errs.write(rw, http.StatusBadRequest, "Batch request error", err)
+			return
+		}
+		if int64(len(body)) > limit {
+			if bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+				req.Body.Close()
+				errs.write(rw, http.StatusRequestEntityTooLarge, "Batch request error",
+					fmt.Errorf("batch body exceeds %d bytes", limit))
+				return
+			}
+			req.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+			next.ServeHTTP(rw, req)
+			return
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		var items []interface{}
+		if !bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) || json.Unmarshal(body, &items) != nil {
+			next.ServeHTTP(rw, req)
+			return
+		}
+		if len(items) > b.maxItems {
+			errs.write(rw, http.StatusRequestEntityTooLarge, "Batch request error",
+				fmt.Errorf("batch has %d items, the limit is %d", len(items), b.maxItems))
+			return
+		}
+		if onBatch != nil {
+			onBatch(len(items))
+		}
+
+		results := make([]batchResult, len(items))
+		semaphore := make(chan struct{}, b.concurrency)
+		var wg sync.WaitGroup
+		for i, item := range items {
+			wg.Add(1)
+			semaphore <- struct{}{}
+			go func(i int, item interface{}) {
+				defer wg.Done()
+				defer func() { <-semaphore }()
+				results[i] = b.call(next, req, ctx, i, item)
+			}(i, item)
+		}
+		wg.Wait()
+
+		status := http.StatusOK
+		for _, result := range results {
+			if result.Status < 200 || result.Status > 299 {
+				status = http.StatusMultiStatus
+				break
+			}
+		}
+
+		aggregated, err := json.Marshal(results)
+		if err != nil {
+			errs.write(rw, http.StatusInternalServerError, "Batch response error", err)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Set("Content-Length", strconv.Itoa(len(aggregated)))
+		rw.Header().Del("Content-Encoding")
+		rw.WriteHeader(status)
+		rw.Write(aggregated)
+	})
+}
+
+// call sends a single item to next and records its response
+func (b *BatchFanOut) call(next http.Handler, req *http.Request, ctx *TemplateContext, index int, item interface{}) batchResult {
+	templateData := buildTemplateData(ctx, map[string]interface{}{
+		"request": requestTemplateData(req),
+		"item":    item,
+		"index":   index,
+	})
+
+	var body []byte
+	if b.itemTemplate != nil {
+		buf := newTemplateOutput(ctx)
+		err := b.itemTemplate.Execute(buf, templateData)
+		body = append([]byte(nil), buf.Bytes()...)
+		buf.release()
+		if err != nil {
+			return batchResult{Status: http.StatusInternalServerError, Error: newTemplateError("batch[item]", err).Error()}
+		}
+	} else {
+		encoded, err := json.Marshal(item)
+		if err != nil {
+			return batchResult{Status: http.StatusBadRequest, Error: err.Error()}
+		}
+		body = encoded
+	}
+
+	itemReq := req.Clone(req.Context())
+	if b.method != "" {
+		itemReq.Method = b.method
+	}
+	if b.pathTemplate != nil {
+		buf := newTemplateOutput(ctx)
+		err := b.pathTemplate.Execute(buf, templateData)
+		rendered := strings.TrimSpace(buf.String())
+		buf.release()
+		if err != nil {
+			return batchResult{Status: http.StatusInternalServerError, Error: newTemplateError("batch[path]", err).Error()}
+		}
+		itemPath, err := b.cleanPath(rendered)
+		if err != nil {
+			return batchResult{Status: http.StatusBadRequest, Error: err.Error()}
+		}
+		itemReq.URL.Path = itemPath
+		itemReq.URL.RawPath = ""
+		itemReq.RequestURI = itemReq.URL.RequestURI()
+	}
+	itemReq.Body = io.NopCloser(bytes.NewReader(body))
+	itemReq.ContentLength = int64(len(body))
+	itemReq.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	itemReq.Header.Del("Accept-Encoding")
+
+	bw := &batchResponseWriter{header: make(http.Header)}
+	next.ServeHTTP(bw, itemReq)
+
+	result := batchResult{Status: bw.status}
+	if result.Status == 0 {
+		result.Status = http.StatusOK
+	}
+	if bw.body.Len() > 0 {
+		var decoded interface{}
+		if json.Unmarshal(bw.body.Bytes(), &decoded) == nil {
+			result.Body = decoded
+		} else {
+			result.Body = bw.body.String()
+		}
+	}
+	return result
+}
+
+// cleanPath resolves dot segments in a rendered item path and rejects paths
+// that leave the literal directory of the path template, so item values
+// such as "../admin" cannot reach other upstream routes
+func (b *BatchFanOut) cleanPath(rendered string) (string, error) {
+	cleaned := path.Clean("/" + rendered)
+	if strings.HasSuffix(rendered, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	if !strings.HasPrefix(cleaned, b.pathBase) {
+		return "", fmt.Errorf("batch path %q is outside %q", rendered, b.pathBase)
+	}
+	return cleaned, nil
+}
+
+func (bw *batchResponseWriter) Header() http.Header {
+	return bw.header
+}
+
+func (bw *batchResponseWriter) WriteHeader(statusCode int) {
+	if bw.status == 0 {
+		bw.status = statusCode
+	}
+}
+
+func (bw *batchResponseWriter) Write(b []byte) (int, error) {
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+	return bw.body.Write(b)
+}
@@ -0,0 +1,95 @@
+package traefik_modifier_plugin
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hukumonline-com/traefik-modifier-plugin/pkg"
+)
+
+func TestBatchFanOut_Handler(t *testing.T) {
+	b, err := NewBatchFanOut(&BatchConfig{
+		PathPrefix:   "/users/batch",
+		Method:       "PUT",
+		PathTemplate: "/users/[[ .item.id ]]",
+		ItemTemplate: `{"name": "[[ .item.name ]]", "position": [[ .index ]]}`,
+		Concurrency:  2,
+		MaxItems:     3,
+	}, pkg.SimpleFuncMap())
+	if err != nil {
+		t.Fatalf("NewBatchFanOut() error = %v", err)
+	}
+
+	var mu sync.Mutex
+	active, maxActive := 0, 0
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			active--
+			mu.Unlock()
+		}()
+
+		if req.URL.Path == "/users/404" {
+			http.Error(rw, "not found", http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		rw.Header().Set("Content-Type", "application/json")
+		io.WriteString(rw, `{"method": "`+req.Method+`", "path": "`+req.URL.Path+`", "received": `+string(body)+`}`)
+	})
+	handler := b.Handler(next, 256, &TemplateContext{}, nil, nil)
+
+	call := func(target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", target, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := call("/users/batch", `[{"id": 1, "name": "ana"}, {"id": 404, "name": "budi"}, {"id": 3, "name": "citra"}]`)
+	expected := `[{"status":200,"body":{"method":"PUT","path":"/users/1","received":{"name":"ana","position":0}}},` +
+		`{"status":404,"body":"not found\n"},` +
+		`{"status":200,"body":{"method":"PUT","path":"/users/3","received":{"name":"citra","position":2}}}]`
+	if rec.Code != http.StatusMultiStatus || rec.Body.String() != expected {
+		t.Errorf("Unexpected batch response %d:\n%s\nexpected:\n%s", rec.Code, rec.Body.String(), expected)
+	}
+	if maxActive > 2 {
+		t.Errorf("Expected at most 2 concurrent calls, got %d", maxActive)
+	}
+
+	// Batches above the limit are rejected
+	if rec := call("/users/batch", `[1, 2, 3, 4]`); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413, got %d", rec.Code)
+	}
+
+	// Arrays above the body limit are rejected before they are parsed
+	if rec := call("/users/batch", `[{"name": "`+strings.Repeat("x", 256)+`"}]`); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a large batch body, got %d", rec.Code)
+	}
+
+	// Item paths cannot leave the directory of the path template
+	rec = call("/users/batch", `[{"id": "../admin"}, {"id": "2/../../admin"}, {"id": "7/../8", "name": "dian"}]`)
+	expected = `[{"status":400,"error":"batch path \"/users/../admin\" is outside \"/users/\""},` +
+		`{"status":400,"error":"batch path \"/users/2/../../admin\" is outside \"/users/\""},` +
+		`{"status":200,"body":{"method":"PUT","path":"/users/8","received":{"name":"dian","position":2}}}]`
+	if rec.Code != http.StatusMultiStatus || rec.Body.String() != expected {
+		t.Errorf("Unexpected traversal response %d:\n%s\nexpected:\n%s", rec.Code, rec.Body.String(), expected)
+	}
+
+	// Objects and other paths pass through
+	if rec := call("/users/batch", `{"id": 1}`); !strings.Contains(rec.Body.String(), `"path": "/users/batch"`) {
+		t.Errorf("Expected passthrough, got %s", rec.Body.String())
+	}
+	if rec := call("/users/batch", `{"name": "`+strings.Repeat("x", 256)+`"}`); !strings.Contains(rec.Body.String(), `"path": "/users/batch"`) {
+		t.Errorf("Expected large objects to pass through, got %s", rec.Body.String())
+	}
+}
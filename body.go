@@ -1,12 +1,25 @@
 package traefik_modifier_plugin
 
 import (
+	"bufio"
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"text/template"
 
 	"github.com/hukumonline-com/traefik-modifier-plugin/pkg"
@@ -14,95 +27,872 @@ import (
 
 // BodyModifier handles request and response body modifications
 type BodyModifier struct {
-	templateRequest  string
-	templateResponse map[int]string
+	templateRequest    string
+	templateResponse   map[string]string
+	requestTemplate    *template.Template
+	responseTemplates  map[string]*template.Template
+	parseErr           error
+	parseErrs          map[string]error
+	requestProgram     *bodyExpression
+	responsePrograms   map[string]*bodyExpression
+	responseConditions map[string][]*responseCondition
+	maskedHeaders      *maskedHeaders
+	responseRanges     []statusRange
+	requestFormat      string
+	maxBuffer          int64
+	maxRequestBody     int64
+	maxResponseBody    int64
+	limitAction        string
+	limitTemplate      *template.Template
+	streamTypes        []string
+	streamTemplate     *template.Template
+	funcs              template.FuncMap
+}
+
+// Request body formats
+const (
+	bodyFormatJSON = "json"
+	bodyFormatForm = "form"
+)
+
+// errBodyStreamed is returned when a request body is larger than the buffer
+// limit and is forwarded unmodified
+var errBodyStreamed = errors.New("request body exceeds max_buffer_bytes, streaming unmodified")
+
+// defaultMaxDecodedBytes caps decompressed bodies when no body limit is
+// configured, so a small compressed body cannot expand without bound
+const defaultMaxDecodedBytes = 32 << 20
+
+// errDecodedTooLarge is returned with the bytes read so far when a
+// decompressed body grows past its limit
+var errDecodedTooLarge = errors.New("decompressed body exceeds the body limit")
+
+// defaultResponseKey is the ModifierResponse key used when no status key matches
+const defaultResponseKey = "default"
+
+// statusRange is a ModifierResponse key resolved to the status codes,
+// content types and request paths it covers
+type statusRange struct {
+	key        string
+	low, high  int
+	fallback   bool
+	mediaTypes []string
+	paths      []string
+	pathRegex  []*regexp.Regexp
 }
 
 // NewBodyModifier creates a new body modifier instance
-func NewBodyModifier(templateRequest string, templateResponse map[int]string) *BodyModifier {
-	return &BodyModifier{
-		templateRequest:  templateRequest,
-		templateResponse: templateResponse,
+func NewBodyModifier(templateRequest string, templateResponse map[string]string) *BodyModifier {
+	return NewBodyModifierWithFuncs(templateRequest, templateResponse, pkg.SimpleFuncMap())
+}
+
+// NewBodyModifierWithFuncs creates a new body modifier instance using the given template functions
+func NewBodyModifierWithFuncs(templateRequest string, templateResponse map[string]string, funcs template.FuncMap) *BodyModifier {
+	bm := &BodyModifier{
+		templateRequest:   templateRequest,
+		templateResponse:  templateResponse,
+		responseTemplates: make(map[string]*template.Template, len(templateResponse)),
+		limitAction:       bodyLimitReject,
+		streamTypes:       []string{"text/event-stream"},
+		funcs:             funcs,
+	}
+
+	// Parse the templates once, in key order so the reported error is stable
+	if templateRequest != "" {
+		bm.requestTemplate = bm.parseTemplate("modifier_request", templateRequest)
+	}
+	keys := make([]string, 0, len(templateResponse))
+	for key := range templateResponse {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if tmpl := bm.parseTemplate(fmt.Sprintf("modifier_response[%s]", key), templateResponse[key]); tmpl != nil {
+			bm.responseTemplates[key] = tmpl
+		}
+		bm.addResponseKey("modifier_response", key)
 	}
+	bm.sortResponseRanges()
+
+	return bm
+}
+
+// parseTemplate parses the body template configured under name. Failures
+// are kept for Validate and for the requests that would have used the
+// template, and nil is returned.
+func (bm *BodyModifier) parseTemplate(name, source string) *template.Template {
+	tmpl, err := template.New(name).Funcs(bm.funcs).Delims("[[", "]]").Parse(source)
+	if err != nil {
+		err = newTemplateError(name, err)
+		log.Printf("Error parsing body template %s: %v", name, err)
+		if bm.parseErrs == nil {
+			bm.parseErrs = make(map[string]error)
+		}
+		bm.parseErrs[name] = err
+		if bm.parseErr == nil {
+			bm.parseErr = err
+		}
+		return nil
+	}
+	return tmpl
+}
+
+// addResponseKey registers a status key of modifier_response or
+// modifier_response_jq. The status may be followed by content types the
+// upstream response must have and request path globs or ~regexes, such as
+// "200 application/json /users/*".
+func (bm *BodyModifier) addResponseKey(field, key string) {
+	fields := strings.Fields(key)
+	if len(fields) == 0 {
+		log.Printf("Ignoring %s[%s]: expected a status code, class such as 4xx, range such as 400-499 or default", field, key)
+		return
+	}
+
+	r := statusRange{key: key}
+	if strings.EqualFold(fields[0], defaultResponseKey) {
+		r.fallback = true
+	} else {
+		var ok bool
+		if r.low, r.high, ok = parseStatusKey(fields[0]); !ok {
+			log.Printf("Ignoring %s[%s]: expected a status code, class such as 4xx, range such as 400-499 or default", field, key)
+			return
+		}
+	}
+	for _, value := range fields[1:] {
+		// Regexes may contain commas, so they are not split
+		if strings.HasPrefix(value, "~") {
+			re, err := regexp.Compile(value[1:])
+			if err != nil {
+				log.Printf("Ignoring %s[%s]: invalid path regex: %v", field, key, err)
+				return
+			}
+			r.pathRegex = append(r.pathRegex, re)
+			continue
+		}
+		for _, pattern := range strings.Split(value, ",") {
+			pattern = strings.TrimSpace(pattern)
+			switch {
+			case pattern == "":
+			case strings.HasPrefix(pattern, "/"):
+				if _, err := path.Match(pattern, ""); err != nil {
+					log.Printf("Ignoring %s[%s]: invalid path glob %q", field, key, pattern)
+					return
+				}
+				r.paths = append(r.paths, pattern)
+			default:
+				mediaType := strings.ToLower(pattern)
+				if _, err := path.Match(mediaType, ""); err != nil || !strings.Contains(mediaType, "/") {
+					log.Printf("Ignoring %s[%s]: invalid content type %q", field, key, pattern)
+					return
+				}
+				r.mediaTypes = append(r.mediaTypes, mediaType)
+			}
+		}
+	}
+	bm.responseRanges = append(bm.responseRanges, r)
+}
+
+// sortResponseRanges orders the status keys so narrower keys win, so 404
+// beats 400-499 which beats 4xx which beats default. For the same status,
+// keys scoped to paths beat keys scoped to content types, which beat keys
+// without either.
+func (bm *BodyModifier) sortResponseRanges() {
+	sort.Slice(bm.responseRanges, func(i, j int) bool {
+		ri, rj := bm.responseRanges[i], bm.responseRanges[j]
+		if ri.fallback != rj.fallback {
+			return rj.fallback
+		}
+		wi, wj := ri.high-ri.low, rj.high-rj.low
+		if wi != wj {
+			return wi < wj
+		}
+		if si, sj := ri.specificity(), rj.specificity(); si != sj {
+			return si > sj
+		}
+		return ri.key < rj.key
+	})
+}
+
+// specificity ranks keys covering the same statuses
+func (r statusRange) specificity() int {
+	specificity := 0
+	if len(r.paths) > 0 || len(r.pathRegex) > 0 {
+		specificity += 2
+	}
+	if len(r.mediaTypes) > 0 {
+		specificity++
+	}
+	return specificity
+}
+
+// matches reports whether a response with status and contentType to a
+// request for requestPath is covered
+func (r statusRange) matches(status int, contentType, requestPath string) bool {
+	if !r.fallback && (status < r.low || status > r.high) {
+		return false
+	}
+	if len(r.paths) > 0 || len(r.pathRegex) > 0 {
+		matched := false
+		for _, pattern := range r.paths {
+			if matchPathGlob(pattern, requestPath) {
+				matched = true
+				break
+			}
+		}
+		for _, re := range r.pathRegex {
+			if !matched && re.MatchString(requestPath) {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(r.mediaTypes) == 0 {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "" {
+		return false
+	}
+	for _, pattern := range r.mediaTypes {
+		if matched, _ := path.Match(pattern, mediaType); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathGlob matches a request path against a glob where * matches
+// within one segment and a final /** matches the path and everything below
+func matchPathGlob(pattern, requestPath string) bool {
+	if prefix, found := strings.CutSuffix(pattern, "/**"); found {
+		segments := strings.Count(prefix, "/") + 1
+		parts := strings.Split(requestPath, "/")
+		if len(parts) < segments {
+			return false
+		}
+		pattern, requestPath = prefix, strings.Join(parts[:segments], "/")
+	}
+	matched, _ := path.Match(pattern, requestPath)
+	return matched
+}
+
+// parseStatusKey parses a ModifierResponse key: an exact status code (404),
+// a class (4xx) or an inclusive range (400-499)
+func parseStatusKey(key string) (int, int, bool) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	if len(key) == 3 && strings.HasSuffix(key, "xx") && key[0] >= '1' && key[0] <= '5' {
+		low := int(key[0]-'0') * 100
+		return low, low + 99, true
+	}
+	if from, to, found := strings.Cut(key, "-"); found {
+		low, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			return 0, 0, false
+		}
+		high, err := strconv.Atoi(strings.TrimSpace(to))
+		if err != nil || low > high {
+			return 0, 0, false
+		}
+		return low, high, true
+	}
+	status, err := strconv.Atoi(key)
+	if err != nil {
+		return 0, 0, false
+	}
+	return status, status, true
+}
+
+// ResponseTemplate returns the key and template that apply to a response
+// with status and contentType to a request for requestPath, falling back to
+// the default template. Keys of response expressions such as
+// modifier_response_jq match with an empty template.
+func (bm *BodyModifier) ResponseTemplate(status int, contentType, requestPath string) (string, string, bool) {
+	for _, r := range bm.responseRanges {
+		if r.matches(status, contentType, requestPath) {
+			return r.key, bm.templateResponse[r.key], true
+		}
+	}
+	return "", "", false
+}
+
+// responseContentType returns the media type of a response, without
+// parameters such as charset
+func responseContentType(header http.Header) string {
+	contentType := header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// capturedTemplate returns the key and template that apply to a captured response
+func (bm *BodyModifier) capturedTemplate(capturedResponse *ResponseWriter) (string, string, bool) {
+	var requestPath string
+	if capturedResponse.request != nil {
+		requestPath = capturedResponse.request.URL.Path
+	}
+	return bm.ResponseTemplate(capturedResponse.statusCode, capturedResponse.Header().Get("Content-Type"), requestPath)
+}
+
+// Validate returns the error of a request or response template that failed
+// to parse, so a broken configuration is rejected when the plugin is created
+func (bm *BodyModifier) Validate() error {
+	return bm.parseErr
 }
 
 // ModifyRequestBodyWithContext handles request body modification using templates with context
 func (bm *BodyModifier) ModifyRequestBodyWithContext(req *http.Request, ctx *TemplateContext) ([]byte, []byte, error) {
-	if bm.templateRequest == "" || req.Body == nil {
+	if !bm.HasRequestTransform() || req.Body == nil {
 		return nil, nil, nil
 	}
 
+	// Stream or reject bodies known to be above the limit before reading them
+	limit, action := bm.requestLimit()
+	if limit > 0 && req.ContentLength > limit {
+		switch action {
+		case bodyLimitPassthrough:
+			return nil, nil, errBodyStreamed
+		case bodyLimitReject:
+			return nil, nil, errBodyTooLarge
+		}
+	}
+
 	// Read original body
-	body, err := io.ReadAll(req.Body)
+	reader := req.Body
+	if limit > 0 {
+		reader = io.NopCloser(io.LimitReader(req.Body, limit+1))
+	}
+	body, err := io.ReadAll(reader)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to read request body: %w", err)
 	}
+	truncated := false
+	if limit > 0 && int64(len(body)) > limit {
+		switch action {
+		case bodyLimitPassthrough:
+			req.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+			return nil, nil, errBodyStreamed
+		case bodyLimitReject:
+			req.Body.Close()
+			return nil, nil, errBodyTooLarge
+		}
+		body = body[:limit]
+		truncated = true
+	}
 	req.Body.Close()
 
-	// Parse JSON body
-	var requestData interface{}
-	if len(body) > 0 {
-		if err := json.Unmarshal(body, &requestData); err != nil {
-			return nil, nil, fmt.Errorf("failed to parse request JSON: %w", err)
+	// Forward the body as it was read when it cannot be modified
+	raw, encoding := body, req.Header.Get("Content-Encoding")
+	fail := func(err error) ([]byte, []byte, error) {
+		req.Body = io.NopCloser(bytes.NewReader(raw))
+		if encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
 		}
+		return nil, nil, err
 	}
 
-	// Parse and execute template
-	tmpl := template.Must(template.New("request").Funcs(pkg.SimpleFuncMap()).Delims("[[", "]]").Parse(bm.templateRequest))
-
-	var buf bytes.Buffer
-	templateData := map[string]interface{}{
-		"request": map[string]interface{}{
-			"api": map[string]interface{}{
-				"body": requestData,
-			},
-		},
+	// Decompress gzip bodies; the modified body is forwarded uncompressed
+	if encoding := strings.ToLower(strings.TrimSpace(encoding)); encoding != "" && encoding != "identity" {
+		if encoding != "gzip" && encoding != "x-gzip" {
+			return fail(fmt.Errorf("unsupported request Content-Encoding %q", encoding))
+		}
+		body, err = gunzip(body, limit)
+		if errors.Is(err, errDecodedTooLarge) {
+			// The limit applies to the decompressed size as well
+			switch action {
+			case bodyLimitPassthrough:
+				return fail(errBodyStreamed)
+			case bodyLimitReject:
+				return fail(errBodyTooLarge)
+			}
+			body, err = body[:len(body)-1], nil
+			truncated = true
+		}
+		if err != nil {
+			return fail(fmt.Errorf("failed to decompress request body: %w", err))
+		}
+		req.Header.Del("Content-Encoding")
 	}
 
-	// Add context if provided
-	if ctx != nil {
-		templateData["context"] = ctx
+	// Parse JSON or form body
+	var requestData interface{}
+	isForm := isFormContentType(req.Header.Get("Content-Type"))
+	if isForm {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return fail(fmt.Errorf("failed to parse request form: %w", err))
+		}
+		requestData = formToMap(values)
+	} else if len(body) > 0 {
+		if err := json.Unmarshal(body, &requestData); err != nil {
+			if !truncated {
+				return fail(fmt.Errorf("failed to parse request JSON: %w", err))
+			}
+			// Truncated JSON is passed to the template as a string
+			requestData = string(body)
+		}
 	}
 
-	if err := tmpl.Execute(&buf, templateData); err != nil {
-		return nil, nil, fmt.Errorf("failed to execute request template: %w", err)
+	request := requestTemplateData(req)
+	request["api"] = map[string]interface{}{
+		"body": requestData,
 	}
+	templateData := buildTemplateData(ctx, map[string]interface{}{
+		"request": request,
+	})
 
-	// Clean and update request body
-	newBody := buf.Bytes()
+	var newBody []byte
+	if bm.requestProgram != nil {
+		if newBody, err = bm.requestProgram.run(requestData, templateData); err != nil {
+			traceTemplate(ctx, "modifier_request", nil, err)
+			return fail(fmt.Errorf("failed to transform request body: %w", err))
+		}
+	} else if bm.requestTemplate == nil {
+		// Validate rejects this when the plugin is created; never panic here
+		err := bm.parseErrs["modifier_request"]
+		traceTemplate(ctx, "modifier_request", nil, err)
+		return fail(fmt.Errorf("failed to parse request template: %w", err))
+	} else {
+		buf := newTemplateOutput(ctx)
+		defer buf.release()
+		if err := bm.requestTemplate.Execute(buf, templateData); err != nil {
+			err = newTemplateError("modifier_request", err)
+			traceTemplate(ctx, "modifier_request", nil, err)
+			return fail(fmt.Errorf("failed to execute request template: %w", err))
+		}
+		newBody = buf.Bytes()
+	}
+	traceTemplate(ctx, "modifier_request", newBody, nil)
 
 	// Clean JSON by removing "<no value>" strings
 	cleanedBody := bytes.ReplaceAll(newBody, []byte(`"<no value>"`), []byte(`""`))
 
+	// Write the output back as a form body, or as JSON when the input was a form
+	switch {
+	case bm.requestFormat == bodyFormatForm:
+		formBody, err := jsonToForm(cleanedBody)
+		if err != nil {
+			return fail(fmt.Errorf("failed to encode request form: %w", err))
+		}
+		cleanedBody = formBody
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	case isForm:
+		req.Header.Set("Content-Type", "application/json")
+	}
+
 	req.Body = io.NopCloser(bytes.NewReader(cleanedBody))
 	req.ContentLength = int64(len(cleanedBody))
 	req.Header.Set("Content-Length", strconv.Itoa(len(cleanedBody)))
 
+	if truncated {
+		return body, cleanedBody, errBodyTruncated
+	}
 	return body, cleanedBody, nil
 }
 
-// ResponseWriter wraps http.ResponseWriter to capture response
+// SetRequestFormat sets the format the request template output is written
+// as: json (default) or form
+func (bm *BodyModifier) SetRequestFormat(format string) error {
+	switch format {
+	case "", bodyFormatJSON:
+		bm.requestFormat = bodyFormatJSON
+	case bodyFormatForm:
+		bm.requestFormat = bodyFormatForm
+	default:
+		return fmt.Errorf("invalid modifier_request_format %q", format)
+	}
+	return nil
+}
+
+// gunzip decompresses a gzip body of at most limit bytes (0 uses
+// defaultMaxDecodedBytes)
+func gunzip(body []byte, limit int64) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return readDecoded(reader, limit)
+}
+
+// decodeContentEncoding decompresses a gzip or deflate body of at most limit
+// bytes (0 uses defaultMaxDecodedBytes). Deflate bodies are zlib streams,
+// with raw deflate accepted from misbehaving servers.
+func decodeContentEncoding(encoding string, body []byte, limit int64) ([]byte, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		return gunzip(body, limit)
+	case "deflate":
+		if reader, err := zlib.NewReader(bytes.NewReader(body)); err == nil {
+			defer reader.Close()
+			return readDecoded(reader, limit)
+		}
+		reader := flate.NewReader(bytes.NewReader(body))
+		defer reader.Close()
+		return readDecoded(reader, limit)
+	}
+	return nil, fmt.Errorf("unsupported Content-Encoding %q", encoding)
+}
+
+// readDecoded reads a decompressing reader up to limit bytes, returning the
+// bytes read with errDecodedTooLarge when there is more
+func readDecoded(reader io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		limit = defaultMaxDecodedBytes
+	}
+	body, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return body, errDecodedTooLarge
+	}
+	return body, nil
+}
+
+// encodeContentEncoding compresses body with a gzip or deflate encoding
+func encodeContentEncoding(encoding string, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+	switch encoding {
+	case "gzip", "x-gzip":
+		writer = gzip.NewWriter(&buf)
+	case "deflate":
+		writer = zlib.NewWriter(&buf)
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", encoding)
+	}
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// supportedAcceptEncoding removes encodings the response templates cannot
+// decode, such as br, from an Accept-Encoding header
+func supportedAcceptEncoding(acceptEncoding string) string {
+	var kept []string
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding := strings.ToLower(strings.TrimSpace(strings.SplitN(part, ";", 2)[0]))
+		switch coding {
+		case "gzip", "x-gzip", "deflate", "identity":
+			kept = append(kept, strings.TrimSpace(part))
+		}
+	}
+	return strings.Join(kept, ", ")
+}
+
+// limitAcceptEncoding restricts the Accept-Encoding header of req to the
+// encodings decodeContentEncoding supports
+func limitAcceptEncoding(req *http.Request) {
+	acceptEncoding := req.Header.Get("Accept-Encoding")
+	if acceptEncoding == "" {
+		return
+	}
+	if supported := supportedAcceptEncoding(acceptEncoding); supported != "" {
+		req.Header.Set("Accept-Encoding", supported)
+	} else {
+		req.Header.Del("Accept-Encoding")
+	}
+}
+
+// SetMaxBuffer sets the largest body, in bytes, that is buffered for
+// templating. Larger bodies are streamed unmodified; 0 disables the limit.
+func (bm *BodyModifier) SetMaxBuffer(maxBuffer int64) {
+	bm.maxBuffer = maxBuffer
+}
+
+// SetStreamContentTypes sets the response content types that bypass response
+// templates and are streamed to the client as they are written
+func (bm *BodyModifier) SetStreamContentTypes(contentTypes []string) {
+	if len(contentTypes) > 0 {
+		bm.streamTypes = contentTypes
+	}
+}
+
+// isFormContentType reports whether contentType is a URL-encoded form
+func isFormContentType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/x-www-form-urlencoded"
+}
+
+// formToMap converts form values to a template map. Fields with a single
+// value become strings, repeated fields become lists.
+func formToMap(values url.Values) map[string]interface{} {
+	result := make(map[string]interface{}, len(values))
+	for name, fieldValues := range values {
+		if len(fieldValues) == 1 {
+			result[name] = fieldValues[0]
+			continue
+		}
+		list := make([]interface{}, len(fieldValues))
+		for i, value := range fieldValues {
+			list[i] = value
+		}
+		result[name] = list
+	}
+	return result
+}
+
+// jsonToForm encodes a JSON object as a form body. Lists become repeated
+// fields, null becomes an empty value and nested objects are JSON encoded.
+func jsonToForm(body []byte) ([]byte, error) {
+	var object map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil {
+		return nil, fmt.Errorf("template output must be a JSON object: %w", err)
+	}
+
+	values := make(url.Values, len(object))
+	for name, value := range object {
+		list, ok := value.([]interface{})
+		if !ok {
+			list = []interface{}{value}
+		}
+		for _, item := range list {
+			switch v := item.(type) {
+			case nil:
+				values.Add(name, "")
+			case string:
+				values.Add(name, v)
+			case map[string]interface{}, []interface{}:
+				encoded, err := json.Marshal(v)
+				if err != nil {
+					return nil, err
+				}
+				values.Add(name, string(encoded))
+			default:
+				values.Add(name, fmt.Sprint(v))
+			}
+		}
+	}
+	return []byte(values.Encode()), nil
+}
+
+// ResponseWriter wraps http.ResponseWriter to capture response. Responses
+// that no template applies to and streamed content types switch to
+// streaming: the status, the buffered bytes and all later writes go straight
+// to the client. Responses growing past the buffer limit are marked as
+// overflowed, and the body is dropped or cut at the limit; only the
+// passthrough limit action streams them unmasked.
 type ResponseWriter struct {
 	http.ResponseWriter
-	body       *bytes.Buffer
-	statusCode int
+	body        *bytes.Buffer
+	statusCode  int
+	maxBuffer   int64
+	limitAction string
+	overflowed  bool
+	streamTypes []string
+	streamLines func() *streamLines
+	lines       *streamLines
+	hasTemplate func(status int) bool
+	request     *http.Request
+	ownHeaders  map[string]bool
+	decided     bool
+	streaming   bool
+	hijacked    bool
 }
 
 // NewResponseWriter creates a new response writer wrapper
 func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
 	return &ResponseWriter{
 		ResponseWriter: w,
-		body:           &bytes.Buffer{},
+		body:           getBuffer(0),
 		statusCode:     http.StatusOK,
 	}
 }
 
 func (rw *ResponseWriter) Write(b []byte) (int, error) {
+	if !rw.decided {
+		rw.decide()
+	}
+	if rw.lines != nil {
+		rw.lines.write(rw.ResponseWriter, b)
+		return len(b), nil
+	}
+	if rw.streaming {
+		return rw.ResponseWriter.Write(b)
+	}
+	if rw.overflowed {
+		return len(b), nil
+	}
+	if rw.maxBuffer > 0 && int64(rw.body.Len()+len(b)) > rw.maxBuffer {
+		switch rw.limitAction {
+		case bodyLimitReject:
+			rw.overflowed = true
+			rw.body.Reset()
+			return len(b), nil
+		case bodyLimitTruncate:
+			rw.overflowed = true
+			rw.body.Write(b[:rw.maxBuffer-int64(rw.body.Len())])
+			return len(b), nil
+		}
+		rw.startStreaming()
+		return rw.ResponseWriter.Write(b)
+	}
 	return rw.body.Write(b)
 }
 
 func (rw *ResponseWriter) WriteHeader(statusCode int) {
+	if rw.decided {
+		return
+	}
 	rw.statusCode = statusCode
+	rw.decide()
+}
+
+// ReadFrom copies r into the response, handing the copy to the underlying
+// writer once the response is streamed so sendfile can be used
+func (rw *ResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !rw.decided {
+		rw.decide()
+	}
+	if rw.streaming && rw.lines == nil {
+		if readerFrom, ok := rw.ResponseWriter.(io.ReaderFrom); ok {
+			return readerFrom.ReadFrom(r)
+		}
+		return io.Copy(struct{ io.Writer }{rw.ResponseWriter}, r)
+	}
+	return io.Copy(struct{ io.Writer }{rw}, r)
+}
+
+// decide switches to streaming once the status and headers are known, when
+// the response cannot or need not be templated
+func (rw *ResponseWriter) decide() {
+	rw.decided = true
+	defer rw.sizeBuffer()
+	switch {
+	case rw.statusCode == http.StatusSwitchingProtocols:
+		rw.startStreaming()
+	case rw.isStreamType():
+		// Uncompressed streams are modified line by line when a stream
+		// template is set
+		if rw.streamLines != nil && rw.Header().Get("Content-Encoding") == "" {
+			if rw.lines = rw.streamLines(); rw.lines != nil {
+				rw.Header().Del("Content-Length")
+			}
+		}
+		rw.startStreaming()
+	case rw.hasTemplate != nil && !rw.hasTemplate(rw.statusCode):
+		rw.startStreaming()
+	case rw.maxBuffer > 0:
+		length, err := strconv.ParseInt(rw.Header().Get("Content-Length"), 10, 64)
+		if err != nil || length <= rw.maxBuffer {
+			return
+		}
+		switch rw.limitAction {
+		case bodyLimitReject:
+			rw.overflowed = true
+		case bodyLimitTruncate:
+		default:
+			rw.startStreaming()
+		}
+	}
+}
+
+// sizeBuffer swaps the capture buffer for one of the size class of the
+// announced Content-Length, so large responses are not grown from the
+// smallest class
+func (rw *ResponseWriter) sizeBuffer() {
+	if rw.streaming || rw.overflowed || rw.body.Len() > 0 {
+		return
+	}
+	length, err := strconv.ParseInt(rw.Header().Get("Content-Length"), 10, 64)
+	if err != nil || length <= int64(rw.body.Cap()) {
+		return
+	}
+	if rw.maxBuffer > 0 && length > rw.maxBuffer {
+		length = rw.maxBuffer
+	}
+	putBuffer(rw.body)
+	rw.body = getBuffer(int(length))
+}
+
+// release returns the capture buffer to the pool once the response was
+// written; GetBody must not be used afterwards
+func (rw *ResponseWriter) release() {
+	putBuffer(rw.body)
+	rw.body = &bytes.Buffer{}
+}
+
+// startStreaming writes the status and the buffered body to the client
+func (rw *ResponseWriter) startStreaming() {
+	rw.streaming = true
+	rw.ResponseWriter.WriteHeader(rw.statusCode)
+	rw.ResponseWriter.Write(rw.body.Bytes())
+	rw.body.Reset()
+}
+
+// isStreamType reports whether the response content type is streamed
+func (rw *ResponseWriter) isStreamType() bool {
+	mediaType, _, _ := mime.ParseMediaType(rw.Header().Get("Content-Type"))
+	for _, streamType := range rw.streamTypes {
+		if strings.EqualFold(mediaType, streamType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Flush sends streamed data to the client. Buffered responses are only
+// written once the response templates ran, so Flush does nothing for them.
+func (rw *ResponseWriter) Flush() {
+	if !rw.streaming {
+		return
+	}
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets the caller take over the connection, e.g. for WebSocket
+// upgrades. Body capture is disabled once the connection is hijacked.
+func (rw *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not implement http.Hijacker", rw.ResponseWriter)
+	}
+	conn, brw, err := hijacker.Hijack()
+	if err == nil {
+		rw.hijacked = true
+	}
+	return conn, brw, err
+}
+
+// CloseNotify forwards to the underlying writer when it supports close
+// notifications
+func (rw *ResponseWriter) CloseNotify() <-chan bool {
+	// CloseNotifier is deprecated but still used by older handlers
+	if notifier, ok := rw.ResponseWriter.(http.CloseNotifier); ok {
+		return notifier.CloseNotify()
+	}
+	return make(chan bool)
+}
+
+// Hijacked reports whether the connection was hijacked
+func (rw *ResponseWriter) Hijacked() bool {
+	return rw.hijacked
+}
+
+// Overflowed reports whether the response was larger than the limit and
+// was dropped or truncated
+func (rw *ResponseWriter) Overflowed() bool {
+	return rw.overflowed
+}
+
+// Streaming reports whether the response was streamed to the client
+// unmodified, because of its content type or the buffer limit
+func (rw *ResponseWriter) Streaming() bool {
+	return rw.streaming
 }
 
 func (rw *ResponseWriter) GetBody() []byte {
@@ -120,7 +910,7 @@ func (bm *BodyModifier) ModifyResponse(originalWriter http.ResponseWriter, captu
 
 // ModifyResponseWithContext handles response body modification with context
 func (bm *BodyModifier) ModifyResponseWithContext(originalWriter http.ResponseWriter, capturedResponse *ResponseWriter, originalRequestBody, modifiedRequestBody []byte, ctx *TemplateContext) error {
-	if len(bm.templateResponse) == 0 {
+	if !bm.HasResponseTransforms() {
 		// No response masking configured, write original response
 		originalWriter.WriteHeader(capturedResponse.statusCode)
 		originalWriter.Write(capturedResponse.body.Bytes())
@@ -128,7 +918,7 @@ func (bm *BodyModifier) ModifyResponseWithContext(originalWriter http.ResponseWr
 	}
 
 	// Check if we have a template for this status code
-	templateStr, exists := bm.templateResponse[capturedResponse.statusCode]
+	responseKey, _, exists := bm.capturedTemplate(capturedResponse)
 	if !exists {
 		// No masking for this status code, write original response
 		originalWriter.WriteHeader(capturedResponse.statusCode)
@@ -148,9 +938,35 @@ func (bm *BodyModifier) ModifyResponseWithContext(originalWriter http.ResponseWr
 		json.Unmarshal(modifiedRequestBody, &requestDataModified)
 	}
 
+	// Decode compressed upstream responses; the output is encoded again below
+	responseBody := capturedResponse.body.Bytes()
+	encoding := strings.ToLower(strings.TrimSpace(originalWriter.Header().Get("Content-Encoding")))
+	if encoding == "identity" {
+		encoding = ""
+	}
+	if encoding != "" {
+		limit, action := bm.responseLimit()
+		decoded, err := decodeContentEncoding(encoding, responseBody, limit)
+		if errors.Is(err, errDecodedTooLarge) {
+			// The limit applies to the decompressed size as well
+			switch action {
+			case bodyLimitPassthrough:
+				originalWriter.WriteHeader(capturedResponse.statusCode)
+				originalWriter.Write(responseBody)
+				return errBodyStreamed
+			case bodyLimitReject:
+				return errBodyTooLarge
+			}
+			decoded, err = decoded[:len(decoded)-1], nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decode %s response: %w", encoding, err)
+		}
+		responseBody = decoded
+	}
+
 	// Parse response body
 	var responseData interface{}
-	responseBody := capturedResponse.body.Bytes()
 	if len(responseBody) > 0 {
 		if err := json.Unmarshal(responseBody, &responseData); err != nil {
 			// If we can't parse as JSON, use raw string
@@ -158,41 +974,85 @@ func (bm *BodyModifier) ModifyResponseWithContext(originalWriter http.ResponseWr
 		}
 	}
 
-	// Parse and execute response template
-	tmpl := template.Must(template.New("response").Funcs(pkg.SimpleFuncMap()).Delims("[[", "]]").Parse(templateStr))
-
-	var buf bytes.Buffer
-	templateData := map[string]interface{}{
-		"request": map[string]interface{}{
-			"api": map[string]interface{}{
-				"body": requestDataOriginal,
-			},
-			"modified": map[string]interface{}{
-				"body": requestDataModified,
-			},
-		},
+	request := map[string]interface{}{}
+	if capturedResponse.request != nil {
+		request = requestTemplateData(capturedResponse.request)
+	}
+	request["api"] = map[string]interface{}{
+		"body": requestDataOriginal,
+	}
+	request["modified"] = map[string]interface{}{
+		"body": requestDataModified,
+	}
+	templateData := buildTemplateData(ctx, map[string]interface{}{
+		"request": request,
 		"response": map[string]interface{}{
-			"body": responseData,
+			"body":        responseData,
+			"status":      capturedResponse.statusCode,
+			"headers":     convertHeaders(capturedResponse.Header()),
+			"contentType": responseContentType(capturedResponse.Header()),
 		},
-	}
+	})
 
-	// Add context if provided
-	if ctx != nil {
-		templateData["context"] = ctx
-	}
+	var responseBytes []byte
+	templateKey := fmt.Sprintf("modifier_response[%s]", responseKey)
+	if program, ok := bm.responsePrograms[responseKey]; ok {
+		var err error
+		if responseBytes, err = program.run(responseData, templateData); err != nil {
+			traceTemplate(ctx, templateKey, nil, err)
+			return err
+		}
+	} else if conditions, ok := bm.responseConditions[responseKey]; ok {
+		tmpl, err := selectResponseCondition(conditions, templateData, ctx)
+		if err != nil {
+			return err
+		}
+		if tmpl == nil {
+			// No condition matched, write original response
+			originalWriter.WriteHeader(capturedResponse.statusCode)
+			originalWriter.Write(capturedResponse.body.Bytes())
+			return nil
+		}
 
-	if err := tmpl.Execute(&buf, templateData); err != nil {
-		return fmt.Errorf("response masking error: %v", err)
+		templateKey = tmpl.Name()
+		buf := newTemplateOutput(ctx)
+		defer buf.release()
+		if err := tmpl.Execute(buf, templateData); err != nil {
+			err = newTemplateError(templateKey, err)
+			traceTemplate(ctx, templateKey, nil, err)
+			return err
+		}
+		responseBytes = buf.Bytes()
+	} else if tmpl, ok := bm.responseTemplates[responseKey]; !ok {
+		// Validate rejects this when the plugin is created; never panic here
+		err := bm.parseErrs[templateKey]
+		traceTemplate(ctx, templateKey, nil, err)
+		return fmt.Errorf("failed to parse response template: %w", err)
+	} else {
+		buf := newTemplateOutput(ctx)
+		defer buf.release()
+		if err := tmpl.Execute(buf, templateData); err != nil {
+			err = newTemplateError(templateKey, err)
+			traceTemplate(ctx, templateKey, nil, err)
+			return err
+		}
+		responseBytes = buf.Bytes()
 	}
+	traceTemplate(ctx, templateKey, responseBytes, nil)
+	bm.maskedHeaders.filter(originalWriter.Header(), capturedResponse.ownHeaders)
 
 	// Write modified response
 	// Check if response is valid JSON and clean it
-	responseBytes := buf.Bytes()
 	var formattedJSON []byte
 
 	var jsonData interface{}
 	if err := json.Unmarshal(responseBytes, &jsonData); err != nil {
 		// If not valid JSON, use as is
+		if encoding != "" {
+			if responseBytes, err = encodeContentEncoding(encoding, responseBytes); err != nil {
+				return fmt.Errorf("failed to encode %s response: %w", encoding, err)
+			}
+		}
 		originalWriter.Header().Set("Content-Length", strconv.Itoa(len(responseBytes)))
 		originalWriter.WriteHeader(capturedResponse.statusCode)
 		originalWriter.Write(responseBytes)
@@ -215,6 +1075,12 @@ func (bm *BodyModifier) ModifyResponseWithContext(originalWriter http.ResponseWr
 	}
 
 	// Write formatted response
+	if encoding != "" {
+		var err error
+		if formattedJSON, err = encodeContentEncoding(encoding, formattedJSON); err != nil {
+			return fmt.Errorf("failed to encode %s response: %w", encoding, err)
+		}
+	}
 	originalWriter.Header().Set("Content-Length", strconv.Itoa(len(formattedJSON)))
 	originalWriter.Header().Set("Content-Type", "application/json")
 	originalWriter.WriteHeader(capturedResponse.statusCode)
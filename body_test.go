@@ -0,0 +1,415 @@
+package traefik_modifier_plugin
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyModifier_ResponseTemplate(t *testing.T) {
+	bm := NewBodyModifier("", map[string]string{
+		"404":     "not found",
+		"400-409": "client range",
+		"4xx":     "client class",
+		"5XX":     "server class",
+		"teapot":  "ignored",
+	})
+
+	for _, tt := range []struct {
+		status   int
+		key      string
+		template string
+	}{
+		{404, "404", "not found"},
+		{401, "400-409", "client range"},
+		{422, "4xx", "client class"},
+		{503, "5XX", "server class"},
+		{200, "", ""},
+	} {
+		key, tmpl, ok := bm.ResponseTemplate(tt.status, "", "/")
+		if ok != (tt.key != "") || key != tt.key || tmpl != tt.template {
+			t.Errorf("ResponseTemplate(%d) = %q, %q, %v; expected %q, %q", tt.status, key, tmpl, ok, tt.key, tt.template)
+		}
+	}
+}
+
+func TestBodyModifier_DefaultResponseTemplate(t *testing.T) {
+	bm := NewBodyModifier("", map[string]string{
+		"200":     "ok",
+		"default": "envelope",
+	})
+
+	if key, tmpl, ok := bm.ResponseTemplate(200, "", "/"); !ok || key != "200" || tmpl != "ok" {
+		t.Errorf("Expected the exact template for 200, got %q %q", key, tmpl)
+	}
+	for _, status := range []int{201, 302, 404, 502} {
+		if key, tmpl, ok := bm.ResponseTemplate(status, "", "/"); !ok || key != "default" || tmpl != "envelope" {
+			t.Errorf("Expected the default template for %d, got %q %q", status, key, tmpl)
+		}
+	}
+}
+
+func TestBodyModifier_ContentTypeResponseTemplate(t *testing.T) {
+	bm := NewBodyModifier("", map[string]string{
+		"200 application/json":               "json",
+		"200 application/*+json, text/plain": "problem",
+		"2xx":                                "success",
+		"default text/*":                     "text",
+		"200 not-a-type":                     "ignored",
+	})
+
+	for _, tt := range []struct {
+		status      int
+		contentType string
+		key         string
+	}{
+		{200, "application/json; charset=utf-8", "200 application/json"},
+		{200, "application/problem+json", "200 application/*+json, text/plain"},
+		{200, "TEXT/PLAIN", "200 application/*+json, text/plain"},
+		{200, "application/pdf", "2xx"},
+		{201, "application/json", "2xx"},
+		{404, "text/html", "default text/*"},
+		{404, "application/json", ""},
+		{404, "", ""},
+	} {
+		key, _, ok := bm.ResponseTemplate(tt.status, tt.contentType, "/")
+		if ok != (tt.key != "") || key != tt.key {
+			t.Errorf("ResponseTemplate(%d, %q) = %q, %v; expected %q", tt.status, tt.contentType, key, ok, tt.key)
+		}
+	}
+}
+
+func TestBodyModifier_PathResponseTemplate(t *testing.T) {
+	bm := NewBodyModifier("", map[string]string{
+		"200 /users/*":                  "user",
+		"200 ~^/orders/[0-9]{1,8}$":     "order",
+		"200 application/json /api/**":  "api json",
+		"2xx /users/*/avatar, /avatars": "avatar",
+		"200":                           "ok",
+		"404 /users/[":                  "ignored",
+	})
+
+	for _, tt := range []struct {
+		status      int
+		contentType string
+		path        string
+		key         string
+	}{
+		{200, "", "/users/7", "200 /users/*"},
+		{200, "", "/users/7/orders", "200"},
+		{200, "", "/orders/42", "200 ~^/orders/[0-9]{1,8}$"},
+		{200, "", "/orders/latest", "200"},
+		{200, "application/json", "/api", "200 application/json /api/**"},
+		{200, "application/json", "/api/v1/items/3", "200 application/json /api/**"},
+		{200, "text/html", "/api/v1/items/3", "200"},
+		{200, "application/json", "/apis", "200"},
+		{201, "", "/users/7/avatar", "2xx /users/*/avatar, /avatars"},
+		{204, "", "/avatars", "2xx /users/*/avatar, /avatars"},
+		{201, "", "/users/7", ""},
+		{404, "", "/users/[", ""},
+	} {
+		key, _, ok := bm.ResponseTemplate(tt.status, tt.contentType, tt.path)
+		if ok != (tt.key != "") || key != tt.key {
+			t.Errorf("ResponseTemplate(%d, %q, %q) = %q, %v; expected %q", tt.status, tt.contentType, tt.path, key, ok, tt.key)
+		}
+	}
+}
+
+func TestBodyModifier_FormRequestBody(t *testing.T) {
+	template := `{"username": "[[ .request.api.body.user ]]", "roles": [[ toJSON .request.api.body.role ]], "remember": true}`
+
+	for _, tt := range []struct {
+		format, contentType, expected string
+	}{
+		{"form", "application/x-www-form-urlencoded", "remember=true&roles=admin&roles=editor&username=ana+maria"},
+		{"", "application/json", `{"username": "ana maria", "roles": ["admin","editor"], "remember": true}`},
+	} {
+		bm := NewBodyModifier(template, nil)
+		if err := bm.SetRequestFormat(tt.format); err != nil {
+			t.Fatalf("SetRequestFormat(%q) error = %v", tt.format, err)
+		}
+
+		req := httptest.NewRequest("POST", "/login", strings.NewReader("user=ana+maria&role=admin&role=editor"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+		if _, _, err := bm.ModifyRequestBodyWithContext(req, &TemplateContext{}); err != nil {
+			t.Fatalf("ModifyRequestBodyWithContext() error = %v", err)
+		}
+
+		body, _ := io.ReadAll(req.Body)
+		if string(body) != tt.expected || req.Header.Get("Content-Type") != tt.contentType {
+			t.Errorf("format %q: unexpected body %s (%s)", tt.format, body, req.Header.Get("Content-Type"))
+		}
+	}
+
+	if err := NewBodyModifier("", nil).SetRequestFormat("xml"); err == nil {
+		t.Errorf("Expected error for unknown format")
+	}
+}
+
+func TestBodyModifier_GzipRequestBody(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(`{"question": "apa itu hukum?"}`))
+	zw.Close()
+
+	bm := NewBodyModifier(`{"ask": "[[ .request.api.body.question ]]"}`, nil)
+	req := httptest.NewRequest("POST", "/ask", &compressed)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+
+	original, _, err := bm.ModifyRequestBodyWithContext(req, &TemplateContext{})
+	if err != nil {
+		t.Fatalf("ModifyRequestBodyWithContext() error = %v", err)
+	}
+	body, _ := io.ReadAll(req.Body)
+	if string(body) != `{"ask": "apa itu hukum?"}` || req.Header.Get("Content-Encoding") != "" {
+		t.Errorf("Unexpected body %s (Content-Encoding %q)", body, req.Header.Get("Content-Encoding"))
+	}
+	if string(original) != `{"question": "apa itu hukum?"}` {
+		t.Errorf("Expected the decompressed original body, got %s", original)
+	}
+
+	req = httptest.NewRequest("POST", "/ask", strings.NewReader("x"))
+	req.Header.Set("Content-Encoding", "br")
+	if _, _, err := bm.ModifyRequestBodyWithContext(req, &TemplateContext{}); err == nil {
+		t.Errorf("Expected error for unsupported encoding")
+	}
+}
+
+func TestBodyModifier_CompressedResponseBody(t *testing.T) {
+	bm := NewBodyModifier("", map[string]string{"200": `{"answer": "[[ .response.body.text ]]"}`})
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		compressed, err := encodeContentEncoding(encoding, []byte(`{"text": "ok", "secret": "x"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Content-Encoding", encoding)
+		captured := NewResponseWriter(rec)
+		captured.Write(compressed)
+
+		if err := bm.ModifyResponseWithContext(rec, captured, nil, nil, &TemplateContext{}); err != nil {
+			t.Fatalf("%s: ModifyResponseWithContext() error = %v", encoding, err)
+		}
+		body, err := decodeContentEncoding(encoding, rec.Body.Bytes(), 0)
+		if err != nil || string(body) != `{"answer": "ok"}` {
+			t.Errorf("%s: unexpected response %s (%v)", encoding, body, err)
+		}
+		if rec.Header().Get("Content-Encoding") != encoding {
+			t.Errorf("%s: expected Content-Encoding to be kept", encoding)
+		}
+	}
+
+	if got := supportedAcceptEncoding("br;q=1.0, gzip;q=0.8, zstd, deflate"); got != "gzip;q=0.8, deflate" {
+		t.Errorf("Unexpected Accept-Encoding %q", got)
+	}
+}
+
+func TestBodyModifier_DecompressedBodyLimit(t *testing.T) {
+	bomb, err := encodeContentEncoding("gzip", []byte(`{"q": "`+strings.Repeat("a", 1<<20)+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		action   string
+		request  error
+		response error
+	}{
+		{bodyLimitPassthrough, errBodyStreamed, errBodyStreamed},
+		{bodyLimitReject, errBodyTooLarge, errBodyTooLarge},
+		{bodyLimitTruncate, errBodyTruncated, nil},
+	}
+
+	for _, tt := range tests {
+		bm := NewBodyModifier(`{"q": [[ printf "%q" (print .request.api.body) ]]}`, map[string]string{"200": `{"ok": true}`})
+		if err := bm.SetBodyLimits(1024, 1024, tt.action, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		// The compressed request fits the limit, the decompressed one does not
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(bomb))
+		req.Header.Set("Content-Encoding", "gzip")
+		_, modified, err := bm.ModifyRequestBodyWithContext(req, &TemplateContext{})
+		if !errors.Is(err, tt.request) {
+			t.Errorf("%s: expected request error %v, got %v", tt.action, tt.request, err)
+		}
+		if tt.action == bodyLimitTruncate && len(modified) > 1100 {
+			t.Errorf("%s: expected the request cut at the limit, got %d bytes", tt.action, len(modified))
+		}
+		if tt.action == bodyLimitPassthrough {
+			body, _ := io.ReadAll(req.Body)
+			if !bytes.Equal(body, bomb) || req.Header.Get("Content-Encoding") != "gzip" {
+				t.Errorf("%s: expected the compressed request forwarded as is", tt.action)
+			}
+		}
+
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Content-Encoding", "gzip")
+		captured := NewResponseWriter(rec)
+		captured.Write(bomb)
+		err = bm.ModifyResponseWithContext(rec, captured, nil, nil, &TemplateContext{})
+		if !errors.Is(err, tt.response) {
+			t.Errorf("%s: expected response error %v, got %v", tt.action, tt.response, err)
+		}
+	}
+
+	deflated, _ := encodeContentEncoding("deflate", bytes.Repeat([]byte("a"), 4096))
+	if body, err := decodeContentEncoding("deflate", deflated, 1024); !errors.Is(err, errDecodedTooLarge) || len(body) != 1025 {
+		t.Errorf("Expected deflate bodies to stop past the limit, got %d bytes (%v)", len(body), err)
+	}
+}
+
+func TestBodyModifier_ResponseMetadata(t *testing.T) {
+	bm := NewBodyModifier("", map[string]string{
+		"4xx": `{"status": [[ .response.status ]], "type": "[[ .response.contentType ]]", "correlation": "[[ index .response.headers "x-correlation-id" ]]"}`,
+	})
+
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Content-Type", "application/problem+json; charset=utf-8")
+	rec.Header().Set("X-Correlation-ID", "abc-123")
+	captured := NewResponseWriter(rec)
+	captured.WriteHeader(http.StatusConflict)
+	captured.Write([]byte(`{"title": "conflict"}`))
+
+	if err := bm.ModifyResponseWithContext(rec, captured, nil, nil, &TemplateContext{}); err != nil {
+		t.Fatalf("ModifyResponseWithContext() error = %v", err)
+	}
+	if expected := `{"status": 409, "type": "application/problem+json", "correlation": "abc-123"}`; rec.Body.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, rec.Body.String())
+	}
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", rec.Code)
+	}
+}
+
+func TestBodyModifier_ParsesTemplatesOnce(t *testing.T) {
+	bm := NewBodyModifier(`{"id": [[ .request.api.body.id ]]}`, map[string]string{"200": `{"ok": true}`, "4xx": `{"ok": false}`})
+	if err := bm.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if bm.requestTemplate == nil || len(bm.responseTemplates) != 2 {
+		t.Fatalf("Expected the request and response templates to be parsed, got %v and %v", bm.requestTemplate, bm.responseTemplates)
+	}
+	parsed := bm.responseTemplates["200"]
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		captured := NewResponseWriter(rec)
+		captured.Write([]byte(`{}`))
+		if err := bm.ModifyResponseWithContext(rec, captured, nil, nil, &TemplateContext{}); err != nil {
+			t.Fatalf("ModifyResponseWithContext() error = %v", err)
+		}
+		if rec.Body.String() != `{"ok": true}` {
+			t.Errorf("Unexpected response %s", rec.Body.String())
+		}
+	}
+	if bm.responseTemplates["200"] != parsed {
+		t.Errorf("Expected the parsed template to be reused")
+	}
+
+	broken := NewBodyModifier("", map[string]string{"200": `{}`, "500": `[[ if ]]`})
+	if err := broken.Validate(); err == nil || !strings.Contains(err.Error(), "modifier_response[500]") {
+		t.Errorf("Expected a modifier_response[500] parse error, got %v", err)
+	}
+}
+
+func TestBodyModifier_UnparsedTemplatesDoNotPanic(t *testing.T) {
+	bm := NewBodyModifier(`{"id": [[ .request.api.body.id ]`, map[string]string{"200": `{}`, "5xx": `[[ end ]]`})
+	if err := bm.Validate(); err == nil || !strings.Contains(err.Error(), "modifier_request") {
+		t.Fatalf("Expected a modifier_request parse error, got %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"id": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	if _, _, err := bm.ModifyRequestBodyWithContext(req, &TemplateContext{}); err == nil || !strings.Contains(err.Error(), "failed to parse request template") {
+		t.Errorf("Expected a request template parse error, got %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	captured := NewResponseWriter(rec)
+	captured.WriteHeader(http.StatusBadGateway)
+	captured.Write([]byte(`{}`))
+	err := bm.ModifyResponseWithContext(rec, captured, nil, nil, &TemplateContext{})
+	if err == nil || !strings.Contains(err.Error(), "modifier_response[5xx]") {
+		t.Errorf("Expected a modifier_response[5xx] parse error, got %v", err)
+	}
+}
+
+// hijackRecorder is a ResponseRecorder that can be hijacked
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	conn net.Conn
+}
+
+func (hr *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hr.conn, bufio.NewReadWriter(bufio.NewReader(hr.conn), bufio.NewWriter(hr.conn)), nil
+}
+
+func TestResponseWriter_Hijack(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	captured := NewResponseWriter(&hijackRecorder{ResponseRecorder: httptest.NewRecorder(), conn: server})
+	conn, _, err := captured.Hijack()
+	if err != nil || conn != server {
+		t.Fatalf("Hijack() = %v, %v", conn, err)
+	}
+	if !captured.Hijacked() {
+		t.Errorf("Expected the writer to report the hijack")
+	}
+
+	if _, _, err := NewResponseWriter(httptest.NewRecorder()).Hijack(); err == nil {
+		t.Errorf("Expected an error when the underlying writer cannot be hijacked")
+	}
+
+	// Protocol switches go straight to the client
+	rec := httptest.NewRecorder()
+	upgraded := NewResponseWriter(rec)
+	upgraded.WriteHeader(http.StatusSwitchingProtocols)
+	if !upgraded.Streaming() || rec.Code != http.StatusSwitchingProtocols {
+		t.Errorf("Expected 101 to be written through, got %d", rec.Code)
+	}
+}
+
+func TestResponseWriter_FlushAndReadFrom(t *testing.T) {
+	hasTemplate := func(status int) bool { return status == http.StatusOK }
+
+	// Statuses without a template stream, so flushes reach the client
+	rec := httptest.NewRecorder()
+	passthrough := NewResponseWriter(rec)
+	passthrough.hasTemplate = hasTemplate
+	passthrough.WriteHeader(http.StatusNotFound)
+	passthrough.Write([]byte("chunk"))
+	passthrough.Flush()
+	if !passthrough.Streaming() || !rec.Flushed || rec.Body.String() != "chunk" {
+		t.Errorf("Expected the 404 to be flushed through, got flushed=%v body=%q", rec.Flushed, rec.Body.String())
+	}
+
+	n, err := passthrough.ReadFrom(strings.NewReader(" more"))
+	if err != nil || n != 5 || rec.Body.String() != "chunk more" {
+		t.Errorf("ReadFrom() = %d, %v, body %q", n, err, rec.Body.String())
+	}
+
+	// Templated statuses are still buffered
+	rec = httptest.NewRecorder()
+	buffered := NewResponseWriter(rec)
+	buffered.hasTemplate = hasTemplate
+	if _, err := buffered.ReadFrom(strings.NewReader("body")); err != nil {
+		t.Fatalf("ReadFrom() error: %v", err)
+	}
+	buffered.Flush()
+	if buffered.Streaming() || rec.Flushed || rec.Body.Len() != 0 || buffered.body.String() != "body" {
+		t.Errorf("Expected the 200 to stay buffered, got flushed=%v body=%q", rec.Flushed, rec.Body.String())
+	}
+}
@@ -0,0 +1,101 @@
+package traefik_modifier_plugin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"text/template"
+)
+
+// Body limit actions
+const (
+	bodyLimitPassthrough = "passthrough"
+	bodyLimitReject      = "reject"
+	bodyLimitTruncate    = "truncate"
+)
+
+// errBodyTooLarge is returned when a request body is larger than
+// max_request_body_bytes and the limit action is reject
+var errBodyTooLarge = errors.New("request body exceeds max_request_body_bytes")
+
+// errBodyTruncated is returned together with the modified body when the
+// request body was cut at max_request_body_bytes
+var errBodyTruncated = errors.New("request body truncated to max_request_body_bytes")
+
+// SetBodyLimits sets the largest request and response bodies, in bytes, the
+// templates are applied to and what happens to larger bodies: reject
+// (default) answers 413 with the optional reject template, truncate cuts
+// them at the limit and passthrough streams them unmodified, which skips
+// response masking. A limit of 0 falls back to max_buffer_bytes.
+func (bm *BodyModifier) SetBodyLimits(maxRequest, maxResponse int64, action, rejectTemplate string) error {
+	switch action {
+	case "", bodyLimitReject:
+		action = bodyLimitReject
+	case bodyLimitPassthrough, bodyLimitTruncate:
+	default:
+		return fmt.Errorf("invalid body_limit_action %q", action)
+	}
+	if maxRequest < 0 || maxResponse < 0 {
+		return errors.New("body limits must not be negative")
+	}
+
+	bm.maxRequestBody = maxRequest
+	bm.maxResponseBody = maxResponse
+	bm.limitAction = action
+	bm.limitTemplate = nil
+	if rejectTemplate != "" {
+		tmpl, err := template.New("body_limit_response").Funcs(bm.funcs).Delims("[[", "]]").Parse(rejectTemplate)
+		if err != nil {
+			return newTemplateError("body_limit_response", err)
+		}
+		bm.limitTemplate = tmpl
+	}
+	return nil
+}
+
+// requestLimit returns the request body limit and the action for larger
+// bodies. Without max_request_body_bytes, max_buffer_bytes is the limit.
+func (bm *BodyModifier) requestLimit() (int64, string) {
+	if bm.maxRequestBody > 0 {
+		return bm.maxRequestBody, bm.limitAction
+	}
+	return bm.maxBuffer, bm.limitAction
+}
+
+// responseLimit returns the response body limit and the action for larger
+// bodies. Without max_response_body_bytes, max_buffer_bytes is the limit.
+func (bm *BodyModifier) responseLimit() (int64, string) {
+	if bm.maxResponseBody > 0 {
+		return bm.maxResponseBody, bm.limitAction
+	}
+	return bm.maxBuffer, bm.limitAction
+}
+
+// WriteBodyLimit answers 413 for a request or response body over its limit,
+// rendering the reject template when one is configured
+func (bm *BodyModifier) WriteBodyLimit(rw http.ResponseWriter, req *http.Request, direction string, ctx *TemplateContext, errs *pluginErrors) {
+	limit, _ := bm.requestLimit()
+	if direction == phaseResponse {
+		limit, _ = bm.responseLimit()
+	}
+
+	header := rw.Header()
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+
+	if bm.limitTemplate == nil {
+		errs.write(rw, http.StatusRequestEntityTooLarge, "Body too large",
+			fmt.Errorf("%s body exceeds %d bytes", direction, limit))
+		return
+	}
+
+	templateData := buildTemplateData(ctx, map[string]interface{}{
+		"request": requestTemplateData(req),
+		"limit": map[string]interface{}{
+			"direction": direction,
+			"bytes":     limit,
+		},
+	})
+
+	writeTemplateResponse(rw, http.StatusRequestEntityTooLarge, "body_limit_response", bm.limitTemplate, templateData, errs)
+}
@@ -0,0 +1,89 @@
+package traefik_modifier_plugin
+
+import (
+	"fmt"
+)
+
+// bodyProgram transforms a decoded request or response body. jq and JMESPath
+// expressions implement it as alternatives to the Go templates.
+type bodyProgram interface {
+	run(body interface{}, templateData map[string]interface{}) ([]byte, error)
+}
+
+// bodyExpression is a compiled bodyProgram with the config key it came from,
+// e.g. modifier_response_jq[2xx]
+type bodyExpression struct {
+	name    string
+	program bodyProgram
+}
+
+// run executes the expression, naming its config key in errors
+func (e *bodyExpression) run(body interface{}, templateData map[string]interface{}) ([]byte, error) {
+	output, err := e.program.run(body, templateData)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", e.name, err)
+	}
+	return output, nil
+}
+
+// setPrograms compiles the request and per-status response expressions of
+// one language. requestField and responseField name the config keys; a body
+// can only have one template or expression, so overlaps are errors.
+func (bm *BodyModifier) setPrograms(requestField, responseField, request string, response map[string]string, compile func(string) (bodyProgram, error)) error {
+	if request != "" {
+		if bm.templateRequest != "" || bm.requestProgram != nil {
+			return fmt.Errorf("%s cannot be combined with another request body transform", requestField)
+		}
+		program, err := compile(request)
+		if err != nil {
+			return fmt.Errorf("%s: %w", requestField, err)
+		}
+		bm.requestProgram = &bodyExpression{name: requestField, program: program}
+	}
+
+	if len(response) == 0 {
+		return nil
+	}
+	if bm.responsePrograms == nil {
+		bm.responsePrograms = make(map[string]*bodyExpression, len(response))
+	}
+	for key, source := range response {
+		name := fmt.Sprintf("%s[%s]", responseField, key)
+		_, hasTemplate := bm.templateResponse[key]
+		_, hasConditions := bm.responseConditions[key]
+		if _, hasProgram := bm.responsePrograms[key]; hasTemplate || hasProgram || hasConditions {
+			return fmt.Errorf("%s cannot be combined with another response body transform for the same key", name)
+		}
+		program, err := compile(source)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		bm.responsePrograms[key] = &bodyExpression{name: name, program: program}
+		bm.addResponseKey(responseField, key)
+	}
+	bm.sortResponseRanges()
+	return nil
+}
+
+// HasRequestTransform reports whether a request template or expression is set
+func (bm *BodyModifier) HasRequestTransform() bool {
+	return bm.templateRequest != "" || bm.requestProgram != nil
+}
+
+// HasResponseTransforms reports whether any response template, expression
+// or stream template is set
+func (bm *BodyModifier) HasResponseTransforms() bool {
+	return len(bm.templateResponse) > 0 || len(bm.responsePrograms) > 0 || len(bm.responseConditions) > 0 || bm.streamTemplate != nil
+}
+
+// inheritedPrograms returns the base response expressions a tenant keeps:
+// those whose key the tenant does not override with a template
+func inheritedPrograms(base, overlayTemplates map[string]string) map[string]string {
+	programs := make(map[string]string, len(base))
+	for status, program := range base {
+		if _, overridden := overlayTemplates[status]; !overridden {
+			programs[status] = program
+		}
+	}
+	return programs
+}
@@ -0,0 +1,184 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// defaultMaxStreamLine is the longest line of a streamed response held for
+// modifier_response_stream when no response body limit is configured
+const defaultMaxStreamLine = 1 << 20
+
+// errStreamLineTooLong is reported for a streamed line dropped because it
+// grew past the line limit before it ended
+var errStreamLineTooLong = errors.New("streamed line exceeds the body limit")
+
+// streamLines applies modifier_response_stream to a streamed response line
+// by line as it passes through a ResponseWriter
+type streamLines struct {
+	modify   func(line []byte) ([]byte, error)
+	maxLine  int64
+	pending  bytes.Buffer
+	skipping bool
+	dropped  int
+	err      error
+}
+
+// SetStreamTemplate parses the template applied to every line of responses
+// streamed because of their content type
+func (bm *BodyModifier) SetStreamTemplate(source string) error {
+	if source == "" {
+		bm.streamTemplate = nil
+		return nil
+	}
+	tmpl, err := template.New("modifier_response_stream").Funcs(bm.funcs).Delims("[[", "]]").Parse(source)
+	if err != nil {
+		return newTemplateError("modifier_response_stream", err)
+	}
+	bm.streamTemplate = tmpl
+	return nil
+}
+
+// streamLines returns the line modifier of a streamed response to req, or
+// nil without a stream template. Event streams only have the payload of
+// their data: lines modified; other content types have every non-empty
+// line modified.
+func (bm *BodyModifier) streamLines(rw *ResponseWriter, ctx *TemplateContext) *streamLines {
+	if bm.streamTemplate == nil {
+		return nil
+	}
+	maxLine, _ := bm.responseLimit()
+	if maxLine <= 0 {
+		maxLine = defaultMaxStreamLine
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(rw.Header().Get("Content-Type"))
+	eventStream := mediaType == "text/event-stream"
+	request := map[string]interface{}{}
+	if rw.request != nil {
+		request = requestTemplateData(rw.request)
+	}
+
+	modify := func(line []byte) ([]byte, error) {
+		payload := string(line)
+		if eventStream {
+			data, ok := strings.CutPrefix(payload, "data:")
+			if !ok {
+				return line, nil
+			}
+			payload = strings.TrimPrefix(data, " ")
+		}
+		if strings.TrimSpace(payload) == "" {
+			return line, nil
+		}
+
+		var body interface{}
+		if err := json.Unmarshal([]byte(payload), &body); err != nil {
+			body = payload
+		}
+		templateData := buildTemplateData(ctx, map[string]interface{}{
+			"request": request,
+			"response": map[string]interface{}{
+				"line":        payload,
+				"body":        body,
+				"status":      rw.statusCode,
+				"headers":     convertHeaders(rw.Header()),
+				"contentType": responseContentType(rw.Header()),
+			},
+		})
+
+		buf := newTemplateOutput(ctx)
+		defer buf.release()
+		if err := bm.streamTemplate.Execute(buf, templateData); err != nil {
+			err = newTemplateError(bm.streamTemplate.Name(), err)
+			traceTemplate(ctx, bm.streamTemplate.Name(), nil, err)
+			return nil, err
+		}
+		traceTemplate(ctx, bm.streamTemplate.Name(), buf.Bytes(), nil)
+
+		output := strings.TrimSpace(buf.String())
+		if output == "" || !eventStream {
+			return []byte(output), nil
+		}
+		// Multi-line output becomes one data: line per line of the event
+		return []byte("data: " + strings.ReplaceAll(output, "\n", "\ndata: ")), nil
+	}
+
+	return &streamLines{modify: modify, maxLine: maxLine}
+}
+
+// write modifies the complete lines of b and writes them to w, holding a
+// trailing partial line until it ends. Lines whose template fails, and lines
+// longer than maxLine, are dropped so unmodified data never reaches the
+// client; an empty template output drops the line as well.
+func (sl *streamLines) write(w http.ResponseWriter, b []byte) {
+	for len(b) > 0 {
+		end := bytes.IndexByte(b, '\n')
+		if end < 0 {
+			if !sl.skipping {
+				sl.pending.Write(b)
+				if int64(sl.pending.Len()) > sl.maxLine {
+					sl.drop(errStreamLineTooLong)
+					sl.skipping = true
+				}
+			}
+			return
+		}
+
+		if sl.skipping {
+			sl.skipping = false
+		} else {
+			sl.pending.Write(b[:end])
+			if int64(sl.pending.Len()) > sl.maxLine {
+				sl.drop(errStreamLineTooLong)
+			} else {
+				sl.emit(w, true)
+			}
+		}
+		b = b[end+1:]
+	}
+}
+
+// finish modifies and writes a last line that did not end in a newline
+func (sl *streamLines) finish(w http.ResponseWriter) {
+	if !sl.skipping && sl.pending.Len() > 0 {
+		sl.emit(w, false)
+	}
+}
+
+// emit writes the modified pending line, keeping a CRLF line ending
+func (sl *streamLines) emit(w http.ResponseWriter, newline bool) {
+	line := sl.pending.Bytes()
+	ending := ""
+	if newline {
+		ending = "\n"
+		if trimmed, ok := bytes.CutSuffix(line, []byte("\r")); ok {
+			line, ending = trimmed, "\r\n"
+		}
+	}
+
+	modified, err := sl.modify(line)
+	sl.pending.Reset()
+	if err != nil {
+		sl.drop(err)
+		return
+	}
+	if len(modified) == 0 && len(line) > 0 {
+		return
+	}
+	w.Write(append(modified, ending...))
+}
+
+// drop discards the pending line, remembering the first error
+func (sl *streamLines) drop(err error) {
+	sl.pending.Reset()
+	sl.dropped++
+	if sl.err == nil {
+		sl.err = err
+	}
+}
@@ -0,0 +1,170 @@
+package traefik_modifier_plugin
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Modifier names used for error tracking
+const (
+	phaseHeader   = "header"
+	phaseQuery    = "query"
+	phaseCookie   = "cookie"
+	phaseRequest  = "request"
+	phaseResponse = "response"
+)
+
+// BreakerConfig holds the circuit breaker configuration
+type BreakerConfig struct {
+	Window      string  `json:"window,omitempty"`
+	Threshold   float64 `json:"threshold,omitempty"`
+	MinRequests int     `json:"min_requests,omitempty"`
+	Cooldown    string  `json:"cooldown,omitempty"`
+}
+
+const breakerBuckets = 10
+
+// CircuitBreaker tracks template error rates per modifier over a sliding window
+// and bypasses a modifier (fail-open) while its error rate is above the threshold
+type CircuitBreaker struct {
+	window      time.Duration
+	cooldown    time.Duration
+	threshold   float64
+	minRequests int
+	now         func() time.Time
+
+	mu     sync.Mutex
+	states map[string]*breakerState
+}
+
+// breakerState holds the sliding window counters of a single modifier
+type breakerState struct {
+	buckets   [breakerBuckets]breakerBucket
+	openUntil time.Time
+}
+
+// breakerBucket counts executions within one slice of the window
+type breakerBucket struct {
+	epoch    int64
+	total    int
+	failures int
+}
+
+// NewCircuitBreaker creates a new circuit breaker from the given configuration
+func NewCircuitBreaker(config *BreakerConfig) (*CircuitBreaker, error) {
+	cb := &CircuitBreaker{
+		window:      time.Minute,
+		cooldown:    30 * time.Second,
+		threshold:   0.5,
+		minRequests: 10,
+		now:         time.Now,
+		states:      make(map[string]*breakerState),
+	}
+
+	if config.Window != "" {
+		window, err := time.ParseDuration(config.Window)
+		if err != nil {
+			return nil, fmt.Errorf("invalid circuit breaker window: %w", err)
+		}
+		cb.window = window
+	}
+	if config.Cooldown != "" {
+		cooldown, err := time.ParseDuration(config.Cooldown)
+		if err != nil {
+			return nil, fmt.Errorf("invalid circuit breaker cooldown: %w", err)
+		}
+		cb.cooldown = cooldown
+	}
+	if config.Threshold > 0 {
+		cb.threshold = config.Threshold
+	}
+	if config.MinRequests > 0 {
+		cb.minRequests = config.MinRequests
+	}
+
+	if cb.window < breakerBuckets {
+		return nil, fmt.Errorf("circuit breaker window too small: %s", cb.window)
+	}
+
+	return cb, nil
+}
+
+// Allow reports whether the named modifier should run. A nil breaker always allows.
+func (cb *CircuitBreaker) Allow(name string) bool {
+	if cb == nil {
+		return true
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	state, exists := cb.states[name]
+	if !exists || state.openUntil.IsZero() {
+		return true
+	}
+
+	if cb.now().Before(state.openUntil) {
+		return false
+	}
+
+	// Cooldown elapsed, close the breaker with a fresh window
+	*state = breakerState{}
+	log.Printf("Circuit breaker closed for %s modifier", name)
+	return true
+}
+
+// Record registers the outcome of a modifier execution and trips the breaker
+// when the error rate within the window exceeds the threshold
+func (cb *CircuitBreaker) Record(name string, failed bool) {
+	if cb == nil {
+		return
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	state, exists := cb.states[name]
+	if !exists {
+		state = &breakerState{}
+		cb.states[name] = state
+	}
+
+	now := cb.now()
+	bucketSize := int64(cb.window / breakerBuckets)
+	epoch := now.UnixNano() / bucketSize
+
+	bucket := &state.buckets[epoch%breakerBuckets]
+	if bucket.epoch != epoch {
+		*bucket = breakerBucket{epoch: epoch}
+	}
+	bucket.total++
+	if failed {
+		bucket.failures++
+	}
+
+	if !failed || !state.openUntil.IsZero() {
+		return
+	}
+
+	// Sum up buckets that are still inside the window
+	total, failures := 0, 0
+	for _, b := range state.buckets {
+		if epoch-b.epoch < breakerBuckets {
+			total += b.total
+			failures += b.failures
+		}
+	}
+
+	if total < cb.minRequests {
+		return
+	}
+
+	rate := float64(failures) / float64(total)
+	if rate >= cb.threshold {
+		state.openUntil = now.Add(cb.cooldown)
+		log.Printf("ALERT: circuit breaker opened for %s modifier (error rate %.2f over %d requests), bypassing for %s",
+			name, rate, total, cb.cooldown)
+	}
+}
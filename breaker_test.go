@@ -0,0 +1,87 @@
+package traefik_modifier_plugin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker_TripsAndRecovers(t *testing.T) {
+	cb, err := NewCircuitBreaker(&BreakerConfig{
+		Window:      "10s",
+		Threshold:   0.5,
+		MinRequests: 4,
+		Cooldown:    "5s",
+	})
+	if err != nil {
+		t.Fatalf("NewCircuitBreaker() error = %v", err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	cb.now = func() time.Time { return now }
+
+	// Below minimum requests the breaker stays closed
+	cb.Record(phaseHeader, true)
+	cb.Record(phaseHeader, true)
+	if !cb.Allow(phaseHeader) {
+		t.Fatalf("Expected breaker to stay closed below min requests")
+	}
+
+	cb.Record(phaseHeader, false)
+	cb.Record(phaseHeader, true)
+	if cb.Allow(phaseHeader) {
+		t.Fatalf("Expected breaker to open when error rate exceeds threshold")
+	}
+
+	// Other modifiers are not affected
+	if !cb.Allow(phaseQuery) {
+		t.Errorf("Expected query modifier to be allowed")
+	}
+
+	now = now.Add(6 * time.Second)
+	if !cb.Allow(phaseHeader) {
+		t.Errorf("Expected breaker to close after cooldown")
+	}
+}
+
+func TestCircuitBreaker_SlidingWindow(t *testing.T) {
+	cb, err := NewCircuitBreaker(&BreakerConfig{
+		Window:      "10s",
+		Threshold:   0.5,
+		MinRequests: 2,
+	})
+	if err != nil {
+		t.Fatalf("NewCircuitBreaker() error = %v", err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	cb.now = func() time.Time { return now }
+
+	cb.Record(phaseResponse, true)
+
+	// Old failure falls out of the window
+	now = now.Add(15 * time.Second)
+	cb.Record(phaseResponse, false)
+	cb.Record(phaseResponse, false)
+	cb.Record(phaseResponse, true)
+
+	if !cb.Allow(phaseResponse) {
+		t.Errorf("Expected breaker to stay closed when old failures left the window")
+	}
+}
+
+func TestCircuitBreaker_Nil(t *testing.T) {
+	var cb *CircuitBreaker
+	cb.Record(phaseHeader, true)
+	if !cb.Allow(phaseHeader) {
+		t.Errorf("Expected nil breaker to always allow")
+	}
+}
+
+func TestNewCircuitBreaker_InvalidConfig(t *testing.T) {
+	if _, err := NewCircuitBreaker(&BreakerConfig{Window: "abc"}); err == nil {
+		t.Errorf("Expected error for invalid window")
+	}
+	if _, err := NewCircuitBreaker(&BreakerConfig{Cooldown: "-"}); err == nil {
+		t.Errorf("Expected error for invalid cooldown")
+	}
+}
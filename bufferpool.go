@@ -0,0 +1,45 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"sync"
+)
+
+// bufferClasses are the capacities pooled buffers are recycled by. Buffers
+// that grew past twice the largest class are left to the garbage collector
+// so one huge response does not pin its memory in the pool.
+var bufferClasses = []int{4 << 10, 64 << 10, 1 << 20, 4 << 20}
+
+// bufferPools holds one pool per size class
+var bufferPools = make([]sync.Pool, len(bufferClasses))
+
+// getBuffer returns an empty buffer with room for sizeHint bytes, or for
+// the largest size class when sizeHint is above it
+func getBuffer(sizeHint int) *bytes.Buffer {
+	class := len(bufferClasses) - 1
+	for i, size := range bufferClasses {
+		if sizeHint <= size {
+			class = i
+			break
+		}
+	}
+	if buf, ok := bufferPools[class].Get().(*bytes.Buffer); ok {
+		return buf
+	}
+	return bytes.NewBuffer(make([]byte, 0, bufferClasses[class]))
+}
+
+// putBuffer recycles buf into the largest size class its capacity covers.
+// buf must not be used afterwards.
+func putBuffer(buf *bytes.Buffer) {
+	if buf == nil || buf.Cap() < bufferClasses[0] || buf.Cap() > 2*bufferClasses[len(bufferClasses)-1] {
+		return
+	}
+	buf.Reset()
+	for i := len(bufferClasses) - 1; i >= 0; i-- {
+		if buf.Cap() >= bufferClasses[i] {
+			bufferPools[i].Put(buf)
+			return
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestBufferPool_SizeClasses(t *testing.T) {
+	for _, tt := range []struct {
+		hint, capacity int
+	}{
+		{0, 4 << 10},
+		{4 << 10, 4 << 10},
+		{5 << 10, 64 << 10},
+		{300 << 10, 1 << 20},
+		{64 << 20, 4 << 20},
+	} {
+		buf := getBuffer(tt.hint)
+		if buf.Len() != 0 || buf.Cap() < tt.capacity {
+			t.Errorf("getBuffer(%d) returned len %d, cap %d; expected an empty buffer with cap %d", tt.hint, buf.Len(), buf.Cap(), tt.capacity)
+		}
+		buf.WriteString("data")
+		putBuffer(buf)
+	}
+
+	// Oversized buffers are not pooled
+	huge := bytes.NewBuffer(make([]byte, 0, 16<<20))
+	putBuffer(huge)
+	if huge.Len() != 0 || huge.Cap() != 16<<20 {
+		t.Errorf("Expected the oversized buffer to be left alone")
+	}
+}
+
+func TestResponseWriter_SizesBufferFromContentLength(t *testing.T) {
+	rec := httptest.NewRecorder()
+	captured := NewResponseWriter(rec)
+	captured.Header().Set("Content-Length", strconv.Itoa(200<<10))
+	captured.WriteHeader(http.StatusOK)
+	if captured.body.Cap() < 200<<10 {
+		t.Errorf("Expected a buffer for the announced length, got cap %d", captured.body.Cap())
+	}
+
+	captured.Write([]byte(`{}`))
+	if string(captured.GetBody()) != `{}` {
+		t.Errorf("Unexpected body %q", captured.GetBody())
+	}
+	captured.release()
+	if len(captured.GetBody()) != 0 {
+		t.Errorf("Expected an empty body after release")
+	}
+}
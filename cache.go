@@ -0,0 +1,178 @@
+package traefik_modifier_plugin
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ttlCache is a small in-memory cache with per-entry expiration. Entries
+// stay available to Fetch for the stale window after they expire, while
+// they are refreshed in the background.
+type ttlCache struct {
+	ttl        time.Duration
+	stale      time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu         sync.Mutex
+	entries    map[string]cacheEntry
+	refreshing map[string]bool
+}
+
+// cacheEntry holds a cached value and its expiration time
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// newTTLCache creates a new cache. A zero TTL disables caching and returns nil.
+func newTTLCache(ttl time.Duration, maxEntries int) *ttlCache {
+	if ttl <= 0 {
+		return nil
+	}
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	return &ttlCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[string]cacheEntry),
+		refreshing: make(map[string]bool),
+	}
+}
+
+// newLookupCache creates the cache of an external lookup from its
+// cache_ttl, cache_max_entries and cache_stale_while_revalidate options.
+// An empty ttl disables caching.
+func newLookupCache(name, ttl string, maxEntries int, stale string) (*ttlCache, error) {
+	if ttl == "" {
+		return nil, nil
+	}
+	duration, err := time.ParseDuration(ttl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s cache_ttl: %w", name, err)
+	}
+	cache := newTTLCache(duration, maxEntries)
+	if stale != "" {
+		window, err := time.ParseDuration(stale)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s cache_stale_while_revalidate: %w", name, err)
+		}
+		if cache != nil {
+			cache.stale = window
+		}
+	}
+	return cache, nil
+}
+
+// Get returns the cached value if present and not expired
+func (c *ttlCache) Get(key string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, exists := c.entries[key]
+	if !exists {
+		return nil, false
+	}
+	now := c.now()
+	if now.After(entry.expires) {
+		if now.After(entry.expires.Add(c.stale)) {
+			delete(c.entries, key)
+		}
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// Fetch returns the cached value of key, calling load on a miss. An expired
+// entry still inside the stale window is returned as is and refreshed in the
+// background, so only the first lookup of a key waits for load.
+func (c *ttlCache) Fetch(key string, load func() (interface{}, error)) (interface{}, error) {
+	if c == nil {
+		return load()
+	}
+
+	c.mu.Lock()
+	entry, exists := c.entries[key]
+	now := c.now()
+	if exists && !now.After(entry.expires) {
+		c.mu.Unlock()
+		return entry.value, nil
+	}
+	if exists && !now.After(entry.expires.Add(c.stale)) {
+		if !c.refreshing[key] {
+			c.refreshing[key] = true
+			go c.refresh(key, load)
+		}
+		c.mu.Unlock()
+		return entry.value, nil
+	}
+	c.mu.Unlock()
+
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+	c.Set(key, value)
+	return value, nil
+}
+
+// refresh reloads a stale entry. On failure the stale value is kept until
+// the stale window ends.
+func (c *ttlCache) refresh(key string, load func() (interface{}, error)) {
+	value, err := load()
+
+	c.mu.Lock()
+	delete(c.refreshing, key)
+	c.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Cache refresh failed, serving stale value: %v", err)
+		return
+	}
+	c.Set(key, value)
+}
+
+// Set stores a value using the cache TTL
+func (c *ttlCache) Set(key string, value interface{}) {
+	if c == nil {
+		return
+	}
+	c.SetWithTTL(key, value, c.ttl)
+}
+
+// SetWithTTL stores a value with a specific time to live, evicting expired
+// (or arbitrary) entries when full. Entries inside their stale window count
+// as expired for eviction.
+func (c *ttlCache) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	if c == nil || ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.maxEntries {
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < c.maxEntries {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[key] = cacheEntry{value: value, expires: now.Add(ttl)}
+}
@@ -0,0 +1,57 @@
+package traefik_modifier_plugin
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTTLCache_StaleWhileRevalidate(t *testing.T) {
+	cache, err := newLookupCache("test", "1m", 10, "30s")
+	if err != nil {
+		t.Fatalf("newLookupCache() error = %v", err)
+	}
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	loads := 0
+	refreshed := make(chan struct{}, 1)
+	load := func() (interface{}, error) {
+		loads++
+		if loads > 1 {
+			defer func() { refreshed <- struct{}{} }()
+		}
+		return loads, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if value, _ := cache.Fetch("key", load); value != 1 {
+			t.Errorf("Expected cached value 1, got %v", value)
+		}
+	}
+
+	// Expired but inside the stale window: stale value, background refresh
+	now = now.Add(75 * time.Second)
+	if value, _ := cache.Fetch("key", load); value != 1 {
+		t.Errorf("Expected stale value 1, got %v", value)
+	}
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a background refresh")
+	}
+	if value, _ := cache.Fetch("key", load); value != 2 {
+		t.Errorf("Expected refreshed value 2, got %v", value)
+	}
+
+	// Past the stale window: the lookup waits for load
+	now = now.Add(2 * time.Minute)
+	failing := func() (interface{}, error) { return nil, errors.New("down") }
+	if _, err := cache.Fetch("key", failing); err == nil {
+		t.Errorf("Expected load error past the stale window")
+	}
+
+	if _, err := newLookupCache("test", "1m", 0, "soon"); err == nil {
+		t.Errorf("Expected error for invalid cache_stale_while_revalidate")
+	}
+}
@@ -0,0 +1,151 @@
+package traefik_modifier_plugin
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultMaxCaptureBytes is the largest response a captureWriter buffers
+// before it streams the response to the client unprocessed
+const defaultMaxCaptureBytes = 4 << 20
+
+// captureWriter buffers a response for a component that processes it once
+// the handler returned. Responses the component cannot process are streamed
+// to the client as they are written instead: protocol switches, responses
+// the capture callback declines and bodies larger than maxBytes. Flush and
+// Hijack are forwarded so SSE and WebSocket responses keep working.
+type captureWriter struct {
+	http.ResponseWriter
+	capture   func(status int, header http.Header) bool
+	maxBytes  int64
+	status    int
+	body      bytes.Buffer
+	decided   bool
+	streaming bool
+	hijacked  bool
+}
+
+// newCaptureWriter wraps rw. capture reports whether a response with the
+// given status and headers is buffered; nil buffers every response.
+func newCaptureWriter(rw http.ResponseWriter, maxBytes int64, capture func(status int, header http.Header) bool) *captureWriter {
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxCaptureBytes
+	}
+	return &captureWriter{ResponseWriter: rw, capture: capture, maxBytes: maxBytes}
+}
+
+func (cw *captureWriter) WriteHeader(statusCode int) {
+	if cw.decided {
+		return
+	}
+	cw.status = statusCode
+	cw.decided = true
+
+	switch {
+	case statusCode == http.StatusSwitchingProtocols:
+		cw.streaming = true
+	case cw.capture != nil && !cw.capture(statusCode, cw.Header()):
+		cw.streaming = true
+	default:
+		length, err := strconv.ParseInt(cw.Header().Get("Content-Length"), 10, 64)
+		cw.streaming = err == nil && length > cw.maxBytes
+	}
+	if cw.streaming {
+		cw.ResponseWriter.WriteHeader(statusCode)
+	}
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.streaming {
+		return cw.ResponseWriter.Write(b)
+	}
+	if int64(cw.body.Len()+len(b)) > cw.maxBytes {
+		cw.startStreaming()
+		return cw.ResponseWriter.Write(b)
+	}
+	return cw.body.Write(b)
+}
+
+// startStreaming gives up buffering and sends the status and the buffered
+// body to the client
+func (cw *captureWriter) startStreaming() {
+	cw.streaming = true
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if cw.body.Len() > 0 {
+		cw.ResponseWriter.Write(cw.body.Bytes())
+	}
+	cw.body = bytes.Buffer{}
+}
+
+// Flush sends streamed data to the client. Buffered responses are only
+// written once they were processed, so Flush does nothing for them.
+func (cw *captureWriter) Flush() {
+	if !cw.decided {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.streaming {
+		return
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets the caller take over the connection, e.g. for WebSocket
+// upgrades. Nothing is written by the component afterwards.
+func (cw *captureWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err == nil {
+		cw.hijacked = true
+	}
+	return conn, buf, err
+}
+
+// captured reports whether the whole response was buffered and still has
+// to be written by the component
+func (cw *captureWriter) captured() bool {
+	return !cw.streaming && !cw.hijacked
+}
+
+// statusCode returns the buffered status, defaulting to 200 for handlers
+// that wrote nothing
+func (cw *captureWriter) statusCode() int {
+	if cw.status == 0 {
+		return http.StatusOK
+	}
+	return cw.status
+}
+
+// textContentType reports whether a content type holds text a component can
+// scan or rewrite. Event streams are excluded so they are never buffered;
+// responses without a content type are treated as text.
+func textContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "text/"), responseFormat(contentType) != "":
+		return true
+	}
+	switch mediaType {
+	case "application/javascript", "application/x-www-form-urlencoded", "application/graphql":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package traefik_modifier_plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// requestTLS returns the .request.tls data describing the verified client
+// certificate of req, or nil when the client did not present one
+func requestTLS(req *http.Request) map[string]interface{} {
+	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	cert := req.TLS.PeerCertificates[0]
+	sum := sha256.Sum256(cert.Raw)
+
+	dns := append([]string{}, cert.DNSNames...)
+	emails := append([]string{}, cert.EmailAddresses...)
+	ips := make([]string, 0, len(cert.IPAddresses))
+	for _, ip := range cert.IPAddresses {
+		ips = append(ips, ip.String())
+	}
+	uris := make([]string, 0, len(cert.URIs))
+	for _, uri := range cert.URIs {
+		uris = append(uris, uri.String())
+	}
+
+	return map[string]interface{}{
+		"subject":      cert.Subject.String(),
+		"issuer":       cert.Issuer.String(),
+		"commonName":   cert.Subject.CommonName,
+		"serialNumber": cert.SerialNumber.String(),
+		"fingerprint":  hex.EncodeToString(sum[:]),
+		"notBefore":    cert.NotBefore.UTC().Format(time.RFC3339),
+		"notAfter":     cert.NotAfter.UTC().Format(time.RFC3339),
+		"verified":     len(req.TLS.VerifiedChains) > 0,
+		"sans": map[string]interface{}{
+			"dns":    dns,
+			"emails": emails,
+			"ips":    ips,
+			"uris":   uris,
+		},
+	}
+}
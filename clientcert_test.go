@@ -0,0 +1,77 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestModifier_ClientCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "web", Organization: []string{"Acme"}},
+		DNSNames:     []string{"web.internal"},
+		IPAddresses:  []net.IP{net.ParseIP("10.0.0.5")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	sum := sha256.Sum256(der)
+
+	config := CreateConfig()
+	config.ModifierHeader = HeaderConfig{
+		"X-Client-Subject":     "[[ with .request.tls ]][[ .subject ]][[ end ]]",
+		"X-Client-Fingerprint": "[[ with .request.tls ]][[ .fingerprint ]][[ end ]]",
+		"X-Client-SANs":        `[[ with .request.tls ]][[ join "," .sans.dns ]];[[ join "," .sans.ips ]][[ end ]]`,
+	}
+
+	headers := http.Header{}
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		headers = req.Header.Clone()
+	})
+
+	handler, err := New(context.Background(), next, config, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "https://api.example.com/", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := headers.Get("X-Client-Subject"); got != "CN=web,O=Acme" {
+		t.Errorf("Expected subject CN=web,O=Acme, got %s", got)
+	}
+	if got := headers.Get("X-Client-Fingerprint"); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("Unexpected fingerprint %s", got)
+	}
+	if got := headers.Get("X-Client-SANs"); got != "web.internal;10.0.0.5" {
+		t.Errorf("Expected SANs web.internal;10.0.0.5, got %s", got)
+	}
+
+	req = httptest.NewRequest("GET", "http://api.example.com/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got := headers.Get("X-Client-Subject"); got != "" {
+		t.Errorf("Expected empty subject without a client certificate, got %s", got)
+	}
+}
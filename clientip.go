@@ -0,0 +1,121 @@
+package traefik_modifier_plugin
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIPConfig controls how .request.clientIP is derived. By default the
+// client IP is the peer address; forwarding headers are only used when
+// trusted, and only from trusted_proxies when that list is set.
+type ClientIPConfig struct {
+	TrustForwardedFor bool     `json:"trust_forwarded_for,omitempty"`
+	TrustRealIP       bool     `json:"trust_real_ip,omitempty"`
+	TrustedProxies    []string `json:"trusted_proxies,omitempty"`
+}
+
+// ClientIPResolver derives the client IP of a request
+type ClientIPResolver struct {
+	trustForwardedFor bool
+	trustRealIP       bool
+	trustedProxies    []*net.IPNet
+}
+
+// NewClientIPResolver creates a new client IP resolver
+func NewClientIPResolver(config *ClientIPConfig) (*ClientIPResolver, error) {
+	r := &ClientIPResolver{
+		trustForwardedFor: config.TrustForwardedFor,
+		trustRealIP:       config.TrustRealIP,
+	}
+
+	for _, proxy := range config.TrustedProxies {
+		cidr := proxy
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client_ip trusted proxy %q: %w", proxy, err)
+		}
+		r.trustedProxies = append(r.trustedProxies, network)
+	}
+
+	return r, nil
+}
+
+// Resolve returns the client IP of req. Without a resolver it is the host
+// part of RemoteAddr.
+func (r *ClientIPResolver) Resolve(req *http.Request) string {
+	peer := remoteIP(req)
+	if r == nil || !r.trusted(peer) {
+		return peer
+	}
+
+	if r.trustForwardedFor {
+		// Walk from the closest hop, skipping trusted proxies
+		hops := forwardedForHops(req.Header.Values("X-Forwarded-For"))
+		for i := len(hops) - 1; i >= 0; i-- {
+			if i == 0 || !r.trustedProxy(hops[i]) {
+				return hops[i]
+			}
+		}
+	}
+
+	if r.trustRealIP {
+		if ip := net.ParseIP(strings.TrimSpace(req.Header.Get("X-Real-IP"))); ip != nil {
+			return ip.String()
+		}
+	}
+
+	return peer
+}
+
+// trusted reports whether forwarding headers sent by peer may be used
+func (r *ClientIPResolver) trusted(peer string) bool {
+	if len(r.trustedProxies) == 0 {
+		return true
+	}
+	return r.trustedProxy(peer)
+}
+
+// trustedProxy reports whether ip is in trusted_proxies
+func (r *ClientIPResolver) trustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range r.trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the host part of the request peer address
+func remoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// forwardedForHops returns the valid IPs of X-Forwarded-For, client first
+func forwardedForHops(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, hop := range strings.Split(value, ",") {
+			if ip := net.ParseIP(strings.TrimSpace(hop)); ip != nil {
+				hops = append(hops, ip.String())
+			}
+		}
+	}
+	return hops
+}
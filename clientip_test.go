@@ -0,0 +1,76 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *ClientIPConfig
+		remote   string
+		xff      string
+		realIP   string
+		expected string
+	}{
+		{"peer address by default", nil, "203.0.113.7:5123", "198.51.100.1", "", "203.0.113.7"},
+		{"untrusted headers ignored", &ClientIPConfig{}, "203.0.113.7:5123", "198.51.100.1", "198.51.100.2", "203.0.113.7"},
+		{"forwarded for", &ClientIPConfig{TrustForwardedFor: true}, "10.0.0.2:80", "198.51.100.1, 10.0.0.3", "", "10.0.0.3"},
+		{"forwarded for skips trusted proxies", &ClientIPConfig{TrustForwardedFor: true, TrustedProxies: []string{"10.0.0.0/8"}}, "10.0.0.2:80", "198.51.100.1, 10.0.0.3", "", "198.51.100.1"},
+		{"forwarded for from untrusted peer", &ClientIPConfig{TrustForwardedFor: true, TrustedProxies: []string{"10.0.0.0/8"}}, "203.0.113.7:80", "198.51.100.1", "", "203.0.113.7"},
+		{"real ip", &ClientIPConfig{TrustRealIP: true, TrustedProxies: []string{"10.0.0.2"}}, "10.0.0.2:80", "", "198.51.100.2", "198.51.100.2"},
+		{"invalid real ip", &ClientIPConfig{TrustRealIP: true}, "10.0.0.2:80", "", "unknown", "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		var resolver *ClientIPResolver
+		if tt.config != nil {
+			var err error
+			if resolver, err = NewClientIPResolver(tt.config); err != nil {
+				t.Fatalf("%s: NewClientIPResolver() error = %v", tt.name, err)
+			}
+		}
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		req.RemoteAddr = tt.remote
+		if tt.xff != "" {
+			req.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		if tt.realIP != "" {
+			req.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if got := resolver.Resolve(req); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.expected, got)
+		}
+	}
+
+	if _, err := NewClientIPResolver(&ClientIPConfig{TrustedProxies: []string{"not-an-ip"}}); err == nil {
+		t.Errorf("Expected error for invalid trusted proxy")
+	}
+}
+
+func TestModifier_ClientIP(t *testing.T) {
+	config := CreateConfig()
+	config.ClientIP = &ClientIPConfig{TrustForwardedFor: true}
+	config.ModifierHeader = HeaderConfig{"X-Client-IP": "[[ .request.clientIP ]]"}
+
+	var received string
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		received = req.Header.Get("X-Client-IP")
+	})
+
+	handler, err := New(context.Background(), next, config, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if received != "198.51.100.1" {
+		t.Errorf("Expected client IP 198.51.100.1, got %s", received)
+	}
+}
@@ -0,0 +1,104 @@
+package traefik_modifier_plugin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// ConditionalTemplate is an entry of modifier_response_when. When is a
+// template rendered with the response template data; the first entry of a
+// key for which it renders true, or that has no When, masks the response.
+type ConditionalTemplate struct {
+	When     string `json:"when,omitempty"`
+	Template string `json:"template,omitempty"`
+}
+
+// responseCondition is a conditional template with its parsed templates
+type responseCondition struct {
+	when     *template.Template
+	template *template.Template
+}
+
+// SetResponseConditions parses the conditional templates of
+// modifier_response_when. A key can only have one response body transform,
+// so keys also set in modifier_response or an expression are errors.
+func (bm *BodyModifier) SetResponseConditions(response map[string][]*ConditionalTemplate) error {
+	if len(response) == 0 {
+		return nil
+	}
+	if bm.responseConditions == nil {
+		bm.responseConditions = make(map[string][]*responseCondition, len(response))
+	}
+	for key, entries := range response {
+		name := fmt.Sprintf("modifier_response_when[%s]", key)
+		_, hasTemplate := bm.templateResponse[key]
+		if _, hasProgram := bm.responsePrograms[key]; hasTemplate || hasProgram {
+			return fmt.Errorf("%s cannot be combined with another response body transform for the same key", name)
+		}
+		if len(entries) == 0 {
+			return fmt.Errorf("%s: at least one template is required", name)
+		}
+
+		conditions := make([]*responseCondition, 0, len(entries))
+		for i, entry := range entries {
+			if entry == nil || entry.Template == "" {
+				return fmt.Errorf("%s[%d]: template is required", name, i)
+			}
+			condition := &responseCondition{}
+			var err error
+			if entry.When != "" {
+				whenKey := fmt.Sprintf("modifier_response_when[%s:%d:when]", key, i)
+				if condition.when, err = template.New(whenKey).Funcs(bm.funcs).Delims("[[", "]]").Parse(entry.When); err != nil {
+					return newTemplateError(whenKey, err)
+				}
+			}
+			templateKey := fmt.Sprintf("modifier_response_when[%s:%d]", key, i)
+			if condition.template, err = template.New(templateKey).Funcs(bm.funcs).Delims("[[", "]]").Parse(entry.Template); err != nil {
+				return newTemplateError(templateKey, err)
+			}
+			conditions = append(conditions, condition)
+		}
+		bm.responseConditions[key] = conditions
+		bm.addResponseKey("modifier_response_when", key)
+	}
+	bm.sortResponseRanges()
+	return nil
+}
+
+// selectResponseCondition returns the template of the first condition that
+// renders true for templateData, or nil when none does
+func selectResponseCondition(conditions []*responseCondition, templateData map[string]interface{}, ctx *TemplateContext) (*template.Template, error) {
+	for _, condition := range conditions {
+		if condition.when == nil {
+			return condition.template, nil
+		}
+		buf := newTemplateOutput(ctx)
+		if err := condition.when.Execute(buf, templateData); err != nil {
+			buf.release()
+			err = newTemplateError(condition.when.Name(), err)
+			traceTemplate(ctx, condition.when.Name(), nil, err)
+			return nil, err
+		}
+		traceTemplate(ctx, condition.when.Name(), buf.Bytes(), nil)
+		matched, _ := strconv.ParseBool(strings.TrimSpace(buf.String()))
+		buf.release()
+		if matched {
+			return condition.template, nil
+		}
+	}
+	return nil, nil
+}
+
+// inheritedConditions returns the base conditional templates whose keys the
+// overlay templates do not override
+func inheritedConditions(base map[string][]*ConditionalTemplate, overlayTemplates map[string]string) map[string][]*ConditionalTemplate {
+	conditions := make(map[string][]*ConditionalTemplate, len(base))
+	for status, entries := range base {
+		if _, overridden := overlayTemplates[status]; !overridden {
+			conditions[status] = entries
+		}
+	}
+	return conditions
+}
@@ -0,0 +1,62 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestModifier_ResponseConditions(t *testing.T) {
+	config := CreateConfig()
+	config.ModifierResponseWhen = map[string][]*ConditionalTemplate{
+		"4xx": {
+			{When: `[[ eq .response.body.error.code "AUTH" ]]`, Template: `{"error": "unauthorized"}`},
+			{When: `[[ eq .response.body.error.code "VALIDATION" ]]`, Template: `{"error": "invalid", "fields": [[ toJSON .response.body.error.fields ]]}`},
+		},
+		"5xx": {
+			{When: `[[ eq .response.body.retry true ]]`, Template: `{"error": "try_again"}`},
+			{Template: `{"error": "unavailable"}`},
+		},
+	}
+
+	for _, tt := range []struct {
+		status         int
+		body, expected string
+	}{
+		{http.StatusUnauthorized, `{"error": {"code": "AUTH", "user": "jane"}}`, `{"error": "unauthorized"}`},
+		{http.StatusBadRequest, `{"error": {"code": "VALIDATION", "fields": ["email"]}}`, `{"error": "invalid", "fields": ["email"]}`},
+		{http.StatusConflict, `{"error": {"code": "CONFLICT"}}`, `{"error": {"code": "CONFLICT"}}`},
+		{http.StatusBadGateway, `{"retry": true}`, `{"error": "try_again"}`},
+		{http.StatusInternalServerError, `{"trace": "..."}`, `{"error": "unavailable"}`},
+	} {
+		handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(tt.status)
+			io.WriteString(rw, tt.body)
+		}), config, "conditions")
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		if rec.Code != tt.status || rec.Body.String() != tt.expected {
+			t.Errorf("%d %s: expected %q, got %d %q", tt.status, tt.body, tt.expected, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestBodyModifier_SetResponseConditionsErrors(t *testing.T) {
+	for name, conditions := range map[string]map[string][]*ConditionalTemplate{
+		"duplicate key":    {"200": {{Template: `{}`}}},
+		"empty list":       {"404": {}},
+		"missing template": {"404": {{When: `true`}}},
+		"invalid when":     {"404": {{When: `[[ if ]]`, Template: `{}`}}},
+	} {
+		bm := NewBodyModifier("", map[string]string{"200": `{}`})
+		if err := bm.SetResponseConditions(conditions); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package traefik_modifier_plugin
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// CookieConfig holds the request cookie modification configuration. Set
+// values are templates; an empty result leaves the cookie untouched.
+type CookieConfig struct {
+	Set    map[string]string `json:"set,omitempty"`
+	Remove []string          `json:"remove,omitempty"`
+}
+
+// CookieModifier sets and removes request cookies, rebuilding the Cookie header
+type CookieModifier struct {
+	templates map[string]*template.Template
+	names     []string
+	remove    map[string]bool
+}
+
+// requestCookies returns the .request.cookies data of req. When a cookie is
+// sent more than once, the first value wins, as with http.Request.Cookie.
+func requestCookies(req *http.Request) map[string]string {
+	cookies := make(map[string]string)
+	for _, cookie := range req.Cookies() {
+		if _, exists := cookies[cookie.Name]; !exists {
+			cookies[cookie.Name] = cookie.Value
+		}
+	}
+	return cookies
+}
+
+// NewCookieModifier creates a new cookie modifier
+func NewCookieModifier(config *CookieConfig, funcs template.FuncMap) (*CookieModifier, error) {
+	cm := &CookieModifier{
+		templates: make(map[string]*template.Template),
+		remove:    make(map[string]bool),
+	}
+
+	for name, value := range config.Set {
+		if !validCookieName(name) {
+			return nil, fmt.Errorf("invalid modifier_cookie name %q", name)
+		}
+		key := "modifier_cookie[" + name + "]"
+		tmpl, err := template.New(key).Funcs(funcs).Delims("[[", "]]").Parse(value)
+		if err != nil {
+			return nil, newTemplateError(key, err)
+		}
+		cm.templates[name] = tmpl
+		cm.names = append(cm.names, name)
+	}
+	sort.Strings(cm.names)
+
+	for _, name := range config.Remove {
+		if !validCookieName(name) {
+			return nil, fmt.Errorf("invalid modifier_cookie name %q", name)
+		}
+		if _, exists := cm.templates[name]; exists {
+			return nil, fmt.Errorf("modifier_cookie %q is both set and removed", name)
+		}
+		cm.remove[name] = true
+	}
+
+	return cm, nil
+}
+
+// ModifyCookies applies the configured cookies to req. Existing cookies keep
+// their position, set cookies replace every cookie of the same name and new
+// cookies are appended. Failing templates are skipped and the last error is
+// returned.
+func (cm *CookieModifier) ModifyCookies(req *http.Request, ctx *TemplateContext) error {
+	templateData := buildTemplateData(ctx, map[string]interface{}{
+		"request": requestTemplateData(req),
+	})
+
+	var execErr error
+	values := make(map[string]string, len(cm.templates))
+	for _, name := range cm.names {
+		tmpl := cm.templates[name]
+		buf := newTemplateOutput(ctx)
+		if err := tmpl.Execute(buf, templateData); err != nil {
+			execErr = newTemplateError(tmpl.Name(), err)
+			traceTemplate(ctx, tmpl.Name(), nil, execErr)
+			buf.release()
+			continue
+		}
+		traceTemplate(ctx, tmpl.Name(), buf.Bytes(), nil)
+		if value := strings.TrimSpace(buf.String()); value != "" {
+			values[name] = value
+		}
+		buf.release()
+	}
+
+	var pairs []string
+	written := make(map[string]bool)
+	for _, cookie := range req.Cookies() {
+		if cm.remove[cookie.Name] || written[cookie.Name] {
+			continue
+		}
+		if value, exists := values[cookie.Name]; exists {
+			cookie.Value = value
+			written[cookie.Name] = true
+		}
+		pairs = append(pairs, cookiePair(cookie.Name, cookie.Value))
+	}
+	for _, name := range cm.names {
+		if value, exists := values[name]; exists && !written[name] {
+			pairs = append(pairs, cookiePair(name, value))
+		}
+	}
+
+	req.Header.Del("Cookie")
+	if len(pairs) > 0 {
+		req.Header.Set("Cookie", strings.Join(pairs, "; "))
+	}
+	return execErr
+}
+
+// cookiePair formats a request cookie, quoting or dropping invalid value bytes
+func cookiePair(name, value string) string {
+	return (&http.Cookie{Name: name, Value: value}).String()
+}
+
+// validCookieName reports whether name is a valid cookie name token
+func validCookieName(name string) bool {
+	return name != "" && cookiePair(name, "") != ""
+}
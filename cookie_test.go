@@ -0,0 +1,83 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestModifier_RequestCookies(t *testing.T) {
+	config := CreateConfig()
+	config.ModifierHeader = HeaderConfig{
+		"Authorization": `[[ with .request.cookies.session ]]Bearer [[ . ]][[ end ]]`,
+	}
+	config.ModifierRequest = `{"session": "[[ .request.cookies.session ]]", "theme": "[[ index .request.cookies "theme" ]]"}`
+
+	var authorization, body string
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		authorization = req.Header.Get("Authorization")
+		data, _ := io.ReadAll(req.Body)
+		body = string(data)
+	})
+
+	handler, err := New(context.Background(), next, config, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "http://example.com/", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Cookie", "session=abc123; theme=dark; session=ignored")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if authorization != "Bearer abc123" {
+		t.Errorf("Expected Bearer abc123, got %q", authorization)
+	}
+	if !strings.Contains(body, `"session": "abc123"`) || !strings.Contains(body, `"theme": "dark"`) {
+		t.Errorf("Expected cookies in body, got %s", body)
+	}
+}
+
+func TestModifier_CookieModification(t *testing.T) {
+	config := CreateConfig()
+	config.ModifierCookie = &CookieConfig{
+		Set: map[string]string{
+			"affinity": `node-[[ index .request.headers "x-node" ]]`,
+			"consent":  "granted",
+			"optional": `[[ if .request.cookies.missing ]]x[[ end ]]`,
+		},
+		Remove: []string{"tracking"},
+	}
+
+	var cookie string
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		cookie = req.Header.Get("Cookie")
+	})
+
+	handler, err := New(context.Background(), next, config, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("X-Node", "2")
+	req.Header.Add("Cookie", "session=abc; affinity=node-1; tracking=xyz")
+	req.Header.Add("Cookie", "affinity=stale")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if expected := "session=abc; affinity=node-2; consent=granted"; cookie != expected {
+		t.Errorf("Expected Cookie %q, got %q", expected, cookie)
+	}
+
+	for _, invalid := range []*CookieConfig{
+		{Set: map[string]string{"bad name": "x"}},
+		{Set: map[string]string{"a": "x"}, Remove: []string{"a"}},
+	} {
+		if _, err := NewCookieModifier(invalid, nil); err == nil {
+			t.Errorf("Expected error for %+v", invalid)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package traefik_modifier_plugin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// maxDebugOutput bounds each template output in the debug header
+const maxDebugOutput = 1024
+
+// maxDebugHeader bounds the whole debug header, which proxies and clients
+// reject when it grows past their header size limits
+const maxDebugHeader = 8 << 10
+
+// debugRedacted replaces credentials in the debug output
+const debugRedacted = "[redacted]"
+
+// debugHiddenGlobals are template globals left out of the debug output
+var debugHiddenGlobals = []string{"secrets", "env", "vault"}
+
+// debugRedactedFields are request fields whose values are credentials: the
+// request cookies and the verified JWT claims
+var debugRedactedFields = []string{"cookies", "jwt"}
+
+// debugRedactedHeaders are headers whose template outputs are credentials
+var debugRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// DebugConfig holds the per-request template debug configuration. Requests
+// carrying Header with the value Secret get the evaluated template context
+// and the output of each template in the ResponseHeader response header.
+type DebugConfig struct {
+	Header         string `json:"header,omitempty"`
+	Secret         string `json:"secret,omitempty"`
+	ResponseHeader string `json:"response_header,omitempty"`
+}
+
+// Debugger reports template evaluation for requests with the trigger header
+type Debugger struct {
+	header         string
+	secret         []byte
+	responseHeader string
+}
+
+// debugTrace records the templates executed for one request
+type debugTrace struct {
+	Templates []debugTemplate `json:"templates"`
+}
+
+// debugTemplate is the output or error of one template execution
+type debugTemplate struct {
+	Name      string `json:"name"`
+	Output    string `json:"output,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// NewDebugger creates the debug trigger; the secret is required
+func NewDebugger(config *DebugConfig) (*Debugger, error) {
+	if config.Secret == "" {
+		return nil, errors.New("debug secret is required")
+	}
+
+	d := &Debugger{
+		header:         config.Header,
+		secret:         []byte(config.Secret),
+		responseHeader: config.ResponseHeader,
+	}
+	if d.header == "" {
+		d.header = "X-Modifier-Debug"
+	}
+	if d.responseHeader == "" {
+		d.responseHeader = "X-Modifier-Debug"
+	}
+	return d, nil
+}
+
+// Triggered reports whether req carries the trigger header with the secret.
+// The trigger header is removed so it does not reach the upstream.
+func (d *Debugger) Triggered(req *http.Request) bool {
+	if d == nil {
+		return false
+	}
+	value := req.Header.Get(d.header)
+	if value == "" {
+		return false
+	}
+	req.Header.Del(d.header)
+	return subtle.ConstantTimeCompare([]byte(value), d.secret) == 1
+}
+
+// ResponseWriter starts a template trace in ctx and wraps rw so the trace is
+// written to the debug response header right before the status line
+func (d *Debugger) ResponseWriter(rw http.ResponseWriter, ctx *TemplateContext) http.ResponseWriter {
+	trace := &debugTrace{}
+	(*ctx)[debugKey] = trace
+	return &headerResponseWriter{ResponseWriter: rw, modify: func(int) {
+		output := map[string]interface{}{
+			"templates": trace.Templates,
+		}
+		data := buildTemplateData(ctx, map[string]interface{}{})
+		for _, name := range debugHiddenGlobals {
+			delete(data, name)
+		}
+		if request, ok := data["request"].(map[string]interface{}); ok {
+			for _, name := range debugRedactedFields {
+				if _, exists := request[name]; exists {
+					request[name] = debugRedacted
+				}
+			}
+		}
+		if _, err := json.Marshal(data); err == nil {
+			output["data"] = data
+		}
+
+		value, err := marshalDebugOutput(output)
+		if err != nil {
+			requestLog(ctx).errorf("debug", "", "Debug output error: %v", err)
+			return
+		}
+		rw.Header().Set(d.responseHeader, string(value))
+	}}
+}
+
+// marshalDebugOutput encodes output within maxDebugHeader. The template
+// data goes first, then the last templates, and truncated is set.
+func marshalDebugOutput(output map[string]interface{}) ([]byte, error) {
+	value, err := json.Marshal(output)
+	if err != nil || len(value) <= maxDebugHeader {
+		return value, err
+	}
+
+	delete(output, "data")
+	output["truncated"] = true
+	templates, _ := output["templates"].([]debugTemplate)
+	for {
+		output["templates"] = templates
+		value, err = json.Marshal(output)
+		if err != nil || len(value) <= maxDebugHeader || len(templates) == 0 {
+			return value, err
+		}
+		templates = templates[:len(templates)-1]
+	}
+}
+
+// debugRedactedTemplate reports whether the output of the template name is
+// a credential: a cookie value or one of debugRedactedHeaders
+func debugRedactedTemplate(name string) bool {
+	if strings.HasPrefix(name, "modifier_cookie[") {
+		return true
+	}
+	start := strings.IndexByte(name, '[')
+	if start < 0 || !strings.HasSuffix(name, "]") {
+		return false
+	}
+	header := name[start+1 : len(name)-1]
+	for _, redacted := range debugRedactedHeaders {
+		if strings.EqualFold(header, redacted) {
+			return true
+		}
+	}
+	return false
+}
+
+// traceTemplate records the output of the template name when the request
+// is being debugged, and its name on the current span when it is traced
+func traceTemplate(ctx *TemplateContext, name string, output []byte, err error) {
+	if ctx == nil {
+		return
+	}
+	if rt := requestTracing(ctx); rt != nil {
+		rt.templateExecuted(name)
+	}
+	trace, ok := (*ctx)[debugKey].(*debugTrace)
+	if !ok {
+		return
+	}
+
+	t := debugTemplate{Name: name}
+	switch {
+	case err != nil:
+		t.Error = err.Error()
+	case debugRedactedTemplate(name):
+		t.Output = debugRedacted
+	default:
+		if len(output) > maxDebugOutput {
+			output, t.Truncated = output[:maxDebugOutput], true
+		}
+		t.Output = string(output)
+	}
+	trace.Templates = append(trace.Templates, t)
+}
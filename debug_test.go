@@ -0,0 +1,140 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestModifier_Debug(t *testing.T) {
+	config := CreateConfig()
+	config.Debug = &DebugConfig{Secret: "s3cret"}
+	config.ModifierHeader = HeaderConfig{"X-Method": "[[ .request.method ]]"}
+	config.ModifierRequest = `{"name": "[[ .request.api.body.name ]]"}`
+	config.ModifierResponse = map[string]string{"200": `[[ index .response.body.items 5 ]]`}
+
+	var trigger string
+	handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		trigger = req.Header.Get("X-Modifier-Debug")
+		io.WriteString(rw, `{"items": []}`)
+	}), config, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	for _, secret := range []string{"", "wrong", "s3cret"} {
+		req := httptest.NewRequest("POST", "/orders", strings.NewReader(`{"name": "book"}`))
+		if secret != "" {
+			req.Header.Set("X-Modifier-Debug", secret)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if trigger != "" {
+			t.Errorf("%q: expected the trigger header to be removed upstream", secret)
+		}
+		value := rec.Header().Get("X-Modifier-Debug")
+		if secret != "s3cret" {
+			if value != "" {
+				t.Errorf("%q: expected no debug output, got %s", secret, value)
+			}
+			continue
+		}
+
+		var output struct {
+			Templates []debugTemplate        `json:"templates"`
+			Data      map[string]interface{} `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(value), &output); err != nil {
+			t.Fatalf("Invalid debug output %q: %v", value, err)
+		}
+		outputs := map[string]debugTemplate{}
+		for _, tmpl := range output.Templates {
+			outputs[tmpl.Name] = tmpl
+		}
+		if got := outputs["modifier_header[X-Method]"].Output; got != "POST" {
+			t.Errorf("Expected header output POST, got %q", got)
+		}
+		if got := outputs["modifier_request"].Output; got != `{"name": "book"}` {
+			t.Errorf("Expected request output, got %q", got)
+		}
+		if outputs["modifier_response[200]"].Error == "" {
+			t.Errorf("Expected response template error, got %+v", outputs["modifier_response[200]"])
+		}
+		if _, ok := output.Data["context"]; !ok {
+			t.Errorf("Expected the template context in %v", output.Data)
+		}
+	}
+
+	if _, err := NewDebugger(&DebugConfig{}); err == nil {
+		t.Errorf("Expected error without a debug secret")
+	}
+}
+
+func TestModifier_DebugRedaction(t *testing.T) {
+	config := CreateConfig()
+	config.Debug = &DebugConfig{Secret: "s3cret"}
+	config.ModifierHeader = HeaderConfig{
+		"Authorization": "Bearer [[ .request.cookies.session ]]",
+		"X-Method":      "[[ .request.method ]]",
+	}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) { io.WriteString(rw, "ok") }), config, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Modifier-Debug", "s3cret")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "token-123"})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	value := rec.Header().Get("X-Modifier-Debug")
+	if value == "" || strings.Contains(value, "token-123") {
+		t.Fatalf("Expected the session cookie to be redacted, got %s", value)
+	}
+	var output struct {
+		Templates []debugTemplate `json:"templates"`
+	}
+	if err := json.Unmarshal([]byte(value), &output); err != nil {
+		t.Fatalf("Invalid debug output %q: %v", value, err)
+	}
+	for _, tmpl := range output.Templates {
+		if tmpl.Name == "modifier_header[X-Method]" && tmpl.Output != "GET" {
+			t.Errorf("Expected other outputs to be kept, got %+v", tmpl)
+		}
+	}
+
+	// Many large outputs are cut to the header limit
+	config.ModifierHeader = HeaderConfig{}
+	for i := 0; i < 20; i++ {
+		config.ModifierHeader["X-Large-"+strconv.Itoa(i)] = strings.Repeat("x", maxDebugOutput)
+	}
+	handler, err = New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) { io.WriteString(rw, "ok") }), config, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Modifier-Debug", "s3cret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	value = rec.Header().Get("X-Modifier-Debug")
+	var truncated struct {
+		Templates []debugTemplate        `json:"templates"`
+		Data      map[string]interface{} `json:"data"`
+		Truncated bool                   `json:"truncated"`
+	}
+	if err := json.Unmarshal([]byte(value), &truncated); err != nil {
+		t.Fatalf("Invalid debug output %q: %v", value, err)
+	}
+	if len(value) > maxDebugHeader || !truncated.Truncated || truncated.Data != nil || len(truncated.Templates) == 0 || len(truncated.Templates) >= 20 {
+		t.Errorf("Expected a truncated debug header, got %d bytes with %d templates", len(value), len(truncated.Templates))
+	}
+}
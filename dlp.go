@@ -0,0 +1,388 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// DLP actions
+const (
+	dlpActionMask  = "mask"
+	dlpActionBlock = "block"
+	dlpActionLog   = "log"
+)
+
+// dlpBuiltinPatterns are the detectors available by type
+var dlpBuiltinPatterns = map[string]string{
+	"card_number": `\b(?:\d[ -]?){12,18}\d\b`,
+	"nik":         `\b\d{16}\b`,
+	"email":       `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+}
+
+const defaultDLPBlockBody = `{"error":"Response blocked by data loss prevention policy"}`
+
+// DLPConfig holds the data loss prevention configuration
+type DLPConfig struct {
+	Detectors     []DLPDetectorConfig `json:"detectors,omitempty"`
+	BlockStatus   int                 `json:"block_status,omitempty"`
+	BlockTemplate string              `json:"block_template,omitempty"`
+	MaxBodyBytes  int64               `json:"max_body_bytes,omitempty"`
+}
+
+// DLPDetectorConfig describes a named detector and the action taken on a match
+type DLPDetectorConfig struct {
+	Name        string   `json:"name,omitempty"`
+	Type        string   `json:"type,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"`
+	Paths       []string `json:"paths,omitempty"`
+	Action      string   `json:"action,omitempty"`
+	Replacement string   `json:"replacement,omitempty"`
+	KeepLast    int      `json:"keep_last,omitempty"`
+}
+
+// DLPScanner scans responses for sensitive data before they leave the gateway
+type DLPScanner struct {
+	detectors   []*dlpDetector
+	blockStatus int
+	block       *template.Template
+	maxBody     int64
+}
+
+// dlpDetector is a compiled detector
+type dlpDetector struct {
+	name        string
+	pattern     *regexp.Regexp
+	luhn        bool
+	paths       [][]string
+	action      string
+	replacement string
+	keepLast    int
+}
+
+// NewDLPScanner compiles the detectors and the block template
+func NewDLPScanner(config *DLPConfig, funcs template.FuncMap) (*DLPScanner, error) {
+	if len(config.Detectors) == 0 {
+		return nil, errors.New("dlp requires at least one detector")
+	}
+
+	ds := &DLPScanner{blockStatus: config.BlockStatus}
+	if ds.blockStatus == 0 {
+		ds.blockStatus = http.StatusForbidden
+	}
+	if config.MaxBodyBytes < 0 {
+		return nil, errors.New("dlp max_body_bytes must not be negative")
+	}
+	ds.maxBody = config.MaxBodyBytes
+
+	if config.BlockTemplate != "" {
+		tmpl, err := template.New("dlp[block]").Funcs(funcs).Delims("[[", "]]").Parse(config.BlockTemplate)
+		if err != nil {
+			return nil, newTemplateError("dlp[block]", err)
+		}
+		ds.block = tmpl
+	}
+
+	for _, dc := range config.Detectors {
+		detector := &dlpDetector{
+			name:        dc.Name,
+			action:      dc.Action,
+			replacement: dc.Replacement,
+			keepLast:    dc.KeepLast,
+		}
+		if detector.name == "" {
+			detector.name = dc.Type
+		}
+		if detector.name == "" {
+			return nil, errors.New("dlp detector requires a name or type")
+		}
+
+		switch detector.action {
+		case "":
+			detector.action = dlpActionMask
+		case dlpActionMask, dlpActionBlock, dlpActionLog:
+		default:
+			return nil, fmt.Errorf("invalid dlp action %q for detector %s", dc.Action, detector.name)
+		}
+
+		pattern := dc.Pattern
+		if pattern == "" {
+			builtin, ok := dlpBuiltinPatterns[dc.Type]
+			if !ok {
+				return nil, fmt.Errorf("dlp detector %s requires a pattern or a known type", detector.name)
+			}
+			pattern = builtin
+			detector.luhn = dc.Type == "card_number"
+		}
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dlp pattern for detector %s: %w", detector.name, err)
+		}
+		detector.pattern = compiled
+
+		detector.paths = splitJSONPaths(dc.Paths)
+
+		ds.detectors = append(ds.detectors, detector)
+	}
+
+	return ds, nil
+}
+
+// ResponseWriter wraps rw so the response is scanned when Finish is called.
+// Non-text responses and responses larger than max_body_bytes are streamed
+// to the client unscanned.
+func (ds *DLPScanner) ResponseWriter(rw http.ResponseWriter) *captureWriter {
+	return newCaptureWriter(rw, ds.maxBody, func(status int, header http.Header) bool {
+		return textContentType(header.Get("Content-Type"))
+	})
+}
+
+// Finish scans the buffered response, applies mask actions and writes the
+// result, or the block response when a block detector matched. Gzip and
+// deflate responses are scanned decoded. It returns the names of the
+// detectors that matched.
+func (ds *DLPScanner) Finish(dw *captureWriter, req *http.Request, ctx *TemplateContext) ([]string, error) {
+	if !dw.captured() {
+		return nil, nil
+	}
+	status := dw.statusCode()
+	header := dw.ResponseWriter.Header()
+	original := dw.body.Bytes()
+	body := original
+
+	encoding := header.Get("Content-Encoding")
+	if encoding == "identity" {
+		encoding = ""
+	}
+	if encoding != "" {
+		decoded, err := decodeContentEncoding(encoding, original, ds.maxBody)
+		if err != nil {
+			dw.ResponseWriter.WriteHeader(status)
+			dw.ResponseWriter.Write(original)
+			return nil, fmt.Errorf("dlp: cannot scan %s encoded response: %w", encoding, err)
+		}
+		body = decoded
+	}
+
+	scan := &dlpScan{matched: make(map[string]bool)}
+	var data interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if len(body) > 0 && decoder.Decode(&data) == nil {
+		data = ds.scanValue(scan, data, nil)
+		if scan.masked {
+			if encoded, err := json.Marshal(data); err == nil {
+				body = encoded
+			}
+		}
+	} else {
+		masked := ds.scanString(scan, string(body), nil)
+		if scan.masked {
+			body = []byte(masked)
+		}
+	}
+
+	var fired []string
+	for _, detector := range ds.detectors {
+		if scan.matched[detector.name] {
+			fired = append(fired, detector.name)
+			if detector.action == dlpActionLog {
+				requestLog(ctx).warnf("dlp", "", "DLP detector %s matched response for %s", detector.name, req.URL.Path)
+			}
+		}
+	}
+
+	if scan.blocked {
+		blockBody, err := ds.blockBody(fired, req, ctx)
+		if err != nil {
+			requestLog(ctx).warnf("dlp", "", "DLP block template error: %v", err)
+			blockBody = []byte(defaultDLPBlockBody)
+		}
+		for name := range header {
+			header.Del(name)
+		}
+		header.Set("Content-Type", "application/json")
+		header.Set("Content-Length", strconv.Itoa(len(blockBody)))
+		dw.ResponseWriter.WriteHeader(ds.blockStatus)
+		dw.ResponseWriter.Write(blockBody)
+		return fired, nil
+	}
+
+	// Masked bodies are encoded again; others are written as received
+	if !scan.masked {
+		body = original
+	} else if encoding != "" {
+		encoded, err := encodeContentEncoding(encoding, body)
+		if err != nil {
+			header.Del("Content-Encoding")
+		} else {
+			body = encoded
+		}
+	}
+
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	dw.ResponseWriter.WriteHeader(status)
+	dw.ResponseWriter.Write(body)
+	return fired, nil
+}
+
+// blockBody renders the block template with the matched detector names
+func (ds *DLPScanner) blockBody(fired []string, req *http.Request, ctx *TemplateContext) ([]byte, error) {
+	if ds.block == nil {
+		return []byte(defaultDLPBlockBody), nil
+	}
+
+	data := buildTemplateData(ctx, map[string]interface{}{
+		"request": requestTemplateData(req),
+		"dlp": map[string]interface{}{
+			"detectors": fired,
+		},
+	})
+	buf := newTemplateOutput(ctx)
+	defer buf.release()
+	if err := ds.block.Execute(buf, data); err != nil {
+		return nil, newTemplateError("dlp[block]", err)
+	}
+	return append([]byte(nil), buf.Bytes()...), nil
+}
+
+// dlpScan collects the results of scanning a response
+type dlpScan struct {
+	matched map[string]bool
+	masked  bool
+	blocked bool
+}
+
+// scanValue scans the string and number leaves of a JSON value, returning
+// the value with masked leaves replaced
+func (ds *DLPScanner) scanValue(scan *dlpScan, value interface{}, path []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = ds.scanValue(scan, child, append(path[:len(path):len(path)], key))
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = ds.scanValue(scan, child, append(path[:len(path):len(path)], strconv.Itoa(i)))
+		}
+	case string:
+		return ds.scanString(scan, v, path)
+	case json.Number:
+		if masked := ds.scanString(scan, v.String(), path); masked != v.String() {
+			return masked
+		}
+	}
+	return value
+}
+
+// scanString runs the detectors that apply to path over s. A nil path means
+// a non-JSON body, which only detectors without paths scan.
+func (ds *DLPScanner) scanString(scan *dlpScan, s string, path []string) string {
+	for _, detector := range ds.detectors {
+		if !detector.appliesTo(path) {
+			continue
+		}
+
+		matched := false
+		s = detector.pattern.ReplaceAllStringFunc(s, func(match string) string {
+			if detector.luhn && !luhnValid(match) {
+				return match
+			}
+			matched = true
+			if detector.action != dlpActionMask {
+				return match
+			}
+			scan.masked = true
+			return detector.mask(match)
+		})
+
+		if matched {
+			scan.matched[detector.name] = true
+			if detector.action == dlpActionBlock {
+				scan.blocked = true
+			}
+		}
+	}
+	return s
+}
+
+// appliesTo reports whether the detector scans the value at path
+func (d *dlpDetector) appliesTo(path []string) bool {
+	if len(d.paths) == 0 {
+		return true
+	}
+	return path != nil && jsonPathMatches(d.paths, path)
+}
+
+// splitJSONPaths splits paths such as $.items.*.email into their segments
+func splitJSONPaths(paths []string) [][]string {
+	var split [][]string
+	for _, path := range paths {
+		path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+		split = append(split, strings.Split(path, "."))
+	}
+	return split
+}
+
+// jsonPathMatches reports whether path matches one of the split patterns,
+// where a * segment matches any key or index
+func jsonPathMatches(patterns [][]string, path []string) bool {
+	for _, pattern := range patterns {
+		if len(pattern) != len(path) {
+			continue
+		}
+		match := true
+		for i := range pattern {
+			if pattern[i] != "*" && pattern[i] != path[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// mask replaces a match with the configured replacement, or with asterisks
+// keeping the last keepLast characters
+func (d *dlpDetector) mask(match string) string {
+	if d.replacement != "" {
+		return d.pattern.ReplaceAllString(match, d.replacement)
+	}
+	keep := d.keepLast
+	if keep > len(match) {
+		keep = len(match)
+	}
+	return strings.Repeat("*", len(match)-keep) + match[len(match)-keep:]
+}
+
+// luhnValid reports whether the digits of s pass the Luhn checksum
+func luhnValid(s string) bool {
+	sum, count := 0, 0
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		digit := int(c - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+		count++
+	}
+	return count >= 13 && sum%10 == 0
+}
@@ -0,0 +1,151 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hukumonline-com/traefik-modifier-plugin/pkg"
+)
+
+func TestDLPScanner_Finish(t *testing.T) {
+	ds, err := NewDLPScanner(&DLPConfig{
+		Detectors: []DLPDetectorConfig{
+			{Type: "card_number", KeepLast: 4},
+			{Name: "nik", Type: "nik", Paths: []string{"$.customers.*.nik"}},
+			{Name: "secret", Pattern: `sk_live_[A-Za-z0-9]+`, Action: "block"},
+		},
+		BlockTemplate: `{"error": "blocked", "detectors": [[ toJSON .dlp.detectors ]]}`,
+	}, pkg.SimpleFuncMap())
+	if err != nil {
+		t.Fatalf("NewDLPScanner() error = %v", err)
+	}
+
+	scan := func(body string) (*httptest.ResponseRecorder, []string) {
+		rec := httptest.NewRecorder()
+		dw := ds.ResponseWriter(rec)
+		dw.Header().Set("Content-Type", "application/json")
+		dw.WriteHeader(http.StatusOK)
+		dw.Write([]byte(body))
+		fired, err := ds.Finish(dw, httptest.NewRequest("GET", "/customers", nil), &TemplateContext{})
+		if err != nil {
+			t.Fatalf("Finish() error = %v", err)
+		}
+		return rec, fired
+	}
+
+	// Card numbers failing the Luhn check and NIKs outside the paths are kept
+	rec, fired := scan(`{"customers":[{"nik":"3201234567890123","card":"4111 1111 1111 1111","ref":"1234567890123456"}],"nik":"3201234567890123"}`)
+	expected := `{"customers":[{"card":"***************1111","nik":"****************","ref":"1234567890123456"}],"nik":"3201234567890123"}`
+	if rec.Code != http.StatusOK || rec.Body.String() != expected {
+		t.Errorf("Unexpected masked response %d:\n%s\nexpected:\n%s", rec.Code, rec.Body.String(), expected)
+	}
+	if len(fired) != 2 || fired[0] != "card_number" || fired[1] != "nik" {
+		t.Errorf("Unexpected fired detectors %v", fired)
+	}
+
+	// Block detectors replace the response with the block template
+	rec, _ = scan(`{"config":{"key":"sk_live_abc123"}}`)
+	if rec.Code != http.StatusForbidden || rec.Body.String() != `{"error": "blocked", "detectors": ["secret"]}` {
+		t.Errorf("Unexpected block response %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Unmatched responses pass through untouched
+	rec, fired = scan(`{"status": "ok"}`)
+	if rec.Body.String() != `{"status": "ok"}` || len(fired) != 0 {
+		t.Errorf("Unexpected response %s (fired %v)", rec.Body.String(), fired)
+	}
+
+	if _, err := NewDLPScanner(&DLPConfig{Detectors: []DLPDetectorConfig{{Name: "x"}}}, nil); err == nil {
+		t.Errorf("Expected error for detector without pattern")
+	}
+}
+
+func TestModifier_DLPCompressedResponse(t *testing.T) {
+	config := CreateConfig()
+	config.DLP = &DLPConfig{Detectors: []DLPDetectorConfig{
+		{Name: "secret", Pattern: `sk_live_[A-Za-z0-9]+`, Action: "block"},
+		{Type: "email"},
+	}}
+
+	var acceptEncoding string
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		acceptEncoding = req.Header.Get("Accept-Encoding")
+		body, _ := encodeContentEncoding("gzip", []byte(req.URL.Query().Get("body")))
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Set("Content-Encoding", "gzip")
+		rw.Write(body)
+	})
+
+	handler, err := New(context.Background(), next, config, "dlp")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	serve := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/?body="+url.QueryEscape(body), nil)
+		req.Header.Set("Accept-Encoding", "br, gzip")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Block detectors see through the compression
+	rec := serve(`{"key":"sk_live_abc123"}`)
+	if rec.Code != http.StatusForbidden || rec.Body.String() != defaultDLPBlockBody {
+		t.Errorf("Unexpected block response %d: %s", rec.Code, rec.Body.String())
+	}
+	if acceptEncoding != "gzip" {
+		t.Errorf("Expected the upstream to be asked for gzip only, got %q", acceptEncoding)
+	}
+
+	// Masked responses are compressed again
+	rec = serve(`{"email":"a@b.co"}`)
+	decoded, err := decodeContentEncoding(rec.Header().Get("Content-Encoding"), rec.Body.Bytes(), 0)
+	if err != nil || string(decoded) != `{"email":"******"}` {
+		t.Errorf("Unexpected masked response %q (%v)", decoded, err)
+	}
+}
+
+func TestDLPScanner_Passthrough(t *testing.T) {
+	ds, err := NewDLPScanner(&DLPConfig{
+		Detectors:    []DLPDetectorConfig{{Name: "secret", Pattern: `sk_live_[A-Za-z0-9]+`, Action: "block"}},
+		MaxBodyBytes: 16,
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewDLPScanner() error = %v", err)
+	}
+
+	for name, contentType := range map[string]string{"binary": "application/octet-stream", "event stream": "text/event-stream"} {
+		rec := httptest.NewRecorder()
+		dw := ds.ResponseWriter(rec)
+		dw.Header().Set("Content-Type", contentType)
+		dw.Write([]byte("sk_live_abc"))
+		dw.Flush()
+		if !rec.Flushed || rec.Body.String() != "sk_live_abc" {
+			t.Errorf("%s: expected the response to stream, got flushed=%v %q", name, rec.Flushed, rec.Body.String())
+		}
+		if fired, err := ds.Finish(dw, httptest.NewRequest("GET", "/", nil), &TemplateContext{}); err != nil || fired != nil || rec.Body.String() != "sk_live_abc" {
+			t.Errorf("%s: expected Finish to leave the streamed response alone, got %v %v %q", name, fired, err, rec.Body.String())
+		}
+	}
+
+	// Text responses above the size cap are streamed once they pass it
+	rec := httptest.NewRecorder()
+	dw := ds.ResponseWriter(rec)
+	dw.Write([]byte("0123456789"))
+	if rec.Body.Len() != 0 {
+		t.Errorf("Expected small writes to be buffered")
+	}
+	dw.Write([]byte("sk_live_abc"))
+	ds.Finish(dw, httptest.NewRequest("GET", "/", nil), &TemplateContext{})
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789sk_live_abc" {
+		t.Errorf("Unexpected oversized response %d: %q", rec.Code, rec.Body.String())
+	}
+
+	if _, _, err := ds.ResponseWriter(rec).Hijack(); err == nil {
+		t.Errorf("Expected Hijack to fail on a writer without hijacking support")
+	}
+}
@@ -0,0 +1,209 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// dryRunReport lists the changes the plugin would have made to a request
+type dryRunReport struct {
+	Method         string            `json:"method"`
+	Path           string            `json:"path"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	RemovedHeaders []string          `json:"removedHeaders,omitempty"`
+	Query          *string           `json:"query,omitempty"`
+	RequestBody    *string           `json:"requestBody,omitempty"`
+	Rejected       bool              `json:"rejected,omitempty"`
+	Status         int               `json:"status,omitempty"`
+	ResponseBody   *string           `json:"responseBody,omitempty"`
+}
+
+// serveDryRun runs the modifications on a copy of req and forwards the
+// original request and upstream response untouched. The would-be changes are
+// logged and, with dry_run_header, summarized in a response header.
+func (m *modifier) serveDryRun(rw http.ResponseWriter, req *http.Request) {
+	limit, _ := m.bodyModifier.requestLimit()
+	body, ok := bufferRequestBody(req, limit)
+	if !ok {
+		m.logger.forRequest(nil).infof("dry_run", "", "Dry run skipped for %s %s: request body exceeds the buffer limit", req.Method, req.URL.Path)
+		m.next.ServeHTTP(rw, req)
+		return
+	}
+
+	shadow := req.Clone(req.Context())
+	if body != nil {
+		shadow.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	// The modified request reaches this handler, which records it and sends
+	// the original request to the upstream instead
+	var modified *http.Request
+	var modifiedBody []byte
+	var upstream *dryRunRecorder
+	dm := *m
+	dm.dryRunHeader, dm.dryRun = "", false
+	// Skip stages with side effects beyond the request itself
+	dm.responseCache, dm.idempotency, dm.mirror, dm.notifier, dm.batch, dm.retrier = nil, nil, nil, nil, nil, nil
+	dm.next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if upstream != nil {
+			http.Error(w, "dry run: upstream already called", http.StatusBadGateway)
+			return
+		}
+		modified = r
+		if r.Body != nil {
+			modifiedBody, _ = io.ReadAll(r.Body)
+		}
+		if body != nil {
+			req.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		upstream = &dryRunRecorder{header: make(http.Header)}
+		m.next.ServeHTTP(upstream, req)
+
+		for name, values := range upstream.header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(upstream.statusCode())
+		w.Write(upstream.body.Bytes())
+	})
+
+	output := &dryRunRecorder{header: make(http.Header)}
+	dm.ServeHTTP(output, shadow)
+
+	report := &dryRunReport{Method: req.Method, Path: req.URL.Path}
+	if upstream == nil {
+		// The plugin answered the request itself, forward it unmodified
+		report.Rejected = true
+		report.Status = output.statusCode()
+		responseBody := output.body.String()
+		report.ResponseBody = &responseBody
+		if body != nil {
+			req.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		upstream = &dryRunRecorder{header: make(http.Header)}
+		m.next.ServeHTTP(upstream, req)
+	} else {
+		report.diffRequest(req, body, modified, modifiedBody)
+		if output.statusCode() != upstream.statusCode() {
+			report.Status = output.statusCode()
+		}
+		if !bytes.Equal(output.body.Bytes(), upstream.body.Bytes()) {
+			responseBody := output.body.String()
+			report.ResponseBody = &responseBody
+		}
+	}
+
+	if summary := report.summary(); summary != "" {
+		if data, err := json.Marshal(report); err == nil {
+			m.logger.forRequest(nil).infof("dry_run", "", "Dry run: %s", data)
+		}
+		if m.dryRunHeader != "" {
+			upstream.header.Set(m.dryRunHeader, summary)
+		}
+	}
+
+	for name, values := range upstream.header {
+		rw.Header()[name] = values
+	}
+	rw.WriteHeader(upstream.statusCode())
+	rw.Write(upstream.body.Bytes())
+}
+
+// diffRequest records the header, query and body changes of modified
+func (r *dryRunReport) diffRequest(original *http.Request, originalBody []byte, modified *http.Request, modifiedBody []byte) {
+	for name, values := range modified.Header {
+		if name == "Content-Length" {
+			// Follows the request body change
+			continue
+		}
+		value := strings.Join(values, ", ")
+		if strings.Join(original.Header.Values(name), ", ") != value {
+			if r.Headers == nil {
+				r.Headers = make(map[string]string)
+			}
+			r.Headers[name] = value
+		}
+	}
+	for name := range original.Header {
+		if _, exists := modified.Header[name]; !exists {
+			r.RemovedHeaders = append(r.RemovedHeaders, name)
+		}
+	}
+	sort.Strings(r.RemovedHeaders)
+
+	if modified.URL.RawQuery != original.URL.RawQuery {
+		query := modified.URL.RawQuery
+		r.Query = &query
+	}
+	if !bytes.Equal(modifiedBody, originalBody) {
+		requestBody := string(modifiedBody)
+		r.RequestBody = &requestBody
+	}
+}
+
+// summary lists the changed parts, e.g. "headers=X-Tenant,X-User; query; response-body"
+func (r *dryRunReport) summary() string {
+	var parts []string
+	if r.Rejected {
+		parts = append(parts, "rejected="+strconv.Itoa(r.Status))
+	} else if r.Status != 0 {
+		parts = append(parts, "status="+strconv.Itoa(r.Status))
+	}
+	if len(r.Headers) > 0 {
+		names := make([]string, 0, len(r.Headers))
+		for name := range r.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		parts = append(parts, "headers="+strings.Join(names, ","))
+	}
+	if len(r.RemovedHeaders) > 0 {
+		parts = append(parts, "removed-headers="+strings.Join(r.RemovedHeaders, ","))
+	}
+	if r.Query != nil {
+		parts = append(parts, "query")
+	}
+	if r.RequestBody != nil {
+		parts = append(parts, "request-body")
+	}
+	if r.ResponseBody != nil && !r.Rejected {
+		parts = append(parts, "response-body")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// dryRunRecorder buffers a response
+type dryRunRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *dryRunRecorder) Header() http.Header {
+	return rr.header
+}
+
+func (rr *dryRunRecorder) WriteHeader(statusCode int) {
+	if rr.status == 0 && statusCode >= http.StatusOK {
+		rr.status = statusCode
+	}
+}
+
+func (rr *dryRunRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	return rr.body.Write(b)
+}
+
+// statusCode returns the recorded status, 200 when none was written
+func (rr *dryRunRecorder) statusCode() int {
+	if rr.status == 0 {
+		return http.StatusOK
+	}
+	return rr.status
+}
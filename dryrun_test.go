@@ -0,0 +1,59 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestModifier_DryRun(t *testing.T) {
+	config := CreateConfig()
+	config.DryRun = true
+	config.DryRunHeader = "X-Dry-Run"
+	config.ModifierHeader = HeaderConfig{"X-Tenant": "acme"}
+	config.ModifierRequest = `{"name": "[[ .request.api.body.name ]]", "modified": true}`
+	config.ModifierResponse = map[string]string{"200": `{"wrapped": [[ toJSON .response.body ]]}`}
+	config.Reject = []*RejectConfig{{Name: "blocked", When: `[[ eq .request.body.name "blocked" ]]`, Status: http.StatusForbidden}}
+
+	var calls int
+	var seen *http.Request
+	var seenBody string
+	handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls++
+		body, _ := io.ReadAll(req.Body)
+		seen, seenBody = req, string(body)
+		io.WriteString(rw, `{"id":1}`)
+	}), config, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		body    string
+		summary string
+	}{
+		{`{"name": "book"}`, "headers=X-Tenant; request-body; response-body"},
+		{`{"name": "blocked"}`, "rejected=403"},
+	}
+	for _, tt := range tests {
+		calls = 0
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", "/orders", strings.NewReader(tt.body)))
+
+		if calls != 1 {
+			t.Errorf("%s: expected one upstream call, got %d", tt.body, calls)
+		}
+		if seenBody != tt.body || seen.Header.Get("X-Tenant") != "" {
+			t.Errorf("%s: expected the original request upstream, got %s with X-Tenant %q", tt.body, seenBody, seen.Header.Get("X-Tenant"))
+		}
+		if rec.Code != http.StatusOK || rec.Body.String() != `{"id":1}` {
+			t.Errorf("%s: expected the original response, got %d %s", tt.body, rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("X-Dry-Run"); got != tt.summary {
+			t.Errorf("%s: expected summary %q, got %q", tt.body, tt.summary, got)
+		}
+	}
+}
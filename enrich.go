@@ -0,0 +1,155 @@
+package traefik_modifier_plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// EnrichConfig holds the enrichment subrequest configuration
+type EnrichConfig struct {
+	URL      string            `json:"url,omitempty"`
+	Method   string            `json:"method,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Timeout  string            `json:"timeout,omitempty"`
+	CacheTTL string            `json:"cache_ttl,omitempty"`
+
+	CacheMaxEntries           int    `json:"cache_max_entries,omitempty"`
+	CacheStaleWhileRevalidate string `json:"cache_stale_while_revalidate,omitempty"`
+}
+
+// Enricher fetches JSON from a templated URL and exposes it as .enrich
+type Enricher struct {
+	method      string
+	urlTemplate *template.Template
+	headers     map[string]*template.Template
+	client      *http.Client
+	cache       *ttlCache
+}
+
+// NewEnricher creates a new enrichment subrequest
+func NewEnricher(config *EnrichConfig, funcs template.FuncMap) (*Enricher, error) {
+	if config.URL == "" {
+		return nil, errors.New("enrich url is required")
+	}
+
+	urlTemplate, err := template.New("enrich[url]").Funcs(funcs).Delims("[[", "]]").Parse(config.URL)
+	if err != nil {
+		return nil, newTemplateError("enrich[url]", err)
+	}
+
+	e := &Enricher{
+		method:      http.MethodGet,
+		urlTemplate: urlTemplate,
+		headers:     make(map[string]*template.Template),
+		client:      &http.Client{Timeout: 5 * time.Second},
+	}
+
+	if config.Method != "" {
+		e.method = strings.ToUpper(config.Method)
+	}
+
+	for name, value := range config.Headers {
+		key := fmt.Sprintf("enrich[header:%s]", name)
+		tmpl, err := template.New(key).Funcs(funcs).Delims("[[", "]]").Parse(value)
+		if err != nil {
+			return nil, newTemplateError(key, err)
+		}
+		e.headers[name] = tmpl
+	}
+
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid enrich timeout: %w", err)
+		}
+		e.client.Timeout = timeout
+	}
+
+	if e.cache, err = newLookupCache("enrich", config.CacheTTL, config.CacheMaxEntries, config.CacheStaleWhileRevalidate); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Fetch renders the subrequest for req and returns its decoded JSON result
+func (e *Enricher) Fetch(req *http.Request, ctx *TemplateContext) (interface{}, error) {
+	templateData := buildTemplateData(ctx, map[string]interface{}{
+		"request": requestTemplateData(req),
+	})
+
+	buf := newTemplateOutput(ctx)
+	defer buf.release()
+	if err := e.urlTemplate.Execute(buf, templateData); err != nil {
+		return nil, newTemplateError(e.urlTemplate.Name(), err)
+	}
+	url := strings.TrimSpace(buf.String())
+
+	headers := make(map[string]string, len(e.headers))
+	for name, tmpl := range e.headers {
+		buf.Reset()
+		if err := tmpl.Execute(buf, templateData); err != nil {
+			return nil, newTemplateError(tmpl.Name(), err)
+		}
+		headers[name] = buf.String()
+	}
+
+	return e.cache.Fetch(jsonRequestCacheKey(e.method, url, headers), func() (interface{}, error) {
+		return fetchJSON(e.client, e.method, url, headers, "enrich")
+	})
+}
+
+// jsonRequestCacheKey identifies a rendered JSON subrequest
+func jsonRequestCacheKey(method, url string, headers map[string]string) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	key := method + " " + url
+	for _, name := range names {
+		key += "\n" + name + ": " + headers[name]
+	}
+	return key
+}
+
+// fetchJSON performs a subrequest and decodes its JSON response. Errors are
+// prefixed with label.
+func fetchJSON(client *http.Client, method, url string, headers map[string]string, label string) (interface{}, error) {
+	subrequest, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s request: %w", label, err)
+	}
+	subrequest.Header.Set("Accept", "application/json")
+	for name, value := range headers {
+		subrequest.Header.Set(name, value)
+	}
+
+	res, err := client.Do(subrequest)
+	if err != nil {
+		return nil, fmt.Errorf("%s request: %w", label, err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s response: %w", label, err)
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("%s %s %s returned %d", label, method, url, res.StatusCode)
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("%s response is not JSON: %w", label, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,59 @@
+package traefik_modifier_plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hukumonline-com/traefik-modifier-plugin/pkg"
+)
+
+func TestEnricher_Fetch(t *testing.T) {
+	calls := 0
+	accounts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls++
+		if req.Header.Get("Authorization") != "Bearer token" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.URL.Path != "/accounts/42" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.Write([]byte(`{"name": "Acme", "tier": "gold"}`))
+	}))
+	defer accounts.Close()
+
+	e, err := NewEnricher(&EnrichConfig{
+		URL:      accounts.URL + `/accounts/[[ index .request.headers "x-account-id" ]]`,
+		Headers:  map[string]string{"Authorization": `[[ index .request.headers "authorization" ]]`},
+		CacheTTL: "1m",
+	}, pkg.SimpleFuncMap())
+	if err != nil {
+		t.Fatalf("NewEnricher() error = %v", err)
+	}
+
+	fetch := func(account string) (interface{}, error) {
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		req.Header.Set("X-Account-Id", account)
+		req.Header.Set("Authorization", "Bearer token")
+		return e.Fetch(req, &TemplateContext{})
+	}
+
+	for i := 0; i < 2; i++ {
+		result, err := fetch("42")
+		if err != nil {
+			t.Fatalf("Fetch() error = %v", err)
+		}
+		if profile, _ := result.(map[string]interface{}); profile["tier"] != "gold" {
+			t.Errorf("Unexpected enrich result %v", result)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected enrich result to be cached, got %d calls", calls)
+	}
+
+	if _, err := fetch("7"); err == nil {
+		t.Errorf("Expected error for non-2xx enrich response")
+	}
+}
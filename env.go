@@ -0,0 +1,40 @@
+package traefik_modifier_plugin
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// EnvConfig holds the environment variables exposed to templates as .env
+type EnvConfig struct {
+	Allow []string `json:"allow,omitempty"`
+}
+
+// LoadEnv reads the allowlisted environment variables once at startup.
+// Names ending in * allow every variable with that prefix, e.g. UPSTREAM_*.
+// Allowlisted names that are not set render as an empty string.
+func LoadEnv(config *EnvConfig) (map[string]string, error) {
+	if len(config.Allow) == 0 {
+		return nil, errors.New("env requires an allow list of variable names")
+	}
+
+	values := make(map[string]string)
+	for _, name := range config.Allow {
+		name = strings.TrimSpace(name)
+		if prefix, isPrefix := strings.CutSuffix(name, "*"); isPrefix {
+			if prefix == "" {
+				return nil, errors.New("env allow list cannot expose every variable with *")
+			}
+			for _, entry := range os.Environ() {
+				key, value, _ := strings.Cut(entry, "=")
+				if strings.HasPrefix(key, prefix) {
+					values[key] = value
+				}
+			}
+			continue
+		}
+		values[name] = os.Getenv(name)
+	}
+	return values, nil
+}
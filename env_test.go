@@ -0,0 +1,51 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestModifier_Env(t *testing.T) {
+	t.Setenv("UPSTREAM_API_KEY", "sk-env")
+	t.Setenv("UPSTREAM_REGION", "id")
+	t.Setenv("DATABASE_PASSWORD", "hidden")
+
+	config := CreateConfig()
+	config.Env = &EnvConfig{Allow: []string{"UPSTREAM_*", "NOT_SET"}}
+	config.ModifierHeader = HeaderConfig{
+		"Authorization": "Bearer [[ .env.UPSTREAM_API_KEY ]]",
+		"X-Region":      "[[ .env.UPSTREAM_REGION ]]",
+		"X-Leak":        "[[ .env.DATABASE_PASSWORD ]]",
+		"X-Unset":       "[[ .env.NOT_SET ]]",
+	}
+
+	var upstreamHeaders http.Header
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		upstreamHeaders = req.Header.Clone()
+	})
+
+	handler, err := New(context.Background(), next, config, "env")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if upstreamHeaders.Get("Authorization") != "Bearer sk-env" || upstreamHeaders.Get("X-Region") != "id" {
+		t.Errorf("Expected the allowlisted variables, got %v", upstreamHeaders)
+	}
+	if strings.Contains(upstreamHeaders.Get("X-Leak"), "hidden") {
+		t.Errorf("Expected variables outside the allow list to be hidden, got %q", upstreamHeaders.Get("X-Leak"))
+	}
+	if upstreamHeaders.Get("X-Unset") != "" {
+		t.Errorf("Expected an unset allowlisted variable to be empty, got %q", upstreamHeaders.Get("X-Unset"))
+	}
+
+	for _, allow := range [][]string{nil, {"*"}} {
+		if _, err := LoadEnv(&EnvConfig{Allow: allow}); err == nil {
+			t.Errorf("LoadEnv(%v) expected an error", allow)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package traefik_modifier_plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"text/template"
+)
+
+// ErrorPageConfig holds the template that replaces an upstream error body.
+// ContentType defaults to application/json for JSON output and
+// text/html otherwise.
+type ErrorPageConfig struct {
+	Template    string `json:"template,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// ErrorPages replaces upstream error responses with templated documents.
+// Keys are status codes, classes (5xx) or ranges (500-599); the narrowest
+// matching key wins.
+type ErrorPages struct {
+	pages []*errorPage
+}
+
+// errorPage is a configured page with the statuses it covers
+type errorPage struct {
+	key         string
+	low, high   int
+	template    *template.Template
+	contentType string
+}
+
+// NewErrorPages parses the error page templates
+func NewErrorPages(config map[string]*ErrorPageConfig, funcs template.FuncMap) (*ErrorPages, error) {
+	ep := &ErrorPages{}
+	for key, pageConfig := range config {
+		low, high, ok := parseStatusKey(key)
+		if !ok {
+			return nil, fmt.Errorf("invalid error_pages key %q: expected a status code, class such as 5xx or range such as 500-599", key)
+		}
+		if pageConfig == nil || pageConfig.Template == "" {
+			return nil, fmt.Errorf("error_pages[%s]: template is required", key)
+		}
+		name := fmt.Sprintf("error_pages[%s]", key)
+		tmpl, err := template.New(name).Funcs(funcs).Delims("[[", "]]").Parse(pageConfig.Template)
+		if err != nil {
+			return nil, newTemplateError(name, err)
+		}
+		ep.pages = append(ep.pages, &errorPage{
+			key:         key,
+			low:         low,
+			high:        high,
+			template:    tmpl,
+			contentType: pageConfig.ContentType,
+		})
+	}
+	sort.Slice(ep.pages, func(i, j int) bool {
+		wi := ep.pages[i].high - ep.pages[i].low
+		wj := ep.pages[j].high - ep.pages[j].low
+		if wi != wj {
+			return wi < wj
+		}
+		return ep.pages[i].key < ep.pages[j].key
+	})
+	return ep, nil
+}
+
+// page returns the error page for status, or nil
+func (ep *ErrorPages) page(status int) *errorPage {
+	for _, p := range ep.pages {
+		if status >= p.low && status <= p.high {
+			return p
+		}
+	}
+	return nil
+}
+
+// ResponseWriter wraps rw so a response with a configured status is
+// replaced by its error page. rendered is called with the page key.
+func (ep *ErrorPages) ResponseWriter(rw http.ResponseWriter, req *http.Request, ctx *TemplateContext, errs *pluginErrors, rendered func(key string)) http.ResponseWriter {
+	return &errorPageResponseWriter{
+		ResponseWriter: rw,
+		pages:          ep,
+		req:            req,
+		ctx:            ctx,
+		errs:           errs,
+		rendered:       rendered,
+	}
+}
+
+// errorPageResponseWriter writes the error page instead of the upstream
+// body and discards the upstream writes
+type errorPageResponseWriter struct {
+	http.ResponseWriter
+	pages       *ErrorPages
+	req         *http.Request
+	ctx         *TemplateContext
+	errs        *pluginErrors
+	rendered    func(key string)
+	wroteHeader bool
+	replaced    bool
+}
+
+func (ew *errorPageResponseWriter) WriteHeader(statusCode int) {
+	if ew.wroteHeader {
+		return
+	}
+	if statusCode < http.StatusOK {
+		// Informational responses precede the final status
+		ew.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	ew.wroteHeader = true
+
+	page := ew.pages.page(statusCode)
+	if page == nil {
+		ew.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	ew.replaced = true
+	ew.render(page, statusCode)
+}
+
+func (ew *errorPageResponseWriter) Write(b []byte) (int, error) {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if ew.replaced {
+		return len(b), nil
+	}
+	return ew.ResponseWriter.Write(b)
+}
+
+// Flush forwards flushes of streamed responses, writing the headers first.
+// Error pages are complete once rendered, so flushing them is harmless.
+func (ew *errorPageResponseWriter) Flush() {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := ew.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack forwards connection upgrades
+func (ew *errorPageResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := ew.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// render writes page for the upstream status, falling back to the
+// upstream status with a plain error when the template fails
+func (ew *errorPageResponseWriter) render(page *errorPage, status int) {
+	header := ew.Header()
+	templateData := buildTemplateData(ew.ctx, map[string]interface{}{
+		"request": requestTemplateData(ew.req),
+		"response": map[string]interface{}{
+			"status":     status,
+			"statusText": http.StatusText(status),
+			"headers":    convertHeaders(header),
+		},
+	})
+
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+
+	buf := newTemplateOutput(ew.ctx)
+	defer buf.release()
+	if err := page.template.Execute(buf, templateData); err != nil {
+		err = newTemplateError(page.template.Name(), err)
+		requestLog(ew.ctx).errorf("error_pages", outcomeRejected, "Error page error: %v", err)
+		ew.errs.write(ew.ResponseWriter, status, "Error page error", err)
+		return
+	}
+
+	contentType := page.contentType
+	if contentType == "" {
+		if json.Valid(buf.Bytes()) {
+			contentType = "application/json"
+		} else {
+			contentType = "text/html; charset=utf-8"
+		}
+	}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Length", strconv.Itoa(len(buf.Bytes())))
+	ew.ResponseWriter.WriteHeader(status)
+	ew.ResponseWriter.Write(buf.Bytes())
+
+	if ew.rendered != nil {
+		ew.rendered(page.key)
+	}
+}
@@ -0,0 +1,130 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestModifier_ErrorPages(t *testing.T) {
+	config := CreateConfig()
+	config.RequestID = &RequestIDConfig{Response: true}
+	config.StatusMap = map[string]int{"500": 502}
+	config.ErrorPages = map[string]*ErrorPageConfig{
+		"5xx": {Template: `{"error": "[[ .response.statusText ]]", "status": [[ .response.status ]], "requestId": "[[ .context.requestID ]]"}`},
+		"503": {Template: `<h1>Maintenance</h1>`},
+	}
+	config.ModifierResponse = map[string]string{
+		"2xx": `{"data": [[ toJSON .response.body ]]}`,
+	}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		status, _ := strconv.Atoi(req.URL.Query().Get("status"))
+		rw.Header().Set("Content-Type", "text/plain")
+		rw.WriteHeader(status)
+		io.WriteString(rw, `{"stack": "internal details"}`)
+	}), config, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		upstream    int
+		status      int
+		contentType string
+		body        string
+	}{
+		{500, 502, "application/json", `{"error": "Internal Server Error", "status": 500, "requestId": "`},
+		{503, 503, "text/html; charset=utf-8", `<h1>Maintenance</h1>`},
+		{404, 404, "text/plain", `{"stack": "internal details"}`},
+		{200, 200, "application/json", `{"data": {"stack":"internal details"}}`},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/items?status="+strconv.Itoa(tt.upstream), nil))
+		if rec.Code != tt.status {
+			t.Errorf("Expected status %d for upstream %d, got %d", tt.status, tt.upstream, rec.Code)
+		}
+		if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("Expected Content-Type %q for upstream %d, got %q", tt.contentType, tt.upstream, got)
+		}
+		if got := rec.Body.String(); !strings.HasPrefix(got, tt.body) {
+			t.Errorf("Expected body %s for upstream %d, got %s", tt.body, tt.upstream, got)
+		}
+	}
+
+	// The request ID is rendered into the page
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/items?status=500", nil))
+	if id := rec.Header().Get("X-Request-Id"); id == "" || !strings.Contains(rec.Body.String(), id) {
+		t.Errorf("Expected request ID %q in body, got %s", id, rec.Body.String())
+	}
+}
+
+func TestNewErrorPages_Invalid(t *testing.T) {
+	for _, config := range []map[string]*ErrorPageConfig{
+		{"5yy": {Template: "error"}},
+		{"500": {}},
+		{"500": {Template: "[[ .response.status "}},
+	} {
+		if _, err := NewErrorPages(config, nil); err == nil {
+			t.Errorf("Expected error for %v", config)
+		}
+	}
+}
+
+func TestErrorPages_Streaming(t *testing.T) {
+	ep, err := NewErrorPages(map[string]*ErrorPageConfig{"5xx": {Template: `{"error": "unavailable"}`}}, nil)
+	if err != nil {
+		t.Fatalf("NewErrorPages() error = %v", err)
+	}
+	req := httptest.NewRequest("GET", "/events", nil)
+
+	// Successful event streams are flushed through as they are written
+	rec := httptest.NewRecorder()
+	ew := ep.ResponseWriter(rec, req, &TemplateContext{}, nil, nil)
+	ew.Header().Set("Content-Type", "text/event-stream")
+	io.WriteString(ew, "data: 1\n\n")
+	ew.(http.Flusher).Flush()
+	if !rec.Flushed || rec.Code != http.StatusOK || rec.Body.String() != "data: 1\n\n" {
+		t.Errorf("Expected a flushed event stream, got flushed=%v %d %q", rec.Flushed, rec.Code, rec.Body.String())
+	}
+
+	// Error streams still get the error page, and later events are dropped
+	rec = httptest.NewRecorder()
+	ew = ep.ResponseWriter(rec, req, &TemplateContext{}, nil, nil)
+	ew.WriteHeader(http.StatusServiceUnavailable)
+	ew.(http.Flusher).Flush()
+	io.WriteString(ew, "data: 1\n\n")
+	if rec.Code != http.StatusServiceUnavailable || rec.Body.String() != `{"error": "unavailable"}` {
+		t.Errorf("Unexpected error page %d: %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestErrorPages_Hijack(t *testing.T) {
+	ep, err := NewErrorPages(map[string]*ErrorPageConfig{"5xx": {Template: "error"}}, nil)
+	if err != nil {
+		t.Fatalf("NewErrorPages() error = %v", err)
+	}
+	req := httptest.NewRequest("GET", "/socket", nil)
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	ew := ep.ResponseWriter(&hijackRecorder{ResponseRecorder: httptest.NewRecorder(), conn: server}, req, &TemplateContext{}, nil, nil)
+	conn, _, err := ew.(http.Hijacker).Hijack()
+	if err != nil || conn != server {
+		t.Fatalf("Hijack() = %v, %v", conn, err)
+	}
+
+	ew = ep.ResponseWriter(httptest.NewRecorder(), req, &TemplateContext{}, nil, nil)
+	if _, _, err := ew.(http.Hijacker).Hijack(); err == nil {
+		t.Errorf("Expected an error when the underlying writer cannot be hijacked")
+	}
+}
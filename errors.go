@@ -0,0 +1,232 @@
+package traefik_modifier_plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// templateErrorPattern matches text/template error messages such as
+// `template: modifier_response[401]:2:30: executing "modifier_response[401]" at <index .a 3>: error calling index: ...`
+var (
+	templateErrorPattern = regexp.MustCompile(`^template: (.+?):(\d+)(?::(\d+))?: (.*)$`)
+	executingPattern     = regexp.MustCompile(`^executing "[^"]*" at <(.*?)>: (.*)$`)
+)
+
+// TemplateError describes a template failure with its configured key and location
+type TemplateError struct {
+	Key        string `json:"template"`
+	Line       int    `json:"line,omitempty"`
+	Column     int    `json:"column,omitempty"`
+	Expression string `json:"expression,omitempty"`
+	Message    string `json:"message"`
+	Err        error  `json:"-"`
+}
+
+// newTemplateError wraps a parse or execution error of the template configured under key
+func newTemplateError(key string, err error) *TemplateError {
+	te := &TemplateError{
+		Key:     key,
+		Message: err.Error(),
+		Err:     err,
+	}
+
+	matches := templateErrorPattern.FindStringSubmatch(err.Error())
+	if matches == nil {
+		return te
+	}
+
+	te.Line, _ = strconv.Atoi(matches[2])
+	if matches[3] != "" {
+		te.Column, _ = strconv.Atoi(matches[3])
+	}
+	te.Message = matches[4]
+
+	if exec := executingPattern.FindStringSubmatch(te.Message); exec != nil {
+		te.Expression = exec[1]
+		te.Message = exec[2]
+	}
+
+	// Nested templates report their own name, keep it in the message
+	if matches[1] != key {
+		te.Message = fmt.Sprintf("in %s: %s", matches[1], te.Message)
+	}
+
+	return te
+}
+
+func (e *TemplateError) Error() string {
+	var b strings.Builder
+	b.WriteString("template ")
+	b.WriteString(e.Key)
+	if e.Line > 0 {
+		fmt.Fprintf(&b, " line %d", e.Line)
+	}
+	if e.Column > 0 {
+		fmt.Fprintf(&b, " column %d", e.Column)
+	}
+	if e.Expression != "" {
+		fmt.Fprintf(&b, " at <%s>", e.Expression)
+	}
+	b.WriteString(": ")
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// writeError writes a plugin error response. When debug is enabled and the error
+// originates from a template, a JSON body with the template location is returned.
+func writeError(rw http.ResponseWriter, statusCode int, prefix string, err error, debug bool) {
+	var te *TemplateError
+	if debug && errors.As(err, &te) {
+		body, marshalErr := json.Marshal(map[string]interface{}{
+			"error":  prefix,
+			"detail": te,
+		})
+		if marshalErr == nil {
+			rw.Header().Set("Content-Type", "application/json")
+			rw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			rw.WriteHeader(statusCode)
+			rw.Write(body)
+			return
+		}
+	}
+
+	if err == nil {
+		http.Error(rw, prefix, statusCode)
+		return
+	}
+	http.Error(rw, fmt.Sprintf("%s: %v", prefix, err), statusCode)
+}
+
+// ErrorResponseConfig switches the errors written by the plugin itself to
+// JSON. Template renders the body from .error.code, .error.message,
+// .error.requestID, .error.detail and .context; without it the body is
+// {"code", "message", "requestID"}.
+type ErrorResponseConfig struct {
+	Template string `json:"template,omitempty"`
+}
+
+// ErrorResponder writes the errors generated by the plugin, as plain text
+// or, when configured, as JSON
+type ErrorResponder struct {
+	debug    bool
+	json     bool
+	template *template.Template
+}
+
+// NewErrorResponder creates the plugin error writer. A nil config keeps
+// plain text errors.
+func NewErrorResponder(config *ErrorResponseConfig, debug bool, funcs template.FuncMap) (*ErrorResponder, error) {
+	er := &ErrorResponder{debug: debug}
+	if config == nil {
+		return er, nil
+	}
+	er.json = true
+	if config.Template != "" {
+		tmpl, err := template.New("error_response").Funcs(funcs).Delims("[[", "]]").Parse(config.Template)
+		if err != nil {
+			return nil, newTemplateError("error_response", err)
+		}
+		er.template = tmpl
+	}
+	return er, nil
+}
+
+// forRequest returns the error writer of a request, reading its request ID
+// from ctx
+func (er *ErrorResponder) forRequest(ctx *TemplateContext) *pluginErrors {
+	return &pluginErrors{ErrorResponder: er, ctx: ctx}
+}
+
+// pluginErrors writes the plugin errors of one request. A nil value writes
+// plain text errors without debug details.
+type pluginErrors struct {
+	*ErrorResponder
+	ctx *TemplateContext
+}
+
+// write writes a plugin error response for err, which may be nil
+func (pe *pluginErrors) write(rw http.ResponseWriter, statusCode int, prefix string, err error) {
+	if pe == nil || pe.ErrorResponder == nil {
+		writeError(rw, statusCode, prefix, err, false)
+		return
+	}
+	if !pe.json {
+		writeError(rw, statusCode, prefix, err, pe.debug)
+		return
+	}
+
+	message := prefix
+	if err != nil {
+		message = fmt.Sprintf("%s: %v", prefix, err)
+	}
+	var requestID string
+	if pe.ctx != nil {
+		requestID, _ = (*pe.ctx)["requestID"].(string)
+	}
+	fields := map[string]interface{}{
+		"code":      statusCode,
+		"message":   message,
+		"requestID": requestID,
+	}
+	var te *TemplateError
+	if pe.debug && errors.As(err, &te) {
+		fields["detail"] = te
+	}
+
+	header := rw.Header()
+	header.Del("Content-Encoding")
+	header.Set("Content-Type", "application/json")
+
+	var body []byte
+	if pe.template != nil {
+		buf := newTemplateOutput(pe.ctx)
+		defer buf.release()
+		data := buildTemplateData(pe.ctx, map[string]interface{}{"error": fields})
+		if execErr := pe.template.Execute(buf, data); execErr == nil {
+			body = buf.Bytes()
+		} else {
+			requestLog(pe.ctx).warnf("error_response", "", "Error response template error: %v", newTemplateError("error_response", execErr))
+		}
+	}
+	if body == nil {
+		body, _ = json.Marshal(fields)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	rw.WriteHeader(statusCode)
+	rw.Write(body)
+}
+
+// writeTemplateResponse renders tmpl, configured under key, as the body of a
+// plugin-generated response. JSON output is served as application/json.
+func writeTemplateResponse(rw http.ResponseWriter, statusCode int, key string, tmpl *template.Template, data map[string]interface{}, errs *pluginErrors) {
+	var ctx *TemplateContext
+	if errs != nil {
+		ctx = errs.ctx
+	}
+	buf := newTemplateOutput(ctx)
+	defer buf.release()
+	if err := tmpl.Execute(buf, data); err != nil {
+		errs.write(rw, http.StatusInternalServerError, "Response template error", newTemplateError(key, err))
+		return
+	}
+
+	header := rw.Header()
+	if json.Valid(buf.Bytes()) {
+		header.Set("Content-Type", "application/json")
+	} else {
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	header.Set("Content-Length", strconv.Itoa(len(buf.Bytes())))
+	rw.WriteHeader(statusCode)
+	rw.Write(buf.Bytes())
+}
@@ -0,0 +1,120 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestNewTemplateError(t *testing.T) {
+	tmpl := template.Must(template.New("modifier_response[401]").Delims("[[", "]]").Parse("{\n  \"id\": [[ index .list 3 ]]\n}"))
+	execErr := tmpl.Execute(&discard{}, map[string]interface{}{"list": []int{1}})
+	if execErr == nil {
+		t.Fatalf("Expected execution error")
+	}
+
+	te := newTemplateError("modifier_response[401]", execErr)
+	if te.Line != 2 || te.Column != 11 {
+		t.Errorf("Expected line 2 column 11, got line %d column %d", te.Line, te.Column)
+	}
+	if te.Expression != "index .list 3" {
+		t.Errorf("Expected expression %q, got %q", "index .list 3", te.Expression)
+	}
+	if !errors.Is(te, execErr) {
+		t.Errorf("Expected TemplateError to unwrap to the execution error")
+	}
+
+	expected := "template modifier_response[401] line 2 column 11 at <index .list 3>: error calling index: index out of range: 3"
+	if te.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, te.Error())
+	}
+}
+
+func TestNewTemplateError_Parse(t *testing.T) {
+	_, parseErr := template.New("modifier_request").Delims("[[", "]]").Parse("a\n\n[[ if ]]")
+	te := newTemplateError("modifier_request", parseErr)
+	if te.Line != 3 || te.Column != 0 || te.Expression != "" {
+		t.Errorf("Unexpected parse error location: %+v", te)
+	}
+	if te.Message != "missing value for if" {
+		t.Errorf("Unexpected message %q", te.Message)
+	}
+}
+
+func TestWriteError_Debug(t *testing.T) {
+	te := &TemplateError{Key: "modifier_request", Line: 1, Message: "boom"}
+
+	rec := httptest.NewRecorder()
+	writeError(rec, 400, "Request masking error", te, true)
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected JSON body, got %s", rec.Body.String())
+	}
+	detail := body["detail"].(map[string]interface{})
+	if detail["template"] != "modifier_request" || detail["message"] != "boom" {
+		t.Errorf("Unexpected debug detail: %v", detail)
+	}
+
+	rec = httptest.NewRecorder()
+	writeError(rec, 400, "Request masking error", te, false)
+	if rec.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Errorf("Expected plain text error without debug, got %s", rec.Header().Get("Content-Type"))
+	}
+}
+
+// discard is an io.Writer that drops everything
+type discard struct{}
+
+func (discard) Write(p []byte) (int, error) { return len(p), nil }
+
+func TestModifier_ErrorResponse(t *testing.T) {
+	newHandler := func(errorResponse *ErrorResponseConfig) http.Handler {
+		config := CreateConfig()
+		config.RequestID = &RequestIDConfig{Response: true}
+		config.ModifierRequest = `{"name": "[[ .request.api.body.name ]]"}`
+		config.ErrorResponse = errorResponse
+		handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}), config, "test")
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		return handler
+	}
+
+	// Default JSON shape
+	rec := httptest.NewRecorder()
+	newHandler(&ErrorResponseConfig{}).ServeHTTP(rec, httptest.NewRequest("POST", "/", strings.NewReader("not json")))
+	if rec.Code != http.StatusBadRequest || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Expected a JSON 400, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected JSON body, got %s", rec.Body.String())
+	}
+	if body["code"] != float64(400) || body["requestID"] != rec.Header().Get("X-Request-Id") ||
+		!strings.HasPrefix(body["message"].(string), "Request masking error: ") {
+		t.Errorf("Unexpected error body: %v", body)
+	}
+
+	// Custom template
+	rec = httptest.NewRecorder()
+	newHandler(&ErrorResponseConfig{
+		Template: `{"error": {"status": [[ .error.code ]], "trace": "[[ .context.requestID ]]"}}`,
+	}).ServeHTTP(rec, httptest.NewRequest("POST", "/", strings.NewReader("not json")))
+	expected := `{"error": {"status": 400, "trace": "` + rec.Header().Get("X-Request-Id") + `"}}`
+	if rec.Body.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, rec.Body.String())
+	}
+
+	// Plain text without error_response
+	rec = httptest.NewRecorder()
+	newHandler(nil).ServeHTTP(rec, httptest.NewRequest("POST", "/", strings.NewReader("not json")))
+	if rec.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Errorf("Expected plain text error, got %s", rec.Header().Get("Content-Type"))
+	}
+}
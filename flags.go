@@ -0,0 +1,165 @@
+package traefik_modifier_plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// FeatureFlagsConfig holds the feature flag document source
+type FeatureFlagsConfig struct {
+	URL             string `json:"url,omitempty"`
+	File            string `json:"file,omitempty"`
+	RefreshInterval string `json:"refresh_interval,omitempty"`
+	Timeout         string `json:"timeout,omitempty"`
+}
+
+// FeatureFlags polls a JSON flag document from a URL or file and exposes it as .flags
+type FeatureFlags struct {
+	url             string
+	file            string
+	refreshInterval time.Duration
+	client          *http.Client
+	now             func() time.Time
+
+	// etag and modTime are only used by reload, which runs at most once at
+	// a time
+	etag    string
+	modTime time.Time
+
+	mu         sync.Mutex
+	flags      map[string]interface{}
+	lastCheck  time.Time
+	refreshing bool
+	refreshes  sync.WaitGroup
+}
+
+// NewFeatureFlags creates a new flag source and performs the initial load.
+// A failed initial load is logged and leaves the flags empty.
+func NewFeatureFlags(config *FeatureFlagsConfig) (*FeatureFlags, error) {
+	if (config.URL == "") == (config.File == "") {
+		return nil, errors.New("feature flags require exactly one of url or file")
+	}
+
+	ff := &FeatureFlags{
+		url:             config.URL,
+		file:            config.File,
+		refreshInterval: 30 * time.Second,
+		client:          &http.Client{Timeout: 5 * time.Second},
+		now:             time.Now,
+		flags:           make(map[string]interface{}),
+	}
+
+	if config.RefreshInterval != "" {
+		interval, err := time.ParseDuration(config.RefreshInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid feature flags refresh_interval: %w", err)
+		}
+		ff.refreshInterval = interval
+	}
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid feature flags timeout: %w", err)
+		}
+		ff.client.Timeout = timeout
+	}
+
+	if err := ff.reload(); err != nil {
+		log.Printf("Failed to load feature flags: %v", err)
+	}
+	ff.lastCheck = ff.now()
+
+	return ff, nil
+}
+
+// Values returns the current flags. Once the refresh interval has elapsed
+// the document is reloaded in the background, and the last values are
+// served until it completes. The last good document is kept when a reload
+// fails.
+func (ff *FeatureFlags) Values() map[string]interface{} {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+
+	if now := ff.now(); now.Sub(ff.lastCheck) >= ff.refreshInterval && !ff.refreshing {
+		ff.lastCheck = now
+		ff.refreshing = true
+		ff.refreshes.Add(1)
+		go ff.refresh()
+	}
+
+	return ff.flags
+}
+
+// refresh reloads the document outside the lock
+func (ff *FeatureFlags) refresh() {
+	defer ff.refreshes.Done()
+	if err := ff.reload(); err != nil {
+		log.Printf("Failed to reload feature flags: %v", err)
+	}
+
+	ff.mu.Lock()
+	ff.refreshing = false
+	ff.mu.Unlock()
+}
+
+// reload fetches the flag document, skipping unchanged documents. The flags
+// map is replaced rather than mutated so snapshots handed out stay consistent.
+func (ff *FeatureFlags) reload() error {
+	var content []byte
+	if ff.file != "" {
+		info, err := os.Stat(ff.file)
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Equal(ff.modTime) {
+			return nil
+		}
+		if content, err = os.ReadFile(ff.file); err != nil {
+			return err
+		}
+		ff.modTime = info.ModTime()
+	} else {
+		req, err := http.NewRequest(http.MethodGet, ff.url, nil)
+		if err != nil {
+			return err
+		}
+		if ff.etag != "" {
+			req.Header.Set("If-None-Match", ff.etag)
+		}
+
+		res, err := ff.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode == http.StatusNotModified {
+			return nil
+		}
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("GET %s returned %d", ff.url, res.StatusCode)
+		}
+		if content, err = io.ReadAll(res.Body); err != nil {
+			return err
+		}
+		ff.etag = res.Header.Get("ETag")
+	}
+
+	var flags map[string]interface{}
+	if err := json.Unmarshal(content, &flags); err != nil {
+		return fmt.Errorf("invalid feature flags document: %w", err)
+	}
+
+	ff.mu.Lock()
+	ff.flags = flags
+	ff.mu.Unlock()
+	log.Printf("Loaded %d feature flags", len(flags))
+	return nil
+}
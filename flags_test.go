@@ -0,0 +1,67 @@
+package traefik_modifier_plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFeatureFlags_Refresh(t *testing.T) {
+	document := `{"mask_email": true}`
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls++
+		etag := `"` + document + `"`
+		if req.Header.Get("If-None-Match") == etag {
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if document == "broken" {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("ETag", etag)
+		rw.Write([]byte(document))
+	}))
+	defer server.Close()
+
+	ff, err := NewFeatureFlags(&FeatureFlagsConfig{URL: server.URL, RefreshInterval: "10s"})
+	if err != nil {
+		t.Fatalf("NewFeatureFlags() error = %v", err)
+	}
+	now := time.Now()
+	ff.now = func() time.Time { return now }
+
+	if ff.Values()["mask_email"] != true {
+		t.Fatalf("Unexpected flags: %v", ff.Values())
+	}
+
+	// Unchanged documents are not re-parsed
+	now = now.Add(11 * time.Second)
+	ff.Values()
+	ff.refreshes.Wait()
+	if ff.Values()["mask_email"] != true || calls != 2 {
+		t.Errorf("Expected not-modified refresh, got %v after %d calls", ff.Values(), calls)
+	}
+
+	// The last values are served while the document reloads
+	document = `{"mask_email": false}`
+	now = now.Add(11 * time.Second)
+	if ff.Values()["mask_email"] != true {
+		t.Errorf("Expected the last flags during the reload, got %v", ff.Values())
+	}
+	ff.refreshes.Wait()
+	if ff.Values()["mask_email"] != false {
+		t.Errorf("Expected refreshed flags, got %v", ff.Values())
+	}
+
+	// Failed reloads keep the last good document
+	document = "broken"
+	now = now.Add(11 * time.Second)
+	ff.Values()
+	ff.refreshes.Wait()
+	if ff.Values()["mask_email"] != false {
+		t.Errorf("Expected last good flags, got %v", ff.Values())
+	}
+}
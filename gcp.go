@@ -0,0 +1,263 @@
+package traefik_modifier_plugin
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultGCPMetadataURL = "http://metadata.google.internal"
+	jwtBearerGrantType    = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+)
+
+// GCPIdentityConfig holds the Google ID token configuration
+type GCPIdentityConfig struct {
+	Audience           string `json:"audience,omitempty"`
+	ServiceAccountFile string `json:"service_account_file,omitempty"`
+	MetadataURL        string `json:"metadata_url,omitempty"`
+	Header             string `json:"header,omitempty"`
+	Timeout            string `json:"timeout,omitempty"`
+}
+
+// GCPIdentityProvider injects Google-signed ID tokens for Cloud Run and IAP
+// upstreams, using the metadata server or a service account key
+type GCPIdentityProvider struct {
+	audience    string
+	metadataURL string
+	header      string
+	account     *gcpServiceAccount
+	client      *http.Client
+	token       *cachedToken
+}
+
+// gcpServiceAccount is the relevant part of a service account key file
+type gcpServiceAccount struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+
+	key *rsa.PrivateKey
+}
+
+// NewGCPIdentityProvider creates a new ID token provider
+func NewGCPIdentityProvider(config *GCPIdentityConfig) (*GCPIdentityProvider, error) {
+	if config.Audience == "" {
+		return nil, errors.New("gcp identity audience is required")
+	}
+
+	p := &GCPIdentityProvider{
+		audience:    config.Audience,
+		metadataURL: strings.TrimRight(config.MetadataURL, "/"),
+		header:      config.Header,
+		client:      &http.Client{Timeout: 5 * time.Second},
+	}
+	if p.metadataURL == "" {
+		p.metadataURL = defaultGCPMetadataURL
+	}
+	if p.header == "" {
+		p.header = "Authorization"
+	}
+
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gcp identity timeout: %w", err)
+		}
+		p.client.Timeout = timeout
+	}
+
+	if config.ServiceAccountFile != "" {
+		account, err := loadGCPServiceAccount(config.ServiceAccountFile)
+		if err != nil {
+			return nil, err
+		}
+		p.account = account
+	}
+
+	p.token = newCachedToken(p.fetch)
+	return p, nil
+}
+
+// ModifyRequest sets the ID token header on the upstream request
+func (p *GCPIdentityProvider) ModifyRequest(req *http.Request) error {
+	token, err := p.token.Token()
+	if err != nil {
+		return err
+	}
+	req.Header.Set(p.header, "Bearer "+token)
+	return nil
+}
+
+// fetch obtains a new ID token and its expiry
+func (p *GCPIdentityProvider) fetch() (string, time.Time, error) {
+	var token string
+	var err error
+	if p.account != nil {
+		token, err = p.fetchWithServiceAccount()
+	} else {
+		token, err = p.fetchFromMetadata()
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	claims, err := decodeJWTClaims(token)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("gcp identity: %w", err)
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return "", time.Time{}, errors.New("gcp identity: id token has no exp claim")
+	}
+	return token, time.Unix(int64(exp), 0), nil
+}
+
+// fetchFromMetadata requests an ID token from the GCE/Cloud Run metadata server
+func (p *GCPIdentityProvider) fetchFromMetadata() (string, error) {
+	endpoint := p.metadataURL + "/computeMetadata/v1/instance/service-accounts/default/identity?audience=" +
+		url.QueryEscape(p.audience) + "&format=full"
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("gcp identity: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", fmt.Errorf("gcp identity: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("gcp identity: metadata server returned %d", res.StatusCode)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// fetchWithServiceAccount exchanges a self-signed assertion for an ID token
+func (p *GCPIdentityProvider) fetchWithServiceAccount() (string, error) {
+	assertion, err := p.account.assertion(p.audience, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {jwtBearerGrantType},
+		"assertion":  {assertion},
+	}
+	res, err := p.client.PostForm(p.account.TokenURI, form)
+	if err != nil {
+		return "", fmt.Errorf("gcp identity: %w", err)
+	}
+	defer res.Body.Close()
+
+	var resp struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return "", fmt.Errorf("gcp identity: invalid response (status %d): %w", res.StatusCode, err)
+	}
+	if res.StatusCode != http.StatusOK || resp.IDToken == "" {
+		if resp.Error != "" {
+			return "", fmt.Errorf("gcp identity: %s: %s", resp.Error, resp.ErrorDescription)
+		}
+		return "", fmt.Errorf("gcp identity: token endpoint returned %d", res.StatusCode)
+	}
+	return resp.IDToken, nil
+}
+
+// loadGCPServiceAccount reads a service account key file
+func loadGCPServiceAccount(path string) (*gcpServiceAccount, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gcp service account file: %w", err)
+	}
+
+	var account gcpServiceAccount
+	if err := json.Unmarshal(content, &account); err != nil {
+		return nil, fmt.Errorf("invalid gcp service account file: %w", err)
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, errors.New("gcp service account file requires client_email and private_key")
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return nil, errors.New("gcp service account private_key is not PEM encoded")
+	}
+	key, err := parseRSAPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gcp service account private_key: %w", err)
+	}
+	account.key = key
+
+	return &account, nil
+}
+
+// parseRSAPrivateKey parses a PKCS#8 or PKCS#1 RSA private key
+func parseRSAPrivateKey(der []byte) (*rsa.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not RSA")
+	}
+	return key, nil
+}
+
+// assertion builds the RS256 signed JWT requesting an ID token for audience
+func (a *gcpServiceAccount) assertion(audience string, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": a.PrivateKeyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":             a.ClientEmail,
+		"sub":             a.ClientEmail,
+		"aud":             a.TokenURI,
+		"target_audience": audience,
+		"iat":             now.Unix(),
+		"exp":             now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("gcp identity: failed to sign assertion: %w", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,102 @@
+package traefik_modifier_plugin
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGCPIdentityProvider_ServiceAccount(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	fetches := 0
+	var tokenURL string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		fetches++
+		req.ParseForm()
+		assertion := req.Form.Get("assertion")
+		parts := strings.Split(assertion, ".")
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		claims, _ := decodeJWTClaims(assertion)
+		if req.Form.Get("grant_type") != jwtBearerGrantType ||
+			verifyJWTSignature("RS256", &key.PublicKey, []byte(parts[0]+"."+parts[1]), signature) != nil ||
+			claims["target_audience"] != "https://orders.run.app" || claims["aud"] != tokenURL {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(`{"error": "invalid_grant", "error_description": "bad assertion"}`))
+			return
+		}
+		idToken := signTestJWT(t, key, "", map[string]interface{}{"exp": time.Now().Add(time.Hour).Unix()})
+		json.NewEncoder(rw).Encode(map[string]string{"id_token": idToken})
+	}))
+	defer server.Close()
+	tokenURL = server.URL + "/token"
+
+	account, _ := json.Marshal(map[string]string{
+		"client_email": "gateway@project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    tokenURL,
+	})
+	path := filepath.Join(t.TempDir(), "sa.json")
+	os.WriteFile(path, account, 0o600)
+
+	p, err := NewGCPIdentityProvider(&GCPIdentityConfig{Audience: "https://orders.run.app", ServiceAccountFile: path})
+	if err != nil {
+		t.Fatalf("NewGCPIdentityProvider() error = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		if err := p.ModifyRequest(req); err != nil {
+			t.Fatalf("ModifyRequest() error = %v", err)
+		}
+		if !strings.HasPrefix(req.Header.Get("Authorization"), "Bearer ey") {
+			t.Errorf("Unexpected Authorization %q", req.Header.Get("Authorization"))
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("Expected ID token to be cached, got %d fetches", fetches)
+	}
+
+	// Tokens are refreshed before they expire
+	p.token.now = func() time.Time { return time.Now().Add(56 * time.Minute) }
+	p.ModifyRequest(httptest.NewRequest("GET", "http://example.com/", nil))
+	if fetches != 2 {
+		t.Errorf("Expected ID token refresh before expiry, got %d fetches", fetches)
+	}
+}
+
+func TestGCPIdentityProvider_Metadata(t *testing.T) {
+	idToken := "header." + base64.RawURLEncoding.EncodeToString([]byte(`{"exp": 4102444800}`)) + ".sig"
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Metadata-Flavor") != "Google" || req.URL.Query().Get("audience") != "iap-client-id" {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+		rw.Write([]byte(idToken))
+	}))
+	defer server.Close()
+
+	p, err := NewGCPIdentityProvider(&GCPIdentityConfig{Audience: "iap-client-id", MetadataURL: server.URL, Header: "Proxy-Authorization"})
+	if err != nil {
+		t.Fatalf("NewGCPIdentityProvider() error = %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	if err := p.ModifyRequest(req); err != nil {
+		t.Fatalf("ModifyRequest() error = %v", err)
+	}
+	if req.Header.Get("Proxy-Authorization") != "Bearer "+idToken {
+		t.Errorf("Unexpected Proxy-Authorization %q", req.Header.Get("Proxy-Authorization"))
+	}
+}
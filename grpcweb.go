@@ -0,0 +1,314 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	grpcWebContentType  = "application/grpc-web+proto"
+	grpcWebTrailerFlag  = 0x80
+	grpcWebCompressFlag = 0x01
+)
+
+// GRPCWebConfig holds the gRPC-Web bridge configuration
+type GRPCWebConfig struct {
+	DescriptorFile string `json:"descriptor_file,omitempty"`
+	PathPrefix     string `json:"path_prefix,omitempty"`
+}
+
+// GRPCWebBridge translates JSON requests into gRPC-Web calls and gRPC-Web
+// responses back into JSON, using message types from a descriptor set
+type GRPCWebBridge struct {
+	registry   *protoRegistry
+	pathPrefix string
+}
+
+// grpcWebResponseWriter buffers the framed upstream response
+type grpcWebResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// NewGRPCWebBridge loads the descriptor set and creates a new bridge
+func NewGRPCWebBridge(config *GRPCWebConfig) (*GRPCWebBridge, error) {
+	if config.DescriptorFile == "" {
+		return nil, errors.New("grpc web descriptor_file is required")
+	}
+
+	data, err := os.ReadFile(config.DescriptorFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read grpc web descriptor_file: %w", err)
+	}
+	registry, err := parseDescriptorSet(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(registry.methods) == 0 {
+		return nil, errors.New("grpc web descriptor_file defines no services")
+	}
+
+	return &GRPCWebBridge{
+		registry:   registry,
+		pathPrefix: strings.TrimRight(config.PathPrefix, "/"),
+	}, nil
+}
+
+// method returns the gRPC path and method for a JSON request, or nil when the
+// request does not target a known method
+func (gb *GRPCWebBridge) method(req *http.Request) (string, *protoMethod) {
+	if req.Method != http.MethodPost || !strings.HasPrefix(req.URL.Path, gb.pathPrefix) {
+		return "", nil
+	}
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		if mediaType != "application/json" {
+			return "", nil
+		}
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, gb.pathPrefix)
+	method, ok := gb.registry.methods[path]
+	if !ok {
+		return "", nil
+	}
+	return path, method
+}
+
+// ModifyRequest wraps a JSON request body into a gRPC-Web frame. It returns
+// the called method, or nil when the request is not bridged.
+func (gb *GRPCWebBridge) ModifyRequest(req *http.Request) (*protoMethod, error) {
+	path, method := gb.method(req)
+	if method == nil {
+		return nil, nil
+	}
+
+	body, err := readAndRestoreBody(req, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var input interface{}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &input); err != nil {
+			return nil, fmt.Errorf("invalid JSON request: %w", err)
+		}
+	}
+	message, err := gb.registry.encodeMessage(method.input, input)
+	if err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	frame = append(frame, message...)
+
+	req.URL.Path = path
+	req.URL.RawPath = ""
+	req.Body = io.NopCloser(bytes.NewReader(frame))
+	req.ContentLength = int64(len(frame))
+	req.Header.Set("Content-Length", strconv.Itoa(len(frame)))
+	req.Header.Set("Content-Type", grpcWebContentType)
+	req.Header.Set("Accept", grpcWebContentType)
+	req.Header.Set("X-Grpc-Web", "1")
+	req.Header.Del("Accept-Encoding")
+	return method, nil
+}
+
+// Handler wraps next so the gRPC-Web response of method is returned as JSON.
+// Successful calls return the response message (or an array for server
+// streams); failed calls return {"code", "message"} with a mapped status.
+func (gb *GRPCWebBridge) Handler(next http.Handler, method *protoMethod, errs *pluginErrors) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		gw := &grpcWebResponseWriter{ResponseWriter: rw}
+		next.ServeHTTP(gw, req)
+
+		status := gw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		header := rw.Header()
+		contentType := header.Get("Content-Type")
+
+		// Pass through responses that are not gRPC-Web, e.g. proxy errors
+		if !strings.HasPrefix(contentType, "application/grpc-web") {
+			rw.WriteHeader(status)
+			rw.Write(gw.body.Bytes())
+			return
+		}
+
+		body, err := gb.decodeResponse(method, contentType, header, gw.body.Bytes())
+		for _, name := range []string{"Content-Type", "Content-Length", "Grpc-Status", "Grpc-Message"} {
+			header.Del(name)
+		}
+		if err != nil {
+			errs.write(rw, http.StatusBadGateway, "gRPC-Web response error", err)
+			return
+		}
+
+		header.Set("Content-Type", "application/json")
+		header.Set("Content-Length", strconv.Itoa(len(body.payload)))
+		rw.WriteHeader(body.status)
+		rw.Write(body.payload)
+	})
+}
+
+// grpcWebResult is the JSON translation of a gRPC-Web response
+type grpcWebResult struct {
+	status  int
+	payload []byte
+}
+
+// decodeResponse parses the frames of a gRPC-Web response body
+func (gb *GRPCWebBridge) decodeResponse(method *protoMethod, contentType string, header http.Header, body []byte) (*grpcWebResult, error) {
+	if strings.HasPrefix(contentType, "application/grpc-web-text") {
+		decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(body)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid grpc-web-text body: %w", err)
+		}
+		body = decoded
+	}
+
+	// Trailers-only responses carry the status in the headers
+	grpcStatus := header.Get("Grpc-Status")
+	grpcMessage := header.Get("Grpc-Message")
+
+	var messages []interface{}
+	for len(body) > 0 {
+		if len(body) < 5 {
+			return nil, errors.New("truncated frame header")
+		}
+		flags := body[0]
+		size := binary.BigEndian.Uint32(body[1:5])
+		if uint64(len(body)-5) < uint64(size) {
+			return nil, errors.New("truncated frame")
+		}
+		payload := body[5 : 5+size]
+		body = body[5+size:]
+
+		if flags&grpcWebTrailerFlag != 0 {
+			for _, line := range strings.Split(string(payload), "\r\n") {
+				name, value, ok := strings.Cut(line, ":")
+				if !ok {
+					continue
+				}
+				switch strings.ToLower(strings.TrimSpace(name)) {
+				case "grpc-status":
+					grpcStatus = strings.TrimSpace(value)
+				case "grpc-message":
+					grpcMessage = strings.TrimSpace(value)
+				}
+			}
+			continue
+		}
+		if flags&grpcWebCompressFlag != 0 {
+			return nil, errors.New("compressed messages are not supported")
+		}
+
+		message, err := gb.registry.decodeMessage(method.output, payload)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+
+	code := 0
+	if grpcStatus != "" {
+		parsed, err := strconv.Atoi(grpcStatus)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grpc-status %q", grpcStatus)
+		}
+		code = parsed
+	}
+
+	var result interface{}
+	switch {
+	case code != 0:
+		result = map[string]interface{}{"code": code, "message": grpcUnescape(grpcMessage)}
+	case len(messages) == 0:
+		result = map[string]interface{}{}
+	case len(messages) == 1:
+		result = messages[0]
+	default:
+		result = messages
+	}
+
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return &grpcWebResult{status: grpcHTTPStatus(code), payload: payload}, nil
+}
+
+// grpcHTTPStatus maps gRPC status codes to HTTP status codes like the
+// gRPC-gateway does
+func grpcHTTPStatus(code int) int {
+	switch code {
+	case 0:
+		return http.StatusOK
+	case 1:
+		return 499
+	case 3, 9, 11:
+		return http.StatusBadRequest
+	case 4:
+		return http.StatusGatewayTimeout
+	case 5:
+		return http.StatusNotFound
+	case 6, 10:
+		return http.StatusConflict
+	case 7:
+		return http.StatusForbidden
+	case 8:
+		return http.StatusTooManyRequests
+	case 12:
+		return http.StatusNotImplemented
+	case 14:
+		return http.StatusServiceUnavailable
+	case 16:
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+// grpcUnescape decodes the percent-encoding of grpc-message
+func grpcUnescape(message string) string {
+	if !strings.Contains(message, "%") {
+		return message
+	}
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		if message[i] == '%' && i+2 < len(message) {
+			if value, err := strconv.ParseUint(message[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(value))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(message[i])
+	}
+	return b.String()
+}
+
+func (gw *grpcWebResponseWriter) WriteHeader(statusCode int) {
+	if gw.status == 0 {
+		gw.status = statusCode
+	}
+}
+
+func (gw *grpcWebResponseWriter) Write(b []byte) (int, error) {
+	if gw.status == 0 {
+		gw.status = http.StatusOK
+	}
+	return gw.body.Write(b)
+}
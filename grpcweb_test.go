@@ -0,0 +1,186 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// protoTestField appends a length-delimited field to a descriptor message
+func protoTestField(out []byte, number int, payload []byte) []byte {
+	out = appendProtoTag(out, number, wireBytes)
+	out = binary.AppendUvarint(out, uint64(len(payload)))
+	return append(out, payload...)
+}
+
+// protoTestVarint appends a varint field to a descriptor message
+func protoTestVarint(out []byte, number int, value uint64) []byte {
+	return binary.AppendUvarint(appendProtoTag(out, number, wireVarint), value)
+}
+
+// protoTestFieldDescriptor encodes a FieldDescriptorProto
+func protoTestFieldDescriptor(name string, number, label, typ int, typeName string) []byte {
+	var field []byte
+	field = protoTestField(field, 1, []byte(name))
+	field = protoTestVarint(field, 3, uint64(number))
+	field = protoTestVarint(field, 4, uint64(label))
+	field = protoTestVarint(field, 5, uint64(typ))
+	if typeName != "" {
+		field = protoTestField(field, 6, []byte(typeName))
+	}
+	return field
+}
+
+// testDescriptorSet describes:
+//
+//	package shop;
+//	enum Status { UNKNOWN = 0; PAID = 1; }
+//	message GetOrderRequest { string order_id = 1; }
+//	message Order {
+//	  string order_id = 1; int64 total_cents = 2; repeated int32 quantities = 3;
+//	  Status status = 4; map<string, string> labels = 5;
+//	}
+//	service Orders { rpc GetOrder(GetOrderRequest) returns (Order); }
+func testDescriptorSet() []byte {
+	var request []byte
+	request = protoTestField(request, 1, []byte("GetOrderRequest"))
+	request = protoTestField(request, 2, protoTestFieldDescriptor("order_id", 1, 1, protoTypeString, ""))
+
+	var entry []byte
+	entry = protoTestField(entry, 1, []byte("LabelsEntry"))
+	entry = protoTestField(entry, 2, protoTestFieldDescriptor("key", 1, 1, protoTypeString, ""))
+	entry = protoTestField(entry, 2, protoTestFieldDescriptor("value", 2, 1, protoTypeString, ""))
+	entry = protoTestField(entry, 7, protoTestVarint(nil, 7, 1))
+
+	var order []byte
+	order = protoTestField(order, 1, []byte("Order"))
+	order = protoTestField(order, 2, protoTestFieldDescriptor("order_id", 1, 1, protoTypeString, ""))
+	order = protoTestField(order, 2, protoTestFieldDescriptor("total_cents", 2, 1, protoTypeInt64, ""))
+	order = protoTestField(order, 2, protoTestFieldDescriptor("quantities", 3, protoLabelRepeated, protoTypeInt32, ""))
+	order = protoTestField(order, 2, protoTestFieldDescriptor("status", 4, 1, protoTypeEnum, ".shop.Status"))
+	order = protoTestField(order, 2, protoTestFieldDescriptor("labels", 5, protoLabelRepeated, protoTypeMessage, ".shop.Order.LabelsEntry"))
+	order = protoTestField(order, 3, entry)
+
+	var enum []byte
+	enum = protoTestField(enum, 1, []byte("Status"))
+	enum = protoTestField(enum, 2, protoTestVarint(protoTestField(nil, 1, []byte("UNKNOWN")), 2, 0))
+	enum = protoTestField(enum, 2, protoTestVarint(protoTestField(nil, 1, []byte("PAID")), 2, 1))
+
+	var method []byte
+	method = protoTestField(method, 1, []byte("GetOrder"))
+	method = protoTestField(method, 2, []byte(".shop.GetOrderRequest"))
+	method = protoTestField(method, 3, []byte(".shop.Order"))
+
+	var service []byte
+	service = protoTestField(service, 1, []byte("Orders"))
+	service = protoTestField(service, 2, method)
+
+	var file []byte
+	file = protoTestField(file, 1, []byte("shop.proto"))
+	file = protoTestField(file, 2, []byte("shop"))
+	file = protoTestField(file, 4, request)
+	file = protoTestField(file, 4, order)
+	file = protoTestField(file, 5, enum)
+	file = protoTestField(file, 6, service)
+
+	return protoTestField(nil, 1, file)
+}
+
+// grpcWebFrame frames a message or trailer block
+func grpcWebFrame(flags byte, payload []byte) []byte {
+	frame := make([]byte, 5, 5+len(payload))
+	frame[0] = flags
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	return append(frame, payload...)
+}
+
+func TestModifier_GRPCWebBridge(t *testing.T) {
+	descriptorFile := filepath.Join(t.TempDir(), "shop.pb")
+	if err := os.WriteFile(descriptorFile, testDescriptorSet(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	registry, err := parseDescriptorSet(testDescriptorSet())
+	if err != nil {
+		t.Fatalf("parseDescriptorSet() error = %v", err)
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/shop.Orders/GetOrder" || req.Header.Get("Content-Type") != grpcWebContentType {
+			t.Errorf("Unexpected upstream request %s %s", req.URL.Path, req.Header.Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(req.Body)
+		input, err := registry.decodeMessage("shop.GetOrderRequest", body[5:])
+		if err != nil {
+			t.Fatalf("decodeMessage() error = %v", err)
+		}
+
+		rw.Header().Set("Content-Type", grpcWebContentType)
+		if input["orderId"] == "missing" {
+			rw.Write(grpcWebFrame(grpcWebTrailerFlag, []byte("grpc-status:5\r\ngrpc-message:order%20not%20found\r\n")))
+			return
+		}
+
+		message, err := registry.encodeMessage("shop.Order", map[string]interface{}{
+			"orderId":    input["orderId"],
+			"totalCents": "12500",
+			"quantities": []interface{}{float64(1), float64(3)},
+			"status":     "PAID",
+			"labels":     map[string]interface{}{"channel": "web"},
+		})
+		if err != nil {
+			t.Fatalf("encodeMessage() error = %v", err)
+		}
+		rw.Write(grpcWebFrame(0, message))
+		rw.Write(grpcWebFrame(grpcWebTrailerFlag, []byte("grpc-status:0\r\n")))
+	})
+
+	config := CreateConfig()
+	config.GRPCWeb = &GRPCWebConfig{DescriptorFile: descriptorFile, PathPrefix: "/api"}
+	handler, err := New(context.Background(), next, config, "grpc-web")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	call := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/shop.Orders/GetOrder", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := call(`{"order_id": "A-1"}`)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Unexpected response %d %s: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+	var order map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &order)
+	expected := map[string]interface{}{
+		"orderId":    "A-1",
+		"totalCents": "12500",
+		"quantities": []interface{}{float64(1), float64(3)},
+		"status":     "PAID",
+		"labels":     map[string]interface{}{"channel": "web"},
+	}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("Unexpected order %v", order)
+	}
+
+	rec = call(`{"orderId": "missing"}`)
+	if rec.Code != http.StatusNotFound || rec.Body.String() != `{"code":5,"message":"order not found"}` {
+		t.Errorf("Unexpected error response %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = call(`{"unknown": true}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unknown field, got %d", rec.Code)
+	}
+}
@@ -1,11 +1,18 @@
 package traefik_modifier_plugin
 
 import (
-	"bytes"
+	"bufio"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"path"
+	"sort"
 	"strings"
 	"text/template"
+
+	"github.com/hukumonline-com/traefik-modifier-plugin/pkg"
 )
 
 // HeaderConfig holds header modification configuration
@@ -15,23 +22,49 @@ type HeaderConfig map[string]string
 type HeaderModifier struct {
 	templates       map[string]*template.Template
 	templateStrings map[string]string // Store original template strings
+	funcs           template.FuncMap
+	parseErr        error
+	remove          []string
 }
 
 // NewHeaderModifier creates a new header modifier with the given configuration
 func NewHeaderModifier(config HeaderConfig) *HeaderModifier {
+	return NewHeaderModifierWithFuncs(config, pkg.SimpleFuncMap())
+}
+
+// NewHeaderModifierWithFuncs creates a new header modifier using the given template functions
+func NewHeaderModifierWithFuncs(config HeaderConfig, funcs template.FuncMap) *HeaderModifier {
+	return newHeaderModifier("modifier_header", config, funcs)
+}
+
+// newHeaderModifier creates a header modifier whose templates are named after
+// the config key, e.g. modifier_response_header[Location]
+func newHeaderModifier(key string, config HeaderConfig, funcs template.FuncMap) *HeaderModifier {
 	hm := &HeaderModifier{
 		templates:       make(map[string]*template.Template),
 		templateStrings: make(map[string]string),
+		funcs:           funcs,
 	}
 
-	// Parse all header templates
-	for headerName, templateStr := range config {
+	// Parse all header templates, in name order so the reported error is stable
+	names := make([]string, 0, len(config))
+	for headerName := range config {
+		names = append(names, headerName)
+	}
+	sort.Strings(names)
+	for _, headerName := range names {
+		templateStr := config[headerName]
 		if templateStr != "" {
-			tmpl, err := template.New("header_"+headerName).
+			tmpl, err := template.New(key+"["+headerName+"]").
+				Funcs(hm.funcs).
 				Delims("[[", "]]").
 				Parse(templateStr)
 			if err != nil {
+				err = newTemplateError(key+"["+headerName+"]", err)
 				log.Printf("Error parsing header template for %s: %v", headerName, err)
+				if hm.parseErr == nil {
+					hm.parseErr = err
+				}
 				continue
 			}
 			hm.templates[headerName] = tmpl
@@ -42,13 +75,22 @@ func NewHeaderModifier(config HeaderConfig) *HeaderModifier {
 	return hm
 }
 
+// Validate returns the error of a header template that failed to parse, so
+// a broken configuration is rejected when the plugin is created
+func (hm *HeaderModifier) Validate() error {
+	return hm.parseErr
+}
+
 // ModifyHeaders modifies request headers based on the configured templates and context
 // Uses original headers map to determine whether to Set (replace) or Add (append)
+// Failing templates are skipped and the last execution error is returned
 func (hm *HeaderModifier) ModifyHeaders(req *http.Request, context *TemplateContext) error {
 	if len(hm.templates) == 0 {
 		return nil
 	}
 
+	logs := requestLog(context)
+
 	// Capture original headers before any modifications
 	originalHeaders := make(map[string]string)
 	for name, values := range req.Header {
@@ -58,28 +100,28 @@ func (hm *HeaderModifier) ModifyHeaders(req *http.Request, context *TemplateCont
 	}
 
 	// Create template data combining request info and context
-	templateData := map[string]interface{}{
-		"request": map[string]interface{}{
-			"headers": convertHeaders(req.Header),
-			"method":  req.Method,
-			"url":     req.URL.String(),
-			"path":    req.URL.Path,
-		},
-		"context": *context,
-	}
+	templateData := buildTemplateData(context, map[string]interface{}{
+		"request": requestTemplateData(req),
+	})
 
 	// Create modified headers map
 	modifiedHeaders := make(map[string]string)
 
 	// Process each header template to generate modified headers
+	var execErr error
 	for headerName, tmpl := range hm.templates {
-		var buf bytes.Buffer
-		if err := tmpl.Execute(&buf, templateData); err != nil {
-			log.Printf("Error executing header template for %s: %v", headerName, err)
+		buf := newTemplateOutput(context)
+		if err := tmpl.Execute(buf, templateData); err != nil {
+			execErr = newTemplateError(tmpl.Name(), err)
+			traceTemplate(context, tmpl.Name(), nil, execErr)
+			logs.warnf(phaseHeader, "", "Error executing header template for %s: %v", headerName, execErr)
+			buf.release()
 			continue
 		}
+		traceTemplate(context, tmpl.Name(), buf.Bytes(), nil)
 
 		headerValue := strings.TrimSpace(buf.String())
+		buf.release()
 		if headerValue != "" {
 			modifiedHeaders[headerName] = headerValue
 		}
@@ -102,17 +144,137 @@ func (hm *HeaderModifier) ModifyHeaders(req *http.Request, context *TemplateCont
 		if headerExistsInOriginal {
 			// Use Set (replace) for existing headers
 			req.Header.Set(headerName, headerValue)
-			log.Printf("Set header %s: %s (was: %s)", headerName, headerValue, originalValue)
+			logs.debugf(phaseHeader, outcomeModified, "Set header %s: %s (was: %s)", headerName, headerValue, originalValue)
 		} else {
 			// Use Add (append) for new headers
 			req.Header.Add(headerName, headerValue)
-			log.Printf("Added header %s: %s", headerName, headerValue)
+			logs.debugf(phaseHeader, outcomeModified, "Added header %s: %s", headerName, headerValue)
 		}
 	}
 
+	return execErr
+}
+
+// SetRemove sets the glob patterns (path.Match syntax, case-insensitive) of
+// response headers removed before the templates are applied
+func (hm *HeaderModifier) SetRemove(patterns []string) error {
+	hm.remove = nil
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return fmt.Errorf("invalid remove_response_headers pattern %q", pattern)
+		}
+		hm.remove = append(hm.remove, pattern)
+	}
 	return nil
 }
 
+// removeHeaders deletes the headers matching a remove pattern
+func (hm *HeaderModifier) removeHeaders(header http.Header) {
+	for name := range header {
+		lower := strings.ToLower(name)
+		for _, pattern := range hm.remove {
+			if matched, _ := path.Match(pattern, lower); matched {
+				header.Del(name)
+				break
+			}
+		}
+	}
+}
+
+// ModifyResponseHeaders removes and sets response headers from the
+// configured patterns and templates before the response reaches the client.
+// Templates see .response.status and the upstream .response.headers next to
+// the request data; empty results are skipped. Failing templates are skipped
+// and the last execution error is returned
+func (hm *HeaderModifier) ModifyResponseHeaders(header http.Header, status int, req *http.Request, context *TemplateContext) error {
+	if len(hm.templates) == 0 && len(hm.remove) == 0 {
+		return nil
+	}
+
+	templateData := buildTemplateData(context, map[string]interface{}{
+		"request": requestTemplateData(req),
+		"response": map[string]interface{}{
+			"status":  status,
+			"headers": convertHeaders(header),
+		},
+	})
+	hm.removeHeaders(header)
+
+	var execErr error
+	for headerName, tmpl := range hm.templates {
+		buf := newTemplateOutput(context)
+		if err := tmpl.Execute(buf, templateData); err != nil {
+			execErr = newTemplateError(tmpl.Name(), err)
+			traceTemplate(context, tmpl.Name(), nil, execErr)
+			requestLog(context).warnf("response_header", "", "Error executing response header template for %s: %v", headerName, execErr)
+			buf.release()
+			continue
+		}
+		traceTemplate(context, tmpl.Name(), buf.Bytes(), nil)
+
+		if headerValue := strings.TrimSpace(buf.String()); headerValue != "" {
+			header.Set(headerName, headerValue)
+		}
+		buf.release()
+	}
+
+	return execErr
+}
+
+// ResponseHandler wraps next so the response headers are modified right
+// before the status line is written
+func (hm *HeaderModifier) ResponseHandler(next http.Handler, context *TemplateContext) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(&headerResponseWriter{ResponseWriter: rw, modify: func(status int) {
+			if err := hm.ModifyResponseHeaders(rw.Header(), status, req, context); err != nil {
+				requestLog(context).warnf("response_header", outcomeContinued, "Response header modification error: %v", err)
+			}
+		}}, req)
+	})
+}
+
+// headerResponseWriter calls modify once before the headers are written
+type headerResponseWriter struct {
+	http.ResponseWriter
+	modify      func(status int)
+	wroteHeader bool
+}
+
+func (hw *headerResponseWriter) WriteHeader(statusCode int) {
+	if !hw.wroteHeader {
+		hw.wroteHeader = true
+		hw.modify(statusCode)
+	}
+	hw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (hw *headerResponseWriter) Write(b []byte) (int, error) {
+	if !hw.wroteHeader {
+		hw.WriteHeader(http.StatusOK)
+	}
+	return hw.ResponseWriter.Write(b)
+}
+
+// Flush forwards flushes of streamed responses, writing the headers first
+func (hw *headerResponseWriter) Flush() {
+	if !hw.wroteHeader {
+		hw.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := hw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack forwards connection upgrades
+func (hw *headerResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := hw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
 // AddHeader adds a new header without replacing existing ones
 func (hm *HeaderModifier) AddHeader(req *http.Request, headerName, headerValue string, context *TemplateContext) error {
 	if headerValue == "" {
@@ -122,31 +284,27 @@ func (hm *HeaderModifier) AddHeader(req *http.Request, headerName, headerValue s
 	// Check if it's a template
 	if containsTemplate(headerValue) {
 		tmpl, err := template.New("dynamic").
+			Funcs(hm.funcs).
 			Delims("[[", "]]").
 			Parse(headerValue)
 		if err != nil {
 			return err
 		}
 
-		templateData := map[string]interface{}{
-			"request": map[string]interface{}{
-				"headers": convertHeaders(req.Header),
-				"method":  req.Method,
-				"url":     req.URL.String(),
-				"path":    req.URL.Path,
-			},
-			"context": *context,
-		}
+		templateData := buildTemplateData(context, map[string]interface{}{
+			"request": requestTemplateData(req),
+		})
 
-		var buf bytes.Buffer
-		if err := tmpl.Execute(&buf, templateData); err != nil {
+		buf := newTemplateOutput(context)
+		defer buf.release()
+		if err := tmpl.Execute(buf, templateData); err != nil {
 			return err
 		}
 		headerValue = buf.String()
 	}
 
 	req.Header.Add(headerName, headerValue)
-	log.Printf("Added header %s: %s", headerName, headerValue)
+	requestLog(context).debugf(phaseHeader, outcomeModified, "Added header %s: %s", headerName, headerValue)
 	return nil
 }
 
@@ -159,38 +317,34 @@ func (hm *HeaderModifier) SetHeader(req *http.Request, headerName, headerValue s
 	// Check if it's a template
 	if containsTemplate(headerValue) {
 		tmpl, err := template.New("dynamic").
+			Funcs(hm.funcs).
 			Delims("[[", "]]").
 			Parse(headerValue)
 		if err != nil {
 			return err
 		}
 
-		templateData := map[string]interface{}{
-			"request": map[string]interface{}{
-				"headers": convertHeaders(req.Header),
-				"method":  req.Method,
-				"url":     req.URL.String(),
-				"path":    req.URL.Path,
-			},
-			"context": *context,
-		}
+		templateData := buildTemplateData(context, map[string]interface{}{
+			"request": requestTemplateData(req),
+		})
 
-		var buf bytes.Buffer
-		if err := tmpl.Execute(&buf, templateData); err != nil {
+		buf := newTemplateOutput(context)
+		defer buf.release()
+		if err := tmpl.Execute(buf, templateData); err != nil {
 			return err
 		}
 		headerValue = buf.String()
 	}
 
 	req.Header.Set(headerName, headerValue)
-	log.Printf("Set header %s: %s", headerName, headerValue)
+	requestLog(context).debugf(phaseHeader, outcomeModified, "Set header %s: %s", headerName, headerValue)
 	return nil
 }
 
 // RemoveHeader removes a header from the request
 func (hm *HeaderModifier) RemoveHeader(req *http.Request, headerName string) {
 	req.Header.Del(headerName)
-	log.Printf("Removed header %s", headerName)
+	requestLog(nil).debugf(phaseHeader, outcomeModified, "Removed header %s", headerName)
 }
 
 // convertHeaders converts http.Header to map[string]string for template access
@@ -1,9 +1,12 @@
 package traefik_modifier_plugin
 
 import (
+	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
+
+	"github.com/hukumonline-com/traefik-modifier-plugin/pkg"
 )
 
 func TestHeaderModifier_ModifyHeaders(t *testing.T) {
@@ -100,6 +103,74 @@ func TestHeaderModifier_ModifyHeaders(t *testing.T) {
 	}
 }
 
+func TestHeaderModifier_ResponseHandler(t *testing.T) {
+	hm := newHeaderModifier("modifier_response_header", HeaderConfig{
+		"X-Cache-Status": `[[ if eq .response.status 304 ]]REVALIDATED[[ else ]]MISS[[ end ]]`,
+		"Location":       `[[ with index .response.headers "location" ]][[ slice . 21 ]][[ end ]]`,
+		"X-Request-Path": `[[ .request.path ]]`,
+	}, pkg.SimpleFuncMap())
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Location", "http://users.internal/users/7")
+		rw.WriteHeader(http.StatusCreated)
+	})
+
+	rec := httptest.NewRecorder()
+	hm.ResponseHandler(next, &TemplateContext{}).ServeHTTP(rec, httptest.NewRequest("POST", "/users", nil))
+
+	for name, expected := range map[string]string{
+		"X-Cache-Status": "MISS",
+		"Location":       "/users/7",
+		"X-Request-Path": "/users",
+	} {
+		if got := rec.Header().Get(name); got != expected {
+			t.Errorf("Expected %s %q, got %q", name, expected, got)
+		}
+	}
+	if rec.Code != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d", rec.Code)
+	}
+}
+
+func TestHeaderModifier_RemoveResponseHeaders(t *testing.T) {
+	hm := newHeaderModifier("modifier_response_header", HeaderConfig{
+		"Server":        "gateway",
+		"X-Upstream-Db": `[[ index .response.headers "x-debug-db" ]]`,
+	}, pkg.SimpleFuncMap())
+	if err := hm.SetRemove([]string{"x-powered-by", "X-Debug-*", "server"}); err != nil {
+		t.Fatalf("SetRemove() error = %v", err)
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Server", "nginx/1.25")
+		rw.Header().Set("X-Powered-By", "PHP/8.2")
+		rw.Header().Set("X-Debug-Db", "primary")
+		rw.Header().Set("X-Debug-Sql", "SELECT 1")
+		rw.Header().Set("Cache-Control", "no-store")
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	hm.ResponseHandler(next, &TemplateContext{}).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	for name, expected := range map[string]string{
+		"Server":        "gateway",
+		"X-Powered-By":  "",
+		"X-Debug-Db":    "",
+		"X-Debug-Sql":   "",
+		"X-Upstream-Db": "primary",
+		"Cache-Control": "no-store",
+	} {
+		if got := rec.Header().Get(name); got != expected {
+			t.Errorf("Expected %s %q, got %q", name, expected, got)
+		}
+	}
+
+	if err := hm.SetRemove([]string{"X-["}); err == nil {
+		t.Errorf("Expected error for an invalid pattern")
+	}
+}
+
 func TestHeaderModifier_SetHeader(t *testing.T) {
 	hm := NewHeaderModifier(HeaderConfig{})
 	req := httptest.NewRequest("GET", "http://example.com/test", nil)
@@ -0,0 +1,230 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// IdempotencyConfig holds the Idempotency-Key configuration
+type IdempotencyConfig struct {
+	Header       string   `json:"header,omitempty"`
+	Fingerprint  string   `json:"fingerprint,omitempty"`
+	Methods      []string `json:"methods,omitempty"`
+	DedupeTTL    string   `json:"dedupe_ttl,omitempty"`
+	MaxEntries   int      `json:"max_entries,omitempty"`
+	MaxBodyBytes int64    `json:"max_body_bytes,omitempty"`
+}
+
+const defaultIdempotencyFingerprint = "[[ .request.method ]] [[ .request.url ]] [[ .request.body ]]"
+
+// Idempotency generates or propagates an Idempotency-Key header and optionally
+// replays the captured response for duplicate requests
+type Idempotency struct {
+	header      string
+	fingerprint *template.Template
+	methods     map[string]bool
+	maxBody     int64
+	cache       *ttlCache
+
+	mu       sync.Mutex
+	inFlight map[string]string
+}
+
+// idempotentResponse is a captured response with the fingerprint of its request
+type idempotentResponse struct {
+	fingerprint string
+	response    *cachedResponse
+}
+
+// NewIdempotency creates a new Idempotency-Key handler
+func NewIdempotency(config *IdempotencyConfig, funcs template.FuncMap) (*Idempotency, error) {
+	fingerprint := config.Fingerprint
+	if fingerprint == "" {
+		fingerprint = defaultIdempotencyFingerprint
+	}
+
+	tmpl, err := template.New("idempotency[fingerprint]").Funcs(funcs).Delims("[[", "]]").Parse(fingerprint)
+	if err != nil {
+		return nil, newTemplateError("idempotency[fingerprint]", err)
+	}
+
+	id := &Idempotency{
+		header:      "Idempotency-Key",
+		fingerprint: tmpl,
+		methods:     make(map[string]bool),
+		maxBody:     defaultBatchMaxBody,
+		inFlight:    make(map[string]string),
+	}
+	if config.Header != "" {
+		id.header = config.Header
+	}
+	if config.MaxBodyBytes < 0 {
+		return nil, errors.New("idempotency max_body_bytes must not be negative")
+	}
+	if config.MaxBodyBytes > 0 {
+		id.maxBody = config.MaxBodyBytes
+	}
+
+	methods := config.Methods
+	if len(methods) == 0 {
+		methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	for _, method := range methods {
+		id.methods[strings.ToUpper(method)] = true
+	}
+
+	if config.DedupeTTL != "" {
+		ttl, err := time.ParseDuration(config.DedupeTTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid idempotency dedupe_ttl: %w", err)
+		}
+		id.cache = newTTLCache(ttl, config.MaxEntries)
+	}
+
+	return id, nil
+}
+
+// Key renders the request fingerprint and returns the dedupe key, scoped to
+// the caller, of the idempotency key the client sent. Without one, a key is
+// generated from the caller and the fingerprint for the upstream, and the
+// request is not deduplicated: the returned key is empty, as it is for
+// methods that are not covered. Bodies larger than max_body_bytes are not
+// read and return an error, leaving the request as it is.
+func (id *Idempotency) Key(req *http.Request, ctx *TemplateContext) (string, string, error) {
+	if !id.methods[req.Method] {
+		return "", "", nil
+	}
+
+	body, ok := bufferRequestBody(req, id.maxBody)
+	if !ok {
+		return "", "", fmt.Errorf("request body exceeds %d bytes", id.maxBody)
+	}
+	if body != nil {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	bodySum := sha256.Sum256(body)
+
+	request := requestTemplateData(req)
+	request["body"] = hex.EncodeToString(bodySum[:])
+	templateData := buildTemplateData(ctx, map[string]interface{}{
+		"request": request,
+	})
+
+	buf := newTemplateOutput(ctx)
+	err := id.fingerprint.Execute(buf, templateData)
+	sum := sha256.Sum256(buf.Bytes())
+	buf.release()
+	if err != nil {
+		return "", "", newTemplateError(id.fingerprint.Name(), err)
+	}
+	fingerprint := hex.EncodeToString(sum[:])
+	scope := callerScope(req, ctx)
+
+	key := req.Header.Get(id.header)
+	if key == "" {
+		generated := sha256.Sum256([]byte(scope + "\n" + fingerprint))
+		req.Header.Set(id.header, hex.EncodeToString(generated[:]))
+		return "", fingerprint, nil
+	}
+	return scope + "\n" + key, fingerprint, nil
+}
+
+// callerScope identifies the caller of req, so idempotency keys of different
+// users never share a captured response: the Authorization header, else the
+// Cookie header, else the client IP
+func callerScope(req *http.Request, ctx *TemplateContext) string {
+	if authorization := req.Header.Get("Authorization"); authorization != "" {
+		return "authorization:" + hashString(authorization)
+	}
+	if cookie := req.Header.Get("Cookie"); cookie != "" {
+		return "cookie:" + hashString(cookie)
+	}
+	if ctx != nil {
+		if fields, ok := (*ctx)[requestKey].(contextRequest); ok {
+			if ip, ok := fields["clientIP"].(string); ok && ip != "" {
+				return "ip:" + ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// hashString returns the hex SHA-256 of s, so credentials are not kept in
+// cache keys
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// Deduplicates reports whether the dedupe cache is enabled
+func (id *Idempotency) Deduplicates() bool {
+	return id.cache != nil
+}
+
+// Begin claims key for the current request. It returns the captured response
+// for replays, or a conflict status when the key is in flight or was used
+// with a different request.
+func (id *Idempotency) Begin(key, fingerprint string) (*cachedResponse, int) {
+	id.mu.Lock()
+	defer id.mu.Unlock()
+
+	if value, ok := id.cache.Get(key); ok {
+		captured := value.(*idempotentResponse)
+		if captured.fingerprint != fingerprint {
+			return nil, http.StatusUnprocessableEntity
+		}
+		return captured.response, 0
+	}
+
+	if _, exists := id.inFlight[key]; exists {
+		return nil, http.StatusConflict
+	}
+	id.inFlight[key] = fingerprint
+	return nil, 0
+}
+
+// Replay writes a captured response
+func (id *Idempotency) Replay(rw http.ResponseWriter, response *cachedResponse) {
+	for name, values := range response.header {
+		rw.Header()[name] = append([]string(nil), values...)
+	}
+	rw.Header().Set("Idempotent-Replayed", "true")
+	rw.WriteHeader(response.status)
+	rw.Write(response.body)
+}
+
+// Finish releases key and captures the response unless it was a server error,
+// so failed requests can be retried
+func (id *Idempotency) Finish(key string, recorder *cacheRecorder) {
+	id.mu.Lock()
+	defer id.mu.Unlock()
+
+	fingerprint := id.inFlight[key]
+	delete(id.inFlight, key)
+
+	if recorder.status == 0 || recorder.status >= 500 {
+		return
+	}
+	id.cache.Set(key, &idempotentResponse{
+		fingerprint: fingerprint,
+		response: &cachedResponse{
+			status: recorder.status,
+			header: recorder.header.Clone(),
+			body:   append([]byte(nil), recorder.body.Bytes()...),
+		},
+	})
+}
@@ -0,0 +1,35 @@
+package traefik_modifier_plugin
+
+import (
+	"encoding/json"
+
+	"github.com/hukumonline-com/traefik-modifier-plugin/pkg"
+)
+
+// jmespathProgram selects from the body with a JMESPath expression
+type jmespathProgram struct {
+	expression *pkg.JMESPath
+}
+
+// SetJMESPath compiles the expressions of modifier_request_jmespath and
+// modifier_response_jmespath. An expression replaces the Go template of the
+// same body.
+func (bm *BodyModifier) SetJMESPath(request string, response map[string]string) error {
+	return bm.setPrograms("modifier_request_jmespath", "modifier_response_jmespath", request, response, func(source string) (bodyProgram, error) {
+		expression, err := pkg.CompileJMESPath(source)
+		if err != nil {
+			return nil, err
+		}
+		return &jmespathProgram{expression: expression}, nil
+	})
+}
+
+// run returns the search result as JSON. JMESPath has no variables, so only
+// the body is searched.
+func (p *jmespathProgram) run(body interface{}, templateData map[string]interface{}) ([]byte, error) {
+	result, err := p.expression.Search(body)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(result)
+}
@@ -0,0 +1,39 @@
+package traefik_modifier_plugin
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hukumonline-com/traefik-modifier-plugin/pkg"
+)
+
+// jqProgram runs a jq program with the body as input and the top level
+// template data (request, response, context, ...) as $variables
+type jqProgram struct {
+	program *pkg.Jq
+}
+
+// SetJq compiles the jq programs of modifier_request_jq and
+// modifier_response_jq. A jq program replaces the Go template of the same body.
+func (bm *BodyModifier) SetJq(request string, response map[string]string) error {
+	return bm.setPrograms("modifier_request_jq", "modifier_response_jq", request, response, func(source string) (bodyProgram, error) {
+		program, err := pkg.CompileJq(source)
+		if err != nil {
+			return nil, err
+		}
+		return &jqProgram{program: program}, nil
+	})
+}
+
+// run executes the program, which must produce exactly one value, and
+// returns it as JSON
+func (p *jqProgram) run(body interface{}, templateData map[string]interface{}) ([]byte, error) {
+	outputs, err := p.program.Run(body, templateData)
+	if err != nil {
+		return nil, err
+	}
+	if len(outputs) != 1 {
+		return nil, fmt.Errorf("jq program produced %d values, expected 1", len(outputs))
+	}
+	return json.Marshal(outputs[0])
+}
@@ -0,0 +1,36 @@
+package traefik_modifier_plugin
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/hukumonline-com/traefik-modifier-plugin/pkg"
+)
+
+// bearerToken returns the bearer token of the Authorization header, if any
+func bearerToken(header http.Header) string {
+	auth := header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// decodeJWTClaims decodes the payload of a JWT without verifying its signature
+func decodeJWTClaims(token string) (map[string]interface{}, error) {
+	return pkg.DecodeJWTClaims(token)
+}
+
+// requestJWT returns the .request.jwt data for the bearer token of req, or
+// nil when there is no decodable token. The claims are not verified.
+func requestJWT(req *http.Request) map[string]interface{} {
+	token := bearerToken(req.Header)
+	if token == "" {
+		return nil
+	}
+	claims, err := decodeJWTClaims(token)
+	if err != nil {
+		return nil
+	}
+	return map[string]interface{}{"claims": claims}
+}
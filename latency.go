@@ -0,0 +1,28 @@
+package traefik_modifier_plugin
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// upstreamDurationKey is the context key of the upstream latency in milliseconds
+const upstreamDurationKey = "upstreamDurationMs"
+
+// timeUpstream wraps the upstream so the time spent in it, including
+// retries and batch fan-out, is stored in ctx as .context.upstreamDurationMs.
+// When header is set, the time until the upstream wrote its response
+// headers is sent to the client in that header.
+func timeUpstream(next http.Handler, ctx *TemplateContext, header string) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		if header != "" {
+			upstreamHeader := rw.Header()
+			rw = &headerResponseWriter{ResponseWriter: rw, modify: func(int) {
+				upstreamHeader.Set(header, strconv.FormatInt(time.Since(start).Milliseconds(), 10))
+			}}
+		}
+		next.ServeHTTP(rw, req)
+		(*ctx)[upstreamDurationKey] = time.Since(start).Milliseconds()
+	})
+}
@@ -0,0 +1,42 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestModifier_UpstreamDuration(t *testing.T) {
+	config := CreateConfig()
+	config.UpstreamDurationHeader = "X-Upstream-Duration"
+	config.ModifierResponse = map[string]string{"200": `{"data": [[ toJSON .response.body ]], "latencyMs": [[ .context.upstreamDurationMs ]]}`}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		io.WriteString(rw, `{"id": 1}`)
+	}), config, "latency")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	var body struct {
+		LatencyMs int64 `json:"latencyMs"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Invalid response %s: %v", rec.Body.String(), err)
+	}
+	if body.LatencyMs < 20 {
+		t.Errorf("Expected an upstream latency of at least 20ms, got %d", body.LatencyMs)
+	}
+	if header, err := strconv.ParseInt(rec.Header().Get("X-Upstream-Duration"), 10, 64); err != nil || header < 20 || header > body.LatencyMs {
+		t.Errorf("Unexpected X-Upstream-Duration %q for a latency of %dms", rec.Header().Get("X-Upstream-Duration"), body.LatencyMs)
+	}
+}
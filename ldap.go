@@ -0,0 +1,394 @@
+package traefik_modifier_plugin
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// LDAPConfig holds the LDAP/Active Directory lookup configuration
+type LDAPConfig struct {
+	URL                string `json:"url,omitempty"`
+	BindDN             string `json:"bind_dn,omitempty"`
+	BindPassword       string `json:"bind_password,omitempty"`
+	BaseDN             string `json:"base_dn,omitempty"`
+	UserAttribute      string `json:"user_attribute,omitempty"`
+	Timeout            string `json:"timeout,omitempty"`
+	CacheTTL           string `json:"cache_ttl,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+
+	CacheMaxEntries           int    `json:"cache_max_entries,omitempty"`
+	CacheStaleWhileRevalidate string `json:"cache_stale_while_revalidate,omitempty"`
+}
+
+// BER tags used by the LDAP messages below
+const (
+	berBoolean        = 0x01
+	berInteger        = 0x02
+	berOctetString    = 0x04
+	berEnumerated     = 0x0a
+	berSequence       = 0x30
+	ldapBindRequest   = 0x60
+	ldapBindResponse  = 0x61
+	ldapUnbindRequest = 0x42
+	ldapSearchRequest = 0x63
+	ldapSearchEntry   = 0x64
+	ldapSearchDone    = 0x65
+	ldapSearchRef     = 0x73
+	ldapSimpleAuth    = 0x80
+	ldapEqualityMatch = 0xa3
+)
+
+// LDAPClient performs cached attribute lookups against an LDAP directory
+type LDAPClient struct {
+	address       string
+	useTLS        bool
+	tlsConfig     *tls.Config
+	bindDN        string
+	bindPassword  string
+	baseDN        string
+	userAttribute string
+	timeout       time.Duration
+	cache         *ttlCache
+}
+
+// berElement is a decoded BER TLV element
+type berElement struct {
+	tag      byte
+	content  []byte
+	children []berElement
+}
+
+// NewLDAPClient creates a new LDAP client. Connections are opened per lookup.
+func NewLDAPClient(config *LDAPConfig) (*LDAPClient, error) {
+	if config.URL == "" || config.BaseDN == "" {
+		return nil, errors.New("ldap url and base_dn are required")
+	}
+
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ldap url: %w", err)
+	}
+
+	client := &LDAPClient{
+		address:       u.Host,
+		bindDN:        config.BindDN,
+		bindPassword:  config.BindPassword,
+		baseDN:        config.BaseDN,
+		userAttribute: config.UserAttribute,
+		timeout:       5 * time.Second,
+	}
+
+	switch u.Scheme {
+	case "ldap":
+		if u.Port() == "" {
+			client.address = net.JoinHostPort(u.Hostname(), "389")
+		}
+	case "ldaps":
+		client.useTLS = true
+		client.tlsConfig = &tls.Config{
+			ServerName:         u.Hostname(),
+			InsecureSkipVerify: config.InsecureSkipVerify,
+		}
+		if u.Port() == "" {
+			client.address = net.JoinHostPort(u.Hostname(), "636")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported ldap scheme %q", u.Scheme)
+	}
+
+	if client.userAttribute == "" {
+		client.userAttribute = "uid"
+	}
+	if config.Timeout != "" {
+		if client.timeout, err = time.ParseDuration(config.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid ldap timeout: %w", err)
+		}
+	}
+	cacheTTL := config.CacheTTL
+	if cacheTTL == "" {
+		cacheTTL = "5m"
+	}
+	if client.cache, err = newLookupCache("ldap", cacheTTL, config.CacheMaxEntries, config.CacheStaleWhileRevalidate); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// FuncMap returns the LDAP template functions
+func (c *LDAPClient) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"ldapLookup": c.Lookup,
+	}
+}
+
+// Lookup returns the first value of attr for the given user, or an empty string
+func (c *LDAPClient) Lookup(user, attr string) (string, error) {
+	value, err := c.cache.Fetch(user+"\x00"+attr, func() (interface{}, error) {
+		values, err := c.search(user, attr)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) == 0 {
+			return "", nil
+		}
+		return values[0], nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+// search binds and searches the directory for attr of the given user
+func (c *LDAPClient) search(user, attr string) ([]string, error) {
+	dialer := &net.Dialer{Timeout: c.timeout}
+	var conn net.Conn
+	var err error
+	if c.useTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.address, c.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", c.address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ldap: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+
+	// Simple bind
+	bind := berEncode(ldapBindRequest,
+		berInt(3),
+		berEncode(berOctetString, []byte(c.bindDN)),
+		berEncode(ldapSimpleAuth, []byte(c.bindPassword)),
+	)
+	if _, err := conn.Write(ldapMessage(1, bind)); err != nil {
+		return nil, fmt.Errorf("ldap: %w", err)
+	}
+	op, err := readLDAPMessage(reader)
+	if err != nil {
+		return nil, err
+	}
+	if op.tag != ldapBindResponse {
+		return nil, fmt.Errorf("ldap: unexpected bind response tag 0x%x", op.tag)
+	}
+	if err := ldapResultError(op); err != nil {
+		return nil, fmt.Errorf("ldap bind failed: %w", err)
+	}
+
+	// Subtree search on userAttribute=user returning attr
+	search := berEncode(ldapSearchRequest,
+		berEncode(berOctetString, []byte(c.baseDN)),
+		berEncode(berEnumerated, []byte{2}),
+		berEncode(berEnumerated, []byte{0}),
+		berInt(1),
+		berInt(int(c.timeout/time.Second)),
+		berEncode(berBoolean, []byte{0}),
+		berEncode(ldapEqualityMatch,
+			berEncode(berOctetString, []byte(c.userAttribute)),
+			berEncode(berOctetString, []byte(user)),
+		),
+		berEncode(berSequence, berEncode(berOctetString, []byte(attr))),
+	)
+	if _, err := conn.Write(ldapMessage(2, search)); err != nil {
+		return nil, fmt.Errorf("ldap: %w", err)
+	}
+
+	var values []string
+	for {
+		op, err := readLDAPMessage(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		switch op.tag {
+		case ldapSearchEntry:
+			values = append(values, ldapEntryValues(op, attr)...)
+		case ldapSearchRef:
+			// Referrals are not followed
+		case ldapSearchDone:
+			conn.Write(ldapMessage(3, berEncode(ldapUnbindRequest)))
+			if err := ldapResultError(op); err != nil {
+				return nil, fmt.Errorf("ldap search failed: %w", err)
+			}
+			return values, nil
+		default:
+			return nil, fmt.Errorf("ldap: unexpected search response tag 0x%x", op.tag)
+		}
+	}
+}
+
+// ldapEntryValues extracts the values of attr from a SearchResultEntry
+func ldapEntryValues(entry berElement, attr string) []string {
+	if len(entry.children) < 2 {
+		return nil
+	}
+	var values []string
+	for _, attribute := range entry.children[1].children {
+		if len(attribute.children) < 2 || !strings.EqualFold(string(attribute.children[0].content), attr) {
+			continue
+		}
+		for _, value := range attribute.children[1].children {
+			values = append(values, string(value.content))
+		}
+	}
+	return values
+}
+
+// ldapResultError converts a non-success LDAPResult into an error
+func ldapResultError(op berElement) error {
+	if len(op.children) < 3 {
+		return errors.New("malformed result")
+	}
+	code := berToInt(op.children[0].content)
+	if code == 0 {
+		return nil
+	}
+	return fmt.Errorf("result code %d: %s", code, op.children[2].content)
+}
+
+// ldapMessage wraps a protocol operation into an LDAPMessage
+func ldapMessage(id int, op []byte) []byte {
+	return berEncode(berSequence, berInt(id), op)
+}
+
+// readLDAPMessage reads one LDAPMessage and returns its protocol operation
+func readLDAPMessage(r *bufio.Reader) (berElement, error) {
+	msg, err := readBER(r)
+	if err != nil {
+		return berElement{}, fmt.Errorf("ldap: %w", err)
+	}
+	if msg.tag != berSequence || len(msg.children) < 2 {
+		return berElement{}, errors.New("ldap: malformed message")
+	}
+	return msg.children[1], nil
+}
+
+// berEncode encodes a TLV element whose content is the concatenation of parts
+func berEncode(tag byte, parts ...[]byte) []byte {
+	var content []byte
+	for _, part := range parts {
+		content = append(content, part...)
+	}
+
+	out := []byte{tag}
+	length := len(content)
+	if length < 0x80 {
+		out = append(out, byte(length))
+	} else {
+		var lengthBytes []byte
+		for l := length; l > 0; l >>= 8 {
+			lengthBytes = append([]byte{byte(l)}, lengthBytes...)
+		}
+		out = append(out, 0x80|byte(len(lengthBytes)))
+		out = append(out, lengthBytes...)
+	}
+	return append(out, content...)
+}
+
+// berInt encodes a non-negative INTEGER
+func berInt(value int) []byte {
+	content := []byte{byte(value)}
+	for v := value >> 8; v > 0; v >>= 8 {
+		content = append([]byte{byte(v)}, content...)
+	}
+	if content[0]&0x80 != 0 {
+		content = append([]byte{0}, content...)
+	}
+	return berEncode(berInteger, content)
+}
+
+// berToInt decodes an INTEGER or ENUMERATED content
+func berToInt(content []byte) int {
+	value := 0
+	for _, b := range content {
+		value = value<<8 | int(b)
+	}
+	return value
+}
+
+// readBER reads a single BER element, decoding constructed elements recursively
+func readBER(r io.ByteReader) (berElement, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return berElement{}, err
+	}
+
+	first, err := r.ReadByte()
+	if err != nil {
+		return berElement{}, err
+	}
+	length := int(first)
+	if first&0x80 != 0 {
+		count := int(first & 0x7f)
+		if count == 0 || count > 4 {
+			return berElement{}, errors.New("unsupported BER length")
+		}
+		length = 0
+		for i := 0; i < count; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return berElement{}, err
+			}
+			length = length<<8 | int(b)
+		}
+	}
+
+	content := make([]byte, length)
+	for i := range content {
+		if content[i], err = r.ReadByte(); err != nil {
+			return berElement{}, err
+		}
+	}
+
+	element := berElement{tag: tag, content: content}
+	if tag&0x20 != 0 {
+		children, err := parseBERChildren(content)
+		if err != nil {
+			return berElement{}, err
+		}
+		element.children = children
+	}
+	return element, nil
+}
+
+// parseBERChildren decodes the elements contained in a constructed element
+func parseBERChildren(content []byte) ([]berElement, error) {
+	var children []berElement
+	reader := &byteSliceReader{data: content}
+	for reader.pos < len(content) {
+		child, err := readBER(reader)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+	return children, nil
+}
+
+// byteSliceReader implements io.ByteReader over a byte slice
+type byteSliceReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *byteSliceReader) ReadByte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
@@ -0,0 +1,105 @@
+package traefik_modifier_plugin
+
+import (
+	"bufio"
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLDAPClient_Lookup(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	var searches int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			reader := bufio.NewReader(conn)
+
+			// Bind
+			bind, err := readLDAPMessage(reader)
+			if err != nil || bind.tag != ldapBindRequest || string(bind.children[2].content) != "secret" {
+				conn.Close()
+				continue
+			}
+			conn.Write(ldapMessage(1, berEncode(ldapBindResponse,
+				berEncode(berEnumerated, []byte{0}),
+				berEncode(berOctetString),
+				berEncode(berOctetString),
+			)))
+
+			// Search
+			search, err := readLDAPMessage(reader)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			atomic.AddInt32(&searches, 1)
+			filter := search.children[6]
+			user := string(filter.children[1].content)
+			if string(filter.children[0].content) == "sAMAccountName" && user == "jdoe" {
+				conn.Write(ldapMessage(2, berEncode(ldapSearchEntry,
+					berEncode(berOctetString, []byte("CN=John Doe,DC=corp,DC=local")),
+					berEncode(berSequence,
+						berEncode(berSequence,
+							berEncode(berOctetString, []byte("Department")),
+							berEncode(0x31, berEncode(berOctetString, []byte("Engineering"))),
+						),
+					),
+				)))
+			}
+			conn.Write(ldapMessage(2, berEncode(ldapSearchDone,
+				berEncode(berEnumerated, []byte{0}),
+				berEncode(berOctetString),
+				berEncode(berOctetString),
+			)))
+			conn.Close()
+		}
+	}()
+
+	client, err := NewLDAPClient(&LDAPConfig{
+		URL:           "ldap://" + listener.Addr().String(),
+		BindDN:        "CN=svc,DC=corp,DC=local",
+		BindPassword:  "secret",
+		BaseDN:        "DC=corp,DC=local",
+		UserAttribute: "sAMAccountName",
+	})
+	if err != nil {
+		t.Fatalf("NewLDAPClient() error = %v", err)
+	}
+
+	value, err := client.Lookup("jdoe", "department")
+	if err != nil || value != "Engineering" {
+		t.Fatalf("Lookup() = %q, %v", value, err)
+	}
+
+	value, err = client.Lookup("unknown", "department")
+	if err != nil || value != "" {
+		t.Fatalf("Lookup() unknown = %q, %v", value, err)
+	}
+
+	// Cached lookups do not reach the server
+	client.Lookup("jdoe", "department")
+	if n := atomic.LoadInt32(&searches); n != 2 {
+		t.Errorf("Expected 2 searches, got %d", n)
+	}
+}
+
+func TestBEREncodeLongLength(t *testing.T) {
+	content := make([]byte, 300)
+	encoded := berEncode(berOctetString, content)
+	element, err := readBER(&byteSliceReader{data: encoded})
+	if err != nil {
+		t.Fatalf("readBER() error = %v", err)
+	}
+	if element.tag != berOctetString || len(element.content) != 300 {
+		t.Errorf("Unexpected element: tag 0x%x length %d", element.tag, len(element.content))
+	}
+}
@@ -0,0 +1,146 @@
+package traefik_modifier_plugin
+
+import (
+	"encoding/json"
+	"sync"
+	"text/template"
+
+	"github.com/hukumonline-com/traefik-modifier-plugin/pkg"
+)
+
+// maxSharedTemplateSets bounds the template library. Traefik does not tell
+// when an instance is dropped, so the least recently used configuration is
+// evicted once the library is full, and repeated Traefik reloads cannot
+// grow it without limit. Instances keep the modifiers they already hold.
+const maxSharedTemplateSets = 256
+
+// templateLibrary shares the template modifiers of identical configurations
+// between middleware instances, so routers using the same templates hold
+// one parsed copy and one function map
+type templateLibrary struct {
+	mu         sync.Mutex
+	funcs      template.FuncMap
+	maxEntries int
+	uses       uint64
+	entries    map[string]*libraryEntry
+}
+
+// libraryEntry is a shared template set and the library use that last
+// returned it
+type libraryEntry struct {
+	templates *templateModifiers
+	lastUsed  uint64
+}
+
+// sharedTemplates is the template library of every instance in the process
+var sharedTemplates = newTemplateLibrary(maxSharedTemplateSets)
+
+// newTemplateLibrary creates a library holding at most maxEntries template sets
+func newTemplateLibrary(maxEntries int) *templateLibrary {
+	return &templateLibrary{maxEntries: maxEntries, entries: make(map[string]*libraryEntry)}
+}
+
+// templateLibraryKey holds the configuration read by newTemplateModifiers
+type templateLibraryKey struct {
+	ModifierRequest          string
+	ModifierRequestJq        string
+	ModifierRequestJMESPath  string
+	ModifierRequestFormat    string
+	MaxBufferBytes           int64
+	MaxRequestBodyBytes      int64
+	MaxResponseBodyBytes     int64
+	BodyLimitAction          string
+	BodyLimitResponse        string
+	StreamContentTypes       []string
+	ModifierResponseStream   string
+	ModifierResponse         map[string]string
+	ModifierResponseJq       map[string]string
+	ModifierResponseJMESPath map[string]string
+	ModifierResponseWhen     map[string][]*ConditionalTemplate
+	ModifierHeader           HeaderConfig
+	ModifierResponseHeader   HeaderConfig
+	RemoveResponseHeaders    []string
+	MaskedResponseHeaders    *MaskedHeadersConfig
+}
+
+// Modifiers returns the template modifiers of config, built once per
+// configuration. Instances whose funcs include functions of their own, e.g.
+// redis or vault lookups, cannot share templates and get their own.
+func (tl *templateLibrary) Modifiers(config *Config, funcs template.FuncMap) (*templateModifiers, error) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	if tl.funcs == nil {
+		tl.funcs = pkg.SimpleFuncMap()
+	}
+	if !sameFuncNames(funcs, tl.funcs) {
+		return newTemplateModifiers(config, funcs)
+	}
+
+	data, err := json.Marshal(templateLibraryKey{
+		ModifierRequest:          config.ModifierRequest,
+		ModifierRequestJq:        config.ModifierRequestJq,
+		ModifierRequestJMESPath:  config.ModifierRequestJMESPath,
+		ModifierRequestFormat:    config.ModifierRequestFormat,
+		MaxBufferBytes:           config.MaxBufferBytes,
+		MaxRequestBodyBytes:      config.MaxRequestBodyBytes,
+		MaxResponseBodyBytes:     config.MaxResponseBodyBytes,
+		BodyLimitAction:          config.BodyLimitAction,
+		BodyLimitResponse:        config.BodyLimitResponse,
+		StreamContentTypes:       config.StreamContentTypes,
+		ModifierResponseStream:   config.ModifierResponseStream,
+		ModifierResponse:         config.ModifierResponse,
+		ModifierResponseJq:       config.ModifierResponseJq,
+		ModifierResponseJMESPath: config.ModifierResponseJMESPath,
+		ModifierResponseWhen:     config.ModifierResponseWhen,
+		ModifierHeader:           config.ModifierHeader,
+		ModifierResponseHeader:   config.ModifierResponseHeader,
+		RemoveResponseHeaders:    config.RemoveResponseHeaders,
+		MaskedResponseHeaders:    config.MaskedResponseHeaders,
+	})
+	if err != nil {
+		return newTemplateModifiers(config, funcs)
+	}
+	key := string(data)
+	tl.uses++
+	if entry, ok := tl.entries[key]; ok {
+		entry.lastUsed = tl.uses
+		return entry.templates, nil
+	}
+
+	templates, err := newTemplateModifiers(config, tl.funcs)
+	if err != nil {
+		return nil, err
+	}
+	if len(tl.entries) >= tl.maxEntries {
+		tl.evictLeastRecentlyUsed()
+	}
+	tl.entries[key] = &libraryEntry{templates: templates, lastUsed: tl.uses}
+	return templates, nil
+}
+
+// evictLeastRecentlyUsed removes the template set returned longest ago
+func (tl *templateLibrary) evictLeastRecentlyUsed() {
+	var oldest string
+	var oldestUse uint64
+	for key, entry := range tl.entries {
+		if oldest == "" || entry.lastUsed < oldestUse {
+			oldest, oldestUse = key, entry.lastUsed
+		}
+	}
+	delete(tl.entries, oldest)
+}
+
+// sameFuncNames reports whether a and b define the same function names.
+// Instance functions only add names to the base function map.
+func sameFuncNames(a, b template.FuncMap) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name := range a {
+		if _, ok := b[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
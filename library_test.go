@@ -0,0 +1,75 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hukumonline-com/traefik-modifier-plugin/pkg"
+)
+
+func TestModifier_SharedTemplates(t *testing.T) {
+	newModifier := func(name string, configure func(*Config)) *modifier {
+		config := CreateConfig()
+		config.ModifierResponse = map[string]string{"200": `{"card": "****"}`}
+		config.ModifierHeader = HeaderConfig{"X-Shared": "library"}
+		if configure != nil {
+			configure(config)
+		}
+		handler, err := New(context.Background(), http.NotFoundHandler(), config, name)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		return handler.(*modifier)
+	}
+
+	first := newModifier("orders", nil)
+	second := newModifier("payments", nil)
+	if first.bodyModifier != second.bodyModifier || first.headerModifier != second.headerModifier {
+		t.Errorf("Expected instances with the same templates to share modifiers")
+	}
+
+	other := newModifier("users", func(c *Config) { c.ModifierHeader = HeaderConfig{"X-Shared": "other"} })
+	if other.headerModifier == first.headerModifier {
+		t.Errorf("Expected instances with different templates to have their own modifiers")
+	}
+
+	locale := newModifier("locale", func(c *Config) { c.Locale = &LocaleConfig{Supported: []string{"id", "en"}} })
+	if locale.bodyModifier == first.bodyModifier {
+		t.Errorf("Expected instances with instance functions to have their own modifiers")
+	}
+}
+
+func TestTemplateLibrary_EvictsLeastRecentlyUsed(t *testing.T) {
+	library := newTemplateLibrary(2)
+	modifiers := func(value string) *templateModifiers {
+		config := CreateConfig()
+		config.ModifierHeader = HeaderConfig{"X-Set": value}
+		templates, err := library.Modifiers(config, pkg.SimpleFuncMap())
+		if err != nil {
+			t.Fatalf("Modifiers() error = %v", err)
+		}
+		return templates
+	}
+
+	first := modifiers("first")
+	second := modifiers("second")
+	if modifiers("first") != first {
+		t.Fatalf("Expected the first set to be shared")
+	}
+
+	// A third set evicts the second, used longest ago, and keeps the limit
+	modifiers("third")
+	if len(library.entries) != 2 {
+		t.Errorf("Expected the library to hold 2 sets, got %d", len(library.entries))
+	}
+	if modifiers("first") != first {
+		t.Errorf("Expected the recently used first set to stay shared")
+	}
+	if modifiers("second") == second {
+		t.Errorf("Expected the second set to be evicted and parsed again")
+	}
+	if len(library.entries) != 2 {
+		t.Errorf("Expected the library to hold 2 sets, got %d", len(library.entries))
+	}
+}
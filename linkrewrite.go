@@ -0,0 +1,265 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// LinkRewriteConfig holds the absolute link rewriting configuration
+type LinkRewriteConfig struct {
+	Rules        []LinkRewriteRule `json:"rules,omitempty"`
+	Pattern      string            `json:"pattern,omitempty"`
+	PublicURL    string            `json:"public_url,omitempty"`
+	Paths        []string          `json:"paths,omitempty"`
+	Headers      []string          `json:"headers,omitempty"`
+	MaxBodyBytes int64             `json:"max_body_bytes,omitempty"`
+}
+
+// LinkRewriteRule maps an upstream URL prefix to its public prefix
+type LinkRewriteRule struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// LinkRewriter rewrites absolute upstream URLs in JSON responses and link
+// headers to the public gateway address
+type LinkRewriter struct {
+	rules     []LinkRewriteRule
+	pattern   *regexp.Regexp
+	publicURL string
+	paths     [][]string
+	headers   []string
+	maxBody   int64
+}
+
+// linkRewriteResponseWriter rewrites the link headers once the status is
+// written and buffers JSON responses for rewriting
+type linkRewriteResponseWriter struct {
+	*captureWriter
+	base      string
+	rewritten bool
+}
+
+// NewLinkRewriter creates a new link rewriter
+func NewLinkRewriter(config *LinkRewriteConfig) (*LinkRewriter, error) {
+	if len(config.Rules) == 0 && config.Pattern == "" {
+		return nil, errors.New("link_rewrite requires rules or a pattern")
+	}
+
+	lr := &LinkRewriter{
+		publicURL: strings.TrimSuffix(config.PublicURL, "/"),
+		paths:     splitJSONPaths(config.Paths),
+		headers:   config.Headers,
+	}
+	if lr.publicURL != "" {
+		if u, err := url.Parse(lr.publicURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid link_rewrite public_url %q", config.PublicURL)
+		}
+	}
+	if len(lr.headers) == 0 {
+		lr.headers = []string{"Location", "Content-Location", "Link"}
+	}
+	if config.MaxBodyBytes < 0 {
+		return nil, errors.New("link_rewrite max_body_bytes must not be negative")
+	}
+	lr.maxBody = config.MaxBodyBytes
+
+	for _, rule := range config.Rules {
+		if u, err := url.Parse(rule.From); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("link_rewrite rule from must be an absolute URL, got %q", rule.From)
+		}
+		lr.rules = append(lr.rules, LinkRewriteRule{
+			From: strings.TrimSuffix(rule.From, "/"),
+			To:   strings.TrimSuffix(rule.To, "/"),
+		})
+	}
+
+	if config.Pattern != "" {
+		pattern, err := regexp.Compile(config.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid link_rewrite pattern: %w", err)
+		}
+		lr.pattern = pattern
+	}
+
+	return lr, nil
+}
+
+// ResponseWriter wraps rw so upstream links are rewritten to the public
+// address of req. Non-JSON responses and JSON bodies larger than
+// max_body_bytes are streamed with only their headers rewritten.
+func (lr *LinkRewriter) ResponseWriter(rw http.ResponseWriter, req *http.Request) *linkRewriteResponseWriter {
+	lw := &linkRewriteResponseWriter{base: lr.publicBase(req)}
+	lw.captureWriter = newCaptureWriter(rw, lr.maxBody, func(status int, header http.Header) bool {
+		lw.rewritten = lr.rewriteHeaders(header, lw.base)
+		return responseFormat(header.Get("Content-Type")) == formatJSON
+	})
+	return lw
+}
+
+// publicBase returns the configured public URL, or the scheme and host the
+// client used to reach the gateway
+func (lr *LinkRewriter) publicBase(req *http.Request) string {
+	if lr.publicURL != "" {
+		return lr.publicURL
+	}
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	if proto := req.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = strings.TrimSpace(strings.Split(proto, ",")[0])
+	}
+	host := req.Host
+	if forwarded := req.Header.Get("X-Forwarded-Host"); forwarded != "" {
+		host = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	return scheme + "://" + host
+}
+
+// Finish rewrites the links in the buffered response and writes it. Gzip
+// and deflate bodies are rewritten decoded and encoded again. It reports
+// whether any link was rewritten.
+func (lr *LinkRewriter) Finish(lw *linkRewriteResponseWriter) bool {
+	if !lw.decided {
+		lw.captureWriter.WriteHeader(http.StatusOK)
+	}
+	if !lw.captured() {
+		return lw.rewritten
+	}
+	header := lw.ResponseWriter.Header()
+	body := lw.body.Bytes()
+
+	encoding := header.Get("Content-Encoding")
+	if encoding == "identity" {
+		encoding = ""
+	}
+	if rewrittenBody, ok := lr.rewriteBody(body, encoding, lw.base); ok {
+		body = rewrittenBody
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+		lw.rewritten = true
+	}
+
+	lw.ResponseWriter.WriteHeader(lw.statusCode())
+	lw.ResponseWriter.Write(body)
+	return lw.rewritten
+}
+
+// rewriteHeaders rewrites the configured link headers in place and reports
+// whether any value changed
+func (lr *LinkRewriter) rewriteHeaders(header http.Header, base string) bool {
+	rewritten := false
+	for _, name := range lr.headers {
+		values := header.Values(name)
+		for i, value := range values {
+			if replaced := lr.rewrite(value, base); replaced != value {
+				values[i] = replaced
+				rewritten = true
+			}
+		}
+	}
+	return rewritten
+}
+
+// rewriteBody rewrites the links in a JSON body with the given
+// Content-Encoding. It reports false when nothing changed or the body could
+// not be decoded.
+func (lr *LinkRewriter) rewriteBody(body []byte, encoding string, base string) ([]byte, bool) {
+	if encoding != "" {
+		decoded, err := decodeContentEncoding(encoding, body, lr.maxBody)
+		if err != nil {
+			return nil, false
+		}
+		body = decoded
+	}
+
+	var data interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if decoder.Decode(&data) != nil {
+		return nil, false
+	}
+	changed := false
+	data = lr.rewriteValue(data, []string{}, base, &changed)
+	if !changed {
+		return nil, false
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, false
+	}
+	if encoding != "" {
+		if encoded, err = encodeContentEncoding(encoding, encoded); err != nil {
+			return nil, false
+		}
+	}
+	return encoded, true
+}
+
+// rewriteValue rewrites the string leaves of a JSON value selected by the
+// configured paths, or all string leaves when no paths are configured
+func (lr *LinkRewriter) rewriteValue(value interface{}, path []string, base string, changed *bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = lr.rewriteValue(child, append(path[:len(path):len(path)], key), base, changed)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = lr.rewriteValue(child, append(path[:len(path):len(path)], strconv.Itoa(i)), base, changed)
+		}
+	case string:
+		if len(lr.paths) > 0 && !jsonPathMatches(lr.paths, path) {
+			return v
+		}
+		if rewritten := lr.rewrite(v, base); rewritten != v {
+			*changed = true
+			return rewritten
+		}
+	}
+	return value
+}
+
+// rewrite replaces the upstream URL prefixes in s. Rules are applied first;
+// the pattern then replaces any remaining internal base URL with base.
+func (lr *LinkRewriter) rewrite(s, base string) string {
+	for _, rule := range lr.rules {
+		to := rule.To
+		if to == "" || strings.HasPrefix(to, "/") {
+			to = base + to
+		}
+		s = replaceURLPrefix(s, rule.From, to)
+	}
+	if lr.pattern != nil {
+		s = lr.pattern.ReplaceAllLiteralString(s, base)
+	}
+	return s
+}
+
+// replaceURLPrefix replaces occurrences of from in s that end at a URL
+// boundary, so http://api.internal does not match http://api.internal.example
+func replaceURLPrefix(s, from, to string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, from)
+		if i < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		end := i + len(from)
+		b.WriteString(s[:i])
+		if end == len(s) || strings.IndexByte("/?#\"'<> ;,", s[end]) >= 0 {
+			b.WriteString(to)
+		} else {
+			b.WriteString(from)
+		}
+		s = s[end:]
+	}
+}
@@ -0,0 +1,108 @@
+package traefik_modifier_plugin
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLinkRewriter_Finish(t *testing.T) {
+	lr, err := NewLinkRewriter(&LinkRewriteConfig{
+		Rules: []LinkRewriteRule{
+			{From: "http://users.svc.cluster.local:8080/v1", To: "/users"},
+		},
+		Pattern: `https?://[a-z0-9-]+\.internal(:\d+)?`,
+		Paths:   []string{"$.self", "$.items.*.href"},
+	})
+	if err != nil {
+		t.Fatalf("NewLinkRewriter() error = %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://gateway.local/users", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "api.example.com")
+
+	rec := httptest.NewRecorder()
+	lw := lr.ResponseWriter(rec, req)
+	lw.Header().Set("Content-Type", "application/json")
+	lw.Header().Set("Location", "http://users.svc.cluster.local:8080/v1/7")
+	lw.WriteHeader(http.StatusCreated)
+	lw.Write([]byte(`{"self":"http://users.svc.cluster.local:8080/v1/7","items":[{"href":"http://files.internal:9000/a.pdf"},{"href":"http://users.svc.cluster.local:8080/v10"}],"note":"http://files.internal/b"}`))
+	if !lr.Finish(lw) {
+		t.Errorf("Expected links to be rewritten")
+	}
+
+	expected := `{"items":[{"href":"https://api.example.com/a.pdf"},{"href":"http://users.svc.cluster.local:8080/v10"}],"note":"http://files.internal/b","self":"https://api.example.com/users/7"}`
+	if rec.Code != http.StatusCreated || rec.Body.String() != expected {
+		t.Errorf("Unexpected response %d:\n%s\nexpected:\n%s", rec.Code, rec.Body.String(), expected)
+	}
+	if location := rec.Header().Get("Location"); location != "https://api.example.com/users/7" {
+		t.Errorf("Unexpected Location %s", location)
+	}
+
+	if _, err := NewLinkRewriter(&LinkRewriteConfig{Rules: []LinkRewriteRule{{From: "/v1"}}}); err == nil {
+		t.Errorf("Expected error for relative rule")
+	}
+}
+
+func TestLinkRewriter_EncodedAndStreamed(t *testing.T) {
+	lr, err := NewLinkRewriter(&LinkRewriteConfig{
+		Rules:        []LinkRewriteRule{{From: "http://users.internal", To: "/users"}},
+		PublicURL:    "https://api.example.com",
+		MaxBodyBytes: 64,
+	})
+	if err != nil {
+		t.Fatalf("NewLinkRewriter() error = %v", err)
+	}
+	req := httptest.NewRequest("GET", "/users", nil)
+
+	// Gzip bodies are rewritten decoded and compressed again
+	rec := httptest.NewRecorder()
+	lw := lr.ResponseWriter(rec, req)
+	compressed, _ := encodeContentEncoding("gzip", []byte(`{"self":"http://users.internal/7"}`))
+	lw.Header().Set("Content-Type", "application/json")
+	lw.Header().Set("Content-Encoding", "gzip")
+	lw.Write(compressed)
+	if !lr.Finish(lw) {
+		t.Errorf("Expected the compressed body to be rewritten")
+	}
+	decoded, err := decodeContentEncoding(rec.Header().Get("Content-Encoding"), rec.Body.Bytes(), 0)
+	if err != nil || string(decoded) != `{"self":"https://api.example.com/users/7"}` {
+		t.Errorf("Unexpected rewritten body %q (%v)", decoded, err)
+	}
+
+	// Event streams are flushed through with their headers rewritten
+	rec = httptest.NewRecorder()
+	lw = lr.ResponseWriter(rec, req)
+	lw.Header().Set("Content-Type", "text/event-stream")
+	lw.Header().Set("Link", "<http://users.internal/8>; rel=next")
+	io.WriteString(lw, "data: http://users.internal/7\n\n")
+	lw.Flush()
+	if !rec.Flushed || rec.Body.String() != "data: http://users.internal/7\n\n" || rec.Header().Get("Link") != "<https://api.example.com/users/8>; rel=next" {
+		t.Errorf("Unexpected stream flushed=%v %q %v", rec.Flushed, rec.Body.String(), rec.Header())
+	}
+	if !lr.Finish(lw) || rec.Body.String() != "data: http://users.internal/7\n\n" {
+		t.Errorf("Expected Finish to report the header rewrite and leave the stream alone, got %q", rec.Body.String())
+	}
+
+	// JSON bodies above the cap are streamed unmodified
+	rec = httptest.NewRecorder()
+	lw = lr.ResponseWriter(rec, req)
+	lw.Header().Set("Content-Type", "application/json")
+	large := `{"self":"http://users.internal/7","padding":"` + strings.Repeat("x", 64) + `"}`
+	io.WriteString(lw, large)
+	if lr.Finish(lw) || rec.Body.String() != large {
+		t.Errorf("Expected the large body to stream unmodified, got %q", rec.Body.String())
+	}
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	lw = lr.ResponseWriter(&hijackRecorder{ResponseRecorder: httptest.NewRecorder(), conn: server}, req)
+	if conn, _, err := lw.Hijack(); err != nil || conn != server {
+		t.Errorf("Hijack() = %v, %v", conn, err)
+	}
+}
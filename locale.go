@@ -0,0 +1,228 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// LocaleConfig holds the locale selection configuration
+type LocaleConfig struct {
+	Supported  []string `json:"supported,omitempty"`
+	Default    string   `json:"default,omitempty"`
+	QueryParam string   `json:"query_param,omitempty"`
+	Collapse   bool     `json:"collapse,omitempty"`
+}
+
+// Localizer resolves the caller's locale and collapses multilingual values
+// such as {"id": "Judul", "en": "Title"} into a single language
+type Localizer struct {
+	supported  []string
+	known      map[string]bool
+	fallback   string
+	queryParam string
+	collapse   bool
+}
+
+// localeResponseWriter buffers the response for collapsing
+type localeResponseWriter struct {
+	http.ResponseWriter
+	locale string
+	status int
+	body   bytes.Buffer
+}
+
+// NewLocalizer creates a new localizer
+func NewLocalizer(config *LocaleConfig) (*Localizer, error) {
+	if len(config.Supported) == 0 {
+		return nil, errors.New("locale supported list is required")
+	}
+
+	l := &Localizer{
+		known:      make(map[string]bool, len(config.Supported)),
+		fallback:   strings.ToLower(config.Default),
+		queryParam: config.QueryParam,
+		collapse:   config.Collapse,
+	}
+	for _, locale := range config.Supported {
+		locale = strings.ToLower(locale)
+		l.supported = append(l.supported, locale)
+		l.known[locale] = true
+	}
+	if l.fallback == "" {
+		l.fallback = l.supported[0]
+	}
+	if !l.known[l.fallback] {
+		return nil, errors.New("locale default must be one of the supported locales")
+	}
+	if l.queryParam == "" {
+		l.queryParam = "lang"
+	}
+
+	return l, nil
+}
+
+// Resolve returns the locale of the request from the query parameter, then
+// Accept-Language, then the default
+func (l *Localizer) Resolve(req *http.Request) string {
+	if locale := l.match(req.URL.Query().Get(l.queryParam)); locale != "" {
+		return locale
+	}
+
+	type candidate struct {
+		locale  string
+		quality float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(req.Header.Get("Accept-Language"), ",") {
+		tag, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if locale := l.match(tag); locale != "" && quality > 0 {
+			candidates = append(candidates, candidate{locale, quality})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].quality > candidates[j].quality })
+	if len(candidates) > 0 {
+		return candidates[0].locale
+	}
+
+	return l.fallback
+}
+
+// match maps a language tag such as en-US to a supported locale
+func (l *Localizer) match(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return ""
+	}
+	if l.known[tag] {
+		return tag
+	}
+	if i := strings.IndexAny(tag, "-_"); i > 0 && l.known[tag[:i]] {
+		return tag[:i]
+	}
+	return ""
+}
+
+// FuncMap returns the locale template functions
+func (l *Localizer) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"localize": func(value interface{}, locale string) interface{} {
+			if localized, ok := l.pick(value, locale, 1); ok {
+				return localized
+			}
+			return value
+		},
+		"localizeAll": l.Collapse,
+	}
+}
+
+// Collapse replaces every multilingual object in value with its translation
+// for locale. Objects need at least two locale keys, so that objects such as
+// {"id": 42} are not mistaken for translations.
+func (l *Localizer) Collapse(value interface{}, locale string) interface{} {
+	if localized, ok := l.pick(value, locale, 2); ok {
+		return localized
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		collapsed := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			collapsed[key] = l.Collapse(child, locale)
+		}
+		return collapsed
+	case []interface{}:
+		collapsed := make([]interface{}, len(v))
+		for i, child := range v {
+			collapsed[i] = l.Collapse(child, locale)
+		}
+		return collapsed
+	}
+	return value
+}
+
+// pick returns the translation for locale when value is a multilingual
+// object, i.e. an object with at least minKeys keys that are all supported
+// locales. Missing translations fall back to the default and then to the
+// supported order.
+func (l *Localizer) pick(value interface{}, locale string, minKeys int) (interface{}, bool) {
+	object, ok := value.(map[string]interface{})
+	if !ok || len(object) < minKeys {
+		return nil, false
+	}
+	for key := range object {
+		if !l.known[strings.ToLower(key)] {
+			return nil, false
+		}
+	}
+
+	for _, candidate := range append([]string{strings.ToLower(locale), l.fallback}, l.supported...) {
+		for key, translation := range object {
+			if strings.ToLower(key) == candidate {
+				return translation, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// ResponseWriter wraps rw so JSON responses are collapsed to locale when
+// Finish is called. It returns nil when collapsing is disabled.
+func (l *Localizer) ResponseWriter(rw http.ResponseWriter, locale string) *localeResponseWriter {
+	if !l.collapse {
+		return nil
+	}
+	return &localeResponseWriter{ResponseWriter: rw, locale: locale}
+}
+
+// Finish collapses the buffered JSON response and writes it
+func (l *Localizer) Finish(lw *localeResponseWriter) {
+	status := lw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	header := lw.ResponseWriter.Header()
+	body := lw.body.Bytes()
+
+	if responseFormat(header.Get("Content-Type")) == formatJSON && header.Get("Content-Encoding") == "" {
+		var data interface{}
+		if err := json.Unmarshal(body, &data); err == nil {
+			if collapsed, err := json.Marshal(l.Collapse(data, lw.locale)); err == nil {
+				body = collapsed
+			}
+		}
+		header.Set("Content-Language", lw.locale)
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	header.Add("Vary", "Accept-Language")
+
+	lw.ResponseWriter.WriteHeader(status)
+	lw.ResponseWriter.Write(body)
+}
+
+func (lw *localeResponseWriter) WriteHeader(statusCode int) {
+	if lw.status == 0 {
+		lw.status = statusCode
+	}
+}
+
+func (lw *localeResponseWriter) Write(b []byte) (int, error) {
+	if lw.status == 0 {
+		lw.status = http.StatusOK
+	}
+	return lw.body.Write(b)
+}
@@ -0,0 +1,185 @@
+package traefik_modifier_plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Log levels, from the quietest to the most verbose
+const (
+	logLevelError = iota + 1
+	logLevelWarn
+	logLevelInfo
+	logLevelDebug
+)
+
+// logLevels maps the log_level names to their levels
+var logLevels = map[string]int{
+	"error": logLevelError,
+	"warn":  logLevelWarn,
+	"info":  logLevelInfo,
+	"debug": logLevelDebug,
+}
+
+// Log formats
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// Log line outcomes, telling what happened to the request
+const (
+	// outcomeRejected means the request was answered with an error
+	outcomeRejected = "rejected"
+	// outcomeContinued means the request went on without the stage's result
+	outcomeContinued = "continued"
+	// outcomeRestored means the stage was undone with on_error useOriginal
+	outcomeRestored = "restored"
+	// outcomeModified means the stage changed the request or response
+	outcomeModified = "modified"
+)
+
+// logger writes the log lines of one plugin instance at or below its level.
+// A nil logger writes text lines at info, so per-request modification
+// details stay off.
+type logger struct {
+	level int
+	name  string
+	json  bool
+}
+
+// newLogger creates the logger of the middleware name for a log_level and
+// log_format, defaulting to info and text
+func newLogger(level, format, name string) (*logger, error) {
+	l := &logger{level: logLevelInfo, name: name}
+	if level != "" {
+		var ok bool
+		if l.level, ok = logLevels[strings.ToLower(level)]; !ok {
+			return nil, fmt.Errorf("invalid log_level %q: expected error, warn, info or debug", level)
+		}
+	}
+
+	switch strings.ToLower(format) {
+	case "", logFormatText:
+	case logFormatJSON:
+		l.json = true
+	default:
+		return nil, fmt.Errorf("invalid log_format %q: expected text or json", format)
+	}
+	return l, nil
+}
+
+// enabled reports whether lines of level are written
+func (l *logger) enabled(level int) bool {
+	if l == nil {
+		return level <= logLevelInfo
+	}
+	return level <= l.level
+}
+
+// forRequest returns the logger of the request with the template context
+// ctx, which carries it to the stages that only see the context
+func (l *logger) forRequest(ctx *TemplateContext) *requestLogger {
+	rl := &requestLogger{logger: l, ctx: ctx}
+	if ctx != nil {
+		(*ctx)[loggerKey] = rl
+	}
+	return rl
+}
+
+// requestLog returns the logger stored in the template context ctx, or a
+// default logger when there is none
+func requestLog(ctx *TemplateContext) *requestLogger {
+	if ctx != nil {
+		if rl, ok := (*ctx)[loggerKey].(*requestLogger); ok {
+			return rl
+		}
+	}
+	return &requestLogger{ctx: ctx}
+}
+
+// requestLogger writes log lines correlated with one request. Phases are
+// the config keys of the stages (header, query, request, response, jwt,
+// ...) and outcomes tell what happened to the request; both may be empty.
+type requestLogger struct {
+	*logger
+	ctx *TemplateContext
+}
+
+// logLine is a JSON log line
+type logLine struct {
+	Time       string `json:"time"`
+	Level      string `json:"level"`
+	Middleware string `json:"middleware,omitempty"`
+	RequestID  string `json:"requestID,omitempty"`
+	Phase      string `json:"phase,omitempty"`
+	Outcome    string `json:"outcome,omitempty"`
+	Message    string `json:"message"`
+}
+
+func (rl *requestLogger) printf(level int, phase, outcome, format string, args ...interface{}) {
+	if !rl.enabled(level) {
+		return
+	}
+	message := fmt.Sprintf(format, args...)
+	if rl.logger == nil || !rl.json {
+		log.Print(message)
+		return
+	}
+
+	line := logLine{
+		Time:       time.Now().UTC().Format(time.RFC3339Nano),
+		Middleware: rl.name,
+		Phase:      phase,
+		Outcome:    outcome,
+		Message:    message,
+	}
+	for name, l := range logLevels {
+		if l == level {
+			line.Level = name
+		}
+	}
+	if rl.ctx != nil {
+		line.RequestID, _ = (*rl.ctx)["requestID"].(string)
+	}
+	data, err := json.Marshal(line)
+	if err != nil {
+		log.Print(message)
+		return
+	}
+	fmt.Fprintf(log.Writer(), "%s\n", data)
+}
+
+// errorf logs failures of the plugin or its backends
+func (rl *requestLogger) errorf(phase, outcome, format string, args ...interface{}) {
+	rl.printf(logLevelError, phase, outcome, format, args...)
+}
+
+// warnf logs rejected client input and template errors that were passed through
+func (rl *requestLogger) warnf(phase, outcome, format string, args ...interface{}) {
+	rl.printf(logLevelWarn, phase, outcome, format, args...)
+}
+
+// infof logs reports the configuration asked for, such as dry runs
+func (rl *requestLogger) infof(phase, outcome, format string, args ...interface{}) {
+	rl.printf(logLevelInfo, phase, outcome, format, args...)
+}
+
+// debugf logs the modifications made to each request
+func (rl *requestLogger) debugf(phase, outcome, format string, args ...interface{}) {
+	rl.printf(logLevelDebug, phase, outcome, format, args...)
+}
+
+// policyOutcome returns the outcome of an on_error policy
+func policyOutcome(policy string) string {
+	switch policy {
+	case onErrorReject:
+		return outcomeRejected
+	case onErrorUseOriginal:
+		return outcomeRestored
+	}
+	return outcomeContinued
+}
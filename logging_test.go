@@ -0,0 +1,90 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestModifier_LogLevel(t *testing.T) {
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stdout)
+
+	for _, tt := range []struct {
+		level  string
+		logged bool
+	}{
+		{"", false},
+		{"warn", false},
+		{"DEBUG", true},
+	} {
+		config := CreateConfig()
+		config.LogLevel = tt.level
+		config.ModifierHeader = HeaderConfig{"X-User": "[[ index .request.headers \"x-email\" ]]"}
+		handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}), config, "test")
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		output.Reset()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Email", "jane@example.com")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if logged := strings.Contains(output.String(), "jane@example.com"); logged != tt.logged {
+			t.Errorf("log_level %q: expected logged %v, got %q", tt.level, tt.logged, output.String())
+		}
+	}
+
+	config := CreateConfig()
+	config.LogLevel = "verbose"
+	if _, err := New(context.Background(), http.NotFoundHandler(), config, "test"); err == nil {
+		t.Errorf("Expected error for an unknown log level")
+	}
+}
+
+func TestModifier_LogFormatJSON(t *testing.T) {
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stdout)
+
+	config := CreateConfig()
+	config.LogFormat = "json"
+	config.RequestID = &RequestIDConfig{}
+	config.ModifierHeader = HeaderConfig{"X-Broken": `[[ index .request.headers.missing 3 ]]`}
+	handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}), config, "orders-modifier")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var lines []logLine
+	for _, text := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var line logLine
+		if err := json.Unmarshal([]byte(text), &line); err != nil {
+			t.Fatalf("Expected JSON log lines, got %q: %v", text, err)
+		}
+		lines = append(lines, line)
+	}
+
+	last := lines[len(lines)-1]
+	expected := logLine{Time: last.Time, Level: "warn", Middleware: "orders-modifier", RequestID: "req-1", Phase: phaseHeader, Outcome: outcomeContinued, Message: last.Message}
+	if last != expected || !strings.HasPrefix(last.Message, "Header modification error") {
+		t.Errorf("Unexpected log line %+v", last)
+	}
+
+	config.LogFormat = "logfmt"
+	if _, err := New(context.Background(), http.NotFoundHandler(), config, "test"); err == nil {
+		t.Errorf("Expected error for an unknown log format")
+	}
+}
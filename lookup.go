@@ -0,0 +1,241 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// LookupConfig holds the named HTTP endpoints of the lookup template function
+type LookupConfig struct {
+	Endpoints map[string]*LookupEndpointConfig `json:"endpoints,omitempty"`
+}
+
+// LookupEndpointConfig describes one lookup endpoint. URL and headers are
+// templates rendered with .arg (the first argument) and .args. When Context
+// is set, it is rendered with the request data for every request and the
+// lookup result is exposed as .lookup.<name>.
+type LookupEndpointConfig struct {
+	URL      string            `json:"url,omitempty"`
+	Method   string            `json:"method,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Timeout  string            `json:"timeout,omitempty"`
+	CacheTTL string            `json:"cache_ttl,omitempty"`
+	Fallback string            `json:"fallback,omitempty"`
+	Context  string            `json:"context,omitempty"`
+
+	CacheMaxEntries           int    `json:"cache_max_entries,omitempty"`
+	CacheStaleWhileRevalidate string `json:"cache_stale_while_revalidate,omitempty"`
+}
+
+// Lookups calls named HTTP endpoints returning JSON
+type Lookups struct {
+	endpoints map[string]*lookupEndpoint
+	names     []string
+}
+
+// lookupEndpoint is a configured endpoint with its parsed templates
+type lookupEndpoint struct {
+	name        string
+	method      string
+	urlTemplate *template.Template
+	headers     map[string]*template.Template
+	context     *template.Template
+	fallback    interface{}
+	hasFallback bool
+	client      *http.Client
+	cache       *ttlCache
+}
+
+// NewLookups creates the lookup endpoints
+func NewLookups(config *LookupConfig, funcs template.FuncMap) (*Lookups, error) {
+	if len(config.Endpoints) == 0 {
+		return nil, errors.New("lookup requires at least one endpoint")
+	}
+
+	l := &Lookups{endpoints: make(map[string]*lookupEndpoint, len(config.Endpoints))}
+	for name, endpointConfig := range config.Endpoints {
+		endpoint, err := newLookupEndpoint(name, endpointConfig, funcs)
+		if err != nil {
+			return nil, err
+		}
+		l.endpoints[name] = endpoint
+		l.names = append(l.names, name)
+	}
+	sort.Strings(l.names)
+	return l, nil
+}
+
+// newLookupEndpoint parses the templates and options of one endpoint
+func newLookupEndpoint(name string, config *LookupEndpointConfig, funcs template.FuncMap) (*lookupEndpoint, error) {
+	if config == nil || config.URL == "" {
+		return nil, fmt.Errorf("lookup %s: url is required", name)
+	}
+
+	parse := func(key, text string) (*template.Template, error) {
+		tmpl, err := template.New(key).Funcs(funcs).Delims("[[", "]]").Parse(text)
+		if err != nil {
+			return nil, newTemplateError(key, err)
+		}
+		return tmpl, nil
+	}
+
+	urlTemplate, err := parse(fmt.Sprintf("lookup[%s:url]", name), config.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &lookupEndpoint{
+		name:        name,
+		method:      http.MethodGet,
+		urlTemplate: urlTemplate,
+		headers:     make(map[string]*template.Template),
+		client:      &http.Client{Timeout: 2 * time.Second},
+	}
+
+	if config.Method != "" {
+		e.method = strings.ToUpper(config.Method)
+	}
+
+	for header, value := range config.Headers {
+		tmpl, err := parse(fmt.Sprintf("lookup[%s:header:%s]", name, header), value)
+		if err != nil {
+			return nil, err
+		}
+		e.headers[header] = tmpl
+	}
+
+	if config.Context != "" {
+		if e.context, err = parse(fmt.Sprintf("lookup[%s:context]", name), config.Context); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.Fallback != "" {
+		if err := json.Unmarshal([]byte(config.Fallback), &e.fallback); err != nil {
+			return nil, fmt.Errorf("lookup %s: fallback must be JSON: %w", name, err)
+		}
+		e.hasFallback = true
+	}
+
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lookup %s timeout: %w", name, err)
+		}
+		e.client.Timeout = timeout
+	}
+
+	if e.cache, err = newLookupCache("lookup "+name, config.CacheTTL, config.CacheMaxEntries, config.CacheStaleWhileRevalidate); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// FuncMap returns the lookup template function
+func (l *Lookups) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"lookup": l.Lookup,
+	}
+}
+
+// Lookup calls the named endpoint with args and returns its decoded JSON.
+// When the call fails, the endpoint fallback is returned if configured.
+func (l *Lookups) Lookup(name string, args ...interface{}) (interface{}, error) {
+	endpoint, exists := l.endpoints[name]
+	if !exists {
+		return nil, fmt.Errorf("lookup: unknown endpoint %q", name)
+	}
+	return endpoint.call(args)
+}
+
+// Resolve runs the endpoints that have a context template for req and
+// returns their results keyed by name, plus the names of failed lookups
+func (l *Lookups) Resolve(req *http.Request, ctx *TemplateContext) (map[string]interface{}, []string) {
+	var results map[string]interface{}
+	var failed []string
+
+	var templateData map[string]interface{}
+	for _, name := range l.names {
+		endpoint := l.endpoints[name]
+		if endpoint.context == nil {
+			continue
+		}
+		if templateData == nil {
+			templateData = buildTemplateData(ctx, map[string]interface{}{
+				"request": requestTemplateData(req),
+			})
+		}
+
+		buf := newTemplateOutput(ctx)
+		err := endpoint.context.Execute(buf, templateData)
+		arg := strings.TrimSpace(buf.String())
+		buf.release()
+		if err != nil {
+			requestLog(ctx).warnf("lookup", outcomeContinued, "Lookup %s error: %v", name, newTemplateError(endpoint.context.Name(), err))
+			failed = append(failed, name)
+			continue
+		}
+		if arg == "" {
+			continue
+		}
+
+		result, err := endpoint.call([]interface{}{arg})
+		if err != nil {
+			requestLog(ctx).errorf("lookup", outcomeContinued, "Lookup %s error: %v", name, err)
+			failed = append(failed, name)
+			continue
+		}
+		if results == nil {
+			results = make(map[string]interface{})
+		}
+		results[name] = result
+	}
+	return results, failed
+}
+
+// call renders and performs the request, falling back on failure
+func (e *lookupEndpoint) call(args []interface{}) (interface{}, error) {
+	result, err := e.fetch(args)
+	if err != nil && e.hasFallback {
+		log.Printf("Lookup %s failed, using fallback: %v", e.name, err)
+		return e.fallback, nil
+	}
+	return result, err
+}
+
+// fetch renders the URL and headers with args and decodes the JSON response
+func (e *lookupEndpoint) fetch(args []interface{}) (interface{}, error) {
+	var arg interface{}
+	if len(args) > 0 {
+		arg = args[0]
+	}
+	data := map[string]interface{}{"arg": arg, "args": args}
+
+	var buf bytes.Buffer
+	if err := e.urlTemplate.Execute(&buf, data); err != nil {
+		return nil, newTemplateError(e.urlTemplate.Name(), err)
+	}
+	url := strings.TrimSpace(buf.String())
+
+	headers := make(map[string]string, len(e.headers))
+	for name, tmpl := range e.headers {
+		buf.Reset()
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, newTemplateError(tmpl.Name(), err)
+		}
+		headers[name] = buf.String()
+	}
+
+	return e.cache.Fetch(jsonRequestCacheKey(e.method, url, headers), func() (interface{}, error) {
+		return fetchJSON(e.client, e.method, url, headers, "lookup "+e.name)
+	})
+}
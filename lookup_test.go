@@ -0,0 +1,86 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hukumonline-com/traefik-modifier-plugin/pkg"
+)
+
+func TestModifier_Lookup(t *testing.T) {
+	calls := 0
+	users := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls++
+		if req.URL.Path != "/users/42" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.Write([]byte(`{"name": "Ana", "plan": "pro"}`))
+	}))
+	defer users.Close()
+
+	config := CreateConfig()
+	config.Lookup = &LookupConfig{
+		Endpoints: map[string]*LookupEndpointConfig{
+			"user-service": {
+				URL:      users.URL + "/users/[[ urlPathEscape .arg ]]",
+				CacheTTL: "1m",
+			},
+			"profile": {
+				URL:      users.URL + "/users/[[ .arg ]]",
+				Context:  `[[ index .request.headers "x-user-id" ]]`,
+				Fallback: `{"plan": "free"}`,
+			},
+		},
+	}
+	config.ModifierHeader = HeaderConfig{
+		"X-User-Name": `[[ (lookup "user-service" (index .request.headers "x-user-id")).name ]]`,
+		"X-User-Plan": `[[ .lookup.profile.plan ]]`,
+	}
+
+	var name, plan string
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		name = req.Header.Get("X-User-Name")
+		plan = req.Header.Get("X-User-Plan")
+	})
+
+	handler, err := New(context.Background(), next, config, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("X-User-Id", "42")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if name != "Ana" || plan != "pro" {
+		t.Errorf("Expected lookup results Ana/pro, got %s/%s", name, plan)
+	}
+
+	req = httptest.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("X-User-Id", "7")
+	req.Header.Set("X-User-Plan", "spoofed")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if plan != "free" {
+		t.Errorf("Expected fallback plan free, got %s", plan)
+	}
+
+	lookups, err := NewLookups(config.Lookup, pkg.SimpleFuncMap())
+	if err != nil {
+		t.Fatalf("NewLookups() error = %v", err)
+	}
+	if _, err := lookups.Lookup("user-service", "7"); err == nil {
+		t.Errorf("Expected error for non-2xx lookup without fallback")
+	}
+	if _, err := lookups.Lookup("unknown", "42"); err == nil {
+		t.Errorf("Expected error for unknown lookup endpoint")
+	}
+
+	before := calls
+	lookups.Lookup("user-service", "42")
+	lookups.Lookup("user-service", "42")
+	if calls != before+1 {
+		t.Errorf("Expected lookup result to be cached, got %d calls", calls-before)
+	}
+}
@@ -0,0 +1,85 @@
+package traefik_modifier_plugin
+
+import (
+	"net/http"
+)
+
+// maskedFramingHeaders describe the templated body and are always written
+var maskedFramingHeaders = []string{"Content-Type", "Content-Length", "Content-Encoding"}
+
+// MaskedHeadersConfig selects the upstream response headers sent with a
+// response whose body a template replaced. When Keep is set, only those
+// headers are propagated; Drop removes headers, e.g. an ETag of the
+// unmasked body.
+type MaskedHeadersConfig struct {
+	Keep []string `json:"keep,omitempty"`
+	Drop []string `json:"drop,omitempty"`
+}
+
+// maskedHeaders filters the upstream headers of masked responses
+type maskedHeaders struct {
+	keep map[string]bool
+	drop map[string]bool
+}
+
+// SetMaskedHeaders sets the upstream headers kept or dropped when a response
+// template applies. Without it, all upstream headers are propagated.
+func (bm *BodyModifier) SetMaskedHeaders(config *MaskedHeadersConfig) {
+	if config == nil || (len(config.Keep) == 0 && len(config.Drop) == 0) {
+		bm.maskedHeaders = nil
+		return
+	}
+
+	mh := &maskedHeaders{drop: make(map[string]bool, len(config.Drop))}
+	if len(config.Keep) > 0 {
+		mh.keep = make(map[string]bool, len(config.Keep)+len(maskedFramingHeaders))
+		for _, name := range append(maskedFramingHeaders, config.Keep...) {
+			mh.keep[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+	for _, name := range config.Drop {
+		mh.drop[http.CanonicalHeaderKey(name)] = true
+	}
+	bm.maskedHeaders = mh
+}
+
+// filter removes the dropped headers, and the headers not kept, that the
+// upstream added to header. Headers the plugin set before calling the
+// upstream, listed in ownHeaders, are left alone.
+func (mh *maskedHeaders) filter(header http.Header, ownHeaders map[string]bool) {
+	if mh == nil {
+		return
+	}
+	for name := range header {
+		canonical := http.CanonicalHeaderKey(name)
+		if ownHeaders[canonical] {
+			continue
+		}
+		if mh.drop[canonical] || (mh.keep != nil && !mh.keep[canonical]) {
+			header.Del(name)
+		}
+	}
+}
+
+// headerNameSet returns the canonical names of header
+func headerNameSet(header http.Header) map[string]bool {
+	names := make(map[string]bool, len(header))
+	for name := range header {
+		names[http.CanonicalHeaderKey(name)] = true
+	}
+	return names
+}
+
+// maskedHeadersConfig returns the masked header configuration of config.
+// Headers set by modifier_response_header are always kept.
+func maskedHeadersConfig(config *Config) *MaskedHeadersConfig {
+	masked := config.MaskedResponseHeaders
+	if masked == nil || len(masked.Keep) == 0 || len(config.ModifierResponseHeader) == 0 {
+		return masked
+	}
+	keep := append([]string(nil), masked.Keep...)
+	for name := range config.ModifierResponseHeader {
+		keep = append(keep, name)
+	}
+	return &MaskedHeadersConfig{Keep: keep, Drop: masked.Drop}
+}
@@ -0,0 +1,64 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestModifier_MaskedResponseHeaders(t *testing.T) {
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Set-Cookie", "session=abc")
+		rw.Header().Set("Cache-Control", "no-store")
+		rw.Header().Set("ETag", `"v1"`)
+		rw.Header().Set("X-Internal-Trace", "db-7")
+		rw.Header().Set("Content-Type", "application/json")
+		io.WriteString(rw, `{"card": "4111"}`)
+	})
+
+	for _, tt := range []struct {
+		name     string
+		masked   *MaskedHeadersConfig
+		present  []string
+		removed  []string
+		response HeaderConfig
+	}{
+		{"default", nil, []string{"Set-Cookie", "Cache-Control", "Etag", "X-Internal-Trace"}, nil, nil},
+		{"drop", &MaskedHeadersConfig{Drop: []string{"etag", "X-Internal-Trace"}}, []string{"Set-Cookie", "Cache-Control"}, []string{"Etag", "X-Internal-Trace"}, nil},
+		{
+			"keep",
+			&MaskedHeadersConfig{Keep: []string{"Cache-Control", "Set-Cookie"}, Drop: []string{"Set-Cookie"}},
+			[]string{"Cache-Control", "Content-Type", "X-Request-Id", "X-Masked"},
+			[]string{"Set-Cookie", "Etag", "X-Internal-Trace"},
+			HeaderConfig{"X-Masked": "true"},
+		},
+	} {
+		config := CreateConfig()
+		config.RequestID = &RequestIDConfig{Response: true}
+		config.ModifierResponse = map[string]string{"200": `{"card": "****"}`}
+		config.ModifierResponseHeader = tt.response
+		config.MaskedResponseHeaders = tt.masked
+		handler, err := New(context.Background(), next, config, "masked")
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		if rec.Body.String() != `{"card": "****"}` {
+			t.Errorf("%s: expected the masked body, got %q", tt.name, rec.Body.String())
+		}
+		for _, name := range tt.present {
+			if rec.Header().Get(name) == "" {
+				t.Errorf("%s: expected %s to be propagated, got %v", tt.name, name, rec.Header())
+			}
+		}
+		for _, name := range tt.removed {
+			if rec.Header().Get(name) != "" {
+				t.Errorf("%s: expected %s to be removed, got %v", tt.name, name, rec.Header())
+			}
+		}
+	}
+}
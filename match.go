@@ -0,0 +1,100 @@
+package traefik_modifier_plugin
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// MatchConfig holds the conditions a request must meet to be modified. All
+// configured conditions must match; an empty config matches every request.
+type MatchConfig struct {
+	Path        string            `json:"path,omitempty"`
+	Methods     []string          `json:"methods,omitempty"`
+	Host        string            `json:"host,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	HeaderRegex map[string]string `json:"header_regex,omitempty"`
+}
+
+// RequestMatcher decides whether a request is modified
+type RequestMatcher struct {
+	path        *regexp.Regexp
+	methods     map[string]bool
+	host        *regexp.Regexp
+	headers     map[string]string
+	headerRegex map[string]*regexp.Regexp
+}
+
+// NewRequestMatcher compiles the match conditions
+func NewRequestMatcher(config *MatchConfig) (*RequestMatcher, error) {
+	rm := &RequestMatcher{
+		headers:     make(map[string]string, len(config.Headers)),
+		headerRegex: make(map[string]*regexp.Regexp, len(config.HeaderRegex)),
+	}
+
+	var err error
+	if config.Path != "" {
+		if rm.path, err = regexp.Compile(config.Path); err != nil {
+			return nil, fmt.Errorf("invalid match path: %w", err)
+		}
+	}
+	if config.Host != "" {
+		if rm.host, err = regexp.Compile("(?i)" + config.Host); err != nil {
+			return nil, fmt.Errorf("invalid match host: %w", err)
+		}
+	}
+	if len(config.Methods) > 0 {
+		rm.methods = make(map[string]bool, len(config.Methods))
+		for _, method := range config.Methods {
+			rm.methods[strings.ToUpper(method)] = true
+		}
+	}
+	for name, value := range config.Headers {
+		rm.headers[http.CanonicalHeaderKey(name)] = value
+	}
+	for name, pattern := range config.HeaderRegex {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid match header_regex %s: %w", name, err)
+		}
+		rm.headerRegex[http.CanonicalHeaderKey(name)] = re
+	}
+
+	return rm, nil
+}
+
+// Match reports whether req meets every condition. A nil matcher matches
+// every request.
+func (rm *RequestMatcher) Match(req *http.Request) bool {
+	if rm == nil {
+		return true
+	}
+	if rm.methods != nil && !rm.methods[req.Method] {
+		return false
+	}
+	if rm.path != nil && !rm.path.MatchString(req.URL.Path) {
+		return false
+	}
+	if rm.host != nil {
+		host := req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !rm.host.MatchString(host) {
+			return false
+		}
+	}
+	for name, value := range rm.headers {
+		if req.Header.Get(name) != value {
+			return false
+		}
+	}
+	for name, re := range rm.headerRegex {
+		if !re.MatchString(req.Header.Get(name)) {
+			return false
+		}
+	}
+	return true
+}
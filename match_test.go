@@ -0,0 +1,67 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestModifier_Match(t *testing.T) {
+	config := CreateConfig()
+	config.Match = &MatchConfig{
+		Path:        `^/api/v[0-9]+/`,
+		Methods:     []string{"post"},
+		Host:        `^api\.example\.com$`,
+		Headers:     map[string]string{"X-Tenant": "acme"},
+		HeaderRegex: map[string]string{"content-type": `^application/json`},
+	}
+	config.ModifierHeader = HeaderConfig{"X-Modified": "yes"}
+	config.ModifierRequest = `{"wrapped": [[ toJSON .request.api.body ]]}`
+
+	var modified, body string
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		modified = req.Header.Get("X-Modified")
+		data, _ := io.ReadAll(req.Body)
+		body = string(data)
+	})
+
+	handler, err := New(context.Background(), next, config, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		tenant  string
+		matches bool
+	}{
+		{"all conditions", "POST", "http://api.example.com:8443/api/v1/chat", "acme", true},
+		{"wrong path", "POST", "http://api.example.com/health", "acme", false},
+		{"wrong method", "GET", "http://api.example.com/api/v1/chat", "acme", false},
+		{"wrong host", "POST", "http://www.example.com/api/v1/chat", "acme", false},
+		{"wrong header", "POST", "http://api.example.com/api/v1/chat", "other", false},
+	}
+	for _, tt := range tests {
+		modified, body = "", ""
+		req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(`{"a": 1}`))
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		req.Header.Set("X-Tenant", tt.tenant)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if (modified == "yes") != tt.matches {
+			t.Errorf("%s: expected modified=%v, got header %q", tt.name, tt.matches, modified)
+		}
+		if !tt.matches && body != `{"a": 1}` {
+			t.Errorf("%s: expected untouched body, got %s", tt.name, body)
+		}
+	}
+
+	if _, err := NewRequestMatcher(&MatchConfig{Path: "("}); err == nil {
+		t.Errorf("Expected error for invalid path regex")
+	}
+}
@@ -0,0 +1,167 @@
+package traefik_modifier_plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SizeMetricsConfig holds the body size metrics configuration
+type SizeMetricsConfig struct {
+	Endpoint    string `json:"endpoint,omitempty"`
+	DebugHeader string `json:"debug_header,omitempty"`
+}
+
+// SizeMetrics aggregates original vs modified body sizes
+type SizeMetrics struct {
+	endpoint    string
+	debugHeader string
+
+	mu       sync.Mutex
+	request  sizeAggregate
+	response sizeAggregate
+}
+
+// sizeAggregate holds the counters of one direction
+type sizeAggregate struct {
+	Count         int64 `json:"count"`
+	OriginalBytes int64 `json:"original_bytes"`
+	ModifiedBytes int64 `json:"modified_bytes"`
+	MinDelta      int64 `json:"min_delta"`
+	MaxDelta      int64 `json:"max_delta"`
+}
+
+// NewSizeMetrics creates a new size metrics collector
+func NewSizeMetrics(config *SizeMetricsConfig) *SizeMetrics {
+	return &SizeMetrics{
+		endpoint:    config.Endpoint,
+		debugHeader: config.DebugHeader,
+	}
+}
+
+// add records a single original/modified pair
+func (a *sizeAggregate) add(original, modified int) {
+	delta := int64(modified - original)
+	if a.Count == 0 || delta < a.MinDelta {
+		a.MinDelta = delta
+	}
+	if a.Count == 0 || delta > a.MaxDelta {
+		a.MaxDelta = delta
+	}
+	a.Count++
+	a.OriginalBytes += int64(original)
+	a.ModifiedBytes += int64(modified)
+}
+
+// summary returns the aggregate with derived averages for reporting
+func (a sizeAggregate) summary() map[string]interface{} {
+	result := map[string]interface{}{
+		"count":          a.Count,
+		"original_bytes": a.OriginalBytes,
+		"modified_bytes": a.ModifiedBytes,
+		"min_delta":      a.MinDelta,
+		"max_delta":      a.MaxDelta,
+		"avg_delta":      0.0,
+		"ratio":          0.0,
+	}
+	if a.Count > 0 {
+		result["avg_delta"] = float64(a.ModifiedBytes-a.OriginalBytes) / float64(a.Count)
+	}
+	if a.OriginalBytes > 0 {
+		result["ratio"] = float64(a.ModifiedBytes) / float64(a.OriginalBytes)
+	}
+	return result
+}
+
+// RecordRequest records request body sizes. A nil collector is a no-op.
+func (sm *SizeMetrics) RecordRequest(original, modified int) {
+	if sm == nil {
+		return
+	}
+	sm.mu.Lock()
+	sm.request.add(original, modified)
+	sm.mu.Unlock()
+}
+
+// RecordResponse records response body sizes. A nil collector is a no-op.
+func (sm *SizeMetrics) RecordResponse(original, modified int) {
+	if sm == nil {
+		return
+	}
+	sm.mu.Lock()
+	sm.response.add(original, modified)
+	sm.mu.Unlock()
+}
+
+// IsEndpoint reports whether the request targets the metrics endpoint
+func (sm *SizeMetrics) IsEndpoint(req *http.Request) bool {
+	return sm != nil && sm.endpoint != "" && req.URL.Path == sm.endpoint
+}
+
+// ServeHTTP writes the aggregated metrics as JSON
+func (sm *SizeMetrics) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	sm.mu.Lock()
+	snapshot := map[string]interface{}{
+		"request":  sm.request.summary(),
+		"response": sm.response.summary(),
+	}
+	sm.mu.Unlock()
+
+	body, err := json.Marshal(snapshot)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(body)
+}
+
+// sizeWriter counts bytes written to the client and sets the debug header
+// right before the status code is written
+type sizeWriter struct {
+	http.ResponseWriter
+	metrics          *SizeMetrics
+	requestSizes     string
+	originalResponse int
+	written          int
+	wroteHeader      bool
+}
+
+func (sw *sizeWriter) WriteHeader(statusCode int) {
+	if !sw.wroteHeader {
+		sw.wroteHeader = true
+		if sw.metrics.debugHeader != "" {
+			modified := sw.originalResponse
+			if contentLength, err := strconv.Atoi(sw.Header().Get("Content-Length")); err == nil {
+				modified = contentLength
+			}
+			parts := []string{}
+			if sw.requestSizes != "" {
+				parts = append(parts, sw.requestSizes)
+			}
+			parts = append(parts, formatSizeDelta("response", sw.originalResponse, modified))
+			sw.Header().Set(sw.metrics.debugHeader, strings.Join(parts, ", "))
+		}
+	}
+	sw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (sw *sizeWriter) Write(b []byte) (int, error) {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	n, err := sw.ResponseWriter.Write(b)
+	sw.written += n
+	return n, err
+}
+
+// formatSizeDelta formats sizes for the debug header, e.g. "request=120->98"
+func formatSizeDelta(direction string, original, modified int) string {
+	return fmt.Sprintf("%s=%d->%d", direction, original, modified)
+}
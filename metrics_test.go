@@ -0,0 +1,151 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSizeMetrics_Aggregation(t *testing.T) {
+	sm := NewSizeMetrics(&SizeMetricsConfig{Endpoint: "/__modifier/size"})
+	sm.RecordRequest(100, 80)
+	sm.RecordRequest(50, 60)
+	sm.RecordRequest(10, 10)
+	sm.RecordResponse(200, 50)
+
+	request := sm.request.summary()
+	expected := map[string]interface{}{
+		"count":          int64(3),
+		"original_bytes": int64(160),
+		"modified_bytes": int64(150),
+		"min_delta":      int64(-20),
+		"max_delta":      int64(10),
+		"avg_delta":      float64(-10) / 3,
+		"ratio":          float64(150) / 160,
+	}
+	for name, value := range expected {
+		if request[name] != value {
+			t.Errorf("request %s = %v, expected %v", name, request[name], value)
+		}
+	}
+
+	// A single negative delta is both the minimum and the maximum
+	response := sm.response.summary()
+	if response["min_delta"] != int64(-150) || response["max_delta"] != int64(-150) || response["ratio"] != 0.25 {
+		t.Errorf("Unexpected response summary %v", response)
+	}
+
+	// Empty aggregates report zero averages instead of dividing by zero
+	empty := NewSizeMetrics(&SizeMetricsConfig{}).request.summary()
+	if empty["avg_delta"] != 0.0 || empty["ratio"] != 0.0 {
+		t.Errorf("Unexpected empty summary %v", empty)
+	}
+
+	// A nil collector is a no-op
+	var disabled *SizeMetrics
+	disabled.RecordRequest(1, 2)
+	disabled.RecordResponse(1, 2)
+	if disabled.IsEndpoint(httptest.NewRequest("GET", "/__modifier/size", nil)) {
+		t.Errorf("Expected a nil collector to serve no endpoint")
+	}
+}
+
+func TestSizeMetrics_Endpoint(t *testing.T) {
+	sm := NewSizeMetrics(&SizeMetricsConfig{Endpoint: "/__modifier/size"})
+	sm.RecordResponse(40, 10)
+
+	if !sm.IsEndpoint(httptest.NewRequest("GET", "/__modifier/size", nil)) || sm.IsEndpoint(httptest.NewRequest("GET", "/__modifier/size/x", nil)) {
+		t.Errorf("Expected only the exact endpoint path to match")
+	}
+
+	rec := httptest.NewRecorder()
+	sm.ServeHTTP(rec, httptest.NewRequest("GET", "/__modifier/size", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Unexpected endpoint response %d %v", rec.Code, rec.Header())
+	}
+
+	var body map[string]map[string]float64
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Invalid endpoint JSON %s: %v", rec.Body.String(), err)
+	}
+	if body["request"]["count"] != 0 || body["response"]["count"] != 1 || body["response"]["avg_delta"] != -30 || body["response"]["ratio"] != 0.25 {
+		t.Errorf("Unexpected endpoint output %s", rec.Body.String())
+	}
+}
+
+func TestSizeWriter_DebugHeader(t *testing.T) {
+	sm := NewSizeMetrics(&SizeMetricsConfig{DebugHeader: "X-Size-Delta"})
+
+	// The modified size comes from Content-Length when it is set
+	rec := httptest.NewRecorder()
+	sw := &sizeWriter{
+		ResponseWriter:   rec,
+		metrics:          sm,
+		requestSizes:     formatSizeDelta("request", 120, 98),
+		originalResponse: 500,
+	}
+	sw.Header().Set("Content-Length", "120")
+	sw.WriteHeader(http.StatusCreated)
+	sw.WriteHeader(http.StatusOK)
+	io.WriteString(sw, strings.Repeat("x", 120))
+
+	if actual := rec.Header().Get("X-Size-Delta"); actual != "request=120->98, response=500->120" {
+		t.Errorf("Unexpected debug header %q", actual)
+	}
+	if rec.Code != http.StatusCreated || sw.written != 120 {
+		t.Errorf("Expected status 201 and 120 bytes written, got %d and %d", rec.Code, sw.written)
+	}
+
+	// Without Content-Length the original size is reported
+	rec = httptest.NewRecorder()
+	sw = &sizeWriter{ResponseWriter: rec, metrics: sm, originalResponse: 7}
+	io.WriteString(sw, "changed")
+	if actual := rec.Header().Get("X-Size-Delta"); actual != "response=7->7" {
+		t.Errorf("Unexpected debug header %q", actual)
+	}
+
+	// No header is set without a debug header name
+	rec = httptest.NewRecorder()
+	sw = &sizeWriter{ResponseWriter: rec, metrics: NewSizeMetrics(&SizeMetricsConfig{}), originalResponse: 7}
+	io.WriteString(sw, "changed")
+	if len(rec.Header()) != 0 {
+		t.Errorf("Expected no debug header, got %v", rec.Header())
+	}
+}
+
+func TestModifier_SizeMetrics(t *testing.T) {
+	config := CreateConfig()
+	config.ModifierRequest = `{"q": "[[ .request.api.body.question ]]"}`
+	config.ModifierResponse = map[string]string{"200": `{"a": "[[ .response.body.answer ]]"}`}
+	config.SizeMetrics = &SizeMetricsConfig{Endpoint: "/__modifier/size", DebugHeader: "X-Modifier-Size-Delta"}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		io.WriteString(rw, `{"answer": "ok", "internal": "secret"}`)
+	})
+
+	handler, err := New(context.Background(), next, config, "size")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/ask", strings.NewReader(`{"question": "hi", "extra": 1}`)))
+	if actual := rec.Header().Get("X-Modifier-Size-Delta"); actual != "request=30->11, response=38->11" {
+		t.Errorf("Unexpected debug header %q", actual)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/__modifier/size", nil))
+	var body map[string]map[string]float64
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Invalid endpoint JSON %s: %v", rec.Body.String(), err)
+	}
+	if body["request"]["original_bytes"] != 30 || body["request"]["modified_bytes"] != 11 ||
+		body["response"]["original_bytes"] != 38 || body["response"]["modified_bytes"] != 11 {
+		t.Errorf("Unexpected endpoint output %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,177 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Mirror sources
+const (
+	mirrorModified = "modified"
+	mirrorOriginal = "original"
+)
+
+// MirrorConfig holds the request mirroring configuration
+type MirrorConfig struct {
+	URL           string  `json:"url,omitempty"`
+	Source        string  `json:"source,omitempty"`
+	SampleRate    float64 `json:"sample_rate,omitempty"`
+	Timeout       string  `json:"timeout,omitempty"`
+	MaxConcurrent int     `json:"max_concurrent,omitempty"`
+	MaxBodyBytes  int64   `json:"max_body_bytes,omitempty"`
+}
+
+// Mirror asynchronously sends copies of requests to a shadow endpoint
+type Mirror struct {
+	target     *url.URL
+	source     string
+	sampleRate float64
+	client     *http.Client
+	slots      chan struct{}
+	maxBody    int64
+}
+
+// mirrorRequest is a detached copy of a request
+type mirrorRequest struct {
+	method string
+	url    *url.URL
+	header http.Header
+	body   []byte
+}
+
+// hopHeaders are not forwarded to the mirror
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// NewMirror creates a new request mirror
+func NewMirror(config *MirrorConfig) (*Mirror, error) {
+	if config.URL == "" {
+		return nil, errors.New("mirror url is required")
+	}
+
+	target, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mirror url: %w", err)
+	}
+
+	mr := &Mirror{
+		target:     target,
+		source:     mirrorModified,
+		sampleRate: 1,
+		client:     &http.Client{Timeout: 5 * time.Second},
+		maxBody:    1 << 20,
+	}
+
+	switch config.Source {
+	case "", mirrorModified:
+	case mirrorOriginal:
+		mr.source = mirrorOriginal
+	default:
+		return nil, fmt.Errorf("invalid mirror source %q", config.Source)
+	}
+
+	if config.SampleRate > 0 {
+		mr.sampleRate = config.SampleRate
+	}
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mirror timeout: %w", err)
+		}
+		mr.client.Timeout = timeout
+	}
+
+	maxConcurrent := config.MaxConcurrent
+	if maxConcurrent <= 0 {
+		maxConcurrent = 100
+	}
+	mr.slots = make(chan struct{}, maxConcurrent)
+
+	if config.MaxBodyBytes < 0 {
+		return nil, errors.New("mirror max_body_bytes must not be negative")
+	}
+	if config.MaxBodyBytes > 0 {
+		mr.maxBody = config.MaxBodyBytes
+	}
+
+	return mr, nil
+}
+
+// sample decides whether the current request is mirrored. A nil mirror never samples.
+func (mr *Mirror) sample() bool {
+	if mr == nil {
+		return false
+	}
+	return mr.sampleRate >= 1 || rand.Float64() < mr.sampleRate
+}
+
+// snapshot copies the request, restoring its body for the upstream. It
+// returns nil when the body is larger than max_body_bytes, which is then
+// streamed to the upstream without being mirrored.
+func (mr *Mirror) snapshot(req *http.Request) *mirrorRequest {
+	snap := &mirrorRequest{
+		method: req.Method,
+		header: req.Header.Clone(),
+	}
+
+	target := *mr.target
+	target.Path = strings.TrimRight(mr.target.Path, "/") + req.URL.Path
+	target.RawQuery = req.URL.RawQuery
+	snap.url = &target
+
+	if req.Body != nil && req.Body != http.NoBody {
+		body, ok := bufferRequestBody(req, mr.maxBody)
+		if !ok {
+			log.Printf("Mirror skipped %s %s: body exceeds %d bytes", req.Method, req.URL.Path, mr.maxBody)
+			return nil
+		}
+		snap.body = body
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	for _, name := range hopHeaders {
+		snap.header.Del(name)
+	}
+
+	return snap
+}
+
+// send mirrors the request in the background, dropping it when too many are in flight
+func (mr *Mirror) send(snap *mirrorRequest) {
+	select {
+	case mr.slots <- struct{}{}:
+	default:
+		log.Printf("Mirror queue full, dropping %s %s", snap.method, snap.url.Path)
+		return
+	}
+
+	go func() {
+		defer func() { <-mr.slots }()
+
+		req, err := http.NewRequest(snap.method, snap.url.String(), bytes.NewReader(snap.body))
+		if err != nil {
+			log.Printf("Mirror request error: %v", err)
+			return
+		}
+		req.Header = snap.header
+		req.ContentLength = int64(len(snap.body))
+
+		res, err := mr.client.Do(req)
+		if err != nil {
+			log.Printf("Mirror request to %s failed: %v", snap.url.Host, err)
+			return
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}()
+}
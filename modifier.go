@@ -2,11 +2,15 @@ package traefik_modifier_plugin
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"text/template"
 	"time"
+
+	"github.com/hukumonline-com/traefik-modifier-plugin/pkg"
 )
 
 func init() {
@@ -15,10 +19,85 @@ func init() {
 
 // Config holds the plugin configuration
 type Config struct {
-	ModifierRequest  string         `json:"modifier_request,omitempty"`
-	ModifierResponse map[int]string `json:"modifier_response,omitempty"`
-	ModifierQuery    *QueryConfig   `json:"modifier_query,omitempty"`
-	ModifierHeader   HeaderConfig   `json:"modifier_header,omitempty"`
+	ModifierRequest          string               `json:"modifier_request,omitempty"`
+	ModifierRequestJq        string               `json:"modifier_request_jq,omitempty"`
+	ModifierRequestJMESPath  string               `json:"modifier_request_jmespath,omitempty"`
+	ModifierRequestFormat    string               `json:"modifier_request_format,omitempty"`
+	MaxBufferBytes           int64                `json:"max_buffer_bytes,omitempty"`
+	MaxRequestBodyBytes      int64                `json:"max_request_body_bytes,omitempty"`
+	MaxResponseBodyBytes     int64                `json:"max_response_body_bytes,omitempty"`
+	BodyLimitAction          string               `json:"body_limit_action,omitempty"`
+	BodyLimitResponse        string               `json:"body_limit_response,omitempty"`
+	StreamContentTypes       []string             `json:"stream_content_types,omitempty"`
+	ModifierResponseStream   string               `json:"modifier_response_stream,omitempty"`
+	ModifierResponse         map[string]string    `json:"modifier_response,omitempty"`
+	ModifierResponseJq       map[string]string    `json:"modifier_response_jq,omitempty"`
+	ModifierResponseJMESPath map[string]string    `json:"modifier_response_jmespath,omitempty"`
+	ModifierQuery            *QueryConfig         `json:"modifier_query,omitempty"`
+	ModifierHeader           HeaderConfig         `json:"modifier_header,omitempty"`
+	ModifierResponseHeader   HeaderConfig         `json:"modifier_response_header,omitempty"`
+	ModifierCookie           *CookieConfig        `json:"modifier_cookie,omitempty"`
+	CircuitBreaker           *BreakerConfig       `json:"circuit_breaker,omitempty"`
+	SizeMetrics              *SizeMetricsConfig   `json:"size_metrics,omitempty"`
+	AccessLog                *AccessLogConfig     `json:"access_log,omitempty"`
+	DebugErrors              bool                 `json:"debug_errors,omitempty"`
+	ErrorResponse            *ErrorResponseConfig `json:"error_response,omitempty"`
+	Debug                    *DebugConfig         `json:"debug,omitempty"`
+	Redis                    *RedisConfig         `json:"redis,omitempty"`
+	Vault                    *VaultConfig         `json:"vault,omitempty"`
+	SecretsDir               *SecretsDirConfig    `json:"secrets_dir,omitempty"`
+	Env                      *EnvConfig           `json:"env,omitempty"`
+	LDAP                     *LDAPConfig          `json:"ldap,omitempty"`
+	TokenExchange            *TokenExchangeConfig `json:"token_exchange,omitempty"`
+	OIDC                     *OIDCConfig          `json:"oidc,omitempty"`
+	ResponseCache            *ResponseCacheConfig `json:"response_cache,omitempty"`
+	Mirror                   *MirrorConfig        `json:"mirror,omitempty"`
+	Enrich                   *EnrichConfig        `json:"enrich,omitempty"`
+	Lookup                   *LookupConfig        `json:"lookup,omitempty"`
+	FeatureFlags             *FeatureFlagsConfig  `json:"feature_flags,omitempty"`
+	RateLimit                *RateLimitConfig     `json:"rate_limit,omitempty"`
+	Idempotency              *IdempotencyConfig   `json:"idempotency,omitempty"`
+	Signing                  *SigningConfig       `json:"signing,omitempty"`
+	GCPIdentity              *GCPIdentityConfig   `json:"gcp_identity,omitempty"`
+	AzureAD                  *AzureADConfig       `json:"azure_ad,omitempty"`
+	URLSigning               *URLSigningConfig    `json:"url_signing,omitempty"`
+	Script                   *ScriptConfig        `json:"script,omitempty"`
+	GRPCWeb                  *GRPCWebConfig       `json:"grpc_web,omitempty"`
+	XFCC                     *XFCCConfig          `json:"xfcc,omitempty"`
+	ClientIP                 *ClientIPConfig      `json:"client_ip,omitempty"`
+	Match                    *MatchConfig         `json:"match,omitempty"`
+	RequestID                *RequestIDConfig     `json:"request_id,omitempty"`
+	DLP                      *DLPConfig           `json:"dlp,omitempty"`
+	OpenAPI                  *OpenAPIConfig       `json:"openapi,omitempty"`
+	Negotiation              *NegotiationConfig   `json:"negotiation,omitempty"`
+	Locale                   *LocaleConfig        `json:"locale,omitempty"`
+	Pagination               *PaginationConfig    `json:"pagination,omitempty"`
+	LinkRewrite              *LinkRewriteConfig   `json:"link_rewrite,omitempty"`
+	Batch                    *BatchConfig         `json:"batch,omitempty"`
+	Notify                   *NotifyConfig        `json:"notify,omitempty"`
+	Tenants                  *TenantConfig        `json:"tenants,omitempty"`
+	Rules                    []*RuleConfig        `json:"rules,omitempty"`
+	RulesMode                string               `json:"rules_mode,omitempty"`
+	StatusMap                map[string]int       `json:"status_map,omitempty"`
+	Reject                   []*RejectConfig      `json:"reject,omitempty"`
+	Retry                    *RetryConfig         `json:"retry,omitempty"`
+	OnError                  *OnErrorConfig       `json:"on_error,omitempty"`
+	DryRun                   bool                 `json:"dry_run,omitempty"`
+	DryRunHeader             string               `json:"dry_run_header,omitempty"`
+	LogLevel                 string               `json:"log_level,omitempty"`
+	LogFormat                string               `json:"log_format,omitempty"`
+	Tracing                  *TracingConfig       `json:"tracing,omitempty"`
+	Audit                    *AuditConfig         `json:"audit,omitempty"`
+	MaskedResponseHeaders    *MaskedHeadersConfig `json:"masked_response_headers,omitempty"`
+	RemoveResponseHeaders    []string             `json:"remove_response_headers,omitempty"`
+	UpstreamDurationHeader   string               `json:"upstream_duration_header,omitempty"`
+	ModifierRequestFile      string               `json:"modifier_request_file,omitempty"`
+	ModifierResponseFiles    map[string]string    `json:"modifier_response_files,omitempty"`
+	TemplateReloadInterval   string               `json:"template_reload_interval,omitempty"`
+	MaxTemplateOutputBytes   int64                `json:"max_template_output_bytes,omitempty"`
+
+	ErrorPages           map[string]*ErrorPageConfig       `json:"error_pages,omitempty"`
+	ModifierResponseWhen map[string][]*ConditionalTemplate `json:"modifier_response_when,omitempty"`
 }
 
 // TemplateContext holds context data for templates
@@ -31,99 +110,1434 @@ func CreateConfig() *Config {
 
 // modifier holds the plugin instance
 type modifier struct {
-	name           string
-	next           http.Handler
-	bodyModifier   *BodyModifier
-	queryModifier  *QueryModifier
-	headerModifier *HeaderModifier
-	context        *TemplateContext
+	name                   string
+	traefik                map[string]interface{}
+	next                   http.Handler
+	matcher                *RequestMatcher
+	bodyModifier           *BodyModifier
+	queryModifier          *QueryModifier
+	headerModifier         *HeaderModifier
+	responseHeaderModifier *HeaderModifier
+	reloader               *templateReloader
+	maxTemplateOutput      int64
+	cookieModifier         *CookieModifier
+	breaker                *CircuitBreaker
+	sizeMetrics            *SizeMetrics
+	accessLog              *AccessLogEnricher
+	errorResponder         *ErrorResponder
+	debugger               *Debugger
+	logger                 *logger
+	tracer                 *Tracer
+	auditor                *Auditor
+	upstreamDurationHeader string
+	secretsDir             *SecretsDirectory
+	vault                  *VaultProvider
+	env                    map[string]string
+	tokenExchanger         *TokenExchanger
+	gcpIdentity            *GCPIdentityProvider
+	responseCache          *ResponseCache
+	mirror                 *Mirror
+	enricher               *Enricher
+	lookups                *Lookups
+	featureFlags           *FeatureFlags
+	rateLimiter            *RateLimiter
+	idempotency            *Idempotency
+	signer                 *RequestSigner
+	script                 *ScriptStage
+	grpcWeb                *GRPCWebBridge
+	xfcc                   *XFCCBuilder
+	clientIP               *ClientIPResolver
+	requestIDs             *RequestIDs
+	dlp                    *DLPScanner
+	openAPI                *OpenAPIValidator
+	negotiator             *Negotiator
+	localizer              *Localizer
+	paginator              *Paginator
+	linkRewriter           *LinkRewriter
+	batch                  *BatchFanOut
+	notifier               *Notifier
+	tenants                *Tenants
+	rules                  *Rules
+	onError                errorPolicy
+	rejecter               *Rejecter
+	retrier                *Retrier
+	statusMap              *StatusMap
+	errorPages             *ErrorPages
+	jwtVerifier            *JWTVerifier
+	dryRun                 bool
+	dryRunHeader           string
 }
 
 // New creates and returns a new modifier plugin instance
 func New(ctx context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
-	// Initialize body modifier
-	bodyModifier := NewBodyModifier(config.ModifierRequest, config.ModifierResponse)
+	// Initialize per-request logging
+	logger, err := newLogger(config.LogLevel, config.LogFormat, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the templates configured as files
+	fileConfig := config
+	config, err = resolveTemplateFiles(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.MaxTemplateOutputBytes < 0 {
+		return nil, errors.New("max_template_output_bytes must not be negative")
+	}
+
+	// Build template function map
+	funcs := pkg.SimpleFuncMap()
+	var redisClient *RedisClient
+	if config.Redis != nil {
+		var err error
+		redisClient, err = NewRedisClient(config.Redis)
+		if err != nil {
+			return nil, err
+		}
+		mergeFuncs(funcs, redisClient.FuncMap())
+	}
+	var vaultProvider *VaultProvider
+	if config.Vault != nil {
+		var err error
+		vaultProvider, err = NewVaultProvider(config.Vault)
+		if err != nil {
+			return nil, err
+		}
+		if err := vaultProvider.Prefetch(); err != nil {
+			return nil, err
+		}
+		mergeFuncs(funcs, vaultProvider.FuncMap())
+	}
+	if config.LDAP != nil {
+		ldapClient, err := NewLDAPClient(config.LDAP)
+		if err != nil {
+			return nil, err
+		}
+		mergeFuncs(funcs, ldapClient.FuncMap())
+	}
+	var lookups *Lookups
+	if config.Lookup != nil {
+		var err error
+		lookups, err = NewLookups(config.Lookup, funcs)
+		if err != nil {
+			return nil, err
+		}
+		mergeFuncs(funcs, lookups.FuncMap())
+	}
+	var jwtVerifier *JWTVerifier
+	if config.OIDC != nil {
+		var err error
+		jwtVerifier, err = NewJWTVerifier(config.OIDC, logger)
+		if err != nil {
+			return nil, err
+		}
+		mergeFuncs(funcs, jwtVerifier.FuncMap())
+	}
+	if config.AzureAD != nil {
+		azureProvider, err := NewAzureADProvider(config.AzureAD)
+		if err != nil {
+			return nil, err
+		}
+		mergeFuncs(funcs, azureProvider.FuncMap())
+	}
+	if config.URLSigning != nil {
+		urlSigner, err := NewURLSigner(config.URLSigning)
+		if err != nil {
+			return nil, err
+		}
+		mergeFuncs(funcs, urlSigner.FuncMap())
+	}
+	var localizer *Localizer
+	if config.Locale != nil {
+		var err error
+		localizer, err = NewLocalizer(config.Locale)
+		if err != nil {
+			return nil, err
+		}
+		mergeFuncs(funcs, localizer.FuncMap())
+	}
+
+	// Initialize mounted secrets directory
+	var secretsDir *SecretsDirectory
+	if config.SecretsDir != nil {
+		var err error
+		secretsDir, err = NewSecretsDirectory(config.SecretsDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize environment variables
+	var env map[string]string
+	if config.Env != nil {
+		var err error
+		env, err = LoadEnv(config.Env)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize token exchange
+	var tokenExchanger *TokenExchanger
+	if config.TokenExchange != nil {
+		var err error
+		tokenExchanger, err = NewTokenExchanger(config.TokenExchange)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize Google ID token injection
+	var gcpIdentity *GCPIdentityProvider
+	if config.GCPIdentity != nil {
+		var err error
+		gcpIdentity, err = NewGCPIdentityProvider(config.GCPIdentity)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize body, header and response header modifiers, shared with
+	// instances configured with the same templates
+	templates, err := sharedTemplates.Modifiers(config, funcs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reload the templates configured as files when they change
+	var reloader *templateReloader
+	if config.TemplateReloadInterval != "" {
+		reloader, err = newTemplateReloader(fileConfig, funcs, templates, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	// Initialize query modifier
 	var queryModifier *QueryModifier
-	if config.ModifierQuery != nil && len(config.ModifierQuery.Transform) > 0 {
-		queryModifier = NewQueryModifier(config.ModifierQuery.Transform)
+	if q := config.ModifierQuery; q != nil && (len(q.Transform) > 0 || len(q.Remove) > 0 || len(q.Allow) > 0) {
+		queryModifier = NewQueryModifierWithFuncs(q.Transform, funcs)
+		if err := queryModifier.SetRemove(q.Remove); err != nil {
+			return nil, err
+		}
+		if err := queryModifier.SetAllow(q.Allow); err != nil {
+			return nil, err
+		}
+		queryModifier.SetPreserveRawQuery(q.PreserveRawQuery)
+		if err := queryModifier.Validate(); err != nil {
+			return nil, err
+		}
 	}
 
-	// Initialize header modifier
-	var headerModifier *HeaderModifier
-	if len(config.ModifierHeader) > 0 {
-		headerModifier = NewHeaderModifier(config.ModifierHeader)
+	// Initialize cookie modifier
+	var cookieModifier *CookieModifier
+	if config.ModifierCookie != nil {
+		var err error
+		cookieModifier, err = NewCookieModifier(config.ModifierCookie, funcs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize bearer token verification
+	if jwtVerifier != nil {
+		if err := jwtVerifier.EnableRequestVerification(config.OIDC, funcs); err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize per-tenant template overlays
+	var tenants *Tenants
+	if config.Tenants != nil {
+		var err error
+		tenants, err = NewTenants(config.Tenants, config, funcs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize rule blocks
+	var rules *Rules
+	if len(config.Rules) > 0 {
+		var err error
+		rules, err = NewRules(config.Rules, config.RulesMode, config, funcs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize plugin error responses
+	errorResponder, err := NewErrorResponder(config.ErrorResponse, config.DebugErrors, funcs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize template debug output
+	var debugger *Debugger
+	if config.Debug != nil {
+		var err error
+		debugger, err = NewDebugger(config.Debug)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize span export
+	var tracer *Tracer
+	if config.Tracing != nil {
+		var err error
+		tracer, err = NewTracer(config.Tracing)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize audit log
+	var auditor *Auditor
+	if config.Audit != nil {
+		var err error
+		auditor, err = NewAuditor(config.Audit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize template error policies
+	onError, err := newErrorPolicy(config.OnError)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize reject rules
+	var rejecter *Rejecter
+	if len(config.Reject) > 0 {
+		var err error
+		rejecter, err = NewRejecter(config.Reject, funcs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize upstream retries
+	var retrier *Retrier
+	if config.Retry != nil {
+		var err error
+		retrier, err = NewRetrier(config.Retry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize upstream status rewriting
+	var statusMap *StatusMap
+	if len(config.StatusMap) > 0 {
+		var err error
+		statusMap, err = NewStatusMap(config.StatusMap)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize upstream error pages
+	var errorPages *ErrorPages
+	if len(config.ErrorPages) > 0 {
+		var err error
+		errorPages, err = NewErrorPages(config.ErrorPages, funcs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize response cache
+	var responseCache *ResponseCache
+	if config.ResponseCache != nil {
+		var err error
+		responseCache, err = NewResponseCache(config.ResponseCache, funcs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize feature flags
+	var featureFlags *FeatureFlags
+	if config.FeatureFlags != nil {
+		var err error
+		featureFlags, err = NewFeatureFlags(config.FeatureFlags)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize rate limit counter
+	var rateLimiter *RateLimiter
+	if config.RateLimit != nil {
+		var err error
+		rateLimiter, err = NewRateLimiter(config.RateLimit, funcs, redisClient)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize Idempotency-Key handling
+	var idempotency *Idempotency
+	if config.Idempotency != nil {
+		var err error
+		idempotency, err = NewIdempotency(config.Idempotency, funcs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize request signing
+	var signer *RequestSigner
+	if config.Signing != nil {
+		var err error
+		signer, err = NewRequestSigner(config.Signing)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize script stage
+	var script *ScriptStage
+	if config.Script != nil {
+		var err error
+		script, err = NewScriptStage(config.Script)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize content negotiation
+	var negotiator *Negotiator
+	if config.Negotiation != nil {
+		var err error
+		negotiator, err = NewNegotiator(config.Negotiation)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize webhook notifications
+	var notifier *Notifier
+	if config.Notify != nil {
+		var err error
+		notifier, err = NewNotifier(config.Notify, funcs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize batch fan-out
+	var batch *BatchFanOut
+	if config.Batch != nil {
+		var err error
+		batch, err = NewBatchFanOut(config.Batch, funcs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize absolute link rewriting
+	var linkRewriter *LinkRewriter
+	if config.LinkRewrite != nil {
+		var err error
+		linkRewriter, err = NewLinkRewriter(config.LinkRewrite)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize pagination translation
+	var paginator *Paginator
+	if config.Pagination != nil {
+		var err error
+		paginator, err = NewPaginator(config.Pagination)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// Initialize template context
-	templateContext := &TemplateContext{}
+	// Initialize OpenAPI validation
+	var openAPI *OpenAPIValidator
+	if config.OpenAPI != nil {
+		var err error
+		openAPI, err = NewOpenAPIValidator(config.OpenAPI)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize DLP response scanning
+	var dlp *DLPScanner
+	if config.DLP != nil {
+		var err error
+		dlp, err = NewDLPScanner(config.DLP, funcs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize request matching
+	var matcher *RequestMatcher
+	if config.Match != nil {
+		var err error
+		matcher, err = NewRequestMatcher(config.Match)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize client IP resolution
+	var clientIP *ClientIPResolver
+	if config.ClientIP != nil {
+		var err error
+		clientIP, err = NewClientIPResolver(config.ClientIP)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize request ID generation
+	var requestIDs *RequestIDs
+	if config.RequestID != nil {
+		var err error
+		requestIDs, err = NewRequestIDs(config.RequestID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize XFCC header construction
+	var xfcc *XFCCBuilder
+	if config.XFCC != nil {
+		var err error
+		xfcc, err = NewXFCCBuilder(config.XFCC)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize gRPC-Web bridge
+	var grpcWeb *GRPCWebBridge
+	if config.GRPCWeb != nil {
+		var err error
+		grpcWeb, err = NewGRPCWebBridge(config.GRPCWeb)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize enrichment subrequest
+	var enricher *Enricher
+	if config.Enrich != nil {
+		var err error
+		enricher, err = NewEnricher(config.Enrich, funcs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize request mirroring
+	var mirror *Mirror
+	if config.Mirror != nil {
+		var err error
+		mirror, err = NewMirror(config.Mirror)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize circuit breaker
+	var breaker *CircuitBreaker
+	if config.CircuitBreaker != nil {
+		var err error
+		breaker, err = NewCircuitBreaker(config.CircuitBreaker)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize size metrics
+	var sizeMetrics *SizeMetrics
+	if config.SizeMetrics != nil {
+		sizeMetrics = NewSizeMetrics(config.SizeMetrics)
+	}
+
+	// Initialize access log enrichment
+	var accessLog *AccessLogEnricher
+	if config.AccessLog != nil {
+		accessLog = NewAccessLogEnricher(config.AccessLog)
+	}
 
 	plugin := &modifier{
-		name:           name,
-		next:           next,
-		bodyModifier:   bodyModifier,
-		queryModifier:  queryModifier,
-		headerModifier: headerModifier,
-		context:        templateContext,
+		name:                   name,
+		traefik:                traefikMetadata(name),
+		next:                   next,
+		matcher:                matcher,
+		bodyModifier:           templates.bodyModifier,
+		queryModifier:          queryModifier,
+		headerModifier:         templates.headerModifier,
+		responseHeaderModifier: templates.responseHeaderModifier,
+		reloader:               reloader,
+		maxTemplateOutput:      config.MaxTemplateOutputBytes,
+		cookieModifier:         cookieModifier,
+		breaker:                breaker,
+		sizeMetrics:            sizeMetrics,
+		accessLog:              accessLog,
+		errorResponder:         errorResponder,
+		debugger:               debugger,
+		logger:                 logger,
+		tracer:                 tracer,
+		auditor:                auditor,
+		upstreamDurationHeader: config.UpstreamDurationHeader,
+		secretsDir:             secretsDir,
+		vault:                  vaultProvider,
+		env:                    env,
+		tokenExchanger:         tokenExchanger,
+		gcpIdentity:            gcpIdentity,
+		responseCache:          responseCache,
+		mirror:                 mirror,
+		enricher:               enricher,
+		lookups:                lookups,
+		featureFlags:           featureFlags,
+		rateLimiter:            rateLimiter,
+		idempotency:            idempotency,
+		signer:                 signer,
+		script:                 script,
+		grpcWeb:                grpcWeb,
+		xfcc:                   xfcc,
+		clientIP:               clientIP,
+		requestIDs:             requestIDs,
+		dlp:                    dlp,
+		openAPI:                openAPI,
+		negotiator:             negotiator,
+		localizer:              localizer,
+		paginator:              paginator,
+		linkRewriter:           linkRewriter,
+		batch:                  batch,
+		notifier:               notifier,
+		tenants:                tenants,
+		rules:                  rules,
+		onError:                onError,
+		rejecter:               rejecter,
+		retrier:                retrier,
+		statusMap:              statusMap,
+		errorPages:             errorPages,
+		jwtVerifier:            jwtVerifier,
+		dryRun:                 config.DryRun,
+		dryRunHeader:           config.DryRunHeader,
 	}
 
 	return plugin, nil
 }
 
+// templateModifiers are the body, header and response header modifiers
+// built from the templates of a configuration
+type templateModifiers struct {
+	bodyModifier           *BodyModifier
+	headerModifier         *HeaderModifier
+	responseHeaderModifier *HeaderModifier
+}
+
+// newTemplateModifiers builds the body, header and response header modifiers
+// of config
+func newTemplateModifiers(config *Config, funcs template.FuncMap) (*templateModifiers, error) {
+	bodyModifier := NewBodyModifierWithFuncs(config.ModifierRequest, config.ModifierResponse, funcs)
+	if err := bodyModifier.SetJq(config.ModifierRequestJq, config.ModifierResponseJq); err != nil {
+		return nil, err
+	}
+	if err := bodyModifier.SetJMESPath(config.ModifierRequestJMESPath, config.ModifierResponseJMESPath); err != nil {
+		return nil, err
+	}
+	if err := bodyModifier.SetResponseConditions(config.ModifierResponseWhen); err != nil {
+		return nil, err
+	}
+	if err := bodyModifier.SetRequestFormat(config.ModifierRequestFormat); err != nil {
+		return nil, err
+	}
+	bodyModifier.SetMaxBuffer(config.MaxBufferBytes)
+	if err := bodyModifier.SetBodyLimits(config.MaxRequestBodyBytes, config.MaxResponseBodyBytes, config.BodyLimitAction, config.BodyLimitResponse); err != nil {
+		return nil, err
+	}
+	bodyModifier.SetStreamContentTypes(config.StreamContentTypes)
+	if err := bodyModifier.SetStreamTemplate(config.ModifierResponseStream); err != nil {
+		return nil, err
+	}
+	bodyModifier.SetMaskedHeaders(maskedHeadersConfig(config))
+	if err := bodyModifier.Validate(); err != nil {
+		return nil, err
+	}
+
+	var headerModifier *HeaderModifier
+	if len(config.ModifierHeader) > 0 {
+		headerModifier = NewHeaderModifierWithFuncs(config.ModifierHeader, funcs)
+		if err := headerModifier.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	var responseHeaderModifier *HeaderModifier
+	if len(config.ModifierResponseHeader) > 0 || len(config.RemoveResponseHeaders) > 0 {
+		responseHeaderModifier = newHeaderModifier("modifier_response_header", config.ModifierResponseHeader, funcs)
+		if err := responseHeaderModifier.Validate(); err != nil {
+			return nil, err
+		}
+		if err := responseHeaderModifier.SetRemove(config.RemoveResponseHeaders); err != nil {
+			return nil, err
+		}
+	}
+
+	return &templateModifiers{
+		bodyModifier:           bodyModifier,
+		headerModifier:         headerModifier,
+		responseHeaderModifier: responseHeaderModifier,
+	}, nil
+}
+
 // ServeHTTP processes the HTTP request and response
 func (m *modifier) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	var err error
 	var originalRequestBody, modifiedRequestBody []byte
 
-	m.context = &TemplateContext{
+	// Drop access log headers sent by the client before anything reads them
+	m.accessLog.strip(req)
+
+	// Serve size metrics endpoint
+	if m.sizeMetrics.IsEndpoint(req) {
+		m.sizeMetrics.ServeHTTP(rw, req)
+		return
+	}
+
+	// Pass requests outside the match conditions through untouched
+	if !m.matcher.Match(req) {
+		m.next.ServeHTTP(rw, req)
+		return
+	}
+
+	// Use the latest templates read from files
+	if templates := m.reloader.Templates(); templates != nil {
+		tm := *m
+		tm.bodyModifier = templates.bodyModifier
+		tm.headerModifier = templates.headerModifier
+		tm.responseHeaderModifier = templates.responseHeaderModifier
+		m = &tm
+	}
+
+	// Report the modifications without applying them
+	if m.dryRun {
+		m.serveDryRun(rw, req)
+		return
+	}
+
+	// Template context of this request; m is shared by concurrent requests
+	ctx := &TemplateContext{
 		"unixtime": time.Now().UnixNano(),
 	}
+	ctx.setOutputLimit(m.maxTemplateOutput)
+	logs := m.logger.forRequest(ctx)
+	if m.requestIDs != nil {
+		requestID, err := m.requestIDs.ModifyRequest(rw, req)
+		if err != nil {
+			logs.errorf("request_id", outcomeContinued, "Request ID error: %v", err)
+		} else {
+			(*ctx)["requestID"] = requestID
+		}
+	}
+	errs := m.errorResponder.forRequest(ctx)
+	if m.debugger.Triggered(req) {
+		rw = m.debugger.ResponseWriter(rw, ctx)
+	}
+	trace := m.tracer.Start(req, ctx, m.name)
+	defer trace.finish()
+	var audit *auditEntry
+	audit, rw = m.auditor.Start(rw, req, ctx, m.name)
+	defer audit.finish()
+	ctx.SetGlobal("traefik", m.traefik)
+	ctx.SetRequestField("clientIP", m.clientIP.Resolve(req))
+	ctx.SetRequestField("cookies", requestCookies(req))
+	if tls := requestTLS(req); tls != nil {
+		ctx.SetRequestField("tls", tls)
+	}
+	if m.secretsDir != nil {
+		ctx.SetGlobal("secrets", m.secretsDir.Values())
+	}
+	if m.env != nil {
+		ctx.SetGlobal("env", m.env)
+	}
+	if m.vault != nil && len(m.vault.preload) > 0 {
+		ctx.SetGlobal("vault", m.vault.Values())
+	}
+	if m.featureFlags != nil {
+		ctx.SetGlobal("flags", m.featureFlags.Values())
+	}
+	var jwtErr error
+	jwt := requestJWT(req)
+	if m.jwtVerifier != nil && m.jwtVerifier.verifyRequests {
+		if jwt == nil {
+			jwt = map[string]interface{}{}
+		}
+		jwtErr = m.jwtVerifier.VerifyRequest(req)
+		jwt["valid"] = jwtErr == nil
+		if jwtErr != nil {
+			jwt["error"] = jwtErr.Error()
+		}
+	}
+	if jwt != nil {
+		ctx.SetRequestField("jwt", jwt)
+	}
+	var locale string
+	if m.localizer != nil {
+		locale = m.localizer.Resolve(req)
+		ctx.SetRequestField("locale", locale)
+	}
+
+	// Record modifier behavior for the access log
+	record := m.accessLog.newRecord()
+	defer m.accessLog.apply(req, m.name, record)
+
+	// Reject requests whose bearer token failed verification
+	if jwtErr != nil && m.jwtVerifier.rejectInvalid {
+		logs.warnf("oidc", outcomeRejected, "JWT verification failed: %v", jwtErr)
+		record.flag("jwt:invalid")
+		m.jwtVerifier.WriteUnauthorized(rw, req, jwtErr, ctx, errs)
+		return
+	}
+
+	// Stop requests matching a reject rule at the edge
+	if m.rejecter != nil {
+		limit, _ := m.bodyModifier.requestLimit()
+		rejected, failed := m.rejecter.Check(rw, req, ctx, limit, errs)
+		for _, name := range failed {
+			record.flag("reject:" + name + ":error")
+		}
+		if rejected != "" {
+			record.flag("reject:" + rejected)
+			return
+		}
+	}
+
+	// Swap in the header, query and body modifiers of the matching rules
+	if m.rules != nil {
+		names, overlay, err := m.rules.Resolve(req)
+		if err != nil {
+			logs.warnf("rules", outcomeContinued, "Rule resolution error: %v", err)
+		} else if overlay != nil {
+			tm := *m
+			tm.bodyModifier = overlay.bodyModifier
+			tm.queryModifier = overlay.queryModifier
+			tm.headerModifier = overlay.headerModifier
+			m = &tm
+			for _, name := range names {
+				record.flag("rule:" + name)
+			}
+		}
+	}
+
+	// Swap in the tenant's header, query and body modifiers
+	if m.tenants != nil {
+		tenant, overlay, err := m.tenants.Resolve(req, ctx)
+		if err != nil {
+			logs.warnf("tenants", outcomeContinued, "Tenant resolution error: %v", err)
+		} else if tenant != "" {
+			ctx.SetRequestField("tenant", tenant)
+			if overlay != nil {
+				tm := *m
+				tm.bodyModifier = overlay.bodyModifier
+				tm.queryModifier = overlay.queryModifier
+				tm.headerModifier = overlay.headerModifier
+				m = &tm
+				record.flag("tenant:" + tenant)
+			}
+		}
+	}
+
+	// Reject inbound requests with invalid, stale or replayed signatures
+	if m.signer != nil && m.signer.mode == signingModeVerify {
+		if err := m.signer.Verify(req); err != nil {
+			logs.warnf("signing", outcomeRejected, "Signature verification failed: %v", err)
+			record.flag("signature:invalid")
+			status := http.StatusUnauthorized
+			if errors.Is(err, errBodyOverLimit) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			errs.write(rw, status, "Signature verification failed", err)
+			return
+		}
+	}
+
+	// Forward the client certificate to the upstream
+	if m.xfcc != nil {
+		m.xfcc.ModifyRequest(req)
+	}
+
+	// Capture the original request for mirroring
+	var mirrorRequest *mirrorRequest
+	mirrorSampled := m.mirror.sample()
+	if mirrorSampled && m.mirror.source == mirrorOriginal {
+		mirrorRequest = m.mirror.snapshot(req)
+		if mirrorRequest == nil {
+			mirrorSampled = false
+			record.flag("mirror:skipped")
+		}
+	}
+
+	// Exchange the incoming bearer token for a downstream token
+	if m.tokenExchanger != nil {
+		if err := m.tokenExchanger.ModifyRequest(req); err != nil {
+			if m.tokenExchanger.config.FailOpen {
+				logs.errorf("token_exchange", outcomeContinued, "Token exchange error: %v", err)
+			} else {
+				logs.errorf("token_exchange", outcomeRejected, "Token exchange error: %v", err)
+				errs.write(rw, http.StatusUnauthorized, "Token exchange error", err)
+				return
+			}
+		}
+	}
+
+	// Inject a Google-signed ID token for the upstream
+	if m.gcpIdentity != nil {
+		if err := m.gcpIdentity.ModifyRequest(req); err != nil {
+			logs.errorf("gcp_identity", outcomeRejected, "GCP identity token error: %v", err)
+			errs.write(rw, http.StatusBadGateway, "Identity token error", err)
+			return
+		}
+	}
+
+	// Propagate the Idempotency-Key and replay duplicate requests
+	if m.idempotency != nil {
+		key, fingerprint, err := m.idempotency.Key(req, ctx)
+		if err != nil {
+			logs.warnf("idempotency", outcomeContinued, "Idempotency key error: %v", err)
+		} else if key != "" && m.idempotency.Deduplicates() {
+			replay, conflict := m.idempotency.Begin(key, fingerprint)
+			if conflict != 0 {
+				record.flag("idempotency:conflict")
+				errs.write(rw, conflict, http.StatusText(conflict), nil)
+				return
+			}
+			if replay != nil {
+				record.flag("idempotency:replay")
+				m.idempotency.Replay(rw, replay)
+				return
+			}
+			recorder := &cacheRecorder{ResponseWriter: rw}
+			defer m.idempotency.Finish(key, recorder)
+			rw = recorder
+		}
+	}
+
+	// Count the request against its rate limit key
+	if m.rateLimiter != nil {
+		quota, err := m.rateLimiter.Count(req, ctx)
+		if err != nil {
+			logs.errorf("rate_limit", outcomeContinued, "Rate limit counter error: %v", err)
+			record.flag("ratelimit:error")
+		} else if quota != nil {
+			ctx.SetGlobal("ratelimit", quota)
+		}
+	}
+
+	// Resolve enrichment data before templating
+	if m.enricher != nil {
+		result, err := m.enricher.Fetch(req, ctx)
+		if err != nil {
+			logs.errorf("enrich", outcomeContinued, "Enrich error: %v", err)
+			record.flag("enrich:error")
+		} else {
+			ctx.SetGlobal("enrich", result)
+		}
+	}
+
+	// Resolve per-request lookups before templating
+	if m.lookups != nil {
+		results, failed := m.lookups.Resolve(req, ctx)
+		for _, name := range failed {
+			record.flag("lookup:" + name + ":error")
+		}
+		if results != nil {
+			ctx.SetGlobal("lookup", results)
+		}
+	}
 
 	// Handle header modification
 	if m.headerModifier != nil {
-		if err := m.headerModifier.ModifyHeaders(req, m.context); err != nil {
-			log.Printf("Header modification error: %v", err)
+		if m.breaker.Allow(phaseHeader) {
+			beforeHeaders, _ := record.snapshot(req)
+			var originalHeaders http.Header
+			if m.onError[phaseHeader] == onErrorUseOriginal {
+				originalHeaders = req.Header.Clone()
+			}
+			span := trace.startSpan(phaseHeader)
+			err := m.headerModifier.ModifyHeaders(req, ctx)
+			span.finish(err)
+			m.breaker.Record(phaseHeader, err != nil)
+			if err != nil {
+				logs.warnf(phaseHeader, policyOutcome(m.onError[phaseHeader]), "Header modification error: %v", err)
+				if m.onError.handle(rw, phaseHeader, http.StatusInternalServerError, "Header modification error", err, errs, func() {
+					replaceHeader(req.Header, originalHeaders)
+				}) {
+					return
+				}
+			}
+			record.diffHeaders(beforeHeaders, req.Header, m.headerModifier.templates)
+		} else {
+			record.flag("bypass:" + phaseHeader)
+		}
+	}
+
+	// Handle request cookie modification
+	if m.cookieModifier != nil {
+		originalCookies, hadCookies := req.Header["Cookie"]
+		if err := m.cookieModifier.ModifyCookies(req, ctx); err != nil {
+			logs.warnf(phaseCookie, policyOutcome(m.onError[phaseCookie]), "Cookie modification error: %v", err)
+			if m.onError.handle(rw, phaseCookie, http.StatusInternalServerError, "Cookie modification error", err, errs, func() {
+				req.Header.Del("Cookie")
+				if hadCookies {
+					req.Header["Cookie"] = originalCookies
+				}
+			}) {
+				return
+			}
 		}
 	}
 
 	// Handle query parameter modification
 	if m.queryModifier != nil {
-		if err := m.queryModifier.ModifyQueryWithContext(req, m.context); err != nil {
-			log.Printf("Query modification error: %v", err)
+		if m.breaker.Allow(phaseQuery) {
+			_, beforeQuery := record.snapshot(req)
+			rawQuery, requestURI := req.URL.RawQuery, req.RequestURI
+			span := trace.startSpan(phaseQuery)
+			err := m.queryModifier.ModifyQueryWithContext(req, ctx)
+			span.finish(err)
+			m.breaker.Record(phaseQuery, err != nil)
+			if err != nil {
+				logs.warnf(phaseQuery, policyOutcome(m.onError[phaseQuery]), "Query modification error: %v", err)
+				if m.onError.handle(rw, phaseQuery, http.StatusInternalServerError, "Query modification error", err, errs, func() {
+					req.URL.RawQuery, req.RequestURI = rawQuery, requestURI
+				}) {
+					return
+				}
+			}
+			if record != nil {
+				record.diffQuery(beforeQuery, req.URL.Query(), m.queryModifier.transforms)
+			}
+		} else {
+			record.flag("bypass:" + phaseQuery)
+		}
+	}
+
+	// Notify webhooks once the response has been served
+	if m.notifier != nil {
+		nw := m.notifier.ResponseWriter(rw)
+		defer func() {
+			requestBody := modifiedRequestBody
+			if requestBody == nil {
+				requestBody = originalRequestBody
+			}
+			queued, err := m.notifier.Finish(nw, req, requestBody, ctx)
+			if err != nil {
+				logs.errorf("notify", outcomeContinued, "Notify error: %v", err)
+				record.flag("notify:error")
+			} else if !queued {
+				record.flag("notify:dropped")
+			}
+		}()
+		rw = nw
+	}
+
+	// Translate pagination parameters to the upstream style
+	var page *pageRequest
+	if m.paginator != nil {
+		page, err = m.paginator.ModifyRequest(req)
+		if err != nil {
+			logs.warnf("pagination", outcomeRejected, "Pagination request error: %v", err)
+			errs.write(rw, http.StatusBadRequest, "Pagination request error", err)
+			return
+		}
+	}
+
+	// Convert the final response to the format the client accepts
+	if m.negotiator != nil {
+		if nw := m.negotiator.ResponseWriter(rw, req); nw != nil {
+			defer func() {
+				if err := m.negotiator.Finish(nw); err != nil {
+					logs.errorf("negotiation", outcomeContinued, "Content negotiation error: %v", err)
+					record.flag("negotiation:error")
+				}
+			}()
+			rw = nw
+		}
+	}
+
+	// Collapse multilingual values to the caller's locale
+	if m.localizer != nil {
+		if lw := m.localizer.ResponseWriter(rw, locale); lw != nil {
+			defer m.localizer.Finish(lw)
+			rw = lw
+		}
+	}
+
+	// Rewrite upstream links to the public gateway address, asking the
+	// upstream only for encodings the rewriter can decode
+	if m.linkRewriter != nil {
+		limitAcceptEncoding(req)
+		lw := m.linkRewriter.ResponseWriter(rw, req)
+		defer func() {
+			if m.linkRewriter.Finish(lw) {
+				record.flag("link-rewrite")
+			}
+		}()
+		rw = lw
+	}
+
+	// Serve cached responses, recording misses for later requests
+	if m.responseCache != nil {
+		cacheKey, err := m.responseCache.Key(req, ctx)
+		if err != nil {
+			logs.errorf("response_cache", outcomeContinued, "Response cache key error: %v", err)
+		} else if cacheKey != "" {
+			if m.responseCache.Serve(rw, req, cacheKey) {
+				record.flag("cache:hit")
+				return
+			}
+			recorder := m.responseCache.Recorder(rw, req)
+			defer m.responseCache.Store(cacheKey, recorder)
+			rw = recorder
+		}
+	}
+
+	// Scan the final response for sensitive data, which must be encoded in a
+	// way the scanner can decode
+	if m.dlp != nil {
+		limitAcceptEncoding(req)
+		dw := m.dlp.ResponseWriter(rw)
+		defer func() {
+			fired, err := m.dlp.Finish(dw, req, ctx)
+			if err != nil {
+				logs.errorf("dlp", outcomeContinued, "DLP scan error: %v", err)
+				record.flag("dlp:error")
+			}
+			for _, name := range fired {
+				record.flag("dlp:" + name)
+			}
+		}()
+		rw = dw
+	}
+
+	// Buffer the final response for the response script
+	if m.script != nil {
+		if sw := m.script.ResponseWriter(rw); sw != nil {
+			defer func() {
+				if err := m.script.Finish(sw, req, ctx); err != nil {
+					logs.errorf("script", outcomeContinued, "Response script error: %v", err)
+					record.flag("script:error")
+				}
+			}()
+			rw = sw
 		}
 	}
 
 	// Handle request body masking
-	if m.bodyModifier != nil {
-		originalRequestBody, modifiedRequestBody, err = m.bodyModifier.ModifyRequestBodyWithContext(req, m.context)
+	if m.bodyModifier != nil && m.bodyModifier.HasRequestTransform() && !m.breaker.Allow(phaseRequest) {
+		record.flag("bypass:" + phaseRequest)
+	} else if m.bodyModifier != nil {
+		span := trace.startSpan(phaseRequest)
+		originalRequestBody, modifiedRequestBody, err = m.bodyModifier.ModifyRequestBodyWithContext(req, ctx)
+		span.set("request.body.size", len(originalRequestBody))
+		if modifiedRequestBody != nil {
+			span.set("request.body.modified_size", len(modifiedRequestBody))
+		}
+		switch {
+		case errors.Is(err, errBodyStreamed):
+			record.flag("stream:" + phaseRequest)
+			err = nil
+		case errors.Is(err, errBodyTruncated):
+			record.flag("truncate:" + phaseRequest)
+			err = nil
+		case errors.Is(err, errBodyTooLarge):
+			record.flag("limit:" + phaseRequest)
+			span.finish(err)
+			m.bodyModifier.WriteBodyLimit(rw, req, phaseRequest, ctx, errs)
+			return
+		}
+		span.finish(err)
+		if m.bodyModifier.HasRequestTransform() {
+			m.breaker.Record(phaseRequest, err != nil)
+		}
 		if err != nil {
-			http.Error(rw, fmt.Sprintf("Request masking error: %v", err), http.StatusBadRequest)
+			// The original body is forwarded unless the request is rejected
+			logs.errorf(phaseRequest, policyOutcome(m.onError[phaseRequest]), "Request modification error: %v", err)
+			if m.onError.handle(rw, phaseRequest, http.StatusBadRequest, "Request masking error", err, errs, nil) {
+				return
+			}
+		}
+		if modifiedRequestBody != nil {
+			m.sizeMetrics.RecordRequest(len(originalRequestBody), len(modifiedRequestBody))
+			record.fired(phaseRequest)
+			record.flag(phaseRequest)
+		}
+	}
+
+	// Run the request script
+	if m.script != nil {
+		if err := m.script.ModifyRequest(req, ctx); err != nil {
+			logs.errorf("script", outcomeRejected, "Request script error: %v", err)
+			errs.write(rw, http.StatusInternalServerError, "Request script error", err)
+			return
+		}
+	}
+
+	// Validate the final request against the documented operation
+	var openAPIOperation *openAPIOperation
+	if m.openAPI != nil {
+		if openAPIOperation = m.openAPI.Match(req); openAPIOperation != nil {
+			validationErrs, err := m.openAPI.ModifyRequest(req, openAPIOperation)
+			if err != nil {
+				logs.warnf("openapi", outcomeRejected, "OpenAPI request error: %v", err)
+				errs.write(rw, http.StatusBadRequest, "OpenAPI request error", err)
+				return
+			}
+			if len(validationErrs) > 0 {
+				logValidationErrors(logs, "request", outcomeRejected, openAPIOperation, validationErrs)
+				record.flag("openapi:request-invalid")
+				writeValidationError(rw, http.StatusBadRequest, "Request validation failed", validationErrs)
+				return
+			}
+		}
+	}
+
+	// Trace and audit each upstream call, then retry transient upstream
+	// failures with a fresh copy of the final body
+	upstream := audit.Handler(trace.Handler(m.next))
+	if m.retrier != nil {
+		limit, _ := m.bodyModifier.requestLimit()
+		upstream = m.retrier.Handler(upstream, limit, func(retries int) {
+			record.flag(fmt.Sprintf("retry:%d", retries))
+		})
+	}
+
+	// Bridge JSON requests to gRPC-Web upstreams
+	if m.grpcWeb != nil {
+		method, err := m.grpcWeb.ModifyRequest(req)
+		if err != nil {
+			logs.warnf("grpc_web", outcomeRejected, "gRPC-Web request error: %v", err)
+			errs.write(rw, http.StatusBadRequest, "gRPC-Web request error", err)
+			return
+		}
+		if method != nil {
+			upstream = m.grpcWeb.Handler(upstream, method, errs)
+			record.flag("grpc-web")
+		}
+	}
+
+	// Validate and strip the upstream response before response templates
+	if openAPIOperation != nil && (m.openAPI.validateResponse || m.openAPI.stripUnknown) {
+		upstream = m.openAPI.Handler(upstream, openAPIOperation, func(errs []string) {
+			logValidationErrors(logs, "response", "", openAPIOperation, errs)
+			record.flag("openapi:response-invalid")
+		})
+	}
+
+	// Fan out JSON array requests, one upstream call per item
+	if m.batch != nil {
+		limit, _ := m.bodyModifier.requestLimit()
+		upstream = m.batch.Handler(upstream, limit, ctx, errs, func(items int) {
+			record.flag(fmt.Sprintf("batch:%d", items))
+		})
+	}
+
+	// Measure the time spent in the upstream for templates and audit logs
+	upstream = timeUpstream(upstream, ctx, m.upstreamDurationHeader)
+
+	// Normalize the upstream pagination envelope
+	if page != nil {
+		upstream = m.paginator.Handler(upstream, page)
+		record.flag("pagination")
+	}
+
+	// Modify the upstream response headers
+	if m.responseHeaderModifier != nil {
+		upstream = m.responseHeaderModifier.ResponseHandler(upstream, ctx)
+	}
+
+	// Sign the final request for the upstream
+	if m.signer != nil && m.signer.mode == signingModeSign {
+		if err := m.signer.Sign(req); err != nil {
+			logs.errorf("signing", outcomeRejected, "Request signing error: %v", err)
+			status := http.StatusInternalServerError
+			if errors.Is(err, errBodyOverLimit) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			errs.write(rw, status, "Request signing error", err)
 			return
 		}
+		record.flag("signed")
+	}
+
+	// Mirror the request to the shadow endpoint
+	if mirrorSampled {
+		if mirrorRequest == nil {
+			mirrorRequest = m.mirror.snapshot(req)
+		}
+		if mirrorRequest != nil {
+			m.mirror.send(mirrorRequest)
+			record.flag("mirror")
+		} else {
+			record.flag("mirror:skipped")
+		}
+	}
+
+	// Rewrite the upstream status written to the client; response templates
+	// still select on the upstream status
+	if m.statusMap != nil {
+		rw = m.statusMap.ResponseWriter(rw, func(from, to int) {
+			record.flag(fmt.Sprintf("status:%d->%d", from, to))
+		})
+	}
+
+	// Replace upstream error bodies with the configured error pages, before
+	// the status is rewritten
+	if m.errorPages != nil {
+		rw = m.errorPages.ResponseWriter(rw, req, ctx, errs, func(key string) {
+			record.flag("error-page:" + key)
+		})
 	}
 
 	// Handle response masking if configured
-	if m.bodyModifier != nil && len(m.bodyModifier.templateResponse) > 0 {
-		m.handleResponseMasking(rw, req, originalRequestBody, modifiedRequestBody)
-		return
+	if m.bodyModifier != nil && m.bodyModifier.HasResponseTransforms() {
+		if m.breaker.Allow(phaseResponse) {
+			m.handleResponseMasking(upstream, rw, req, originalRequestBody, modifiedRequestBody, ctx, record)
+			return
+		}
+		record.flag("bypass:" + phaseResponse)
 	}
 
 	// No response masking, proceed normally
-	m.next.ServeHTTP(rw, req)
+	if m.sizeMetrics != nil && m.sizeMetrics.debugHeader != "" && modifiedRequestBody != nil {
+		rw.Header().Set(m.sizeMetrics.debugHeader, formatSizeDelta("request", len(originalRequestBody), len(modifiedRequestBody)))
+	}
+	upstream.ServeHTTP(rw, req)
 }
 
 // handleResponseMasking handles response body modification
-func (m *modifier) handleResponseMasking(rw http.ResponseWriter, req *http.Request, originalRequestBody, modifiedRequestBody []byte) {
+func (m *modifier) handleResponseMasking(next http.Handler, rw http.ResponseWriter, req *http.Request, originalRequestBody, modifiedRequestBody []byte, ctx *TemplateContext, record *accessLogRecord) {
+	logs := requestLog(ctx)
+	errs := m.errorResponder.forRequest(ctx)
+
+	// Only ask the upstream for encodings the response templates can decode
+	limitAcceptEncoding(req)
+
 	// Create a response writer to capture the response
 	captureWriter := NewResponseWriter(rw)
+	defer captureWriter.release()
+	captureWriter.maxBuffer, captureWriter.limitAction = m.bodyModifier.responseLimit()
+	captureWriter.streamTypes = m.bodyModifier.streamTypes
+	captureWriter.request = req
+	captureWriter.ownHeaders = headerNameSet(rw.Header())
+	captureWriter.hasTemplate = func(status int) bool {
+		_, _, exists := m.bodyModifier.ResponseTemplate(status, captureWriter.Header().Get("Content-Type"), req.URL.Path)
+		return exists
+	}
+	captureWriter.streamLines = func() *streamLines {
+		return m.bodyModifier.streamLines(captureWriter, ctx)
+	}
 
 	// Call next handler
-	m.next.ServeHTTP(captureWriter, req)
+	next.ServeHTTP(captureWriter, req)
+
+	// Hijacked connections and streamed responses already reached the client
+	if captureWriter.Hijacked() {
+		record.flag("hijacked")
+		return
+	}
+	if lines := captureWriter.lines; lines != nil {
+		lines.finish(rw)
+		record.flag("stream-lines:" + phaseResponse)
+		if lines.err != nil {
+			logs.errorf(phaseResponse, outcomeContinued, "Response stream template error, %d lines dropped: %v", lines.dropped, lines.err)
+			record.flag("stream-lines:dropped")
+		}
+		return
+	}
+	if captureWriter.Streaming() {
+		if _, _, exists := m.bodyModifier.capturedTemplate(captureWriter); exists {
+			record.flag("stream:" + phaseResponse)
+		}
+		return
+	}
+	if captureWriter.Overflowed() {
+		if captureWriter.limitAction == bodyLimitReject {
+			record.flag("limit:" + phaseResponse)
+			m.bodyModifier.WriteBodyLimit(rw, req, phaseResponse, ctx, errs)
+			return
+		}
+		record.flag("truncate:" + phaseResponse)
+	}
+
+	// Track sizes of the response written to the client
+	var outputWriter http.ResponseWriter = rw
+	var sw *sizeWriter
+	if m.sizeMetrics != nil {
+		sw = &sizeWriter{
+			ResponseWriter:   rw,
+			metrics:          m.sizeMetrics,
+			originalResponse: len(captureWriter.GetBody()),
+		}
+		if modifiedRequestBody != nil {
+			sw.requestSizes = formatSizeDelta("request", len(originalRequestBody), len(modifiedRequestBody))
+		}
+		outputWriter = sw
+	}
+
+	// Select the template before it replaces the upstream Content-Type
+	responseKey, _, templated := m.bodyModifier.capturedTemplate(captureWriter)
 
 	// Use body modifier to handle response modification with context
-	if err := m.bodyModifier.ModifyResponseWithContext(rw, captureWriter, originalRequestBody, modifiedRequestBody, m.context); err != nil {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
+	span := requestTracing(ctx).startSpan(phaseResponse)
+	span.set("response.body.size", len(captureWriter.GetBody()))
+	err := m.bodyModifier.ModifyResponseWithContext(outputWriter, captureWriter, originalRequestBody, modifiedRequestBody, ctx)
+	switch {
+	case errors.Is(err, errBodyStreamed):
+		span.finish(nil)
+		record.flag("stream:" + phaseResponse)
 		return
+	case errors.Is(err, errBodyTooLarge):
+		span.finish(err)
+		record.flag("limit:" + phaseResponse)
+		m.bodyModifier.WriteBodyLimit(rw, req, phaseResponse, ctx, errs)
+		return
+	}
+	span.finish(err)
+	m.breaker.Record(phaseResponse, err != nil)
+	if err != nil {
+		logs.errorf(phaseResponse, policyOutcome(m.onError[phaseResponse]), "Response modification error: %v", err)
+		if m.onError[phaseResponse] == onErrorReject {
+			errs.write(rw, http.StatusInternalServerError, "Response masking error", err)
+			return
+		}
+		// Forward the upstream response unmodified
+		outputWriter.WriteHeader(captureWriter.GetStatusCode())
+		outputWriter.Write(captureWriter.GetBody())
+		record.flag("original:" + phaseResponse)
+		return
+	}
+
+	if sw != nil {
+		m.sizeMetrics.RecordResponse(sw.originalResponse, sw.written)
+	}
+
+	if templated {
+		record.fired(fmt.Sprintf("%s:%s", phaseResponse, responseKey))
+		record.flag(phaseResponse)
+	}
+}
+
+// mergeFuncs adds the given template functions to funcs
+func mergeFuncs(funcs template.FuncMap, extra template.FuncMap) {
+	for name, fn := range extra {
+		funcs[name] = fn
 	}
 }
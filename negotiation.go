@@ -0,0 +1,337 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Negotiated response formats
+const (
+	formatJSON = "json"
+	formatXML  = "xml"
+)
+
+// NegotiationConfig holds the content negotiation configuration
+type NegotiationConfig struct {
+	RootElement string `json:"root_element,omitempty"`
+	ItemElement string `json:"item_element,omitempty"`
+}
+
+// Negotiator converts the final response between JSON and XML according to
+// the Accept header of the request
+type Negotiator struct {
+	rootElement string
+	itemElement string
+}
+
+// negotiationResponseWriter buffers the response for conversion
+type negotiationResponseWriter struct {
+	http.ResponseWriter
+	target string
+	status int
+	body   bytes.Buffer
+}
+
+// NewNegotiator creates a new content negotiator
+func NewNegotiator(config *NegotiationConfig) (*Negotiator, error) {
+	n := &Negotiator{
+		rootElement: config.RootElement,
+		itemElement: config.ItemElement,
+	}
+	if n.rootElement == "" {
+		n.rootElement = "response"
+	}
+	if n.itemElement == "" {
+		n.itemElement = "item"
+	}
+	if xmlName(n.rootElement) != n.rootElement || xmlName(n.itemElement) != n.itemElement {
+		return nil, errors.New("negotiation root_element and item_element must be valid XML names")
+	}
+	return n, nil
+}
+
+// ResponseWriter wraps rw when the client prefers JSON or XML, returning nil
+// when the Accept header does not ask for a specific format
+func (n *Negotiator) ResponseWriter(rw http.ResponseWriter, req *http.Request) *negotiationResponseWriter {
+	rw.Header().Add("Vary", "Accept")
+	target := preferredFormat(req.Header.Get("Accept"))
+	if target == "" {
+		return nil
+	}
+	return &negotiationResponseWriter{ResponseWriter: rw, target: target}
+}
+
+// Finish converts the buffered response to the preferred format. Responses
+// already in that format, or in neither format, are written unchanged.
+func (n *Negotiator) Finish(nw *negotiationResponseWriter) error {
+	status := nw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	header := nw.ResponseWriter.Header()
+	body := nw.body.Bytes()
+
+	source := responseFormat(header.Get("Content-Type"))
+	if source == "" || source == nw.target || header.Get("Content-Encoding") != "" || len(body) == 0 {
+		nw.ResponseWriter.WriteHeader(status)
+		nw.ResponseWriter.Write(body)
+		return nil
+	}
+
+	var converted []byte
+	var contentType string
+	var err error
+	if nw.target == formatXML {
+		converted, err = n.jsonToXML(body)
+		contentType = "application/xml; charset=utf-8"
+	} else {
+		converted, err = xmlToJSON(body)
+		contentType = "application/json"
+	}
+	if err != nil {
+		nw.ResponseWriter.WriteHeader(status)
+		nw.ResponseWriter.Write(body)
+		return err
+	}
+
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Length", strconv.Itoa(len(converted)))
+	nw.ResponseWriter.WriteHeader(status)
+	nw.ResponseWriter.Write(converted)
+	return nil
+}
+
+// preferredFormat returns the format with the highest quality in accept
+func preferredFormat(accept string) string {
+	best, bestQuality := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if format := responseFormat(mediaType); format != "" && quality > bestQuality {
+			best, bestQuality = format, quality
+		}
+	}
+	return best
+}
+
+// responseFormat classifies a content type as JSON or XML
+func responseFormat(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return formatJSON
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return formatXML
+	}
+	return ""
+}
+
+// jsonToXML converts a JSON document to XML, keeping the key order. Arrays
+// inside objects become repeated elements of their key; top-level and nested
+// arrays wrap their values in item elements.
+func (n *Negotiator) jsonToXML(body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+
+	token, err := decoder.Token()
+	if err == nil {
+		err = n.encodeJSONValue(decoder, encoder, token, n.rootElement)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert JSON to XML: %w", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("failed to convert JSON to XML: trailing data")
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeJSONValue writes the JSON value starting with token as element name
+func (n *Negotiator) encodeJSONValue(decoder *json.Decoder, encoder *xml.Encoder, token json.Token, name string) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch value := token.(type) {
+	case json.Delim:
+		if value == '[' {
+			if err := n.encodeJSONItems(decoder, encoder, n.itemElement); err != nil {
+				return err
+			}
+			break
+		}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+			name := xmlName(key.(string))
+			next, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+			if delim, ok := next.(json.Delim); ok && delim == '[' {
+				err = n.encodeJSONItems(decoder, encoder, name)
+			} else {
+				err = n.encodeJSONValue(decoder, encoder, next, name)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+	case nil:
+	default:
+		if err := encoder.EncodeToken(xml.CharData(fmt.Sprint(value))); err != nil {
+			return err
+		}
+	}
+
+	return encoder.EncodeToken(start.End())
+}
+
+// encodeJSONItems writes the remaining items of an array as elements name
+func (n *Negotiator) encodeJSONItems(decoder *json.Decoder, encoder *xml.Encoder, name string) error {
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if err := n.encodeJSONValue(decoder, encoder, token, name); err != nil {
+			return err
+		}
+	}
+	_, err := decoder.Token()
+	return err
+}
+
+// xmlName turns a JSON key into a valid XML element name
+func xmlName(key string) string {
+	if key == "" {
+		return "_"
+	}
+	var b strings.Builder
+	for i, r := range key {
+		valid := r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r > 0x7f
+		if i > 0 {
+			valid = valid || r == '-' || r == '.' || r >= '0' && r <= '9'
+		}
+		if !valid {
+			if i == 0 && r >= '0' && r <= '9' {
+				b.WriteRune('_')
+				b.WriteRune(r)
+				continue
+			}
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// xmlToJSON converts an XML document to JSON. The root element is unwrapped,
+// attributes become "@name" keys, repeated elements become arrays and text
+// next to child elements or attributes is stored under "#text".
+func xmlToJSON(body []byte) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert XML to JSON: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			value, err := decodeXMLElement(decoder, start)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert XML to JSON: %w", err)
+			}
+			return json.Marshal(value)
+		}
+	}
+}
+
+// decodeXMLElement converts the content of start into a JSON value
+func decodeXMLElement(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	object := make(map[string]interface{})
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		object["@"+attr.Name.Local] = attr.Value
+	}
+
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			child, err := decodeXMLElement(decoder, t)
+			if err != nil {
+				return nil, err
+			}
+			// Element values are strings or objects, so a list means the
+			// element was repeated before
+			name := t.Name.Local
+			switch existing := object[name].(type) {
+			case nil:
+				object[name] = child
+			case []interface{}:
+				object[name] = append(existing, child)
+			default:
+				object[name] = []interface{}{existing, child}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			content := strings.TrimSpace(text.String())
+			if len(object) == 0 {
+				return content, nil
+			}
+			if content != "" {
+				object["#text"] = content
+			}
+			return object, nil
+		}
+	}
+}
+
+func (nw *negotiationResponseWriter) WriteHeader(statusCode int) {
+	if nw.status == 0 {
+		nw.status = statusCode
+	}
+}
+
+func (nw *negotiationResponseWriter) Write(b []byte) (int, error) {
+	if nw.status == 0 {
+		nw.status = http.StatusOK
+	}
+	return nw.body.Write(b)
+}
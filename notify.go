@@ -0,0 +1,249 @@
+package traefik_modifier_plugin
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"text/template"
+	"time"
+)
+
+// maxNotifyBody is the largest response body captured for notifications
+const maxNotifyBody = 1 << 20
+
+// NotifyConfig holds the webhook notification configuration
+type NotifyConfig struct {
+	URLs      []string          `json:"urls,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Template  string            `json:"template,omitempty"`
+	Retries   int               `json:"retries,omitempty"`
+	Backoff   string            `json:"backoff,omitempty"`
+	Timeout   string            `json:"timeout,omitempty"`
+	QueueSize int               `json:"queue_size,omitempty"`
+}
+
+// Notifier posts templated events to webhooks after the response is served
+type Notifier struct {
+	urls     []string
+	headers  map[string]string
+	template *template.Template
+	retries  int
+	backoff  time.Duration
+	client   *http.Client
+	slots    chan struct{}
+}
+
+// notifyResponseWriter passes the response through while keeping a copy of
+// up to maxNotifyBody bytes. Event streams are not copied.
+type notifyResponseWriter struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	streaming bool
+}
+
+// NewNotifier creates a new webhook notifier
+func NewNotifier(config *NotifyConfig, funcs template.FuncMap) (*Notifier, error) {
+	if len(config.URLs) == 0 {
+		return nil, errors.New("notify urls are required")
+	}
+	for _, target := range config.URLs {
+		if u, err := url.Parse(target); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid notify url %q", target)
+		}
+	}
+	if config.Template == "" {
+		return nil, errors.New("notify template is required")
+	}
+
+	tmpl, err := template.New("notify").Funcs(funcs).Delims("[[", "]]").Parse(config.Template)
+	if err != nil {
+		return nil, newTemplateError("notify", err)
+	}
+
+	n := &Notifier{
+		urls:     config.URLs,
+		headers:  config.Headers,
+		template: tmpl,
+		retries:  config.Retries,
+		backoff:  500 * time.Millisecond,
+		client:   &http.Client{Timeout: 5 * time.Second},
+	}
+	if n.retries <= 0 {
+		n.retries = 3
+	}
+	if config.Backoff != "" {
+		backoff, err := time.ParseDuration(config.Backoff)
+		if err != nil {
+			return nil, fmt.Errorf("invalid notify backoff: %w", err)
+		}
+		n.backoff = backoff
+	}
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid notify timeout: %w", err)
+		}
+		n.client.Timeout = timeout
+	}
+
+	queueSize := config.QueueSize
+	if queueSize <= 0 {
+		queueSize = 100
+	}
+	n.slots = make(chan struct{}, queueSize)
+
+	return n, nil
+}
+
+// ResponseWriter wraps rw so the served response is available to Finish
+func (n *Notifier) ResponseWriter(rw http.ResponseWriter) *notifyResponseWriter {
+	return &notifyResponseWriter{ResponseWriter: rw}
+}
+
+// Finish renders the event for the served response and queues it for
+// delivery. It returns false when the event was dropped.
+func (n *Notifier) Finish(nw *notifyResponseWriter, req *http.Request, requestBody []byte, ctx *TemplateContext) (bool, error) {
+	status := nw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	var requestData, responseData interface{}
+	if len(requestBody) > 0 {
+		json.Unmarshal(requestBody, &requestData)
+	}
+	if nw.body.Len() > 0 {
+		if err := json.Unmarshal(nw.body.Bytes(), &responseData); err != nil {
+			responseData = nw.body.String()
+		}
+	}
+
+	request := requestTemplateData(req)
+	request["body"] = requestData
+	templateData := buildTemplateData(ctx, map[string]interface{}{
+		"request": request,
+		"response": map[string]interface{}{
+			"status":  status,
+			"headers": convertHeaders(nw.Header()),
+			"body":    responseData,
+		},
+	})
+
+	buf := newTemplateOutput(ctx)
+	defer buf.release()
+	if err := n.template.Execute(buf, templateData); err != nil {
+		return true, newTemplateError("notify", err)
+	}
+	return n.send(append([]byte(nil), buf.Bytes()...)), nil
+}
+
+// send delivers event to every webhook in the background, dropping it when
+// the queue is full
+func (n *Notifier) send(event []byte) bool {
+	select {
+	case n.slots <- struct{}{}:
+	default:
+		log.Printf("Notify queue full, dropping event")
+		return false
+	}
+
+	go func() {
+		defer func() { <-n.slots }()
+		for _, target := range n.urls {
+			if err := n.deliver(target, event); err != nil {
+				log.Printf("Notify webhook %s failed: %v", target, err)
+			}
+		}
+	}()
+	return true
+}
+
+// deliver posts event to target, retrying network errors and 5xx responses
+// with exponential backoff
+func (n *Notifier) deliver(target string, event []byte) error {
+	backoff := n.backoff
+	var err error
+	for attempt := 0; attempt <= n.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		var req *http.Request
+		req, err = http.NewRequest(http.MethodPost, target, bytes.NewReader(event))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for name, value := range n.headers {
+			req.Header.Set(name, value)
+		}
+
+		var res *http.Response
+		res, err = n.client.Do(req)
+		if err != nil {
+			continue
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+
+		switch {
+		case res.StatusCode < 300:
+			return nil
+		case res.StatusCode < 500:
+			return fmt.Errorf("webhook returned %d", res.StatusCode)
+		}
+		err = fmt.Errorf("webhook returned %d", res.StatusCode)
+	}
+	return err
+}
+
+func (nw *notifyResponseWriter) WriteHeader(statusCode int) {
+	if nw.status == 0 {
+		nw.status = statusCode
+		mediaType, _, _ := mime.ParseMediaType(nw.Header().Get("Content-Type"))
+		nw.streaming = mediaType == "text/event-stream"
+	}
+	nw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (nw *notifyResponseWriter) Write(b []byte) (int, error) {
+	if nw.status == 0 {
+		nw.WriteHeader(http.StatusOK)
+	}
+	if room := maxNotifyBody - nw.body.Len(); room > 0 && !nw.streaming {
+		if len(b) < room {
+			room = len(b)
+		}
+		nw.body.Write(b[:room])
+	}
+	return nw.ResponseWriter.Write(b)
+}
+
+// Flush forwards flushes of streamed responses
+func (nw *notifyResponseWriter) Flush() {
+	if nw.status == 0 {
+		nw.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := nw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack forwards connection upgrades
+func (nw *notifyResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := nw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
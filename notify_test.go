@@ -0,0 +1,104 @@
+package traefik_modifier_plugin
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hukumonline-com/traefik-modifier-plugin/pkg"
+)
+
+func TestNotifier_Finish(t *testing.T) {
+	events := make(chan string, 4)
+	attempts := 0
+	webhook := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		attempts++
+		if attempts == 1 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		events <- req.Header.Get("X-Source") + " " + string(body)
+	}))
+	defer webhook.Close()
+
+	n, err := NewNotifier(&NotifyConfig{
+		URLs:     []string{webhook.URL},
+		Headers:  map[string]string{"X-Source": "gateway"},
+		Template: `{"event": "[[ .request.method ]] [[ .request.path ]]", "status": [[ .response.status ]], "id": [[ .response.body.id ]], "name": "[[ .request.body.name ]]"}`,
+		Backoff:  "1ms",
+	}, pkg.SimpleFuncMap())
+	if err != nil {
+		t.Fatalf("NewNotifier() error = %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	nw := n.ResponseWriter(rec)
+	nw.WriteHeader(http.StatusCreated)
+	nw.Write([]byte(`{"id": 7}`))
+
+	// The response is served before the event is delivered
+	if rec.Code != http.StatusCreated || rec.Body.String() != `{"id": 7}` {
+		t.Errorf("Unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+
+	req := httptest.NewRequest("POST", "/users", nil)
+	queued, err := n.Finish(nw, req, []byte(`{"name": "ana"}`), &TemplateContext{})
+	if err != nil || !queued {
+		t.Fatalf("Finish() = %v, %v", queued, err)
+	}
+
+	select {
+	case event := <-events:
+		expected := `gateway {"event": "POST /users", "status": 201, "id": 7, "name": "ana"}`
+		if event != expected {
+			t.Errorf("Expected event %s, got %s", expected, event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the webhook to receive the event after a retry")
+	}
+
+	if _, err := NewNotifier(&NotifyConfig{URLs: []string{"/relative"}, Template: "{}"}, nil); err == nil || !strings.Contains(err.Error(), "invalid notify url") {
+		t.Errorf("Expected invalid url error, got %v", err)
+	}
+}
+
+func TestNotifier_Streaming(t *testing.T) {
+	n, err := NewNotifier(&NotifyConfig{URLs: []string{"http://webhook"}, Template: "{}"}, nil)
+	if err != nil {
+		t.Fatalf("NewNotifier() error = %v", err)
+	}
+
+	// Event streams are flushed through and not copied
+	rec := httptest.NewRecorder()
+	nw := n.ResponseWriter(rec)
+	nw.Header().Set("Content-Type", "text/event-stream")
+	io.WriteString(nw, "data: 1\n\n")
+	nw.Flush()
+	if !rec.Flushed || rec.Code != http.StatusOK || rec.Body.String() != "data: 1\n\n" || nw.body.Len() != 0 {
+		t.Errorf("Expected an uncopied flushed stream, got flushed=%v %d %q (copied %d)", rec.Flushed, rec.Code, rec.Body.String(), nw.body.Len())
+	}
+
+	// The copy stops at maxNotifyBody while the response is served in full
+	rec = httptest.NewRecorder()
+	nw = n.ResponseWriter(rec)
+	nw.Write(make([]byte, maxNotifyBody+10))
+	if rec.Body.Len() != maxNotifyBody+10 || nw.body.Len() != maxNotifyBody {
+		t.Errorf("Expected %d bytes copied of %d served, got %d of %d", maxNotifyBody, maxNotifyBody+10, nw.body.Len(), rec.Body.Len())
+	}
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	nw = n.ResponseWriter(&hijackRecorder{ResponseRecorder: httptest.NewRecorder(), conn: server})
+	if conn, _, err := nw.Hijack(); err != nil || conn != server {
+		t.Errorf("Hijack() = %v, %v", conn, err)
+	}
+	if _, _, err := n.ResponseWriter(httptest.NewRecorder()).Hijack(); err == nil {
+		t.Errorf("Expected an error when the underlying writer cannot be hijacked")
+	}
+}
@@ -0,0 +1,502 @@
+package traefik_modifier_plugin
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// OIDCConfig holds the OIDC discovery configuration backing jwtVerify and
+// the optional verification of incoming bearer tokens
+type OIDCConfig struct {
+	IssuerURL            string `json:"issuer_url,omitempty"`
+	JWKSURL              string `json:"jwks_url,omitempty"`
+	Audience             string `json:"audience,omitempty"`
+	RefreshInterval      string `json:"refresh_interval,omitempty"`
+	StaleWhileRevalidate string `json:"stale_while_revalidate,omitempty"`
+	Timeout              string `json:"timeout,omitempty"`
+	VerifyRequests       bool   `json:"verify_requests,omitempty"`
+	RejectInvalid        bool   `json:"reject_invalid,omitempty"`
+	UnauthorizedResponse string `json:"unauthorized_response,omitempty"`
+}
+
+// errMissingBearerToken is the verification error of requests without a
+// bearer token
+var errMissingBearerToken = errors.New("jwt: missing bearer token")
+
+// minJWKSRefresh limits forced refreshes caused by unknown key IDs
+const minJWKSRefresh = time.Minute
+
+// jwksCacheKey is the cache key of the JWKS
+const jwksCacheKey = "jwks"
+
+// JWTVerifier verifies JWTs against keys discovered from an OIDC issuer
+type JWTVerifier struct {
+	issuer   string
+	jwksURL  string
+	audience string
+	cache    *ttlCache
+	client   *http.Client
+	now      func() time.Time
+
+	verifyRequests bool
+	rejectInvalid  bool
+	unauthorized   *template.Template
+	logger         *logger
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	lastAttempt time.Time
+}
+
+// jsonWebKey is a single key of a JWKS document
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// NewJWTVerifier creates a new verifier logging to logger. Discovery happens
+// lazily on first use.
+func NewJWTVerifier(config *OIDCConfig, logger *logger) (*JWTVerifier, error) {
+	if config.IssuerURL == "" && config.JWKSURL == "" {
+		return nil, errors.New("oidc issuer_url or jwks_url is required")
+	}
+
+	v := &JWTVerifier{
+		issuer:   strings.TrimRight(config.IssuerURL, "/"),
+		jwksURL:  config.JWKSURL,
+		audience: config.Audience,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		now:      time.Now,
+		logger:   logger,
+	}
+
+	interval := time.Hour
+	if config.RefreshInterval != "" {
+		var err error
+		if interval, err = time.ParseDuration(config.RefreshInterval); err != nil {
+			return nil, fmt.Errorf("invalid oidc refresh_interval: %w", err)
+		}
+	}
+	v.cache = newTTLCache(interval, 1)
+	if v.cache == nil {
+		return nil, errors.New("oidc refresh_interval must be positive")
+	}
+	v.cache.now = func() time.Time { return v.now() }
+	if config.StaleWhileRevalidate != "" {
+		stale, err := time.ParseDuration(config.StaleWhileRevalidate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid oidc stale_while_revalidate: %w", err)
+		}
+		v.cache.stale = stale
+	}
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid oidc timeout: %w", err)
+		}
+		v.client.Timeout = timeout
+	}
+
+	return v, nil
+}
+
+// FuncMap returns the JWT verification template functions
+func (v *JWTVerifier) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"jwtVerify": v.VerifyClaims,
+	}
+}
+
+// EnableRequestVerification turns on the verification of incoming bearer
+// tokens and parses the unauthorized response template
+func (v *JWTVerifier) EnableRequestVerification(config *OIDCConfig, funcs template.FuncMap) error {
+	if !config.VerifyRequests {
+		return nil
+	}
+	v.verifyRequests = true
+	v.rejectInvalid = config.RejectInvalid
+	if config.UnauthorizedResponse != "" {
+		tmpl, err := template.New("oidc[unauthorized_response]").Funcs(funcs).Delims("[[", "]]").Parse(config.UnauthorizedResponse)
+		if err != nil {
+			return newTemplateError("oidc[unauthorized_response]", err)
+		}
+		v.unauthorized = tmpl
+	}
+	return nil
+}
+
+// VerifyRequest verifies the bearer token of req
+func (v *JWTVerifier) VerifyRequest(req *http.Request) error {
+	token := bearerToken(req.Header)
+	if token == "" {
+		return errMissingBearerToken
+	}
+	_, err := v.Verify(token)
+	return err
+}
+
+// WriteUnauthorized answers 401 for a request whose bearer token failed
+// verification, rendering the unauthorized template when one is configured
+func (v *JWTVerifier) WriteUnauthorized(rw http.ResponseWriter, req *http.Request, verifyErr error, ctx *TemplateContext, errs *pluginErrors) {
+	if errors.Is(verifyErr, errMissingBearerToken) {
+		rw.Header().Set("WWW-Authenticate", "Bearer")
+	} else {
+		rw.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+
+	if v.unauthorized == nil {
+		errs.write(rw, http.StatusUnauthorized, "Unauthorized", verifyErr)
+		return
+	}
+
+	templateData := buildTemplateData(ctx, map[string]interface{}{
+		"request": requestTemplateData(req),
+	})
+	writeTemplateResponse(rw, http.StatusUnauthorized, "oidc[unauthorized_response]", v.unauthorized, templateData, errs)
+}
+
+// VerifyClaims returns the claims of a valid token, or nil when the token is
+// invalid so templates can branch with `with`. A "Bearer " prefix is accepted.
+func (v *JWTVerifier) VerifyClaims(token string) map[string]interface{} {
+	claims, err := v.Verify(token)
+	if err != nil {
+		v.logger.forRequest(nil).debugf("oidc", outcomeContinued, "jwtVerify returned no claims: %v", err)
+		return nil
+	}
+	return claims
+}
+
+// Verify checks the signature and standard claims of a token and returns its claims
+func (v *JWTVerifier) Verify(token string) (map[string]interface{}, error) {
+	token = strings.TrimSpace(token)
+	if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+		token = strings.TrimSpace(token[7:])
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("jwt: token must have three parts")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("jwt: invalid header encoding: %w", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("jwt: invalid header: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("jwt: invalid signature encoding: %w", err)
+	}
+
+	key, err := v.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyJWTSignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	claims, err := decodeJWTClaims(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// validateClaims checks exp, nbf, iss and aud
+func (v *JWTVerifier) validateClaims(claims map[string]interface{}) error {
+	now := v.now().Unix()
+	const leeway = 30
+
+	if exp, ok := claims["exp"].(float64); ok && now > int64(exp)+leeway {
+		return errors.New("jwt: token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now+leeway < int64(nbf) {
+		return errors.New("jwt: token not yet valid")
+	}
+	if v.issuer != "" {
+		if iss, _ := claims["iss"].(string); strings.TrimRight(iss, "/") != v.issuer {
+			return fmt.Errorf("jwt: unexpected issuer %q", iss)
+		}
+	}
+	if v.audience != "" && !audienceContains(claims["aud"], v.audience) {
+		return errors.New("jwt: audience mismatch")
+	}
+	return nil
+}
+
+// audienceContains reports whether the aud claim (string or list) contains audience
+func audienceContains(aud interface{}, audience string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == audience
+	case []interface{}:
+		for _, item := range a {
+			if s, ok := item.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// key returns the public key for kid. The JWKS is cached for the refresh
+// interval, and an unknown key ID forces a refresh (key rotation).
+func (v *JWTVerifier) key(kid string) (crypto.PublicKey, error) {
+	keys, err := v.cachedKeys()
+	if err != nil {
+		return nil, err
+	}
+	key, known := lookupKey(keys, kid)
+
+	if !known && v.allowForcedRefresh() {
+		if value, err := v.fetchKeys(); err != nil {
+			v.logger.forRequest(nil).warnf("oidc", outcomeContinued, "JWKS refresh failed, using cached keys: %v", err)
+		} else {
+			v.cache.Set(jwksCacheKey, value)
+			key, known = lookupKey(value.(map[string]crypto.PublicKey), kid)
+		}
+	}
+
+	if !known {
+		return nil, fmt.Errorf("jwt: unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+// cachedKeys returns the cached JWKS, falling back to the last fetched keys
+// when a refresh fails
+func (v *JWTVerifier) cachedKeys() (map[string]crypto.PublicKey, error) {
+	value, err := v.cache.Fetch(jwksCacheKey, v.fetchKeys)
+	if err == nil {
+		return value.(map[string]crypto.PublicKey), nil
+	}
+
+	v.mu.Lock()
+	keys := v.keys
+	v.mu.Unlock()
+	if keys == nil {
+		return nil, err
+	}
+	v.logger.forRequest(nil).warnf("oidc", outcomeContinued, "JWKS refresh failed, using cached keys: %v", err)
+	return keys, nil
+}
+
+// allowForcedRefresh reports whether an unknown key ID may refresh the JWKS
+func (v *JWTVerifier) allowForcedRefresh() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.now().Sub(v.lastAttempt) >= minJWKSRefresh
+}
+
+// lookupKey finds a key by kid. Tokens without kid match a single-key JWKS.
+func lookupKey(keys map[string]crypto.PublicKey, kid string) (crypto.PublicKey, bool) {
+	if key, ok := keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// fetchKeys discovers the JWKS URL if needed and loads the keys
+func (v *JWTVerifier) fetchKeys() (interface{}, error) {
+	v.mu.Lock()
+	v.lastAttempt = v.now()
+	jwksURL := v.jwksURL
+	v.mu.Unlock()
+
+	if jwksURL == "" {
+		var discovery struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.getJSON(v.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+			return nil, fmt.Errorf("oidc discovery failed: %w", err)
+		}
+		if discovery.JWKSURI == "" {
+			return nil, errors.New("oidc discovery document has no jwks_uri")
+		}
+		jwksURL = discovery.JWKSURI
+		v.mu.Lock()
+		v.jwksURL = jwksURL
+		v.mu.Unlock()
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := v.getJSON(jwksURL, &jwks); err != nil {
+		return nil, fmt.Errorf("jwks fetch failed: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			v.logger.forRequest(nil).warnf("oidc", "", "Skipping JWKS key %q: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.mu.Unlock()
+	return keys, nil
+}
+
+// getJSON fetches and decodes a JSON document
+func (v *JWTVerifier) getJSON(url string, target interface{}) error {
+	res, err := v.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", url, res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(target)
+}
+
+// publicKey converts a JWK into an RSA or ECDSA public key
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+// decodeBigInt decodes a base64url encoded big-endian integer
+func decodeBigInt(value string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// verifyJWTSignature verifies an RS*, PS* or ES* signature
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("jwt: unsupported algorithm %q", alg)
+	}
+
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("jwt: unsupported algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch {
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("jwt: key type does not match algorithm")
+		}
+		var err error
+		if alg[0] == 'R' {
+			err = rsa.VerifyPKCS1v15(rsaKey, hash, digest, signature)
+		} else {
+			err = rsa.VerifyPSS(rsaKey, hash, digest, signature, nil)
+		}
+		if err != nil {
+			return errors.New("jwt: invalid signature")
+		}
+		return nil
+	case strings.HasPrefix(alg, "ES"):
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("jwt: key type does not match algorithm")
+		}
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("jwt: invalid signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return errors.New("jwt: invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("jwt: unsupported algorithm %q", alg)
+	}
+}
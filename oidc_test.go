@@ -0,0 +1,206 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signTestJWT creates an RS256 token signed with key
+func signTestJWT(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTVerifier_DiscoveryAndRotation(t *testing.T) {
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	activeKeys := map[string]*rsa.PrivateKey{"old": oldKey}
+	jwksFetches := 0
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(rw).Encode(map[string]string{"issuer": server.URL, "jwks_uri": server.URL + "/keys"})
+		case "/keys":
+			jwksFetches++
+			var keys []map[string]string
+			for kid, key := range activeKeys {
+				keys = append(keys, map[string]string{
+					"kid": kid,
+					"kty": "RSA",
+					"use": "sig",
+					"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+				})
+			}
+			json.NewEncoder(rw).Encode(map[string]interface{}{"keys": keys})
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	v, err := NewJWTVerifier(&OIDCConfig{IssuerURL: server.URL, Audience: "api"}, nil)
+	if err != nil {
+		t.Fatalf("NewJWTVerifier() error = %v", err)
+	}
+	now := time.Now()
+	v.now = func() time.Time { return now }
+
+	claims := map[string]interface{}{
+		"iss": server.URL,
+		"aud": []string{"api"},
+		"sub": "user-1",
+		"exp": now.Add(time.Hour).Unix(),
+	}
+
+	verified, err := v.Verify("Bearer " + signTestJWT(t, oldKey, "old", claims))
+	if err != nil || verified["sub"] != "user-1" {
+		t.Fatalf("Verify() = %v, %v", verified, err)
+	}
+
+	// Wrong audience and expired tokens are rejected
+	claims["aud"] = "other"
+	if _, err := v.Verify(signTestJWT(t, oldKey, "old", claims)); err == nil {
+		t.Errorf("Expected audience mismatch")
+	}
+	claims["aud"] = "api"
+	claims["exp"] = now.Add(-time.Hour).Unix()
+	if v.VerifyClaims(signTestJWT(t, oldKey, "old", claims)) != nil {
+		t.Errorf("Expected expired token to be rejected")
+	}
+	claims["exp"] = now.Add(time.Hour).Unix()
+
+	// Tampered signature is rejected
+	if _, err := v.Verify(signTestJWT(t, newKey, "old", claims)); err == nil {
+		t.Errorf("Expected invalid signature")
+	}
+
+	// Key rotation: unknown kid triggers a refresh (rate limited)
+	activeKeys["new"] = newKey
+	now = now.Add(2 * time.Minute)
+	if _, err := v.Verify(signTestJWT(t, newKey, "new", claims)); err != nil {
+		t.Errorf("Expected rotated key to be picked up, got %v", err)
+	}
+	if jwksFetches != 2 {
+		t.Errorf("Expected 2 JWKS fetches, got %d", jwksFetches)
+	}
+}
+
+func TestModifier_JWTRequestVerification(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(rw).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "k1",
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer server.Close()
+
+	config := CreateConfig()
+	config.OIDC = &OIDCConfig{
+		JWKSURL:              server.URL,
+		VerifyRequests:       true,
+		RejectInvalid:        true,
+		UnauthorizedResponse: `{"error": "unauthorized", "detail": "[[ .request.jwt.error ]]"}`,
+	}
+	config.ModifierHeader = HeaderConfig{"X-User": `[[ if .request.jwt.valid ]][[ .request.jwt.claims.sub ]][[ end ]]`}
+
+	var upstreamUser string
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		upstreamUser = req.Header.Get("X-User")
+	})
+	handler, err := New(context.Background(), next, config, "oidc")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	claims := map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+signTestJWT(t, key, "k1", claims))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || upstreamUser != "user-1" {
+		t.Errorf("Expected a valid token to pass, got %d and user %q", rec.Code, upstreamUser)
+	}
+
+	for name, authorization := range map[string]string{
+		"forged":  "Bearer " + signTestJWT(t, otherKey, "k1", claims),
+		"missing": "",
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized || !strings.HasPrefix(rec.Body.String(), `{"error": "unauthorized", "detail": "jwt: `) {
+			t.Errorf("%s token: expected the templated 401, got %d %s", name, rec.Code, rec.Body.String())
+		}
+		if rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s token: expected a WWW-Authenticate challenge", name)
+		}
+	}
+}
+
+func TestJWTVerifier_VerifyClaimsLogLevel(t *testing.T) {
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stdout)
+
+	for _, level := range []string{"info", "debug"} {
+		output.Reset()
+		logger, err := newLogger(level, "json", "jwt")
+		if err != nil {
+			t.Fatalf("newLogger() error = %v", err)
+		}
+		v, err := NewJWTVerifier(&OIDCConfig{JWKSURL: "http://127.0.0.1:0/jwks"}, logger)
+		if err != nil {
+			t.Fatalf("NewJWTVerifier() error = %v", err)
+		}
+
+		// An invalid token only gives a debug line, since templates branch on it
+		if v.VerifyClaims("not-a-token") != nil {
+			t.Fatalf("Expected no claims for an invalid token")
+		}
+		if level == "info" {
+			if output.Len() != 0 {
+				t.Errorf("Expected no log line at info, got %s", output.String())
+			}
+			continue
+		}
+		var line logLine
+		if err := json.Unmarshal(output.Bytes(), &line); err != nil {
+			t.Fatalf("Expected a JSON log line, got %q: %v", output.String(), err)
+		}
+		if line.Level != "debug" || line.Phase != "oidc" || line.Outcome != outcomeContinued || line.Middleware != "jwt" {
+			t.Errorf("Unexpected log line %+v", line)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package traefik_modifier_plugin
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Template error policies
+const (
+	// onErrorPassthrough keeps going with whatever the modifier produced
+	onErrorPassthrough = "passthrough"
+	// onErrorReject answers the request with an error
+	onErrorReject = "reject"
+	// onErrorUseOriginal undoes the modifier and forwards the original data
+	onErrorUseOriginal = "useOriginal"
+)
+
+// OnErrorConfig holds the template error policy of each modifier. Headers,
+// query and cookies default to passthrough; request and response bodies
+// default to reject.
+type OnErrorConfig struct {
+	Header   string `json:"header,omitempty"`
+	Query    string `json:"query,omitempty"`
+	Cookie   string `json:"cookie,omitempty"`
+	Request  string `json:"request,omitempty"`
+	Response string `json:"response,omitempty"`
+}
+
+// errorPolicy maps a modifier phase to its template error policy
+type errorPolicy map[string]string
+
+// newErrorPolicy validates the configured policies over the defaults
+func newErrorPolicy(config *OnErrorConfig) (errorPolicy, error) {
+	p := errorPolicy{
+		phaseHeader:   onErrorPassthrough,
+		phaseQuery:    onErrorPassthrough,
+		phaseCookie:   onErrorPassthrough,
+		phaseRequest:  onErrorReject,
+		phaseResponse: onErrorReject,
+	}
+	if config == nil {
+		return p, nil
+	}
+
+	for phase, value := range map[string]string{
+		phaseHeader:   config.Header,
+		phaseQuery:    config.Query,
+		phaseCookie:   config.Cookie,
+		phaseRequest:  config.Request,
+		phaseResponse: config.Response,
+	} {
+		if value == "" {
+			continue
+		}
+		switch {
+		case strings.EqualFold(value, onErrorPassthrough):
+			p[phase] = onErrorPassthrough
+		case strings.EqualFold(value, onErrorReject):
+			p[phase] = onErrorReject
+		case strings.EqualFold(value, onErrorUseOriginal):
+			p[phase] = onErrorUseOriginal
+		default:
+			return nil, fmt.Errorf("invalid on_error %s policy %q: expected passthrough, reject or useOriginal", phase, value)
+		}
+	}
+	return p, nil
+}
+
+// handle applies the policy of phase to a modifier error. With reject the
+// request is answered with status; with useOriginal restore undoes the
+// modifier. It reports whether the request was answered.
+func (p errorPolicy) handle(rw http.ResponseWriter, phase string, status int, prefix string, err error, errs *pluginErrors, restore func()) bool {
+	switch p[phase] {
+	case onErrorReject:
+		errs.write(rw, status, prefix, err)
+		return true
+	case onErrorUseOriginal:
+		if restore != nil {
+			restore()
+		}
+	}
+	return false
+}
+
+// replaceHeader replaces the values of header with those of original
+func replaceHeader(header, original http.Header) {
+	for name := range header {
+		header.Del(name)
+	}
+	for name, values := range original {
+		header[name] = values
+	}
+}
@@ -0,0 +1,85 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestModifier_OnError(t *testing.T) {
+	newHandler := func(policy string) (http.Handler, *http.Request) {
+		config := CreateConfig()
+		config.ModifierHeader = HeaderConfig{
+			"X-Static": "set",
+			"X-Broken": `[[ index .request.headers.missing 3 ]]`,
+		}
+		config.ModifierRequest = `{"total": [[ index .request.api.body.items 5 ]]}`
+		config.ModifierResponse = map[string]string{"200": `[[ index .response.body.items 5 ]]`}
+		config.OnError = &OnErrorConfig{Header: policy, Request: policy, Response: policy}
+
+		seen := &http.Request{}
+		handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			*seen = *req
+			seen.Body = io.NopCloser(strings.NewReader(string(body)))
+			io.WriteString(rw, `{"items": []}`)
+		}), config, "test")
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		return handler, seen
+	}
+
+	tests := []struct {
+		policy   string
+		status   int
+		body     string
+		xStatic  string
+		upstream string
+	}{
+		{onErrorPassthrough, http.StatusOK, `{"items": []}`, "set", `{"items": [1]}`},
+		{onErrorUseOriginal, http.StatusOK, `{"items": []}`, "", `{"items": [1]}`},
+		{onErrorReject, http.StatusInternalServerError, "", "", ""},
+	}
+	for _, tt := range tests {
+		handler, seen := newHandler(tt.policy)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", "/orders", strings.NewReader(`{"items": [1]}`)))
+
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.policy, tt.status, rec.Code)
+		}
+		if tt.status != http.StatusOK {
+			if !strings.HasPrefix(rec.Body.String(), "Header modification error") {
+				t.Errorf("%s: expected header error, got %q", tt.policy, rec.Body.String())
+			}
+			continue
+		}
+		if got := rec.Body.String(); got != tt.body {
+			t.Errorf("%s: expected response %s, got %s", tt.policy, tt.body, got)
+		}
+		if got := seen.Header.Get("X-Static"); got != tt.xStatic {
+			t.Errorf("%s: expected X-Static %q, got %q", tt.policy, tt.xStatic, got)
+		}
+		if body, _ := io.ReadAll(seen.Body); string(body) != tt.upstream {
+			t.Errorf("%s: expected upstream body %s, got %s", tt.policy, tt.upstream, body)
+		}
+	}
+}
+
+func TestNewErrorPolicy(t *testing.T) {
+	policy, err := newErrorPolicy(&OnErrorConfig{Query: "useoriginal"})
+	if err != nil {
+		t.Fatalf("newErrorPolicy() error = %v", err)
+	}
+	if policy[phaseQuery] != onErrorUseOriginal || policy[phaseHeader] != onErrorPassthrough || policy[phaseRequest] != onErrorReject {
+		t.Errorf("Unexpected policies %v", policy)
+	}
+
+	if _, err := newErrorPolicy(&OnErrorConfig{Response: "ignore"}); err == nil {
+		t.Errorf("Expected error for an unknown policy")
+	}
+}
@@ -0,0 +1,715 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSchemaDepth bounds $ref and composition nesting while validating
+const maxSchemaDepth = 64
+
+// openAPIUUIDPattern validates the uuid string format
+var openAPIUUIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// OpenAPIConfig holds the OpenAPI validation configuration
+type OpenAPIConfig struct {
+	SpecFile         string `json:"spec_file,omitempty"`
+	BasePath         string `json:"base_path,omitempty"`
+	ValidateRequest  bool   `json:"validate_request,omitempty"`
+	ValidateResponse bool   `json:"validate_response,omitempty"`
+	StripUnknown     bool   `json:"strip_unknown,omitempty"`
+	ResponseAction   string `json:"response_action,omitempty"`
+}
+
+// OpenAPIValidator validates and strips requests and responses using the
+// operation schemas of an OpenAPI 3 document
+type OpenAPIValidator struct {
+	spec             map[string]interface{}
+	basePath         string
+	routes           []*openAPIRoute
+	validateRequest  bool
+	validateResponse bool
+	stripUnknown     bool
+	rejectResponse   bool
+}
+
+// openAPIRoute is a path template of the spec
+type openAPIRoute struct {
+	segments []string
+	literals int
+	item     map[string]interface{}
+}
+
+// openAPIOperation is the operation matched for a request
+type openAPIOperation struct {
+	method     string
+	path       string
+	params     map[string]string
+	operation  map[string]interface{}
+	parameters []map[string]interface{}
+}
+
+// openAPIResponseWriter buffers the upstream response for validation
+type openAPIResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// NewOpenAPIValidator loads the spec and creates a new validator
+func NewOpenAPIValidator(config *OpenAPIConfig) (*OpenAPIValidator, error) {
+	if config.SpecFile == "" {
+		return nil, errors.New("openapi spec_file is required")
+	}
+
+	data, err := os.ReadFile(config.SpecFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read openapi spec_file: %w", err)
+	}
+	var spec map[string]interface{}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("openapi spec_file must be a JSON document: %w", err)
+	}
+
+	ov := &OpenAPIValidator{
+		spec:             spec,
+		basePath:         strings.TrimRight(config.BasePath, "/"),
+		validateRequest:  config.ValidateRequest,
+		validateResponse: config.ValidateResponse,
+		stripUnknown:     config.StripUnknown,
+	}
+
+	switch config.ResponseAction {
+	case "", "log":
+	case "reject":
+		ov.rejectResponse = true
+	default:
+		return nil, fmt.Errorf("invalid openapi response_action %q", config.ResponseAction)
+	}
+
+	paths, _ := spec["paths"].(map[string]interface{})
+	if len(paths) == 0 {
+		return nil, errors.New("openapi spec defines no paths")
+	}
+	for template, item := range paths {
+		pathItem, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		route := &openAPIRoute{segments: strings.Split(strings.Trim(template, "/"), "/"), item: pathItem}
+		for _, segment := range route.segments {
+			if !strings.HasPrefix(segment, "{") {
+				route.literals++
+			}
+		}
+		ov.routes = append(ov.routes, route)
+	}
+
+	// Prefer concrete paths over templated ones, e.g. /users/me over /users/{id}
+	sort.Slice(ov.routes, func(i, j int) bool {
+		if ov.routes[i].literals != ov.routes[j].literals {
+			return ov.routes[i].literals > ov.routes[j].literals
+		}
+		return strings.Join(ov.routes[i].segments, "/") < strings.Join(ov.routes[j].segments, "/")
+	})
+
+	return ov, nil
+}
+
+// Match returns the operation for the request, or nil when the spec does not
+// document it
+func (ov *OpenAPIValidator) Match(req *http.Request) *openAPIOperation {
+	if !strings.HasPrefix(req.URL.Path, ov.basePath) {
+		return nil
+	}
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, ov.basePath), "/"), "/")
+	method := strings.ToLower(req.Method)
+
+	for _, route := range ov.routes {
+		if len(route.segments) != len(segments) {
+			continue
+		}
+		params := make(map[string]string)
+		matched := true
+		for i, segment := range route.segments {
+			if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+				params[segment[1:len(segment)-1]] = segments[i]
+			} else if segment != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		operation, ok := route.item[method].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		op := &openAPIOperation{method: method, path: "/" + strings.Join(route.segments, "/"), params: params, operation: operation}
+		op.parameters = ov.parameters(route.item, operation)
+		return op
+	}
+	return nil
+}
+
+// parameters merges path item and operation parameters, the operation
+// overriding parameters with the same name and location
+func (ov *OpenAPIValidator) parameters(item, operation map[string]interface{}) []map[string]interface{} {
+	var merged []map[string]interface{}
+	index := make(map[string]int)
+	for _, source := range []interface{}{item["parameters"], operation["parameters"]} {
+		list, _ := source.([]interface{})
+		for _, raw := range list {
+			param, ok := ov.resolve(raw).(map[string]interface{})
+			if !ok {
+				continue
+			}
+			key := fmt.Sprint(param["in"], ":", param["name"])
+			if i, exists := index[key]; exists {
+				merged[i] = param
+				continue
+			}
+			index[key] = len(merged)
+			merged = append(merged, param)
+		}
+	}
+	return merged
+}
+
+// ModifyRequest validates the parameters and JSON body of the request and
+// strips undocumented body fields. It returns the validation failures.
+func (ov *OpenAPIValidator) ModifyRequest(req *http.Request, op *openAPIOperation) ([]string, error) {
+	sv := &schemaValidator{ov: ov, strip: ov.stripUnknown}
+
+	if ov.validateRequest {
+		query := req.URL.Query()
+		for _, param := range op.parameters {
+			name, _ := param["name"].(string)
+			required, _ := param["required"].(bool)
+
+			var values []string
+			switch param["in"] {
+			case "path":
+				if value, ok := op.params[name]; ok {
+					values = []string{value}
+				}
+			case "query":
+				values = query[name]
+			case "header":
+				values = req.Header.Values(name)
+			default:
+				continue
+			}
+
+			location := fmt.Sprintf("%s.%s", param["in"], name)
+			if len(values) == 0 {
+				if required {
+					sv.fail(location, "is required")
+				}
+				continue
+			}
+			if schema := ov.resolve(param["schema"]); schema != nil {
+				sv.validateParameter(schema, values, location)
+			}
+		}
+	}
+
+	schema := ov.bodySchema(op.operation["requestBody"], req.Header.Get("Content-Type"))
+	if schema == nil || (!ov.validateRequest && !ov.stripUnknown) {
+		return sv.errors, nil
+	}
+
+	body, err := readAndRestoreBody(req, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		if requestBody, ok := ov.resolve(op.operation["requestBody"]).(map[string]interface{}); ok && ov.validateRequest {
+			if required, _ := requestBody["required"].(bool); required {
+				sv.fail("body", "is required")
+			}
+		}
+		return sv.errors, nil
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		if ov.validateRequest {
+			sv.fail("body", "is not valid JSON")
+		}
+		return sv.errors, nil
+	}
+
+	sv.validate(schema, data, "body", 0)
+	if sv.stripped {
+		newBody, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(newBody))
+		req.ContentLength = int64(len(newBody))
+		req.Header.Set("Content-Length", strconv.Itoa(len(newBody)))
+	}
+	if !ov.validateRequest {
+		return nil, nil
+	}
+	return sv.errors, nil
+}
+
+// Handler wraps next so the upstream response is validated against the
+// response schema of op and stripped of undocumented fields
+func (ov *OpenAPIValidator) Handler(next http.Handler, op *openAPIOperation, onInvalid func([]string)) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		ow := &openAPIResponseWriter{ResponseWriter: rw}
+		next.ServeHTTP(ow, req)
+
+		status := ow.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		header := rw.Header()
+		body := ow.body.Bytes()
+
+		schema := ov.bodySchema(ov.responseObject(op, status), header.Get("Content-Type"))
+		var data interface{}
+		if schema != nil && header.Get("Content-Encoding") == "" && json.Unmarshal(body, &data) == nil {
+			sv := &schemaValidator{ov: ov, strip: ov.stripUnknown}
+			sv.validate(schema, data, "response", 0)
+
+			if ov.validateResponse && len(sv.errors) > 0 {
+				onInvalid(sv.errors)
+				if ov.rejectResponse {
+					writeValidationError(rw, http.StatusBadGateway, "Response validation failed", sv.errors)
+					return
+				}
+			}
+			if sv.stripped {
+				if encoded, err := json.Marshal(data); err == nil {
+					body = encoded
+					header.Set("Content-Length", strconv.Itoa(len(body)))
+				}
+			}
+		}
+
+		rw.WriteHeader(status)
+		rw.Write(body)
+	})
+}
+
+// responseObject returns the response object documented for status, trying
+// the exact code, the range (e.g. 2XX) and default
+func (ov *OpenAPIValidator) responseObject(op *openAPIOperation, status int) interface{} {
+	responses, _ := op.operation["responses"].(map[string]interface{})
+	code := strconv.Itoa(status)
+	for _, key := range []string{code, code[:1] + "XX", code[:1] + "xx", "default"} {
+		if response, ok := responses[key]; ok {
+			return response
+		}
+	}
+	return nil
+}
+
+// bodySchema returns the JSON schema of a request body or response object
+// for the given content type, or nil when it has none
+func (ov *OpenAPIValidator) bodySchema(raw interface{}, contentType string) interface{} {
+	object, _ := ov.resolve(raw).(map[string]interface{})
+	content, _ := object["content"].(map[string]interface{})
+	if len(content) == 0 {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "" {
+		mediaType = "application/json"
+	}
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return nil
+	}
+
+	for _, key := range []string{mediaType, "application/json", "*/*"} {
+		if media, ok := content[key].(map[string]interface{}); ok {
+			return ov.resolve(media["schema"])
+		}
+	}
+	return nil
+}
+
+// resolve follows local $ref pointers such as #/components/schemas/User
+func (ov *OpenAPIValidator) resolve(raw interface{}) interface{} {
+	for depth := 0; depth < maxSchemaDepth; depth++ {
+		object, ok := raw.(map[string]interface{})
+		if !ok {
+			return raw
+		}
+		ref, ok := object["$ref"].(string)
+		if !ok {
+			return raw
+		}
+		if !strings.HasPrefix(ref, "#/") {
+			return nil
+		}
+
+		var current interface{} = ov.spec
+		for _, part := range strings.Split(ref[2:], "/") {
+			part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+			container, _ := current.(map[string]interface{})
+			current = container[part]
+		}
+		raw = current
+	}
+	return nil
+}
+
+// schemaValidator validates a value against a JSON schema, optionally
+// removing properties the schema does not document
+type schemaValidator struct {
+	ov       *OpenAPIValidator
+	strip    bool
+	stripped bool
+	errors   []string
+}
+
+func (sv *schemaValidator) fail(path, format string, args ...interface{}) {
+	sv.errors = append(sv.errors, path+": "+fmt.Sprintf(format, args...))
+}
+
+// validateParameter coerces string parameter values to the schema type
+func (sv *schemaValidator) validateParameter(schema interface{}, values []string, path string) {
+	object, _ := schema.(map[string]interface{})
+	if object["type"] == "array" {
+		items := sv.ov.resolve(object["items"])
+		for i, value := range values {
+			sv.validate(items, coerceParameter(items, value), fmt.Sprintf("%s[%d]", path, i), 0)
+		}
+		return
+	}
+	sv.validate(schema, coerceParameter(schema, values[0]), path, 0)
+}
+
+// coerceParameter converts a parameter string to the type of its schema
+func coerceParameter(schema interface{}, value string) interface{} {
+	object, _ := schema.(map[string]interface{})
+	switch object["type"] {
+	case "integer", "number":
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			return number
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// validate checks value against schema and records failures under path
+func (sv *schemaValidator) validate(raw interface{}, value interface{}, path string, depth int) {
+	sv.validateSchema(raw, value, path, depth, true)
+}
+
+// validateSchema validates value. stripObject is false for allOf branches,
+// whose properties are only complete together with the other branches.
+func (sv *schemaValidator) validateSchema(raw interface{}, value interface{}, path string, depth int, stripObject bool) {
+	if depth > maxSchemaDepth {
+		sv.fail(path, "schema nesting too deep")
+		return
+	}
+	schema, ok := sv.ov.resolve(raw).(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable || schemaAllowsType(schema, "null") || schema["type"] == nil {
+			return
+		}
+		sv.fail(path, "must not be null")
+		return
+	}
+
+	if !sv.checkType(schema, value, path) {
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			sv.fail(path, "must be one of %v", enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		sv.validateString(schema, v, path)
+	case float64:
+		sv.validateNumber(schema, v, path)
+	case []interface{}:
+		if min, ok := schema["minItems"].(float64); ok && float64(len(v)) < min {
+			sv.fail(path, "must have at least %v items", min)
+		}
+		if max, ok := schema["maxItems"].(float64); ok && float64(len(v)) > max {
+			sv.fail(path, "must have at most %v items", max)
+		}
+		if items := schema["items"]; items != nil {
+			for i, item := range v {
+				sv.validate(items, item, fmt.Sprintf("%s[%d]", path, i), depth+1)
+			}
+		}
+	case map[string]interface{}:
+		sv.validateObject(schema, v, path, depth, stripObject)
+	}
+
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range allOf {
+			sv.validateSchema(sub, value, path, depth+1, false)
+		}
+	}
+	for _, keyword := range []string{"oneOf", "anyOf"} {
+		branches, ok := schema[keyword].([]interface{})
+		if !ok {
+			continue
+		}
+		matches := 0
+		for _, branch := range branches {
+			probe := &schemaValidator{ov: sv.ov}
+			probe.validate(branch, value, path, depth+1)
+			if len(probe.errors) == 0 {
+				matches++
+			}
+		}
+		if matches == 0 || (keyword == "oneOf" && matches > 1) {
+			sv.fail(path, "must match %s %s", map[string]string{"oneOf": "exactly one of", "anyOf": "at least one of"}[keyword], keyword)
+		}
+	}
+}
+
+// checkType validates the type keyword, accepting OpenAPI 3.1 type lists
+func (sv *schemaValidator) checkType(schema map[string]interface{}, value interface{}, path string) bool {
+	if schema["type"] == nil {
+		return true
+	}
+
+	actual := ""
+	switch v := value.(type) {
+	case string:
+		actual = "string"
+	case bool:
+		actual = "boolean"
+	case float64:
+		actual = "number"
+		if v == math.Trunc(v) && schemaAllowsType(schema, "integer") {
+			actual = "integer"
+		}
+	case []interface{}:
+		actual = "array"
+	case map[string]interface{}:
+		actual = "object"
+	}
+
+	if schemaAllowsType(schema, actual) || (actual == "integer" && schemaAllowsType(schema, "number")) {
+		return true
+	}
+	sv.fail(path, "expected %v, got %s", schema["type"], actual)
+	return false
+}
+
+// schemaAllowsType reports whether the type keyword of schema allows typ
+func schemaAllowsType(schema map[string]interface{}, typ string) bool {
+	switch t := schema["type"].(type) {
+	case string:
+		return t == typ
+	case []interface{}:
+		for _, allowed := range t {
+			if allowed == typ {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (sv *schemaValidator) validateString(schema map[string]interface{}, value, path string) {
+	length := float64(len([]rune(value)))
+	if min, ok := schema["minLength"].(float64); ok && length < min {
+		sv.fail(path, "must be at least %v characters", min)
+	}
+	if max, ok := schema["maxLength"].(float64); ok && length > max {
+		sv.fail(path, "must be at most %v characters", max)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(value) {
+			sv.fail(path, "must match pattern %s", pattern)
+		}
+	}
+
+	var valid bool
+	switch schema["format"] {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		valid = err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", value)
+		valid = err == nil
+	case "uuid":
+		valid = openAPIUUIDPattern.MatchString(value)
+	case "email":
+		at := strings.LastIndex(value, "@")
+		valid = at > 0 && at < len(value)-1
+	default:
+		return
+	}
+	if !valid {
+		sv.fail(path, "must be a valid %s", schema["format"])
+	}
+}
+
+func (sv *schemaValidator) validateNumber(schema map[string]interface{}, value float64, path string) {
+	if min, ok := schema["minimum"].(float64); ok {
+		if exclusive, _ := schema["exclusiveMinimum"].(bool); exclusive && value <= min {
+			sv.fail(path, "must be greater than %v", min)
+		} else if value < min {
+			sv.fail(path, "must be at least %v", min)
+		}
+	}
+	if min, ok := schema["exclusiveMinimum"].(float64); ok && value <= min {
+		sv.fail(path, "must be greater than %v", min)
+	}
+	if max, ok := schema["maximum"].(float64); ok {
+		if exclusive, _ := schema["exclusiveMaximum"].(bool); exclusive && value >= max {
+			sv.fail(path, "must be less than %v", max)
+		} else if value > max {
+			sv.fail(path, "must be at most %v", max)
+		}
+	}
+	if max, ok := schema["exclusiveMaximum"].(float64); ok && value >= max {
+		sv.fail(path, "must be less than %v", max)
+	}
+}
+
+func (sv *schemaValidator) validateObject(schema map[string]interface{}, value map[string]interface{}, path string, depth int, stripObject bool) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if _, exists := value[fmt.Sprint(name)]; !exists {
+				sv.fail(path+"."+fmt.Sprint(name), "is required")
+			}
+		}
+	}
+
+	properties, open := sv.ov.schemaProperties(schema, 0)
+	if sv.strip && stripObject && !open {
+		for name := range value {
+			if _, documented := properties[name]; !documented {
+				delete(value, name)
+				sv.stripped = true
+			}
+		}
+	}
+
+	own, _ := schema["properties"].(map[string]interface{})
+	additional := schema["additionalProperties"]
+	for name, child := range value {
+		if propertySchema, ok := own[name]; ok {
+			sv.validate(propertySchema, child, path+"."+name, depth+1)
+			continue
+		}
+		switch a := additional.(type) {
+		case bool:
+			if !a {
+				if _, documented := properties[name]; !documented {
+					sv.fail(path+"."+name, "is not allowed")
+				}
+			}
+		case map[string]interface{}:
+			sv.validate(a, child, path+"."+name, depth+1)
+		}
+	}
+}
+
+// schemaProperties returns the properties documented by schema and its allOf
+// branches, and whether undocumented properties must be kept (because of
+// additionalProperties or oneOf/anyOf compositions)
+func (ov *OpenAPIValidator) schemaProperties(raw interface{}, depth int) (map[string]interface{}, bool) {
+	properties := make(map[string]interface{})
+	schema, ok := ov.resolve(raw).(map[string]interface{})
+	if !ok || depth > maxSchemaDepth {
+		return properties, true
+	}
+
+	open := false
+	switch additional := schema["additionalProperties"].(type) {
+	case bool:
+		open = additional
+	case map[string]interface{}:
+		open = true
+	}
+	if schema["oneOf"] != nil || schema["anyOf"] != nil {
+		open = true
+	}
+
+	if own, ok := schema["properties"].(map[string]interface{}); ok {
+		for name, property := range own {
+			properties[name] = property
+		}
+	}
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range allOf {
+			subProperties, subOpen := ov.schemaProperties(sub, depth+1)
+			for name, property := range subProperties {
+				properties[name] = property
+			}
+			open = open || subOpen
+		}
+	}
+	return properties, open
+}
+
+// writeValidationError writes a JSON validation error response
+func writeValidationError(rw http.ResponseWriter, statusCode int, message string, details []string) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"error":   message,
+		"details": details,
+	})
+	rw.Header().Del("Content-Encoding")
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	rw.WriteHeader(statusCode)
+	rw.Write(body)
+}
+
+// logValidationErrors logs validation failures of an operation
+func logValidationErrors(logs *requestLogger, kind, outcome string, op *openAPIOperation, errs []string) {
+	logs.warnf("openapi", outcome, "OpenAPI %s validation failed for %s %s: %s", kind, strings.ToUpper(op.method), op.path, strings.Join(errs, "; "))
+}
+
+func (ow *openAPIResponseWriter) WriteHeader(statusCode int) {
+	if ow.status == 0 {
+		ow.status = statusCode
+	}
+}
+
+func (ow *openAPIResponseWriter) Write(b []byte) (int, error) {
+	if ow.status == 0 {
+		ow.status = http.StatusOK
+	}
+	return ow.body.Write(b)
+}
@@ -0,0 +1,118 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testOpenAPISpec = `{
+  "openapi": "3.0.3",
+  "paths": {
+    "/users/{id}": {
+      "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer", "minimum": 1}}],
+      "put": {
+        "parameters": [{"name": "notify", "in": "query", "schema": {"type": "boolean"}}],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/UserInput"}}}},
+        "responses": {
+          "200": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+          "4XX": {"content": {"application/json": {"schema": {"type": "object"}}}}
+        }
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "UserInput": {
+        "type": "object",
+        "required": ["name"],
+        "properties": {
+          "name": {"type": "string", "minLength": 1},
+          "email": {"type": "string", "format": "email"},
+          "role": {"type": "string", "enum": ["admin", "member"]}
+        }
+      },
+      "User": {
+        "allOf": [
+          {"$ref": "#/components/schemas/UserInput"},
+          {"type": "object", "required": ["id"], "properties": {"id": {"type": "integer"}}}
+        ]
+      }
+    }
+  }
+}`
+
+func TestModifier_OpenAPI(t *testing.T) {
+	specFile := filepath.Join(t.TempDir(), "openapi.json")
+	if err := os.WriteFile(specFile, []byte(testOpenAPISpec), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var upstreamBody string
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		upstreamBody = string(body)
+		rw.Header().Set("Content-Type", "application/json")
+		io.WriteString(rw, `{"id": 7, "name": "Jane", "password_hash": "secret"}`)
+	})
+
+	config := CreateConfig()
+	config.OpenAPI = &OpenAPIConfig{
+		SpecFile:         specFile,
+		BasePath:         "/api",
+		ValidateRequest:  true,
+		ValidateResponse: true,
+		StripUnknown:     true,
+	}
+	handler, err := New(context.Background(), next, config, "openapi")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	call := func(target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Undocumented fields are stripped from the request and the response
+	rec := call("/api/users/7?notify=true", `{"name": "Jane", "is_admin": true}`)
+	if rec.Code != http.StatusOK || upstreamBody != `{"name":"Jane"}` {
+		t.Errorf("Unexpected request %d, upstream body %s", rec.Code, upstreamBody)
+	}
+	if rec.Body.String() != `{"id":7,"name":"Jane"}` {
+		t.Errorf("Unexpected stripped response %s", rec.Body.String())
+	}
+
+	// Invalid requests are rejected with the validation details
+	rec = call("/api/users/0?notify=maybe", `{"email": "nope", "role": "owner"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400, got %d", rec.Code)
+	}
+	for _, detail := range []string{
+		`path.id: must be at least 1`,
+		`query.notify: expected boolean, got string`,
+		`body.name: is required`,
+		`body.email: must be a valid email`,
+		`body.role: must be one of [admin member]`,
+	} {
+		if !strings.Contains(rec.Body.String(), detail) {
+			t.Errorf("Expected detail %q in %s", detail, rec.Body.String())
+		}
+	}
+
+	// Undocumented operations pass through untouched
+	req := httptest.NewRequest(http.MethodGet, "/api/health", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "password_hash") {
+		t.Errorf("Unexpected passthrough response %d %s", rec.Code, rec.Body.String())
+	}
+}
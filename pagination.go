@@ -0,0 +1,346 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hukumonline-com/traefik-modifier-plugin/pkg"
+)
+
+// Pagination styles
+const (
+	paginationOffset = "offset"
+	paginationPage   = "page"
+	paginationCursor = "cursor"
+)
+
+// PaginationConfig holds the pagination translation configuration
+type PaginationConfig struct {
+	Client         string            `json:"client,omitempty"`
+	Upstream       string            `json:"upstream,omitempty"`
+	DefaultSize    int               `json:"default_size,omitempty"`
+	MaxSize        int               `json:"max_size,omitempty"`
+	ClientParams   *PaginationParams `json:"client_params,omitempty"`
+	UpstreamParams *PaginationParams `json:"upstream_params,omitempty"`
+	Items          string            `json:"items,omitempty"`
+	Total          string            `json:"total,omitempty"`
+	NextCursor     string            `json:"next_cursor,omitempty"`
+	ItemsField     string            `json:"items_field,omitempty"`
+	MetaField      string            `json:"meta_field,omitempty"`
+}
+
+// PaginationParams holds the query parameter names of a pagination style
+type PaginationParams struct {
+	Offset string `json:"offset,omitempty"`
+	Limit  string `json:"limit,omitempty"`
+	Page   string `json:"page,omitempty"`
+	Size   string `json:"size,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// Paginator translates pagination query parameters from the client style to
+// the upstream style and normalizes upstream response envelopes
+type Paginator struct {
+	client         string
+	upstream       string
+	defaultSize    int
+	maxSize        int
+	clientParams   PaginationParams
+	upstreamParams PaginationParams
+	items          string
+	total          string
+	nextCursor     string
+	itemsField     string
+	metaField      string
+}
+
+// pageRequest is the page a client asked for
+type pageRequest struct {
+	offset int
+	size   int
+	cursor string
+}
+
+// paginationResponseWriter buffers the upstream response for normalization
+type paginationResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// NewPaginator creates a new pagination translator
+func NewPaginator(config *PaginationConfig) (*Paginator, error) {
+	p := &Paginator{
+		client:      config.Client,
+		upstream:    config.Upstream,
+		defaultSize: config.DefaultSize,
+		maxSize:     config.MaxSize,
+		items:       config.Items,
+		total:       config.Total,
+		nextCursor:  config.NextCursor,
+		itemsField:  config.ItemsField,
+		metaField:   config.MetaField,
+	}
+
+	for _, style := range []*string{&p.client, &p.upstream} {
+		switch *style {
+		case "":
+			*style = paginationOffset
+		case paginationOffset, paginationPage, paginationCursor:
+		default:
+			return nil, fmt.Errorf("invalid pagination style %q", *style)
+		}
+	}
+	if p.upstream == paginationCursor && p.client != paginationCursor {
+		return nil, errors.New("cursor upstreams require cursor pagination on the client")
+	}
+	if p.upstream == paginationCursor && p.nextCursor == "" {
+		return nil, errors.New("pagination next_cursor path is required for cursor upstreams")
+	}
+
+	if p.defaultSize <= 0 {
+		p.defaultSize = 20
+	}
+	if p.maxSize <= 0 {
+		p.maxSize = 100
+	}
+	if p.itemsField == "" {
+		p.itemsField = "items"
+	}
+	if p.metaField == "" {
+		p.metaField = "pagination"
+	}
+	p.clientParams = paginationParams(config.ClientParams)
+	p.upstreamParams = paginationParams(config.UpstreamParams)
+
+	return p, nil
+}
+
+// paginationParams fills in the default parameter names
+func paginationParams(params *PaginationParams) PaginationParams {
+	result := PaginationParams{Offset: "offset", Limit: "limit", Page: "page", Size: "per_page", Cursor: "cursor"}
+	if params == nil {
+		return result
+	}
+	for _, field := range []struct {
+		target *string
+		value  string
+	}{
+		{&result.Offset, params.Offset},
+		{&result.Limit, params.Limit},
+		{&result.Page, params.Page},
+		{&result.Size, params.Size},
+		{&result.Cursor, params.Cursor},
+	} {
+		if field.value != "" {
+			*field.target = field.value
+		}
+	}
+	return result
+}
+
+// ModifyRequest rewrites the pagination query parameters of GET requests
+// into the upstream style. It returns the requested page, or nil for other
+// methods.
+func (p *Paginator) ModifyRequest(req *http.Request) (*pageRequest, error) {
+	if req.Method != http.MethodGet {
+		return nil, nil
+	}
+
+	query := req.URL.Query()
+	page := &pageRequest{size: p.defaultSize}
+
+	sizeParam := p.clientParams.Limit
+	if p.client == paginationPage {
+		sizeParam = p.clientParams.Size
+	}
+	if value := query.Get(sizeParam); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 1 {
+			return nil, fmt.Errorf("invalid %s %q", sizeParam, value)
+		}
+		page.size = size
+	}
+	if page.size > p.maxSize {
+		page.size = p.maxSize
+	}
+
+	switch p.client {
+	case paginationOffset:
+		if value := query.Get(p.clientParams.Offset); value != "" {
+			offset, err := strconv.Atoi(value)
+			if err != nil || offset < 0 {
+				return nil, fmt.Errorf("invalid %s %q", p.clientParams.Offset, value)
+			}
+			page.offset = offset
+		}
+	case paginationPage:
+		if value := query.Get(p.clientParams.Page); value != "" {
+			number, err := strconv.Atoi(value)
+			if err != nil || number < 1 {
+				return nil, fmt.Errorf("invalid %s %q", p.clientParams.Page, value)
+			}
+			page.offset = pkg.PageToOffset(number, page.size)
+		}
+	case paginationCursor:
+		cursor := query.Get(p.clientParams.Cursor)
+		if p.upstream == paginationCursor {
+			page.cursor = cursor
+		} else {
+			offset, err := pkg.DecodeCursor(cursor)
+			if err != nil {
+				return nil, err
+			}
+			page.offset = offset
+		}
+	}
+
+	for _, name := range []string{p.clientParams.Offset, p.clientParams.Limit, p.clientParams.Page, p.clientParams.Size, p.clientParams.Cursor} {
+		query.Del(name)
+	}
+	switch p.upstream {
+	case paginationOffset:
+		query.Set(p.upstreamParams.Offset, strconv.Itoa(page.offset))
+		query.Set(p.upstreamParams.Limit, strconv.Itoa(page.size))
+	case paginationPage:
+		query.Set(p.upstreamParams.Page, strconv.Itoa(pkg.OffsetToPage(page.offset, page.size)))
+		query.Set(p.upstreamParams.Size, strconv.Itoa(page.size))
+	case paginationCursor:
+		if page.cursor != "" {
+			query.Set(p.upstreamParams.Cursor, page.cursor)
+		}
+		query.Set(p.upstreamParams.Limit, strconv.Itoa(page.size))
+	}
+	req.URL.RawQuery = query.Encode()
+
+	return page, nil
+}
+
+// Handler wraps next so successful JSON list responses are returned in the
+// normalized envelope {items, pagination} of the client style
+func (p *Paginator) Handler(next http.Handler, page *pageRequest) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		pw := &paginationResponseWriter{ResponseWriter: rw}
+		next.ServeHTTP(pw, req)
+
+		status := pw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		header := rw.Header()
+		body := pw.body.Bytes()
+
+		if status >= 200 && status < 300 && header.Get("Content-Encoding") == "" {
+			if envelope, ok := p.envelope(body, page); ok {
+				if encoded, err := json.Marshal(envelope); err == nil {
+					body = encoded
+					header.Set("Content-Type", "application/json")
+					header.Set("Content-Length", strconv.Itoa(len(body)))
+				}
+			}
+		}
+
+		rw.WriteHeader(status)
+		rw.Write(body)
+	})
+}
+
+// envelope builds the normalized envelope for an upstream response body
+func (p *Paginator) envelope(body []byte, page *pageRequest) (map[string]interface{}, bool) {
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, false
+	}
+
+	var items []interface{}
+	if p.items == "" {
+		if list, ok := data.([]interface{}); ok {
+			items = list
+		} else if list, ok := paginationLookup(data, "items").([]interface{}); ok {
+			items = list
+		}
+	} else {
+		items, _ = paginationLookup(data, p.items).([]interface{})
+	}
+	if items == nil {
+		return nil, false
+	}
+
+	total := -1
+	if p.total != "" {
+		if value, ok := paginationLookup(data, p.total).(float64); ok {
+			total = int(value)
+		}
+	}
+
+	var nextCursor string
+	hasMore := len(items) >= page.size
+	switch {
+	case p.upstream == paginationCursor:
+		nextCursor, _ = paginationLookup(data, p.nextCursor).(string)
+		hasMore = nextCursor != ""
+	case total >= 0:
+		hasMore = page.offset+len(items) < total
+	}
+
+	meta := map[string]interface{}{"has_more": hasMore}
+	switch p.client {
+	case paginationOffset:
+		meta["offset"] = page.offset
+		meta["limit"] = page.size
+	case paginationPage:
+		meta["page"] = pkg.OffsetToPage(page.offset, page.size)
+		meta["per_page"] = page.size
+		if total >= 0 {
+			meta["total_pages"] = (total + page.size - 1) / page.size
+		}
+	case paginationCursor:
+		meta["limit"] = page.size
+		if p.upstream != paginationCursor && hasMore {
+			nextCursor = pkg.EncodeCursor(page.offset + len(items))
+		}
+		if nextCursor != "" {
+			meta["next_cursor"] = nextCursor
+		} else {
+			meta["next_cursor"] = nil
+		}
+	}
+	if total >= 0 {
+		meta["total"] = total
+	}
+
+	return map[string]interface{}{
+		p.itemsField: items,
+		p.metaField:  meta,
+	}, true
+}
+
+// paginationLookup returns the value at a dot separated path such as meta.total
+func paginationLookup(data interface{}, path string) interface{} {
+	for _, key := range strings.Split(path, ".") {
+		object, ok := data.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		data = object[key]
+	}
+	return data
+}
+
+func (pw *paginationResponseWriter) WriteHeader(statusCode int) {
+	if pw.status == 0 {
+		pw.status = statusCode
+	}
+}
+
+func (pw *paginationResponseWriter) Write(b []byte) (int, error) {
+	if pw.status == 0 {
+		pw.status = http.StatusOK
+	}
+	return pw.body.Write(b)
+}
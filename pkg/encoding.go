@@ -0,0 +1,44 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Base64URLEncode encodes s with the unpadded URL-safe alphabet used by JWTs
+func Base64URLEncode(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// Base64URLDecode decodes a URL-safe base64 string, with or without padding
+func Base64URLDecode(s string) (string, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(strings.TrimSpace(s), "="))
+	return string(decoded), err
+}
+
+// URLQueryEscape escapes the arguments for use as a query parameter value.
+// Unlike the text/template builtin, a single JSON number is formatted
+// without an exponent.
+func URLQueryEscape(args ...interface{}) string {
+	if len(args) == 1 {
+		return url.QueryEscape(ToString(args[0]))
+	}
+	return url.QueryEscape(fmt.Sprint(args...))
+}
+
+// URLQueryUnescape decodes an escaped query parameter value
+func URLQueryUnescape(s string) (string, error) {
+	return url.QueryUnescape(s)
+}
+
+// URLPathEscape escapes v for use as a single path segment
+func URLPathEscape(v interface{}) string {
+	return url.PathEscape(ToString(v))
+}
+
+// URLPathUnescape decodes an escaped path segment
+func URLPathUnescape(s string) (string, error) {
+	return url.PathUnescape(s)
+}
@@ -0,0 +1,976 @@
+package pkg
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Expr is a compiled expression that can be evaluated against template data,
+// e.g. request.headers['x-tier'] in ['gold', 'platinum']
+type Expr struct {
+	source string
+	root   exprNode
+}
+
+// exprNode is a node of the expression syntax tree
+type exprNode interface {
+	eval(env interface{}) (interface{}, error)
+}
+
+var (
+	exprCacheMu sync.Mutex
+	exprCache   = make(map[string]*Expr)
+)
+
+// maxExprCache bounds the number of compiled expressions kept by EvalExpr
+const maxExprCache = 1000
+
+// CompileExpr parses an expression
+func CompileExpr(source string) (*Expr, error) {
+	tokens, err := tokenizeExpr(source)
+	if err != nil {
+		return nil, fmt.Errorf("expr %q: %w", source, err)
+	}
+
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseTernary()
+	if err == nil && p.peek().kind != tokEOF {
+		err = fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("expr %q: %w", source, err)
+	}
+
+	return &Expr{source: source, root: root}, nil
+}
+
+// Eval evaluates the expression. Identifiers are looked up in env, which is
+// usually the template data map.
+func (e *Expr) Eval(env interface{}) (interface{}, error) {
+	value, err := e.root.eval(env)
+	if err != nil {
+		return nil, fmt.Errorf("expr %q: %w", e.source, err)
+	}
+	return value, nil
+}
+
+// EvalBool evaluates the expression and reports whether the result is truthy
+func (e *Expr) EvalBool(env interface{}) (bool, error) {
+	value, err := e.Eval(env)
+	if err != nil {
+		return false, err
+	}
+	return exprTruthy(value), nil
+}
+
+// EvalExpr compiles (with caching) and evaluates an expression. It backs the
+// expr template function: [[ if expr "request.method == 'POST'" . ]]
+func EvalExpr(source string, env interface{}) (interface{}, error) {
+	exprCacheMu.Lock()
+	compiled, ok := exprCache[source]
+	exprCacheMu.Unlock()
+
+	if !ok {
+		var err error
+		compiled, err = CompileExpr(source)
+		if err != nil {
+			return nil, err
+		}
+		exprCacheMu.Lock()
+		if len(exprCache) >= maxExprCache {
+			exprCache = make(map[string]*Expr)
+		}
+		exprCache[source] = compiled
+		exprCacheMu.Unlock()
+	}
+
+	return compiled.Eval(env)
+}
+
+// Tokenizer
+
+type exprTokenKind int
+
+const (
+	tokEOF exprTokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokPunct
+)
+
+type exprToken struct {
+	kind  exprTokenKind
+	text  string
+	value interface{}
+}
+
+// exprPuncts lists operators, longest first
+var exprPuncts = []string{"==", "!=", "<=", ">=", "&&", "||", "(", ")", "[", "]", "{", "}", ",", ";", ".", "?", ":", "!", "<", ">", "=", "+", "-", "*", "/", "%"}
+
+func tokenizeExpr(source string) ([]exprToken, error) {
+	var tokens []exprToken
+	i := 0
+	for i < len(source) {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#':
+			// Comments run to the end of the line
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(source) && (source[i] >= '0' && source[i] <= '9' || source[i] == '.') {
+				i++
+			}
+			number, err := strconv.ParseFloat(source[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", source[start:i])
+			}
+			tokens = append(tokens, exprToken{kind: tokNumber, text: source[start:i], value: number})
+		case c == '\'' || c == '"':
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(source) {
+					return nil, fmt.Errorf("unterminated string")
+				}
+				if source[i] == c {
+					i++
+					break
+				}
+				if source[i] == '\\' && i+1 < len(source) {
+					i++
+					switch source[i] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(source[i])
+					}
+					i++
+					continue
+				}
+				b.WriteByte(source[i])
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokString, text: b.String(), value: b.String()})
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := i
+			for i < len(source) && (source[i] == '_' || source[i] >= 'a' && source[i] <= 'z' ||
+				source[i] >= 'A' && source[i] <= 'Z' || source[i] >= '0' && source[i] <= '9') {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokIdent, text: source[start:i]})
+		default:
+			matched := false
+			for _, punct := range exprPuncts {
+				if strings.HasPrefix(source[i:], punct) {
+					tokens = append(tokens, exprToken{kind: tokPunct, text: punct})
+					i += len(punct)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+		}
+	}
+	return append(tokens, exprToken{kind: tokEOF}), nil
+}
+
+// Parser
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	token := p.tokens[p.pos]
+	if token.kind != tokEOF {
+		p.pos++
+	}
+	return token
+}
+
+// accept consumes the next token if it is one of the given punctuations or keywords
+func (p *exprParser) accept(texts ...string) (string, bool) {
+	token := p.peek()
+	if token.kind != tokPunct && token.kind != tokIdent {
+		return "", false
+	}
+	for _, text := range texts {
+		if token.text == text {
+			p.pos++
+			return text, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) expect(text string) error {
+	if _, ok := p.accept(text); !ok {
+		return fmt.Errorf("expected %q, got %q", text, p.peek().text)
+	}
+	return nil
+}
+
+func (p *exprParser) parseTernary() (exprNode, error) {
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.accept("?"); !ok {
+		return cond, nil
+	}
+	then, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	otherwise, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	return &ternaryNode{cond: cond, then: then, otherwise: otherwise}, nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||", "or"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "||", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&", "and"); !ok {
+			return left, nil
+		}
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "&&", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	negate := false
+	if p.peek().kind == tokIdent && p.peek().text == "not" && p.tokens[p.pos+1].text == "in" {
+		p.pos++
+		negate = true
+	}
+	op, ok := p.accept("==", "!=", "<", "<=", ">", ">=", "in", "contains", "startsWith", "endsWith", "matches")
+	if !ok {
+		return left, nil
+	}
+
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	node := &binaryNode{op: op, left: left, right: right}
+	if op == "matches" {
+		if literal, ok := right.(*literalNode); ok {
+			pattern, _ := literal.value.(string)
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			node.re = re
+		}
+	}
+	if negate {
+		return &notNode{operand: node}, nil
+	}
+	return node, nil
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseMultiplicative() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("*", "/", "%")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if _, ok := p.accept("!", "not"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	if _, ok := p.accept("-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{op: "-", left: &literalNode{value: float64(0)}, right: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *exprParser) parsePostfix() (exprNode, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("."); ok {
+			name := p.next()
+			if name.kind != tokIdent {
+				return nil, fmt.Errorf("expected field name after '.', got %q", name.text)
+			}
+			node = &indexNode{target: node, index: &literalNode{value: name.text}}
+			continue
+		}
+		if _, ok := p.accept("["); ok {
+			index, err := p.parseTernary()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			node = &indexNode{target: node, index: index}
+			continue
+		}
+		return node, nil
+	}
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	token := p.next()
+	switch token.kind {
+	case tokNumber, tokString:
+		return &literalNode{value: token.value}, nil
+	case tokIdent:
+		switch token.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null", "nil":
+			return &literalNode{value: nil}, nil
+		}
+		if _, ok := p.accept("("); ok {
+			fn, exists := exprFuncs[token.text]
+			if !exists {
+				return nil, fmt.Errorf("unknown function %q", token.text)
+			}
+			args, err := p.parseList(")")
+			if err != nil {
+				return nil, err
+			}
+			return &callNode{name: token.text, fn: fn, args: args}, nil
+		}
+		return &identNode{name: token.text}, nil
+	case tokPunct:
+		switch token.text {
+		case "(":
+			node, err := p.parseTernary()
+			if err != nil {
+				return nil, err
+			}
+			return node, p.expect(")")
+		case "[":
+			items, err := p.parseList("]")
+			if err != nil {
+				return nil, err
+			}
+			return &listNode{items: items}, nil
+		case "{":
+			return p.parseMap()
+		}
+	}
+	if token.kind == tokEOF {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q", token.text)
+}
+
+// parseMap parses a map literal such as {name: 'x', 'full-name': y}
+func (p *exprParser) parseMap() (exprNode, error) {
+	node := &mapNode{}
+	if _, ok := p.accept("}"); ok {
+		return node, nil
+	}
+	for {
+		key := p.next()
+		if key.kind != tokIdent && key.kind != tokString {
+			return nil, fmt.Errorf("expected map key, got %q", key.text)
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseTernary()
+		if err != nil {
+			return nil, err
+		}
+		node.keys = append(node.keys, key.text)
+		node.values = append(node.values, value)
+		if _, ok := p.accept(","); ok {
+			continue
+		}
+		return node, p.expect("}")
+	}
+}
+
+// parseList parses comma separated expressions up to the closing token
+func (p *exprParser) parseList(closing string) ([]exprNode, error) {
+	var items []exprNode
+	if _, ok := p.accept(closing); ok {
+		return items, nil
+	}
+	for {
+		item, err := p.parseTernary()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if _, ok := p.accept(","); ok {
+			continue
+		}
+		return items, p.expect(closing)
+	}
+}
+
+// Nodes
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(env interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+type identNode struct {
+	name string
+}
+
+func (n *identNode) eval(env interface{}) (interface{}, error) {
+	return exprLookup(env, n.name), nil
+}
+
+type indexNode struct {
+	target exprNode
+	index  exprNode
+}
+
+func (n *indexNode) eval(env interface{}) (interface{}, error) {
+	target, err := n.target.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	index, err := n.index.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	if number, ok := exprNumber(index); ok {
+		v := reflect.ValueOf(target)
+		if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+			i := int(number)
+			if i < 0 {
+				i += v.Len()
+			}
+			if i < 0 || i >= v.Len() {
+				return nil, nil
+			}
+			return v.Index(i).Interface(), nil
+		}
+	}
+	return exprLookup(target, fmt.Sprint(index)), nil
+}
+
+type listNode struct {
+	items []exprNode
+}
+
+func (n *listNode) eval(env interface{}) (interface{}, error) {
+	values := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		value, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+type mapNode struct {
+	keys   []string
+	values []exprNode
+}
+
+func (n *mapNode) eval(env interface{}) (interface{}, error) {
+	values := make(map[string]interface{}, len(n.keys))
+	for i, key := range n.keys {
+		value, err := n.values[i].eval(env)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+type notNode struct {
+	operand exprNode
+}
+
+func (n *notNode) eval(env interface{}) (interface{}, error) {
+	value, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return !exprTruthy(value), nil
+}
+
+type ternaryNode struct {
+	cond, then, otherwise exprNode
+}
+
+func (n *ternaryNode) eval(env interface{}) (interface{}, error) {
+	cond, err := n.cond.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if exprTruthy(cond) {
+		return n.then.eval(env)
+	}
+	return n.otherwise.eval(env)
+}
+
+type logicalNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *logicalNode) eval(env interface{}) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "&&" && !exprTruthy(left) {
+		return false, nil
+	}
+	if n.op == "||" && exprTruthy(left) {
+		return true, nil
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return exprTruthy(right), nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right exprNode
+	re          *regexp.Regexp
+}
+
+func (n *binaryNode) eval(env interface{}) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return exprEqual(left, right), nil
+	case "!=":
+		return !exprEqual(left, right), nil
+	case "in":
+		return exprContains(right, left), nil
+	case "contains":
+		return exprContains(left, right), nil
+	case "startsWith":
+		return strings.HasPrefix(exprString(left), exprString(right)), nil
+	case "endsWith":
+		return strings.HasSuffix(exprString(left), exprString(right)), nil
+	case "matches":
+		re := n.re
+		if re == nil {
+			if re, err = regexp.Compile(exprString(right)); err != nil {
+				return nil, err
+			}
+		}
+		return re.MatchString(exprString(left)), nil
+	case "<", "<=", ">", ">=":
+		ordered, err := exprCompare(n.op, left, right)
+		if err != nil {
+			return nil, err
+		}
+		return ordered, nil
+	case "+":
+		if l, ok := exprNumber(left); ok {
+			if r, ok := exprNumber(right); ok {
+				return l + r, nil
+			}
+		}
+		return exprString(left) + exprString(right), nil
+	}
+
+	l, lok := exprNumber(left)
+	r, rok := exprNumber(right)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operator %s requires numbers, got %v and %v", n.op, left, right)
+	}
+	switch n.op {
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	default:
+		if int64(r) == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return float64(int64(l) % int64(r)), nil
+	}
+}
+
+type callNode struct {
+	name string
+	fn   func(args []interface{}) (interface{}, error)
+	args []exprNode
+}
+
+func (n *callNode) eval(env interface{}) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	value, err := n.fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return value, nil
+}
+
+// exprFuncs are the functions callable from expressions
+var exprFuncs = map[string]func(args []interface{}) (interface{}, error){
+	"len": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected 1 argument")
+		}
+		if s, ok := args[0].(string); ok {
+			return float64(len(s)), nil
+		}
+		v := reflect.ValueOf(args[0])
+		switch v.Kind() {
+		case reflect.Slice, reflect.Array, reflect.Map:
+			return float64(v.Len()), nil
+		}
+		return float64(0), nil
+	},
+	"lower": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected 1 argument")
+		}
+		return strings.ToLower(exprString(args[0])), nil
+	},
+	"upper": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected 1 argument")
+		}
+		return strings.ToUpper(exprString(args[0])), nil
+	},
+	"trim": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected 1 argument")
+		}
+		return strings.TrimSpace(exprString(args[0])), nil
+	},
+	"string": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected 1 argument")
+		}
+		return exprString(args[0]), nil
+	},
+	"number": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected 1 argument")
+		}
+		if number, ok := exprNumber(args[0]); ok {
+			return number, nil
+		}
+		number, err := strconv.ParseFloat(strings.TrimSpace(exprString(args[0])), 64)
+		if err != nil {
+			return nil, err
+		}
+		return number, nil
+	},
+	"has": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected 1 argument")
+		}
+		return args[0] != nil, nil
+	},
+	"append": func(args []interface{}) (interface{}, error) {
+		if len(args) < 1 {
+			return nil, fmt.Errorf("expected at least 1 argument")
+		}
+		var list []interface{}
+		if args[0] != nil {
+			v := reflect.ValueOf(args[0])
+			if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+				return nil, fmt.Errorf("first argument must be a list")
+			}
+			for i := 0; i < v.Len(); i++ {
+				list = append(list, v.Index(i).Interface())
+			}
+		}
+		return append(list, args[1:]...), nil
+	},
+	"keys": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected 1 argument")
+		}
+		v := reflect.ValueOf(args[0])
+		if v.Kind() != reflect.Map {
+			return []interface{}{}, nil
+		}
+		keys := make([]string, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			keys = append(keys, fmt.Sprint(key.Interface()))
+		}
+		sort.Strings(keys)
+		list := make([]interface{}, len(keys))
+		for i, key := range keys {
+			list[i] = key
+		}
+		return list, nil
+	},
+}
+
+// Value helpers
+
+// exprLookup returns the value of key in a map, or nil
+func exprLookup(target interface{}, key string) interface{} {
+	switch m := target.(type) {
+	case map[string]interface{}:
+		return m[key]
+	case map[string]string:
+		if value, ok := m[key]; ok {
+			return value
+		}
+		return nil
+	}
+
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+		return nil
+	}
+	value := v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))
+	if !value.IsValid() {
+		return nil
+	}
+	return value.Interface()
+}
+
+// exprNumber converts numeric values to float64
+func exprNumber(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// exprString formats a value as a string; nil becomes empty
+func exprString(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	if n, ok := exprNumber(value); ok {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// exprTruthy reports whether a value counts as true
+func exprTruthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	}
+	if n, ok := exprNumber(value); ok {
+		return n != 0
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len() > 0
+	}
+	return true
+}
+
+// exprEqual compares values, treating all numeric types alike
+func exprEqual(left, right interface{}) bool {
+	if l, ok := exprNumber(left); ok {
+		r, ok := exprNumber(right)
+		return ok && l == r
+	}
+	if left == nil || right == nil {
+		return left == nil && right == nil
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+// exprContains reports whether a list holds item, a map has key item, or a
+// string contains item
+func exprContains(container, item interface{}) bool {
+	if s, ok := container.(string); ok {
+		return strings.Contains(s, exprString(item))
+	}
+
+	v := reflect.ValueOf(container)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if exprEqual(v.Index(i).Interface(), item) {
+				return true
+			}
+		}
+	case reflect.Map:
+		return exprLookup(container, exprString(item)) != nil
+	}
+	return false
+}
+
+// exprCompare orders two numbers or two strings
+func exprCompare(op string, left, right interface{}) (bool, error) {
+	var cmp int
+	l, lok := exprNumber(left)
+	r, rok := exprNumber(right)
+	switch {
+	case lok && rok:
+		if l < r {
+			cmp = -1
+		} else if l > r {
+			cmp = 1
+		}
+	default:
+		ls, lok := left.(string)
+		rs, rok := right.(string)
+		if !lok || !rok {
+			return false, fmt.Errorf("cannot compare %v and %v", left, right)
+		}
+		cmp = strings.Compare(ls, rs)
+	}
+
+	switch op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
@@ -0,0 +1,54 @@
+package pkg
+
+import "testing"
+
+func TestEvalExpr(t *testing.T) {
+	data := map[string]interface{}{
+		"request": map[string]interface{}{
+			"method":  "POST",
+			"path":    "/api/v1/orders",
+			"headers": map[string]string{"x-tier": "gold", "x-region": "id"},
+			"api": map[string]interface{}{
+				"body": map[string]interface{}{
+					"amount": float64(1500),
+					"items":  []interface{}{"a", "b", "c"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		expression string
+		expected   interface{}
+	}{
+		{`request.headers['x-tier'] in ['gold', 'platinum']`, true},
+		{`request.headers["x-tier"] not in ['gold']`, false},
+		{`request.method == 'POST' && request.api.body.amount > 1000`, true},
+		{`request.method == 'GET' or not (request.path startsWith '/api')`, false},
+		{`request.path matches '^/api/v[0-9]+/'`, true},
+		{`request.headers.missing == null`, true},
+		{`len(request.api.body.items) * 2 + 1`, float64(7)},
+		{`request.api.body.items[-1]`, "c"},
+		{`request.api.body.amount >= 1000 ? 'large' : 'small'`, "large"},
+		{`upper(request.headers['x-region']) + '-' + request.method`, "ID-POST"},
+		{`request.api.body.items contains 'b' and has(request.headers['x-region'])`, true},
+		{`number('42') % 5`, float64(2)},
+	}
+
+	for _, tt := range tests {
+		actual, err := EvalExpr(tt.expression, data)
+		if err != nil {
+			t.Errorf("EvalExpr(%q) error = %v", tt.expression, err)
+			continue
+		}
+		if actual != tt.expected {
+			t.Errorf("EvalExpr(%q) = %v, expected %v", tt.expression, actual, tt.expected)
+		}
+	}
+
+	for _, invalid := range []string{`request.method ==`, `unknown(1)`, `'unterminated`, `1 < 'a'`} {
+		if _, err := EvalExpr(invalid, data); err == nil {
+			t.Errorf("EvalExpr(%q) expected error", invalid)
+		}
+	}
+}
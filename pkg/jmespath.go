@@ -0,0 +1,1346 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// JMESPath is a compiled JMESPath expression, e.g.
+// people[?age > `20`].{name: name, city: address.city}
+type JMESPath struct {
+	source string
+	root   jmesNode
+}
+
+// jmesNode is a node of the JMESPath syntax tree
+type jmesNode interface {
+	eval(value interface{}) (interface{}, error)
+}
+
+var (
+	jmesCacheMu sync.Mutex
+	jmesCache   = make(map[string]*JMESPath)
+)
+
+// maxJMESPathCache bounds the number of compiled expressions kept by
+// SearchJMESPath
+const maxJMESPathCache = 1000
+
+// CompileJMESPath parses a JMESPath expression
+func CompileJMESPath(source string) (*JMESPath, error) {
+	tokens, err := tokenizeJMESPath(source)
+	if err != nil {
+		return nil, fmt.Errorf("jmespath %q: %w", source, err)
+	}
+
+	p := &jmesParser{tokens: tokens}
+	root, err := p.parseExpression(0)
+	if err == nil && p.peek().kind != jmesEOF {
+		err = fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("jmespath %q: %w", source, err)
+	}
+	return &JMESPath{source: source, root: root}, nil
+}
+
+// Search evaluates the expression against data
+func (j *JMESPath) Search(data interface{}) (interface{}, error) {
+	value, err := j.root.eval(normalizeJSON(data))
+	if err != nil {
+		return nil, fmt.Errorf("jmespath %q: %w", j.source, err)
+	}
+	return value, nil
+}
+
+// SearchJMESPath compiles expression, caching the result, and evaluates it
+// against data. It backs the jmespath template function.
+func SearchJMESPath(expression string, data interface{}) (interface{}, error) {
+	jmesCacheMu.Lock()
+	compiled, ok := jmesCache[expression]
+	jmesCacheMu.Unlock()
+
+	if !ok {
+		var err error
+		compiled, err = CompileJMESPath(expression)
+		if err != nil {
+			return nil, err
+		}
+		jmesCacheMu.Lock()
+		if len(jmesCache) >= maxJMESPathCache {
+			jmesCache = make(map[string]*JMESPath)
+		}
+		jmesCache[expression] = compiled
+		jmesCacheMu.Unlock()
+	}
+
+	return compiled.Search(data)
+}
+
+// Tokenizer
+
+type jmesTokenKind int
+
+const (
+	jmesEOF jmesTokenKind = iota
+	jmesIdent
+	jmesQuoted
+	jmesRawString
+	jmesLiteral
+	jmesNumber
+	jmesPunct
+)
+
+type jmesToken struct {
+	kind  jmesTokenKind
+	text  string
+	value interface{}
+}
+
+// jmesPuncts lists operators, longest first. "[?" starts a filter and "[]"
+// flattens.
+var jmesPuncts = []string{"[?", "[]", "||", "&&", "==", "!=", "<=", ">=", "<", ">", "!", "|", "&", ".", "*", "[", "]", "{", "}", "(", ")", ",", ":", "@"}
+
+// jmesBindingPowers ranks the operators for the Pratt parser
+var jmesBindingPowers = map[string]int{
+	"|":  1,
+	"||": 2,
+	"&&": 3,
+	"==": 5, "!=": 5, "<": 5, "<=": 5, ">": 5, ">=": 5,
+	"[]": 9,
+	"*":  20,
+	"[?": 21,
+	".":  40,
+	"!":  45,
+	"{":  50,
+	"[":  55,
+	"(":  60,
+}
+
+func isJMESIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func tokenizeJMESPath(source string) ([]jmesToken, error) {
+	var tokens []jmesToken
+	i := 0
+	for i < len(source) {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isJMESIdentStart(c):
+			start := i
+			for i < len(source) && (isJMESIdentStart(source[i]) || source[i] >= '0' && source[i] <= '9') {
+				i++
+			}
+			tokens = append(tokens, jmesToken{kind: jmesIdent, text: source[start:i]})
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(source) && source[i+1] >= '0' && source[i+1] <= '9':
+			start := i
+			i++
+			for i < len(source) && source[i] >= '0' && source[i] <= '9' {
+				i++
+			}
+			n, err := strconv.Atoi(source[start:i])
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", source[start:i])
+			}
+			tokens = append(tokens, jmesToken{kind: jmesNumber, text: source[start:i], value: n})
+		case c == '"':
+			end, err := jmesDelimited(source, i, '"')
+			if err != nil {
+				return nil, err
+			}
+			var name string
+			if err := json.Unmarshal([]byte(source[i:end]), &name); err != nil {
+				return nil, fmt.Errorf("invalid quoted identifier %s", source[i:end])
+			}
+			tokens = append(tokens, jmesToken{kind: jmesQuoted, text: source[i:end], value: name})
+			i = end
+		case c == '\'':
+			end, err := jmesDelimited(source, i, '\'')
+			if err != nil {
+				return nil, err
+			}
+			raw := strings.ReplaceAll(source[i+1:end-1], `\'`, `'`)
+			tokens = append(tokens, jmesToken{kind: jmesRawString, text: source[i:end], value: raw})
+			i = end
+		case c == '`':
+			end, err := jmesDelimited(source, i, '`')
+			if err != nil {
+				return nil, err
+			}
+			literal := strings.TrimSpace(strings.ReplaceAll(source[i+1:end-1], "\\`", "`"))
+			var value interface{}
+			if err := json.Unmarshal([]byte(literal), &value); err != nil {
+				return nil, fmt.Errorf("invalid literal `%s`", literal)
+			}
+			tokens = append(tokens, jmesToken{kind: jmesLiteral, text: source[i:end], value: value})
+			i = end
+		default:
+			matched := false
+			for _, punct := range jmesPuncts {
+				if strings.HasPrefix(source[i:], punct) {
+					tokens = append(tokens, jmesToken{kind: jmesPunct, text: punct})
+					i += len(punct)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+		}
+	}
+	return append(tokens, jmesToken{kind: jmesEOF}), nil
+}
+
+// jmesDelimited returns the offset after the token delimited by quote that
+// starts at source[start], skipping backslash escapes
+func jmesDelimited(source string, start int, quote byte) (int, error) {
+	for i := start + 1; i < len(source); i++ {
+		switch source[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated %c at offset %d", quote, start)
+}
+
+// Parser
+
+type jmesParser struct {
+	tokens []jmesToken
+	pos    int
+}
+
+func (p *jmesParser) peek() jmesToken {
+	return p.tokens[p.pos]
+}
+
+func (p *jmesParser) next() jmesToken {
+	token := p.tokens[p.pos]
+	if token.kind != jmesEOF {
+		p.pos++
+	}
+	return token
+}
+
+// peekPunct reports whether the next token is the given punctuation
+func (p *jmesParser) peekPunct(text string) bool {
+	token := p.peek()
+	return token.kind == jmesPunct && token.text == text
+}
+
+func (p *jmesParser) expect(text string) error {
+	if !p.peekPunct(text) {
+		return fmt.Errorf("expected %q, got %q", text, p.peek().text)
+	}
+	p.pos++
+	return nil
+}
+
+// bindingPower returns the binding power of the next token
+func (p *jmesParser) bindingPower() int {
+	token := p.peek()
+	if token.kind != jmesPunct {
+		return 0
+	}
+	return jmesBindingPowers[token.text]
+}
+
+// parseExpression parses tokens while they bind tighter than power
+func (p *jmesParser) parseExpression(power int) (jmesNode, error) {
+	left, err := p.nud(p.next())
+	if err != nil {
+		return nil, err
+	}
+	for power < p.bindingPower() {
+		if left, err = p.led(p.next(), left); err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+// nud parses a token at the start of an expression
+func (p *jmesParser) nud(token jmesToken) (jmesNode, error) {
+	switch token.kind {
+	case jmesLiteral, jmesRawString:
+		return &jmesLiteralNode{value: token.value}, nil
+	case jmesQuoted:
+		if p.peekPunct("(") {
+			return nil, errors.New("quoted identifiers cannot be function names")
+		}
+		return &jmesFieldNode{name: token.value.(string)}, nil
+	case jmesIdent:
+		if p.peekPunct("(") {
+			p.next()
+			return p.parseFunction(token.text)
+		}
+		return &jmesFieldNode{name: token.text}, nil
+	case jmesEOF:
+		return nil, errors.New("unexpected end of expression")
+	case jmesNumber:
+		return nil, fmt.Errorf("unexpected number %s, use a literal such as `%s`", token.text, token.text)
+	}
+
+	switch token.text {
+	case "@":
+		return &jmesCurrentNode{}, nil
+	case "*":
+		right, err := p.parseProjectionRHS(jmesBindingPowers["*"])
+		if err != nil {
+			return nil, err
+		}
+		return &jmesValueProjectionNode{left: &jmesCurrentNode{}, right: right}, nil
+	case "[?":
+		return p.parseFilter(&jmesCurrentNode{})
+	case "[]":
+		right, err := p.parseProjectionRHS(jmesBindingPowers["[]"])
+		if err != nil {
+			return nil, err
+		}
+		return &jmesProjectionNode{left: &jmesFlattenNode{target: &jmesCurrentNode{}}, right: right}, nil
+	case "[":
+		if p.peek().kind == jmesNumber || p.peekPunct(":") {
+			return p.parseIndex(&jmesCurrentNode{})
+		}
+		if p.peekPunct("*") && p.tokens[p.pos+1].text == "]" {
+			p.pos += 2
+			right, err := p.parseProjectionRHS(jmesBindingPowers["*"])
+			if err != nil {
+				return nil, err
+			}
+			return &jmesProjectionNode{left: &jmesCurrentNode{}, right: right}, nil
+		}
+		return p.parseMultiSelectList()
+	case "{":
+		return p.parseMultiSelectHash()
+	case "&":
+		inner, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		return &jmesExprRefNode{inner: inner}, nil
+	case "!":
+		inner, err := p.parseExpression(jmesBindingPowers["!"])
+		if err != nil {
+			return nil, err
+		}
+		return &jmesNotNode{inner: inner}, nil
+	case "(":
+		inner, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	}
+	return nil, fmt.Errorf("unexpected %q", token.text)
+}
+
+// led parses an operator following left
+func (p *jmesParser) led(token jmesToken, left jmesNode) (jmesNode, error) {
+	switch token.text {
+	case ".":
+		if p.peekPunct("*") {
+			p.next()
+			right, err := p.parseProjectionRHS(jmesBindingPowers["."])
+			if err != nil {
+				return nil, err
+			}
+			return &jmesValueProjectionNode{left: left, right: right}, nil
+		}
+		right, err := p.parseDotRHS(jmesBindingPowers["."])
+		if err != nil {
+			return nil, err
+		}
+		return &jmesSubexpressionNode{left: left, right: right}, nil
+	case "|":
+		right, err := p.parseExpression(jmesBindingPowers["|"])
+		if err != nil {
+			return nil, err
+		}
+		return &jmesPipeNode{left: left, right: right}, nil
+	case "||", "&&":
+		right, err := p.parseExpression(jmesBindingPowers[token.text])
+		if err != nil {
+			return nil, err
+		}
+		return &jmesLogicalNode{op: token.text, left: left, right: right}, nil
+	case "==", "!=", "<", "<=", ">", ">=":
+		right, err := p.parseExpression(jmesBindingPowers[token.text])
+		if err != nil {
+			return nil, err
+		}
+		return &jmesComparisonNode{op: token.text, left: left, right: right}, nil
+	case "[?":
+		return p.parseFilter(left)
+	case "[]":
+		right, err := p.parseProjectionRHS(jmesBindingPowers["[]"])
+		if err != nil {
+			return nil, err
+		}
+		return &jmesProjectionNode{left: &jmesFlattenNode{target: left}, right: right}, nil
+	case "[":
+		if p.peek().kind == jmesNumber || p.peekPunct(":") {
+			return p.parseIndex(left)
+		}
+		if err := p.expect("*"); err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		right, err := p.parseProjectionRHS(jmesBindingPowers["*"])
+		if err != nil {
+			return nil, err
+		}
+		return &jmesProjectionNode{left: left, right: right}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", token.text)
+}
+
+// parseIndex parses [n] or [start:stop:step] after the [
+func (p *jmesParser) parseIndex(target jmesNode) (jmesNode, error) {
+	var parts [3]*int
+	part := 0
+	for !p.peekPunct("]") {
+		token := p.next()
+		switch {
+		case token.kind == jmesNumber:
+			n := token.value.(int)
+			parts[part] = &n
+		case token.kind == jmesPunct && token.text == ":" && part < 2:
+			part++
+		default:
+			return nil, fmt.Errorf("unexpected %q in index", token.text)
+		}
+	}
+	p.next()
+
+	if part == 0 {
+		if parts[0] == nil {
+			return nil, errors.New("empty index")
+		}
+		return &jmesIndexNode{target: target, index: *parts[0]}, nil
+	}
+	if parts[2] != nil && *parts[2] == 0 {
+		return nil, errors.New("slice step cannot be 0")
+	}
+	right, err := p.parseProjectionRHS(jmesBindingPowers["*"])
+	if err != nil {
+		return nil, err
+	}
+	return &jmesProjectionNode{left: &jmesSliceNode{target: target, parts: parts}, right: right}, nil
+}
+
+// parseFilter parses [?condition] after the [?
+func (p *jmesParser) parseFilter(target jmesNode) (jmesNode, error) {
+	cond, err := p.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	right, err := p.parseProjectionRHS(jmesBindingPowers["[?"])
+	if err != nil {
+		return nil, err
+	}
+	return &jmesFilterNode{target: target, cond: cond, right: right}, nil
+}
+
+// parseDotRHS parses what may follow a dot: a field, a multi-select list
+// or a multi-select hash
+func (p *jmesParser) parseDotRHS(power int) (jmesNode, error) {
+	token := p.peek()
+	switch {
+	case token.kind == jmesIdent || token.kind == jmesQuoted:
+		return p.parseExpression(power)
+	case token.kind == jmesPunct && token.text == "[":
+		p.next()
+		return p.parseMultiSelectList()
+	case token.kind == jmesPunct && token.text == "{":
+		p.next()
+		return p.parseMultiSelectHash()
+	}
+	return nil, fmt.Errorf("unexpected %q after '.'", token.text)
+}
+
+// parseProjectionRHS parses the expression applied to every projected item
+func (p *jmesParser) parseProjectionRHS(power int) (jmesNode, error) {
+	if p.bindingPower() < 10 {
+		return &jmesCurrentNode{}, nil
+	}
+	switch {
+	case p.peekPunct("[") || p.peekPunct("[?"):
+		return p.parseExpression(power)
+	case p.peekPunct("."):
+		p.next()
+		return p.parseDotRHS(power)
+	}
+	return nil, fmt.Errorf("unexpected %q after projection", p.peek().text)
+}
+
+// parseMultiSelectList parses [a, b] after the [
+func (p *jmesParser) parseMultiSelectList() (jmesNode, error) {
+	node := &jmesMultiSelectListNode{}
+	for {
+		item, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		node.items = append(node.items, item)
+		if p.peekPunct("]") {
+			p.next()
+			return node, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseMultiSelectHash parses {key: value, ...} after the {
+func (p *jmesParser) parseMultiSelectHash() (jmesNode, error) {
+	node := &jmesMultiSelectHashNode{}
+	for {
+		token := p.next()
+		var key string
+		switch token.kind {
+		case jmesIdent:
+			key = token.text
+		case jmesQuoted:
+			key = token.value.(string)
+		default:
+			return nil, fmt.Errorf("expected a key, got %q", token.text)
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		node.keys = append(node.keys, key)
+		node.values = append(node.values, value)
+		if p.peekPunct("}") {
+			p.next()
+			return node, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseFunction parses the arguments of name(...) after the (
+func (p *jmesParser) parseFunction(name string) (jmesNode, error) {
+	fn, ok := jmesFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s()", name)
+	}
+	node := &jmesFunctionNode{name: name, fn: fn}
+	for !p.peekPunct(")") {
+		arg, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		node.args = append(node.args, arg)
+		if !p.peekPunct(")") {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+	p.next()
+
+	if len(node.args) < fn.minArgs || fn.maxArgs >= 0 && len(node.args) > fn.maxArgs {
+		return nil, fmt.Errorf("wrong number of arguments for %s()", name)
+	}
+	return node, nil
+}
+
+// Nodes
+
+type jmesCurrentNode struct{}
+
+func (n *jmesCurrentNode) eval(value interface{}) (interface{}, error) {
+	return value, nil
+}
+
+type jmesLiteralNode struct {
+	value interface{}
+}
+
+func (n *jmesLiteralNode) eval(value interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+type jmesFieldNode struct {
+	name string
+}
+
+func (n *jmesFieldNode) eval(value interface{}) (interface{}, error) {
+	if object, ok := value.(map[string]interface{}); ok {
+		return object[n.name], nil
+	}
+	return nil, nil
+}
+
+type jmesSubexpressionNode struct {
+	left  jmesNode
+	right jmesNode
+}
+
+func (n *jmesSubexpressionNode) eval(value interface{}) (interface{}, error) {
+	left, err := n.left.eval(value)
+	if err != nil {
+		return nil, err
+	}
+	return n.right.eval(left)
+}
+
+type jmesPipeNode struct {
+	left  jmesNode
+	right jmesNode
+}
+
+func (n *jmesPipeNode) eval(value interface{}) (interface{}, error) {
+	left, err := n.left.eval(value)
+	if err != nil {
+		return nil, err
+	}
+	return n.right.eval(left)
+}
+
+type jmesIndexNode struct {
+	target jmesNode
+	index  int
+}
+
+func (n *jmesIndexNode) eval(value interface{}) (interface{}, error) {
+	target, err := n.target.eval(value)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := target.([]interface{})
+	if !ok {
+		return nil, nil
+	}
+	index := n.index
+	if index < 0 {
+		index += len(list)
+	}
+	if index < 0 || index >= len(list) {
+		return nil, nil
+	}
+	return list[index], nil
+}
+
+type jmesSliceNode struct {
+	target jmesNode
+	parts  [3]*int
+}
+
+func (n *jmesSliceNode) eval(value interface{}) (interface{}, error) {
+	target, err := n.target.eval(value)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := target.([]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	step := 1
+	if n.parts[2] != nil {
+		step = *n.parts[2]
+	}
+	length := len(list)
+	bound := func(part *int, fallback int) int {
+		if part == nil {
+			return fallback
+		}
+		index := *part
+		if index < 0 {
+			index += length
+			if index < 0 {
+				if step < 0 {
+					return -1
+				}
+				return 0
+			}
+		} else if index >= length {
+			if step < 0 {
+				return length - 1
+			}
+			return length
+		}
+		return index
+	}
+
+	result := []interface{}{}
+	if step > 0 {
+		for i := bound(n.parts[0], 0); i < bound(n.parts[1], length); i += step {
+			result = append(result, list[i])
+		}
+	} else {
+		for i := bound(n.parts[0], length-1); i > bound(n.parts[1], -1); i += step {
+			result = append(result, list[i])
+		}
+	}
+	return result, nil
+}
+
+type jmesProjectionNode struct {
+	left  jmesNode
+	right jmesNode
+}
+
+func (n *jmesProjectionNode) eval(value interface{}) (interface{}, error) {
+	left, err := n.left.eval(value)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := left.([]interface{})
+	if !ok {
+		return nil, nil
+	}
+	return jmesProject(list, n.right)
+}
+
+// jmesProject applies right to every item, dropping null results
+func jmesProject(items []interface{}, right jmesNode) (interface{}, error) {
+	result := []interface{}{}
+	for _, item := range items {
+		projected, err := right.eval(item)
+		if err != nil {
+			return nil, err
+		}
+		if projected != nil {
+			result = append(result, projected)
+		}
+	}
+	return result, nil
+}
+
+type jmesValueProjectionNode struct {
+	left  jmesNode
+	right jmesNode
+}
+
+func (n *jmesValueProjectionNode) eval(value interface{}) (interface{}, error) {
+	left, err := n.left.eval(value)
+	if err != nil {
+		return nil, err
+	}
+	object, ok := left.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	values := make([]interface{}, 0, len(object))
+	for _, key := range Keys(object) {
+		values = append(values, object[key])
+	}
+	return jmesProject(values, n.right)
+}
+
+type jmesFlattenNode struct {
+	target jmesNode
+}
+
+func (n *jmesFlattenNode) eval(value interface{}) (interface{}, error) {
+	target, err := n.target.eval(value)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := target.([]interface{})
+	if !ok {
+		return nil, nil
+	}
+	result := []interface{}{}
+	for _, item := range list {
+		if nested, ok := item.([]interface{}); ok {
+			result = append(result, nested...)
+		} else {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+type jmesFilterNode struct {
+	target jmesNode
+	cond   jmesNode
+	right  jmesNode
+}
+
+func (n *jmesFilterNode) eval(value interface{}) (interface{}, error) {
+	target, err := n.target.eval(value)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := target.([]interface{})
+	if !ok {
+		return nil, nil
+	}
+	var matched []interface{}
+	for _, item := range list {
+		cond, err := n.cond.eval(item)
+		if err != nil {
+			return nil, err
+		}
+		if jmesTruthy(cond) {
+			matched = append(matched, item)
+		}
+	}
+	return jmesProject(matched, n.right)
+}
+
+type jmesMultiSelectListNode struct {
+	items []jmesNode
+}
+
+func (n *jmesMultiSelectListNode) eval(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	result := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		selected, err := item.eval(value)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = selected
+	}
+	return result, nil
+}
+
+type jmesMultiSelectHashNode struct {
+	keys   []string
+	values []jmesNode
+}
+
+func (n *jmesMultiSelectHashNode) eval(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	result := make(map[string]interface{}, len(n.keys))
+	for i, key := range n.keys {
+		selected, err := n.values[i].eval(value)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = selected
+	}
+	return result, nil
+}
+
+type jmesLogicalNode struct {
+	op    string
+	left  jmesNode
+	right jmesNode
+}
+
+func (n *jmesLogicalNode) eval(value interface{}) (interface{}, error) {
+	left, err := n.left.eval(value)
+	if err != nil {
+		return nil, err
+	}
+	if jmesTruthy(left) == (n.op == "||") {
+		return left, nil
+	}
+	return n.right.eval(value)
+}
+
+type jmesNotNode struct {
+	inner jmesNode
+}
+
+func (n *jmesNotNode) eval(value interface{}) (interface{}, error) {
+	inner, err := n.inner.eval(value)
+	if err != nil {
+		return nil, err
+	}
+	return !jmesTruthy(inner), nil
+}
+
+type jmesComparisonNode struct {
+	op    string
+	left  jmesNode
+	right jmesNode
+}
+
+func (n *jmesComparisonNode) eval(value interface{}) (interface{}, error) {
+	left, err := n.left.eval(value)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(value)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return reflect.DeepEqual(left, right), nil
+	case "!=":
+		return !reflect.DeepEqual(left, right), nil
+	}
+
+	// Ordering comparisons are only defined for numbers
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		return nil, nil
+	}
+	switch n.op {
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	}
+	return l >= r, nil
+}
+
+// jmesExprRefNode is an &expression argument, evaluated by the function
+type jmesExprRefNode struct {
+	inner jmesNode
+}
+
+func (n *jmesExprRefNode) eval(value interface{}) (interface{}, error) {
+	return n, nil
+}
+
+type jmesFunctionNode struct {
+	name string
+	fn   jmesFunction
+	args []jmesNode
+}
+
+func (n *jmesFunctionNode) eval(value interface{}) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		evaluated, err := arg.eval(value)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = evaluated
+	}
+	result, err := n.fn.call(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %w", n.name, err)
+	}
+	return result, nil
+}
+
+// Functions
+
+// jmesFunction is a builtin function. maxArgs < 0 means variadic.
+type jmesFunction struct {
+	minArgs int
+	maxArgs int
+	call    func(args []interface{}) (interface{}, error)
+}
+
+var jmesFunctions map[string]jmesFunction
+
+func init() {
+	jmesFunctions = map[string]jmesFunction{
+		"abs": {1, 1, func(args []interface{}) (interface{}, error) {
+			n, err := jmesNumberArg(args[0])
+			return math.Abs(n), err
+		}},
+		"avg": {1, 1, func(args []interface{}) (interface{}, error) {
+			numbers, err := jmesNumbersArg(args[0])
+			if err != nil || len(numbers) == 0 {
+				return nil, err
+			}
+			sum := 0.0
+			for _, n := range numbers {
+				sum += n
+			}
+			return sum / float64(len(numbers)), nil
+		}},
+		"ceil": {1, 1, func(args []interface{}) (interface{}, error) {
+			n, err := jmesNumberArg(args[0])
+			return math.Ceil(n), err
+		}},
+		"floor": {1, 1, func(args []interface{}) (interface{}, error) {
+			n, err := jmesNumberArg(args[0])
+			return math.Floor(n), err
+		}},
+		"contains": {2, 2, func(args []interface{}) (interface{}, error) {
+			switch subject := args[0].(type) {
+			case string:
+				search, ok := args[1].(string)
+				return ok && strings.Contains(subject, search), nil
+			case []interface{}:
+				for _, item := range subject {
+					if reflect.DeepEqual(item, args[1]) {
+						return true, nil
+					}
+				}
+				return false, nil
+			}
+			return nil, errors.New("expected an array or string")
+		}},
+		"starts_with": {2, 2, func(args []interface{}) (interface{}, error) {
+			s, prefix, err := jmesStringArgs(args)
+			return strings.HasPrefix(s, prefix), err
+		}},
+		"ends_with": {2, 2, func(args []interface{}) (interface{}, error) {
+			s, suffix, err := jmesStringArgs(args)
+			return strings.HasSuffix(s, suffix), err
+		}},
+		"join": {2, 2, func(args []interface{}) (interface{}, error) {
+			sep, ok := args[0].(string)
+			list, lok := args[1].([]interface{})
+			if !ok || !lok {
+				return nil, errors.New("expected a string separator and an array of strings")
+			}
+			parts := make([]string, len(list))
+			for i, item := range list {
+				s, ok := item.(string)
+				if !ok {
+					return nil, errors.New("expected an array of strings")
+				}
+				parts[i] = s
+			}
+			return strings.Join(parts, sep), nil
+		}},
+		"keys": {1, 1, func(args []interface{}) (interface{}, error) {
+			object, ok := args[0].(map[string]interface{})
+			if !ok {
+				return nil, errors.New("expected an object")
+			}
+			keys := make([]interface{}, 0, len(object))
+			for _, key := range Keys(object) {
+				keys = append(keys, key)
+			}
+			return keys, nil
+		}},
+		"values": {1, 1, func(args []interface{}) (interface{}, error) {
+			object, ok := args[0].(map[string]interface{})
+			if !ok {
+				return nil, errors.New("expected an object")
+			}
+			values := make([]interface{}, 0, len(object))
+			for _, key := range Keys(object) {
+				values = append(values, object[key])
+			}
+			return values, nil
+		}},
+		"length": {1, 1, func(args []interface{}) (interface{}, error) {
+			switch v := args[0].(type) {
+			case string:
+				return float64(utf8.RuneCountInString(v)), nil
+			case []interface{}:
+				return float64(len(v)), nil
+			case map[string]interface{}:
+				return float64(len(v)), nil
+			}
+			return nil, errors.New("expected a string, array or object")
+		}},
+		"map": {2, 2, func(args []interface{}) (interface{}, error) {
+			ref, list, err := jmesExprRefArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			result := make([]interface{}, len(list))
+			for i, item := range list {
+				if result[i], err = ref.inner.eval(item); err != nil {
+					return nil, err
+				}
+			}
+			return result, nil
+		}},
+		"max": {1, 1, func(args []interface{}) (interface{}, error) {
+			return jmesExtreme(args[0], 1)
+		}},
+		"min": {1, 1, func(args []interface{}) (interface{}, error) {
+			return jmesExtreme(args[0], -1)
+		}},
+		"max_by": {2, 2, func(args []interface{}) (interface{}, error) {
+			return jmesExtremeBy(args, 1)
+		}},
+		"min_by": {2, 2, func(args []interface{}) (interface{}, error) {
+			return jmesExtremeBy(args, -1)
+		}},
+		"merge": {1, -1, func(args []interface{}) (interface{}, error) {
+			result := map[string]interface{}{}
+			for _, arg := range args {
+				object, ok := arg.(map[string]interface{})
+				if !ok {
+					return nil, errors.New("expected objects")
+				}
+				for key, value := range object {
+					result[key] = value
+				}
+			}
+			return result, nil
+		}},
+		"not_null": {1, -1, func(args []interface{}) (interface{}, error) {
+			for _, arg := range args {
+				if arg != nil {
+					return arg, nil
+				}
+			}
+			return nil, nil
+		}},
+		"reverse": {1, 1, func(args []interface{}) (interface{}, error) {
+			switch v := args[0].(type) {
+			case string:
+				runes := []rune(v)
+				for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+					runes[i], runes[j] = runes[j], runes[i]
+				}
+				return string(runes), nil
+			case []interface{}:
+				return Reverse(v), nil
+			}
+			return nil, errors.New("expected an array or string")
+		}},
+		"sort": {1, 1, func(args []interface{}) (interface{}, error) {
+			list, ok := args[0].([]interface{})
+			if !ok {
+				return nil, errors.New("expected an array")
+			}
+			keys := make([]interface{}, len(list))
+			copy(keys, list)
+			return jmesSortByKeys(list, keys)
+		}},
+		"sort_by": {2, 2, func(args []interface{}) (interface{}, error) {
+			list, keys, err := jmesKeysBy(args)
+			if err != nil {
+				return nil, err
+			}
+			return jmesSortByKeys(list, keys)
+		}},
+		"sum": {1, 1, func(args []interface{}) (interface{}, error) {
+			numbers, err := jmesNumbersArg(args[0])
+			sum := 0.0
+			for _, n := range numbers {
+				sum += n
+			}
+			return sum, err
+		}},
+		"to_array": {1, 1, func(args []interface{}) (interface{}, error) {
+			if list, ok := args[0].([]interface{}); ok {
+				return list, nil
+			}
+			return []interface{}{args[0]}, nil
+		}},
+		"to_string": {1, 1, func(args []interface{}) (interface{}, error) {
+			if s, ok := args[0].(string); ok {
+				return s, nil
+			}
+			encoded, err := json.Marshal(args[0])
+			return string(encoded), err
+		}},
+		"to_number": {1, 1, func(args []interface{}) (interface{}, error) {
+			switch v := args[0].(type) {
+			case float64:
+				return v, nil
+			case string:
+				n, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					return nil, nil
+				}
+				return n, nil
+			}
+			return nil, nil
+		}},
+		"type": {1, 1, func(args []interface{}) (interface{}, error) {
+			switch args[0].(type) {
+			case nil:
+				return "null", nil
+			case bool:
+				return "boolean", nil
+			case float64:
+				return "number", nil
+			case string:
+				return "string", nil
+			case []interface{}:
+				return "array", nil
+			}
+			return "object", nil
+		}},
+	}
+}
+
+// jmesTruthy reports whether value is not false, null or empty
+func jmesTruthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+func jmesNumberArg(arg interface{}) (float64, error) {
+	n, ok := arg.(float64)
+	if !ok {
+		return 0, errors.New("expected a number")
+	}
+	return n, nil
+}
+
+func jmesNumbersArg(arg interface{}) ([]float64, error) {
+	list, ok := arg.([]interface{})
+	if !ok {
+		return nil, errors.New("expected an array of numbers")
+	}
+	numbers := make([]float64, len(list))
+	for i, item := range list {
+		n, ok := item.(float64)
+		if !ok {
+			return nil, errors.New("expected an array of numbers")
+		}
+		numbers[i] = n
+	}
+	return numbers, nil
+}
+
+func jmesStringArgs(args []interface{}) (string, string, error) {
+	s, ok := args[0].(string)
+	other, ook := args[1].(string)
+	if !ok || !ook {
+		return "", "", errors.New("expected strings")
+	}
+	return s, other, nil
+}
+
+// jmesExprRefArgs checks the (&expression, array) arguments of map
+func jmesExprRefArgs(args []interface{}) (*jmesExprRefNode, []interface{}, error) {
+	ref, ok := args[0].(*jmesExprRefNode)
+	if !ok {
+		return nil, nil, errors.New("expected an expression reference such as &name")
+	}
+	list, ok := args[1].([]interface{})
+	if !ok {
+		return nil, nil, errors.New("expected an array")
+	}
+	return ref, list, nil
+}
+
+// jmesKeysBy evaluates the (array, &expression) arguments of the *_by
+// functions to the items and their keys
+func jmesKeysBy(args []interface{}) ([]interface{}, []interface{}, error) {
+	list, ok := args[0].([]interface{})
+	if !ok {
+		return nil, nil, errors.New("expected an array")
+	}
+	ref, ok := args[1].(*jmesExprRefNode)
+	if !ok {
+		return nil, nil, errors.New("expected an expression reference such as &name")
+	}
+	keys := make([]interface{}, len(list))
+	for i, item := range list {
+		key, err := ref.inner.eval(item)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys[i] = key
+	}
+	return list, keys, nil
+}
+
+// jmesSortByKeys sorts list by keys, which must be all numbers or all strings
+func jmesSortByKeys(list, keys []interface{}) (interface{}, error) {
+	if err := jmesComparableKeys(keys); err != nil {
+		return nil, err
+	}
+	indexes := make([]int, len(list))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return jmesLess(keys[indexes[i]], keys[indexes[j]])
+	})
+	sorted := make([]interface{}, len(list))
+	for i, index := range indexes {
+		sorted[i] = list[index]
+	}
+	return sorted, nil
+}
+
+// jmesComparableKeys checks that keys are all numbers or all strings
+func jmesComparableKeys(keys []interface{}) error {
+	for _, key := range keys {
+		switch key.(type) {
+		case float64:
+			if _, ok := keys[0].(float64); ok {
+				continue
+			}
+		case string:
+			if _, ok := keys[0].(string); ok {
+				continue
+			}
+		}
+		return errors.New("expected only numbers or only strings")
+	}
+	return nil
+}
+
+func jmesLess(a, b interface{}) bool {
+	if s, ok := a.(string); ok {
+		return s < b.(string)
+	}
+	return a.(float64) < b.(float64)
+}
+
+// jmesExtreme returns the largest (sign 1) or smallest (sign -1) item
+func jmesExtreme(arg interface{}, sign int) (interface{}, error) {
+	list, ok := arg.([]interface{})
+	if !ok {
+		return nil, errors.New("expected an array")
+	}
+	return jmesExtremeOf(list, list, sign)
+}
+
+// jmesExtremeBy returns the item with the largest or smallest key
+func jmesExtremeBy(args []interface{}, sign int) (interface{}, error) {
+	list, keys, err := jmesKeysBy(args)
+	if err != nil {
+		return nil, err
+	}
+	return jmesExtremeOf(list, keys, sign)
+}
+
+func jmesExtremeOf(list, keys []interface{}, sign int) (interface{}, error) {
+	if len(list) == 0 {
+		return nil, nil
+	}
+	if err := jmesComparableKeys(keys); err != nil {
+		return nil, err
+	}
+	best := 0
+	for i := 1; i < len(list); i++ {
+		if sign > 0 && jmesLess(keys[best], keys[i]) || sign < 0 && jmesLess(keys[i], keys[best]) {
+			best = i
+		}
+	}
+	return list[best], nil
+}
@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJMESPath(t *testing.T) {
+	var data interface{}
+	json.Unmarshal([]byte(`{
+		"people": [
+			{"name": "Ana", "age": 31, "address": {"city": "Jakarta"}},
+			{"name": "Budi", "age": 19, "address": {"city": "Bandung"}},
+			{"name": "Citra", "age": 45}
+		],
+		"meta": {"total": 3, "next": null},
+		"matrix": [[1, 2], [3], [4, 5]],
+		"foo bar": "spaced"
+	}`), &data)
+
+	tests := []struct {
+		expression string
+		expected   interface{}
+	}{
+		{"people[0].name", "Ana"},
+		{"people[-1].name", "Citra"},
+		{"people[5].name", nil},
+		{`"foo bar"`, "spaced"},
+		{"people[*].name", []interface{}{"Ana", "Budi", "Citra"}},
+		{"people[*].address.city", []interface{}{"Jakarta", "Bandung"}},
+		{"people[?age > `20`].name", []interface{}{"Ana", "Citra"}},
+		{"people[?address.city == 'Bandung'] | [0].name", "Budi"},
+		{"people[:2].name", []interface{}{"Ana", "Budi"}},
+		{"people[::-1].name", []interface{}{"Citra", "Budi", "Ana"}},
+		{"matrix[]", []interface{}{float64(1), float64(2), float64(3), float64(4), float64(5)}},
+		{"meta.*", []interface{}{float64(3)}},
+		{"people[0].{n: name, city: address.city}", map[string]interface{}{"n": "Ana", "city": "Jakarta"}},
+		{"people[0].[name, age]", []interface{}{"Ana", float64(31)}},
+		{"meta.next || 'none'", "none"},
+		{"!(meta.next)", true},
+		{"length(people)", float64(3)},
+		{"max_by(people, &age).name", "Citra"},
+		{"sort_by(people, &age)[*].name", []interface{}{"Budi", "Ana", "Citra"}},
+		{"map(&name, people)", []interface{}{"Ana", "Budi", "Citra"}},
+		{"sum(people[*].age)", float64(95)},
+		{"join(', ', people[*].name)", "Ana, Budi, Citra"},
+		{"people[?contains(name, 'i')].name", []interface{}{"Budi", "Citra"}},
+		{"keys(meta)", []interface{}{"next", "total"}},
+		{"`{\"a\": 1}`.a", float64(1)},
+		{"missing.deeper[0]", nil},
+	}
+
+	for _, tt := range tests {
+		result, err := SearchJMESPath(tt.expression, data)
+		if err != nil {
+			t.Errorf("SearchJMESPath(%q) error: %v", tt.expression, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("SearchJMESPath(%q) = %#v, want %#v", tt.expression, result, tt.expected)
+		}
+	}
+}
+
+func TestJMESPath_Errors(t *testing.T) {
+	for _, expression := range []string{"people[", "a.", "nosuch(@)", "length(a, b)", "[0", "a[?b"} {
+		if _, err := CompileJMESPath(expression); err == nil {
+			t.Errorf("CompileJMESPath(%q) expected an error", expression)
+		}
+	}
+	if _, err := SearchJMESPath("abs(name)", map[string]interface{}{"name": "x"}); err == nil {
+		t.Error("Expected an error calling abs with a string")
+	}
+}
@@ -0,0 +1,2893 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Jq is a compiled jq program, e.g. {id, name: .user.name} | del(.secret).
+// It implements the commonly used subset of jq: paths, pipes, object and
+// array construction, conditionals, variables, reduce, assignments and the
+// usual builtins.
+type Jq struct {
+	source string
+	root   jqNode
+}
+
+// jqNode is a node of the jq syntax tree. Every node produces zero or more
+// outputs for an input.
+type jqNode interface {
+	eval(input interface{}, env *jqEnv) ([]interface{}, error)
+}
+
+// jqPathNode is a node that can be used as a path expression, on the left of
+// an assignment or in del
+type jqPathNode interface {
+	paths(input interface{}, env *jqEnv) ([][]interface{}, error)
+}
+
+// jqEnv holds the variables bound with `as` and reduce
+type jqEnv struct {
+	name   string
+	value  interface{}
+	parent *jqEnv
+}
+
+// lookup returns the value of a variable
+func (e *jqEnv) lookup(name string) (interface{}, bool) {
+	for env := e; env != nil; env = env.parent {
+		if env.name == name {
+			return env.value, true
+		}
+	}
+	return nil, false
+}
+
+// bind returns an environment with name bound to value
+func (e *jqEnv) bind(name string, value interface{}) *jqEnv {
+	return &jqEnv{name: name, value: value, parent: e}
+}
+
+// CompileJq parses a jq program
+func CompileJq(source string) (*Jq, error) {
+	root, err := parseJq(source)
+	if err != nil {
+		return nil, fmt.Errorf("jq %q: %w", source, err)
+	}
+	return &Jq{source: source, root: root}, nil
+}
+
+// Run evaluates the program against input. The variables are available as
+// $name in the program.
+func (j *Jq) Run(input interface{}, variables map[string]interface{}) ([]interface{}, error) {
+	var env *jqEnv
+	for name, value := range variables {
+		env = env.bind(name, normalizeJSON(value))
+	}
+	outputs, err := j.root.eval(normalizeJSON(input), env)
+	if err != nil {
+		return nil, fmt.Errorf("jq %q: %w", j.source, err)
+	}
+	return outputs, nil
+}
+
+// Tokenizer
+
+type jqTokenKind int
+
+const (
+	jqEOF jqTokenKind = iota
+	jqNumber
+	jqString
+	jqIdent
+	jqField
+	jqVariable
+	jqFormat
+	jqPunct
+)
+
+type jqToken struct {
+	kind  jqTokenKind
+	text  string
+	value interface{}
+	// parts of a string token: literal strings and interpolated sources
+	parts []interface{}
+}
+
+// jqInterpolation is the source of a \(...) string interpolation
+type jqInterpolation string
+
+// jqPuncts lists operators, longest first
+var jqPuncts = []string{"//=", "|=", "+=", "-=", "*=", "/=", "%=", "==", "!=", "<=", ">=", "//", "..", "|", ",", "=", "<", ">", "+", "-", "*", "/", "%", "(", ")", "[", "]", "{", "}", ":", ";", "?", "."}
+
+func isJqIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isJqIdentChar(c byte) bool {
+	return isJqIdentStart(c) || c >= '0' && c <= '9'
+}
+
+func tokenizeJq(source string) ([]jqToken, error) {
+	var tokens []jqToken
+	i := 0
+	for i < len(source) {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#':
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(source) && (source[i] >= '0' && source[i] <= '9' || source[i] == '.') {
+				i++
+			}
+			if i < len(source) && (source[i] == 'e' || source[i] == 'E') {
+				i++
+				if i < len(source) && (source[i] == '+' || source[i] == '-') {
+					i++
+				}
+				for i < len(source) && source[i] >= '0' && source[i] <= '9' {
+					i++
+				}
+			}
+			number, err := strconv.ParseFloat(source[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", source[start:i])
+			}
+			tokens = append(tokens, jqToken{kind: jqNumber, text: source[start:i], value: number})
+		case c == '"':
+			token, end, err := tokenizeJqString(source, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token)
+			i = end
+		case c == '.' && i+1 < len(source) && isJqIdentStart(source[i+1]):
+			start := i + 1
+			i++
+			for i < len(source) && isJqIdentChar(source[i]) {
+				i++
+			}
+			tokens = append(tokens, jqToken{kind: jqField, text: source[start:i]})
+		case (c == '$' || c == '@') && i+1 < len(source) && isJqIdentStart(source[i+1]):
+			start := i + 1
+			i++
+			for i < len(source) && isJqIdentChar(source[i]) {
+				i++
+			}
+			kind := jqVariable
+			if c == '@' {
+				kind = jqFormat
+			}
+			tokens = append(tokens, jqToken{kind: kind, text: source[start:i]})
+		case isJqIdentStart(c):
+			start := i
+			for i < len(source) && isJqIdentChar(source[i]) {
+				i++
+			}
+			tokens = append(tokens, jqToken{kind: jqIdent, text: source[start:i]})
+		default:
+			matched := false
+			for _, punct := range jqPuncts {
+				if strings.HasPrefix(source[i:], punct) {
+					tokens = append(tokens, jqToken{kind: jqPunct, text: punct})
+					i += len(punct)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+		}
+	}
+	return append(tokens, jqToken{kind: jqEOF}), nil
+}
+
+// tokenizeJqString reads the string literal starting at source[start],
+// splitting out \(...) interpolations
+func tokenizeJqString(source string, start int) (jqToken, int, error) {
+	var parts []interface{}
+	var b strings.Builder
+	i := start + 1
+	for i < len(source) {
+		c := source[i]
+		switch {
+		case c == '"':
+			if b.Len() > 0 || len(parts) == 0 {
+				parts = append(parts, b.String())
+			}
+			token := jqToken{kind: jqString, text: source[start : i+1], parts: parts}
+			if len(parts) == 1 {
+				if s, ok := parts[0].(string); ok {
+					token.value = s
+				}
+			}
+			return token, i + 1, nil
+		case c == '\\' && i+1 < len(source):
+			i++
+			switch source[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'u':
+				if i+4 >= len(source) {
+					return jqToken{}, 0, errors.New("invalid \\u escape")
+				}
+				code, err := strconv.ParseUint(source[i+1:i+5], 16, 32)
+				if err != nil {
+					return jqToken{}, 0, errors.New("invalid \\u escape")
+				}
+				b.WriteRune(rune(code))
+				i += 4
+			case '(':
+				depth, end, quoted := 1, -1, false
+				for j := i + 1; j < len(source) && end < 0; j++ {
+					switch {
+					case quoted:
+						if source[j] == '\\' {
+							j++
+						} else if source[j] == '"' {
+							quoted = false
+						}
+					case source[j] == '"':
+						quoted = true
+					case source[j] == '(':
+						depth++
+					case source[j] == ')':
+						depth--
+						if depth == 0 {
+							end = j
+						}
+					}
+				}
+				if end < 0 {
+					return jqToken{}, 0, errors.New("unterminated string interpolation")
+				}
+				if b.Len() > 0 {
+					parts = append(parts, b.String())
+					b.Reset()
+				}
+				parts = append(parts, jqInterpolation(source[i+1:end]))
+				i = end
+			default:
+				b.WriteByte(source[i])
+			}
+			i++
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return jqToken{}, 0, errors.New("unterminated string")
+}
+
+// Parser
+
+type jqParser struct {
+	tokens []jqToken
+	pos    int
+}
+
+func parseJq(source string) (jqNode, error) {
+	tokens, err := tokenizeJq(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &jqParser{tokens: tokens}
+	root, err := p.parsePipe()
+	if err == nil && p.peek().kind != jqEOF {
+		err = fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	return root, err
+}
+
+func (p *jqParser) peek() jqToken {
+	return p.tokens[p.pos]
+}
+
+func (p *jqParser) next() jqToken {
+	token := p.tokens[p.pos]
+	if token.kind != jqEOF {
+		p.pos++
+	}
+	return token
+}
+
+// accept consumes the next token if it is one of the given punctuations or keywords
+func (p *jqParser) accept(texts ...string) (string, bool) {
+	token := p.peek()
+	if token.kind != jqPunct && token.kind != jqIdent {
+		return "", false
+	}
+	for _, text := range texts {
+		if token.text == text {
+			p.pos++
+			return text, true
+		}
+	}
+	return "", false
+}
+
+func (p *jqParser) expect(text string) error {
+	if _, ok := p.accept(text); !ok {
+		return fmt.Errorf("expected %q, got %q", text, p.peek().text)
+	}
+	return nil
+}
+
+func (p *jqParser) expectVariable() (string, error) {
+	token := p.next()
+	if token.kind != jqVariable {
+		return "", fmt.Errorf("expected a variable, got %q", token.text)
+	}
+	return token.text, nil
+}
+
+func (p *jqParser) parsePipe() (jqNode, error) {
+	left, err := p.parseComma()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.accept("as"); ok {
+		name, err := p.expectVariable()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("|"); err != nil {
+			return nil, err
+		}
+		body, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		return &jqBindNode{source: left, name: name, body: body}, nil
+	}
+	if _, ok := p.accept("|"); ok {
+		right, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		return &jqPipeNode{left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *jqParser) parseComma() (jqNode, error) {
+	left, err := p.parseAlternative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept(","); !ok {
+			return left, nil
+		}
+		right, err := p.parseAlternative()
+		if err != nil {
+			return nil, err
+		}
+		left = &jqCommaNode{left: left, right: right}
+	}
+}
+
+func (p *jqParser) parseAlternative() (jqNode, error) {
+	left, err := p.parseAssign()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.accept("//"); !ok {
+		return left, nil
+	}
+	right, err := p.parseAlternative()
+	if err != nil {
+		return nil, err
+	}
+	return &jqAlternativeNode{left: left, right: right}, nil
+}
+
+func (p *jqParser) parseAssign() (jqNode, error) {
+	left, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("=", "|=", "+=", "-=", "*=", "/=", "%=", "//=")
+	if !ok {
+		return left, nil
+	}
+	path, isPath := left.(jqPathNode)
+	if !isPath {
+		return nil, fmt.Errorf("invalid path expression on the left of %s", op)
+	}
+	right, err := p.parseAlternative()
+	if err != nil {
+		return nil, err
+	}
+	return &jqAssignNode{op: op, path: path, value: right}, nil
+}
+
+func (p *jqParser) parseOr() (jqNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("or"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &jqLogicalNode{op: "or", left: left, right: right}
+	}
+}
+
+func (p *jqParser) parseAnd() (jqNode, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("and"); !ok {
+			return left, nil
+		}
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &jqLogicalNode{op: "and", left: left, right: right}
+	}
+}
+
+func (p *jqParser) parseComparison() (jqNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<=", ">=", "<", ">")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	return &jqBinaryNode{op: op, left: left, right: right}, nil
+}
+
+func (p *jqParser) parseAdditive() (jqNode, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &jqBinaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *jqParser) parseMultiplicative() (jqNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("*", "/", "%")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &jqBinaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *jqParser) parseUnary() (jqNode, error) {
+	if _, ok := p.accept("-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &jqBinaryNode{op: "-", left: &jqLiteralNode{value: float64(0)}, right: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *jqParser) parsePostfix() (jqNode, error) {
+	term, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		token := p.peek()
+		switch {
+		case token.kind == jqField:
+			p.next()
+			term = &jqIndexNode{target: term, key: &jqLiteralNode{value: token.text}}
+		case token.kind == jqPunct && token.text == "." && p.tokens[p.pos+1].kind == jqString:
+			p.next()
+			key, err := p.parseString(p.next())
+			if err != nil {
+				return nil, err
+			}
+			term = &jqIndexNode{target: term, key: key}
+		case token.kind == jqPunct && token.text == "." && p.tokens[p.pos+1].text == "[":
+			p.next()
+		case token.kind == jqPunct && token.text == "[":
+			p.next()
+			if term, err = p.parseSubscript(term); err != nil {
+				return nil, err
+			}
+		case token.kind == jqPunct && token.text == "?":
+			p.next()
+			term = &jqTryNode{body: term}
+		default:
+			return term, nil
+		}
+	}
+}
+
+// parseSubscript parses the rest of [], [expr] or [from:to] after the [
+func (p *jqParser) parseSubscript(target jqNode) (jqNode, error) {
+	if _, ok := p.accept("]"); ok {
+		return &jqIterateNode{target: target}, nil
+	}
+
+	var from jqNode
+	if _, ok := p.accept(":"); !ok {
+		var err error
+		if from, err = p.parsePipe(); err != nil {
+			return nil, err
+		}
+		if _, ok := p.accept("]"); ok {
+			return &jqIndexNode{target: target, key: from}, nil
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+	}
+
+	var to jqNode
+	if _, ok := p.accept("]"); !ok {
+		var err error
+		if to, err = p.parsePipe(); err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+	}
+	return &jqSliceNode{target: target, from: from, to: to}, nil
+}
+
+func (p *jqParser) parsePrimary() (jqNode, error) {
+	token := p.next()
+	switch token.kind {
+	case jqNumber:
+		return &jqLiteralNode{value: token.value}, nil
+	case jqString:
+		return p.parseString(token)
+	case jqField:
+		return &jqIndexNode{target: &jqIdentityNode{}, key: &jqLiteralNode{value: token.text}}, nil
+	case jqVariable:
+		return &jqVariableNode{name: token.text}, nil
+	case jqFormat:
+		return &jqCallNode{name: "@" + token.text}, nil
+	case jqIdent:
+		return p.parseKeyword(token.text)
+	case jqPunct:
+		switch token.text {
+		case ".":
+			if p.peek().kind == jqString {
+				key, err := p.parseString(p.next())
+				if err != nil {
+					return nil, err
+				}
+				return &jqIndexNode{target: &jqIdentityNode{}, key: key}, nil
+			}
+			return &jqIdentityNode{}, nil
+		case "..":
+			return &jqRecurseNode{}, nil
+		case "(":
+			inner, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			return inner, p.expect(")")
+		case "[":
+			if _, ok := p.accept("]"); ok {
+				return &jqArrayNode{}, nil
+			}
+			inner, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			return &jqArrayNode{inner: inner}, p.expect("]")
+		case "{":
+			return p.parseObject()
+		}
+	}
+	if token.kind == jqEOF {
+		return nil, errors.New("unexpected end of program")
+	}
+	return nil, fmt.Errorf("unexpected %q", token.text)
+}
+
+// parseString builds a literal or an interpolated string node
+func (p *jqParser) parseString(token jqToken) (jqNode, error) {
+	if token.value != nil {
+		return &jqLiteralNode{value: token.value}, nil
+	}
+	node := &jqStringNode{}
+	for _, part := range token.parts {
+		if source, ok := part.(jqInterpolation); ok {
+			inner, err := parseJq(string(source))
+			if err != nil {
+				return nil, err
+			}
+			node.parts = append(node.parts, inner)
+			continue
+		}
+		node.parts = append(node.parts, &jqLiteralNode{value: part})
+	}
+	return node, nil
+}
+
+// parseKeyword parses literals, conditionals, reduce, try and function calls
+func (p *jqParser) parseKeyword(name string) (jqNode, error) {
+	switch name {
+	case "null":
+		return &jqLiteralNode{value: nil}, nil
+	case "true":
+		return &jqLiteralNode{value: true}, nil
+	case "false":
+		return &jqLiteralNode{value: false}, nil
+	case "if":
+		return p.parseIf()
+	case "try":
+		body, err := p.parsePostfix()
+		if err != nil {
+			return nil, err
+		}
+		node := &jqTryNode{body: body}
+		if _, ok := p.accept("catch"); ok {
+			if node.catch, err = p.parsePostfix(); err != nil {
+				return nil, err
+			}
+		}
+		return node, nil
+	case "reduce":
+		source, err := p.parsePostfix()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("as"); err != nil {
+			return nil, err
+		}
+		variable, err := p.expectVariable()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		init, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(";"); err != nil {
+			return nil, err
+		}
+		update, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		return &jqReduceNode{source: source, name: variable, init: init, update: update}, p.expect(")")
+	case "then", "elif", "else", "end", "as", "catch", "and", "or", "def", "import", "include", "label", "foreach":
+		return nil, fmt.Errorf("unexpected %q", name)
+	}
+
+	call := &jqCallNode{name: name}
+	if _, ok := p.accept("("); ok {
+		for {
+			arg, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if _, ok := p.accept(";"); !ok {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	if _, known := jqBuiltins[fmt.Sprintf("%s/%d", call.name, len(call.args))]; !known {
+		return nil, fmt.Errorf("unknown function %s/%d", call.name, len(call.args))
+	}
+	return call, nil
+}
+
+func (p *jqParser) parseIf() (jqNode, error) {
+	cond, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("then"); err != nil {
+		return nil, err
+	}
+	then, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	node := &jqIfNode{cond: cond, then: then}
+
+	switch keyword, _ := p.accept("elif", "else", "end"); keyword {
+	case "elif":
+		node.otherwise, err = p.parseIf()
+		return node, err
+	case "else":
+		if node.otherwise, err = p.parsePipe(); err != nil {
+			return nil, err
+		}
+		return node, p.expect("end")
+	case "end":
+		return node, nil
+	}
+	return nil, fmt.Errorf("expected elif, else or end, got %q", p.peek().text)
+}
+
+// parseObject parses the entries of {...} after the {
+func (p *jqParser) parseObject() (jqNode, error) {
+	node := &jqObjectNode{}
+	if _, ok := p.accept("}"); ok {
+		return node, nil
+	}
+	for {
+		var entry jqObjectEntry
+		token := p.next()
+		switch {
+		case token.kind == jqIdent:
+			entry.key = &jqLiteralNode{value: token.text}
+		case token.kind == jqVariable:
+			entry.key = &jqLiteralNode{value: token.text}
+			entry.value = &jqVariableNode{name: token.text}
+		case token.kind == jqString:
+			key, err := p.parseString(token)
+			if err != nil {
+				return nil, err
+			}
+			entry.key = key
+		case token.kind == jqNumber:
+			entry.key = &jqLiteralNode{value: token.text}
+		case token.kind == jqPunct && token.text == "(":
+			key, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			entry.key = key
+		default:
+			return nil, fmt.Errorf("unexpected %q in object", token.text)
+		}
+
+		if _, ok := p.accept(":"); ok {
+			value, err := p.parseObjectValue()
+			if err != nil {
+				return nil, err
+			}
+			entry.value = value
+		} else if entry.value == nil {
+			// {name} is short for {name: .name}
+			entry.value = &jqIndexNode{target: &jqIdentityNode{}, key: entry.key}
+		}
+		node.entries = append(node.entries, entry)
+
+		if _, ok := p.accept(","); ok {
+			continue
+		}
+		return node, p.expect("}")
+	}
+}
+
+// parseObjectValue parses an object value, which may be a pipe but not a
+// comma list
+func (p *jqParser) parseObjectValue() (jqNode, error) {
+	value, err := p.parseAlternative()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.accept("|"); ok {
+		right, err := p.parseObjectValue()
+		if err != nil {
+			return nil, err
+		}
+		return &jqPipeNode{left: value, right: right}, nil
+	}
+	return value, nil
+}
+
+// Nodes
+
+type jqIdentityNode struct{}
+
+func (n *jqIdentityNode) eval(input interface{}, env *jqEnv) ([]interface{}, error) {
+	return []interface{}{input}, nil
+}
+
+func (n *jqIdentityNode) paths(input interface{}, env *jqEnv) ([][]interface{}, error) {
+	return [][]interface{}{{}}, nil
+}
+
+type jqRecurseNode struct{}
+
+func (n *jqRecurseNode) eval(input interface{}, env *jqEnv) ([]interface{}, error) {
+	return jsonPathDescendants(input, nil), nil
+}
+
+func (n *jqRecurseNode) paths(input interface{}, env *jqEnv) ([][]interface{}, error) {
+	return jqDescendantPaths(input, []interface{}{}, nil), nil
+}
+
+// jqDescendantPaths returns the paths of value and everything nested in it
+func jqDescendantPaths(value interface{}, path []interface{}, result [][]interface{}) [][]interface{} {
+	result = append(result, path)
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range Keys(v) {
+			result = jqDescendantPaths(v[key], jqAppendPath(path, key), result)
+		}
+	case []interface{}:
+		for i, item := range v {
+			result = jqDescendantPaths(item, jqAppendPath(path, float64(i)), result)
+		}
+	}
+	return result
+}
+
+// jqAppendPath returns a copy of path with key added
+func jqAppendPath(path []interface{}, key interface{}) []interface{} {
+	return append(path[:len(path):len(path)], key)
+}
+
+type jqLiteralNode struct {
+	value interface{}
+}
+
+func (n *jqLiteralNode) eval(input interface{}, env *jqEnv) ([]interface{}, error) {
+	return []interface{}{n.value}, nil
+}
+
+type jqVariableNode struct {
+	name string
+}
+
+func (n *jqVariableNode) eval(input interface{}, env *jqEnv) ([]interface{}, error) {
+	value, ok := env.lookup(n.name)
+	if !ok {
+		return nil, fmt.Errorf("$%s is not defined", n.name)
+	}
+	return []interface{}{value}, nil
+}
+
+type jqStringNode struct {
+	parts []jqNode
+}
+
+func (n *jqStringNode) eval(input interface{}, env *jqEnv) ([]interface{}, error) {
+	results := []string{""}
+	for _, part := range n.parts {
+		values, err := part.eval(input, env)
+		if err != nil {
+			return nil, err
+		}
+		var next []string
+		for _, prefix := range results {
+			for _, value := range values {
+				if s, ok := value.(string); ok {
+					next = append(next, prefix+s)
+				} else {
+					next = append(next, prefix+jqToJSON(value))
+				}
+			}
+		}
+		results = next
+	}
+	outputs := make([]interface{}, len(results))
+	for i, s := range results {
+		outputs[i] = s
+	}
+	return outputs, nil
+}
+
+type jqIndexNode struct {
+	target jqNode
+	key    jqNode
+}
+
+func (n *jqIndexNode) eval(input interface{}, env *jqEnv) ([]interface{}, error) {
+	targets, err := n.target.eval(input, env)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := n.key.eval(input, env)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []interface{}
+	for _, target := range targets {
+		for _, key := range keys {
+			value, err := jqIndex(target, key)
+			if err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, value)
+		}
+	}
+	return outputs, nil
+}
+
+func (n *jqIndexNode) paths(input interface{}, env *jqEnv) ([][]interface{}, error) {
+	target, ok := n.target.(jqPathNode)
+	if !ok {
+		return nil, errors.New("invalid path expression")
+	}
+	prefixes, err := target.paths(input, env)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := n.key.eval(input, env)
+	if err != nil {
+		return nil, err
+	}
+	var result [][]interface{}
+	for _, prefix := range prefixes {
+		for _, key := range keys {
+			result = append(result, jqAppendPath(prefix, key))
+		}
+	}
+	return result, nil
+}
+
+// jqIndex returns .[key] of value
+func jqIndex(value, key interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		if k, ok := key.(string); ok {
+			return v[k], nil
+		}
+	case []interface{}:
+		if k, ok := key.(float64); ok {
+			index := int(math.Floor(k))
+			if index < 0 {
+				index += len(v)
+			}
+			if index < 0 || index >= len(v) {
+				return nil, nil
+			}
+			return v[index], nil
+		}
+	}
+	return nil, fmt.Errorf("cannot index %s with %s", jqTypeName(value), jqTypeName(key))
+}
+
+type jqSliceNode struct {
+	target jqNode
+	from   jqNode
+	to     jqNode
+}
+
+func (n *jqSliceNode) eval(input interface{}, env *jqEnv) ([]interface{}, error) {
+	targets, err := n.target.eval(input, env)
+	if err != nil {
+		return nil, err
+	}
+	from, to, err := n.bounds(input, env)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []interface{}
+	for _, target := range targets {
+		switch v := target.(type) {
+		case nil:
+			outputs = append(outputs, nil)
+		case []interface{}:
+			start, end := jqSliceBounds(from, to, len(v))
+			outputs = append(outputs, append([]interface{}{}, v[start:end]...))
+		case string:
+			runes := []rune(v)
+			start, end := jqSliceBounds(from, to, len(runes))
+			outputs = append(outputs, string(runes[start:end]))
+		default:
+			return nil, fmt.Errorf("cannot slice %s", jqTypeName(target))
+		}
+	}
+	return outputs, nil
+}
+
+// bounds evaluates the optional slice bounds
+func (n *jqSliceNode) bounds(input interface{}, env *jqEnv) (interface{}, interface{}, error) {
+	var from, to interface{}
+	for i, node := range []jqNode{n.from, n.to} {
+		if node == nil {
+			continue
+		}
+		values, err := node.eval(input, env)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(values) > 0 {
+			if i == 0 {
+				from = values[0]
+			} else {
+				to = values[0]
+			}
+		}
+	}
+	return from, to, nil
+}
+
+// jqSliceBounds resolves slice bounds against length
+func jqSliceBounds(from, to interface{}, length int) (int, int) {
+	start, end := 0, length
+	if f, ok := from.(float64); ok {
+		start = clampJSONPathIndex(int(math.Floor(f)), length)
+	}
+	if t, ok := to.(float64); ok {
+		end = clampJSONPathIndex(int(math.Ceil(t)), length)
+	}
+	if start > end {
+		start = end
+	}
+	return start, end
+}
+
+type jqIterateNode struct {
+	target jqNode
+}
+
+func (n *jqIterateNode) eval(input interface{}, env *jqEnv) ([]interface{}, error) {
+	targets, err := n.target.eval(input, env)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []interface{}
+	for _, target := range targets {
+		switch v := target.(type) {
+		case []interface{}:
+			outputs = append(outputs, v...)
+		case map[string]interface{}:
+			for _, key := range Keys(v) {
+				outputs = append(outputs, v[key])
+			}
+		default:
+			return nil, fmt.Errorf("cannot iterate over %s", jqTypeName(target))
+		}
+	}
+	return outputs, nil
+}
+
+func (n *jqIterateNode) paths(input interface{}, env *jqEnv) ([][]interface{}, error) {
+	target, ok := n.target.(jqPathNode)
+	if !ok {
+		return nil, errors.New("invalid path expression")
+	}
+	prefixes, err := target.paths(input, env)
+	if err != nil {
+		return nil, err
+	}
+	var result [][]interface{}
+	for _, prefix := range prefixes {
+		value, err := jqGetPath(input, prefix)
+		if err != nil {
+			return nil, err
+		}
+		switch v := value.(type) {
+		case []interface{}:
+			for i := range v {
+				result = append(result, jqAppendPath(prefix, float64(i)))
+			}
+		case map[string]interface{}:
+			for _, key := range Keys(v) {
+				result = append(result, jqAppendPath(prefix, key))
+			}
+		case nil:
+		default:
+			return nil, fmt.Errorf("cannot iterate over %s", jqTypeName(value))
+		}
+	}
+	return result, nil
+}
+
+type jqPipeNode struct {
+	left  jqNode
+	right jqNode
+}
+
+func (n *jqPipeNode) eval(input interface{}, env *jqEnv) ([]interface{}, error) {
+	values, err := n.left.eval(input, env)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []interface{}
+	for _, value := range values {
+		results, err := n.right.eval(value, env)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, results...)
+	}
+	return outputs, nil
+}
+
+func (n *jqPipeNode) paths(input interface{}, env *jqEnv) ([][]interface{}, error) {
+	left, lok := n.left.(jqPathNode)
+	right, rok := n.right.(jqPathNode)
+	if !lok || !rok {
+		return nil, errors.New("invalid path expression")
+	}
+	prefixes, err := left.paths(input, env)
+	if err != nil {
+		return nil, err
+	}
+	var result [][]interface{}
+	for _, prefix := range prefixes {
+		value, err := jqGetPath(input, prefix)
+		if err != nil {
+			return nil, err
+		}
+		suffixes, err := right.paths(value, env)
+		if err != nil {
+			return nil, err
+		}
+		for _, suffix := range suffixes {
+			result = append(result, append(append([]interface{}{}, prefix...), suffix...))
+		}
+	}
+	return result, nil
+}
+
+type jqCommaNode struct {
+	left  jqNode
+	right jqNode
+}
+
+func (n *jqCommaNode) eval(input interface{}, env *jqEnv) ([]interface{}, error) {
+	left, err := n.left.eval(input, env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(input, env)
+	if err != nil {
+		return nil, err
+	}
+	return append(left, right...), nil
+}
+
+func (n *jqCommaNode) paths(input interface{}, env *jqEnv) ([][]interface{}, error) {
+	left, lok := n.left.(jqPathNode)
+	right, rok := n.right.(jqPathNode)
+	if !lok || !rok {
+		return nil, errors.New("invalid path expression")
+	}
+	leftPaths, err := left.paths(input, env)
+	if err != nil {
+		return nil, err
+	}
+	rightPaths, err := right.paths(input, env)
+	if err != nil {
+		return nil, err
+	}
+	return append(leftPaths, rightPaths...), nil
+}
+
+type jqArrayNode struct {
+	inner jqNode
+}
+
+func (n *jqArrayNode) eval(input interface{}, env *jqEnv) ([]interface{}, error) {
+	if n.inner == nil {
+		return []interface{}{[]interface{}{}}, nil
+	}
+	values, err := n.inner.eval(input, env)
+	if err != nil {
+		return nil, err
+	}
+	if values == nil {
+		values = []interface{}{}
+	}
+	return []interface{}{values}, nil
+}
+
+type jqObjectEntry struct {
+	key   jqNode
+	value jqNode
+}
+
+type jqObjectNode struct {
+	entries []jqObjectEntry
+}
+
+func (n *jqObjectNode) eval(input interface{}, env *jqEnv) ([]interface{}, error) {
+	results := []map[string]interface{}{{}}
+	for _, entry := range n.entries {
+		keys, err := entry.key.eval(input, env)
+		if err != nil {
+			return nil, err
+		}
+		values, err := entry.value.eval(input, env)
+		if err != nil {
+			return nil, err
+		}
+		var next []map[string]interface{}
+		for _, result := range results {
+			for _, key := range keys {
+				k, ok := key.(string)
+				if !ok {
+					return nil, fmt.Errorf("object keys must be strings, got %s", jqTypeName(key))
+				}
+				for _, value := range values {
+					object := make(map[string]interface{}, len(result)+1)
+					for name, existing := range result {
+						object[name] = existing
+					}
+					object[k] = value
+					next = append(next, object)
+				}
+			}
+		}
+		results = next
+	}
+	outputs := make([]interface{}, len(results))
+	for i, result := range results {
+		outputs[i] = result
+	}
+	return outputs, nil
+}
+
+type jqBinaryNode struct {
+	op    string
+	left  jqNode
+	right jqNode
+}
+
+func (n *jqBinaryNode) eval(input interface{}, env *jqEnv) ([]interface{}, error) {
+	rights, err := n.right.eval(input, env)
+	if err != nil {
+		return nil, err
+	}
+	lefts, err := n.left.eval(input, env)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []interface{}
+	for _, right := range rights {
+		for _, left := range lefts {
+			value, err := jqBinary(n.op, left, right)
+			if err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, value)
+		}
+	}
+	return outputs, nil
+}
+
+// jqBinary applies an arithmetic or comparison operator
+func jqBinary(op string, left, right interface{}) (interface{}, error) {
+	switch op {
+	case "==":
+		return jqCompare(left, right) == 0, nil
+	case "!=":
+		return jqCompare(left, right) != 0, nil
+	case "<":
+		return jqCompare(left, right) < 0, nil
+	case "<=":
+		return jqCompare(left, right) <= 0, nil
+	case ">":
+		return jqCompare(left, right) > 0, nil
+	case ">=":
+		return jqCompare(left, right) >= 0, nil
+	}
+
+	l, lnum := left.(float64)
+	r, rnum := right.(float64)
+	if lnum && rnum {
+		switch op {
+		case "+":
+			return l + r, nil
+		case "-":
+			return l - r, nil
+		case "*":
+			return l * r, nil
+		case "/":
+			if r == 0 {
+				return nil, errors.New("division by zero")
+			}
+			return l / r, nil
+		case "%":
+			if int64(r) == 0 {
+				return nil, errors.New("division by zero")
+			}
+			return float64(int64(l) % int64(r)), nil
+		}
+	}
+
+	switch op {
+	case "+":
+		switch {
+		case left == nil:
+			return right, nil
+		case right == nil:
+			return left, nil
+		}
+		switch l := left.(type) {
+		case string:
+			if r, ok := right.(string); ok {
+				return l + r, nil
+			}
+		case []interface{}:
+			if r, ok := right.([]interface{}); ok {
+				return append(append([]interface{}{}, l...), r...), nil
+			}
+		case map[string]interface{}:
+			if r, ok := right.(map[string]interface{}); ok {
+				merged := make(map[string]interface{}, len(l)+len(r))
+				for k, v := range l {
+					merged[k] = v
+				}
+				for k, v := range r {
+					merged[k] = v
+				}
+				return merged, nil
+			}
+		}
+	case "-":
+		if l, ok := left.([]interface{}); ok {
+			if r, ok := right.([]interface{}); ok {
+				result := []interface{}{}
+				for _, item := range l {
+					if !jqContainsValue(r, item) {
+						result = append(result, item)
+					}
+				}
+				return result, nil
+			}
+		}
+	case "*":
+		if l, ok := left.(map[string]interface{}); ok {
+			if r, ok := right.(map[string]interface{}); ok {
+				return jqDeepMerge(l, r), nil
+			}
+		}
+		if s, ok := left.(string); ok && rnum {
+			if r <= 0 {
+				return nil, nil
+			}
+			return strings.Repeat(s, int(r)), nil
+		}
+	case "/":
+		if l, ok := left.(string); ok {
+			if r, ok := right.(string); ok {
+				return jqStringList(strings.Split(l, r)), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%s (%s) and %s (%s) cannot be combined with %s",
+		jqTypeName(left), jqToJSON(left), jqTypeName(right), jqToJSON(right), op)
+}
+
+// jqDeepMerge merges right into a copy of left recursively
+func jqDeepMerge(left, right map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(left)+len(right))
+	for k, v := range left {
+		merged[k] = v
+	}
+	for k, v := range right {
+		l, lok := merged[k].(map[string]interface{})
+		r, rok := v.(map[string]interface{})
+		if lok && rok {
+			merged[k] = jqDeepMerge(l, r)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+type jqLogicalNode struct {
+	op    string
+	left  jqNode
+	right jqNode
+}
+
+func (n *jqLogicalNode) eval(input interface{}, env *jqEnv) ([]interface{}, error) {
+	lefts, err := n.left.eval(input, env)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []interface{}
+	for _, left := range lefts {
+		truthy := jqTruthy(left)
+		if n.op == "and" && !truthy || n.op == "or" && truthy {
+			outputs = append(outputs, truthy)
+			continue
+		}
+		rights, err := n.right.eval(input, env)
+		if err != nil {
+			return nil, err
+		}
+		for _, right := range rights {
+			outputs = append(outputs, jqTruthy(right))
+		}
+	}
+	return outputs, nil
+}
+
+type jqAlternativeNode struct {
+	left  jqNode
+	right jqNode
+}
+
+func (n *jqAlternativeNode) eval(input interface{}, env *jqEnv) ([]interface{}, error) {
+	lefts, err := n.left.eval(input, env)
+	var outputs []interface{}
+	if err == nil {
+		for _, left := range lefts {
+			if jqTruthy(left) {
+				outputs = append(outputs, left)
+			}
+		}
+	}
+	if len(outputs) > 0 {
+		return outputs, nil
+	}
+	return n.right.eval(input, env)
+}
+
+type jqIfNode struct {
+	cond      jqNode
+	then      jqNode
+	otherwise jqNode
+}
+
+func (n *jqIfNode) eval(input interface{}, env *jqEnv) ([]interface{}, error) {
+	conds, err := n.cond.eval(input, env)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []interface{}
+	for _, cond := range conds {
+		branch := n.then
+		if !jqTruthy(cond) {
+			branch = n.otherwise
+		}
+		if branch == nil {
+			outputs = append(outputs, input)
+			continue
+		}
+		results, err := branch.eval(input, env)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, results...)
+	}
+	return outputs, nil
+}
+
+type jqTryNode struct {
+	body  jqNode
+	catch jqNode
+}
+
+func (n *jqTryNode) eval(input interface{}, env *jqEnv) ([]interface{}, error) {
+	outputs, err := n.body.eval(input, env)
+	if err == nil {
+		return outputs, nil
+	}
+	if n.catch == nil {
+		return nil, nil
+	}
+	var jqErr *jqError
+	if errors.As(err, &jqErr) {
+		return n.catch.eval(jqErr.value, env)
+	}
+	return n.catch.eval(err.Error(), env)
+}
+
+func (n *jqTryNode) paths(input interface{}, env *jqEnv) ([][]interface{}, error) {
+	body, ok := n.body.(jqPathNode)
+	if !ok {
+		return nil, errors.New("invalid path expression")
+	}
+	result, err := body.paths(input, env)
+	if err != nil {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// jqError is an error raised by the error builtin
+type jqError struct {
+	value interface{}
+}
+
+func (e *jqError) Error() string {
+	if s, ok := e.value.(string); ok {
+		return s
+	}
+	return jqToJSON(e.value)
+}
+
+type jqBindNode struct {
+	source jqNode
+	name   string
+	body   jqNode
+}
+
+func (n *jqBindNode) eval(input interface{}, env *jqEnv) ([]interface{}, error) {
+	values, err := n.source.eval(input, env)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []interface{}
+	for _, value := range values {
+		results, err := n.body.eval(input, env.bind(n.name, value))
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, results...)
+	}
+	return outputs, nil
+}
+
+type jqReduceNode struct {
+	source jqNode
+	name   string
+	init   jqNode
+	update jqNode
+}
+
+func (n *jqReduceNode) eval(input interface{}, env *jqEnv) ([]interface{}, error) {
+	accumulators, err := n.init.eval(input, env)
+	if err != nil {
+		return nil, err
+	}
+	values, err := n.source.eval(input, env)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []interface{}
+	for _, accumulator := range accumulators {
+		for _, value := range values {
+			results, err := n.update.eval(accumulator, env.bind(n.name, value))
+			if err != nil {
+				return nil, err
+			}
+			if len(results) == 0 {
+				accumulator = nil
+				continue
+			}
+			accumulator = results[len(results)-1]
+		}
+		outputs = append(outputs, accumulator)
+	}
+	return outputs, nil
+}
+
+type jqAssignNode struct {
+	op    string
+	path  jqPathNode
+	value jqNode
+}
+
+func (n *jqAssignNode) eval(input interface{}, env *jqEnv) ([]interface{}, error) {
+	paths, err := n.path.paths(input, env)
+	if err != nil {
+		return nil, err
+	}
+
+	// .a |= f updates every path with f applied to its current value
+	if n.op == "|=" {
+		result := input
+		var deleted [][]interface{}
+		for _, path := range paths {
+			current, err := jqGetPath(result, path)
+			if err != nil {
+				return nil, err
+			}
+			values, err := n.value.eval(current, env)
+			if err != nil {
+				return nil, err
+			}
+			if len(values) == 0 {
+				deleted = append(deleted, path)
+				continue
+			}
+			if result, err = jqSetPath(result, path, values[0]); err != nil {
+				return nil, err
+			}
+		}
+		if len(deleted) > 0 {
+			return []interface{}{jqDeletePaths(result, deleted)}, nil
+		}
+		return []interface{}{result}, nil
+	}
+
+	// The right side of the other assignments is evaluated against the input
+	values, err := n.value.eval(input, env)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []interface{}
+	for _, value := range values {
+		result := input
+		for _, path := range paths {
+			newValue := value
+			if n.op != "=" {
+				current, err := jqGetPath(result, path)
+				if err != nil {
+					return nil, err
+				}
+				if n.op == "//=" {
+					if jqTruthy(current) {
+						newValue = current
+					}
+				} else if newValue, err = jqBinary(strings.TrimSuffix(n.op, "="), current, value); err != nil {
+					return nil, err
+				}
+			}
+			if result, err = jqSetPath(result, path, newValue); err != nil {
+				return nil, err
+			}
+		}
+		outputs = append(outputs, result)
+	}
+	return outputs, nil
+}
+
+type jqCallNode struct {
+	name string
+	args []jqNode
+}
+
+// jqBuiltin implements a builtin function for one input
+type jqBuiltin func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error)
+
+func (n *jqCallNode) eval(input interface{}, env *jqEnv) ([]interface{}, error) {
+	builtin := jqBuiltins[fmt.Sprintf("%s/%d", n.name, len(n.args))]
+	return builtin(input, n.args, env)
+}
+
+func (n *jqCallNode) paths(input interface{}, env *jqEnv) ([][]interface{}, error) {
+	switch fmt.Sprintf("%s/%d", n.name, len(n.args)) {
+	case "empty/0":
+		return nil, nil
+	case "recurse/0":
+		return jqDescendantPaths(input, []interface{}{}, nil), nil
+	case "select/1":
+		conds, err := n.args[0].eval(input, env)
+		if err != nil {
+			return nil, err
+		}
+		var result [][]interface{}
+		for _, cond := range conds {
+			if jqTruthy(cond) {
+				result = append(result, []interface{}{})
+			}
+		}
+		return result, nil
+	case "getpath/1":
+		values, err := n.args[0].eval(input, env)
+		if err != nil {
+			return nil, err
+		}
+		var result [][]interface{}
+		for _, value := range values {
+			path, ok := value.([]interface{})
+			if !ok {
+				return nil, errors.New("path must be an array")
+			}
+			result = append(result, path)
+		}
+		return result, nil
+	case "first/0":
+		return [][]interface{}{{float64(0)}}, nil
+	case "last/0":
+		return [][]interface{}{{float64(-1)}}, nil
+	}
+	return nil, fmt.Errorf("invalid path expression %s", n.name)
+}
+
+// Path helpers
+
+// jqGetPath returns the value at path
+func jqGetPath(value interface{}, path []interface{}) (interface{}, error) {
+	for _, key := range path {
+		var err error
+		if value, err = jqIndex(value, key); err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// jqSetPath returns a copy of root with the value at path replaced
+func jqSetPath(root interface{}, path []interface{}, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	switch key := path[0].(type) {
+	case string:
+		object, ok := root.(map[string]interface{})
+		if !ok && root != nil {
+			return nil, fmt.Errorf("cannot index %s with string", jqTypeName(root))
+		}
+		copied := make(map[string]interface{}, len(object)+1)
+		for k, v := range object {
+			copied[k] = v
+		}
+		child, err := jqSetPath(copied[key], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		copied[key] = child
+		return copied, nil
+	case float64:
+		list, ok := root.([]interface{})
+		if !ok && root != nil {
+			return nil, fmt.Errorf("cannot index %s with number", jqTypeName(root))
+		}
+		index := int(key)
+		if index < 0 {
+			index += len(list)
+			if index < 0 {
+				return nil, errors.New("out of bounds negative array index")
+			}
+		}
+		copied := make([]interface{}, len(list))
+		copy(copied, list)
+		for len(copied) <= index {
+			copied = append(copied, nil)
+		}
+		child, err := jqSetPath(copied[index], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		copied[index] = child
+		return copied, nil
+	}
+	return nil, fmt.Errorf("invalid path component %s", jqToJSON(path[0]))
+}
+
+// jqDeletePaths returns a copy of root without the values at paths. Array
+// elements are removed from the highest index down so indexes stay valid.
+func jqDeletePaths(root interface{}, paths [][]interface{}) interface{} {
+	sorted := append([][]interface{}{}, paths...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return jqCompare(sorted[i], sorted[j]) > 0
+	})
+	for _, path := range sorted {
+		root = jqDeletePath(root, path)
+	}
+	return root
+}
+
+// jqDeletePath returns a copy of root without the value at path
+func jqDeletePath(root interface{}, path []interface{}) interface{} {
+	if len(path) == 0 {
+		return nil
+	}
+	switch v := root.(type) {
+	case map[string]interface{}:
+		key, ok := path[0].(string)
+		if !ok {
+			return root
+		}
+		if _, exists := v[key]; !exists {
+			return root
+		}
+		copied := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			copied[k] = value
+		}
+		if len(path) == 1 {
+			delete(copied, key)
+		} else {
+			copied[key] = jqDeletePath(v[key], path[1:])
+		}
+		return copied
+	case []interface{}:
+		key, ok := path[0].(float64)
+		if !ok {
+			return root
+		}
+		index := int(key)
+		if index < 0 {
+			index += len(v)
+		}
+		if index < 0 || index >= len(v) {
+			return root
+		}
+		if len(path) == 1 {
+			return append(append([]interface{}{}, v[:index]...), v[index+1:]...)
+		}
+		copied := append([]interface{}{}, v...)
+		copied[index] = jqDeletePath(v[index], path[1:])
+		return copied
+	}
+	return root
+}
+
+// Value helpers
+
+// jqTypeName returns the jq type of value
+func jqTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// jqTruthy reports whether value is neither null nor false
+func jqTruthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	}
+	return true
+}
+
+// jqTypeOrder ranks types in jq sort order
+func jqTypeOrder(value interface{}) int {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case bool:
+		if v {
+			return 2
+		}
+		return 1
+	case float64:
+		return 3
+	case string:
+		return 4
+	case []interface{}:
+		return 5
+	}
+	return 6
+}
+
+// jqCompare orders two values: null < false < true < numbers < strings <
+// arrays < objects
+func jqCompare(left, right interface{}) int {
+	lo, ro := jqTypeOrder(left), jqTypeOrder(right)
+	if lo != ro {
+		if lo < ro {
+			return -1
+		}
+		return 1
+	}
+	switch l := left.(type) {
+	case float64:
+		r := right.(float64)
+		switch {
+		case l < r:
+			return -1
+		case l > r:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(l, right.(string))
+	case []interface{}:
+		r := right.([]interface{})
+		for i := 0; i < len(l) && i < len(r); i++ {
+			if cmp := jqCompare(l[i], r[i]); cmp != 0 {
+				return cmp
+			}
+		}
+		return jqCompare(float64(len(l)), float64(len(r)))
+	case map[string]interface{}:
+		r := right.(map[string]interface{})
+		lkeys, rkeys := Keys(l), Keys(r)
+		if cmp := jqCompare(jqStringList(lkeys), jqStringList(rkeys)); cmp != 0 {
+			return cmp
+		}
+		for _, key := range lkeys {
+			if cmp := jqCompare(l[key], r[key]); cmp != 0 {
+				return cmp
+			}
+		}
+	}
+	return 0
+}
+
+// jqContainsValue reports whether list holds value
+func jqContainsValue(list []interface{}, value interface{}) bool {
+	for _, item := range list {
+		if jqCompare(item, value) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// jqContains implements contains: substrings, subsets of arrays and objects
+func jqContains(container, value interface{}) bool {
+	switch c := container.(type) {
+	case string:
+		v, ok := value.(string)
+		return ok && strings.Contains(c, v)
+	case []interface{}:
+		v, ok := value.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, item := range v {
+			found := false
+			for _, candidate := range c {
+				if jqContains(candidate, item) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		v, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, item := range v {
+			existing, exists := c[key]
+			if !exists || !jqContains(existing, item) {
+				return false
+			}
+		}
+		return true
+	}
+	return jqCompare(container, value) == 0
+}
+
+// jqStringList converts strings to a jq array
+func jqStringList(values []string) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, value := range values {
+		result[i] = value
+	}
+	return result
+}
+
+// jqToJSON encodes value as compact JSON
+func jqToJSON(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+// jqToString returns strings unchanged and other values as JSON
+func jqToString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return jqToJSON(value)
+}
+
+// jqLength implements length
+func jqLength(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return float64(0), nil
+	case bool:
+		return nil, errors.New("boolean has no length")
+	case float64:
+		return math.Abs(v), nil
+	case string:
+		return float64(utf8.RuneCountInString(v)), nil
+	case []interface{}:
+		return float64(len(v)), nil
+	case map[string]interface{}:
+		return float64(len(v)), nil
+	}
+	return nil, fmt.Errorf("%s has no length", jqTypeName(value))
+}
+
+// jqEach returns the items of an array or the values of an object
+func jqEach(input interface{}) ([]interface{}, error) {
+	switch v := input.(type) {
+	case []interface{}:
+		return v, nil
+	case map[string]interface{}:
+		values := make([]interface{}, 0, len(v))
+		for _, key := range Keys(v) {
+			values = append(values, v[key])
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("cannot iterate over %s", jqTypeName(input))
+}
+
+// jqSortBy sorts an array by the outputs of f
+func jqSortBy(input interface{}, f jqNode, env *jqEnv) ([]interface{}, [][]interface{}, error) {
+	list, ok := input.([]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("%s cannot be sorted, as it is not an array", jqTypeName(input))
+	}
+	type keyed struct {
+		item interface{}
+		key  []interface{}
+	}
+	items := make([]keyed, len(list))
+	for i, item := range list {
+		key, err := f.eval(item, env)
+		if err != nil {
+			return nil, nil, err
+		}
+		items[i] = keyed{item: item, key: key}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return jqCompare(items[i].key, items[j].key) < 0
+	})
+	sorted := make([]interface{}, len(items))
+	keys := make([][]interface{}, len(items))
+	for i, item := range items {
+		sorted[i] = item.item
+		keys[i] = item.key
+	}
+	return sorted, keys, nil
+}
+
+// jqSingle wraps a single output
+func jqSingle(value interface{}, err error) ([]interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{value}, nil
+}
+
+// jqStringInput checks that a builtin receives a string
+func jqStringInput(name string, input interface{}) (string, error) {
+	s, ok := input.(string)
+	if !ok {
+		return "", fmt.Errorf("%s input must be a string, got %s", name, jqTypeName(input))
+	}
+	return s, nil
+}
+
+// jqStringArgs evaluates a string argument of a builtin
+func jqStringArgs(name string, arg jqNode, input interface{}, env *jqEnv) ([]string, error) {
+	values, err := arg.eval(input, env)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, len(values))
+	for i, value := range values {
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s argument must be a string, got %s", name, jqTypeName(value))
+		}
+		result[i] = s
+	}
+	return result, nil
+}
+
+// jqStringFunc builds a builtin taking a string input and a string argument
+func jqStringFunc(name string, fn func(s, arg string) (interface{}, error)) jqBuiltin {
+	return func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+		s, err := jqStringInput(name, input)
+		if err != nil {
+			return nil, err
+		}
+		values, err := jqStringArgs(name, args[0], input, env)
+		if err != nil {
+			return nil, err
+		}
+		var outputs []interface{}
+		for _, value := range values {
+			result, err := fn(s, value)
+			if err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, result)
+		}
+		return outputs, nil
+	}
+}
+
+// jqValueFunc builds a builtin of the input alone
+func jqValueFunc(fn func(input interface{}) (interface{}, error)) jqBuiltin {
+	return func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+		return jqSingle(fn(input))
+	}
+}
+
+// jqBuiltins maps name/arity to the builtin functions
+var jqBuiltins map[string]jqBuiltin
+
+func init() {
+	jqBuiltins = map[string]jqBuiltin{
+		"empty/0": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			return nil, nil
+		},
+		"error/0": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			return nil, &jqError{value: input}
+		},
+		"error/1": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			values, err := args[0].eval(input, env)
+			if err != nil {
+				return nil, err
+			}
+			if len(values) == 0 {
+				return nil, nil
+			}
+			return nil, &jqError{value: values[0]}
+		},
+		"not/0": jqValueFunc(func(input interface{}) (interface{}, error) {
+			return !jqTruthy(input), nil
+		}),
+		"length/0": jqValueFunc(jqLength),
+		"type/0": jqValueFunc(func(input interface{}) (interface{}, error) {
+			return jqTypeName(input), nil
+		}),
+		"keys/0": jqValueFunc(func(input interface{}) (interface{}, error) {
+			switch v := input.(type) {
+			case map[string]interface{}:
+				return jqStringList(Keys(v)), nil
+			case []interface{}:
+				keys := make([]interface{}, len(v))
+				for i := range v {
+					keys[i] = float64(i)
+				}
+				return keys, nil
+			}
+			return nil, fmt.Errorf("%s has no keys", jqTypeName(input))
+		}),
+		"values/0": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			if input == nil {
+				return nil, nil
+			}
+			return []interface{}{input}, nil
+		},
+		"has/1": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			keys, err := args[0].eval(input, env)
+			if err != nil {
+				return nil, err
+			}
+			var outputs []interface{}
+			for _, key := range keys {
+				switch v := input.(type) {
+				case map[string]interface{}:
+					k, ok := key.(string)
+					if !ok {
+						return nil, errors.New("object keys must be strings")
+					}
+					_, exists := v[k]
+					outputs = append(outputs, exists)
+				case []interface{}:
+					k, ok := key.(float64)
+					if !ok {
+						return nil, errors.New("array indexes must be numbers")
+					}
+					outputs = append(outputs, k >= 0 && int(k) < len(v))
+				default:
+					return nil, fmt.Errorf("cannot check whether %s has a key", jqTypeName(input))
+				}
+			}
+			return outputs, nil
+		},
+		"contains/1": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			values, err := args[0].eval(input, env)
+			if err != nil {
+				return nil, err
+			}
+			var outputs []interface{}
+			for _, value := range values {
+				outputs = append(outputs, jqContains(input, value))
+			}
+			return outputs, nil
+		},
+		"map/1": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			items, err := jqEach(input)
+			if err != nil {
+				return nil, err
+			}
+			result := []interface{}{}
+			for _, item := range items {
+				values, err := args[0].eval(item, env)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, values...)
+			}
+			return []interface{}{result}, nil
+		},
+		"map_values/1": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			switch v := input.(type) {
+			case map[string]interface{}:
+				result := make(map[string]interface{}, len(v))
+				for key, item := range v {
+					values, err := args[0].eval(item, env)
+					if err != nil {
+						return nil, err
+					}
+					if len(values) > 0 {
+						result[key] = values[0]
+					}
+				}
+				return []interface{}{result}, nil
+			case []interface{}:
+				result := []interface{}{}
+				for _, item := range v {
+					values, err := args[0].eval(item, env)
+					if err != nil {
+						return nil, err
+					}
+					if len(values) > 0 {
+						result = append(result, values[0])
+					}
+				}
+				return []interface{}{result}, nil
+			}
+			return nil, fmt.Errorf("cannot iterate over %s", jqTypeName(input))
+		},
+		"select/1": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			conds, err := args[0].eval(input, env)
+			if err != nil {
+				return nil, err
+			}
+			var outputs []interface{}
+			for _, cond := range conds {
+				if jqTruthy(cond) {
+					outputs = append(outputs, input)
+				}
+			}
+			return outputs, nil
+		},
+		"recurse/0": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			return jsonPathDescendants(input, nil), nil
+		},
+		"to_entries/0": jqValueFunc(func(input interface{}) (interface{}, error) {
+			object, ok := input.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s has no entries", jqTypeName(input))
+			}
+			entries := make([]interface{}, 0, len(object))
+			for _, key := range Keys(object) {
+				entries = append(entries, map[string]interface{}{"key": key, "value": object[key]})
+			}
+			return entries, nil
+		}),
+		"from_entries/0": jqValueFunc(jqFromEntries),
+		"with_entries/1": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			object, ok := input.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s has no entries", jqTypeName(input))
+			}
+			entries := []interface{}{}
+			for _, key := range Keys(object) {
+				values, err := args[0].eval(map[string]interface{}{"key": key, "value": object[key]}, env)
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, values...)
+			}
+			return jqSingle(jqFromEntries(entries))
+		},
+		"add/0": jqValueFunc(func(input interface{}) (interface{}, error) {
+			items, err := jqEach(input)
+			if err != nil {
+				return nil, err
+			}
+			var sum interface{}
+			for _, item := range items {
+				if sum, err = jqBinary("+", sum, item); err != nil {
+					return nil, err
+				}
+			}
+			return sum, nil
+		}),
+		"any/0": jqValueFunc(func(input interface{}) (interface{}, error) {
+			items, err := jqEach(input)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				if jqTruthy(item) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}),
+		"all/0": jqValueFunc(func(input interface{}) (interface{}, error) {
+			items, err := jqEach(input)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				if !jqTruthy(item) {
+					return false, nil
+				}
+			}
+			return true, nil
+		}),
+		"any/1": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			items, err := jqEach(input)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				values, err := args[0].eval(item, env)
+				if err != nil {
+					return nil, err
+				}
+				for _, value := range values {
+					if jqTruthy(value) {
+						return []interface{}{true}, nil
+					}
+				}
+			}
+			return []interface{}{false}, nil
+		},
+		"all/1": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			items, err := jqEach(input)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				values, err := args[0].eval(item, env)
+				if err != nil {
+					return nil, err
+				}
+				for _, value := range values {
+					if !jqTruthy(value) {
+						return []interface{}{false}, nil
+					}
+				}
+			}
+			return []interface{}{true}, nil
+		},
+		"flatten/0": jqValueFunc(func(input interface{}) (interface{}, error) {
+			return jqFlatten(input, -1)
+		}),
+		"flatten/1": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			depths, err := args[0].eval(input, env)
+			if err != nil {
+				return nil, err
+			}
+			var outputs []interface{}
+			for _, depth := range depths {
+				d, ok := depth.(float64)
+				if !ok || d < 0 {
+					return nil, errors.New("flatten depth must not be negative")
+				}
+				result, err := jqFlatten(input, int(d))
+				if err != nil {
+					return nil, err
+				}
+				outputs = append(outputs, result)
+			}
+			return outputs, nil
+		},
+		"range/1": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			limits, err := args[0].eval(input, env)
+			if err != nil {
+				return nil, err
+			}
+			var outputs []interface{}
+			for _, limit := range limits {
+				n, ok := limit.(float64)
+				if !ok {
+					return nil, errors.New("range limit must be a number")
+				}
+				for i := float64(0); i < n; i++ {
+					outputs = append(outputs, i)
+				}
+			}
+			return outputs, nil
+		},
+		"range/2": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			froms, err := args[0].eval(input, env)
+			if err != nil {
+				return nil, err
+			}
+			tos, err := args[1].eval(input, env)
+			if err != nil {
+				return nil, err
+			}
+			var outputs []interface{}
+			for _, from := range froms {
+				for _, to := range tos {
+					f, fok := from.(float64)
+					t, tok := to.(float64)
+					if !fok || !tok {
+						return nil, errors.New("range bounds must be numbers")
+					}
+					for i := f; i < t; i++ {
+						outputs = append(outputs, i)
+					}
+				}
+			}
+			return outputs, nil
+		},
+		"floor/0": jqValueFunc(func(input interface{}) (interface{}, error) {
+			n, ok := input.(float64)
+			if !ok {
+				return nil, fmt.Errorf("%s has no floor", jqTypeName(input))
+			}
+			return math.Floor(n), nil
+		}),
+		"ceil/0": jqValueFunc(func(input interface{}) (interface{}, error) {
+			n, ok := input.(float64)
+			if !ok {
+				return nil, fmt.Errorf("%s has no ceiling", jqTypeName(input))
+			}
+			return math.Ceil(n), nil
+		}),
+		"round/0": jqValueFunc(func(input interface{}) (interface{}, error) {
+			n, ok := input.(float64)
+			if !ok {
+				return nil, fmt.Errorf("%s cannot be rounded", jqTypeName(input))
+			}
+			return math.Round(n), nil
+		}),
+		"tostring/0": jqValueFunc(func(input interface{}) (interface{}, error) {
+			return jqToString(input), nil
+		}),
+		"tonumber/0": jqValueFunc(func(input interface{}) (interface{}, error) {
+			switch v := input.(type) {
+			case float64:
+				return v, nil
+			case string:
+				n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				if err != nil {
+					return nil, fmt.Errorf("cannot parse %q as a number", v)
+				}
+				return n, nil
+			}
+			return nil, fmt.Errorf("%s cannot be parsed as a number", jqTypeName(input))
+		}),
+		"tojson/0": jqValueFunc(func(input interface{}) (interface{}, error) {
+			return jqToJSON(input), nil
+		}),
+		"fromjson/0": jqValueFunc(func(input interface{}) (interface{}, error) {
+			s, err := jqStringInput("fromjson", input)
+			if err != nil {
+				return nil, err
+			}
+			var value interface{}
+			if err := json.Unmarshal([]byte(s), &value); err != nil {
+				return nil, fmt.Errorf("fromjson: %w", err)
+			}
+			return value, nil
+		}),
+		"ascii_downcase/0": jqValueFunc(func(input interface{}) (interface{}, error) {
+			s, err := jqStringInput("ascii_downcase", input)
+			return strings.ToLower(s), err
+		}),
+		"ascii_upcase/0": jqValueFunc(func(input interface{}) (interface{}, error) {
+			s, err := jqStringInput("ascii_upcase", input)
+			return strings.ToUpper(s), err
+		}),
+		"ltrimstr/1": jqStringFunc("ltrimstr", func(s, prefix string) (interface{}, error) {
+			return strings.TrimPrefix(s, prefix), nil
+		}),
+		"rtrimstr/1": jqStringFunc("rtrimstr", func(s, suffix string) (interface{}, error) {
+			return strings.TrimSuffix(s, suffix), nil
+		}),
+		"startswith/1": jqStringFunc("startswith", func(s, prefix string) (interface{}, error) {
+			return strings.HasPrefix(s, prefix), nil
+		}),
+		"endswith/1": jqStringFunc("endswith", func(s, suffix string) (interface{}, error) {
+			return strings.HasSuffix(s, suffix), nil
+		}),
+		"split/1": jqStringFunc("split", func(s, sep string) (interface{}, error) {
+			return jqStringList(strings.Split(s, sep)), nil
+		}),
+		"test/1": jqStringFunc("test", func(s, pattern string) (interface{}, error) {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			return re.MatchString(s), nil
+		}),
+		"sub/2":  jqRegexReplace("sub", false),
+		"gsub/2": jqRegexReplace("gsub", true),
+		"join/1": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			items, err := jqEach(input)
+			if err != nil {
+				return nil, err
+			}
+			seps, err := jqStringArgs("join", args[0], input, env)
+			if err != nil {
+				return nil, err
+			}
+			var outputs []interface{}
+			for _, sep := range seps {
+				parts := make([]string, 0, len(items))
+				for _, item := range items {
+					switch v := item.(type) {
+					case nil:
+						parts = append(parts, "")
+					case string:
+						parts = append(parts, v)
+					case float64, bool:
+						parts = append(parts, jqToJSON(v))
+					default:
+						return nil, fmt.Errorf("cannot join with %s", jqTypeName(item))
+					}
+				}
+				outputs = append(outputs, strings.Join(parts, sep))
+			}
+			return outputs, nil
+		},
+		"sort/0": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			sorted, _, err := jqSortBy(input, &jqIdentityNode{}, env)
+			return jqSingle(sorted, err)
+		},
+		"sort_by/1": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			sorted, _, err := jqSortBy(input, args[0], env)
+			return jqSingle(sorted, err)
+		},
+		"group_by/1": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			sorted, keys, err := jqSortBy(input, args[0], env)
+			if err != nil {
+				return nil, err
+			}
+			groups := []interface{}{}
+			for i, item := range sorted {
+				if i == 0 || jqCompare(keys[i], keys[i-1]) != 0 {
+					groups = append(groups, []interface{}{item})
+					continue
+				}
+				last := groups[len(groups)-1].([]interface{})
+				groups[len(groups)-1] = append(last, item)
+			}
+			return []interface{}{groups}, nil
+		},
+		"unique/0": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			return jqUniqueBy(input, &jqIdentityNode{}, env)
+		},
+		"unique_by/1": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			return jqUniqueBy(input, args[0], env)
+		},
+		"min/0": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			sorted, _, err := jqSortBy(input, &jqIdentityNode{}, env)
+			if err != nil || len(sorted) == 0 {
+				return jqSingle(nil, err)
+			}
+			return []interface{}{sorted[0]}, nil
+		},
+		"max/0": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			sorted, _, err := jqSortBy(input, &jqIdentityNode{}, env)
+			if err != nil || len(sorted) == 0 {
+				return jqSingle(nil, err)
+			}
+			return []interface{}{sorted[len(sorted)-1]}, nil
+		},
+		"min_by/1": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			sorted, _, err := jqSortBy(input, args[0], env)
+			if err != nil || len(sorted) == 0 {
+				return jqSingle(nil, err)
+			}
+			return []interface{}{sorted[0]}, nil
+		},
+		"max_by/1": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			sorted, _, err := jqSortBy(input, args[0], env)
+			if err != nil || len(sorted) == 0 {
+				return jqSingle(nil, err)
+			}
+			return []interface{}{sorted[len(sorted)-1]}, nil
+		},
+		"reverse/0": jqValueFunc(func(input interface{}) (interface{}, error) {
+			switch v := input.(type) {
+			case nil:
+				return []interface{}{}, nil
+			case string:
+				runes := []rune(v)
+				for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+					runes[i], runes[j] = runes[j], runes[i]
+				}
+				return string(runes), nil
+			case []interface{}:
+				return Reverse(v), nil
+			}
+			return nil, fmt.Errorf("cannot reverse %s", jqTypeName(input))
+		}),
+		"first/0": jqValueFunc(func(input interface{}) (interface{}, error) {
+			return jqIndex(input, float64(0))
+		}),
+		"last/0": jqValueFunc(func(input interface{}) (interface{}, error) {
+			return jqIndex(input, float64(-1))
+		}),
+		"first/1": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			values, err := args[0].eval(input, env)
+			if err != nil || len(values) == 0 {
+				return nil, err
+			}
+			return values[:1], nil
+		},
+		"last/1": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			values, err := args[0].eval(input, env)
+			if err != nil || len(values) == 0 {
+				return nil, err
+			}
+			return values[len(values)-1:], nil
+		},
+		"limit/2": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			limits, err := args[0].eval(input, env)
+			if err != nil {
+				return nil, err
+			}
+			values, err := args[1].eval(input, env)
+			if err != nil {
+				return nil, err
+			}
+			var outputs []interface{}
+			for _, limit := range limits {
+				n, ok := limit.(float64)
+				if !ok {
+					return nil, errors.New("limit must be a number")
+				}
+				if int(n) < len(values) {
+					outputs = append(outputs, values[:int(math.Max(n, 0))]...)
+				} else {
+					outputs = append(outputs, values...)
+				}
+			}
+			return outputs, nil
+		},
+		"del/1": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			path, ok := args[0].(jqPathNode)
+			if !ok {
+				return nil, errors.New("del argument must be a path expression")
+			}
+			paths, err := path.paths(input, env)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{jqDeletePaths(input, paths)}, nil
+		},
+		"getpath/1": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			values, err := args[0].eval(input, env)
+			if err != nil {
+				return nil, err
+			}
+			var outputs []interface{}
+			for _, value := range values {
+				path, ok := value.([]interface{})
+				if !ok {
+					return nil, errors.New("path must be an array")
+				}
+				result, err := jqGetPath(input, path)
+				if err != nil {
+					return nil, nil
+				}
+				outputs = append(outputs, result)
+			}
+			return outputs, nil
+		},
+		"setpath/2": func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+			paths, err := args[0].eval(input, env)
+			if err != nil {
+				return nil, err
+			}
+			values, err := args[1].eval(input, env)
+			if err != nil {
+				return nil, err
+			}
+			var outputs []interface{}
+			for _, p := range paths {
+				path, ok := p.([]interface{})
+				if !ok {
+					return nil, errors.New("path must be an array")
+				}
+				for _, value := range values {
+					result, err := jqSetPath(input, path, value)
+					if err != nil {
+						return nil, err
+					}
+					outputs = append(outputs, result)
+				}
+			}
+			return outputs, nil
+		},
+		"paths/0": jqValueFunc(func(input interface{}) (interface{}, error) {
+			all := jqDescendantPaths(input, []interface{}{}, nil)
+			paths := make([]interface{}, 0, len(all))
+			for _, path := range all[1:] {
+				paths = append(paths, path)
+			}
+			return paths, nil
+		}),
+		"@text": jqValueFunc(func(input interface{}) (interface{}, error) {
+			return jqToString(input), nil
+		}),
+		"@json": jqValueFunc(func(input interface{}) (interface{}, error) {
+			return jqToJSON(input), nil
+		}),
+		"@base64": jqValueFunc(func(input interface{}) (interface{}, error) {
+			return base64.StdEncoding.EncodeToString([]byte(jqToString(input))), nil
+		}),
+		"@base64d": jqValueFunc(func(input interface{}) (interface{}, error) {
+			return Base64Decode(jqToString(input))
+		}),
+		"@uri": jqValueFunc(func(input interface{}) (interface{}, error) {
+			return url.QueryEscape(jqToString(input)), nil
+		}),
+	}
+
+	// Formats are called without arguments, e.g. .token | @base64
+	for _, name := range []string{"@text", "@json", "@base64", "@base64d", "@uri"} {
+		jqBuiltins[name+"/0"] = jqBuiltins[name]
+		delete(jqBuiltins, name)
+	}
+}
+
+// jqFromEntries builds an object from {key, value} entries. The k, name,
+// v and Value spellings are accepted like jq does.
+func jqFromEntries(input interface{}) (interface{}, error) {
+	entries, ok := input.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("from_entries input must be an array, got %s", jqTypeName(input))
+	}
+	result := make(map[string]interface{}, len(entries))
+	for _, entry := range entries {
+		object, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("from_entries entries must be objects, got %s", jqTypeName(entry))
+		}
+		var key interface{}
+		for _, name := range []string{"key", "k", "name", "Name", "Key", "K"} {
+			if k, exists := object[name]; exists && k != nil {
+				key = k
+				break
+			}
+		}
+		var value interface{}
+		for _, name := range []string{"value", "v", "Value", "V"} {
+			if v, exists := object[name]; exists {
+				value = v
+				break
+			}
+		}
+		switch k := key.(type) {
+		case string:
+			result[k] = value
+		case float64, bool:
+			result[jqToJSON(k)] = value
+		default:
+			return nil, errors.New("from_entries entries need a string key")
+		}
+	}
+	return result, nil
+}
+
+// jqFlatten flattens nested arrays up to depth levels; depth < 0 flattens
+// everything
+func jqFlatten(input interface{}, depth int) (interface{}, error) {
+	list, ok := input.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot flatten %s", jqTypeName(input))
+	}
+	result := []interface{}{}
+	for _, item := range list {
+		if nested, ok := item.([]interface{}); ok && depth != 0 {
+			flattened, err := jqFlatten(nested, depth-1)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, flattened.([]interface{})...)
+			continue
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// jqUniqueBy sorts an array by f and keeps the first item of every key
+func jqUniqueBy(input interface{}, f jqNode, env *jqEnv) ([]interface{}, error) {
+	sorted, keys, err := jqSortBy(input, f, env)
+	if err != nil {
+		return nil, err
+	}
+	result := []interface{}{}
+	for i, item := range sorted {
+		if i == 0 || jqCompare(keys[i], keys[i-1]) != 0 {
+			result = append(result, item)
+		}
+	}
+	return []interface{}{result}, nil
+}
+
+// jqRegexReplace builds sub and gsub
+func jqRegexReplace(name string, global bool) jqBuiltin {
+	return func(input interface{}, args []jqNode, env *jqEnv) ([]interface{}, error) {
+		s, err := jqStringInput(name, input)
+		if err != nil {
+			return nil, err
+		}
+		patterns, err := jqStringArgs(name, args[0], input, env)
+		if err != nil {
+			return nil, err
+		}
+		replacements, err := jqStringArgs(name, args[1], input, env)
+		if err != nil {
+			return nil, err
+		}
+		var outputs []interface{}
+		for _, pattern := range patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			for _, replacement := range replacements {
+				if global {
+					outputs = append(outputs, re.ReplaceAllLiteralString(s, replacement))
+					continue
+				}
+				replaced := false
+				outputs = append(outputs, re.ReplaceAllStringFunc(s, func(match string) string {
+					if replaced {
+						return match
+					}
+					replaced = true
+					return replacement
+				}))
+			}
+		}
+		return outputs, nil
+	}
+}
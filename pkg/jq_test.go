@@ -0,0 +1,86 @@
+package pkg
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJq(t *testing.T) {
+	var data interface{}
+	json.Unmarshal([]byte(`{
+		"user": {"id": 7, "name": "Ana", "secret": "x"},
+		"items": [
+			{"id": "a1", "price": 5, "tags": ["new"]},
+			{"id": "b2", "price": 15},
+			{"id": "c3", "price": 25}
+		]
+	}`), &data)
+
+	tests := []struct {
+		program  string
+		expected []interface{}
+	}{
+		{".user.name", []interface{}{"Ana"}},
+		{".items[1].id", []interface{}{"b2"}},
+		{".items[-1].price", []interface{}{float64(25)}},
+		{".items[].id", []interface{}{"a1", "b2", "c3"}},
+		{"[.items[] | select(.price > 10) | .id]", []interface{}{[]interface{}{"b2", "c3"}}},
+		{"{id: .user.id, name: .user.name}", []interface{}{map[string]interface{}{"id": float64(7), "name": "Ana"}}},
+		{".user | {id, name}", []interface{}{map[string]interface{}{"id": float64(7), "name": "Ana"}}},
+		{"del(.user.secret) | .user | keys", []interface{}{[]interface{}{"id", "name"}}},
+		{".user.name |= ascii_upcase | .user.name", []interface{}{"ANA"}},
+		{".items[0].price += 1 | .items[0].price", []interface{}{float64(6)}},
+		{"[.items[].price] | add", []interface{}{float64(45)}},
+		{".items | map(.price * 2)", []interface{}{[]interface{}{float64(10), float64(30), float64(50)}}},
+		{".items | length", []interface{}{float64(3)}},
+		{".missing // \"default\"", []interface{}{"default"}},
+		{"if .user.id > 5 then \"big\" elif .user.id > 1 then \"mid\" else \"small\" end", []interface{}{"big"}},
+		{"\"hi \\(.user.name)!\"", []interface{}{"hi Ana!"}},
+		{".user.id as $id | .items | map(.id + ($id | tostring))", []interface{}{[]interface{}{"a17", "b27", "c37"}}},
+		{"reduce .items[] as $i (0; . + $i.price)", []interface{}{float64(45)}},
+		{".items | sort_by(-.price) | first.id", []interface{}{"c3"}},
+		{".user | to_entries | map(select(.key != \"secret\")) | from_entries", []interface{}{map[string]interface{}{"id": float64(7), "name": "Ana"}}},
+		{".items[:2] | map(.id)", []interface{}{[]interface{}{"a1", "b2"}}},
+		{"try error(\"boom\") catch .", []interface{}{"boom"}},
+		{".user.name | test(\"^A\")", []interface{}{true}},
+		{".user.name | @base64", []interface{}{"QW5h"}},
+		{"[.items[] | .tags?] | map(select(. != null))", []interface{}{[]interface{}{[]interface{}{"new"}}}},
+		{"[.[] | type]", []interface{}{[]interface{}{"array", "object"}}},
+		{".user.id, .user.name", []interface{}{float64(7), "Ana"}},
+		{"[.items[].price] | max", []interface{}{float64(25)}},
+		{"$env.region", []interface{}{"id"}},
+	}
+
+	for _, tt := range tests {
+		program, err := CompileJq(tt.program)
+		if err != nil {
+			t.Errorf("CompileJq(%q) error: %v", tt.program, err)
+			continue
+		}
+		result, err := program.Run(data, map[string]interface{}{"env": map[string]string{"region": "id"}})
+		if err != nil {
+			t.Errorf("Run(%q) error: %v", tt.program, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("Run(%q) = %#v, want %#v", tt.program, result, tt.expected)
+		}
+	}
+}
+
+func TestJq_Errors(t *testing.T) {
+	for _, program := range []string{".a |", "{a: }", "nosuchfunc", "if . then 1", "1 = 2"} {
+		if _, err := CompileJq(program); err == nil {
+			t.Errorf("CompileJq(%q) expected an error", program)
+		}
+	}
+
+	program, err := CompileJq(".a.b")
+	if err != nil {
+		t.Fatalf("CompileJq error: %v", err)
+	}
+	if _, err := program.Run(map[string]interface{}{"a": "text"}, nil); err == nil {
+		t.Error("Run expected an error indexing a string")
+	}
+}
@@ -0,0 +1,439 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// jsonPathSegment is a single step of a JSONPath expression
+type jsonPathSegment struct {
+	recursive bool
+	wildcard  bool
+	names     []string
+	indexes   []int
+	slice     *[3]*int
+	filter    *jsonPathFilter
+}
+
+// jsonPathFilter is a [?(@.path op value)] filter. Without an operator the
+// filter keeps items where the path exists.
+type jsonPathFilter struct {
+	path     []jsonPathSegment
+	operator string
+	value    interface{}
+}
+
+// JSONPath evaluates a JSONPath expression against data. Paths made only of
+// names and indexes return the single value, or nil when it is missing;
+// wildcards, recursive descent, unions, slices and filters return a list.
+//
+// Supported syntax: $, .name, ['name'], [0], [-1], [*], .*, ..name,
+// ['a','b'], [0,2], [1:3] and [?(@.price < 10)].
+func JSONPath(path string, data interface{}) (interface{}, error) {
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := evalJSONPath(segments, []interface{}{normalizeJSON(data)})
+	if isDefiniteJSONPath(segments) {
+		if len(nodes) == 0 {
+			return nil, nil
+		}
+		return nodes[0], nil
+	}
+	if nodes == nil {
+		nodes = []interface{}{}
+	}
+	return nodes, nil
+}
+
+// normalizeJSON converts typed values such as map[string]string to the
+// generic JSON representation so paths can walk them
+func normalizeJSON(data interface{}) interface{} {
+	switch data.(type) {
+	case nil, map[string]interface{}, []interface{}, string, float64, bool:
+		return data
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return data
+	}
+	var generic interface{}
+	if err := json.Unmarshal(encoded, &generic); err != nil {
+		return data
+	}
+	return generic
+}
+
+// isDefiniteJSONPath reports whether segments select at most one value
+func isDefiniteJSONPath(segments []jsonPathSegment) bool {
+	for _, segment := range segments {
+		if segment.recursive || segment.wildcard || segment.slice != nil || segment.filter != nil ||
+			len(segment.names)+len(segment.indexes) > 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// parseJSONPath splits a JSONPath expression into segments
+func parseJSONPath(path string) ([]jsonPathSegment, error) {
+	path = strings.TrimSpace(path)
+	if strings.HasPrefix(path, "$") {
+		path = path[1:]
+	} else if path != "" && path[0] != '.' && path[0] != '[' {
+		path = "." + path
+	}
+
+	var segments []jsonPathSegment
+	for i := 0; i < len(path); {
+		var segment jsonPathSegment
+		switch {
+		case strings.HasPrefix(path[i:], ".."):
+			segment.recursive = true
+			i += 2
+			if i < len(path) && path[i] == '[' {
+				parsed, next, err := parseJSONPathBracket(path, i)
+				if err != nil {
+					return nil, err
+				}
+				parsed.recursive = true
+				segments = append(segments, parsed)
+				i = next
+				continue
+			}
+		case path[i] == '.':
+			i++
+		case path[i] == '[':
+			parsed, next, err := parseJSONPathBracket(path, i)
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, parsed)
+			i = next
+			continue
+		default:
+			return nil, fmt.Errorf("jsonpath: unexpected %q at offset %d", path[i], i)
+		}
+
+		end := i
+		for end < len(path) && path[end] != '.' && path[end] != '[' {
+			end++
+		}
+		name := path[i:end]
+		if name == "" {
+			return nil, fmt.Errorf("jsonpath: missing name at offset %d", i)
+		}
+		if name == "*" {
+			segment.wildcard = true
+		} else {
+			segment.names = []string{name}
+		}
+		segments = append(segments, segment)
+		i = end
+	}
+	return segments, nil
+}
+
+// parseJSONPathBracket parses the bracket expression starting at path[start]
+func parseJSONPathBracket(path string, start int) (jsonPathSegment, int, error) {
+	var segment jsonPathSegment
+
+	// Find the closing bracket outside of quotes and parentheses
+	depth, quote, end := 0, byte(0), -1
+	for i := start + 1; i < len(path) && end < 0; i++ {
+		c := path[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ']' && depth == 0:
+			end = i
+		}
+	}
+	if end < 0 {
+		return segment, 0, fmt.Errorf("jsonpath: unclosed bracket at offset %d", start)
+	}
+	content := strings.TrimSpace(path[start+1 : end])
+
+	switch {
+	case content == "*":
+		segment.wildcard = true
+	case strings.HasPrefix(content, "?"):
+		filter, err := parseJSONPathFilter(strings.TrimSpace(content[1:]))
+		if err != nil {
+			return segment, 0, err
+		}
+		segment.filter = filter
+	case strings.Contains(content, ":") && !strings.ContainsAny(content, `'"`):
+		var bounds [3]*int
+		parts := strings.Split(content, ":")
+		if len(parts) > 3 {
+			return segment, 0, fmt.Errorf("jsonpath: invalid slice [%s]", content)
+		}
+		for i, part := range parts {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return segment, 0, fmt.Errorf("jsonpath: invalid slice [%s]", content)
+			}
+			bounds[i] = &n
+		}
+		segment.slice = &bounds
+	default:
+		for _, part := range splitJSONPathUnion(content) {
+			part = strings.TrimSpace(part)
+			if len(part) >= 2 && (part[0] == '\'' || part[0] == '"') && part[len(part)-1] == part[0] {
+				segment.names = append(segment.names, part[1:len(part)-1])
+				continue
+			}
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return segment, 0, fmt.Errorf("jsonpath: invalid subscript [%s]", content)
+			}
+			segment.indexes = append(segment.indexes, n)
+		}
+	}
+	return segment, end + 1, nil
+}
+
+// splitJSONPathUnion splits a union subscript at commas outside of quotes
+func splitJSONPathUnion(content string) []string {
+	var parts []string
+	quote, last := byte(0), 0
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ',':
+			parts = append(parts, content[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, content[last:])
+}
+
+// parseJSONPathFilter parses a (@.path op value) filter expression
+func parseJSONPathFilter(expression string) (*jsonPathFilter, error) {
+	if !strings.HasPrefix(expression, "(") || !strings.HasSuffix(expression, ")") {
+		return nil, fmt.Errorf("jsonpath: filter must be wrapped in parentheses: %s", expression)
+	}
+	expression = strings.TrimSpace(expression[1 : len(expression)-1])
+	if !strings.HasPrefix(expression, "@") {
+		return nil, fmt.Errorf("jsonpath: filter must start with @: %s", expression)
+	}
+
+	filter := &jsonPathFilter{}
+	left := expression
+	for _, operator := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if i := strings.Index(expression, operator); i > 0 {
+			filter.operator = operator
+			left = strings.TrimSpace(expression[:i])
+			value, err := parseJSONPathLiteral(strings.TrimSpace(expression[i+len(operator):]))
+			if err != nil {
+				return nil, err
+			}
+			filter.value = value
+			break
+		}
+	}
+
+	path, err := parseJSONPath(left[1:])
+	if err != nil {
+		return nil, err
+	}
+	filter.path = path
+	return filter, nil
+}
+
+// parseJSONPathLiteral parses a quoted string, number, boolean or null
+func parseJSONPathLiteral(literal string) (interface{}, error) {
+	if len(literal) >= 2 && literal[0] == '\'' && literal[len(literal)-1] == '\'' {
+		return literal[1 : len(literal)-1], nil
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(literal), &value); err != nil {
+		return nil, fmt.Errorf("jsonpath: invalid filter value %s", literal)
+	}
+	return value, nil
+}
+
+// evalJSONPath applies segments to nodes
+func evalJSONPath(segments []jsonPathSegment, nodes []interface{}) []interface{} {
+	for _, segment := range segments {
+		var next []interface{}
+		for _, node := range nodes {
+			if segment.recursive {
+				for _, descendant := range jsonPathDescendants(node, nil) {
+					next = append(next, segment.apply(descendant)...)
+				}
+				continue
+			}
+			next = append(next, segment.apply(node)...)
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// jsonPathDescendants returns node and all values nested in it
+func jsonPathDescendants(node interface{}, result []interface{}) []interface{} {
+	result = append(result, node)
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for _, key := range Keys(v) {
+			result = jsonPathDescendants(v[key], result)
+		}
+	case []interface{}:
+		for _, item := range v {
+			result = jsonPathDescendants(item, result)
+		}
+	}
+	return result
+}
+
+// apply selects the children of node matched by the segment
+func (s jsonPathSegment) apply(node interface{}) []interface{} {
+	var result []interface{}
+	switch v := node.(type) {
+	case map[string]interface{}:
+		switch {
+		case s.wildcard:
+			for _, key := range Keys(v) {
+				result = append(result, v[key])
+			}
+		case s.filter != nil:
+			for _, key := range Keys(v) {
+				if s.filter.matches(v[key]) {
+					result = append(result, v[key])
+				}
+			}
+		default:
+			for _, name := range s.names {
+				if child, ok := v[name]; ok {
+					result = append(result, child)
+				}
+			}
+		}
+	case []interface{}:
+		switch {
+		case s.wildcard:
+			result = append(result, v...)
+		case s.filter != nil:
+			for _, item := range v {
+				if s.filter.matches(item) {
+					result = append(result, item)
+				}
+			}
+		case s.slice != nil:
+			start, end, step := 0, len(v), 1
+			if s.slice[2] != nil && *s.slice[2] > 0 {
+				step = *s.slice[2]
+			}
+			if s.slice[0] != nil {
+				start = clampJSONPathIndex(*s.slice[0], len(v))
+			}
+			if s.slice[1] != nil {
+				end = clampJSONPathIndex(*s.slice[1], len(v))
+			}
+			for i := start; i < end; i += step {
+				result = append(result, v[i])
+			}
+		default:
+			for _, index := range s.indexes {
+				if index < 0 {
+					index += len(v)
+				}
+				if index >= 0 && index < len(v) {
+					result = append(result, v[index])
+				}
+			}
+		}
+	}
+	return result
+}
+
+// clampJSONPathIndex resolves a negative slice bound and clamps it to length
+func clampJSONPathIndex(index, length int) int {
+	if index < 0 {
+		index += length
+	}
+	if index < 0 {
+		return 0
+	}
+	if index > length {
+		return length
+	}
+	return index
+}
+
+// matches reports whether item passes the filter
+func (f *jsonPathFilter) matches(item interface{}) bool {
+	values := evalJSONPath(f.path, []interface{}{item})
+	if len(values) == 0 {
+		return false
+	}
+	value := values[0]
+	if f.operator == "" {
+		return true
+	}
+
+	if a, ok := value.(float64); ok {
+		if b, ok := f.value.(float64); ok {
+			switch f.operator {
+			case "==":
+				return a == b
+			case "!=":
+				return a != b
+			case "<":
+				return a < b
+			case "<=":
+				return a <= b
+			case ">":
+				return a > b
+			case ">=":
+				return a >= b
+			}
+		}
+	}
+	if a, ok := value.(string); ok {
+		if b, ok := f.value.(string); ok {
+			switch f.operator {
+			case "<":
+				return a < b
+			case "<=":
+				return a <= b
+			case ">":
+				return a > b
+			case ">=":
+				return a >= b
+			}
+		}
+	}
+	switch f.operator {
+	case "==":
+		return reflect.DeepEqual(value, f.value)
+	case "!=":
+		return !reflect.DeepEqual(value, f.value)
+	}
+	return false
+}
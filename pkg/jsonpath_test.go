@@ -0,0 +1,58 @@
+package pkg
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJSONPath(t *testing.T) {
+	var data interface{}
+	json.Unmarshal([]byte(`{
+		"data": {
+			"items": [
+				{"id": "a1", "price": 5, "tags": ["new"]},
+				{"id": "b2", "price": 15, "owner": {"id": "u1"}},
+				{"id": "c3", "price": 25}
+			],
+			"meta key": "spaced"
+		}
+	}`), &data)
+
+	tests := []struct {
+		path     string
+		expected interface{}
+	}{
+		{"$.data.items[0].id", "a1"},
+		{"data.items[-1].id", "c3"},
+		{"$['data']['meta key']", "spaced"},
+		{"$.data.items[1].owner.id", "u1"},
+		{"$.data.missing.id", nil},
+		{"$.data.items[9].id", nil},
+		{"$.data.items[*].id", []interface{}{"a1", "b2", "c3"}},
+		{"$.data.items[0,2].id", []interface{}{"a1", "c3"}},
+		{"$.data.items[1:].price", []interface{}{float64(15), float64(25)}},
+		{"$.data.items[?(@.price > 10)].id", []interface{}{"b2", "c3"}},
+		{"$.data.items[?(@.id == 'a1')].price", []interface{}{float64(5)}},
+		{"$.data.items[?(@.owner)].id", []interface{}{"b2"}},
+		{"$..id", []interface{}{"a1", "b2", "u1", "c3"}},
+		{"$.data.nothing[*]", []interface{}{}},
+	}
+
+	for _, tt := range tests {
+		actual, err := JSONPath(tt.path, data)
+		if err != nil {
+			t.Errorf("JSONPath(%s) error = %v", tt.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("JSONPath(%s) = %#v, expected %#v", tt.path, actual, tt.expected)
+		}
+	}
+
+	for _, path := range []string{"$.data[", "$.data[abc]", "$.data.items[?(@.price > )]", "$data"} {
+		if _, err := JSONPath(path, data); err == nil {
+			t.Errorf("JSONPath(%s) expected an error", path)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DecodeJWTClaims decodes the payload of a JWT without verifying its signature
+func DecodeJWTClaims(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("jwt: token must have three parts")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("jwt: invalid payload encoding: %w", err)
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("jwt: invalid payload: %w", err)
+	}
+	return claims, nil
+}
+
+// JWTDecode returns the claims of a token without verifying it, or nil when
+// the token cannot be decoded so templates can branch with `with`. A
+// "Bearer " prefix is accepted.
+func JWTDecode(token string) map[string]interface{} {
+	token = strings.TrimSpace(token)
+	if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+		token = strings.TrimSpace(token[7:])
+	}
+	claims, err := DecodeJWTClaims(token)
+	if err != nil {
+		return nil
+	}
+	return claims
+}
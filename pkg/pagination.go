@@ -0,0 +1,49 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// cursorPrefix marks cursors that encode an offset
+const cursorPrefix = "offset:"
+
+// PageToOffset converts a 1-based page number to an offset
+func PageToOffset(page, size int) int {
+	if page < 1 {
+		page = 1
+	}
+	return (page - 1) * size
+}
+
+// OffsetToPage converts an offset to the 1-based page containing it
+func OffsetToPage(offset, size int) int {
+	if size <= 0 || offset < 0 {
+		return 1
+	}
+	return offset/size + 1
+}
+
+// EncodeCursor encodes an offset as an opaque cursor
+func EncodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(offset)))
+}
+
+// DecodeCursor decodes a cursor created by EncodeCursor. An empty cursor
+// is the first page.
+func DecodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(cursor, "="))
+	if err != nil || !strings.HasPrefix(string(decoded), cursorPrefix) {
+		return 0, errors.New("invalid cursor")
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(decoded), cursorPrefix))
+	if err != nil || offset < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return offset, nil
+}
@@ -0,0 +1,180 @@
+package pkg
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxSAMLSize bounds the inflated size of a SAML message
+const maxSAMLSize = 1 << 20
+
+// samlNode is a namespace-agnostic XML element
+type samlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Content  string     `xml:",chardata"`
+	Children []samlNode `xml:",any"`
+}
+
+// SAMLDecode decodes a SAMLResponse parameter (base64, optionally deflated
+// as in the HTTP-Redirect binding) and returns its assertion data:
+//
+//	{issuer, destination, inResponseTo, status, nameID, nameIDFormat,
+//	 sessionIndex, notBefore, notOnOrAfter, audience, attributes}
+//
+// When attribute names are given only those attributes are returned.
+// Signatures are NOT verified, so the result must not be used for
+// authorization decisions.
+func SAMLDecode(value string, attributes ...string) (map[string]interface{}, error) {
+	document, err := samlDocument(value)
+	if err != nil {
+		return nil, fmt.Errorf("samlDecode: %w", err)
+	}
+
+	var root samlNode
+	if err := xml.Unmarshal(document, &root); err != nil {
+		return nil, fmt.Errorf("samlDecode: invalid XML: %w", err)
+	}
+
+	result := map[string]interface{}{
+		"destination":  root.attr("Destination"),
+		"inResponseTo": root.attr("InResponseTo"),
+	}
+
+	assertion := &root
+	if root.XMLName.Local == "Response" {
+		if root.find("EncryptedAssertion") != nil {
+			return nil, errors.New("samlDecode: encrypted assertions are not supported")
+		}
+		if status := root.find("StatusCode"); status != nil {
+			result["status"] = strings.TrimPrefix(status.attr("Value"), "urn:oasis:names:tc:SAML:2.0:status:")
+		}
+		assertion = root.find("Assertion")
+		if assertion == nil {
+			assertion = &samlNode{}
+		}
+	} else if root.XMLName.Local != "Assertion" {
+		return nil, fmt.Errorf("samlDecode: unexpected root element %q", root.XMLName.Local)
+	}
+
+	if issuer := assertion.child("Issuer"); issuer != nil {
+		result["issuer"] = strings.TrimSpace(issuer.Content)
+	} else if issuer := root.child("Issuer"); issuer != nil {
+		result["issuer"] = strings.TrimSpace(issuer.Content)
+	}
+	if nameID := assertion.find("NameID"); nameID != nil {
+		result["nameID"] = strings.TrimSpace(nameID.Content)
+		result["nameIDFormat"] = nameID.attr("Format")
+	}
+	if authn := assertion.find("AuthnStatement"); authn != nil {
+		result["sessionIndex"] = authn.attr("SessionIndex")
+	}
+	if conditions := assertion.find("Conditions"); conditions != nil {
+		result["notBefore"] = conditions.attr("NotBefore")
+		result["notOnOrAfter"] = conditions.attr("NotOnOrAfter")
+		if audience := conditions.find("Audience"); audience != nil {
+			result["audience"] = strings.TrimSpace(audience.Content)
+		}
+	}
+
+	selected := make(map[string]bool, len(attributes))
+	for _, name := range attributes {
+		selected[name] = true
+	}
+	values := make(map[string]interface{})
+	if statement := assertion.find("AttributeStatement"); statement != nil {
+		for i := range statement.Children {
+			attribute := &statement.Children[i]
+			if attribute.XMLName.Local != "Attribute" {
+				continue
+			}
+			name := attribute.attr("Name")
+			friendly := attribute.attr("FriendlyName")
+			if len(selected) > 0 && !selected[name] && !selected[friendly] {
+				continue
+			}
+
+			var list []interface{}
+			for _, value := range attribute.Children {
+				if value.XMLName.Local == "AttributeValue" {
+					list = append(list, strings.TrimSpace(value.Content))
+				}
+			}
+			var attributeValue interface{} = list
+			if len(list) == 1 {
+				attributeValue = list[0]
+			}
+
+			if len(selected) > 0 && selected[friendly] && !selected[name] {
+				name = friendly
+			}
+			values[name] = attributeValue
+		}
+	}
+	result["attributes"] = values
+
+	return result, nil
+}
+
+// samlDocument base64-decodes value and inflates it when it is not plain XML
+func samlDocument(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		if decoded, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(value, "=")); err != nil {
+			return nil, errors.New("invalid base64")
+		}
+	}
+
+	if trimmed := bytes.TrimSpace(decoded); len(trimmed) > 0 && trimmed[0] == '<' {
+		return trimmed, nil
+	}
+
+	inflated, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(decoded)), maxSAMLSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inflate: %w", err)
+	}
+	if len(inflated) > maxSAMLSize {
+		return nil, errors.New("message too large")
+	}
+	return inflated, nil
+}
+
+// attr returns the value of the attribute with the given local name
+func (n *samlNode) attr(name string) string {
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// child returns the first direct child with the given local name
+func (n *samlNode) child(name string) *samlNode {
+	for i := range n.Children {
+		if n.Children[i].XMLName.Local == name {
+			return &n.Children[i]
+		}
+	}
+	return nil
+}
+
+// find returns the first descendant with the given local name
+func (n *samlNode) find(name string) *samlNode {
+	for i := range n.Children {
+		if n.Children[i].XMLName.Local == name {
+			return &n.Children[i]
+		}
+		if found := n.Children[i].find(name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
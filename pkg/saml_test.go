@@ -0,0 +1,74 @@
+package pkg
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+const testSAMLResponse = `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_r1" InResponseTo="_req1" Destination="https://sp.example.com/acs">
+  <saml:Issuer>https://idp.example.com</saml:Issuer>
+  <samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>
+  <saml:Assertion ID="_a1">
+    <saml:Issuer>https://idp.example.com</saml:Issuer>
+    <saml:Subject><saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress">jane@example.com</saml:NameID></saml:Subject>
+    <saml:Conditions NotBefore="2024-01-01T00:00:00Z" NotOnOrAfter="2024-01-01T00:05:00Z">
+      <saml:AudienceRestriction><saml:Audience>https://sp.example.com</saml:Audience></saml:AudienceRestriction>
+    </saml:Conditions>
+    <saml:AuthnStatement SessionIndex="_s1"/>
+    <saml:AttributeStatement>
+      <saml:Attribute Name="urn:oid:0.9.2342.19200300.100.1.3" FriendlyName="mail"><saml:AttributeValue>jane@example.com</saml:AttributeValue></saml:Attribute>
+      <saml:Attribute Name="groups"><saml:AttributeValue>admins</saml:AttributeValue><saml:AttributeValue>staff</saml:AttributeValue></saml:Attribute>
+      <saml:Attribute Name="department"><saml:AttributeValue>Legal</saml:AttributeValue></saml:Attribute>
+    </saml:AttributeStatement>
+  </saml:Assertion>
+</samlp:Response>`
+
+func TestSAMLDecode(t *testing.T) {
+	result, err := SAMLDecode(base64.StdEncoding.EncodeToString([]byte(testSAMLResponse)), "mail", "groups")
+	if err != nil {
+		t.Fatalf("SAMLDecode() error = %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"destination":  "https://sp.example.com/acs",
+		"inResponseTo": "_req1",
+		"status":       "Success",
+		"issuer":       "https://idp.example.com",
+		"nameID":       "jane@example.com",
+		"nameIDFormat": "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress",
+		"sessionIndex": "_s1",
+		"notBefore":    "2024-01-01T00:00:00Z",
+		"notOnOrAfter": "2024-01-01T00:05:00Z",
+		"audience":     "https://sp.example.com",
+		"attributes": map[string]interface{}{
+			"mail":   "jane@example.com",
+			"groups": []interface{}{"admins", "staff"},
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Unexpected result:\n%#v\nexpected:\n%#v", result, expected)
+	}
+}
+
+func TestSAMLDecode_Deflated(t *testing.T) {
+	var compressed bytes.Buffer
+	writer, _ := flate.NewWriter(&compressed, flate.DefaultCompression)
+	writer.Write([]byte(testSAMLResponse))
+	writer.Close()
+
+	result, err := SAMLDecode(base64.StdEncoding.EncodeToString(compressed.Bytes()))
+	if err != nil {
+		t.Fatalf("SAMLDecode() error = %v", err)
+	}
+	attributes := result["attributes"].(map[string]interface{})
+	if len(attributes) != 3 || attributes["department"] != "Legal" {
+		t.Errorf("Unexpected attributes %v", attributes)
+	}
+
+	if _, err := SAMLDecode("not base64!"); err == nil {
+		t.Errorf("Expected error for invalid input")
+	}
+}
@@ -0,0 +1,389 @@
+package pkg
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// maxScriptSteps bounds the statements a single script run may execute
+const maxScriptSteps = 100000
+
+// Script is a compiled transformation script. Scripts are a sequence of
+// statements over expression values:
+//
+//	let total = 0
+//	for item in response.body.items {
+//	  set total = total + item.price
+//	  delete item.internal_id
+//	}
+//	set response.body.total = total
+//	if total > 1000 { set response.headers['x-large-order'] = 'true' }
+type Script struct {
+	source string
+	body   []scriptStmt
+}
+
+// scriptStmt is a statement of a script
+type scriptStmt interface {
+	exec(run *scriptRun) error
+}
+
+// scriptRun holds the state of a single script execution
+type scriptRun struct {
+	vars  map[string]interface{}
+	steps int
+}
+
+// CompileScript parses a script
+func CompileScript(source string) (*Script, error) {
+	tokens, err := tokenizeExpr(source)
+	if err != nil {
+		return nil, fmt.Errorf("script: %w", err)
+	}
+
+	p := &exprParser{tokens: tokens}
+	body, err := parseScriptBlock(p)
+	if err == nil && p.peek().kind != tokEOF {
+		err = fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("script: %w", err)
+	}
+
+	return &Script{source: source, body: body}, nil
+}
+
+// Run executes the script. vars holds the top-level variables (e.g. request
+// and response); assignments modify the values in place.
+func (s *Script) Run(vars map[string]interface{}) error {
+	run := &scriptRun{vars: vars}
+	if err := execScriptBlock(run, s.body); err != nil {
+		return fmt.Errorf("script: %w", err)
+	}
+	return nil
+}
+
+func execScriptBlock(run *scriptRun, body []scriptStmt) error {
+	for _, stmt := range body {
+		run.steps++
+		if run.steps > maxScriptSteps {
+			return fmt.Errorf("exceeded %d steps", maxScriptSteps)
+		}
+		if err := stmt.exec(run); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Parser
+
+// parseScriptBlock parses statements until a closing brace or the end
+func parseScriptBlock(p *exprParser) ([]scriptStmt, error) {
+	var body []scriptStmt
+	for {
+		p.accept(";")
+		token := p.peek()
+		if token.kind == tokEOF || token.text == "}" && token.kind == tokPunct {
+			return body, nil
+		}
+
+		stmt, err := parseScriptStmt(p)
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, stmt)
+	}
+}
+
+func parseScriptStmt(p *exprParser) (scriptStmt, error) {
+	keyword := p.next()
+	if keyword.kind != tokIdent {
+		return nil, fmt.Errorf("expected statement, got %q", keyword.text)
+	}
+
+	switch keyword.text {
+	case "let", "set":
+		target, err := parseScriptTarget(p)
+		if err != nil {
+			return nil, err
+		}
+		if keyword.text == "let" {
+			if _, ok := target.(*identNode); !ok {
+				return nil, fmt.Errorf("let requires a variable name")
+			}
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		value, err := p.parseTernary()
+		if err != nil {
+			return nil, err
+		}
+		return &setStmt{target: target, value: value}, nil
+	case "delete":
+		target, err := parseScriptTarget(p)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := target.(*indexNode); !ok {
+			return nil, fmt.Errorf("delete requires a field or index")
+		}
+		return &deleteStmt{target: target.(*indexNode)}, nil
+	case "if":
+		return parseScriptIf(p)
+	case "for":
+		return parseScriptFor(p)
+	}
+	return nil, fmt.Errorf("unknown statement %q", keyword.text)
+}
+
+// parseScriptTarget parses an assignable path such as response.body.items[0]
+func parseScriptTarget(p *exprParser) (exprNode, error) {
+	target, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	for node := target; ; {
+		switch n := node.(type) {
+		case *identNode:
+			return target, nil
+		case *indexNode:
+			node = n.target
+		default:
+			return nil, fmt.Errorf("cannot assign to expression")
+		}
+	}
+}
+
+func parseScriptIf(p *exprParser) (scriptStmt, error) {
+	cond, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	then, err := parseScriptBraces(p)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := &ifStmt{cond: cond, then: then}
+	if _, ok := p.accept("else"); ok {
+		if _, ok := p.accept("if"); ok {
+			elseIf, err := parseScriptIf(p)
+			if err != nil {
+				return nil, err
+			}
+			stmt.otherwise = []scriptStmt{elseIf}
+		} else if stmt.otherwise, err = parseScriptBraces(p); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+func parseScriptFor(p *exprParser) (scriptStmt, error) {
+	stmt := &forStmt{}
+
+	first := p.next()
+	if first.kind != tokIdent {
+		return nil, fmt.Errorf("expected loop variable, got %q", first.text)
+	}
+	stmt.valueName = first.text
+	if _, ok := p.accept(","); ok {
+		second := p.next()
+		if second.kind != tokIdent {
+			return nil, fmt.Errorf("expected loop variable, got %q", second.text)
+		}
+		stmt.keyName, stmt.valueName = first.text, second.text
+	}
+
+	if err := p.expect("in"); err != nil {
+		return nil, err
+	}
+	iterable, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	stmt.iterable = iterable
+
+	if stmt.body, err = parseScriptBraces(p); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// parseScriptBraces parses a { ... } block
+func parseScriptBraces(p *exprParser) ([]scriptStmt, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	body, err := parseScriptBlock(p)
+	if err != nil {
+		return nil, err
+	}
+	return body, p.expect("}")
+}
+
+// Statements
+
+type setStmt struct {
+	target exprNode
+	value  exprNode
+}
+
+func (s *setStmt) exec(run *scriptRun) error {
+	value, err := s.value.eval(run.vars)
+	if err != nil {
+		return err
+	}
+	return scriptAssign(run, s.target, value)
+}
+
+// scriptAssign stores value at target, creating missing intermediate maps
+func scriptAssign(run *scriptRun, target exprNode, value interface{}) error {
+	switch n := target.(type) {
+	case *identNode:
+		run.vars[n.name] = value
+		return nil
+	case *indexNode:
+		container, err := n.target.eval(run.vars)
+		if err != nil {
+			return err
+		}
+		if container == nil {
+			container = map[string]interface{}{}
+			if err := scriptAssign(run, n.target, container); err != nil {
+				return err
+			}
+		}
+		index, err := n.index.eval(run.vars)
+		if err != nil {
+			return err
+		}
+
+		switch c := container.(type) {
+		case map[string]interface{}:
+			c[exprString(index)] = value
+			return nil
+		case []interface{}:
+			number, ok := exprNumber(index)
+			i := int(number)
+			if i < 0 {
+				i += len(c)
+			}
+			if !ok || i < 0 || i >= len(c) {
+				return fmt.Errorf("index %v out of range", index)
+			}
+			c[i] = value
+			return nil
+		}
+		return fmt.Errorf("cannot set %v on %T", index, container)
+	}
+	return fmt.Errorf("cannot assign to expression")
+}
+
+type deleteStmt struct {
+	target *indexNode
+}
+
+func (s *deleteStmt) exec(run *scriptRun) error {
+	container, err := s.target.target.eval(run.vars)
+	if err != nil {
+		return err
+	}
+	index, err := s.target.index.eval(run.vars)
+	if err != nil {
+		return err
+	}
+
+	switch c := container.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		delete(c, exprString(index))
+		return nil
+	case []interface{}:
+		number, ok := exprNumber(index)
+		i := int(number)
+		if i < 0 {
+			i += len(c)
+		}
+		if !ok || i < 0 || i >= len(c) {
+			return nil
+		}
+		return scriptAssign(run, s.target.target, append(c[:i:i], c[i+1:]...))
+	}
+	return fmt.Errorf("cannot delete %v from %T", index, container)
+}
+
+type ifStmt struct {
+	cond      exprNode
+	then      []scriptStmt
+	otherwise []scriptStmt
+}
+
+func (s *ifStmt) exec(run *scriptRun) error {
+	cond, err := s.cond.eval(run.vars)
+	if err != nil {
+		return err
+	}
+	if exprTruthy(cond) {
+		return execScriptBlock(run, s.then)
+	}
+	return execScriptBlock(run, s.otherwise)
+}
+
+type forStmt struct {
+	keyName   string
+	valueName string
+	iterable  exprNode
+	body      []scriptStmt
+}
+
+func (s *forStmt) exec(run *scriptRun) error {
+	iterable, err := s.iterable.eval(run.vars)
+	if err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(iterable)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := s.iteration(run, float64(i), v.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		keys := make([]string, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			keys = append(keys, fmt.Sprint(key.Interface()))
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := s.iteration(run, key, exprLookup(iterable, key)); err != nil {
+				return err
+			}
+		}
+	case reflect.Invalid:
+		// Looping over a missing value does nothing
+	default:
+		return fmt.Errorf("cannot loop over %T", iterable)
+	}
+	return nil
+}
+
+// iteration binds the loop variables and runs the body once. A single
+// variable receives list items or map keys.
+func (s *forStmt) iteration(run *scriptRun, key, value interface{}) error {
+	if s.keyName != "" {
+		run.vars[s.keyName] = key
+		run.vars[s.valueName] = value
+	} else if _, isMapKey := key.(string); isMapKey {
+		run.vars[s.valueName] = key
+	} else {
+		run.vars[s.valueName] = value
+	}
+	return execScriptBlock(run, s.body)
+}
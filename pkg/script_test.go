@@ -0,0 +1,72 @@
+package pkg
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestScript_Run(t *testing.T) {
+	script, err := CompileScript(`
+		# Sum prices, drop internal ids and group items by category
+		let total = 0
+		let groups = {}
+		for item in response.body.items {
+			set total = total + item.price
+			delete item.internal_id
+			set groups[item.category] = append(groups[item.category], item.name)
+		}
+		set response.body.summary.total = total
+		set response.body.groups = groups
+		delete response.body.items[0]
+		if total > 100 {
+			set response.headers['x-large-order'] = 'true'
+		} else if total > 10 {
+			set response.headers['x-large-order'] = 'medium'
+		} else {
+			delete response.headers['x-large-order']
+		}
+		for name, value in response.headers { set response.headers[name] = upper(value) }
+	`)
+	if err != nil {
+		t.Fatalf("CompileScript() error = %v", err)
+	}
+
+	var body interface{}
+	json.Unmarshal([]byte(`{"items": [
+		{"name": "pen", "price": 5, "category": "office", "internal_id": 1},
+		{"name": "desk", "price": 120, "category": "furniture", "internal_id": 2},
+		{"name": "clip", "price": 1, "category": "office", "internal_id": 3}
+	]}`), &body)
+	vars := map[string]interface{}{
+		"response": map[string]interface{}{
+			"headers": map[string]interface{}{"x-source": "upstream"},
+			"body":    body,
+		},
+	}
+
+	if err := script.Run(vars); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	result, _ := json.Marshal(vars["response"])
+	expected := `{"body":{"groups":{"furniture":["desk"],"office":["pen","clip"]},` +
+		`"items":[{"category":"furniture","name":"desk","price":120},{"category":"office","name":"clip","price":1}],` +
+		`"summary":{"total":126}},"headers":{"x-large-order":"TRUE","x-source":"UPSTREAM"}}`
+	if string(result) != expected {
+		t.Errorf("Unexpected result:\n%s\nexpected:\n%s", result, expected)
+	}
+}
+
+func TestCompileScript_Errors(t *testing.T) {
+	for _, source := range []string{
+		`set upper(x) = 1`,
+		`let a.b = 1`,
+		`print x`,
+		`if x { set y = 1`,
+		`for in items {}`,
+	} {
+		if _, err := CompileScript(source); err == nil {
+			t.Errorf("CompileScript(%q) expected error", source)
+		}
+	}
+}
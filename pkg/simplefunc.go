@@ -3,14 +3,15 @@ package pkg
 import (
 	"encoding/json"
 	"fmt"
-	"math/rand"
 	"text/template"
 	"time"
 )
 
-// simpleFuncMap provides basic template functions without heavy dependencies
+// simpleFuncMap provides basic template functions without heavy dependencies.
+// The Sprig functions are included; the functions defined here take
+// precedence over Sprig functions of the same name.
 func SimpleFuncMap() template.FuncMap {
-	return template.FuncMap{
+	funcs := template.FuncMap{
 		"toJSON": func(v interface{}) (string, error) {
 			b, err := json.Marshal(v)
 			return string(b), err
@@ -36,18 +37,11 @@ func SimpleFuncMap() template.FuncMap {
 		"unixEpoch": func() int64 {
 			return time.Now().Unix()
 		},
-		"randAlphaNum": func(length int) string {
-			const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-			b := make([]byte, length)
-			r := rand.New(rand.NewSource(time.Now().UnixNano()))
-			for i := range b {
-				b[i] = charset[r.Intn(len(charset))]
-			}
-			return string(b)
-		},
-		"upper": func(s string) string {
-			return s // Simple version, for now just return as-is
+		"randAlphaNum": func(length int) (string, error) {
+			return RandString(length, alphanumeric)
 		},
+		"uuidv4": UUIDv4,
+		"ulid":   ULID,
 		"date": func(format string, t time.Time) string {
 			// Go time format: convert common formats
 			switch format {
@@ -62,5 +56,28 @@ func SimpleFuncMap() template.FuncMap {
 		"debug": func(v interface{}) string {
 			return fmt.Sprintf("%#v", v)
 		},
+		"pageToOffset":     PageToOffset,
+		"offsetToPage":     OffsetToPage,
+		"encodeCursor":     EncodeCursor,
+		"decodeCursor":     DecodeCursor,
+		"samlDecode":       SAMLDecode,
+		"b64urlenc":        Base64URLEncode,
+		"b64urldec":        Base64URLDecode,
+		"jwtDecode":        JWTDecode,
+		"jsonpath":         JSONPath,
+		"jmespath":         SearchJMESPath,
+		"urlquery":         URLQueryEscape,
+		"urlqueryUnescape": URLQueryUnescape,
+		"urlPathEscape":    URLPathEscape,
+		"urlPathUnescape":  URLPathUnescape,
+		"expr": func(expression string, data interface{}) (interface{}, error) {
+			return EvalExpr(expression, data)
+		},
+	}
+	for name, fn := range SprigFuncMap() {
+		if _, exists := funcs[name]; !exists {
+			funcs[name] = fn
+		}
 	}
+	return funcs
 }
@@ -0,0 +1,131 @@
+package pkg
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"text/template"
+)
+
+func TestSimpleFuncMap_Strings(t *testing.T) {
+	data := map[string]interface{}{"name": "  Budi Santoso  ", "path": "/api/v1/users"}
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{`[[ .name | trim | upper ]]`, "BUDI SANTOSO"},
+		{`[[ .name | trim | lower ]]`, "budi santoso"},
+		{`[[ "budi santoso" | title ]]`, "Budi Santoso"},
+		{`[[ .path | trimPrefix "/api" ]]`, "/v1/users"},
+		{`[[ .path | trimSuffix "/users" ]]`, "/api/v1"},
+		{`[[ .path | replace "/" "." ]]`, ".api.v1.users"},
+		{`[[ (split "/" .path)._2 ]]`, "v1"},
+		{`[[ split "/" .path | join "." ]]`, ".api.v1.users"},
+		{`[[ splitList "," "a,b" | join "+" ]]`, "a+b"},
+		{`[[ .path | contains "v1" ]] [[ .path | hasPrefix "/api" ]]`, "true true"},
+	}
+
+	for _, tt := range tests {
+		tmpl, err := template.New("test").Funcs(SimpleFuncMap()).Delims("[[", "]]").Parse(tt.template)
+		if err != nil {
+			t.Fatalf("Parse(%s) error = %v", tt.template, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			t.Errorf("Execute(%s) error = %v", tt.template, err)
+			continue
+		}
+		if buf.String() != tt.expected {
+			t.Errorf("%s = %q, expected %q", tt.template, buf.String(), tt.expected)
+		}
+	}
+}
+
+func TestSimpleFuncMap_Base64(t *testing.T) {
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{`Basic [[ print "user" ":" "p@ss" | b64enc ]]`, "Basic dXNlcjpwQHNz"},
+		{`[[ "dXNlcjpwQHNz" | b64dec ]] [[ "dXNlcjpwQHM" | b64dec ]]`, "user:p@ss user:p@s"},
+		{`[[ "??>" | b64urlenc ]] [[ "Pz8-" | b64urldec ]]`, "Pz8- ??>"},
+		{`[[ "eyJzdWIiOiIxIn0" | b64urldec ]] [[ "eyJzdWIiOiIxIn0=" | b64urldec ]]`, `{"sub":"1"} {"sub":"1"}`},
+	}
+
+	for _, tt := range tests {
+		tmpl, err := template.New("test").Funcs(SimpleFuncMap()).Delims("[[", "]]").Parse(tt.template)
+		if err != nil {
+			t.Fatalf("Parse(%s) error = %v", tt.template, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, nil); err != nil {
+			t.Errorf("Execute(%s) error = %v", tt.template, err)
+			continue
+		}
+		if buf.String() != tt.expected {
+			t.Errorf("%s = %q, expected %q", tt.template, buf.String(), tt.expected)
+		}
+	}
+
+	tmpl := template.Must(template.New("test").Funcs(SimpleFuncMap()).Delims("[[", "]]").Parse(`[[ b64dec "not base64!" ]]`))
+	if err := tmpl.Execute(&bytes.Buffer{}, nil); err == nil {
+		t.Errorf("Expected invalid base64 to fail the template")
+	}
+}
+
+func TestSimpleFuncMap_Random(t *testing.T) {
+	funcs := SimpleFuncMap()
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	ulidPattern := regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id, err := funcs["uuidv4"].(func() (string, error))()
+		if err != nil || !uuidPattern.MatchString(id) {
+			t.Fatalf("uuidv4() = %q, %v", id, err)
+		}
+		ulid, err := funcs["ulid"].(func() (string, error))()
+		if err != nil || !ulidPattern.MatchString(ulid) {
+			t.Fatalf("ulid() = %q, %v", ulid, err)
+		}
+		token, err := funcs["randAlphaNum"].(func(int) (string, error))(16)
+		if err != nil || len(token) != 16 {
+			t.Fatalf("randAlphaNum(16) = %q, %v", token, err)
+		}
+		if seen[id] || seen[ulid] || seen[token] {
+			t.Fatalf("Duplicate value after %d calls", i)
+		}
+		seen[id], seen[ulid], seen[token] = true, true, true
+	}
+}
+
+func TestSimpleFuncMap_URLEncoding(t *testing.T) {
+	data := map[string]interface{}{"q": "a b&c=d/é", "id": float64(1000000)}
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{`[[ urlquery .q ]]`, "a+b%26c%3Dd%2F%C3%A9"},
+		{`[[ urlquery .id ]]`, "1000000"},
+		{`[[ "a+b%26c" | urlqueryUnescape ]]`, "a b&c"},
+		{`/users/[[ urlPathEscape .q ]]`, "/users/a%20b&c=d%2F%C3%A9"},
+		{`[[ "a%20b%2Fc" | urlPathUnescape ]]`, "a b/c"},
+	}
+
+	for _, tt := range tests {
+		tmpl, err := template.New("test").Funcs(SimpleFuncMap()).Delims("[[", "]]").Parse(tt.template)
+		if err != nil {
+			t.Fatalf("Parse(%s) error = %v", tt.template, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			t.Errorf("Execute(%s) error = %v", tt.template, err)
+			continue
+		}
+		if buf.String() != tt.expected {
+			t.Errorf("%s = %q, expected %q", tt.template, buf.String(), tt.expected)
+		}
+	}
+}
@@ -0,0 +1,1047 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// SprigFuncMap provides the commonly used Sprig template functions with the
+// same names and argument order, implemented on the standard library so they
+// run under yaegi
+func SprigFuncMap() template.FuncMap {
+	return template.FuncMap{
+		// Strings
+		"trim":       strings.TrimSpace,
+		"trimAll":    func(cutset, s string) string { return strings.Trim(s, cutset) },
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"title":      Title,
+		"untitle":    Untitle,
+		"repeat":     func(count int, s string) string { return strings.Repeat(s, count) },
+		"substr":     Substr,
+		"trunc":      Trunc,
+		"abbrev":     Abbrev,
+		"nospace":    func(s string) string { return strings.Join(strings.Fields(s), "") },
+		"initials":   Initials,
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"quote":      Quote,
+		"squote":     SQuote,
+		"cat":        Cat,
+		"indent":     Indent,
+		"nindent":    func(spaces int, s string) string { return "\n" + Indent(spaces, s) },
+		"plural":     Plural,
+		"snakecase":  func(s string) string { return joinWords(s, "_") },
+		"kebabcase":  func(s string) string { return joinWords(s, "-") },
+		"camelcase":  CamelCase,
+		"swapcase":   SwapCase,
+		"split":      Split,
+		"splitList":  func(sep, s string) []string { return strings.Split(s, sep) },
+		"splitn":     Splitn,
+		"join":       Join,
+		"toString":   ToString,
+		"toStrings":  ToStrings,
+		"atoi":       func(s string) int { i, _ := strconv.Atoi(strings.TrimSpace(s)); return i },
+		"int":        func(v interface{}) int { return int(ToInt64(v)) },
+		"int64":      ToInt64,
+		"float64":    ToFloat64,
+
+		// Regular expressions
+		"regexMatch":             func(pattern, s string) (bool, error) { return regexp.MatchString(pattern, s) },
+		"regexFind":              RegexFind,
+		"regexFindAll":           RegexFindAll,
+		"regexReplaceAll":        RegexReplaceAll,
+		"regexReplaceAllLiteral": RegexReplaceAllLiteral,
+		"regexSplit":             RegexSplit,
+
+		// Defaults and flow control
+		"empty":    Empty,
+		"coalesce": Coalesce,
+		"ternary": func(whenTrue, whenFalse interface{}, condition bool) interface{} {
+			if condition {
+				return whenTrue
+			}
+			return whenFalse
+		},
+		"fail": func(message string) (string, error) { return "", errors.New(message) },
+
+		// JSON
+		"toJson":       ToJSONString,
+		"toRawJson":    ToRawJSONString,
+		"toPrettyJson": ToPrettyJSONString,
+		"fromJson":     FromJSON,
+
+		// Math
+		"add":  func(values ...interface{}) int64 { return foldInt(values, func(a, b int64) int64 { return a + b }) },
+		"add1": func(v interface{}) int64 { return ToInt64(v) + 1 },
+		"sub":  func(a, b interface{}) int64 { return ToInt64(a) - ToInt64(b) },
+		"mul":  func(values ...interface{}) int64 { return foldInt(values, func(a, b int64) int64 { return a * b }) },
+		"div":  Div,
+		"mod":  Mod,
+		"max":  func(values ...interface{}) int64 { return foldInt(values, maxInt64) },
+		"min":  func(values ...interface{}) int64 { return foldInt(values, minInt64) },
+		"addf": func(values ...interface{}) float64 {
+			return foldFloat(values, func(a, b float64) float64 { return a + b })
+		},
+		"subf": func(a, b interface{}) float64 { return ToFloat64(a) - ToFloat64(b) },
+		"mulf": func(values ...interface{}) float64 {
+			return foldFloat(values, func(a, b float64) float64 { return a * b })
+		},
+		"divf":  func(a, b interface{}) float64 { return ToFloat64(a) / ToFloat64(b) },
+		"maxf":  func(values ...interface{}) float64 { return foldFloat(values, math.Max) },
+		"minf":  func(values ...interface{}) float64 { return foldFloat(values, math.Min) },
+		"floor": func(v interface{}) float64 { return math.Floor(ToFloat64(v)) },
+		"ceil":  func(v interface{}) float64 { return math.Ceil(ToFloat64(v)) },
+		"round": Round,
+
+		// Lists
+		"list":      func(items ...interface{}) []interface{} { return items },
+		"first":     First,
+		"last":      Last,
+		"rest":      Rest,
+		"initial":   Initial,
+		"append":    Append,
+		"push":      Append,
+		"prepend":   Prepend,
+		"concat":    Concat,
+		"reverse":   Reverse,
+		"uniq":      Uniq,
+		"without":   Without,
+		"has":       Has,
+		"compact":   Compact,
+		"sortAlpha": SortAlpha,
+		"until":     func(count int) []int { return UntilStep(0, count, 1) },
+		"untilStep": UntilStep,
+
+		// Dictionaries
+		"dict": Dict,
+		"get":  Get,
+		"set": func(d map[string]interface{}, key string, value interface{}) map[string]interface{} {
+			d[key] = value
+			return d
+		},
+		"unset":  func(d map[string]interface{}, key string) map[string]interface{} { delete(d, key); return d },
+		"hasKey": func(d map[string]interface{}, key string) bool { _, ok := d[key]; return ok },
+		"keys":   Keys,
+		"values": Values,
+		"pluck":  Pluck,
+		"pick":   Pick,
+		"omit":   Omit,
+		"merge":  Merge,
+		"dig":    Dig,
+
+		// Encoding
+		"b64enc": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"b64dec": Base64Decode,
+		"b32enc": func(s string) string { return base32.StdEncoding.EncodeToString([]byte(s)) },
+		"b32dec": func(s string) (string, error) {
+			decoded, err := base32.StdEncoding.DecodeString(s)
+			return string(decoded), err
+		},
+
+		// Hashes and random values
+		"sha1sum":     func(s string) string { sum := sha1.Sum([]byte(s)); return hex.EncodeToString(sum[:]) },
+		"sha256sum":   func(s string) string { sum := sha256.Sum256([]byte(s)); return hex.EncodeToString(sum[:]) },
+		"sha512sum":   func(s string) string { sum := sha512.Sum512([]byte(s)); return hex.EncodeToString(sum[:]) },
+		"md5sum":      func(s string) string { sum := md5.Sum([]byte(s)); return hex.EncodeToString(sum[:]) },
+		"adler32sum":  func(s string) string { return strconv.FormatUint(uint64(adler32.Checksum([]byte(s))), 10) },
+		"randAlpha":   func(length int) (string, error) { return RandString(length, letters) },
+		"randNumeric": func(length int) (string, error) { return RandString(length, digits) },
+		"randAscii":   func(length int) (string, error) { return RandString(length, printableASCII) },
+		"uuidv4":      UUIDv4,
+	}
+}
+
+// Character sets for the random string functions
+const (
+	letters        = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	digits         = "0123456789"
+	alphanumeric   = letters + digits
+	printableASCII = " !\"#$%&'()*+,-./0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\]^_`abcdefghijklmnopqrstuvwxyz{|}~"
+)
+
+// Title upper-cases the first letter of every word
+func Title(s string) string {
+	runes := []rune(s)
+	start := true
+	for i, r := range runes {
+		if unicode.IsSpace(r) {
+			start = true
+			continue
+		}
+		if start {
+			runes[i] = unicode.ToUpper(r)
+			start = false
+		}
+	}
+	return string(runes)
+}
+
+// Untitle lower-cases the first letter of every word
+func Untitle(s string) string {
+	runes := []rune(s)
+	start := true
+	for i, r := range runes {
+		if unicode.IsSpace(r) {
+			start = true
+			continue
+		}
+		if start {
+			runes[i] = unicode.ToLower(r)
+			start = false
+		}
+	}
+	return string(runes)
+}
+
+// Substr returns the runes of s between start and end. A negative end means
+// the end of the string.
+func Substr(start, end int, s string) string {
+	runes := []rune(s)
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 || end > len(runes) {
+		end = len(runes)
+	}
+	if start > end {
+		return ""
+	}
+	return string(runes[start:end])
+}
+
+// Trunc keeps the first length runes of s, or the last -length runes when
+// length is negative
+func Trunc(length int, s string) string {
+	runes := []rune(s)
+	if length < 0 {
+		if -length >= len(runes) {
+			return s
+		}
+		return string(runes[len(runes)+length:])
+	}
+	if length >= len(runes) {
+		return s
+	}
+	return string(runes[:length])
+}
+
+// Abbrev truncates s to width runes, ending it with an ellipsis
+func Abbrev(width int, s string) string {
+	runes := []rune(s)
+	if width < 4 || len(runes) <= width {
+		return s
+	}
+	return string(runes[:width-3]) + "..."
+}
+
+// Initials returns the first letter of every word
+func Initials(s string) string {
+	var b strings.Builder
+	for _, word := range strings.Fields(s) {
+		r := []rune(word)
+		b.WriteRune(r[0])
+	}
+	return b.String()
+}
+
+// Plural returns one when count is 1 and many otherwise
+func Plural(one, many string, count int) string {
+	if count == 1 {
+		return one
+	}
+	return many
+}
+
+// Quote wraps every value in double quotes and joins them with spaces
+func Quote(values ...interface{}) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != nil {
+			quoted = append(quoted, strconv.Quote(ToString(v)))
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// SQuote wraps every value in single quotes and joins them with spaces
+func SQuote(values ...interface{}) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != nil {
+			quoted = append(quoted, "'"+ToString(v)+"'")
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Cat joins the non-nil values with spaces
+func Cat(values ...interface{}) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != nil {
+			parts = append(parts, ToString(v))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Indent prefixes every line of s with spaces
+func Indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// words splits s into lower-case words at spaces, punctuation and case
+// changes, so "userID", "user_id" and "User Id" all give user, id
+func words(s string) []string {
+	var result []string
+	var current []rune
+	runes := []rune(s)
+	flush := func() {
+		if len(current) > 0 {
+			result = append(result, strings.ToLower(string(current)))
+			current = current[:0]
+		}
+	}
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+			continue
+		case unicode.IsUpper(r) && len(current) > 0:
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				flush()
+			}
+		}
+		current = append(current, r)
+	}
+	flush()
+	return result
+}
+
+// joinWords joins the words of s with sep
+func joinWords(s, sep string) string {
+	return strings.Join(words(s), sep)
+}
+
+// CamelCase converts s to CamelCase
+func CamelCase(s string) string {
+	var b strings.Builder
+	for _, word := range words(s) {
+		r := []rune(word)
+		b.WriteRune(unicode.ToUpper(r[0]))
+		b.WriteString(string(r[1:]))
+	}
+	return b.String()
+}
+
+// SwapCase inverts the case of every letter
+func SwapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+// Split splits s by sep into a dict keyed _0, _1, ... like Sprig's split
+func Split(sep, s string) map[string]string {
+	parts := strings.Split(s, sep)
+	result := make(map[string]string, len(parts))
+	for i, part := range parts {
+		result["_"+strconv.Itoa(i)] = part
+	}
+	return result
+}
+
+// Splitn splits s by sep into at most n parts keyed _0, _1, ...
+func Splitn(sep string, n int, s string) map[string]string {
+	parts := strings.SplitN(s, sep, n)
+	result := make(map[string]string, len(parts))
+	for i, part := range parts {
+		result["_"+strconv.Itoa(i)] = part
+	}
+	return result
+}
+
+// Join joins the items of a list with sep
+func Join(sep string, list interface{}) string {
+	return strings.Join(ToStrings(list), sep)
+}
+
+// ToString formats v as a string
+func ToString(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	case error:
+		return s.Error()
+	case fmt.Stringer:
+		return s.String()
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// ToStrings converts every item of a list to a string
+func ToStrings(list interface{}) []string {
+	items := toList(list)
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if item != nil {
+			result = append(result, ToString(item))
+		}
+	}
+	return result
+}
+
+// ToInt64 converts numbers, booleans and numeric strings to an int64
+func ToInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if n {
+			return 1
+		}
+		return 0
+	case string:
+		if i, err := strconv.ParseInt(strings.TrimSpace(n), 10, 64); err == nil {
+			return i
+		}
+		f, _ := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return int64(f)
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i
+		}
+		f, _ := n.Float64()
+		return int64(f)
+	}
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		return int64(value.Float())
+	}
+	return 0
+}
+
+// ToFloat64 converts numbers, booleans and numeric strings to a float64
+func ToFloat64(v interface{}) float64 {
+	switch n := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if n {
+			return 1
+		}
+		return 0
+	case string:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f
+	case json.Number:
+		f, _ := n.Float64()
+		return f
+	}
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	}
+	return 0
+}
+
+// RegexFind returns the first match of pattern in s
+func RegexFind(pattern, s string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.FindString(s), nil
+}
+
+// RegexFindAll returns up to n matches of pattern in s; n < 0 means all
+func RegexFindAll(pattern, s string, n int) ([]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return re.FindAllString(s, n), nil
+}
+
+// RegexReplaceAll replaces the matches of pattern in s, expanding $1 style
+// references in replacement
+func RegexReplaceAll(pattern, s, replacement string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(s, replacement), nil
+}
+
+// RegexReplaceAllLiteral replaces the matches of pattern in s with the
+// literal replacement
+func RegexReplaceAllLiteral(pattern, s, replacement string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllLiteralString(s, replacement), nil
+}
+
+// RegexSplit splits s around the matches of pattern into at most n parts
+func RegexSplit(pattern, s string, n int) ([]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return re.Split(s, n), nil
+}
+
+// Empty reports whether v is nil, false, zero or an empty string,
+// collection or map
+func Empty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return value.Len() == 0
+	case reflect.Bool:
+		return !value.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return value.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return value.Float() == 0
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	}
+	return false
+}
+
+// Coalesce returns the first non-empty value
+func Coalesce(values ...interface{}) interface{} {
+	for _, v := range values {
+		if !Empty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+// ToJSONString encodes v as JSON, returning an empty string on failure
+func ToJSONString(v interface{}) string {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
+
+// ToRawJSONString encodes v as JSON without escaping HTML characters
+func ToRawJSONString(v interface{}) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// ToPrettyJSONString encodes v as indented JSON
+func ToPrettyJSONString(v interface{}) string {
+	encoded, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
+
+// FromJSON decodes a JSON document, returning nil for invalid input
+func FromJSON(s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil
+	}
+	return v
+}
+
+// foldInt combines the values as int64 with fn
+func foldInt(values []interface{}, fn func(a, b int64) int64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	result := ToInt64(values[0])
+	for _, v := range values[1:] {
+		result = fn(result, ToInt64(v))
+	}
+	return result
+}
+
+// foldFloat combines the values as float64 with fn
+func foldFloat(values []interface{}, fn func(a, b float64) float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	result := ToFloat64(values[0])
+	for _, v := range values[1:] {
+		result = fn(result, ToFloat64(v))
+	}
+	return result
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Div divides a by b as integers
+func Div(a, b interface{}) (int64, error) {
+	divisor := ToInt64(b)
+	if divisor == 0 {
+		return 0, errors.New("division by zero")
+	}
+	return ToInt64(a) / divisor, nil
+}
+
+// Mod returns the remainder of a divided by b
+func Mod(a, b interface{}) (int64, error) {
+	divisor := ToInt64(b)
+	if divisor == 0 {
+		return 0, errors.New("division by zero")
+	}
+	return ToInt64(a) % divisor, nil
+}
+
+// Round rounds v to the given number of decimal places
+func Round(v interface{}, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(ToFloat64(v)*scale) / scale
+}
+
+// toList converts any slice or array, or the result of split, to a
+// []interface{}
+func toList(list interface{}) []interface{} {
+	switch l := list.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return l
+	case []string:
+		result := make([]interface{}, len(l))
+		for i, s := range l {
+			result[i] = s
+		}
+		return result
+	case map[string]string:
+		// The parts of split, keyed _0, _1, ...
+		result := make([]interface{}, 0, len(l))
+		for i := 0; ; i++ {
+			part, ok := l["_"+strconv.Itoa(i)]
+			if !ok {
+				break
+			}
+			result = append(result, part)
+		}
+		if len(result) == len(l) {
+			return result
+		}
+	}
+	value := reflect.ValueOf(list)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return []interface{}{list}
+	}
+	result := make([]interface{}, value.Len())
+	for i := range result {
+		result[i] = value.Index(i).Interface()
+	}
+	return result
+}
+
+// First returns the first item of a list
+func First(list interface{}) interface{} {
+	items := toList(list)
+	if len(items) == 0 {
+		return nil
+	}
+	return items[0]
+}
+
+// Last returns the last item of a list
+func Last(list interface{}) interface{} {
+	items := toList(list)
+	if len(items) == 0 {
+		return nil
+	}
+	return items[len(items)-1]
+}
+
+// Rest returns all but the first item of a list
+func Rest(list interface{}) []interface{} {
+	items := toList(list)
+	if len(items) == 0 {
+		return []interface{}{}
+	}
+	return append([]interface{}{}, items[1:]...)
+}
+
+// Initial returns all but the last item of a list
+func Initial(list interface{}) []interface{} {
+	items := toList(list)
+	if len(items) == 0 {
+		return []interface{}{}
+	}
+	return append([]interface{}{}, items[:len(items)-1]...)
+}
+
+// Append returns a copy of list with v added at the end
+func Append(list interface{}, v interface{}) []interface{} {
+	return append(append([]interface{}{}, toList(list)...), v)
+}
+
+// Prepend returns a copy of list with v added at the front
+func Prepend(list interface{}, v interface{}) []interface{} {
+	return append([]interface{}{v}, toList(list)...)
+}
+
+// Concat joins lists into one
+func Concat(lists ...interface{}) []interface{} {
+	var result []interface{}
+	for _, list := range lists {
+		result = append(result, toList(list)...)
+	}
+	if result == nil {
+		return []interface{}{}
+	}
+	return result
+}
+
+// Reverse returns the items of a list in reverse order
+func Reverse(list interface{}) []interface{} {
+	items := toList(list)
+	result := make([]interface{}, len(items))
+	for i, item := range items {
+		result[len(items)-1-i] = item
+	}
+	return result
+}
+
+// Uniq removes duplicate items from a list
+func Uniq(list interface{}) []interface{} {
+	result := []interface{}{}
+	for _, item := range toList(list) {
+		if !Has(item, result) {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// Without returns list without the given items
+func Without(list interface{}, omit ...interface{}) []interface{} {
+	result := []interface{}{}
+	for _, item := range toList(list) {
+		if !Has(item, omit) {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// Has reports whether list contains needle
+func Has(needle interface{}, list interface{}) bool {
+	for _, item := range toList(list) {
+		if reflect.DeepEqual(item, needle) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compact removes empty items from a list
+func Compact(list interface{}) []interface{} {
+	result := []interface{}{}
+	for _, item := range toList(list) {
+		if !Empty(item) {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// SortAlpha sorts the items of a list as strings
+func SortAlpha(list interface{}) []string {
+	result := ToStrings(list)
+	sort.Strings(result)
+	return result
+}
+
+// UntilStep returns the integers from start up to, not including, stop
+func UntilStep(start, stop, step int) []int {
+	result := []int{}
+	if step == 0 {
+		return result
+	}
+	for i := start; (step > 0 && i < stop) || (step < 0 && i > stop); i += step {
+		result = append(result, i)
+	}
+	return result
+}
+
+// Dict builds a map from alternating keys and values
+func Dict(pairs ...interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key := ToString(pairs[i])
+		if i+1 < len(pairs) {
+			result[key] = pairs[i+1]
+		} else {
+			result[key] = ""
+		}
+	}
+	return result
+}
+
+// toDict converts a map with string keys to a map[string]interface{}
+func toDict(v interface{}) map[string]interface{} {
+	if d, ok := v.(map[string]interface{}); ok {
+		return d
+	}
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Map || value.Type().Key().Kind() != reflect.String {
+		return map[string]interface{}{}
+	}
+	result := make(map[string]interface{}, value.Len())
+	for _, key := range value.MapKeys() {
+		result[key.String()] = value.MapIndex(key).Interface()
+	}
+	return result
+}
+
+// Get returns the value of key in d, or an empty string when it is missing
+func Get(d map[string]interface{}, key string) interface{} {
+	if value, ok := d[key]; ok {
+		return value
+	}
+	return ""
+}
+
+// Keys returns the sorted keys of the given maps
+func Keys(dicts ...interface{}) []string {
+	var result []string
+	for _, d := range dicts {
+		for key := range toDict(d) {
+			result = append(result, key)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Values returns the values of a map ordered by key
+func Values(d interface{}) []interface{} {
+	dict := toDict(d)
+	keys := Keys(dict)
+	result := make([]interface{}, len(keys))
+	for i, key := range keys {
+		result[i] = dict[key]
+	}
+	return result
+}
+
+// Pluck returns the value of key in every map that has it
+func Pluck(key string, dicts ...interface{}) []interface{} {
+	result := []interface{}{}
+	for _, d := range dicts {
+		if value, ok := toDict(d)[key]; ok {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// Pick returns a copy of d with only the given keys
+func Pick(d interface{}, keys ...string) map[string]interface{} {
+	dict := toDict(d)
+	result := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		if value, ok := dict[key]; ok {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// Omit returns a copy of d without the given keys
+func Omit(d interface{}, keys ...string) map[string]interface{} {
+	dict := toDict(d)
+	result := make(map[string]interface{}, len(dict))
+	for key, value := range dict {
+		result[key] = value
+	}
+	for _, key := range keys {
+		delete(result, key)
+	}
+	return result
+}
+
+// Merge copies the keys of the sources into dst that dst does not have yet.
+// Nested maps are merged recursively.
+func Merge(dst interface{}, sources ...interface{}) map[string]interface{} {
+	result := toDict(dst)
+	for _, src := range sources {
+		for key, value := range toDict(src) {
+			existing, ok := result[key]
+			if !ok {
+				result[key] = value
+				continue
+			}
+			existingDict, existingIsDict := existing.(map[string]interface{})
+			valueDict, valueIsDict := value.(map[string]interface{})
+			if existingIsDict && valueIsDict {
+				result[key] = Merge(existingDict, valueDict)
+			}
+		}
+	}
+	return result
+}
+
+// Dig follows keys through nested maps, returning the last argument as the
+// default when a key is missing: dig "user" "role" "guest" .request
+func Dig(args ...interface{}) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, errors.New("dig needs at least one key, a default and a map")
+	}
+	current := interface{}(toDict(args[len(args)-1]))
+	fallback := args[len(args)-2]
+	for _, key := range args[:len(args)-2] {
+		dict, ok := current.(map[string]interface{})
+		if !ok {
+			return fallback, nil
+		}
+		if current, ok = dict[ToString(key)]; !ok {
+			return fallback, nil
+		}
+	}
+	return current, nil
+}
+
+// Base64Decode decodes a standard base64 string, with or without padding
+func Base64Decode(s string) (string, error) {
+	decoded, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(strings.TrimSpace(s), "="))
+	return string(decoded), err
+}
+
+// RandString returns length characters picked from charset with crypto/rand
+func RandString(length int, charset string) (string, error) {
+	if length < 0 {
+		return "", errors.New("length must not be negative")
+	}
+	limit := big.NewInt(int64(len(charset)))
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return "", err
+		}
+		b[i] = charset[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// UUIDv4 returns a random RFC 4122 version 4 UUID generated with crypto/rand
+func UUIDv4() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32], nil
+}
+
+// crockfordBase32 is the ULID alphabet
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID returns a ULID: a 48-bit millisecond timestamp followed by 80 random
+// bits from crypto/rand, as 26 Crockford base32 characters. ULIDs sort by
+// creation time.
+func ULID() (string, error) {
+	var b [16]byte
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> (40 - 8*uint(i)))
+	}
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+
+	// 128 bits encode as 26 characters of 5 bits, the first holding 3 bits
+	id := make([]byte, 26)
+	hi := uint64(b[0])<<56 | uint64(b[1])<<48 | uint64(b[2])<<40 | uint64(b[3])<<32 |
+		uint64(b[4])<<24 | uint64(b[5])<<16 | uint64(b[6])<<8 | uint64(b[7])
+	lo := uint64(b[8])<<56 | uint64(b[9])<<48 | uint64(b[10])<<40 | uint64(b[11])<<32 |
+		uint64(b[12])<<24 | uint64(b[13])<<16 | uint64(b[14])<<8 | uint64(b[15])
+	for i := 25; i >= 0; i-- {
+		id[i] = crockfordBase32[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(id), nil
+}
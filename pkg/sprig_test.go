@@ -0,0 +1,63 @@
+package pkg
+
+import (
+	"bytes"
+	"testing"
+	"text/template"
+)
+
+func TestSprigFuncMap(t *testing.T) {
+	data := map[string]interface{}{
+		"user": map[string]interface{}{
+			"name":  "budi santoso",
+			"roles": []interface{}{"admin", "editor", "admin"},
+			"age":   float64(31),
+		},
+	}
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{`[[ .user.name | title ]]`, "Budi Santoso"},
+		{`[[ .user.name | trunc 4 ]]`, "budi"},
+		{`[[ .user.name | snakecase ]]`, "budi_santoso"},
+		{`[[ "userID" | kebabcase ]]`, "user-id"},
+		{`[[ "user_id" | camelcase ]]`, "UserId"},
+		{`[[ .user.name | replace " " "-" ]]`, "budi-santoso"},
+		{`[[ .user.name | contains "santo" ]]`, "true"},
+		{`[[ (split " " .user.name)._1 ]]`, "santoso"},
+		{`[[ .user.roles | uniq | join "," ]]`, "admin,editor"},
+		{`[[ list 3 1 2 | sortAlpha | toJson ]]`, `["1","2","3"]`},
+		{`[[ .user.roles | first ]] [[ .user.roles | last ]] [[ len (rest .user.roles) ]]`, "admin admin 2"},
+		{`[[ has "editor" .user.roles ]]`, "true"},
+		{`[[ add .user.age 1 ]] [[ sub 10 3 ]] [[ mul 2 3 4 ]] [[ div 7 2 ]] [[ mod 7 2 ]]`, "32 7 24 3 1"},
+		{`[[ max 1 5 3 ]] [[ min 4 2 ]] [[ round 3.14159 2 ]] [[ addf 1.5 2 ]]`, "5 2 3.14 3.5"},
+		{`[[ $d := dict "a" 1 "b" 2 ]][[ keys $d | join "," ]] [[ get $d "b" ]] [[ hasKey $d "c" ]]`, "a,b 2 false"},
+		{`[[ pick .user "age" | toJson ]]`, `{"age":31}`},
+		{`[[ omit .user "roles" "age" | toJson ]]`, `{"name":"budi santoso"}`},
+		{`[[ dig "user" "name" "none" . ]] [[ dig "user" "email" "none" . ]]`, "budi santoso none"},
+		{`[[ coalesce "" .missing "fallback" ]] [[ empty .missing ]] [[ ternary "yes" "no" true ]]`, "fallback true yes"},
+		{`[[ "hello" | b64enc ]] [[ "aGVsbG8=" | b64dec ]]`, "aGVsbG8= hello"},
+		{`[[ "hello" | sha256sum | trunc 8 ]]`, "2cf24dba"},
+		{`[[ regexReplaceAll "[0-9]+" "a1b22" "#" ]] [[ regexMatch "^a" "abc" ]]`, "a#b# true"},
+		{`[[ (fromJson "{\"a\": [1, 2]}").a | toJson ]]`, "[1,2]"},
+		{`[[ until 3 | toJson ]]`, "[0,1,2]"},
+		{`[[ randNumeric 6 | len ]]`, "6"},
+	}
+
+	for _, tt := range tests {
+		tmpl, err := template.New("test").Funcs(SprigFuncMap()).Delims("[[", "]]").Parse(tt.template)
+		if err != nil {
+			t.Fatalf("Parse(%s) error = %v", tt.template, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			t.Errorf("Execute(%s) error = %v", tt.template, err)
+			continue
+		}
+		if buf.String() != tt.expected {
+			t.Errorf("%s = %q, expected %q", tt.template, buf.String(), tt.expected)
+		}
+	}
+}
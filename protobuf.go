@@ -0,0 +1,755 @@
+package traefik_modifier_plugin
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Protobuf field types from descriptor.proto
+const (
+	protoTypeDouble   = 1
+	protoTypeFloat    = 2
+	protoTypeInt64    = 3
+	protoTypeUint64   = 4
+	protoTypeInt32    = 5
+	protoTypeFixed64  = 6
+	protoTypeFixed32  = 7
+	protoTypeBool     = 8
+	protoTypeString   = 9
+	protoTypeMessage  = 11
+	protoTypeBytes    = 12
+	protoTypeUint32   = 13
+	protoTypeEnum     = 14
+	protoTypeSfixed32 = 15
+	protoTypeSfixed64 = 16
+	protoTypeSint32   = 17
+	protoTypeSint64   = 18
+
+	protoLabelRepeated = 3
+)
+
+// protoRegistry holds the messages, enums and methods of a descriptor set
+type protoRegistry struct {
+	messages map[string]*protoMessage
+	enums    map[string]*protoEnum
+	methods  map[string]*protoMethod
+}
+
+// protoMessage describes a message type
+type protoMessage struct {
+	name     string
+	fields   []*protoField
+	byNumber map[int]*protoField
+	byName   map[string]*protoField
+	mapEntry bool
+}
+
+// protoField describes a message field
+type protoField struct {
+	name     string
+	jsonName string
+	number   int
+	label    int
+	typ      int
+	typeName string
+}
+
+// protoEnum maps enum names and numbers
+type protoEnum struct {
+	names  map[int64]string
+	values map[string]int64
+}
+
+// protoMethod describes an RPC method
+type protoMethod struct {
+	input  string
+	output string
+}
+
+// parseDescriptorSet parses a FileDescriptorSet as produced by
+// protoc --descriptor_set_out
+func parseDescriptorSet(data []byte) (*protoRegistry, error) {
+	registry := &protoRegistry{
+		messages: make(map[string]*protoMessage),
+		enums:    make(map[string]*protoEnum),
+		methods:  make(map[string]*protoMethod),
+	}
+
+	err := walkProtoFields(data, func(number, wireType int, value uint64, payload []byte) error {
+		if number == 1 && wireType == wireBytes {
+			return registry.addFile(payload)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %w", err)
+	}
+	return registry, nil
+}
+
+// addFile registers the types and services of a FileDescriptorProto
+func (r *protoRegistry) addFile(data []byte) error {
+	var pkg string
+	var messages, enums, services [][]byte
+	err := walkProtoFields(data, func(number, wireType int, value uint64, payload []byte) error {
+		switch number {
+		case 2:
+			pkg = string(payload)
+		case 4:
+			messages = append(messages, payload)
+		case 5:
+			enums = append(enums, payload)
+		case 6:
+			services = append(services, payload)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	prefix := ""
+	if pkg != "" {
+		prefix = pkg + "."
+	}
+	for _, message := range messages {
+		if err := r.addMessage(prefix, message); err != nil {
+			return err
+		}
+	}
+	for _, enum := range enums {
+		if err := r.addEnum(prefix, enum); err != nil {
+			return err
+		}
+	}
+	for _, service := range services {
+		if err := r.addService(prefix, service); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addMessage registers a DescriptorProto and its nested types
+func (r *protoRegistry) addMessage(prefix string, data []byte) error {
+	message := &protoMessage{byNumber: make(map[int]*protoField), byName: make(map[string]*protoField)}
+	var nested, enums [][]byte
+
+	err := walkProtoFields(data, func(number, wireType int, value uint64, payload []byte) error {
+		switch number {
+		case 1:
+			message.name = prefix + string(payload)
+		case 2:
+			field, err := parseFieldDescriptor(payload)
+			if err != nil {
+				return err
+			}
+			message.fields = append(message.fields, field)
+		case 3:
+			nested = append(nested, payload)
+		case 4:
+			enums = append(enums, payload)
+		case 7:
+			return walkProtoFields(payload, func(number, wireType int, value uint64, payload []byte) error {
+				if number == 7 {
+					message.mapEntry = value != 0
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(message.fields, func(i, j int) bool { return message.fields[i].number < message.fields[j].number })
+	for _, field := range message.fields {
+		message.byNumber[field.number] = field
+		message.byName[field.name] = field
+		message.byName[field.jsonName] = field
+	}
+	r.messages[message.name] = message
+
+	for _, n := range nested {
+		if err := r.addMessage(message.name+".", n); err != nil {
+			return err
+		}
+	}
+	for _, enum := range enums {
+		if err := r.addEnum(message.name+".", enum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseFieldDescriptor parses a FieldDescriptorProto
+func parseFieldDescriptor(data []byte) (*protoField, error) {
+	field := &protoField{}
+	err := walkProtoFields(data, func(number, wireType int, value uint64, payload []byte) error {
+		switch number {
+		case 1:
+			field.name = string(payload)
+		case 3:
+			field.number = int(value)
+		case 4:
+			field.label = int(value)
+		case 5:
+			field.typ = int(value)
+		case 6:
+			field.typeName = strings.TrimPrefix(string(payload), ".")
+		case 10:
+			field.jsonName = string(payload)
+		}
+		return nil
+	})
+	if field.jsonName == "" {
+		field.jsonName = protoJSONName(field.name)
+	}
+	return field, err
+}
+
+// protoJSONName converts snake_case to lowerCamelCase like protoc does
+func protoJSONName(name string) string {
+	var b strings.Builder
+	upper := false
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c == '_' {
+			upper = true
+			continue
+		}
+		if upper && c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper = false
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// addEnum registers an EnumDescriptorProto
+func (r *protoRegistry) addEnum(prefix string, data []byte) error {
+	enum := &protoEnum{names: make(map[int64]string), values: make(map[string]int64)}
+	var name string
+	err := walkProtoFields(data, func(number, wireType int, value uint64, payload []byte) error {
+		switch number {
+		case 1:
+			name = prefix + string(payload)
+		case 2:
+			var valueName string
+			var valueNumber int64
+			err := walkProtoFields(payload, func(number, wireType int, value uint64, payload []byte) error {
+				if number == 1 {
+					valueName = string(payload)
+				} else if number == 2 {
+					valueNumber = int64(int32(value))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			enum.values[valueName] = valueNumber
+			if _, exists := enum.names[valueNumber]; !exists {
+				enum.names[valueNumber] = valueName
+			}
+		}
+		return nil
+	})
+	r.enums[name] = enum
+	return err
+}
+
+// addService registers the methods of a ServiceDescriptorProto by gRPC path
+func (r *protoRegistry) addService(prefix string, data []byte) error {
+	var name string
+	var methods [][]byte
+	err := walkProtoFields(data, func(number, wireType int, value uint64, payload []byte) error {
+		if number == 1 {
+			name = prefix + string(payload)
+		} else if number == 2 {
+			methods = append(methods, payload)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, m := range methods {
+		var methodName string
+		method := &protoMethod{}
+		err := walkProtoFields(m, func(number, wireType int, value uint64, payload []byte) error {
+			switch number {
+			case 1:
+				methodName = string(payload)
+			case 2:
+				method.input = strings.TrimPrefix(string(payload), ".")
+			case 3:
+				method.output = strings.TrimPrefix(string(payload), ".")
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		r.methods["/"+name+"/"+methodName] = method
+	}
+	return nil
+}
+
+// walkProtoFields calls fn for every field of an encoded message. Varint and
+// fixed values are passed as value, length-delimited fields as payload.
+func walkProtoFields(data []byte, fn func(number, wireType int, value uint64, payload []byte) error) error {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("invalid field tag")
+		}
+		data = data[n:]
+		number, wireType := int(tag>>3), int(tag&7)
+
+		var value uint64
+		var payload []byte
+		switch wireType {
+		case wireVarint:
+			value, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errors.New("invalid varint")
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return errors.New("truncated fixed64")
+			}
+			value = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return errors.New("truncated fixed32")
+			}
+			value = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < size {
+				return errors.New("truncated length-delimited field")
+			}
+			payload = data[n : n+int(size)]
+			data = data[n+int(size):]
+		default:
+			return fmt.Errorf("unsupported wire type %d", wireType)
+		}
+
+		if err := fn(number, wireType, value, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decoding
+
+// decodeMessage decodes a binary message into a JSON-compatible map using
+// the proto3 JSON mapping (lowerCamelCase names, 64-bit integers as strings,
+// enums by name, bytes as base64)
+func (r *protoRegistry) decodeMessage(typeName string, data []byte) (map[string]interface{}, error) {
+	message, ok := r.messages[typeName]
+	if !ok {
+		return nil, fmt.Errorf("unknown message type %q", typeName)
+	}
+
+	result := make(map[string]interface{})
+	err := walkProtoFields(data, func(number, wireType int, value uint64, payload []byte) error {
+		field, ok := message.byNumber[number]
+		if !ok {
+			return nil
+		}
+
+		// Packed repeated scalars
+		if wireType == wireBytes && field.label == protoLabelRepeated && isPackableType(field.typ) {
+			list, _ := result[field.jsonName].([]interface{})
+			for len(payload) > 0 {
+				var raw uint64
+				switch packedWireType(field.typ) {
+				case wireFixed64:
+					if len(payload) < 8 {
+						return errors.New("truncated packed fixed64")
+					}
+					raw, payload = binary.LittleEndian.Uint64(payload), payload[8:]
+				case wireFixed32:
+					if len(payload) < 4 {
+						return errors.New("truncated packed fixed32")
+					}
+					raw, payload = uint64(binary.LittleEndian.Uint32(payload)), payload[4:]
+				default:
+					var n int
+					raw, n = binary.Uvarint(payload)
+					if n <= 0 {
+						return errors.New("invalid packed varint")
+					}
+					payload = payload[n:]
+				}
+				list = append(list, r.decodeScalar(field, raw))
+			}
+			result[field.jsonName] = list
+			return nil
+		}
+
+		decoded, err := r.decodeValue(field, value, payload)
+		if err != nil {
+			return err
+		}
+
+		if entry, isMap := r.messages[field.typeName]; isMap && entry.mapEntry {
+			m, _ := result[field.jsonName].(map[string]interface{})
+			if m == nil {
+				m = make(map[string]interface{})
+				result[field.jsonName] = m
+			}
+			pair := decoded.(map[string]interface{})
+			keyField := entry.byNumber[1]
+			key := ""
+			if keyField != nil {
+				key = fmt.Sprint(pair[keyField.jsonName])
+			}
+			if valueField := entry.byNumber[2]; valueField != nil {
+				m[key] = pair[valueField.jsonName]
+			}
+			return nil
+		}
+
+		if field.label == protoLabelRepeated {
+			list, _ := result[field.jsonName].([]interface{})
+			result[field.jsonName] = append(list, decoded)
+			return nil
+		}
+		result[field.jsonName] = decoded
+		return nil
+	})
+	return result, err
+}
+
+// decodeValue decodes a single non-packed field value
+func (r *protoRegistry) decodeValue(field *protoField, value uint64, payload []byte) (interface{}, error) {
+	switch field.typ {
+	case protoTypeString:
+		return string(payload), nil
+	case protoTypeBytes:
+		return base64.StdEncoding.EncodeToString(payload), nil
+	case protoTypeMessage:
+		return r.decodeMessage(field.typeName, payload)
+	}
+	return r.decodeScalar(field, value), nil
+}
+
+// decodeScalar converts a raw varint or fixed value to its JSON representation
+func (r *protoRegistry) decodeScalar(field *protoField, raw uint64) interface{} {
+	switch field.typ {
+	case protoTypeDouble:
+		return math.Float64frombits(raw)
+	case protoTypeFloat:
+		return float64(math.Float32frombits(uint32(raw)))
+	case protoTypeInt64, protoTypeSfixed64:
+		return strconv.FormatInt(int64(raw), 10)
+	case protoTypeUint64, protoTypeFixed64:
+		return strconv.FormatUint(raw, 10)
+	case protoTypeSint64:
+		return strconv.FormatInt(int64(raw>>1)^-int64(raw&1), 10)
+	case protoTypeInt32, protoTypeSfixed32:
+		return int64(int32(raw))
+	case protoTypeUint32, protoTypeFixed32:
+		return int64(uint32(raw))
+	case protoTypeSint32:
+		return int64(int32(uint32(raw>>1) ^ -uint32(raw&1)))
+	case protoTypeBool:
+		return raw != 0
+	case protoTypeEnum:
+		if enum, ok := r.enums[field.typeName]; ok {
+			if name, ok := enum.names[int64(int32(raw))]; ok {
+				return name
+			}
+		}
+		return int64(int32(raw))
+	}
+	return raw
+}
+
+// isPackableType reports whether repeated fields of typ use packed encoding
+func isPackableType(typ int) bool {
+	switch typ {
+	case protoTypeString, protoTypeBytes, protoTypeMessage:
+		return false
+	}
+	return true
+}
+
+// packedWireType returns the wire type of a packed element
+func packedWireType(typ int) int {
+	switch typ {
+	case protoTypeDouble, protoTypeFixed64, protoTypeSfixed64:
+		return wireFixed64
+	case protoTypeFloat, protoTypeFixed32, protoTypeSfixed32:
+		return wireFixed32
+	}
+	return wireVarint
+}
+
+// Encoding
+
+// encodeMessage encodes a JSON object into a binary message. Fields are
+// matched by JSON name or original name; unknown fields are rejected.
+func (r *protoRegistry) encodeMessage(typeName string, value interface{}) ([]byte, error) {
+	message, ok := r.messages[typeName]
+	if !ok {
+		return nil, fmt.Errorf("unknown message type %q", typeName)
+	}
+
+	object, ok := value.(map[string]interface{})
+	if value != nil && !ok {
+		return nil, fmt.Errorf("%s: expected JSON object", typeName)
+	}
+	for name := range object {
+		if _, known := message.byName[name]; !known {
+			return nil, fmt.Errorf("%s: unknown field %q", typeName, name)
+		}
+	}
+
+	var out []byte
+	for _, field := range message.fields {
+		fieldValue, exists := object[field.jsonName]
+		if !exists {
+			fieldValue = object[field.name]
+		}
+		if fieldValue == nil {
+			continue
+		}
+
+		var err error
+		if entry, isMap := r.messages[field.typeName]; isMap && entry.mapEntry {
+			out, err = r.encodeMap(out, field, entry, fieldValue)
+		} else if field.label == protoLabelRepeated {
+			out, err = r.encodeRepeated(out, field, fieldValue)
+		} else {
+			out, err = r.encodeValue(out, field, fieldValue)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", typeName, field.jsonName, err)
+		}
+	}
+	return out, nil
+}
+
+// encodeRepeated encodes a list, packing scalar numeric values
+func (r *protoRegistry) encodeRepeated(out []byte, field *protoField, value interface{}) ([]byte, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, errors.New("expected JSON array")
+	}
+
+	if !isPackableType(field.typ) {
+		for _, item := range list {
+			var err error
+			if out, err = r.encodeValue(out, field, item); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+
+	var packed []byte
+	for _, item := range list {
+		raw, err := r.encodeScalar(field, item)
+		if err != nil {
+			return nil, err
+		}
+		packed = appendProtoRaw(packed, packedWireType(field.typ), raw)
+	}
+	out = appendProtoTag(out, field.number, wireBytes)
+	out = binary.AppendUvarint(out, uint64(len(packed)))
+	return append(out, packed...), nil
+}
+
+// encodeMap encodes a JSON object as repeated map entries
+func (r *protoRegistry) encodeMap(out []byte, field *protoField, entry *protoMessage, value interface{}) ([]byte, error) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("expected JSON object")
+	}
+
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		pair := map[string]interface{}{}
+		if keyField := entry.byNumber[1]; keyField != nil {
+			pair[keyField.jsonName] = key
+		}
+		if valueField := entry.byNumber[2]; valueField != nil {
+			pair[valueField.jsonName] = object[key]
+		}
+		encoded, err := r.encodeMessage(entry.name, pair)
+		if err != nil {
+			return nil, err
+		}
+		out = appendProtoTag(out, field.number, wireBytes)
+		out = binary.AppendUvarint(out, uint64(len(encoded)))
+		out = append(out, encoded...)
+	}
+	return out, nil
+}
+
+// encodeValue encodes a single field value with its tag
+func (r *protoRegistry) encodeValue(out []byte, field *protoField, value interface{}) ([]byte, error) {
+	var payload []byte
+	switch field.typ {
+	case protoTypeString:
+		s, ok := value.(string)
+		if !ok {
+			return nil, errors.New("expected string")
+		}
+		payload = []byte(s)
+	case protoTypeBytes:
+		s, ok := value.(string)
+		if !ok {
+			return nil, errors.New("expected base64 string")
+		}
+		decoded, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			if decoded, err = base64.URLEncoding.DecodeString(s); err != nil {
+				return nil, errors.New("invalid base64")
+			}
+		}
+		payload = decoded
+	case protoTypeMessage:
+		encoded, err := r.encodeMessage(field.typeName, value)
+		if err != nil {
+			return nil, err
+		}
+		payload = encoded
+	default:
+		raw, err := r.encodeScalar(field, value)
+		if err != nil {
+			return nil, err
+		}
+		wireType := packedWireType(field.typ)
+		out = appendProtoTag(out, field.number, wireType)
+		return appendProtoRaw(out, wireType, raw), nil
+	}
+
+	out = appendProtoTag(out, field.number, wireBytes)
+	out = binary.AppendUvarint(out, uint64(len(payload)))
+	return append(out, payload...), nil
+}
+
+// encodeScalar converts a JSON value to the raw wire value of a scalar field
+func (r *protoRegistry) encodeScalar(field *protoField, value interface{}) (uint64, error) {
+	switch field.typ {
+	case protoTypeBool:
+		b, ok := value.(bool)
+		if !ok {
+			return 0, errors.New("expected boolean")
+		}
+		if b {
+			return 1, nil
+		}
+		return 0, nil
+	case protoTypeEnum:
+		if name, ok := value.(string); ok {
+			if enum, ok := r.enums[field.typeName]; ok {
+				if number, ok := enum.values[name]; ok {
+					return uint64(number), nil
+				}
+			}
+			return 0, fmt.Errorf("unknown enum value %q", name)
+		}
+	case protoTypeDouble, protoTypeFloat:
+		number, err := jsonNumber(value)
+		if err != nil {
+			return 0, err
+		}
+		if field.typ == protoTypeFloat {
+			return uint64(math.Float32bits(float32(number))), nil
+		}
+		return math.Float64bits(number), nil
+	}
+
+	switch field.typ {
+	case protoTypeUint64, protoTypeFixed64, protoTypeUint32, protoTypeFixed32:
+		if s, ok := value.(string); ok {
+			return strconv.ParseUint(s, 10, 64)
+		}
+	}
+
+	var integer int64
+	if s, ok := value.(string); ok {
+		parsed, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid integer %q", s)
+		}
+		integer = parsed
+	} else {
+		number, err := jsonNumber(value)
+		if err != nil {
+			return 0, err
+		}
+		if number != math.Trunc(number) {
+			return 0, fmt.Errorf("expected integer, got %v", number)
+		}
+		integer = int64(number)
+	}
+
+	switch field.typ {
+	case protoTypeSint32, protoTypeSint64:
+		return uint64(integer<<1) ^ uint64(integer>>63), nil
+	case protoTypeFixed32, protoTypeSfixed32:
+		return uint64(uint32(integer)), nil
+	}
+	return uint64(integer), nil
+}
+
+// jsonNumber extracts a float from a JSON number or numeric string
+func jsonNumber(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("expected number, got %v", value)
+}
+
+// appendProtoTag appends a field tag
+func appendProtoTag(out []byte, number, wireType int) []byte {
+	return binary.AppendUvarint(out, uint64(number)<<3|uint64(wireType))
+}
+
+// appendProtoRaw appends a raw scalar value in the given wire type
+func appendProtoRaw(out []byte, wireType int, raw uint64) []byte {
+	switch wireType {
+	case wireFixed64:
+		return binary.LittleEndian.AppendUint64(out, raw)
+	case wireFixed32:
+		return binary.LittleEndian.AppendUint32(out, uint32(raw))
+	}
+	return binary.AppendUvarint(out, raw)
+}
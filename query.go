@@ -1,10 +1,11 @@
 package traefik_modifier_plugin
 
 import (
-	"bytes"
-	"log"
+	"fmt"
 	"net/http"
 	"net/url"
+	"path"
+	"sort"
 	"strings"
 	"text/template"
 
@@ -14,85 +15,264 @@ import (
 // QueryConfig holds the query transformation configuration
 type QueryConfig struct {
 	Transform map[string]string `json:"transform,omitempty"`
+	Remove    []string          `json:"remove,omitempty"`
+	Allow     []string          `json:"allow,omitempty"`
+
+	PreserveRawQuery bool `json:"preserve_raw_query,omitempty"`
 }
 
 // QueryModifier handles query parameter transformations
 type QueryModifier struct {
 	transforms map[string]string
+	templates  map[string]*template.Template
+	parseErr   error
+	remove     []*template.Template
+	allow      []string
+	preserve   bool
+	funcs      template.FuncMap
 }
 
 // NewQueryModifier creates a new query modifier instance
 func NewQueryModifier(transforms map[string]string) *QueryModifier {
-	return &QueryModifier{
+	return NewQueryModifierWithFuncs(transforms, pkg.SimpleFuncMap())
+}
+
+// NewQueryModifierWithFuncs creates a new query modifier instance using the given template functions
+func NewQueryModifierWithFuncs(transforms map[string]string, funcs template.FuncMap) *QueryModifier {
+	qm := &QueryModifier{
 		transforms: transforms,
+		templates:  make(map[string]*template.Template, len(transforms)),
+		funcs:      funcs,
+	}
+
+	// Parse the transform templates once, in name order so the reported
+	// error is stable
+	names := make([]string, 0, len(transforms))
+	for name := range transforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		templateKey := "modifier_query[" + name + "]"
+		tmpl, err := template.New(templateKey).Funcs(funcs).Delims("[[", "]]").Parse(transforms[name])
+		if err != nil {
+			if qm.parseErr == nil {
+				qm.parseErr = newTemplateError(templateKey, err)
+			}
+			continue
+		}
+		qm.templates[name] = tmpl
+	}
+
+	return qm
+}
+
+// SetRemove parses the remove list. Each entry is a template rendering
+// whitespace separated glob patterns (path.Match syntax); an empty result
+// removes nothing, so entries can be conditional.
+func (qm *QueryModifier) SetRemove(patterns []string) error {
+	qm.remove = nil
+	for i, pattern := range patterns {
+		key := fmt.Sprintf("modifier_query[remove:%d]", i)
+		tmpl, err := template.New(key).Funcs(qm.funcs).Delims("[[", "]]").Parse(pattern)
+		if err != nil {
+			return newTemplateError(key, err)
+		}
+		if !strings.Contains(pattern, "[[") {
+			for _, glob := range strings.Fields(pattern) {
+				if _, err := path.Match(glob, ""); err != nil {
+					return fmt.Errorf("invalid %s pattern %q: %w", key, glob, err)
+				}
+			}
+		}
+		qm.remove = append(qm.remove, tmpl)
+	}
+	return nil
+}
+
+// SetAllow sets the allowlist of glob patterns. When set, parameters that
+// match none of the patterns are dropped before the transforms run.
+func (qm *QueryModifier) SetAllow(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid modifier_query allow pattern %q: %w", pattern, err)
+		}
+	}
+	qm.allow = patterns
+	return nil
+}
+
+// SetPreserveRawQuery keeps the order and encoding of unchanged parameters
+// instead of re-encoding the whole query string
+func (qm *QueryModifier) SetPreserveRawQuery(preserve bool) {
+	qm.preserve = preserve
+}
+
+// allowed reports whether name matches the allowlist
+func (qm *QueryModifier) allowed(name string) bool {
+	for _, pattern := range qm.allow {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
 	}
+	return false
+}
+
+// Validate returns the error of a transform template that failed to parse,
+// so a broken configuration is rejected when the plugin is created
+func (qm *QueryModifier) Validate() error {
+	return qm.parseErr
 }
 
 // ModifyQueryWithContext handles query parameter modification using templates with context
+// Parameters outside the allowlist or matching the remove list are dropped
+// before the transforms run
+// Failing templates are skipped and the last error is returned
 func (qm *QueryModifier) ModifyQueryWithContext(req *http.Request, ctx *TemplateContext) error {
-	if len(qm.transforms) == 0 {
+	if len(qm.transforms) == 0 && len(qm.remove) == 0 && len(qm.allow) == 0 {
 		return nil
 	}
 
+	logs := requestLog(ctx)
+
 	// Get current query parameters
 	values := req.URL.Query()
 
-	// Create template data from request
-	templateData := map[string]interface{}{
-		"request": map[string]interface{}{
-			"query":  queryParamsToMap(values),
-			"header": headerToMap(req.Header),
-			"method": req.Method,
-			"path":   req.URL.Path,
-		},
-	}
+	// Create template data from request; .request.header keeps every value
+	request := requestTemplateData(req)
+	request["header"] = headerToMap(req.Header)
+	templateData := buildTemplateData(ctx, map[string]interface{}{
+		"request": request,
+	})
 
-	// Add context if provided
-	if ctx != nil {
-		templateData["context"] = ctx
-	}
+	logs.debugf(phaseQuery, "", "Query modifier template data: %+v", templateData["request"])
 
-	log.Printf("Query modifier template data: %+v", templateData)
+	// Keep allowlisted parameters only
+	if len(qm.allow) > 0 {
+		for name := range values {
+			if !qm.allowed(name) {
+				values.Del(name)
+			}
+		}
+	}
 
-	// Apply transformations
-	for targetParam, templateStr := range qm.transforms {
-		// Parse and execute template
-		tmpl, err := template.New("query").Funcs(pkg.SimpleFuncMap()).Delims("[[", "]]").Parse(templateStr)
-		if err != nil {
-			log.Printf("Failed to parse query template for %s: %v", targetParam, err)
+	// Remove matching parameters
+	var execErr error
+	for _, tmpl := range qm.remove {
+		buf := newTemplateOutput(ctx)
+		if err := tmpl.Execute(buf, templateData); err != nil {
+			execErr = newTemplateError(tmpl.Name(), err)
+			traceTemplate(ctx, tmpl.Name(), nil, execErr)
+			logs.warnf(phaseQuery, "", "Failed to execute query remove template: %v", execErr)
+			buf.release()
 			continue
 		}
+		traceTemplate(ctx, tmpl.Name(), buf.Bytes(), nil)
+		globs := strings.Fields(strings.ReplaceAll(buf.String(), "<no value>", ""))
+		buf.release()
+		for _, glob := range globs {
+			for name := range values {
+				if matched, _ := path.Match(glob, name); matched {
+					values.Del(name)
+				}
+			}
+		}
+	}
 
-		var buf bytes.Buffer
-		if err := tmpl.Execute(&buf, templateData); err != nil {
-			log.Printf("Failed to execute query template for %s: %v", targetParam, err)
+	// Apply transformations
+	for targetParam, tmpl := range qm.templates {
+		templateKey := tmpl.Name()
+		buf := newTemplateOutput(ctx)
+		if err := tmpl.Execute(buf, templateData); err != nil {
+			execErr = newTemplateError(templateKey, err)
+			traceTemplate(ctx, templateKey, nil, execErr)
+			logs.warnf(phaseQuery, "", "Failed to execute query template for %s: %v", targetParam, execErr)
+			buf.release()
 			continue
 		}
+		traceTemplate(ctx, templateKey, buf.Bytes(), nil)
 
 		result := buf.String()
+		buf.release()
 
 		// Clean the result by removing "<no value>" strings
 		result = strings.ReplaceAll(result, "<no value>", "")
 
 		if result != "" {
 			if values.Has(targetParam) {
-				log.Printf("Overwriting existing query parameter %s", targetParam)
+				logs.debugf(phaseQuery, outcomeModified, "Overwriting existing query parameter %s", targetParam)
 				values.Set(targetParam, result)
 			} else {
-				log.Printf("Setting new query parameter %s", targetParam)
+				logs.debugf(phaseQuery, outcomeModified, "Setting new query parameter %s", targetParam)
 				values.Add(targetParam, result)
 			}
 
 			// Set the transformed value
-			log.Printf("Query parameter %s transformed to: %s", targetParam, result)
+			logs.debugf(phaseQuery, outcomeModified, "Query parameter %s transformed to: %s", targetParam, result)
 		}
 	}
 
 	// Update the request URL with modified query parameters
-	req.URL.RawQuery = values.Encode()
+	if qm.preserve {
+		req.URL.RawQuery = mergeRawQuery(req.URL.RawQuery, req.URL.Query(), values)
+	} else {
+		req.URL.RawQuery = values.Encode()
+	}
 	req.RequestURI = req.URL.RequestURI()
 
-	return nil
+	return execErr
+}
+
+// mergeRawQuery rewrites raw so it holds values, keeping the original order
+// and encoding of every parameter whose values did not change. Changed
+// parameters are re-encoded at their first position and new parameters are
+// appended in sorted order. Pairs that cannot be decoded are kept as is.
+func mergeRawQuery(raw string, original, values url.Values) string {
+	changed := func(name string) bool {
+		return strings.Join(original[name], "\x00") != strings.Join(values[name], "\x00") ||
+			len(original[name]) != len(values[name])
+	}
+	encode := func(name string) []string {
+		pairs := make([]string, 0, len(values[name]))
+		for _, value := range values[name] {
+			pairs = append(pairs, url.QueryEscape(name)+"="+url.QueryEscape(value))
+		}
+		return pairs
+	}
+
+	var pairs []string
+	written := make(map[string]bool)
+	for _, pair := range strings.Split(raw, "&") {
+		if pair == "" {
+			continue
+		}
+		rawName := pair
+		if i := strings.IndexByte(pair, '='); i >= 0 {
+			rawName = pair[:i]
+		}
+		name, err := url.QueryUnescape(rawName)
+		if err != nil || !changed(name) {
+			pairs = append(pairs, pair)
+			continue
+		}
+		if !written[name] {
+			written[name] = true
+			pairs = append(pairs, encode(name)...)
+		}
+	}
+
+	var added []string
+	for name := range values {
+		if !written[name] && changed(name) {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+	for _, name := range added {
+		pairs = append(pairs, encode(name)...)
+	}
+
+	return strings.Join(pairs, "&")
 }
 
 // queryParamsToMap converts url.Values to a simple map for template usage
@@ -0,0 +1,144 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestModifier_QueryRemove(t *testing.T) {
+	config := CreateConfig()
+	config.ModifierQuery = &QueryConfig{
+		Transform: map[string]string{"source": "gateway"},
+		Remove: []string{
+			"apikey utm_*",
+			`[[ if ne (index .request.header "X-Debug-Token" | default "") "s3cret" ]]debug[[ end ]]`,
+		},
+	}
+	config.AccessLog = &AccessLogConfig{HeaderPrefix: "X-Log-"}
+
+	var query string
+	var upstreamReq *http.Request
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		query = req.URL.RawQuery
+		upstreamReq = req
+	})
+
+	handler, err := New(context.Background(), next, config, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		debugToken string
+		expected   string
+	}{
+		{"", "q=go&source=gateway"},
+		{"s3cret", "debug=1&q=go&source=gateway"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "http://example.com/search?q=go&apikey=k&utm_source=ad&utm_medium=cpc&debug=1", nil)
+		if tt.debugToken != "" {
+			req.Header.Set("X-Debug-Token", tt.debugToken)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if query != tt.expected {
+			t.Errorf("Expected query %q, got %q", tt.expected, query)
+		}
+	}
+	if templates := upstreamReq.Header.Get("X-Log-Templates"); templates != "query:apikey,query:source,query:utm_medium,query:utm_source" {
+		t.Errorf("Unexpected access log templates %q", templates)
+	}
+
+	config.ModifierQuery.Remove = []string{"bad["}
+	if _, err := New(context.Background(), next, config, "test"); err == nil {
+		t.Errorf("Expected error for invalid remove pattern")
+	}
+}
+
+func TestModifier_QueryAllow(t *testing.T) {
+	config := CreateConfig()
+	config.ModifierQuery = &QueryConfig{
+		Transform: map[string]string{"source": "gateway"},
+		Allow:     []string{"q", "page", "filter_*"},
+	}
+
+	var query string
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		query = req.URL.RawQuery
+	})
+
+	handler, err := New(context.Background(), next, config, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com/search?q=go&page=2&filter_lang=id&debug=1&sort=asc", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if expected := "filter_lang=id&page=2&q=go&source=gateway"; query != expected {
+		t.Errorf("Expected query %q, got %q", expected, query)
+	}
+
+	config.ModifierQuery.Allow = []string{"[q"}
+	if _, err := New(context.Background(), next, config, "test"); err == nil {
+		t.Errorf("Expected error for invalid allow pattern")
+	}
+}
+
+func TestModifier_QueryPreserveRawQuery(t *testing.T) {
+	config := CreateConfig()
+	config.ModifierQuery = &QueryConfig{
+		Transform:        map[string]string{"page": "[[ .request.query.p ]]", "source": "gateway"},
+		Remove:           []string{"apikey"},
+		PreserveRawQuery: true,
+	}
+
+	var query string
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		query = req.URL.RawQuery
+	})
+
+	handler, err := New(context.Background(), next, config, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		raw      string
+		expected string
+	}{
+		{"z=a%20b&apikey=k&page=1&p=3&tags=x&tags=y", "z=a%20b&page=3&p=3&tags=x&tags=y&source=gateway"},
+		{"b=1&a=c+d", "b=1&a=c+d&source=gateway"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "http://example.com/search?"+tt.raw, nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if query != tt.expected {
+			t.Errorf("Expected query %q, got %q", tt.expected, query)
+		}
+	}
+}
+
+func TestQueryModifier_ParsesTemplatesOnce(t *testing.T) {
+	qm := NewQueryModifier(map[string]string{"page": `[[ default "1" .request.query.page ]]`, "size": "20"})
+	if err := qm.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if len(qm.templates) != 2 {
+		t.Fatalf("Expected both transforms to be parsed, got %v", qm.templates)
+	}
+
+	req := httptest.NewRequest("GET", "/?page=3", nil)
+	if err := qm.ModifyQueryWithContext(req, &TemplateContext{}); err != nil {
+		t.Fatalf("ModifyQueryWithContext() error = %v", err)
+	}
+	if req.URL.Query().Get("page") != "3" || req.URL.Query().Get("size") != "20" {
+		t.Errorf("Unexpected query %s", req.URL.RawQuery)
+	}
+
+	if err := NewQueryModifier(map[string]string{"page": `[[ if ]]`}).Validate(); err == nil {
+		t.Errorf("Expected a parse error")
+	}
+}
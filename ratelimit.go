@@ -0,0 +1,208 @@
+package traefik_modifier_plugin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Rate limit counter stores
+const (
+	rateLimitStoreMemory = "memory"
+	rateLimitStoreRedis  = "redis"
+)
+
+// RateLimitConfig holds the rate limit counter configuration
+type RateLimitConfig struct {
+	Key     string `json:"key,omitempty"`
+	Limit   int64  `json:"limit,omitempty"`
+	Window  string `json:"window,omitempty"`
+	Store   string `json:"store,omitempty"`
+	MaxKeys int    `json:"max_keys,omitempty"`
+}
+
+// RateLimiter counts requests per templated key in fixed windows and exposes
+// the quota as .ratelimit. It only reports usage, it never rejects requests.
+type RateLimiter struct {
+	keyTemplate *template.Template
+	limit       int64
+	window      time.Duration
+	redis       *RedisClient
+	now         func() time.Time
+	maxKeys     int
+
+	mu          sync.Mutex
+	counters    map[string]*rateLimitCounter
+	sweptWindow int64
+}
+
+// rateLimitCounter is an in-memory counter for a single window
+type rateLimitCounter struct {
+	windowStart int64
+	count       int64
+}
+
+// defaultRateLimitKeys bounds the in-memory store when max_keys is not set
+const defaultRateLimitKeys = 10000
+
+// NewRateLimiter creates a new rate limit counter. The redis client is
+// required when the store is redis.
+func NewRateLimiter(config *RateLimitConfig, funcs template.FuncMap, redis *RedisClient) (*RateLimiter, error) {
+	if config.Key == "" {
+		return nil, errors.New("rate limit key is required")
+	}
+	if config.Limit <= 0 {
+		return nil, errors.New("rate limit limit must be positive")
+	}
+
+	tmpl, err := template.New("rate_limit[key]").Funcs(funcs).Delims("[[", "]]").Parse(config.Key)
+	if err != nil {
+		return nil, newTemplateError("rate_limit[key]", err)
+	}
+
+	rl := &RateLimiter{
+		keyTemplate: tmpl,
+		limit:       config.Limit,
+		window:      time.Minute,
+		now:         time.Now,
+		maxKeys:     defaultRateLimitKeys,
+		counters:    make(map[string]*rateLimitCounter),
+	}
+
+	if config.MaxKeys < 0 {
+		return nil, errors.New("rate limit max_keys must not be negative")
+	}
+	if config.MaxKeys > 0 {
+		rl.maxKeys = config.MaxKeys
+	}
+
+	if config.Window != "" {
+		if rl.window, err = time.ParseDuration(config.Window); err != nil {
+			return nil, fmt.Errorf("invalid rate limit window: %w", err)
+		}
+		if rl.window < time.Second {
+			return nil, errors.New("rate limit window must be at least 1s")
+		}
+	}
+
+	switch config.Store {
+	case "", rateLimitStoreMemory:
+	case rateLimitStoreRedis:
+		if redis == nil {
+			return nil, errors.New("rate limit redis store requires redis configuration")
+		}
+		rl.redis = redis
+	default:
+		return nil, fmt.Errorf("invalid rate limit store %q", config.Store)
+	}
+
+	return rl, nil
+}
+
+// Count increments the counter for the request key and returns the quota for
+// templates. A nil result means the rendered key was empty.
+func (rl *RateLimiter) Count(req *http.Request, ctx *TemplateContext) (map[string]interface{}, error) {
+	templateData := buildTemplateData(ctx, map[string]interface{}{
+		"request": requestTemplateData(req),
+	})
+
+	buf := newTemplateOutput(ctx)
+	err := rl.keyTemplate.Execute(buf, templateData)
+	key := strings.TrimSpace(buf.String())
+	buf.release()
+	if err != nil {
+		return nil, newTemplateError(rl.keyTemplate.Name(), err)
+	}
+	if key == "" {
+		return nil, nil
+	}
+
+	windowSeconds := int64(rl.window / time.Second)
+	windowStart := rl.now().Unix() / windowSeconds * windowSeconds
+
+	var count int64
+	if rl.redis != nil {
+		count, err = rl.incrementRedis(key, windowStart)
+	} else {
+		count = rl.incrementMemory(key, windowStart)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := rl.limit - count
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return map[string]interface{}{
+		"key":       key,
+		"limit":     rl.limit,
+		"count":     count,
+		"remaining": remaining,
+		"reset":     windowStart + windowSeconds,
+		"exceeded":  count > rl.limit,
+	}, nil
+}
+
+// incrementMemory increments the in-memory counter for the current window.
+// Counters of past windows are dropped when a window starts; once max_keys
+// keys are counted in a window, further keys are reported over their limit
+// rather than evicting the counters of other keys.
+func (rl *RateLimiter) incrementMemory(key string, windowStart int64) int64 {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if windowStart != rl.sweptWindow {
+		for k, c := range rl.counters {
+			if c.windowStart != windowStart {
+				delete(rl.counters, k)
+			}
+		}
+		rl.sweptWindow = windowStart
+	}
+
+	counter, exists := rl.counters[key]
+	if !exists {
+		if len(rl.counters) >= rl.maxKeys {
+			return rl.limit + 1
+		}
+		counter = &rateLimitCounter{windowStart: windowStart}
+		rl.counters[key] = counter
+	}
+	if counter.windowStart != windowStart {
+		counter.windowStart = windowStart
+		counter.count = 0
+	}
+
+	counter.count++
+	return counter.count
+}
+
+// incrementRedis increments the shared counter for the current window,
+// setting its expiry when the window starts
+func (rl *RateLimiter) incrementRedis(key string, windowStart int64) (int64, error) {
+	redisKey := "ratelimit:" + key + ":" + strconv.FormatInt(windowStart, 10)
+
+	reply, err := rl.redis.Do("INCR", redisKey)
+	if err != nil {
+		return 0, err
+	}
+	count, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected INCR reply %v", reply)
+	}
+
+	if count == 1 {
+		ttl := strconv.FormatInt(int64(rl.window/time.Millisecond), 10)
+		if _, err := rl.redis.Do("PEXPIRE", redisKey, ttl); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,103 @@
+package traefik_modifier_plugin
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hukumonline-com/traefik-modifier-plugin/pkg"
+)
+
+func TestRateLimiter_CountMemory(t *testing.T) {
+	rl, err := NewRateLimiter(&RateLimitConfig{
+		Key:    `[[ index .request.headers "x-api-key" ]]`,
+		Limit:  2,
+		Window: "1m",
+	}, pkg.SimpleFuncMap(), nil)
+	if err != nil {
+		t.Fatalf("NewRateLimiter() error = %v", err)
+	}
+	now := time.Unix(1700000010, 0)
+	rl.now = func() time.Time { return now }
+
+	count := func(apiKey string) map[string]interface{} {
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		if apiKey != "" {
+			req.Header.Set("X-Api-Key", apiKey)
+		}
+		quota, err := rl.Count(req, &TemplateContext{})
+		if err != nil {
+			t.Fatalf("Count() error = %v", err)
+		}
+		return quota
+	}
+
+	count("a")
+	quota := count("a")
+	if quota["remaining"] != int64(0) || quota["exceeded"] != false || quota["reset"] != int64(1700000040) {
+		t.Errorf("Unexpected quota %v", quota)
+	}
+	if quota := count("a"); quota["remaining"] != int64(0) || quota["exceeded"] != true {
+		t.Errorf("Expected exceeded quota, got %v", quota)
+	}
+	if quota := count("b"); quota["count"] != int64(1) {
+		t.Errorf("Expected separate counter per key, got %v", quota)
+	}
+	if quota := count(""); quota != nil {
+		t.Errorf("Expected empty key not to be counted, got %v", quota)
+	}
+
+	// A new window resets the counter
+	now = now.Add(time.Minute)
+	if quota := count("a"); quota["count"] != int64(1) {
+		t.Errorf("Expected counter reset, got %v", quota)
+	}
+}
+
+func TestRateLimiter_MemoryStoreIsBounded(t *testing.T) {
+	rl, err := NewRateLimiter(&RateLimitConfig{
+		Key:     `[[ index .request.headers "x-api-key" ]]`,
+		Limit:   5,
+		MaxKeys: 3,
+	}, pkg.SimpleFuncMap(), nil)
+	if err != nil {
+		t.Fatalf("NewRateLimiter() error = %v", err)
+	}
+	now := time.Unix(1700000010, 0)
+	rl.now = func() time.Time { return now }
+
+	count := func(apiKey string) map[string]interface{} {
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		req.Header.Set("X-Api-Key", apiKey)
+		quota, err := rl.Count(req, &TemplateContext{})
+		if err != nil {
+			t.Fatalf("Count() error = %v", err)
+		}
+		return quota
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		count(key)
+	}
+
+	// Keys past the cap are reported exceeded, known keys keep counting
+	if quota := count("d"); quota["exceeded"] != true || quota["remaining"] != int64(0) {
+		t.Errorf("Expected a new key past max_keys to be exceeded, got %v", quota)
+	}
+	if quota := count("a"); quota["count"] != int64(2) {
+		t.Errorf("Expected existing counters to be kept, got %v", quota)
+	}
+	if len(rl.counters) != 3 {
+		t.Errorf("Expected 3 counters, got %d", len(rl.counters))
+	}
+
+	// Counters of past windows are dropped when a window starts
+	now = now.Add(time.Minute)
+	if quota := count("d"); quota["count"] != int64(1) || len(rl.counters) != 1 {
+		t.Errorf("Expected past windows to be swept, got %v with %d counters", quota, len(rl.counters))
+	}
+
+	if _, err := NewRateLimiter(&RateLimitConfig{Key: "k", Limit: 1, MaxKeys: -1}, pkg.SimpleFuncMap(), nil); err == nil {
+		t.Errorf("Expected a negative max_keys to be rejected")
+	}
+}
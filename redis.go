@@ -0,0 +1,272 @@
+package traefik_modifier_plugin
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// RedisConfig holds the Redis lookup configuration
+type RedisConfig struct {
+	Address  string `json:"address,omitempty"`
+	Password string `json:"password,omitempty"`
+	DB       int    `json:"db,omitempty"`
+	PoolSize int    `json:"pool_size,omitempty"`
+	Timeout  string `json:"timeout,omitempty"`
+	CacheTTL string `json:"cache_ttl,omitempty"`
+	FailOpen bool   `json:"fail_open,omitempty"`
+
+	CacheMaxEntries           int    `json:"cache_max_entries,omitempty"`
+	CacheStaleWhileRevalidate string `json:"cache_stale_while_revalidate,omitempty"`
+}
+
+// RedisClient is a minimal pooled Redis client used by template functions
+type RedisClient struct {
+	address  string
+	password string
+	db       int
+	timeout  time.Duration
+	failOpen bool
+	pool     chan *redisConn
+	cache    *ttlCache
+}
+
+// redisConn is a pooled connection with its buffered reader
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// redisError is an error reply returned by the server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// NewRedisClient creates a new Redis client. Connections are opened lazily.
+func NewRedisClient(config *RedisConfig) (*RedisClient, error) {
+	if config.Address == "" {
+		return nil, errors.New("redis address is required")
+	}
+
+	client := &RedisClient{
+		address:  config.Address,
+		password: config.Password,
+		db:       config.DB,
+		timeout:  time.Second,
+		failOpen: config.FailOpen,
+	}
+
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis timeout: %w", err)
+		}
+		client.timeout = timeout
+	}
+
+	var err error
+	if client.cache, err = newLookupCache("redis", config.CacheTTL, config.CacheMaxEntries, config.CacheStaleWhileRevalidate); err != nil {
+		return nil, err
+	}
+
+	poolSize := config.PoolSize
+	if poolSize <= 0 {
+		poolSize = 10
+	}
+	client.pool = make(chan *redisConn, poolSize)
+
+	return client, nil
+}
+
+// FuncMap returns the Redis template functions
+func (c *RedisClient) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"redisGet":  c.Get,
+		"redisHGet": c.HGet,
+	}
+}
+
+// Get returns the string value of key, or an empty string when it does not exist
+func (c *RedisClient) Get(key string) (string, error) {
+	return c.cachedString("get\x00"+key, "GET", key)
+}
+
+// HGet returns the value of field in the hash stored at key
+func (c *RedisClient) HGet(key, field string) (string, error) {
+	return c.cachedString("hget\x00"+key+"\x00"+field, "HGET", key, field)
+}
+
+// cachedString runs a command returning a bulk string, using the local cache.
+// With fail_open, errors are logged and the lookup returns an empty string.
+func (c *RedisClient) cachedString(cacheKey string, args ...string) (string, error) {
+	value, err := c.cache.Fetch(cacheKey, func() (interface{}, error) {
+		return c.doString(args...)
+	})
+	if err != nil {
+		if c.failOpen {
+			log.Printf("Redis %s failed, continuing without a value: %v", args[0], err)
+			return "", nil
+		}
+		return "", err
+	}
+	return value.(string), nil
+}
+
+// doString runs a command whose reply is a bulk string, integer or nil
+func (c *RedisClient) doString(args ...string) (interface{}, error) {
+	reply, err := c.Do(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := reply.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply type %T for %s", reply, args[0])
+	}
+}
+
+// Do sends a command and returns its reply. The timeout covers the whole
+// call, including dialing and authenticating a new connection.
+func (c *RedisClient) Do(args ...string) (interface{}, error) {
+	deadline := time.Now().Add(c.timeout)
+	conn, err := c.getConn(deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.roundTrip(conn, args, deadline)
+	if err != nil {
+		var replyErr redisError
+		if !errors.As(err, &replyErr) {
+			// Connection state is unknown, do not reuse it
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	c.putConn(conn)
+	return reply, err
+}
+
+// roundTrip writes a command and reads the reply before the deadline
+func (c *RedisClient) roundTrip(conn *redisConn, args []string, deadline time.Time) (interface{}, error) {
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(conn, b.String()); err != nil {
+		return nil, err
+	}
+
+	return readRedisReply(conn.reader)
+}
+
+// getConn returns an idle pooled connection or dials a new one
+func (c *RedisClient) getConn(deadline time.Time) (*redisConn, error) {
+	select {
+	case conn := <-c.pool:
+		return conn, nil
+	default:
+	}
+
+	netConn, err := net.DialTimeout("tcp", c.address, time.Until(deadline))
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	conn := &redisConn{Conn: netConn, reader: bufio.NewReader(netConn)}
+
+	if c.password != "" {
+		if _, err := c.roundTrip(conn, []string{"AUTH", c.password}, deadline); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if c.db > 0 {
+		if _, err := c.roundTrip(conn, []string{"SELECT", strconv.Itoa(c.db)}, deadline); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// putConn returns a connection to the pool, closing it when the pool is full
+func (c *RedisClient) putConn(conn *redisConn) {
+	select {
+	case c.pool <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// readRedisReply parses a single RESP reply
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	payload := line[1 : len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, redisError(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			if items[i], err = readRedisReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unknown reply type %q", line[0])
+	}
+}
@@ -0,0 +1,160 @@
+package traefik_modifier_plugin
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRedis is a tiny RESP server backed by a map
+type fakeRedis struct {
+	listener net.Listener
+	mu       sync.Mutex
+	data     map[string]string
+	hashes   map[string]map[string]string
+	commands []string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	fr := &fakeRedis{
+		listener: listener,
+		data:     map[string]string{},
+		hashes:   map[string]map[string]string{},
+	}
+	go fr.serve()
+	t.Cleanup(func() { listener.Close() })
+	return fr
+}
+
+func (fr *fakeRedis) serve() {
+	for {
+		conn, err := fr.listener.Accept()
+		if err != nil {
+			return
+		}
+		go fr.handle(conn)
+	}
+}
+
+func (fr *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		reply, err := readRedisReply(r)
+		if err != nil {
+			return
+		}
+		items := reply.([]interface{})
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i] = item.(string)
+		}
+
+		fr.mu.Lock()
+		fr.commands = append(fr.commands, strings.Join(args, " "))
+		var out string
+		switch strings.ToUpper(args[0]) {
+		case "AUTH", "SELECT":
+			out = "+OK\r\n"
+		case "GET":
+			if value, ok := fr.data[args[1]]; ok {
+				out = fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+			} else {
+				out = "$-1\r\n"
+			}
+		case "HGET":
+			if value, ok := fr.hashes[args[1]][args[2]]; ok {
+				out = fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+			} else {
+				out = "$-1\r\n"
+			}
+		default:
+			out = "-ERR unknown command\r\n"
+		}
+		fr.mu.Unlock()
+
+		conn.Write([]byte(out))
+	}
+}
+
+func TestRedisClient_GetAndHGet(t *testing.T) {
+	fr := newFakeRedis(t)
+	fr.data["apikey:sk-1"] = "tenant-a"
+	fr.hashes["tenant:tenant-a"] = map[string]string{"plan": "gold"}
+
+	client, err := NewRedisClient(&RedisConfig{
+		Address:  fr.listener.Addr().String(),
+		Password: "secret",
+		DB:       2,
+		CacheTTL: "1m",
+	})
+	if err != nil {
+		t.Fatalf("NewRedisClient() error = %v", err)
+	}
+
+	value, err := client.Get("apikey:sk-1")
+	if err != nil || value != "tenant-a" {
+		t.Fatalf("Get() = %q, %v", value, err)
+	}
+
+	value, err = client.HGet("tenant:tenant-a", "plan")
+	if err != nil || value != "gold" {
+		t.Fatalf("HGet() = %q, %v", value, err)
+	}
+
+	value, err = client.Get("missing")
+	if err != nil || value != "" {
+		t.Fatalf("Get() missing = %q, %v", value, err)
+	}
+
+	// Cached lookups do not reach the server
+	client.Get("apikey:sk-1")
+
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	expected := []string{"AUTH secret", "SELECT 2", "GET apikey:sk-1", "HGET tenant:tenant-a plan", "GET missing"}
+	if strings.Join(fr.commands, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected commands %v, got %v", expected, fr.commands)
+	}
+}
+
+func TestRedisClient_ErrorReply(t *testing.T) {
+	fr := newFakeRedis(t)
+
+	client, err := NewRedisClient(&RedisConfig{Address: fr.listener.Addr().String()})
+	if err != nil {
+		t.Fatalf("NewRedisClient() error = %v", err)
+	}
+
+	if _, err := client.Do("FLUSHALL"); err == nil || err.Error() != "redis: ERR unknown command" {
+		t.Errorf("Expected error reply, got %v", err)
+	}
+}
+
+func TestRedisClient_FailOpen(t *testing.T) {
+	// Reserve an address with nothing listening on it
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	strict, _ := NewRedisClient(&RedisConfig{Address: address, Timeout: "200ms"})
+	if _, err := strict.Get("apikey:abc"); err == nil {
+		t.Error("Expected an error without fail_open")
+	}
+
+	open, _ := NewRedisClient(&RedisConfig{Address: address, Timeout: "200ms", FailOpen: true})
+	value, err := open.Get("apikey:abc")
+	if err != nil || value != "" {
+		t.Errorf("Expected an empty value with fail_open, got %q, %v", value, err)
+	}
+}
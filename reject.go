@@ -0,0 +1,165 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// RejectConfig is a reject rule. When is a template rendered with the
+// request headers, query and body; a request for which it renders true is
+// answered with Status (default 400) and the Response template.
+type RejectConfig struct {
+	Name     string `json:"name,omitempty"`
+	When     string `json:"when,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Response string `json:"response,omitempty"`
+}
+
+// Rejecter stops requests matching a reject rule before they reach the upstream
+type Rejecter struct {
+	rules    []*rejectRule
+	readBody bool
+}
+
+// rejectRule is a reject rule with its parsed templates
+type rejectRule struct {
+	name     string
+	when     *template.Template
+	status   int
+	response *template.Template
+}
+
+// NewRejecter parses the reject rules
+func NewRejecter(configs []*RejectConfig, funcs template.FuncMap) (*Rejecter, error) {
+	r := &Rejecter{}
+	names := make(map[string]bool, len(configs))
+	for i, config := range configs {
+		if config == nil || config.When == "" {
+			return nil, fmt.Errorf("reject[%d]: when is required", i)
+		}
+		rule := &rejectRule{name: config.Name, status: http.StatusBadRequest}
+		if rule.name == "" {
+			rule.name = strconv.Itoa(i)
+		}
+		if names[rule.name] {
+			return nil, fmt.Errorf("duplicate reject rule %q", rule.name)
+		}
+		names[rule.name] = true
+
+		if config.Status != 0 {
+			if config.Status < 400 || config.Status > 499 {
+				return nil, fmt.Errorf("reject %s: status must be 4xx, got %d", rule.name, config.Status)
+			}
+			rule.status = config.Status
+		}
+
+		key := fmt.Sprintf("reject[%s:when]", rule.name)
+		var err error
+		if rule.when, err = template.New(key).Funcs(funcs).Delims("[[", "]]").Parse(config.When); err != nil {
+			return nil, newTemplateError(key, err)
+		}
+		if config.Response != "" {
+			key = fmt.Sprintf("reject[%s:response]", rule.name)
+			if rule.response, err = template.New(key).Funcs(funcs).Delims("[[", "]]").Parse(config.Response); err != nil {
+				return nil, newTemplateError(key, err)
+			}
+		}
+
+		// Only buffer the request body when a condition refers to it
+		if strings.Contains(config.When, ".body") {
+			r.readBody = true
+		}
+		r.rules = append(r.rules, rule)
+	}
+	return r, nil
+}
+
+// Check evaluates the rules in order and answers the request when one
+// matches. Bodies larger than limit are not read and are empty in the
+// conditions. It returns the name of the matching rule, and the names of
+// rules whose condition failed to render, which do not reject.
+func (r *Rejecter) Check(rw http.ResponseWriter, req *http.Request, ctx *TemplateContext, limit int64, errs *pluginErrors) (string, []string) {
+	request := requestTemplateData(req)
+	if r.readBody {
+		request["body"] = peekRequestBody(req, limit)
+	}
+	templateData := buildTemplateData(ctx, map[string]interface{}{"request": request})
+
+	var failed []string
+	for _, rule := range r.rules {
+		buf := newTemplateOutput(ctx)
+		if err := rule.when.Execute(buf, templateData); err != nil {
+			buf.release()
+			err = newTemplateError(rule.when.Name(), err)
+			traceTemplate(ctx, rule.when.Name(), nil, err)
+			requestLog(ctx).warnf("reject", outcomeContinued, "Reject %s error: %v", rule.name, err)
+			failed = append(failed, rule.name)
+			continue
+		}
+		traceTemplate(ctx, rule.when.Name(), buf.Bytes(), nil)
+		reject, _ := strconv.ParseBool(strings.TrimSpace(buf.String()))
+		buf.release()
+		if !reject {
+			continue
+		}
+
+		if rule.response == nil {
+			errs.write(rw, rule.status, http.StatusText(rule.status), nil)
+			return rule.name, failed
+		}
+		templateData["reject"] = map[string]interface{}{
+			"name":   rule.name,
+			"status": rule.status,
+		}
+		writeTemplateResponse(rw, rule.status, rule.response.Name(), rule.response, templateData, errs)
+		return rule.name, failed
+	}
+	return "", failed
+}
+
+// peekRequestBody decodes the JSON or form request body and restores it for
+// the upstream. Compressed bodies and bodies over limit are not decoded.
+func peekRequestBody(req *http.Request, limit int64) interface{} {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	if encoding := req.Header.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return nil
+	}
+	if limit > 0 && req.ContentLength > limit {
+		return nil
+	}
+
+	reader := io.Reader(req.Body)
+	if limit > 0 {
+		reader = io.LimitReader(req.Body, limit+1)
+	}
+	body, err := io.ReadAll(reader)
+	req.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+	if err != nil || (limit > 0 && int64(len(body)) > limit) {
+		return nil
+	}
+
+	if isFormContentType(req.Header.Get("Content-Type")) {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil
+		}
+		return formToMap(values)
+	}
+	var data interface{}
+	if len(body) > 0 && json.Unmarshal(body, &data) != nil {
+		return string(body)
+	}
+	return data
+}
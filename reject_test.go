@@ -0,0 +1,86 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestModifier_Reject(t *testing.T) {
+	config := CreateConfig()
+	config.Reject = []*RejectConfig{
+		{
+			Name:     "tenant",
+			When:     `[[ not (index .request.headers "x-tenant") ]]`,
+			Response: `{"error": "missing tenant", "rule": "[[ .reject.name ]]"}`,
+		},
+		{
+			Name:   "amount",
+			When:   `[[ and .request.body (gt .request.body.amount 1000.0) ]]`,
+			Status: http.StatusUnprocessableEntity,
+		},
+		{
+			Name: "broken",
+			When: `[[ index .request.query.page 5 ]]`,
+		},
+	}
+
+	var upstreamBody string
+	handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		upstreamBody = string(body)
+		rw.WriteHeader(http.StatusOK)
+	}), config, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		tenant string
+		body   string
+		status int
+		output string
+	}{
+		{"missing tenant", "", `{"amount": 10}`, http.StatusBadRequest, `{"error": "missing tenant", "rule": "tenant"}`},
+		{"large amount", "acme", `{"amount": 5000}`, http.StatusUnprocessableEntity, "Unprocessable Entity\n"},
+		{"allowed", "acme", `{"amount": 10}`, http.StatusOK, ""},
+		{"no body", "acme", "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		upstreamBody = ""
+		req := httptest.NewRequest("POST", "/orders?page=1", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		if tt.tenant != "" {
+			req.Header.Set("X-Tenant", tt.tenant)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, rec.Code)
+		}
+		if got := rec.Body.String(); got != tt.output {
+			t.Errorf("%s: expected body %q, got %q", tt.name, tt.output, got)
+		}
+		if tt.status == http.StatusOK && upstreamBody != tt.body {
+			t.Errorf("%s: expected upstream body %q, got %q", tt.name, tt.body, upstreamBody)
+		}
+	}
+}
+
+func TestNewRejecter_Invalid(t *testing.T) {
+	for _, configs := range [][]*RejectConfig{
+		{{Name: "empty"}},
+		{{When: "true", Status: 500}},
+		{{Name: "a", When: "true"}, {Name: "a", When: "false"}},
+		{{When: "[[ if ]]"}},
+	} {
+		if _, err := NewRejecter(configs, nil); err == nil {
+			t.Errorf("Expected error for %+v", configs[0])
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package traefik_modifier_plugin
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/hukumonline-com/traefik-modifier-plugin/pkg"
+)
+
+// Request ID formats
+const (
+	requestIDUUID = "uuid"
+	requestIDULID = "ulid"
+)
+
+// maxRequestIDLength bounds incoming request IDs that are reused
+const maxRequestIDLength = 128
+
+// RequestIDConfig holds the request ID configuration
+type RequestIDConfig struct {
+	Header   string `json:"header,omitempty"`
+	Format   string `json:"format,omitempty"`
+	Response bool   `json:"response,omitempty"`
+}
+
+// RequestIDs reuses or generates the ID of each request
+type RequestIDs struct {
+	header   string
+	generate func() (string, error)
+	response bool
+}
+
+// NewRequestIDs creates a new request ID generator
+func NewRequestIDs(config *RequestIDConfig) (*RequestIDs, error) {
+	r := &RequestIDs{
+		header:   config.Header,
+		response: config.Response,
+	}
+	if r.header == "" {
+		r.header = "X-Request-ID"
+	}
+
+	switch config.Format {
+	case "", requestIDUUID:
+		r.generate = pkg.UUIDv4
+	case requestIDULID:
+		r.generate = pkg.ULID
+	default:
+		return nil, fmt.Errorf("invalid request_id format %q", config.Format)
+	}
+
+	return r, nil
+}
+
+// ModifyRequest returns the ID of req, generating one when the incoming
+// header is absent or malformed, and sets it on the request (and, with
+// response, on the response) header
+func (r *RequestIDs) ModifyRequest(rw http.ResponseWriter, req *http.Request) (string, error) {
+	id := req.Header.Get(r.header)
+	if !validRequestID(id) {
+		var err error
+		if id, err = r.generate(); err != nil {
+			return "", fmt.Errorf("request id generation failed: %w", err)
+		}
+	}
+
+	req.Header.Set(r.header, id)
+	if r.response {
+		rw.Header().Set(r.header, id)
+	}
+	return id, nil
+}
+
+// validRequestID reports whether an incoming ID is safe to reuse: non-empty,
+// bounded and made of visible ASCII characters
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
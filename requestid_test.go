@@ -0,0 +1,69 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+func TestModifier_RequestID(t *testing.T) {
+	config := CreateConfig()
+	config.RequestID = &RequestIDConfig{Format: "ulid", Response: true}
+	config.ModifierHeader = HeaderConfig{"X-Trace": "trace-[[ .context.requestID ]]"}
+
+	var mu sync.Mutex
+	traces := make(map[string]string)
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		traces[req.Header.Get("X-Request-ID")] = req.Header.Get("X-Trace")
+		mu.Unlock()
+	})
+
+	handler, err := New(context.Background(), next, config, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// Incoming IDs are reused
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, req)
+	if traces["abc-123"] != "trace-abc-123" {
+		t.Errorf("Expected trace-abc-123, got %q", traces["abc-123"])
+	}
+	if got := rw.Header().Get("X-Request-ID"); got != "abc-123" {
+		t.Errorf("Expected request ID echoed on the response, got %q", got)
+	}
+
+	// Concurrent requests get their own generated IDs and template context
+	ulidPattern := regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil))
+		}()
+	}
+	wg.Wait()
+
+	if len(traces) != 51 {
+		t.Errorf("Expected 51 distinct request IDs, got %d", len(traces))
+	}
+	for id, trace := range traces {
+		if id != "abc-123" && !ulidPattern.MatchString(id) {
+			t.Errorf("Expected a ULID, got %q", id)
+		}
+		if trace != "trace-"+id {
+			t.Errorf("Expected trace-%s, got %q", id, trace)
+		}
+	}
+
+	if _, err := NewRequestIDs(&RequestIDConfig{Format: "unixtime"}); err == nil {
+		t.Errorf("Expected error for unknown request ID format")
+	}
+}
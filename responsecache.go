@@ -0,0 +1,335 @@
+package traefik_modifier_plugin
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ResponseCacheConfig holds the response cache configuration
+type ResponseCacheConfig struct {
+	Key          string   `json:"key,omitempty"`
+	TTL          string   `json:"ttl,omitempty"`
+	MaxEntries   int      `json:"max_entries,omitempty"`
+	Methods      []string `json:"methods,omitempty"`
+	Statuses     []int    `json:"statuses,omitempty"`
+	Header       string   `json:"header,omitempty"`
+	MaxBodyBytes int64    `json:"max_body_bytes,omitempty"`
+}
+
+const defaultCacheKeyTemplate = "[[ .request.method ]] [[ .request.url ]]"
+
+// defaultCacheMaxBody is the largest response body stored by default
+const defaultCacheMaxBody = 1 << 20
+
+// ResponseCache caches final (modified) responses keyed by a rendered template
+type ResponseCache struct {
+	keyTemplate *template.Template
+	methods     map[string]bool
+	statuses    map[int]bool
+	header      string
+	maxBody     int64
+	cache       *ttlCache
+}
+
+// cachedResponse is a stored response
+type cachedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// varyEntry is stored under the cache key of a response with a Vary
+// header; the response itself is stored under the key extended with the
+// values of the named request headers
+type varyEntry struct {
+	names []string
+}
+
+// cacheRecorder forwards the response to the client while recording it.
+// Streams, upgrades and bodies above maxBody (when set) are forwarded
+// unrecorded.
+type cacheRecorder struct {
+	http.ResponseWriter
+	status  int
+	header  http.Header
+	body    bytes.Buffer
+	maxBody int64
+	skipped bool
+	// request holds the request headers the response was produced for
+	request http.Header
+}
+
+// NewResponseCache creates a new response cache
+func NewResponseCache(config *ResponseCacheConfig, funcs template.FuncMap) (*ResponseCache, error) {
+	keyTemplate := config.Key
+	if keyTemplate == "" {
+		keyTemplate = defaultCacheKeyTemplate
+	}
+
+	tmpl, err := template.New("response_cache[key]").Funcs(funcs).Delims("[[", "]]").Parse(keyTemplate)
+	if err != nil {
+		return nil, newTemplateError("response_cache[key]", err)
+	}
+
+	ttl := time.Minute
+	if config.TTL != "" {
+		if ttl, err = time.ParseDuration(config.TTL); err != nil {
+			return nil, fmt.Errorf("invalid response cache ttl: %w", err)
+		}
+	}
+
+	maxEntries := config.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = 1000
+	}
+
+	if config.MaxBodyBytes < 0 {
+		return nil, errors.New("response cache max_body_bytes must not be negative")
+	}
+	maxBody := config.MaxBodyBytes
+	if maxBody == 0 {
+		maxBody = defaultCacheMaxBody
+	}
+
+	rc := &ResponseCache{
+		keyTemplate: tmpl,
+		methods:     make(map[string]bool),
+		statuses:    make(map[int]bool),
+		header:      config.Header,
+		maxBody:     maxBody,
+		cache:       newTTLCache(ttl, maxEntries),
+	}
+
+	methods := config.Methods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead}
+	}
+	for _, method := range methods {
+		rc.methods[strings.ToUpper(method)] = true
+	}
+
+	statuses := config.Statuses
+	if len(statuses) == 0 {
+		statuses = []int{http.StatusOK}
+	}
+	for _, status := range statuses {
+		rc.statuses[status] = true
+	}
+
+	return rc, nil
+}
+
+// Key renders the cache key for a request. An empty key disables caching.
+func (rc *ResponseCache) Key(req *http.Request, ctx *TemplateContext) (string, error) {
+	if !rc.methods[req.Method] {
+		return "", nil
+	}
+
+	templateData := buildTemplateData(ctx, map[string]interface{}{
+		"request": requestTemplateData(req),
+	})
+
+	buf := newTemplateOutput(ctx)
+	defer buf.release()
+	if err := rc.keyTemplate.Execute(buf, templateData); err != nil {
+		return "", newTemplateError(rc.keyTemplate.Name(), err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// Serve writes the cached response for key and the Vary headers of req and
+// reports whether it was found
+func (rc *ResponseCache) Serve(rw http.ResponseWriter, req *http.Request, key string) bool {
+	value, ok := rc.cache.Get(key)
+	if vary, isVary := value.(*varyEntry); ok && isVary {
+		value, ok = rc.cache.Get(varyKey(key, vary.names, req.Header))
+	}
+	if !ok {
+		return false
+	}
+	cached, ok := value.(*cachedResponse)
+	if !ok {
+		return false
+	}
+
+	for name, values := range cached.header {
+		rw.Header()[name] = append([]string(nil), values...)
+	}
+	if rc.header != "" {
+		rw.Header().Set(rc.header, "HIT")
+	}
+	rw.WriteHeader(cached.status)
+	rw.Write(cached.body)
+	return true
+}
+
+// Recorder wraps rw so the response to req can be stored after it has been
+// served. Upgrade requests are never recorded.
+func (rc *ResponseCache) Recorder(rw http.ResponseWriter, req *http.Request) *cacheRecorder {
+	if rc.header != "" {
+		rw.Header().Set(rc.header, "MISS")
+	}
+	return &cacheRecorder{
+		ResponseWriter: rw,
+		maxBody:        rc.maxBody,
+		skipped:        req.Header.Get("Upgrade") != "",
+		request:        req.Header.Clone(),
+	}
+}
+
+// Store saves a recorded response when its status and headers allow caching.
+// Responses to requests with credentials are only stored when the upstream
+// marks them public, and responses varying on the request are stored per
+// value of the Vary headers.
+func (rc *ResponseCache) Store(key string, recorder *cacheRecorder) {
+	if recorder.skipped || recorder.status == 0 || !rc.statuses[recorder.status] {
+		return
+	}
+
+	directives := cacheControlDirectives(recorder.header)
+	if directives["no-store"] || directives["private"] || recorder.header.Get("Set-Cookie") != "" {
+		return
+	}
+	credentialed := recorder.request.Get("Authorization") != "" || recorder.request.Get("Cookie") != ""
+	if credentialed && !directives["public"] {
+		return
+	}
+
+	vary, ok := varyNames(recorder.header)
+	if !ok {
+		return
+	}
+	if len(vary) > 0 {
+		rc.cache.Set(key, &varyEntry{names: vary})
+		key = varyKey(key, vary, recorder.request)
+	}
+
+	header := recorder.header.Clone()
+	if rc.header != "" {
+		header.Del(rc.header)
+	}
+
+	rc.cache.Set(key, &cachedResponse{
+		status: recorder.status,
+		header: header,
+		body:   append([]byte(nil), recorder.body.Bytes()...),
+	})
+}
+
+// cacheControlDirectives returns the lowercase Cache-Control directive names
+// of header
+func cacheControlDirectives(header http.Header) map[string]bool {
+	directives := make(map[string]bool)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(directive, "=")
+			directives[strings.ToLower(strings.TrimSpace(name))] = true
+		}
+	}
+	return directives
+}
+
+// varyNames returns the canonical request header names a response varies
+// on, including Accept-Encoding for encoded responses. It reports false for
+// Vary: *, which cannot be cached.
+func varyNames(header http.Header) ([]string, bool) {
+	seen := make(map[string]bool)
+	var names []string
+	add := func(name string) {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if strings.TrimSpace(name) == "*" {
+				return nil, false
+			}
+			add(name)
+		}
+	}
+	if header.Get("Content-Encoding") != "" {
+		add("Accept-Encoding")
+	}
+	sort.Strings(names)
+	return names, true
+}
+
+// varyKey extends key with the values of the named request headers
+func varyKey(key string, names []string, header http.Header) string {
+	var b strings.Builder
+	b.WriteString(key)
+	for _, name := range names {
+		b.WriteString("\n")
+		b.WriteString(name)
+		b.WriteString(": ")
+		b.WriteString(strings.Join(header.Values(name), ", "))
+	}
+	return b.String()
+}
+
+func (cr *cacheRecorder) WriteHeader(statusCode int) {
+	if cr.status == 0 {
+		cr.status = statusCode
+		cr.header = cr.ResponseWriter.Header().Clone()
+
+		mediaType, _, _ := mime.ParseMediaType(cr.header.Get("Content-Type"))
+		length, err := strconv.ParseInt(cr.header.Get("Content-Length"), 10, 64)
+		if mediaType == "text/event-stream" || (cr.maxBody > 0 && err == nil && length > cr.maxBody) {
+			cr.skip()
+		}
+	}
+	cr.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (cr *cacheRecorder) Write(b []byte) (int, error) {
+	if cr.status == 0 {
+		cr.WriteHeader(http.StatusOK)
+	}
+	if !cr.skipped {
+		if cr.maxBody > 0 && int64(cr.body.Len()+len(b)) > cr.maxBody {
+			cr.skip()
+		} else {
+			cr.body.Write(b)
+		}
+	}
+	return cr.ResponseWriter.Write(b)
+}
+
+// skip stops recording and drops what was recorded so far
+func (cr *cacheRecorder) skip() {
+	cr.skipped = true
+	cr.body = bytes.Buffer{}
+}
+
+// Flush forwards flushes of streamed responses
+func (cr *cacheRecorder) Flush() {
+	if cr.status == 0 {
+		cr.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := cr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack forwards connection upgrades. Hijacked responses are not stored.
+func (cr *cacheRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := cr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	cr.skip()
+	return hijacker.Hijack()
+}
@@ -0,0 +1,255 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// RetryConfig holds the retry policy for transient upstream failures.
+// Statuses are status codes, classes (5xx) or ranges (500-599).
+type RetryConfig struct {
+	Count          int      `json:"count,omitempty"`
+	Backoff        string   `json:"backoff,omitempty"`
+	MaxBackoff     string   `json:"max_backoff,omitempty"`
+	Statuses       []string `json:"statuses,omitempty"`
+	IdempotentOnly bool     `json:"idempotent_only,omitempty"`
+}
+
+// Retrier re-invokes the upstream with a fresh copy of the request body
+// while it answers with a retryable status
+type Retrier struct {
+	count          int
+	backoff        time.Duration
+	maxBackoff     time.Duration
+	statuses       []statusRange
+	idempotentOnly bool
+	sleep          func(req *http.Request, d time.Duration) bool
+}
+
+// defaultRetryMaxBody is the largest request body buffered for retries when
+// no request body limit is configured
+const defaultRetryMaxBody = 1 << 20
+
+// idempotentMethods are the methods retried with idempotent_only
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// NewRetrier creates a retry policy. It defaults to 2 retries of 502, 503
+// and 504 with a 100ms backoff doubled per retry up to 2s.
+func NewRetrier(config *RetryConfig) (*Retrier, error) {
+	r := &Retrier{
+		count:          2,
+		backoff:        100 * time.Millisecond,
+		maxBackoff:     2 * time.Second,
+		idempotentOnly: config.IdempotentOnly,
+		sleep:          sleepContext,
+	}
+
+	if config.Count < 0 {
+		return nil, fmt.Errorf("invalid retry count %d", config.Count)
+	}
+	if config.Count > 0 {
+		r.count = config.Count
+	}
+	if config.Backoff != "" {
+		backoff, err := time.ParseDuration(config.Backoff)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry backoff: %w", err)
+		}
+		r.backoff = backoff
+	}
+	if config.MaxBackoff != "" {
+		maxBackoff, err := time.ParseDuration(config.MaxBackoff)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry max_backoff: %w", err)
+		}
+		r.maxBackoff = maxBackoff
+	}
+
+	statuses := config.Statuses
+	if len(statuses) == 0 {
+		statuses = []string{"502", "503", "504"}
+	}
+	for _, key := range statuses {
+		low, high, ok := parseStatusKey(key)
+		if !ok {
+			return nil, fmt.Errorf("invalid retry status %q: expected a status code, class such as 5xx or range such as 500-599", key)
+		}
+		r.statuses = append(r.statuses, statusRange{key: key, low: low, high: high})
+	}
+
+	return r, nil
+}
+
+// retryable reports whether status is one of the retry statuses
+func (r *Retrier) retryable(status int) bool {
+	for _, s := range r.statuses {
+		if status >= s.low && status <= s.high {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler wraps next so retryable responses are discarded and the request
+// is sent again. Request bodies larger than limit (defaultRetryMaxBody when
+// not positive), upgrade requests and, with idempotent_only, non-idempotent
+// methods are sent once. onRetry is called with the number of retries when
+// there were any.
+func (r *Retrier) Handler(next http.Handler, limit int64, onRetry func(int)) http.Handler {
+	if limit <= 0 {
+		limit = defaultRetryMaxBody
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if (r.idempotentOnly && !idempotentMethods[req.Method]) || req.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		body, ok := bufferRequestBody(req, limit)
+		if !ok {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		backoff := r.backoff
+		retries := 0
+		for ; retries < r.count; retries++ {
+			if body != nil {
+				req.Body = io.NopCloser(bytes.NewReader(body))
+			}
+			rrw := &retryResponseWriter{ResponseWriter: rw, header: rw.Header().Clone(), retryable: r.retryable}
+			next.ServeHTTP(rrw, req)
+			if !rrw.discard {
+				if !rrw.wroteHeader {
+					rrw.WriteHeader(http.StatusOK)
+				}
+				break
+			}
+
+			if !r.sleep(req, backoff) {
+				// The client went away, report the discarded response status
+				rrw.commit(rrw.status)
+				break
+			}
+			if backoff *= 2; backoff > r.maxBackoff {
+				backoff = r.maxBackoff
+			}
+		}
+
+		// The last attempt is written straight to the client
+		if retries == r.count {
+			if body != nil {
+				req.Body = io.NopCloser(bytes.NewReader(body))
+			}
+			next.ServeHTTP(rw, req)
+		}
+
+		if retries > 0 && onRetry != nil {
+			onRetry(retries)
+		}
+	})
+}
+
+// bufferRequestBody reads the request body so it can be replayed. It
+// returns false, with the body restored, when it is larger than limit.
+func bufferRequestBody(req *http.Request, limit int64) ([]byte, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true
+	}
+	if limit > 0 && req.ContentLength > limit {
+		return nil, false
+	}
+
+	reader := io.Reader(req.Body)
+	if limit > 0 {
+		reader = io.LimitReader(req.Body, limit+1)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil || (limit > 0 && int64(len(body)) > limit) {
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+		return nil, false
+	}
+	req.Body.Close()
+	return body, true
+}
+
+// sleepContext waits for d, returning false when the request is canceled
+func sleepContext(req *http.Request, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-req.Context().Done():
+		return false
+	}
+}
+
+// retryResponseWriter holds the headers of an attempt and discards the
+// response when its status is retryable
+type retryResponseWriter struct {
+	http.ResponseWriter
+	header      http.Header
+	retryable   func(int) bool
+	status      int
+	wroteHeader bool
+	discard     bool
+}
+
+func (rw *retryResponseWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *retryResponseWriter) WriteHeader(statusCode int) {
+	if rw.wroteHeader || statusCode < http.StatusOK {
+		// Informational responses of an attempt are not forwarded
+		return
+	}
+	rw.wroteHeader = true
+	rw.status = statusCode
+	if rw.retryable(statusCode) {
+		rw.discard = true
+		return
+	}
+	rw.commit(statusCode)
+}
+
+// commit replaces the client headers with the attempt headers and writes
+// the status line
+func (rw *retryResponseWriter) commit(statusCode int) {
+	rw.discard = false
+	replaceHeader(rw.ResponseWriter.Header(), rw.header)
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rw *retryResponseWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if rw.discard {
+		return len(b), nil
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+// Flush forwards flushes of committed responses
+func (rw *retryResponseWriter) Flush() {
+	if rw.wroteHeader && !rw.discard {
+		if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestModifier_Retry(t *testing.T) {
+	config := CreateConfig()
+	config.Retry = &RetryConfig{Count: 2, Backoff: "1ms"}
+	config.ModifierRequest = `{"name": "[[ .request.api.body.name ]]", "retried": true}`
+
+	var attempts int
+	var bodies []string
+	failures := 0
+	handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		attempts++
+		body, _ := io.ReadAll(req.Body)
+		bodies = append(bodies, string(body))
+		if attempts <= failures {
+			rw.Header().Set("X-Attempt-Failed", "yes")
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(rw, "unavailable")
+			return
+		}
+		rw.Header().Set("X-Attempt", "ok")
+		rw.WriteHeader(http.StatusCreated)
+		io.WriteString(rw, "created")
+	}), config, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		failures int
+		attempts int
+		status   int
+		body     string
+	}{
+		{0, 1, http.StatusCreated, "created"},
+		{2, 3, http.StatusCreated, "created"},
+		{5, 3, http.StatusServiceUnavailable, "unavailable"},
+	}
+	for _, tt := range tests {
+		attempts, bodies, failures = 0, nil, tt.failures
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", "/orders", strings.NewReader(`{"name": "book"}`)))
+
+		if attempts != tt.attempts {
+			t.Errorf("Expected %d attempts for %d failures, got %d", tt.attempts, tt.failures, attempts)
+		}
+		if rec.Code != tt.status || rec.Body.String() != tt.body {
+			t.Errorf("Expected %d %q for %d failures, got %d %q", tt.status, tt.body, tt.failures, rec.Code, rec.Body.String())
+		}
+		for i, body := range bodies {
+			if body != `{"name": "book", "retried": true}` {
+				t.Errorf("Expected the modified body on attempt %d, got %s", i+1, body)
+			}
+		}
+		if tt.status == http.StatusCreated && rec.Header().Get("X-Attempt-Failed") != "" {
+			t.Errorf("Expected headers of failed attempts to be discarded")
+		}
+	}
+}
+
+func TestModifier_RetryIdempotentOnly(t *testing.T) {
+	config := CreateConfig()
+	config.Retry = &RetryConfig{Backoff: "1ms", IdempotentOnly: true, Statuses: []string{"5xx"}}
+
+	var attempts int
+	handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		attempts++
+		rw.WriteHeader(http.StatusInternalServerError)
+	}), config, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	for method, expected := range map[string]int{"POST": 1, "GET": 3} {
+		attempts = 0
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/orders", nil))
+		if attempts != expected {
+			t.Errorf("Expected %d attempts for %s, got %d", expected, method, attempts)
+		}
+	}
+}
+
+func TestRetrier_DefaultBodyCap(t *testing.T) {
+	r, err := NewRetrier(&RetryConfig{Count: 2, Backoff: "1ms"})
+	if err != nil {
+		t.Fatalf("NewRetrier() error = %v", err)
+	}
+
+	var attempts int
+	var received []int
+	handler := r.Handler(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		attempts++
+		body, _ := io.ReadAll(req.Body)
+		received = append(received, len(body))
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}), 0, nil)
+
+	// Without a request limit, bodies up to the default cap are retried
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/orders", strings.NewReader("small")))
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts for a small body, got %d", attempts)
+	}
+
+	// Larger bodies are sent once, in full
+	attempts, received = 0, nil
+	large := strings.Repeat("x", defaultRetryMaxBody+1)
+	req := httptest.NewRequest("POST", "/orders", strings.NewReader(large))
+	req.ContentLength = -1
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if attempts != 1 || received[0] != len(large) {
+		t.Errorf("Expected one attempt with the full body, got %d attempts %v", attempts, received)
+	}
+}
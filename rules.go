@@ -0,0 +1,177 @@
+package traefik_modifier_plugin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Rule evaluation modes
+const (
+	rulesFirst = "first"
+	rulesMerge = "merge"
+)
+
+// RuleConfig is a rule block: match conditions plus the templates applied
+// over the base configuration when they match
+type RuleConfig struct {
+	Name             string            `json:"name,omitempty"`
+	Match            *MatchConfig      `json:"match,omitempty"`
+	ModifierRequest  string            `json:"modifier_request,omitempty"`
+	ModifierResponse map[string]string `json:"modifier_response,omitempty"`
+	ModifierQuery    *QueryConfig      `json:"modifier_query,omitempty"`
+	ModifierHeader   HeaderConfig      `json:"modifier_header,omitempty"`
+}
+
+// Rules selects the modifiers of the rule blocks matching a request. With
+// first, the first matching rule applies; with merge, every matching rule
+// is merged in order, later rules overriding earlier ones per key.
+type Rules struct {
+	mode     string
+	rules    []*rule
+	base     *Config
+	funcs    template.FuncMap
+	mu       sync.Mutex
+	resolved map[string]*tenantModifiers
+}
+
+// rule is a rule block with its compiled matcher
+type rule struct {
+	name    string
+	matcher *RequestMatcher
+	overlay *TenantOverlay
+}
+
+// NewRules compiles the rule blocks. The modifiers of each single rule are
+// built at startup, so template errors surface early; merged combinations
+// are built on first use.
+func NewRules(configs []*RuleConfig, mode string, base *Config, funcs template.FuncMap) (*Rules, error) {
+	switch mode {
+	case "":
+		mode = rulesFirst
+	case rulesFirst, rulesMerge:
+	default:
+		return nil, fmt.Errorf("invalid rules_mode %q", mode)
+	}
+
+	r := &Rules{
+		mode:     mode,
+		base:     base,
+		funcs:    funcs,
+		resolved: make(map[string]*tenantModifiers),
+	}
+	names := make(map[string]bool, len(configs))
+	for i, config := range configs {
+		if config == nil {
+			return nil, errors.New("rules entries must not be empty")
+		}
+		name := config.Name
+		if name == "" {
+			name = fmt.Sprintf("%d", i)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("duplicate rule name %q", name)
+		}
+		names[name] = true
+
+		matcher, err := NewRequestMatcher(matchOrEmpty(config.Match))
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", name, err)
+		}
+		overlay := &TenantOverlay{
+			ModifierRequest:  config.ModifierRequest,
+			ModifierResponse: config.ModifierResponse,
+			ModifierQuery:    config.ModifierQuery,
+			ModifierHeader:   config.ModifierHeader,
+		}
+		modifiers, err := mergeTenantOverlay(base, overlay, funcs)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", name, err)
+		}
+		r.resolved[name] = modifiers
+		r.rules = append(r.rules, &rule{name: name, matcher: matcher, overlay: overlay})
+	}
+
+	return r, nil
+}
+
+// matchOrEmpty returns config, or an empty config matching every request
+func matchOrEmpty(config *MatchConfig) *MatchConfig {
+	if config == nil {
+		return &MatchConfig{}
+	}
+	return config
+}
+
+// Resolve returns the names of the rules applied to req and their
+// modifiers, or nil modifiers when no rule matches
+func (r *Rules) Resolve(req *http.Request) ([]string, *tenantModifiers, error) {
+	var matched []*rule
+	for _, rl := range r.rules {
+		if rl.matcher.Match(req) {
+			matched = append(matched, rl)
+			if r.mode == rulesFirst {
+				break
+			}
+		}
+	}
+	if len(matched) == 0 {
+		return nil, nil, nil
+	}
+
+	names := make([]string, len(matched))
+	for i, rl := range matched {
+		names[i] = rl.name
+	}
+	key := strings.Join(names, "\x00")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if modifiers, exists := r.resolved[key]; exists {
+		return names, modifiers, nil
+	}
+
+	merged := &TenantOverlay{}
+	for _, rl := range matched {
+		merged = mergeOverlays(merged, rl.overlay)
+	}
+	modifiers, err := mergeTenantOverlay(r.base, merged, r.funcs)
+	if err != nil {
+		return names, nil, err
+	}
+	r.resolved[key] = modifiers
+	return names, modifiers, nil
+}
+
+// mergeOverlays merges b over a: templates are merged per key, query remove
+// and allow lists are combined and a request template in b replaces a's
+func mergeOverlays(a, b *TenantOverlay) *TenantOverlay {
+	merged := &TenantOverlay{
+		ModifierRequest:  a.ModifierRequest,
+		ModifierResponse: make(map[string]string),
+		ModifierQuery:    &QueryConfig{Transform: make(map[string]string)},
+		ModifierHeader:   make(HeaderConfig),
+	}
+	if b.ModifierRequest != "" {
+		merged.ModifierRequest = b.ModifierRequest
+	}
+	for _, overlay := range []*TenantOverlay{a, b} {
+		for status, tmpl := range overlay.ModifierResponse {
+			merged.ModifierResponse[status] = tmpl
+		}
+		for name, tmpl := range overlay.ModifierHeader {
+			merged.ModifierHeader[name] = tmpl
+		}
+		if q := overlay.ModifierQuery; q != nil {
+			for name, tmpl := range q.Transform {
+				merged.ModifierQuery.Transform[name] = tmpl
+			}
+			merged.ModifierQuery.Remove = append(merged.ModifierQuery.Remove, q.Remove...)
+			merged.ModifierQuery.Allow = append(merged.ModifierQuery.Allow, q.Allow...)
+		}
+	}
+	return merged
+}
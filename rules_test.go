@@ -0,0 +1,80 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestModifier_Rules(t *testing.T) {
+	newHandler := func(mode string) http.Handler {
+		config := CreateConfig()
+		config.ModifierHeader = HeaderConfig{"X-Version": "base"}
+		config.RulesMode = mode
+		config.Rules = []*RuleConfig{
+			{
+				Name:           "orders",
+				Match:          &MatchConfig{Path: "^/orders"},
+				ModifierHeader: HeaderConfig{"X-Version": "orders", "X-Orders": "yes"},
+				ModifierResponse: map[string]string{
+					"200": `{"orders": [[ toJSON .response.body ]]}`,
+				},
+			},
+			{
+				Name:           "writes",
+				Match:          &MatchConfig{Methods: []string{"POST"}},
+				ModifierHeader: HeaderConfig{"X-Version": "writes"},
+			},
+		}
+
+		handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Header().Set("X-Seen-Version", req.Header.Get("X-Version"))
+			rw.Header().Set("X-Seen-Orders", req.Header.Get("X-Orders"))
+			io.WriteString(rw, `{"id": 1}`)
+		}), config, "test")
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		return handler
+	}
+
+	tests := []struct {
+		mode    string
+		method  string
+		path    string
+		version string
+		orders  string
+		body    string
+	}{
+		{"", "GET", "/orders", "orders", "yes", `{"orders": {"id":1}}`},
+		{"", "POST", "/orders", "orders", "yes", `{"orders": {"id":1}}`},
+		{"", "POST", "/users", "writes", "", `{"id": 1}`},
+		{"", "GET", "/users", "base", "", `{"id": 1}`},
+		{"merge", "POST", "/orders", "writes", "yes", `{"orders": {"id":1}}`},
+		{"merge", "GET", "/orders", "orders", "yes", `{"orders": {"id":1}}`},
+	}
+	handlers := map[string]http.Handler{"": newHandler(""), "merge": newHandler("merge")}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handlers[tt.mode].ServeHTTP(rec, httptest.NewRequest(tt.method, "http://example.com"+tt.path, nil))
+
+		if got := rec.Header().Get("X-Seen-Version"); got != tt.version {
+			t.Errorf("%s %s %s: expected X-Version %q, got %q", tt.mode, tt.method, tt.path, tt.version, got)
+		}
+		if got := rec.Header().Get("X-Seen-Orders"); got != tt.orders {
+			t.Errorf("%s %s %s: expected X-Orders %q, got %q", tt.mode, tt.method, tt.path, tt.orders, got)
+		}
+		if got := rec.Body.String(); got != tt.body {
+			t.Errorf("%s %s %s: expected body %s, got %s", tt.mode, tt.method, tt.path, tt.body, got)
+		}
+	}
+
+	if _, err := NewRules([]*RuleConfig{{Name: "a"}, {Name: "a"}}, "", CreateConfig(), nil); err == nil {
+		t.Errorf("Expected error for duplicate rule names")
+	}
+	if _, err := NewRules([]*RuleConfig{{}}, "all", CreateConfig(), nil); err == nil {
+		t.Errorf("Expected error for invalid rules mode")
+	}
+}
@@ -0,0 +1,284 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/hukumonline-com/traefik-modifier-plugin/pkg"
+)
+
+// ScriptConfig holds the script stage configuration
+type ScriptConfig struct {
+	Request  string `json:"request,omitempty"`
+	Response string `json:"response,omitempty"`
+}
+
+// ScriptStage runs scripts over the request and the final response for
+// transformations that cannot be expressed in templates
+type ScriptStage struct {
+	request  *pkg.Script
+	response *pkg.Script
+}
+
+// scriptResponseWriter buffers the response so the response script can
+// rewrite its status, headers and body
+type scriptResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// NewScriptStage compiles the request and response scripts
+func NewScriptStage(config *ScriptConfig) (*ScriptStage, error) {
+	if config.Request == "" && config.Response == "" {
+		return nil, errors.New("script stage requires a request or response script")
+	}
+
+	ss := &ScriptStage{}
+	if config.Request != "" {
+		script, err := pkg.CompileScript(config.Request)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request script: %w", err)
+		}
+		ss.request = script
+	}
+	if config.Response != "" {
+		script, err := pkg.CompileScript(config.Response)
+		if err != nil {
+			return nil, fmt.Errorf("invalid response script: %w", err)
+		}
+		ss.response = script
+	}
+	return ss, nil
+}
+
+// ModifyRequest runs the request script and applies the changes it made to
+// request.headers, request.query, request.path and request.body
+func (ss *ScriptStage) ModifyRequest(req *http.Request, ctx *TemplateContext) error {
+	if ss.request == nil {
+		return nil
+	}
+
+	body, err := readAndRestoreBody(req, 0)
+	if err != nil {
+		return err
+	}
+
+	request := scriptRequestTable(req, body)
+	originalQuery := scriptEncodeQuery(request["query"])
+	originalBody, _ := scriptEncodeBody(request["body"])
+	vars := buildTemplateData(ctx, map[string]interface{}{"request": request})
+	if err := ss.request.Run(vars); err != nil {
+		return err
+	}
+
+	// Read back the request table, which the script may have replaced
+	if replaced, ok := vars["request"].(map[string]interface{}); ok {
+		request = replaced
+	}
+
+	scriptApplyHeaders(req.Header, request["headers"])
+
+	if query := scriptEncodeQuery(request["query"]); query != originalQuery {
+		req.URL.RawQuery = query
+	}
+	if path, ok := request["path"].(string); ok && path != req.URL.Path {
+		req.URL.Path = path
+		req.URL.RawPath = ""
+	}
+
+	newBody, err := scriptEncodeBody(request["body"])
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(newBody, originalBody) {
+		req.Body = io.NopCloser(bytes.NewReader(newBody))
+		req.ContentLength = int64(len(newBody))
+		req.Header.Set("Content-Length", strconv.Itoa(len(newBody)))
+	}
+	return nil
+}
+
+// ResponseWriter wraps rw so the response script runs when Finish is called.
+// It returns nil when no response script is configured.
+func (ss *ScriptStage) ResponseWriter(rw http.ResponseWriter) *scriptResponseWriter {
+	if ss.response == nil {
+		return nil
+	}
+	return &scriptResponseWriter{ResponseWriter: rw}
+}
+
+// Finish runs the response script over the buffered response and writes the
+// result. The original response is written when the script fails.
+func (ss *ScriptStage) Finish(sw *scriptResponseWriter, req *http.Request, ctx *TemplateContext) error {
+	status := sw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	var body interface{}
+	if err := json.Unmarshal(sw.body.Bytes(), &body); err != nil {
+		body = sw.body.String()
+	}
+
+	originalBody, _ := scriptEncodeBody(body)
+	header := sw.ResponseWriter.Header()
+	response := map[string]interface{}{
+		"status":  float64(status),
+		"headers": convertHeadersTable(header),
+		"body":    body,
+	}
+	vars := buildTemplateData(ctx, map[string]interface{}{
+		"request":  scriptRequestTable(req, nil),
+		"response": response,
+	})
+
+	runErr := ss.response.Run(vars)
+	var newBody []byte
+	if runErr == nil {
+		if replaced, ok := vars["response"].(map[string]interface{}); ok {
+			response = replaced
+		}
+		newBody, runErr = scriptEncodeBody(response["body"])
+	}
+	if runErr != nil {
+		sw.ResponseWriter.WriteHeader(status)
+		sw.ResponseWriter.Write(sw.body.Bytes())
+		return runErr
+	}
+
+	scriptApplyHeaders(header, response["headers"])
+	if newStatus, ok := response["status"].(float64); ok && newStatus >= 100 && newStatus <= 999 {
+		status = int(newStatus)
+	}
+	if bytes.Equal(newBody, originalBody) {
+		newBody = sw.body.Bytes()
+	}
+	header.Set("Content-Length", strconv.Itoa(len(newBody)))
+	sw.ResponseWriter.WriteHeader(status)
+	sw.ResponseWriter.Write(newBody)
+	return nil
+}
+
+func (sw *scriptResponseWriter) WriteHeader(statusCode int) {
+	if sw.status == 0 {
+		sw.status = statusCode
+	}
+}
+
+func (sw *scriptResponseWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.body.Write(b)
+}
+
+// scriptRequestTable builds the request table handed to scripts
+func scriptRequestTable(req *http.Request, body []byte) map[string]interface{} {
+	query := make(map[string]interface{})
+	for name, values := range req.URL.Query() {
+		if len(values) > 0 {
+			query[name] = values[0]
+		}
+	}
+
+	var parsedBody interface{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &parsedBody); err != nil {
+			parsedBody = string(body)
+		}
+	}
+
+	return map[string]interface{}{
+		"method":  req.Method,
+		"host":    req.Host,
+		"path":    req.URL.Path,
+		"url":     req.URL.String(),
+		"headers": convertHeadersTable(req.Header),
+		"query":   query,
+		"body":    parsedBody,
+	}
+}
+
+// convertHeadersTable converts headers to a mutable map with lowercase keys
+func convertHeadersTable(header http.Header) map[string]interface{} {
+	table := make(map[string]interface{}, len(header))
+	for name, value := range convertHeaders(header) {
+		table[name] = value
+	}
+	return table
+}
+
+// scriptApplyHeaders makes header match the headers table of a script,
+// removing headers the script deleted
+func scriptApplyHeaders(header http.Header, table interface{}) {
+	headers, ok := table.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	present := make(map[string]bool, len(headers))
+	for name := range headers {
+		present[strings.ToLower(name)] = true
+	}
+	for name := range header {
+		if !present[strings.ToLower(name)] {
+			header.Del(name)
+		}
+	}
+	for name, value := range headers {
+		if value == nil {
+			header.Del(name)
+			continue
+		}
+		if current := header.Get(name); current != scriptString(value) {
+			header.Set(name, scriptString(value))
+		}
+	}
+}
+
+// scriptEncodeQuery encodes the query table of a script
+func scriptEncodeQuery(table interface{}) string {
+	query, _ := table.(map[string]interface{})
+	values := url.Values{}
+	for name, value := range query {
+		if value != nil {
+			values.Set(name, scriptString(value))
+		}
+	}
+	return values.Encode()
+}
+
+// scriptEncodeBody serializes a script body value. Strings are used as is,
+// other values are encoded as JSON and nil means an empty body.
+func scriptEncodeBody(body interface{}) ([]byte, error) {
+	switch b := body.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []byte(b), nil
+	}
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("script: failed to encode body: %w", err)
+	}
+	return encoded, nil
+}
+
+// scriptString formats a script value for headers and query parameters
+func scriptString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,152 @@
+package traefik_modifier_plugin
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretsDirConfig holds the mounted secrets directory configuration. Files
+// maps secret names to individual files, e.g. Docker secrets under
+// /run/secrets, and can be used with or without a directory path.
+type SecretsDirConfig struct {
+	Path            string            `json:"path,omitempty"`
+	Files           map[string]string `json:"files,omitempty"`
+	RefreshInterval string            `json:"refresh_interval,omitempty"`
+	DisableReload   bool              `json:"disable_reload,omitempty"`
+}
+
+// SecretsDirectory loads every file of a directory (e.g. a mounted Kubernetes
+// Secret or ConfigMap) and the mapped files into a map and reloads it when
+// files change
+type SecretsDirectory struct {
+	path            string
+	files           map[string]string
+	refreshInterval time.Duration
+	disableReload   bool
+	now             func() time.Time
+
+	mu        sync.Mutex
+	values    map[string]string
+	modTimes  map[string]time.Time
+	lastCheck time.Time
+}
+
+// NewSecretsDirectory creates a new directory loader and performs the initial load
+func NewSecretsDirectory(config *SecretsDirConfig) (*SecretsDirectory, error) {
+	if config.Path == "" && len(config.Files) == 0 {
+		return nil, fmt.Errorf("secrets directory path or files is required")
+	}
+	for name, path := range config.Files {
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("secret file %s: %w", name, err)
+		}
+	}
+
+	sd := &SecretsDirectory{
+		path:            config.Path,
+		files:           config.Files,
+		refreshInterval: 30 * time.Second,
+		disableReload:   config.DisableReload,
+		now:             time.Now,
+		values:          make(map[string]string),
+		modTimes:        make(map[string]time.Time),
+	}
+
+	if config.RefreshInterval != "" {
+		interval, err := time.ParseDuration(config.RefreshInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secrets refresh_interval: %w", err)
+		}
+		sd.refreshInterval = interval
+	}
+
+	if err := sd.reload(); err != nil {
+		return nil, err
+	}
+	sd.lastCheck = sd.now()
+
+	return sd, nil
+}
+
+// Values returns the current file contents keyed by file or secret name,
+// reloading changed files once the refresh interval has elapsed
+func (sd *SecretsDirectory) Values() map[string]string {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	if now := sd.now(); !sd.disableReload && now.Sub(sd.lastCheck) >= sd.refreshInterval {
+		sd.lastCheck = now
+		if err := sd.reload(); err != nil {
+			log.Printf("Failed to reload secrets directory %s: %v", sd.path, err)
+		}
+	}
+
+	return sd.values
+}
+
+// reload re-reads files whose modification time changed. The values map is
+// replaced rather than mutated so snapshots handed out stay consistent.
+// Mapped files take precedence over directory files of the same name.
+func (sd *SecretsDirectory) reload() error {
+	paths := make(map[string]string, len(sd.files))
+	if sd.path != "" {
+		entries, err := os.ReadDir(sd.path)
+		if err != nil {
+			return fmt.Errorf("failed to read secrets directory: %w", err)
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			// Skip hidden files and the ..data links of Kubernetes volumes
+			if strings.HasPrefix(name, ".") {
+				continue
+			}
+			paths[name] = filepath.Join(sd.path, name)
+		}
+	}
+	for name, path := range sd.files {
+		paths[name] = path
+	}
+
+	values := make(map[string]string, len(paths))
+	modTimes := make(map[string]time.Time, len(paths))
+	changed := false
+
+	for name, fullPath := range paths {
+		info, err := os.Stat(fullPath)
+		if err != nil || info.IsDir() {
+			if _, mapped := sd.files[name]; mapped && err != nil {
+				log.Printf("Failed to read secret file %s: %v", fullPath, err)
+			}
+			continue
+		}
+
+		if previous, exists := sd.modTimes[name]; exists && previous.Equal(info.ModTime()) {
+			values[name] = sd.values[name]
+			modTimes[name] = previous
+			continue
+		}
+
+		content, err := os.ReadFile(fullPath)
+		if err != nil {
+			log.Printf("Failed to read secret file %s: %v", fullPath, err)
+			continue
+		}
+		values[name] = strings.TrimRight(string(content), "\r\n")
+		modTimes[name] = info.ModTime()
+		changed = true
+	}
+
+	if !changed && len(values) == len(sd.values) {
+		return nil
+	}
+
+	sd.values = values
+	sd.modTimes = modTimes
+	log.Printf("Loaded %d secrets", len(values))
+	return nil
+}
@@ -0,0 +1,92 @@
+package traefik_modifier_plugin
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSecretsDirectory_ReloadAndTemplate(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string, modTime time.Time) {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, modTime, modTime)
+	}
+
+	start := time.Unix(1700000000, 0)
+	write("api-key", "sk-one\n", start)
+	write(".hidden", "ignored", start)
+
+	sd, err := NewSecretsDirectory(&SecretsDirConfig{Path: dir, RefreshInterval: "10s"})
+	if err != nil {
+		t.Fatalf("NewSecretsDirectory() error = %v", err)
+	}
+	now := time.Now()
+	sd.now = func() time.Time { return now }
+
+	values := sd.Values()
+	if len(values) != 1 || values["api-key"] != "sk-one" {
+		t.Fatalf("Unexpected secrets: %v", values)
+	}
+
+	// Changes are picked up only after the refresh interval
+	write("api-key", "sk-two", start.Add(time.Minute))
+	if sd.Values()["api-key"] != "sk-one" {
+		t.Errorf("Expected cached value before refresh interval")
+	}
+	now = now.Add(11 * time.Second)
+	if sd.Values()["api-key"] != "sk-two" {
+		t.Errorf("Expected reloaded value after refresh interval")
+	}
+
+	// Secrets are exposed as a top-level template variable
+	hm := NewHeaderModifier(HeaderConfig{
+		"Authorization": `Bearer [[ index .secrets "api-key" ]]`,
+	})
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	ctx := &TemplateContext{}
+	ctx.SetGlobal("secrets", sd.Values())
+	if err := hm.ModifyHeaders(req, ctx); err != nil {
+		t.Fatalf("ModifyHeaders() error = %v", err)
+	}
+	if req.Header.Get("Authorization") != "Bearer sk-two" {
+		t.Errorf("Expected Authorization from secrets, got %q", req.Header.Get("Authorization"))
+	}
+}
+
+func TestSecretsDirectory_Files(t *testing.T) {
+	dir := t.TempDir()
+	tokenPath := filepath.Join(dir, "token")
+	os.WriteFile(tokenPath, []byte("tok-one\n"), 0o600)
+
+	sd, err := NewSecretsDirectory(&SecretsDirConfig{
+		Files:         map[string]string{"upstream_token": tokenPath},
+		DisableReload: true,
+	})
+	if err != nil {
+		t.Fatalf("NewSecretsDirectory() error = %v", err)
+	}
+	now := time.Now()
+	sd.now = func() time.Time { return now }
+	if values := sd.Values(); len(values) != 1 || values["upstream_token"] != "tok-one" {
+		t.Fatalf("Unexpected secrets: %v", values)
+	}
+
+	// With reload disabled the file is only read at startup
+	os.WriteFile(tokenPath, []byte("tok-two"), 0o600)
+	os.Chtimes(tokenPath, now.Add(time.Hour), now.Add(time.Hour))
+	now = now.Add(time.Hour)
+	if sd.Values()["upstream_token"] != "tok-one" {
+		t.Errorf("Expected the startup value with reload disabled")
+	}
+
+	// Missing mapped files fail at startup
+	if _, err := NewSecretsDirectory(&SecretsDirConfig{Files: map[string]string{"x": filepath.Join(dir, "missing")}}); err == nil {
+		t.Error("Expected an error for a missing secret file")
+	}
+}
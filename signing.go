@@ -0,0 +1,278 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Signing modes
+const (
+	signingModeSign   = "sign"
+	signingModeVerify = "verify"
+)
+
+// SigningConfig holds the request signing configuration
+type SigningConfig struct {
+	Mode            string `json:"mode,omitempty"`
+	Secret          string `json:"secret,omitempty"`
+	Algorithm       string `json:"algorithm,omitempty"`
+	TimestampHeader string `json:"timestamp_header,omitempty"`
+	NonceHeader     string `json:"nonce_header,omitempty"`
+	SignatureHeader string `json:"signature_header,omitempty"`
+	MaxSkew         string `json:"max_skew,omitempty"`
+	MaxNonces       int    `json:"max_nonces,omitempty"`
+	MaxBodyBytes    int64  `json:"max_body_bytes,omitempty"`
+}
+
+// RequestSigner signs outgoing requests with timestamp, nonce and HMAC
+// signature headers, or verifies them on inbound requests
+type RequestSigner struct {
+	mode            string
+	secret          []byte
+	newHash         func() hash.Hash
+	timestampHeader string
+	nonceHeader     string
+	signatureHeader string
+	maxSkew         time.Duration
+	maxBody         int64
+	now             func() time.Time
+
+	// nonces remembers verified nonces for twice the allowed skew
+	mu     sync.Mutex
+	nonces *nonceStore
+}
+
+// nonceStore remembers nonces until they expire. Live nonces are never
+// evicted: when the store is full new nonces are refused, so a flood of
+// requests cannot push a captured nonce out and allow its replay.
+type nonceStore struct {
+	ttl        time.Duration
+	maxEntries int
+	expires    map[string]time.Time
+	// order lists the nonces by insertion, which is also expiry order
+	order []string
+}
+
+// errBodyOverLimit is returned by readAndRestoreBody for bodies larger than
+// its limit
+var errBodyOverLimit = errors.New("request body exceeds the size limit")
+
+// errNonceStoreFull rejects requests while the nonce store holds
+// max_nonces live nonces
+var errNonceStoreFull = errors.New("too many requests within the allowed skew")
+
+// newNonceStore creates a store keeping nonces for ttl
+func newNonceStore(ttl time.Duration, maxEntries int) *nonceStore {
+	if maxEntries <= 0 {
+		maxEntries = 100000
+	}
+	return &nonceStore{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		expires:    make(map[string]time.Time),
+	}
+}
+
+// add records nonce at now. It fails for a nonce that is still live and
+// when the store is full of live nonces.
+func (ns *nonceStore) add(nonce string, now time.Time) error {
+	for len(ns.order) > 0 {
+		oldest := ns.order[0]
+		if now.Before(ns.expires[oldest]) {
+			break
+		}
+		delete(ns.expires, oldest)
+		ns.order = ns.order[1:]
+	}
+
+	if _, seen := ns.expires[nonce]; seen {
+		return errors.New("replayed nonce")
+	}
+	if len(ns.expires) >= ns.maxEntries {
+		return errNonceStoreFull
+	}
+	ns.expires[nonce] = now.Add(ns.ttl)
+	ns.order = append(ns.order, nonce)
+	return nil
+}
+
+// NewRequestSigner creates a new request signer or verifier
+func NewRequestSigner(config *SigningConfig) (*RequestSigner, error) {
+	if config.Secret == "" {
+		return nil, errors.New("signing secret is required")
+	}
+
+	rs := &RequestSigner{
+		mode:            signingModeSign,
+		secret:          []byte(config.Secret),
+		newHash:         sha256.New,
+		timestampHeader: "X-Timestamp",
+		nonceHeader:     "X-Nonce",
+		signatureHeader: "X-Signature",
+		maxSkew:         5 * time.Minute,
+		maxBody:         defaultBatchMaxBody,
+		now:             time.Now,
+	}
+
+	switch config.Mode {
+	case "", signingModeSign:
+	case signingModeVerify:
+		rs.mode = signingModeVerify
+	default:
+		return nil, fmt.Errorf("invalid signing mode %q", config.Mode)
+	}
+
+	switch config.Algorithm {
+	case "", "sha256":
+	case "sha512":
+		rs.newHash = sha512.New
+	default:
+		return nil, fmt.Errorf("invalid signing algorithm %q", config.Algorithm)
+	}
+
+	if config.TimestampHeader != "" {
+		rs.timestampHeader = config.TimestampHeader
+	}
+	if config.NonceHeader != "" {
+		rs.nonceHeader = config.NonceHeader
+	}
+	if config.SignatureHeader != "" {
+		rs.signatureHeader = config.SignatureHeader
+	}
+
+	if config.MaxSkew != "" {
+		skew, err := time.ParseDuration(config.MaxSkew)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing max_skew: %w", err)
+		}
+		rs.maxSkew = skew
+	}
+	if config.MaxBodyBytes < 0 {
+		return nil, errors.New("signing max_body_bytes must not be negative")
+	}
+	if config.MaxBodyBytes > 0 {
+		rs.maxBody = config.MaxBodyBytes
+	}
+
+	if rs.mode == signingModeVerify {
+		if rs.maxSkew <= 0 {
+			return nil, errors.New("signing max_skew must be positive")
+		}
+		if config.MaxNonces < 0 {
+			return nil, errors.New("signing max_nonces must not be negative")
+		}
+		rs.nonces = newNonceStore(2*rs.maxSkew, config.MaxNonces)
+	}
+
+	return rs, nil
+}
+
+// Sign adds timestamp, nonce and signature headers over the final request.
+// Bodies larger than max_body_bytes return errBodyOverLimit.
+func (rs *RequestSigner) Sign(req *http.Request) error {
+	body, err := readAndRestoreBody(req, rs.maxBody)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(rs.now().Unix(), 10)
+	nonceValue := hex.EncodeToString(nonce)
+
+	req.Header.Set(rs.timestampHeader, timestamp)
+	req.Header.Set(rs.nonceHeader, nonceValue)
+	req.Header.Set(rs.signatureHeader, rs.signature(req, timestamp, nonceValue, body))
+	return nil
+}
+
+// Verify checks the signature of an inbound request and rejects stale or
+// replayed requests
+func (rs *RequestSigner) Verify(req *http.Request) error {
+	timestamp := req.Header.Get(rs.timestampHeader)
+	nonce := req.Header.Get(rs.nonceHeader)
+	signature := req.Header.Get(rs.signatureHeader)
+	if timestamp == "" || nonce == "" || signature == "" {
+		return errors.New("missing signature headers")
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("invalid timestamp")
+	}
+	skew := rs.now().Sub(time.Unix(seconds, 0))
+	if skew > rs.maxSkew || skew < -rs.maxSkew {
+		return errors.New("timestamp outside allowed skew")
+	}
+
+	body, err := readAndRestoreBody(req, rs.maxBody)
+	if err != nil {
+		return err
+	}
+
+	expected := rs.signature(req, timestamp, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errors.New("invalid signature")
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.nonces.add(nonce, rs.now())
+}
+
+// signature computes the hex HMAC of method, request URI, timestamp, nonce
+// and body hash, separated by newlines
+func (rs *RequestSigner) signature(req *http.Request, timestamp, nonce string, body []byte) string {
+	bodyHash := rs.newHash()
+	bodyHash.Write(body)
+
+	mac := hmac.New(rs.newHash, rs.secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%x", req.Method, req.URL.RequestURI(), timestamp, nonce, bodyHash.Sum(nil))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// readAndRestoreBody reads the request body and replaces it with a fresh
+// reader. A body larger than a positive limit returns errBodyOverLimit with
+// the request body left intact for the upstream.
+func readAndRestoreBody(req *http.Request, limit int64) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if limit > 0 && req.ContentLength > limit {
+		return nil, errBodyOverLimit
+	}
+
+	reader := io.Reader(req.Body)
+	if limit > 0 {
+		reader = io.LimitReader(req.Body, limit+1)
+	}
+	body, err := io.ReadAll(reader)
+	if err == nil && limit > 0 && int64(len(body)) > limit {
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+		return nil, errBodyOverLimit
+	}
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	return body, nil
+}
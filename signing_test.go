@@ -0,0 +1,148 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestSigner_SignAndVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	signer, err := NewRequestSigner(&SigningConfig{Secret: "shared"})
+	if err != nil {
+		t.Fatalf("NewRequestSigner() error = %v", err)
+	}
+	signer.now = func() time.Time { return now }
+
+	verifier, err := NewRequestSigner(&SigningConfig{Mode: "verify", Secret: "shared", MaxSkew: "1m"})
+	if err != nil {
+		t.Fatalf("NewRequestSigner() error = %v", err)
+	}
+	verifier.now = func() time.Time { return now.Add(30 * time.Second) }
+
+	req := httptest.NewRequest("POST", "http://partner.example.com/orders?id=1", strings.NewReader(`{"qty": 1}`))
+	if err := signer.Sign(req); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if req.Header.Get("X-Timestamp") != "1700000000" || len(req.Header.Get("X-Nonce")) != 32 {
+		t.Errorf("Unexpected signing headers %v", req.Header)
+	}
+	if body, _ := io.ReadAll(req.Body); string(body) != `{"qty": 1}` {
+		t.Errorf("Expected body to be restored, got %q", body)
+	}
+
+	verify := func(body string) error {
+		inbound := httptest.NewRequest("POST", "http://gateway.example.com/orders?id=1", strings.NewReader(body))
+		inbound.Header = req.Header.Clone()
+		return verifier.Verify(inbound)
+	}
+
+	if err := verify(`{"qty": 2}`); err == nil || err.Error() != "invalid signature" {
+		t.Errorf("Expected tampered body to fail, got %v", err)
+	}
+	if err := verify(`{"qty": 1}`); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+	if err := verify(`{"qty": 1}`); err == nil || err.Error() != "replayed nonce" {
+		t.Errorf("Expected replay to fail, got %v", err)
+	}
+
+	verifier.now = func() time.Time { return now.Add(2 * time.Minute) }
+	if err := verify(`{"qty": 1}`); err == nil || err.Error() != "timestamp outside allowed skew" {
+		t.Errorf("Expected stale request to fail, got %v", err)
+	}
+}
+
+func TestRequestSigner_FullNonceStoreRejectsInsteadOfEvicting(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	signer, _ := NewRequestSigner(&SigningConfig{Secret: "shared"})
+	signer.now = func() time.Time { return now }
+	verifier, err := NewRequestSigner(&SigningConfig{Mode: "verify", Secret: "shared", MaxSkew: "1m", MaxNonces: 3})
+	if err != nil {
+		t.Fatalf("NewRequestSigner() error = %v", err)
+	}
+	verifier.now = func() time.Time { return now }
+
+	signed := func() *http.Request {
+		req := httptest.NewRequest("POST", "http://gateway.example.com/orders", strings.NewReader(`{"qty": 1}`))
+		if err := signer.Sign(req); err != nil {
+			t.Fatalf("Sign() error = %v", err)
+		}
+		return req
+	}
+	replay := func(req *http.Request) error {
+		inbound := httptest.NewRequest("POST", "http://gateway.example.com/orders", strings.NewReader(`{"qty": 1}`))
+		inbound.Header = req.Header.Clone()
+		return verifier.Verify(inbound)
+	}
+
+	captured := signed()
+	if err := replay(captured); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	// Fill the store so a captured nonce would be evicted by an LRU cache
+	for i := 0; i < 2; i++ {
+		if err := replay(signed()); err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+	}
+	if err := replay(signed()); err == nil || err.Error() != errNonceStoreFull.Error() {
+		t.Errorf("Expected a full store to reject new requests, got %v", err)
+	}
+	if err := replay(captured); err == nil || err.Error() != "replayed nonce" {
+		t.Errorf("Expected the captured request to stay rejected, got %v", err)
+	}
+
+	// Nonces expire after twice the skew, making room again
+	now = now.Add(2*time.Minute + time.Second)
+	if err := replay(signed()); err != nil {
+		t.Errorf("Expected expired nonces to be dropped, got %v", err)
+	}
+}
+
+func TestNewRequestSigner_VerifyRequiresSkew(t *testing.T) {
+	if _, err := NewRequestSigner(&SigningConfig{Mode: "verify", Secret: "shared", MaxSkew: "0s"}); err == nil {
+		t.Errorf("Expected an error for a zero max_skew")
+	}
+}
+
+func TestModifier_SigningBodyLimit(t *testing.T) {
+	signer, err := NewRequestSigner(&SigningConfig{Secret: "shared"})
+	if err != nil {
+		t.Fatalf("NewRequestSigner() error = %v", err)
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		io.Copy(rw, req.Body)
+	})
+
+	for _, mode := range []string{"sign", "verify"} {
+		config := CreateConfig()
+		config.Signing = &SigningConfig{Mode: mode, Secret: "shared", MaxBodyBytes: 16}
+		handler, err := New(context.Background(), next, config, "signing")
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		for body, status := range map[string]int{
+			`{"qty": 1}`:               http.StatusOK,
+			`{"note": "far too long"}`: http.StatusRequestEntityTooLarge,
+		} {
+			req := httptest.NewRequest("POST", "http://gateway.example.com/orders", strings.NewReader(body))
+			signer.Sign(req)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != status {
+				t.Errorf("%s %s: expected status %d, got %d %s", mode, body, status, rec.Code, rec.Body.String())
+			}
+		}
+	}
+
+	if _, err := NewRequestSigner(&SigningConfig{Secret: "shared", MaxBodyBytes: -1}); err == nil {
+		t.Errorf("Expected error for negative max_body_bytes")
+	}
+}
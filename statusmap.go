@@ -0,0 +1,120 @@
+package traefik_modifier_plugin
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+)
+
+// StatusMap rewrites the upstream status code written to the client. Keys
+// are status codes, classes (5xx) or ranges (500-599) like the
+// modifier_response keys; the narrowest matching key wins.
+type StatusMap struct {
+	entries []statusMapping
+}
+
+// statusMapping maps the upstream statuses low..high to status
+type statusMapping struct {
+	key       string
+	low, high int
+	status    int
+}
+
+// NewStatusMap parses the status_map keys and validates the client statuses
+func NewStatusMap(config map[string]int) (*StatusMap, error) {
+	sm := &StatusMap{}
+	for key, status := range config {
+		low, high, ok := parseStatusKey(key)
+		if !ok {
+			return nil, fmt.Errorf("invalid status_map key %q: expected a status code, class such as 5xx or range such as 500-599", key)
+		}
+		if status < 100 || status > 599 {
+			return nil, fmt.Errorf("invalid status_map[%s]: %d is not a valid status code", key, status)
+		}
+		sm.entries = append(sm.entries, statusMapping{key: key, low: low, high: high, status: status})
+	}
+	sort.Slice(sm.entries, func(i, j int) bool {
+		wi := sm.entries[i].high - sm.entries[i].low
+		wj := sm.entries[j].high - sm.entries[j].low
+		if wi != wj {
+			return wi < wj
+		}
+		return sm.entries[i].key < sm.entries[j].key
+	})
+	return sm, nil
+}
+
+// Map returns the client status for the upstream status
+func (sm *StatusMap) Map(status int) int {
+	if sm == nil {
+		return status
+	}
+	for _, e := range sm.entries {
+		if status >= e.low && status <= e.high {
+			return e.status
+		}
+	}
+	return status
+}
+
+// ResponseWriter wraps rw so the status line carries the mapped status.
+// mapped is called once when a status is rewritten.
+func (sm *StatusMap) ResponseWriter(rw http.ResponseWriter, mapped func(from, to int)) http.ResponseWriter {
+	return &statusMapResponseWriter{ResponseWriter: rw, statusMap: sm, mapped: mapped}
+}
+
+// statusMapResponseWriter rewrites the status passed to WriteHeader
+type statusMapResponseWriter struct {
+	http.ResponseWriter
+	statusMap   *StatusMap
+	mapped      func(from, to int)
+	wroteHeader bool
+}
+
+func (sw *statusMapResponseWriter) WriteHeader(statusCode int) {
+	if sw.wroteHeader {
+		return
+	}
+	if statusCode < http.StatusOK {
+		// Informational responses precede the final status
+		sw.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	sw.wroteHeader = true
+	if status := sw.statusMap.Map(statusCode); status != statusCode {
+		if sw.mapped != nil {
+			sw.mapped(statusCode, status)
+		}
+		statusCode = status
+	}
+	sw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (sw *statusMapResponseWriter) Write(b []byte) (int, error) {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+// Flush forwards flushes of streamed responses, writing the mapped status first
+func (sw *statusMapResponseWriter) Flush() {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := sw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack forwards connection upgrades
+func (sw *statusMapResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
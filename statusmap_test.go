@@ -0,0 +1,112 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestModifier_StatusMap(t *testing.T) {
+	config := CreateConfig()
+	config.StatusMap = map[string]int{
+		"500": 502,
+		"404": 200,
+		"4xx": 400,
+	}
+	config.ModifierResponse = map[string]string{
+		"404": `{"items": [], "upstream": [[ .response.body.error | toJSON ]]}`,
+	}
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		status, _ := strconv.Atoi(req.URL.Query().Get("status"))
+		rw.WriteHeader(status)
+		io.WriteString(rw, `{"error": "upstream"}`)
+	}), config, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		upstream int
+		status   int
+		body     string
+	}{
+		{500, 502, `{"error": "upstream"}`},
+		{404, 200, `{"items": [], "upstream": "upstream"}`},
+		{409, 400, `{"error": "upstream"}`},
+		{201, 201, `{"error": "upstream"}`},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/items?status="+strconv.Itoa(tt.upstream), nil))
+		if rec.Code != tt.status {
+			t.Errorf("Expected status %d for upstream %d, got %d", tt.status, tt.upstream, rec.Code)
+		}
+		if got := rec.Body.String(); got != tt.body {
+			t.Errorf("Expected body %s for upstream %d, got %s", tt.body, tt.upstream, got)
+		}
+	}
+}
+
+func TestNewStatusMap_Invalid(t *testing.T) {
+	for _, config := range []map[string]int{
+		{"5yy": 502},
+		{"500": 99},
+		{"500": 600},
+	} {
+		if _, err := NewStatusMap(config); err == nil {
+			t.Errorf("Expected error for %v", config)
+		}
+	}
+}
+
+func TestStatusMap_Streaming(t *testing.T) {
+	sm, err := NewStatusMap(map[string]int{"404": 200})
+	if err != nil {
+		t.Fatalf("NewStatusMap() error = %v", err)
+	}
+
+	// Flushing an event stream sends the status and the events written so far
+	rec := httptest.NewRecorder()
+	sw := sm.ResponseWriter(rec, nil)
+	sw.Header().Set("Content-Type", "text/event-stream")
+	io.WriteString(sw, "data: 1\n\n")
+	sw.(http.Flusher).Flush()
+	if !rec.Flushed || rec.Code != http.StatusOK || rec.Body.String() != "data: 1\n\n" {
+		t.Errorf("Expected a flushed event stream, got flushed=%v %d %q", rec.Flushed, rec.Code, rec.Body.String())
+	}
+
+	// Flushing before any write sends the mapped status
+	rec = httptest.NewRecorder()
+	sw = sm.ResponseWriter(rec, nil)
+	sw.WriteHeader(http.StatusNotFound)
+	sw.(http.Flusher).Flush()
+	if !rec.Flushed || rec.Code != http.StatusOK {
+		t.Errorf("Expected the mapped status to be flushed, got flushed=%v %d", rec.Flushed, rec.Code)
+	}
+}
+
+func TestStatusMap_Hijack(t *testing.T) {
+	sm, err := NewStatusMap(map[string]int{"500": 502})
+	if err != nil {
+		t.Fatalf("NewStatusMap() error = %v", err)
+	}
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	sw := sm.ResponseWriter(&hijackRecorder{ResponseRecorder: httptest.NewRecorder(), conn: server}, nil)
+	conn, _, err := sw.(http.Hijacker).Hijack()
+	if err != nil || conn != server {
+		t.Fatalf("Hijack() = %v, %v", conn, err)
+	}
+
+	if _, _, err := sm.ResponseWriter(httptest.NewRecorder(), nil).(http.Hijacker).Hijack(); err == nil {
+		t.Errorf("Expected an error when the underlying writer cannot be hijacked")
+	}
+}
@@ -0,0 +1,95 @@
+package traefik_modifier_plugin
+
+import (
+	"net/http"
+)
+
+// TemplateContext keys holding data merged into every template
+const (
+	globalsKey     = "\x00globals"
+	requestKey     = "\x00request"
+	debugKey       = "\x00debug"
+	loggerKey      = "\x00logger"
+	tracingKey     = "\x00tracing"
+	outputLimitKey = "\x00outputLimit"
+)
+
+// contextGlobals holds top-level template data such as .secrets
+type contextGlobals map[string]interface{}
+
+// contextRequest holds per-request fields added to .request, such as .request.locale
+type contextRequest map[string]interface{}
+
+// SetGlobal exposes value as a top-level template variable, e.g. .secrets
+func (tc TemplateContext) SetGlobal(name string, value interface{}) {
+	globals, ok := tc[globalsKey].(contextGlobals)
+	if !ok {
+		globals = contextGlobals{}
+		tc[globalsKey] = globals
+	}
+	globals[name] = value
+}
+
+// SetRequestField exposes value as a field of the request data, e.g. .request.locale
+func (tc TemplateContext) SetRequestField(name string, value interface{}) {
+	fields, ok := tc[requestKey].(contextRequest)
+	if !ok {
+		fields = contextRequest{}
+		tc[requestKey] = fields
+	}
+	fields[name] = value
+}
+
+// buildTemplateData adds the context, the top-level globals and the request
+// fields to the template data
+func buildTemplateData(ctx *TemplateContext, data map[string]interface{}) map[string]interface{} {
+	if ctx == nil {
+		return data
+	}
+
+	context := make(TemplateContext, len(*ctx))
+	for key, value := range *ctx {
+		switch key {
+		case globalsKey:
+			for name, global := range value.(contextGlobals) {
+				if _, exists := data[name]; !exists {
+					data[name] = global
+				}
+			}
+		case requestKey:
+			request, ok := data["request"].(map[string]interface{})
+			if !ok {
+				if _, exists := data["request"]; exists {
+					continue
+				}
+				request = map[string]interface{}{}
+				data["request"] = request
+			}
+			for name, field := range value.(contextRequest) {
+				if _, exists := request[name]; !exists {
+					request[name] = field
+				}
+			}
+		case debugKey, loggerKey, tracingKey, outputLimitKey:
+			// The debug trace, logger, spans and output limit of a request are not template data
+		default:
+			context[key] = value
+		}
+	}
+	data["context"] = context
+
+	return data
+}
+
+// requestTemplateData returns the .request data shared by the templates:
+// the headers, query, method, host, URL and path of req
+func requestTemplateData(req *http.Request) map[string]interface{} {
+	return map[string]interface{}{
+		"headers": convertHeaders(req.Header),
+		"query":   queryParamsToMap(req.URL.Query()),
+		"method":  req.Method,
+		"host":    req.Host,
+		"url":     req.URL.String(),
+		"path":    req.URL.Path,
+	}
+}
@@ -0,0 +1,259 @@
+package traefik_modifier_plugin
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// templateFilePrefix marks header template values read from a file, e.g.
+// "file:/etc/traefik/templates/authorization.tmpl"
+const templateFilePrefix = "file:"
+
+// resolveTemplateFiles returns a copy of config with the templates of
+// modifier_request_file, modifier_response_files and file: header values
+// read from disk. A template cannot be set both inline and from a file.
+func resolveTemplateFiles(config *Config) (*Config, error) {
+	if config.ModifierRequestFile == "" && len(config.ModifierResponseFiles) == 0 &&
+		!hasTemplateFiles(config.ModifierHeader) && !hasTemplateFiles(config.ModifierResponseHeader) {
+		return config, nil
+	}
+
+	resolved := *config
+	if config.ModifierRequestFile != "" {
+		if config.ModifierRequest != "" {
+			return nil, errors.New("modifier_request and modifier_request_file cannot both be set")
+		}
+		source, err := readTemplateFile("modifier_request_file", config.ModifierRequestFile)
+		if err != nil {
+			return nil, err
+		}
+		resolved.ModifierRequest = source
+	}
+
+	if len(config.ModifierResponseFiles) > 0 {
+		resolved.ModifierResponse = make(map[string]string, len(config.ModifierResponse)+len(config.ModifierResponseFiles))
+		for key, source := range config.ModifierResponse {
+			resolved.ModifierResponse[key] = source
+		}
+		for _, key := range sortedKeys(config.ModifierResponseFiles) {
+			if _, exists := config.ModifierResponse[key]; exists {
+				return nil, fmt.Errorf("modifier_response[%s] and modifier_response_files[%s] cannot both be set", key, key)
+			}
+			source, err := readTemplateFile(fmt.Sprintf("modifier_response_files[%s]", key), config.ModifierResponseFiles[key])
+			if err != nil {
+				return nil, err
+			}
+			resolved.ModifierResponse[key] = source
+		}
+	}
+
+	var err error
+	if resolved.ModifierHeader, err = resolveHeaderFiles("modifier_header", config.ModifierHeader); err != nil {
+		return nil, err
+	}
+	if resolved.ModifierResponseHeader, err = resolveHeaderFiles("modifier_response_header", config.ModifierResponseHeader); err != nil {
+		return nil, err
+	}
+	return &resolved, nil
+}
+
+// hasTemplateFiles reports whether a header template is read from a file
+func hasTemplateFiles(headers HeaderConfig) bool {
+	for _, value := range headers {
+		if strings.HasPrefix(value, templateFilePrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveHeaderFiles returns a copy of headers with the file: values read
+func resolveHeaderFiles(field string, headers HeaderConfig) (HeaderConfig, error) {
+	if !hasTemplateFiles(headers) {
+		return headers, nil
+	}
+	resolved := make(HeaderConfig, len(headers))
+	for name, value := range headers {
+		if path, ok := strings.CutPrefix(value, templateFilePrefix); ok {
+			source, err := readTemplateFile(fmt.Sprintf("%s[%s]", field, name), path)
+			if err != nil {
+				return nil, err
+			}
+			value = source
+		}
+		resolved[name] = value
+	}
+	return resolved, nil
+}
+
+// readTemplateFile reads the template of the config key field. A single
+// trailing newline is dropped so header templates do not end in one.
+func readTemplateFile(field, path string) (string, error) {
+	data, err := os.ReadFile(strings.TrimSpace(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", field, err)
+	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+// sortedKeys returns the keys of m in order, so reported errors are stable
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// templateReloader re-reads the templates configured as files in the
+// background once the refresh interval has elapsed and swaps in the rebuilt
+// modifiers when a file changed. Requests keep the modifiers they started
+// with.
+type templateReloader struct {
+	config          *Config
+	funcs           template.FuncMap
+	logger          *logger
+	paths           []string
+	refreshInterval time.Duration
+	now             func() time.Time
+
+	// modTimes is only used by refresh, which runs at most once at a time
+	modTimes map[string]time.Time
+
+	mu         sync.Mutex
+	current    *templateModifiers
+	lastCheck  time.Time
+	refreshing bool
+	refreshes  sync.WaitGroup
+}
+
+// newTemplateReloader creates a reloader for the template files of config,
+// the configuration before resolveTemplateFiles, serving current until a
+// file changes
+func newTemplateReloader(config *Config, funcs template.FuncMap, current *templateModifiers, logger *logger) (*templateReloader, error) {
+	interval, err := time.ParseDuration(config.TemplateReloadInterval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template_reload_interval: %w", err)
+	}
+	if interval <= 0 {
+		return nil, errors.New("template_reload_interval must be positive")
+	}
+
+	tr := &templateReloader{
+		config:          config,
+		funcs:           funcs,
+		logger:          logger,
+		paths:           templateFilePaths(config),
+		refreshInterval: interval,
+		now:             time.Now,
+		current:         current,
+	}
+	tr.modTimes = tr.stat()
+	tr.lastCheck = tr.now()
+	return tr, nil
+}
+
+// Templates returns the current modifiers. Once the refresh interval has
+// elapsed the template files are checked in the background, and the current
+// modifiers are served until the rebuilt ones are swapped in. A file that
+// fails to read or parse keeps the previous modifiers in place.
+func (tr *templateReloader) Templates() *templateModifiers {
+	if tr == nil {
+		return nil
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if now := tr.now(); now.Sub(tr.lastCheck) >= tr.refreshInterval && !tr.refreshing {
+		tr.lastCheck = now
+		tr.refreshing = true
+		tr.refreshes.Add(1)
+		go tr.refresh()
+	}
+
+	return tr.current
+}
+
+// refresh checks and rebuilds the template files outside the lock
+func (tr *templateReloader) refresh() {
+	defer tr.refreshes.Done()
+
+	var templates *templateModifiers
+	if modTimes := tr.stat(); changedModTimes(tr.modTimes, modTimes) {
+		tr.modTimes = modTimes
+		var err error
+		if templates, err = tr.reload(); err != nil {
+			tr.logger.forRequest(nil).errorf("templates", outcomeContinued, "Failed to reload template files: %v", err)
+		} else {
+			tr.logger.forRequest(nil).infof("templates", "", "Reloaded template files")
+		}
+	}
+
+	tr.mu.Lock()
+	if templates != nil {
+		tr.current = templates
+	}
+	tr.refreshing = false
+	tr.mu.Unlock()
+}
+
+// reload reads the template files and builds new modifiers
+func (tr *templateReloader) reload() (*templateModifiers, error) {
+	config, err := resolveTemplateFiles(tr.config)
+	if err != nil {
+		return nil, err
+	}
+	return newTemplateModifiers(config, tr.funcs)
+}
+
+// stat returns the modification times of the template files. Files that
+// cannot be read are left out, so they count as changed once restored.
+func (tr *templateReloader) stat() map[string]time.Time {
+	modTimes := make(map[string]time.Time, len(tr.paths))
+	for _, path := range tr.paths {
+		if info, err := os.Stat(path); err == nil {
+			modTimes[path] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+// changedModTimes reports whether a file was added, removed or modified
+func changedModTimes(previous, current map[string]time.Time) bool {
+	if len(previous) != len(current) {
+		return true
+	}
+	for path, modTime := range current {
+		if previousTime, ok := previous[path]; !ok || !previousTime.Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// templateFilePaths returns the paths of the templates configured as files
+func templateFilePaths(config *Config) []string {
+	var paths []string
+	if config.ModifierRequestFile != "" {
+		paths = append(paths, strings.TrimSpace(config.ModifierRequestFile))
+	}
+	for _, key := range sortedKeys(config.ModifierResponseFiles) {
+		paths = append(paths, strings.TrimSpace(config.ModifierResponseFiles[key]))
+	}
+	for _, headers := range []HeaderConfig{config.ModifierHeader, config.ModifierResponseHeader} {
+		for _, value := range headers {
+			if path, ok := strings.CutPrefix(value, templateFilePrefix); ok {
+				paths = append(paths, strings.TrimSpace(path))
+			}
+		}
+	}
+	return paths
+}
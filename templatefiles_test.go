@@ -0,0 +1,154 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestModifier_TemplateFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	config := CreateConfig()
+	config.ModifierRequestFile = write("request.json.tmpl", "{\n  \"name\": \"[[ .request.api.body.name ]]\"\n}\n")
+	config.ModifierResponseFiles = map[string]string{"200": write("ok.json.tmpl", `{"data": [[ toJSON .response.body ]]}`)}
+	config.ModifierResponse = map[string]string{"404": `{"error": "not_found"}`}
+	config.ModifierHeader = HeaderConfig{
+		"Authorization": "file:" + write("authorization.tmpl", "Bearer [[ .request.query.token ]]\n"),
+		"X-Static":      "inline",
+	}
+
+	var authorization, static, body string
+	handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		authorization, static = req.Header.Get("Authorization"), req.Header.Get("X-Static")
+		data, _ := io.ReadAll(req.Body)
+		body = string(data)
+		io.WriteString(rw, `{"id": 1}`)
+	}), config, "files")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/?token=abc", strings.NewReader(`{"name": "book"}`)))
+
+	if authorization != "Bearer abc" || static != "inline" {
+		t.Errorf("Unexpected headers Authorization %q, X-Static %q", authorization, static)
+	}
+	if body != "{\n  \"name\": \"book\"\n}" {
+		t.Errorf("Unexpected request body %s", body)
+	}
+	if rec.Body.String() != `{"data": {"id":1}}` {
+		t.Errorf("Unexpected response %s", rec.Body.String())
+	}
+	if config.ModifierRequest != "" || len(config.ModifierResponse) != 1 {
+		t.Errorf("Expected the configuration to be left unchanged")
+	}
+}
+
+func TestModifier_TemplateFilesErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ok.tmpl")
+	if err := os.WriteFile(path, []byte(`{}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, configure := range map[string]func(*Config){
+		"missing file":    func(c *Config) { c.ModifierRequestFile = path + ".missing" },
+		"inline and file": func(c *Config) { c.ModifierRequest, c.ModifierRequestFile = `{}`, path },
+		"same response key": func(c *Config) {
+			c.ModifierResponse, c.ModifierResponseFiles = map[string]string{"200": `{}`}, map[string]string{"200": path}
+		},
+		"missing header": func(c *Config) { c.ModifierResponseHeader = HeaderConfig{"X-Id": "file:" + path + ".missing"} },
+	} {
+		config := CreateConfig()
+		configure(config)
+		if _, err := New(context.Background(), http.NotFoundHandler(), config, "files"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestModifier_TemplateFilesReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "response.tmpl")
+	modTime := time.Now()
+	write := func(content string) {
+		modTime = modTime.Add(time.Second)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"version": 1}`)
+
+	config := CreateConfig()
+	config.ModifierResponseFiles = map[string]string{"200": path}
+	config.TemplateReloadInterval = "10s"
+	handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		io.WriteString(rw, `{}`)
+	}), config, "reload")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	now := time.Now()
+	reloader := handler.(*modifier).reloader
+	reloader.now = func() time.Time { return now }
+	previous := `{"version": 1}`
+
+	for _, step := range []struct {
+		content  string
+		advance  time.Duration
+		expected string
+	}{
+		{"", 0, `{"version": 1}`},
+		{`{"version": 2}`, time.Second, `{"version": 1}`},
+		{"", 10 * time.Second, `{"version": 2}`},
+		{`{"version": [[ if ]]}`, 10 * time.Second, `{"version": 2}`},
+		{`{"version": 3}`, 10 * time.Second, `{"version": 3}`},
+	} {
+		if step.content != "" {
+			write(step.content)
+		}
+		now = now.Add(step.advance)
+
+		// The first request starts the background check and is served the
+		// previous templates; the next one sees the result of the check
+		trigger := httptest.NewRecorder()
+		handler.ServeHTTP(trigger, httptest.NewRequest("GET", "/", nil))
+		if trigger.Body.String() != previous {
+			t.Errorf("After writing %q: expected the check not to block, got %s", step.content, trigger.Body.String())
+		}
+		reloader.refreshes.Wait()
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		if rec.Body.String() != step.expected {
+			t.Errorf("After writing %q: expected %s, got %s", step.content, step.expected, rec.Body.String())
+		}
+		previous = step.expected
+	}
+}
+
+func TestNewTemplateReloader_Invalid(t *testing.T) {
+	for _, interval := range []string{"soon", "0s", "-1m"} {
+		config := CreateConfig()
+		config.TemplateReloadInterval = interval
+		if _, err := New(context.Background(), http.NotFoundHandler(), config, "reload"); err == nil {
+			t.Errorf("%s: expected an error", interval)
+		}
+	}
+}
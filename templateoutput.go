@@ -0,0 +1,65 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"errors"
+)
+
+// errTemplateOutputLimit aborts a template whose output grows past
+// max_template_output_bytes
+var errTemplateOutputLimit = errors.New("template output exceeds max_template_output_bytes")
+
+// templateOutput collects the output of a template, failing the write that
+// would grow it past the output limit of the request so a runaway template
+// stops executing instead of exhausting memory
+type templateOutput struct {
+	buf   *bytes.Buffer
+	limit int64
+}
+
+// newTemplateOutput returns a pooled template output limited to the
+// max_template_output_bytes stored in ctx, if any. Callers release it once
+// they are done with its contents.
+func newTemplateOutput(ctx *TemplateContext) *templateOutput {
+	to := &templateOutput{buf: getBuffer(0)}
+	if ctx != nil {
+		to.limit, _ = (*ctx)[outputLimitKey].(int64)
+	}
+	return to
+}
+
+// setOutputLimit limits the output of every template of the request to limit
+// bytes; zero leaves it unlimited
+func (tc TemplateContext) setOutputLimit(limit int64) {
+	if limit > 0 {
+		tc[outputLimitKey] = limit
+	}
+}
+
+func (to *templateOutput) Write(p []byte) (int, error) {
+	if to.limit > 0 && int64(to.buf.Len()+len(p)) > to.limit {
+		return 0, errTemplateOutputLimit
+	}
+	return to.buf.Write(p)
+}
+
+// Bytes returns the output written so far
+func (to *templateOutput) Bytes() []byte {
+	return to.buf.Bytes()
+}
+
+// String returns the output written so far as a string
+func (to *templateOutput) String() string {
+	return to.buf.String()
+}
+
+// Reset discards the output so the buffer can hold another template's output
+func (to *templateOutput) Reset() {
+	to.buf.Reset()
+}
+
+// release returns the buffer to the pool; Bytes must not be used afterwards
+func (to *templateOutput) release() {
+	putBuffer(to.buf)
+	to.buf = nil
+}
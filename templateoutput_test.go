@@ -0,0 +1,103 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestModifier_MaxTemplateOutputBytes(t *testing.T) {
+	items := `["` + strings.Repeat("x", 100) + `"` + strings.Repeat(`, "`+strings.Repeat("x", 100)+`"`, 99) + `]`
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		io.WriteString(rw, `{"items": `+items+`}`)
+	})
+
+	for _, tt := range []struct {
+		name     string
+		onError  *OnErrorConfig
+		status   int
+		original bool
+	}{
+		{"reject", nil, http.StatusInternalServerError, false},
+		{"useOriginal", &OnErrorConfig{Response: onErrorUseOriginal}, http.StatusOK, true},
+	} {
+		config := CreateConfig()
+		config.MaxTemplateOutputBytes = 1024
+		config.OnError = tt.onError
+		config.ModifierResponse = map[string]string{"200": `[[ range .response.body.items ]][[ . ]][[ end ]]`}
+		handler, err := New(context.Background(), next, config, "output")
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.name, tt.status, rec.Code, rec.Body.String())
+		}
+		if original := strings.Contains(rec.Body.String(), `"items"`); original != tt.original {
+			t.Errorf("%s: unexpected response %.100s", tt.name, rec.Body.String())
+		}
+	}
+}
+
+func TestModifier_MaxTemplateOutputBytesEverywhere(t *testing.T) {
+	config := CreateConfig()
+	config.MaxTemplateOutputBytes = 64
+	config.Reject = []*RejectConfig{
+		{Name: "flood", When: `[[ if .request.query.flood ]][[ range .request.query.flood ]]xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx[[ end ]][[ end ]]`},
+	}
+	config.ErrorPages = map[string]*ErrorPageConfig{
+		"5xx": {Template: `[[ range .request.headers ]]xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx[[ end ]]`},
+	}
+
+	upstream := 0
+	handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		upstream++
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}), config, "output")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// A reject condition past the limit fails to render and does not reject,
+	// and an error page past the limit falls back to the plain error
+	req := httptest.NewRequest("GET", "/?flood=a&flood=b", nil)
+	req.Header.Set("X-One", "1")
+	req.Header.Set("X-Two", "2")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if upstream != 1 {
+		t.Errorf("Expected the request to reach the upstream, got %d calls", upstream)
+	}
+	if rec.Code != http.StatusServiceUnavailable || strings.Contains(rec.Body.String(), "xxxx") {
+		t.Errorf("Unexpected response %d %.100s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "max_template_output_bytes") {
+		t.Errorf("Expected the output limit error, got %s", rec.Body.String())
+	}
+}
+
+func TestTemplateOutput_Limit(t *testing.T) {
+	ctx := &TemplateContext{}
+	ctx.setOutputLimit(4)
+
+	out := newTemplateOutput(ctx)
+	if _, err := io.WriteString(out, "abcd"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if _, err := io.WriteString(out, "e"); !errors.Is(err, errTemplateOutputLimit) {
+		t.Errorf("Expected errTemplateOutputLimit, got %v", err)
+	}
+	if out.String() != "abcd" {
+		t.Errorf("Expected the output before the limit, got %q", out.String())
+	}
+
+	if _, err := io.WriteString(newTemplateOutput(nil), strings.Repeat("x", 1<<16)); err != nil {
+		t.Errorf("Expected no limit without a context, got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package traefik_modifier_plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// TenantConfig holds the multi-tenant overlay configuration
+type TenantConfig struct {
+	Key       string `json:"key,omitempty"`
+	Directory string `json:"directory,omitempty"`
+}
+
+// TenantOverlay holds the templates a tenant file overrides
+type TenantOverlay struct {
+	ModifierRequest  string            `json:"modifier_request,omitempty"`
+	ModifierResponse map[string]string `json:"modifier_response,omitempty"`
+	ModifierQuery    *QueryConfig      `json:"modifier_query,omitempty"`
+	ModifierHeader   HeaderConfig      `json:"modifier_header,omitempty"`
+}
+
+// Tenants selects tenant-specific header, query and body modifiers with a
+// templated tenant key
+type Tenants struct {
+	key      *template.Template
+	overlays map[string]*tenantModifiers
+}
+
+// tenantModifiers are the base modifiers with a tenant overlay applied
+type tenantModifiers struct {
+	bodyModifier   *BodyModifier
+	queryModifier  *QueryModifier
+	headerModifier *HeaderModifier
+}
+
+// NewTenants loads every <tenant>.json overlay in the configured directory
+// and merges it over the base templates
+func NewTenants(config *TenantConfig, base *Config, funcs template.FuncMap) (*Tenants, error) {
+	if config.Key == "" {
+		return nil, errors.New("tenant key template is required")
+	}
+	if config.Directory == "" {
+		return nil, errors.New("tenant directory is required")
+	}
+
+	key, err := template.New("tenant[key]").Funcs(funcs).Delims("[[", "]]").Parse(config.Key)
+	if err != nil {
+		return nil, newTemplateError("tenant[key]", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(config.Directory, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid tenant directory: %w", err)
+	}
+
+	t := &Tenants{
+		key:      key,
+		overlays: make(map[string]*tenantModifiers, len(files)),
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tenant file: %w", err)
+		}
+		var overlay TenantOverlay
+		if err := json.Unmarshal(data, &overlay); err != nil {
+			return nil, fmt.Errorf("invalid tenant file %s: %w", filepath.Base(file), err)
+		}
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		if t.overlays[name], err = mergeTenantOverlay(base, &overlay, funcs); err != nil {
+			return nil, fmt.Errorf("invalid tenant file %s: %w", filepath.Base(file), err)
+		}
+	}
+
+	return t, nil
+}
+
+// mergeTenantOverlay builds the modifiers of a tenant. Header, query and
+// response templates are merged per key and query remove and allow lists
+// are combined; the request template replaces the base template when set.
+func mergeTenantOverlay(base *Config, overlay *TenantOverlay, funcs template.FuncMap) (*tenantModifiers, error) {
+	requestTemplate := base.ModifierRequest
+	if overlay.ModifierRequest != "" {
+		requestTemplate = overlay.ModifierRequest
+	}
+
+	responseTemplates := make(map[string]string, len(base.ModifierResponse)+len(overlay.ModifierResponse))
+	for status, tmpl := range base.ModifierResponse {
+		responseTemplates[status] = tmpl
+	}
+	for status, tmpl := range overlay.ModifierResponse {
+		responseTemplates[status] = tmpl
+	}
+
+	transforms := make(map[string]string)
+	var remove, allow []string
+	if base.ModifierQuery != nil {
+		for name, tmpl := range base.ModifierQuery.Transform {
+			transforms[name] = tmpl
+		}
+		remove = append(remove, base.ModifierQuery.Remove...)
+		allow = append(allow, base.ModifierQuery.Allow...)
+	}
+	if overlay.ModifierQuery != nil {
+		for name, tmpl := range overlay.ModifierQuery.Transform {
+			transforms[name] = tmpl
+		}
+		remove = append(remove, overlay.ModifierQuery.Remove...)
+		allow = append(allow, overlay.ModifierQuery.Allow...)
+	}
+
+	headers := make(HeaderConfig, len(base.ModifierHeader)+len(overlay.ModifierHeader))
+	for name, tmpl := range base.ModifierHeader {
+		headers[name] = tmpl
+	}
+	for name, tmpl := range overlay.ModifierHeader {
+		headers[name] = tmpl
+	}
+
+	tm := &tenantModifiers{
+		bodyModifier: NewBodyModifierWithFuncs(requestTemplate, responseTemplates, funcs),
+	}
+	// Base expressions apply unless the tenant overrides them with a template
+	requestJq, requestJMESPath := base.ModifierRequestJq, base.ModifierRequestJMESPath
+	if overlay.ModifierRequest != "" {
+		requestJq, requestJMESPath = "", ""
+	}
+	tm.bodyModifier.SetJq(requestJq, inheritedPrograms(base.ModifierResponseJq, overlay.ModifierResponse))
+	tm.bodyModifier.SetJMESPath(requestJMESPath, inheritedPrograms(base.ModifierResponseJMESPath, overlay.ModifierResponse))
+	tm.bodyModifier.SetResponseConditions(inheritedConditions(base.ModifierResponseWhen, overlay.ModifierResponse))
+	tm.bodyModifier.SetRequestFormat(base.ModifierRequestFormat)
+	tm.bodyModifier.SetMaxBuffer(base.MaxBufferBytes)
+	tm.bodyModifier.SetBodyLimits(base.MaxRequestBodyBytes, base.MaxResponseBodyBytes, base.BodyLimitAction, base.BodyLimitResponse)
+	tm.bodyModifier.SetStreamContentTypes(base.StreamContentTypes)
+	tm.bodyModifier.SetStreamTemplate(base.ModifierResponseStream)
+	tm.bodyModifier.SetMaskedHeaders(maskedHeadersConfig(base))
+	if len(transforms) > 0 || len(remove) > 0 || len(allow) > 0 {
+		tm.queryModifier = NewQueryModifierWithFuncs(transforms, funcs)
+		if err := tm.queryModifier.SetRemove(remove); err != nil {
+			return nil, err
+		}
+		if err := tm.queryModifier.SetAllow(allow); err != nil {
+			return nil, err
+		}
+		tm.queryModifier.SetPreserveRawQuery(base.ModifierQuery != nil && base.ModifierQuery.PreserveRawQuery)
+	}
+	if len(headers) > 0 {
+		tm.headerModifier = NewHeaderModifierWithFuncs(headers, funcs)
+		if err := tm.headerModifier.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := tm.bodyModifier.Validate(); err != nil {
+		return nil, err
+	}
+	if tm.queryModifier != nil {
+		if err := tm.queryModifier.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return tm, nil
+}
+
+// Resolve renders the tenant key for req and returns the tenant with its
+// modifiers, or nil modifiers when the tenant has no overlay
+func (t *Tenants) Resolve(req *http.Request, ctx *TemplateContext) (string, *tenantModifiers, error) {
+	templateData := buildTemplateData(ctx, map[string]interface{}{
+		"request": requestTemplateData(req),
+	})
+
+	buf := newTemplateOutput(ctx)
+	err := t.key.Execute(buf, templateData)
+	name := strings.TrimSpace(buf.String())
+	buf.release()
+	if err != nil {
+		return "", nil, newTemplateError("tenant[key]", err)
+	}
+	if name == "" || name == "<no value>" {
+		return "", nil, nil
+	}
+	return name, t.overlays[name], nil
+}
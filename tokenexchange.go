@@ -0,0 +1,187 @@
+package traefik_modifier_plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	accessTokenType        = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// TokenExchangeConfig holds the OAuth2 token exchange (RFC 8693) configuration
+type TokenExchangeConfig struct {
+	TokenURL           string `json:"token_url,omitempty"`
+	ClientID           string `json:"client_id,omitempty"`
+	ClientSecret       string `json:"client_secret,omitempty"`
+	Audience           string `json:"audience,omitempty"`
+	Resource           string `json:"resource,omitempty"`
+	Scope              string `json:"scope,omitempty"`
+	RequestedTokenType string `json:"requested_token_type,omitempty"`
+	Header             string `json:"header,omitempty"`
+	Timeout            string `json:"timeout,omitempty"`
+	FailOpen           bool   `json:"fail_open,omitempty"`
+}
+
+// TokenExchanger exchanges incoming bearer tokens for downstream-audience tokens
+type TokenExchanger struct {
+	config *TokenExchangeConfig
+	header string
+	client *http.Client
+	cache  *ttlCache
+}
+
+// tokenExchangeResponse is the token endpoint response
+type tokenExchangeResponse struct {
+	AccessToken      string `json:"access_token"`
+	IssuedTokenType  string `json:"issued_token_type"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// NewTokenExchanger creates a new token exchanger
+func NewTokenExchanger(config *TokenExchangeConfig) (*TokenExchanger, error) {
+	if config.TokenURL == "" {
+		return nil, errors.New("token exchange token_url is required")
+	}
+
+	te := &TokenExchanger{
+		config: config,
+		header: config.Header,
+		client: &http.Client{Timeout: 5 * time.Second},
+		cache:  newTTLCache(time.Hour, 0),
+	}
+	if te.header == "" {
+		te.header = "Authorization"
+	}
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token exchange timeout: %w", err)
+		}
+		te.client.Timeout = timeout
+	}
+
+	return te, nil
+}
+
+// ModifyRequest replaces the incoming bearer token with the exchanged token.
+// Requests without a bearer token are left untouched.
+func (te *TokenExchanger) ModifyRequest(req *http.Request) error {
+	subjectToken := bearerToken(req.Header)
+	if subjectToken == "" {
+		return nil
+	}
+
+	token, err := te.Exchange(subjectToken)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(te.header, "Bearer "+token)
+	return nil
+}
+
+// Exchange returns a downstream token for the subject token, cached per subject
+func (te *TokenExchanger) Exchange(subjectToken string) (string, error) {
+	cacheKey := tokenCacheKey(subjectToken)
+	if token, ok := te.cache.Get(cacheKey); ok {
+		return token.(string), nil
+	}
+
+	form := url.Values{
+		"grant_type":         {tokenExchangeGrantType},
+		"subject_token":      {subjectToken},
+		"subject_token_type": {accessTokenType},
+	}
+	requestedTokenType := te.config.RequestedTokenType
+	if requestedTokenType == "" {
+		requestedTokenType = accessTokenType
+	}
+	form.Set("requested_token_type", requestedTokenType)
+	if te.config.Audience != "" {
+		form.Set("audience", te.config.Audience)
+	}
+	if te.config.Resource != "" {
+		form.Set("resource", te.config.Resource)
+	}
+	if te.config.Scope != "" {
+		form.Set("scope", te.config.Scope)
+	}
+
+	req, err := http.NewRequest("POST", te.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if te.config.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(te.config.ClientID), url.QueryEscape(te.config.ClientSecret))
+	}
+
+	res, err := te.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token exchange: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", fmt.Errorf("token exchange: %w", err)
+	}
+
+	var resp tokenExchangeResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("token exchange: invalid response (status %d): %w", res.StatusCode, err)
+	}
+	if res.StatusCode != http.StatusOK || resp.AccessToken == "" {
+		if resp.Error != "" {
+			return "", fmt.Errorf("token exchange: %s: %s", resp.Error, resp.ErrorDescription)
+		}
+		return "", fmt.Errorf("token exchange: token endpoint returned %d", res.StatusCode)
+	}
+
+	te.cache.SetWithTTL(cacheKey, resp.AccessToken, tokenCacheTTL(subjectToken, resp.ExpiresIn))
+	return resp.AccessToken, nil
+}
+
+// tokenCacheKey derives the cache key from the subject claim and a hash of the token,
+// so unverified tokens claiming the same subject never share an exchanged token
+func tokenCacheKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	subject := ""
+	if claims, err := decodeJWTClaims(token); err == nil {
+		subject, _ = claims["sub"].(string)
+	}
+	return subject + "\x00" + hex.EncodeToString(sum[:])
+}
+
+// tokenCacheTTL bounds the cache lifetime by the issued token lifetime and
+// the expiry of the subject token, keeping a small safety margin
+func tokenCacheTTL(subjectToken string, expiresIn int) time.Duration {
+	ttl := 5 * time.Minute
+	if expiresIn > 0 {
+		ttl = time.Duration(expiresIn) * time.Second
+	}
+
+	if claims, err := decodeJWTClaims(subjectToken); err == nil {
+		if exp, ok := claims["exp"].(float64); ok {
+			if remaining := time.Until(time.Unix(int64(exp), 0)); remaining < ttl {
+				ttl = remaining
+			}
+		}
+	}
+
+	return ttl - ttl/10
+}
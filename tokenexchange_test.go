@@ -0,0 +1,69 @@
+package traefik_modifier_plugin
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTokenExchanger_ModifyRequest(t *testing.T) {
+	calls := 0
+	sts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls++
+		req.ParseForm()
+		user, pass, _ := req.BasicAuth()
+		if user != "gateway" || pass != "secret" ||
+			req.Form.Get("grant_type") != tokenExchangeGrantType ||
+			req.Form.Get("audience") != "orders-api" {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(`{"error": "invalid_request"}`))
+			return
+		}
+		if req.Form.Get("subject_token") == "invalid" {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(`{"error": "invalid_grant", "error_description": "subject token expired"}`))
+			return
+		}
+		rw.Write([]byte(`{"access_token": "exchanged-` + req.Form.Get("subject_token")[:6] + `", "token_type": "Bearer", "expires_in": 300}`))
+	}))
+	defer sts.Close()
+
+	te, err := NewTokenExchanger(&TokenExchangeConfig{
+		TokenURL:     sts.URL,
+		ClientID:     "gateway",
+		ClientSecret: "secret",
+		Audience:     "orders-api",
+	})
+	if err != nil {
+		t.Fatalf("NewTokenExchanger() error = %v", err)
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub": "user-1"}`))
+	subjectToken := "header." + payload + ".signature"
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		req.Header.Set("Authorization", "Bearer "+subjectToken)
+		if err := te.ModifyRequest(req); err != nil {
+			t.Fatalf("ModifyRequest() error = %v", err)
+		}
+		if req.Header.Get("Authorization") != "Bearer exchanged-header" {
+			t.Errorf("Unexpected Authorization %q", req.Header.Get("Authorization"))
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected exchanged token to be cached, got %d calls", calls)
+	}
+
+	// Requests without bearer token are untouched
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	if err := te.ModifyRequest(req); err != nil || req.Header.Get("Authorization") != "" {
+		t.Errorf("Expected request without token to be untouched")
+	}
+
+	req.Header.Set("Authorization", "Bearer invalid")
+	if err := te.ModifyRequest(req); err == nil || err.Error() != "token exchange: invalid_grant: subject token expired" {
+		t.Errorf("Expected invalid_grant error, got %v", err)
+	}
+}
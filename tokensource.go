@@ -0,0 +1,50 @@
+package traefik_modifier_plugin
+
+import (
+	"sync"
+	"time"
+)
+
+// maxTokenRefreshMargin caps how long before expiry a cached token is refreshed
+const maxTokenRefreshMargin = 5 * time.Minute
+
+// cachedToken caches a token obtained by fetch and refreshes it shortly
+// before it expires
+type cachedToken struct {
+	fetch func() (string, time.Time, error)
+	now   func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	refreshAt time.Time
+}
+
+// newCachedToken creates a token cache around fetch
+func newCachedToken(fetch func() (string, time.Time, error)) *cachedToken {
+	return &cachedToken{fetch: fetch, now: time.Now}
+}
+
+// Token returns the cached token, fetching a new one when none is cached or
+// the current one is about to expire
+func (ct *cachedToken) Token() (string, error) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	now := ct.now()
+	if ct.token != "" && now.Before(ct.refreshAt) {
+		return ct.token, nil
+	}
+
+	token, expires, err := ct.fetch()
+	if err != nil {
+		return "", err
+	}
+
+	margin := expires.Sub(now) / 10
+	if margin > maxTokenRefreshMargin {
+		margin = maxTokenRefreshMargin
+	}
+	ct.token = token
+	ct.refreshAt = expires.Add(-margin)
+	return token, nil
+}
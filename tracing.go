@@ -0,0 +1,426 @@
+package traefik_modifier_plugin
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OTLP span kinds
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+)
+
+// TracingConfig holds the OpenTelemetry trace export configuration. Spans
+// are posted as OTLP/HTTP JSON to Endpoint, e.g.
+// http://otel-collector:4318/v1/traces.
+type TracingConfig struct {
+	Endpoint    string            `json:"endpoint,omitempty"`
+	ServiceName string            `json:"service_name,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Timeout     string            `json:"timeout,omitempty"`
+	QueueSize   int               `json:"queue_size,omitempty"`
+}
+
+// Tracer records spans for the modification phases of each request and
+// exports them in the background
+type Tracer struct {
+	endpoint    string
+	serviceName string
+	headers     map[string]string
+	client      *http.Client
+	slots       chan struct{}
+}
+
+// requestTrace holds the spans of one request
+type requestTrace struct {
+	tracer  *Tracer
+	traceID string
+	root    *span
+
+	mu      sync.Mutex
+	spans   []*span
+	current *span
+}
+
+// span is a timed phase of a request
+type span struct {
+	trace      *requestTrace
+	id         string
+	parentID   string
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+	err        string
+}
+
+// NewTracer creates a new span exporter
+func NewTracer(config *TracingConfig) (*Tracer, error) {
+	if u, err := url.Parse(config.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid tracing endpoint %q", config.Endpoint)
+	}
+
+	t := &Tracer{
+		endpoint:    config.Endpoint,
+		serviceName: config.ServiceName,
+		headers:     config.Headers,
+		client:      &http.Client{Timeout: 5 * time.Second},
+	}
+	if t.serviceName == "" {
+		t.serviceName = "traefik-modifier-plugin"
+	}
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tracing timeout: %w", err)
+		}
+		t.client.Timeout = timeout
+	}
+
+	queueSize := config.QueueSize
+	if queueSize <= 0 {
+		queueSize = 100
+	}
+	t.slots = make(chan struct{}, queueSize)
+
+	return t, nil
+}
+
+// Start begins the plugin span of req as a child of its W3C traceparent, or
+// of a new trace. It returns nil when the incoming trace is not sampled.
+func (t *Tracer) Start(req *http.Request, ctx *TemplateContext, middleware string) *requestTrace {
+	if t == nil {
+		return nil
+	}
+
+	traceID, parentID, sampled := parseTraceparent(req.Header.Get("traceparent"))
+	if !sampled {
+		return nil
+	}
+	if traceID == "" {
+		traceID = randomHex(16)
+	}
+
+	rt := &requestTrace{tracer: t, traceID: traceID}
+	rt.root = &span{
+		trace:    rt,
+		id:       randomHex(8),
+		parentID: parentID,
+		name:     "modifier " + middleware,
+		kind:     spanKindInternal,
+		start:    time.Now(),
+		attributes: map[string]interface{}{
+			"traefik.middleware":  middleware,
+			"http.request.method": req.Method,
+			"url.path":            req.URL.Path,
+		},
+	}
+	rt.spans = append(rt.spans, rt.root)
+	if ctx != nil {
+		(*ctx)[tracingKey] = rt
+	}
+	return rt
+}
+
+// requestTracing returns the trace stored in the template context ctx
+func requestTracing(ctx *TemplateContext) *requestTrace {
+	if ctx == nil {
+		return nil
+	}
+	rt, _ := (*ctx)[tracingKey].(*requestTrace)
+	return rt
+}
+
+// parseTraceparent returns the trace and parent span IDs of a version 00
+// traceparent header and whether it is sampled. Missing or malformed
+// headers start a new sampled trace.
+func parseTraceparent(value string) (string, string, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) != 4 || parts[0] != "00" || !validTraceHex(parts[1], 32) || !validTraceHex(parts[2], 16) || !validTraceHex(parts[3], 2) {
+		return "", "", true
+	}
+	flags, _ := strconv.ParseUint(parts[3], 16, 8)
+	return parts[1], parts[2], flags&1 == 1
+}
+
+// validTraceHex reports whether s is a non-zero lowercase hex ID of length n
+func validTraceHex(s string, n int) bool {
+	if len(s) != n || strings.Trim(s, "0123456789abcdef") != "" {
+		return false
+	}
+	return n == 2 || strings.Trim(s, "0") != ""
+}
+
+// randomHex returns n random bytes as hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// startSpan begins a phase span under the plugin span. Templates executed
+// until it finishes are recorded on it.
+func (rt *requestTrace) startSpan(name string) *span {
+	if rt == nil {
+		return nil
+	}
+	s := &span{
+		trace:      rt,
+		id:         randomHex(8),
+		parentID:   rt.root.id,
+		name:       name,
+		kind:       spanKindInternal,
+		start:      time.Now(),
+		attributes: map[string]interface{}{},
+	}
+	rt.mu.Lock()
+	rt.spans = append(rt.spans, s)
+	rt.current = s
+	rt.mu.Unlock()
+	return s
+}
+
+// templateExecuted adds name to the templates of the current phase span
+func (rt *requestTrace) templateExecuted(name string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.current != nil {
+		templates, _ := rt.current.attributes["modifier.templates"].([]string)
+		rt.current.attributes["modifier.templates"] = append(templates, name)
+	}
+}
+
+// set adds an attribute to the span
+func (s *span) set(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.trace.mu.Lock()
+	s.attributes[key] = value
+	s.trace.mu.Unlock()
+}
+
+// finish ends the span, marking it failed when err is not nil
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.trace.mu.Lock()
+	defer s.trace.mu.Unlock()
+	s.end = time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+	if s.trace.current == s {
+		s.trace.current = nil
+	}
+}
+
+// Handler wraps the upstream so each call gets a client span, which becomes
+// the parent of the upstream through the traceparent header
+func (rt *requestTrace) Handler(next http.Handler) http.Handler {
+	if rt == nil {
+		return next
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		s := rt.startSpan("upstream")
+		s.kind = spanKindClient
+		req.Header.Set("traceparent", fmt.Sprintf("00-%s-%s-01", rt.traceID, s.id))
+
+		sw := &spanResponseWriter{ResponseWriter: rw}
+		next.ServeHTTP(sw, req)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		s.set("http.response.status_code", sw.status)
+		s.set("http.response.body.size", sw.written)
+		var err error
+		if sw.status >= http.StatusInternalServerError {
+			err = errors.New(http.StatusText(sw.status))
+		}
+		s.finish(err)
+	})
+}
+
+// spanResponseWriter records the status and size of an upstream response
+type spanResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	written int
+}
+
+func (sw *spanResponseWriter) WriteHeader(statusCode int) {
+	if sw.status == 0 && statusCode >= http.StatusOK {
+		sw.status = statusCode
+	}
+	sw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (sw *spanResponseWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.Write(b)
+	sw.written += n
+	return n, err
+}
+
+// Flush forwards flushes of streamed responses
+func (sw *spanResponseWriter) Flush() {
+	if flusher, ok := sw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack forwards connection upgrades
+func (sw *spanResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// finish ends the plugin span and queues the spans of the request for
+// export, dropping them when the queue is full
+func (rt *requestTrace) finish() {
+	if rt == nil {
+		return
+	}
+	rt.root.finish(nil)
+
+	t := rt.tracer
+	select {
+	case t.slots <- struct{}{}:
+	default:
+		log.Printf("Tracing queue full, dropping spans")
+		return
+	}
+
+	rt.mu.Lock()
+	payload, err := json.Marshal(rt.otlp())
+	rt.mu.Unlock()
+	if err != nil {
+		<-t.slots
+		log.Printf("Tracing export error: %v", err)
+		return
+	}
+
+	go func() {
+		defer func() { <-t.slots }()
+		if err := t.export(payload); err != nil {
+			log.Printf("Tracing export to %s failed: %v", t.endpoint, err)
+		}
+	}()
+}
+
+// export posts an OTLP/HTTP JSON payload
+func (t *Tracer) export(payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+
+	res, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// otlp returns the OTLP JSON export request of the spans
+func (rt *requestTrace) otlp() map[string]interface{} {
+	spans := make([]interface{}, 0, len(rt.spans))
+	for _, s := range rt.spans {
+		end := s.end
+		if end.IsZero() {
+			end = rt.root.end
+		}
+		otlpSpan := map[string]interface{}{
+			"traceId":           rt.traceID,
+			"spanId":            s.id,
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attributes),
+		}
+		if s.parentID != "" {
+			otlpSpan["parentSpanId"] = s.parentID
+		}
+		if s.err != "" {
+			otlpSpan["status"] = map[string]interface{}{"code": 2, "message": s.err}
+		}
+		spans = append(spans, otlpSpan)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]interface{}{"service.name": rt.tracer.serviceName}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "traefik-modifier-plugin"},
+				"spans": spans,
+			}},
+		}},
+	}
+}
+
+// otlpAttributes converts attributes to OTLP key values, sorted by key
+func otlpAttributes(attributes map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, map[string]interface{}{"key": key, "value": otlpValue(attributes[key])})
+	}
+	return result
+}
+
+// otlpValue converts an attribute value to an OTLP any value
+func otlpValue(value interface{}) map[string]interface{} {
+	switch v := value.(type) {
+	case int:
+		return map[string]interface{}{"intValue": strconv.Itoa(v)}
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case []string:
+		values := make([]interface{}, 0, len(v))
+		for _, s := range v {
+			values = append(values, otlpValue(s))
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	}
+	return map[string]interface{}{"stringValue": fmt.Sprint(value)}
+}
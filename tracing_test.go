@@ -0,0 +1,103 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestModifier_Tracing(t *testing.T) {
+	exports := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		exports <- body
+	}))
+	defer collector.Close()
+
+	config := CreateConfig()
+	config.Tracing = &TracingConfig{Endpoint: collector.URL + "/v1/traces", ServiceName: "gateway"}
+	config.ModifierHeader = HeaderConfig{"X-Method": "[[ .request.method ]]"}
+	config.ModifierRequest = `{"name": "[[ .request.api.body.name ]]"}`
+	config.ModifierResponse = map[string]string{"200": `{"wrapped": [[ toJSON .response.body ]]}`}
+
+	var traceparent string
+	handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		traceparent = req.Header.Get("traceparent")
+		io.WriteString(rw, `{"id":1}`)
+	}), config, "orders")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/orders", strings.NewReader(`{"name": "book"}`))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var payload struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID      string `json:"traceId"`
+					SpanID       string `json:"spanId"`
+					ParentSpanID string `json:"parentSpanId"`
+					Name         string `json:"name"`
+					Attributes   []struct {
+						Key string `json:"key"`
+					} `json:"attributes"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	select {
+	case body := <-exports:
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Fatalf("Invalid OTLP payload %s: %v", body, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected spans to be exported")
+	}
+
+	spans := payload.ResourceSpans[0].ScopeSpans[0].Spans
+	ids := map[string]string{}
+	for _, s := range spans {
+		if s.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("Expected the incoming trace ID on %s, got %s", s.Name, s.TraceID)
+		}
+		ids[s.Name] = s.SpanID
+	}
+	for _, name := range []string{"modifier orders", phaseHeader, phaseRequest, "upstream", phaseResponse} {
+		if ids[name] == "" {
+			t.Errorf("Expected a %s span in %+v", name, spans)
+		}
+	}
+	if spans[0].ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("Expected the plugin span to continue the incoming span, got parent %q", spans[0].ParentSpanID)
+	}
+	if expected := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + ids["upstream"] + "-01"; traceparent != expected {
+		t.Errorf("Expected upstream traceparent %s, got %s", expected, traceparent)
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		value   string
+		traceID string
+		sampled bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", "4bf92f3577b34da6a3ce929d0e0e4736", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", "", true},
+		{"garbage", "", true},
+	}
+	for _, tt := range tests {
+		traceID, _, sampled := parseTraceparent(tt.value)
+		if traceID != tt.traceID || sampled != tt.sampled {
+			t.Errorf("parseTraceparent(%q) = %q, %v; expected %q, %v", tt.value, traceID, sampled, tt.traceID, tt.sampled)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package traefik_modifier_plugin
+
+import "strings"
+
+// traefikMetadata returns the .traefik data for the middleware instance
+// name passed by Traefik, e.g. "orders-modifier@file". Traefik does not pass
+// router or service names to plugins, so they are not part of the data.
+func traefikMetadata(name string) map[string]interface{} {
+	middleware, provider := name, ""
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		middleware, provider = name[:i], name[i+1:]
+	}
+	return map[string]interface{}{
+		"middlewareName": name,
+		"middleware":     middleware,
+		"provider":       provider,
+	}
+}
@@ -0,0 +1,34 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestModifier_TraefikMetadata(t *testing.T) {
+	config := CreateConfig()
+	config.ModifierHeader = HeaderConfig{
+		"X-Route": `[[ if eq .traefik.middleware "orders-modifier" ]]orders[[ else ]]other[[ end ]]@[[ .traefik.provider ]]`,
+	}
+
+	var received string
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		received = req.Header.Get("X-Route")
+	})
+
+	handler, err := New(context.Background(), next, config, "orders-modifier@file")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil))
+
+	if received != "orders@file" {
+		t.Errorf("Expected orders@file, got %s", received)
+	}
+
+	if metadata := traefikMetadata("plain"); metadata["middleware"] != "plain" || metadata["provider"] != "" {
+		t.Errorf("Unexpected metadata for unqualified name: %v", metadata)
+	}
+}
@@ -0,0 +1,228 @@
+package traefik_modifier_plugin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// maxS3PresignExpiry is the longest lifetime S3 accepts for presigned URLs
+const maxS3PresignExpiry = 7 * 24 * time.Hour
+
+// URLSigningConfig holds the pre-signed URL configuration
+type URLSigningConfig struct {
+	DefaultExpiry string        `json:"default_expiry,omitempty"`
+	HMACSecret    string        `json:"hmac_secret,omitempty"`
+	S3            *S3SignConfig `json:"s3,omitempty"`
+}
+
+// S3SignConfig holds the S3 Signature Version 4 presigning configuration
+type S3SignConfig struct {
+	Bucket          string `json:"bucket,omitempty"`
+	Region          string `json:"region,omitempty"`
+	Endpoint        string `json:"endpoint,omitempty"`
+	AccessKeyID     string `json:"access_key_id,omitempty"`
+	SecretAccessKey string `json:"secret_access_key,omitempty"`
+	SessionToken    string `json:"session_token,omitempty"`
+}
+
+// URLSigner rewrites object keys and links into time-limited URLs
+type URLSigner struct {
+	defaultExpiry time.Duration
+	hmacSecret    []byte
+	s3            *S3SignConfig
+	s3Endpoint    *url.URL
+	now           func() time.Time
+}
+
+// NewURLSigner creates a new URL signer
+func NewURLSigner(config *URLSigningConfig) (*URLSigner, error) {
+	if config.HMACSecret == "" && config.S3 == nil {
+		return nil, errors.New("url signing requires hmac_secret or s3")
+	}
+
+	us := &URLSigner{
+		defaultExpiry: 15 * time.Minute,
+		hmacSecret:    []byte(config.HMACSecret),
+		s3:            config.S3,
+		now:           time.Now,
+	}
+
+	if config.DefaultExpiry != "" {
+		expiry, err := time.ParseDuration(config.DefaultExpiry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid url signing default_expiry: %w", err)
+		}
+		us.defaultExpiry = expiry
+	}
+
+	if s3 := config.S3; s3 != nil {
+		if s3.Region == "" || s3.AccessKeyID == "" || s3.SecretAccessKey == "" {
+			return nil, errors.New("s3 url signing requires region, access_key_id and secret_access_key")
+		}
+		endpoint := s3.Endpoint
+		if endpoint == "" {
+			if s3.Bucket == "" {
+				return nil, errors.New("s3 url signing requires bucket or endpoint")
+			}
+			endpoint = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", s3.Bucket, s3.Region)
+		}
+		parsed, err := url.Parse(strings.TrimRight(endpoint, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+		}
+		us.s3Endpoint = parsed
+	}
+
+	return us, nil
+}
+
+// FuncMap returns the URL signing template functions
+func (us *URLSigner) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"signURL":   us.SignURL,
+		"signS3URL": us.SignS3URL,
+	}
+}
+
+// expiry parses the optional expiry argument of the template functions
+func (us *URLSigner) expiry(args []string) (time.Duration, error) {
+	if len(args) == 0 || args[0] == "" {
+		return us.defaultExpiry, nil
+	}
+	expiry, err := time.ParseDuration(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid expiry: %w", err)
+	}
+	return expiry, nil
+}
+
+// SignURL appends expires and an HMAC-SHA256 signature over the path and
+// sorted query to rawURL
+func (us *URLSigner) SignURL(rawURL string, expiry ...string) (string, error) {
+	if len(us.hmacSecret) == 0 {
+		return "", errors.New("signURL: hmac_secret is not configured")
+	}
+	lifetime, err := us.expiry(expiry)
+	if err != nil {
+		return "", fmt.Errorf("signURL: %w", err)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("signURL: %w", err)
+	}
+
+	query := u.Query()
+	query.Del("signature")
+	query.Set("expires", strconv.FormatInt(us.now().Add(lifetime).Unix(), 10))
+
+	mac := hmac.New(sha256.New, us.hmacSecret)
+	mac.Write([]byte(u.EscapedPath() + "?" + query.Encode()))
+	query.Set("signature", hex.EncodeToString(mac.Sum(nil)))
+
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// SignS3URL returns an S3 Signature Version 4 presigned GET URL for key
+func (us *URLSigner) SignS3URL(key string, expiry ...string) (string, error) {
+	if us.s3 == nil {
+		return "", errors.New("signS3URL: s3 is not configured")
+	}
+	lifetime, err := us.expiry(expiry)
+	if err != nil {
+		return "", fmt.Errorf("signS3URL: %w", err)
+	}
+	if lifetime < time.Second || lifetime > maxS3PresignExpiry {
+		return "", errors.New("signS3URL: expiry must be between 1s and 7 days")
+	}
+
+	now := us.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/" + us.s3.Region + "/s3/aws4_request"
+
+	path := us.s3Endpoint.Path + "/" + strings.TrimLeft(key, "/")
+	canonicalURI := awsURIEncode(path, false)
+
+	query := map[string]string{
+		"X-Amz-Algorithm":     "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":    us.s3.AccessKeyID + "/" + scope,
+		"X-Amz-Date":          amzDate,
+		"X-Amz-Expires":       strconv.FormatInt(int64(lifetime/time.Second), 10),
+		"X-Amz-SignedHeaders": "host",
+	}
+	if us.s3.SessionToken != "" {
+		query["X-Amz-Security-Token"] = us.s3.SessionToken
+	}
+	canonicalQuery := awsCanonicalQuery(query)
+
+	canonicalRequest := strings.Join([]string{
+		"GET",
+		canonicalURI,
+		canonicalQuery,
+		"host:" + us.s3Endpoint.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+us.s3.SecretAccessKey), now.Format("20060102"))
+	signingKey = hmacSHA256(signingKey, us.s3.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	return us.s3Endpoint.Scheme + "://" + us.s3Endpoint.Host + canonicalURI + "?" +
+		canonicalQuery + "&X-Amz-Signature=" + signature, nil
+}
+
+// hmacSHA256 computes HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsCanonicalQuery encodes query parameters sorted by name as required by SigV4
+func awsCanonicalQuery(query map[string]string) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = awsURIEncode(name, true) + "=" + awsURIEncode(query[name], true)
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsURIEncode percent-encodes everything except unreserved characters.
+// Slashes are kept unless encodeSlash is set.
+func awsURIEncode(value string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
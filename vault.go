@@ -0,0 +1,443 @@
+package traefik_modifier_plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// VaultConfig holds the HashiCorp Vault secrets provider configuration
+type VaultConfig struct {
+	Address             string            `json:"address,omitempty"`
+	Namespace           string            `json:"namespace,omitempty"`
+	Token               string            `json:"token,omitempty"`
+	KubernetesRole      string            `json:"kubernetes_role,omitempty"`
+	KubernetesMountPath string            `json:"kubernetes_mount_path,omitempty"`
+	KubernetesTokenPath string            `json:"kubernetes_token_path,omitempty"`
+	Timeout             string            `json:"timeout,omitempty"`
+	RefreshInterval     string            `json:"refresh_interval,omitempty"`
+	Secrets             map[string]string `json:"secrets,omitempty"`
+}
+
+const defaultKubernetesTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// VaultProvider fetches secrets from Vault and keeps token and leases renewed
+type VaultProvider struct {
+	address         string
+	namespace       string
+	staticToken     string
+	role            string
+	mountPath       string
+	tokenPath       string
+	refreshInterval time.Duration
+	preload         map[string]string
+	client          *http.Client
+	now             func() time.Time
+
+	// mu guards the token state, the secret cache and the pending fetches;
+	// it is never held across Vault calls. authMu serializes logins and
+	// token renewals.
+	mu          sync.Mutex
+	authMu      sync.Mutex
+	token       string
+	tokenExpiry time.Time
+	renewable   bool
+	secrets     map[string]*vaultSecret
+	pending     map[string]*vaultRead
+}
+
+// vaultRead is an in-flight refresh of a secret path that concurrent reads
+// of the same path wait for
+type vaultRead struct {
+	done chan struct{}
+	data map[string]interface{}
+	err  error
+}
+
+// vaultSecret is a cached secret with its lease information. Cached secrets
+// are not modified; renewals store a copy.
+type vaultSecret struct {
+	data      map[string]interface{}
+	leaseID   string
+	renewable bool
+	fetchedAt time.Time
+	expires   time.Time
+}
+
+// vaultResponse is the common envelope of Vault API responses
+type vaultResponse struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+// NewVaultProvider creates a new Vault secrets provider
+func NewVaultProvider(config *VaultConfig) (*VaultProvider, error) {
+	if config.Address == "" {
+		return nil, errors.New("vault address is required")
+	}
+	if config.Token == "" && config.KubernetesRole == "" {
+		return nil, errors.New("vault requires either token or kubernetes_role")
+	}
+
+	vp := &VaultProvider{
+		address:         strings.TrimRight(config.Address, "/"),
+		namespace:       config.Namespace,
+		staticToken:     config.Token,
+		role:            config.KubernetesRole,
+		mountPath:       config.KubernetesMountPath,
+		tokenPath:       config.KubernetesTokenPath,
+		refreshInterval: 5 * time.Minute,
+		preload:         config.Secrets,
+		client:          &http.Client{Timeout: 5 * time.Second},
+		now:             time.Now,
+		secrets:         make(map[string]*vaultSecret),
+		pending:         make(map[string]*vaultRead),
+	}
+
+	if vp.mountPath == "" {
+		vp.mountPath = "kubernetes"
+	}
+	if vp.tokenPath == "" {
+		vp.tokenPath = defaultKubernetesTokenPath
+	}
+
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vault timeout: %w", err)
+		}
+		vp.client.Timeout = timeout
+	}
+	if config.RefreshInterval != "" {
+		interval, err := time.ParseDuration(config.RefreshInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vault refresh_interval: %w", err)
+		}
+		vp.refreshInterval = interval
+	}
+
+	return vp, nil
+}
+
+// FuncMap returns the Vault template functions
+func (vp *VaultProvider) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"secret": vp.Secret,
+	}
+}
+
+// Prefetch reads the configured secrets so a wrong path or missing
+// permission fails at startup rather than on the first request
+func (vp *VaultProvider) Prefetch() error {
+	for name, path := range vp.preload {
+		if _, err := vp.Read(path); err != nil {
+			return fmt.Errorf("vault secret %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Values returns the configured secrets keyed by name for the .vault
+// template variable. Secrets are renewed or refetched as they age; a secret
+// that cannot be refreshed after it expired is left out.
+func (vp *VaultProvider) Values() map[string]interface{} {
+	values := make(map[string]interface{}, len(vp.preload))
+	for name, path := range vp.preload {
+		data, err := vp.Read(path)
+		if err != nil {
+			log.Printf("Vault secret %s unavailable: %v", name, err)
+			continue
+		}
+		values[name] = data
+	}
+	return values
+}
+
+// Secret returns a single key of the secret stored at path
+func (vp *VaultProvider) Secret(path, key string) (string, error) {
+	data, err := vp.Read(path)
+	if err != nil {
+		return "", err
+	}
+
+	value, exists := data[key]
+	if !exists {
+		return "", fmt.Errorf("vault: key %q not found in %s", key, path)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// Read returns the data of the secret stored at path, fetching or renewing
+// it when needed. Concurrent reads of a path share a single refresh.
+func (vp *VaultProvider) Read(path string) (map[string]interface{}, error) {
+	path = strings.Trim(path, "/")
+
+	vp.mu.Lock()
+	now := vp.now()
+	secret, cached := vp.secrets[path]
+	if cached && now.Before(secret.renewAt()) {
+		vp.mu.Unlock()
+		return secret.data, nil
+	}
+	if call, exists := vp.pending[path]; exists {
+		vp.mu.Unlock()
+		<-call.done
+		return call.data, call.err
+	}
+	call := &vaultRead{done: make(chan struct{})}
+	vp.pending[path] = call
+	vp.mu.Unlock()
+
+	call.data, call.err = vp.refresh(path, secret, now)
+
+	vp.mu.Lock()
+	delete(vp.pending, path)
+	vp.mu.Unlock()
+	close(call.done)
+	return call.data, call.err
+}
+
+// refresh renews or refetches the secret at path; secret is the cached
+// version, or nil
+func (vp *VaultProvider) refresh(path string, secret *vaultSecret, now time.Time) (map[string]interface{}, error) {
+	// Try to extend the lease of renewable secrets before refetching
+	if secret != nil && secret.renewable && secret.leaseID != "" && now.Before(secret.expires) {
+		renewed, err := vp.renewLease(secret)
+		if err == nil {
+			vp.store(path, renewed)
+			return renewed.data, nil
+		}
+		log.Printf("Vault lease renewal failed for %s: %v", path, err)
+	}
+
+	fresh, err := vp.fetch(path)
+	if err != nil {
+		if secret != nil && now.Before(secret.expires) {
+			// Keep serving the still valid secret
+			log.Printf("Vault refresh failed for %s, using cached secret: %v", path, err)
+			return secret.data, nil
+		}
+		return nil, err
+	}
+
+	vp.store(path, fresh)
+	return fresh.data, nil
+}
+
+// store caches the secret of path
+func (vp *VaultProvider) store(path string, secret *vaultSecret) {
+	vp.mu.Lock()
+	vp.secrets[path] = secret
+	vp.mu.Unlock()
+}
+
+// renewAt returns when a secret should be refreshed (at two thirds of its lifetime)
+func (s *vaultSecret) renewAt() time.Time {
+	return s.fetchedAt.Add(s.expires.Sub(s.fetchedAt) * 2 / 3)
+}
+
+// fetch reads a secret from Vault, unwrapping KV version 2 responses
+func (vp *VaultProvider) fetch(path string) (*vaultSecret, error) {
+	resp, err := vp.request("GET", "/v1/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	data := resp.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, hasMetadata := data["metadata"]; hasMetadata {
+			data = inner
+		}
+	}
+
+	now := vp.now()
+	lifetime := vp.refreshInterval
+	if resp.LeaseDuration > 0 {
+		lifetime = time.Duration(resp.LeaseDuration) * time.Second
+	}
+
+	return &vaultSecret{
+		data:      data,
+		leaseID:   resp.LeaseID,
+		renewable: resp.Renewable,
+		fetchedAt: now,
+		expires:   now.Add(lifetime),
+	}, nil
+}
+
+// renewLease extends the lease of a dynamic secret, returning the renewed copy
+func (vp *VaultProvider) renewLease(secret *vaultSecret) (*vaultSecret, error) {
+	resp, err := vp.request("PUT", "/v1/sys/leases/renew", map[string]interface{}{
+		"lease_id": secret.leaseID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := vp.now()
+	renewed := *secret
+	renewed.fetchedAt = now
+	renewed.expires = now.Add(time.Duration(resp.LeaseDuration) * time.Second)
+	renewed.renewable = resp.Renewable
+	return &renewed, nil
+}
+
+// ensureToken returns a valid client token, logging in or renewing as needed
+func (vp *VaultProvider) ensureToken() (string, error) {
+	if vp.role == "" {
+		return vp.staticToken, nil
+	}
+	if token, valid, _ := vp.currentToken(); valid {
+		return token, nil
+	}
+
+	// Only one caller logs in; the others use its token
+	vp.authMu.Lock()
+	defer vp.authMu.Unlock()
+
+	token, valid, renewable := vp.currentToken()
+	if valid {
+		return token, nil
+	}
+
+	if token != "" && renewable {
+		if err := vp.renewToken(token); err == nil {
+			token, _, _ = vp.currentToken()
+			return token, nil
+		}
+	}
+
+	if err := vp.kubernetesLogin(); err != nil {
+		return "", err
+	}
+	token, _, _ = vp.currentToken()
+	return token, nil
+}
+
+// currentToken returns the client token, whether it can still be used and
+// whether it can be renewed
+func (vp *VaultProvider) currentToken() (string, bool, bool) {
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	now := vp.now()
+	valid := vp.token != "" && (vp.tokenExpiry.IsZero() || now.Before(vp.tokenExpiry.Add(-vp.client.Timeout*2)))
+	return vp.token, valid, vp.renewable
+}
+
+// kubernetesLogin authenticates using the service account token
+func (vp *VaultProvider) kubernetesLogin() error {
+	jwt, err := os.ReadFile(vp.tokenPath)
+	if err != nil {
+		return fmt.Errorf("vault: failed to read kubernetes token: %w", err)
+	}
+
+	resp, err := vp.send("POST", "/v1/auth/"+strings.Trim(vp.mountPath, "/")+"/login", "", map[string]interface{}{
+		"role": vp.role,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	})
+	if err != nil {
+		return err
+	}
+	vp.setAuth(resp)
+	return nil
+}
+
+// renewToken extends the lease of the client token
+func (vp *VaultProvider) renewToken(token string) error {
+	resp, err := vp.send("POST", "/v1/auth/token/renew-self", token, map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	vp.setAuth(resp)
+	return nil
+}
+
+// setAuth stores the client token returned by a login or renew call
+func (vp *VaultProvider) setAuth(resp *vaultResponse) {
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return
+	}
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	vp.token = resp.Auth.ClientToken
+	vp.renewable = resp.Auth.Renewable
+	vp.tokenExpiry = time.Time{}
+	if resp.Auth.LeaseDuration > 0 {
+		vp.tokenExpiry = vp.now().Add(time.Duration(resp.Auth.LeaseDuration) * time.Second)
+	}
+}
+
+// request performs an authenticated Vault API call
+func (vp *VaultProvider) request(method, path string, body interface{}) (*vaultResponse, error) {
+	token, err := vp.ensureToken()
+	if err != nil {
+		return nil, err
+	}
+	return vp.send(method, path, token, body)
+}
+
+// send performs a Vault API call with the given token
+func (vp *VaultProvider) send(method, path, token string, body interface{}) (*vaultResponse, error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, vp.address+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if vp.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", vp.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := vp.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vault: %w", err)
+	}
+	defer res.Body.Close()
+
+	var resp vaultResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("vault: failed to decode response: %w", err)
+	}
+
+	if res.StatusCode >= 300 {
+		if len(resp.Errors) > 0 {
+			return nil, fmt.Errorf("vault: %s %s returned %d: %s", method, path, res.StatusCode, strings.Join(resp.Errors, "; "))
+		}
+		return nil, fmt.Errorf("vault: %s %s returned %d", method, path, res.StatusCode)
+	}
+
+	return &resp, nil
+}
@@ -0,0 +1,197 @@
+package traefik_modifier_plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestVaultProvider_KubernetesLoginAndKV2(t *testing.T) {
+	var logins, reads, renewals int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v1/auth/kubernetes/login":
+			logins++
+			var body map[string]string
+			json.NewDecoder(req.Body).Decode(&body)
+			if body["role"] != "gateway" || body["jwt"] != "sa-token" {
+				rw.WriteHeader(http.StatusForbidden)
+				return
+			}
+			rw.Write([]byte(`{"auth": {"client_token": "s.client", "lease_duration": 3600, "renewable": true}}`))
+		case "/v1/secret/data/upstream":
+			reads++
+			if req.Header.Get("X-Vault-Token") != "s.client" {
+				rw.WriteHeader(http.StatusForbidden)
+				rw.Write([]byte(`{"errors": ["permission denied"]}`))
+				return
+			}
+			rw.Write([]byte(`{"data": {"data": {"api_key": "upstream-key", "port": 8080}, "metadata": {"version": 3}}}`))
+		case "/v1/database/creds/readonly":
+			reads++
+			rw.Write([]byte(`{"lease_id": "database/creds/readonly/abc", "lease_duration": 60, "renewable": true, "data": {"username": "v-user"}}`))
+		case "/v1/sys/leases/renew":
+			renewals++
+			rw.Write([]byte(`{"lease_id": "database/creds/readonly/abc", "lease_duration": 60, "renewable": true}`))
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("sa-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	vp, err := NewVaultProvider(&VaultConfig{
+		Address:             server.URL,
+		KubernetesRole:      "gateway",
+		KubernetesTokenPath: tokenPath,
+	})
+	if err != nil {
+		t.Fatalf("NewVaultProvider() error = %v", err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	vp.now = func() time.Time { return now }
+
+	value, err := vp.Secret("secret/data/upstream", "api_key")
+	if err != nil || value != "upstream-key" {
+		t.Fatalf("Secret() = %q, %v", value, err)
+	}
+	value, err = vp.Secret("secret/data/upstream", "port")
+	if err != nil || value != "8080" {
+		t.Fatalf("Secret() port = %q, %v", value, err)
+	}
+	if _, err := vp.Secret("secret/data/upstream", "missing"); err == nil {
+		t.Errorf("Expected error for missing key")
+	}
+
+	// Dynamic secret lease is renewed instead of refetched
+	if _, err := vp.Secret("database/creds/readonly", "username"); err != nil {
+		t.Fatalf("Secret() error = %v", err)
+	}
+	now = now.Add(50 * time.Second)
+	if _, err := vp.Secret("database/creds/readonly", "username"); err != nil {
+		t.Fatalf("Secret() error = %v", err)
+	}
+
+	if logins != 1 || reads != 2 || renewals != 1 {
+		t.Errorf("Expected 1 login, 2 reads and 1 renewal, got %d, %d and %d", logins, reads, renewals)
+	}
+}
+
+func TestVaultProvider_ConcurrentReads(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	reads := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		reads[req.URL.Path]++
+		mu.Unlock()
+		if req.URL.Path == "/v1/secret/slow" {
+			<-release
+		}
+		rw.Write([]byte(`{"data": {"value": "` + req.URL.Path + `"}}`))
+	}))
+	defer server.Close()
+
+	vp, err := NewVaultProvider(&VaultConfig{Address: server.URL, Token: "s.static"})
+	if err != nil {
+		t.Fatalf("NewVaultProvider() error = %v", err)
+	}
+
+	// Concurrent reads of a path share one fetch
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value, err := vp.Secret("secret/slow", "value"); err != nil || value != "/v1/secret/slow" {
+				t.Errorf("Secret() = %q, %v", value, err)
+			}
+		}()
+	}
+
+	// A slow path does not block reads of other paths
+	for {
+		mu.Lock()
+		started := reads["/v1/secret/slow"] > 0
+		mu.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if value, err := vp.Secret("secret/fast", "value"); err != nil || value != "/v1/secret/fast" {
+		t.Errorf("Secret() = %q, %v", value, err)
+	}
+
+	close(release)
+	wg.Wait()
+	if reads["/v1/secret/slow"] != 1 {
+		t.Errorf("Expected a single fetch of the slow path, got %d", reads["/v1/secret/slow"])
+	}
+}
+
+func TestNewVaultProvider_RequiresAuth(t *testing.T) {
+	if _, err := NewVaultProvider(&VaultConfig{Address: "http://vault:8200"}); err == nil {
+		t.Errorf("Expected error without token or kubernetes role")
+	}
+}
+
+func TestModifier_VaultSecretsInContext(t *testing.T) {
+	var reads int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/secret/data/upstream" || req.Header.Get("X-Vault-Token") != "s.static" {
+			rw.WriteHeader(http.StatusForbidden)
+			rw.Write([]byte(`{"errors": ["permission denied"]}`))
+			return
+		}
+		reads++
+		rw.Write([]byte(`{"data": {"data": {"api_key": "short-lived"}, "metadata": {"version": 1}}}`))
+	}))
+	defer server.Close()
+
+	config := CreateConfig()
+	config.Vault = &VaultConfig{
+		Address: server.URL,
+		Token:   "s.static",
+		Secrets: map[string]string{"upstream": "secret/data/upstream"},
+	}
+	config.ModifierHeader = HeaderConfig{"Authorization": "Bearer [[ .vault.upstream.api_key ]]"}
+
+	var authorization string
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		authorization = req.Header.Get("Authorization")
+	})
+
+	handler, err := New(context.Background(), next, config, "vault")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if reads != 1 {
+		t.Errorf("Expected the secret to be fetched at startup, got %d reads", reads)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if authorization != "Bearer short-lived" {
+		t.Errorf("Expected the Vault secret in the header, got %q", authorization)
+	}
+	if reads != 1 {
+		t.Errorf("Expected the cached secret to be reused, got %d reads", reads)
+	}
+
+	// Unreadable secrets fail at startup
+	config.Vault.Secrets["denied"] = "secret/data/other"
+	if _, err := New(context.Background(), next, config, "vault"); err == nil {
+		t.Error("Expected an error for a secret that cannot be read")
+	}
+}
@@ -0,0 +1,136 @@
+package traefik_modifier_plugin
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// XFCC forwarding modes, named after the Envoy options
+const (
+	xfccSanitizeSet   = "sanitize_set"
+	xfccAppendForward = "append_forward"
+)
+
+// XFCCConfig holds the X-Forwarded-Client-Cert configuration
+type XFCCConfig struct {
+	Header  string   `json:"header,omitempty"`
+	Mode    string   `json:"mode,omitempty"`
+	By      string   `json:"by,omitempty"`
+	Details []string `json:"details,omitempty"`
+}
+
+// XFCCBuilder builds an Envoy-compatible X-Forwarded-Client-Cert header from
+// the verified TLS client certificate
+type XFCCBuilder struct {
+	header  string
+	mode    string
+	by      string
+	details []string
+}
+
+// NewXFCCBuilder creates a new XFCC header builder
+func NewXFCCBuilder(config *XFCCConfig) (*XFCCBuilder, error) {
+	xb := &XFCCBuilder{
+		header:  config.Header,
+		mode:    config.Mode,
+		by:      config.By,
+		details: config.Details,
+	}
+	if xb.header == "" {
+		xb.header = "X-Forwarded-Client-Cert"
+	}
+
+	switch xb.mode {
+	case "":
+		xb.mode = xfccSanitizeSet
+	case xfccSanitizeSet, xfccAppendForward:
+	default:
+		return nil, fmt.Errorf("invalid xfcc mode %q", config.Mode)
+	}
+
+	if len(xb.details) == 0 {
+		xb.details = []string{"Hash", "Subject", "URI"}
+	}
+	for _, detail := range xb.details {
+		switch detail {
+		case "Hash", "Cert", "Chain", "Subject", "URI", "DNS":
+		default:
+			return nil, fmt.Errorf("invalid xfcc detail %q", detail)
+		}
+	}
+
+	return xb, nil
+}
+
+// ModifyRequest sets the XFCC header from the client certificate. Headers
+// sent by the client are removed unless mode is append_forward, so backends
+// never trust a spoofed value.
+func (xb *XFCCBuilder) ModifyRequest(req *http.Request) {
+	existing := req.Header.Values(xb.header)
+	req.Header.Del(xb.header)
+
+	var element string
+	if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+		element = xb.element(req.TLS.PeerCertificates)
+	}
+
+	var elements []string
+	if xb.mode == xfccAppendForward {
+		elements = append(elements, existing...)
+	}
+	if element != "" {
+		elements = append(elements, element)
+	}
+	if len(elements) > 0 {
+		req.Header.Set(xb.header, strings.Join(elements, ","))
+	}
+}
+
+// element formats the configured details of a certificate chain as a
+// semicolon separated XFCC element
+func (xb *XFCCBuilder) element(chain []*x509.Certificate) string {
+	cert := chain[0]
+
+	var pairs []string
+	if xb.by != "" {
+		pairs = append(pairs, "By="+xb.by)
+	}
+	for _, detail := range xb.details {
+		switch detail {
+		case "Hash":
+			sum := sha256.Sum256(cert.Raw)
+			pairs = append(pairs, "Hash="+hex.EncodeToString(sum[:]))
+		case "Cert":
+			pairs = append(pairs, `Cert="`+xfccPEM(cert)+`"`)
+		case "Chain":
+			var encoded strings.Builder
+			for _, c := range chain {
+				encoded.WriteString(xfccPEM(c))
+			}
+			pairs = append(pairs, `Chain="`+encoded.String()+`"`)
+		case "Subject":
+			pairs = append(pairs, `Subject="`+strings.ReplaceAll(cert.Subject.String(), `"`, `\"`)+`"`)
+		case "URI":
+			for _, uri := range cert.URIs {
+				pairs = append(pairs, "URI="+uri.String())
+			}
+		case "DNS":
+			for _, name := range cert.DNSNames {
+				pairs = append(pairs, "DNS="+name)
+			}
+		}
+	}
+	return strings.Join(pairs, ";")
+}
+
+// xfccPEM returns the URL-encoded PEM of a certificate
+func xfccPEM(cert *x509.Certificate) string {
+	encoded := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	return strings.ReplaceAll(url.QueryEscape(string(encoded)), "+", "%20")
+}
@@ -0,0 +1,76 @@
+package traefik_modifier_plugin
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestXFCCBuilder_ModifyRequest(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spiffeID, _ := url.Parse("spiffe://cluster.local/ns/default/sa/web")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "web", Organization: []string{"Acme"}},
+		URIs:         []*url.URL{spiffeID},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	sum := sha256.Sum256(der)
+
+	xb, err := NewXFCCBuilder(&XFCCConfig{By: "spiffe://cluster.local/ns/default/sa/gateway"})
+	if err != nil {
+		t.Fatalf("NewXFCCBuilder() error = %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "https://api.example.com/", nil)
+	req.Header.Set("X-Forwarded-Client-Cert", "Hash=spoofed")
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	xb.ModifyRequest(req)
+
+	expected := "By=spiffe://cluster.local/ns/default/sa/gateway;Hash=" + hex.EncodeToString(sum[:]) +
+		`;Subject="CN=web,O=Acme";URI=spiffe://cluster.local/ns/default/sa/web`
+	if got := req.Header.Get("X-Forwarded-Client-Cert"); got != expected {
+		t.Errorf("Unexpected XFCC header:\n%s\nexpected:\n%s", got, expected)
+	}
+
+	// Spoofed headers are removed from requests without a client certificate
+	req = httptest.NewRequest("GET", "https://api.example.com/", nil)
+	req.Header.Set("X-Forwarded-Client-Cert", "Hash=spoofed")
+	xb.ModifyRequest(req)
+	if got := req.Header.Get("X-Forwarded-Client-Cert"); got != "" {
+		t.Errorf("Expected spoofed header to be removed, got %q", got)
+	}
+
+	// append_forward keeps the elements of previous proxies
+	xb, _ = NewXFCCBuilder(&XFCCConfig{Mode: "append_forward", Details: []string{"URI"}})
+	req = httptest.NewRequest("GET", "https://api.example.com/", nil)
+	req.Header.Set("X-Forwarded-Client-Cert", "URI=spiffe://edge")
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	xb.ModifyRequest(req)
+	if got := req.Header.Get("X-Forwarded-Client-Cert"); got != "URI=spiffe://edge,URI=spiffe://cluster.local/ns/default/sa/web" {
+		t.Errorf("Unexpected forwarded XFCC header %q", got)
+	}
+
+	if _, err := NewXFCCBuilder(&XFCCConfig{Details: []string{"Serial"}}); err == nil {
+		t.Errorf("Expected error for unknown detail")
+	}
+}